@@ -171,7 +171,7 @@ function Gallery() {
           connectionIdSet.current = true;
           connectionIdPromiseResolve(data.connectionId); // <-- resolve the promise
           console.log('Received connectionId:', data.connectionId);
-        } else if (data.jobStatus === 'completed') {
+        } else if (data.jobStatus === 'completed' || data.jobStatus === 'completed_with_warnings') {
           setUploading(false);
           setWaitingForWS(false);
           // 10) Client makes the second get call to get the .glb
@@ -10,7 +10,7 @@ cd ./lambda
 echo "Building model-loader-util function..."
 cd ./model-loader-util
 echo "Creating zip file for model-loader-util.go function..."
-GOOS=linux GOARCH=amd64 go build -o bootstrap model-loader-util.go
+GOOS=linux GOARCH=amd64 go build -o bootstrap .
 zip ./model-loader-util.zip bootstrap
 
 cd ../
@@ -49,6 +49,24 @@ echo "Creating zip file for notification.go function..."
 GOOS=linux GOARCH=amd64 go build -o bootstrap notification.go
 zip ./notification.zip bootstrap
 
+cd ../
+
+# Build the native converter function
+echo "Building converter function..."
+cd ./converter
+echo "Creating zip file for converter function..."
+GOOS=linux GOARCH=amd64 go build -o bootstrap .
+zip ./converter.zip bootstrap
+
+cd ../
+
+# Build the http converter dispatcher function
+echo "Building http-dispatcher function..."
+cd ./http-dispatcher
+echo "Creating zip file for http-dispatcher function..."
+GOOS=linux GOARCH=amd64 go build -o bootstrap .
+zip ./http-dispatcher.zip bootstrap
+
 
 cd ../../
 
@@ -1,5 +1,7 @@
+import hashlib
 import json
 import os
+import shutil
 import subprocess
 import logging
 import boto3
@@ -12,9 +14,75 @@ def send_notification(queue_url, message):
     sqs.send_message(QueueUrl=queue_url, MessageBody=json.dumps(message))
     logger.info(f"Notification sent to SQS: {message}")
 
+def job_is_cancelled(table, job_id):
+    """Returns True when the job was cancelled through POST /jobs/{jobId}/cancel."""
+    if not table or not job_id:
+        return False
+    dynamodb = boto3.client('dynamodb')
+    result = dynamodb.get_item(
+        TableName=table,
+        Key={"jobId": {"S": job_id}},
+        ProjectionExpression="jobStatus",
+        ConsistentRead=True,
+    )
+    return result.get("Item", {}).get("jobStatus", {}).get("S") == "cancelled"
+
+def sha256_file(path):
+    digest = hashlib.sha256()
+    with open(path, "rb") as f:
+        for chunk in iter(lambda: f.read(1024 * 1024), b""):
+            digest.update(chunk)
+    return digest.hexdigest()
+
+def upload_outputs(s3, bucket, output_dir, output_file, to_file_type, model_id):
+    """Uploads every file the export produced and returns (new_s3_key, artifacts).
+
+    Single-file exports keep the {toFileType}/{modelId}.{ext} key. Exports with
+    sidecar files (.bin, .mtl, textures) are uploaded under {toFileType}/{modelId}/
+    with their relative layout preserved, so relative URIs keep resolving.
+    """
+    files = []
+    for root, _, names in os.walk(output_dir):
+        for name in names:
+            files.append(os.path.relpath(os.path.join(root, name), output_dir))
+    main_file = os.path.relpath(output_file, output_dir)
+
+    if files == [main_file]:
+        key_for = lambda path: f"{to_file_type}/{path}"
+    else:
+        key_for = lambda path: f"{to_file_type}/{model_id}/{path}"
+
+    artifacts = []
+    for path in sorted(files):
+        local_path = os.path.join(output_dir, path)
+        key = key_for(path)
+        logger.info(f"Uploading {local_path} to s3://{bucket}/{key}")
+        s3.upload_file(local_path, bucket, key)
+        artifacts.append({
+            "path": path,
+            "s3Key": key,
+            "size": os.path.getsize(local_path),
+            "sha256": sha256_file(local_path),
+        })
+    return key_for(main_file), artifacts
+
+def queue_post_process(queue_url, body, export_file_type, intermediate_key):
+    """Hands the export to the native backend, which converts it to toFileType
+    and sends the job's notification."""
+    message = {key: value for key, value in body.items() if key not in ("exportFileType", "postProcess", "backend")}
+    message["converter"] = body.get("postProcess")
+    message["inputS3Key"] = intermediate_key
+    message["inputFileType"] = export_file_type
+    # The options stay on the message: the converter's schema covers both the
+    # export and the post-processing step, which ignores what it doesn't read
+    sqs = boto3.client('sqs')
+    sqs.send_message(QueueUrl=queue_url, MessageBody=json.dumps(message))
+    logger.info(f"Post-processing queued: {message}")
+
 def handler(event, context):
     notification_queue_url = os.environ.get('notification_queue_url')
     bucket = os.environ.get('model_s3_bucket')
+    job_history_table = os.environ.get('job_history_table')
     if not notification_queue_url:
         raise RuntimeError("notification_queue_url environment variable is not set")
     if not bucket:
@@ -31,15 +99,34 @@ def handler(event, context):
             to_file_type = body.get('toFileType')
             model_id = body.get('modelId')
             s3_key = body.get('s3Key')
+            source_main_file = body.get('sourceMainFile', '')
+            # Options arrive as JSON, already checked against the converter's schema
+            options = body.get('options', '{}')
             connection_id = body.get('connectionId')
+            attempt = body.get('attempt')
+            # Formats Blender cannot write are exported as exportFileType and
+            # finished by the native postProcess converter
+            export_file_type = body.get('exportFileType') or to_file_type
+            post_process = body.get('postProcess')
+            # Cancelled jobs are skipped without a notification, the cancel
+            # request already recorded their final status
+            if job_is_cancelled(job_history_table, job_id):
+                logger.info(f"Job {job_id} was cancelled while queued, skipping")
+                continue
+
+            output_dir = f"/tmp/{job_id}"
+            shutil.rmtree(output_dir, ignore_errors=True)
 
             cmd = [
                 "blender", "-b", "-P", "script.py", "--",
                 f"--fromFileType={from_file_type}",
-                f"--toFileType={to_file_type}",
+                f"--toFileType={export_file_type}",
                 f"--modelId={model_id}",
                 f"--s3Key={s3_key}",
-                f"--jobType={job_type}"
+                f"--mainFile={source_main_file}",
+                f"--options={options}",
+                f"--jobType={job_type}",
+                f"--outputDir={output_dir}"
             ]
             logger.info(f"Running Blender command: {' '.join(cmd)}")
             result = subprocess.run(cmd, capture_output=True, text=True, env=os.environ.copy())
@@ -56,10 +143,26 @@ def handler(event, context):
             if not output_file or not os.path.exists(output_file):
                 raise RuntimeError("Output file not found after Blender conversion.")
 
+            if job_is_cancelled(job_history_table, job_id):
+                logger.info(f"Job {job_id} was cancelled during conversion, discarding output")
+                shutil.rmtree(output_dir, ignore_errors=True)
+                continue
+
             s3 = boto3.client('s3')
-            new_s3_key = f"{to_file_type}/{os.path.basename(output_file)}"
-            logger.info(f"Uploading {output_file} to s3://{bucket}/{new_s3_key}")
-            s3.upload_file(output_file, bucket, new_s3_key)
+            if post_process:
+                native_jobs_queue_url = os.environ.get('native_jobs_queue_url')
+                if not native_jobs_queue_url:
+                    raise RuntimeError("native_jobs_queue_url environment variable is not set")
+                # The export sits under the output prefix of the final format,
+                # so it is removed with the model if post-processing never runs
+                intermediate_key = f"{to_file_type}/{model_id}/{os.path.basename(output_file)}"
+                logger.info(f"Uploading {output_file} to s3://{bucket}/{intermediate_key}")
+                s3.upload_file(output_file, bucket, intermediate_key)
+                shutil.rmtree(output_dir, ignore_errors=True)
+                queue_post_process(native_jobs_queue_url, body, export_file_type, intermediate_key)
+                continue
+
+            new_s3_key, artifacts = upload_outputs(s3, bucket, output_dir, output_file, to_file_type, model_id)
 
             notification = {
                 "connectionId": connection_id,
@@ -71,6 +174,8 @@ def handler(event, context):
                 "modelId": model_id,
                 "s3Key": s3_key,
                 "newS3Key": new_s3_key,
+                "artifacts": artifacts,
+                "attempt": attempt,
             }
             send_notification(notification_queue_url, notification)
 
@@ -86,7 +191,8 @@ def handler(event, context):
                 "modelId": body.get('modelId') if 'body' in locals() else None,
                 "s3Key": body.get('s3Key') if 'body' in locals() else None,
                 "newS3Key": new_s3_key if 'new_s3_key' in locals() else None,
-                "error": str(e)
+                "error": str(e),
+                "attempt": body.get('attempt') if 'body' in locals() else None,
             }
             send_notification(notification_queue_url, error_notification)
 
@@ -1,5 +1,9 @@
 import sys
 import os
+import json
+import zipfile
+import shutil
+import tempfile
 import boto3
 import traceback
 
@@ -32,6 +36,11 @@ s3_key = params.get("s3Key")
 from_file_type = params.get("fromFileType")
 to_file_type = params.get("toFileType")
 model_id = params.get("modelId")
+output_dir = params.get("outputDir", "/tmp")
+# The .blend file to open inside a blend-zip, found when the upload was validated
+main_file = params.get("mainFile", "")
+# Export settings from the converter registry, with their defaults filled in
+options = json.loads(params.get("options") or "{}")
 
 
 # S3 client
@@ -39,9 +48,15 @@ s3 = boto3.client("s3")
 
 # File paths
 input_ext = from_file_type if from_file_type else "blend"
+if input_ext == "blend-zip":
+    input_ext = "zip"
 output_ext = to_file_type if to_file_type else "glb"
 input_file = f"/tmp/{model_id}.{input_ext}"
-output_file = f"/tmp/{model_id}.{output_ext}"
+os.makedirs(output_dir, exist_ok=True)
+output_file = f"{output_dir}/{model_id}.{output_ext}"
+# Where a blend-zip is extracted, removed after the conversion so a warm
+# Lambda never mixes in files from an earlier archive
+extract_dir = None
 
 try:
     # Download the input file from S3
@@ -52,6 +67,35 @@ try:
     if from_file_type == "blend":
         print(f"Opening Blender file: {input_file}")
         bpy.ops.wm.open_mainfile(filepath=input_file)
+    elif from_file_type == "blend-zip":
+        # The archive was checked for unsafe paths before the job was queued.
+        # Extracting it keeps the relative paths the .blend file references.
+        extract_dir = tempfile.mkdtemp(prefix=f"{model_id}-source-")
+        print(f"Extracting {input_file} to {extract_dir}")
+        with zipfile.ZipFile(input_file) as archive:
+            archive.extractall(extract_dir)
+        main_path = os.path.join(extract_dir, main_file)
+        if not main_file or not os.path.isfile(main_path):
+            raise ValueError(f"Main .blend file {main_file!r} not found in the archive")
+        print(f"Opening Blender file: {main_path}")
+        bpy.ops.wm.open_mainfile(filepath=main_path)
+    elif from_file_type in ("fbx", "obj", "gltf", "glb", "stl", "ply", "usd", "usdz"):
+        # Other formats are imported into an empty scene, so the default cube,
+        # camera and light don't end up in the export
+        bpy.ops.wm.read_factory_settings(use_empty=True)
+        print(f"Importing {from_file_type} file: {input_file}")
+        if from_file_type == "fbx":
+            bpy.ops.import_scene.fbx(filepath=input_file)
+        elif from_file_type == "obj":
+            bpy.ops.import_scene.obj(filepath=input_file)
+        elif from_file_type in ("gltf", "glb"):
+            bpy.ops.import_scene.gltf(filepath=input_file)
+        elif from_file_type == "stl":
+            bpy.ops.import_mesh.stl(filepath=input_file)
+        elif from_file_type == "ply":
+            bpy.ops.import_mesh.ply(filepath=input_file)
+        else:
+            bpy.ops.wm.usd_import(filepath=input_file)
     else:
         raise ValueError(f"Unsupported input file type: {from_file_type}")
 
@@ -62,7 +106,7 @@ try:
             export_format='GLB',
             export_texcoords=True,
             export_normals=True,
-            export_yup=True
+            export_yup=options.get("yUp", True)
             )
     elif to_file_type == "gltf":
         bpy.ops.export_scene.gltf(
@@ -70,26 +114,24 @@ try:
             export_format='GLTF_SEPARATE',
             export_texcoords=True,
             export_normals=True,
-            export_yup=True
+            export_yup=options.get("yUp", True)
         )
     elif to_file_type == "obj":
+        # Copy referenced textures next to the .obj/.mtl so the whole set can be uploaded
         bpy.ops.export_scene.obj(
             filepath=output_file,
-            use_materials=True
+            use_materials=True,
+            path_mode='COPY'
         )
     elif to_file_type == "fbx":
         bpy.ops.export_scene.fbx(
             filepath=output_file,
             use_selection=False,
-            apply_unit_scale=True,
+            apply_unit_scale=options.get("applyUnitScale", True),
             bake_space_transform=True
         )
     elif to_file_type == "usd":
         bpy.ops.wm.usd_export(filepath=output_file)
-    elif to_file_type == "usdz":
-        # Export as .usd first
-        intermediate_usd = output_file.replace(".usdz", ".usd")
-        bpy.ops.wm.usd_export(filepath=intermediate_usd)
     else:
         raise ValueError(f"Unsupported output file type: {to_file_type}")
 
@@ -100,4 +142,7 @@ try:
 except Exception as e:
     print("Error during Blender conversion:")
     traceback.print_exc()
-    sys.exit(1)
\ No newline at end of file
+    sys.exit(1)
+finally:
+    if extract_dir:
+        shutil.rmtree(extract_dir, ignore_errors=True)
\ No newline at end of file
@@ -0,0 +1,396 @@
+// Package blendfile reads the container format of Blender's .blend files
+// without Blender: the file header, the file-block directory and the names of
+// the data-blocks a file holds. It does not interpret mesh or scene data.
+package blendfile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+var (
+	ErrNotBlendFile = errors.New("missing BLENDER magic")
+	ErrTruncated    = errors.New("file ends before its ENDB block")
+)
+
+const (
+	magic = "BLENDER"
+	// legacyHeaderSize is the header written before Blender 5.0,
+	// BLENDER_v300 for example
+	legacyHeaderSize = 12
+	// MaxHeaderSize covers the header written since Blender 5.0,
+	// BLENDER17-01v0500 for example
+	MaxHeaderSize = 17
+	// idBlockPrefix is how much of every data-block of interest is kept until
+	// the DNA1 block at the end of the file says where its name is
+	idBlockPrefix = 8192
+	// sceneBlockPrefix is kept of scenes instead, whose unit settings come
+	// after the render settings
+	sceneBlockPrefix = 64 * 1024
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+type Header struct {
+	PointerSize  int
+	LittleEndian bool
+	// Version is the Blender version that wrote the file, 402 for 4.2
+	Version int
+	// FormatVersion is 0 for the 12 byte header, 1 for the 17 byte header
+	// that uses 64-bit block lengths
+	FormatVersion int
+	Size          int
+}
+
+// Block is one entry of the file-block directory
+type Block struct {
+	// Code is DATA, DNA1, REND, GLOB or similar, or a two letter data-block
+	// type such as OB for objects
+	Code string
+	// Offset is where the block's data starts in the decompressed file
+	Offset     int64
+	Length     int64
+	OldAddress uint64
+	SDNAIndex  int
+	Count      int64
+}
+
+// UnitSystem is the unit system a scene is modelled in
+type UnitSystem string
+
+const (
+	UnitSystemNone     UnitSystem = "none"
+	UnitSystemMetric   UnitSystem = "metric"
+	UnitSystemImperial UnitSystem = "imperial"
+)
+
+// Units are the unit settings of a scene. System is empty when the settings
+// could not be read.
+type Units struct {
+	System UnitSystem
+	// ScaleLength is the number of meters in one Blender unit
+	ScaleLength float64
+}
+
+type File struct {
+	Header
+	Compression Compression
+	Blocks      []Block
+	Scenes      []string
+	Objects     []string
+	Meshes      []string
+	Materials   []string
+	Images      []string
+	// Libraries are the paths of linked .blend files as stored, usually
+	// relative to the file and starting with //
+	Libraries []string
+	// ExternalImages are the paths of images that are not packed into the
+	// file, stored like Libraries
+	ExternalImages []string
+	// SceneUnits are the unit settings of each of Scenes
+	SceneUnits []Units
+}
+
+// idCodes are the data-block types File lists
+var idCodes = []string{"SC", "OB", "ME", "MA", "IM", "LI"}
+
+// DetectCompression reports how a .blend file starting with prefix is
+// compressed. Blender compressed with gzip before 3.0 and with zstd since.
+func DetectCompression(prefix []byte) Compression {
+	switch {
+	case bytes.HasPrefix(prefix, gzipMagic):
+		return CompressionGzip
+	case bytes.HasPrefix(prefix, zstdMagic):
+		return CompressionZstd
+	}
+	return CompressionNone
+}
+
+func parseDigits(data []byte) (int, error) {
+	for _, c := range data {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("invalid header number %q", data)
+		}
+	}
+	return strconv.Atoi(string(data))
+}
+
+// ParseHeader parses the header at the start of an uncompressed .blend file.
+// data needs to hold MaxHeaderSize bytes unless the file is shorter.
+func ParseHeader(data []byte) (Header, error) {
+	if len(data) < len(magic) || string(data[:len(magic)]) != magic {
+		return Header{}, ErrNotBlendFile
+	}
+	if len(data) < legacyHeaderSize {
+		return Header{}, fmt.Errorf("header is %d bytes: %w", len(data), ErrTruncated)
+	}
+
+	var header Header
+	pointerSize, endianness, version := data[7], data[8], data[9:12]
+	if data[7] >= '0' && data[7] <= '9' {
+		if len(data) < MaxHeaderSize {
+			return Header{}, fmt.Errorf("header is %d bytes: %w", len(data), ErrTruncated)
+		}
+		size, err := parseDigits(data[7:9])
+		if err != nil {
+			return Header{}, err
+		}
+		if size != MaxHeaderSize || data[9] != '-' {
+			return Header{}, fmt.Errorf("unsupported header size %d", size)
+		}
+		if header.FormatVersion, err = parseDigits(data[10:12]); err != nil {
+			return Header{}, err
+		}
+		if header.FormatVersion != 1 {
+			return Header{}, fmt.Errorf("unsupported file format version %d", header.FormatVersion)
+		}
+		// Format version 1 always uses 8 byte pointers
+		pointerSize, endianness, version = '-', data[12], data[13:17]
+		header.Size = MaxHeaderSize
+	} else {
+		header.Size = legacyHeaderSize
+	}
+
+	switch pointerSize {
+	case '_':
+		header.PointerSize = 4
+	case '-':
+		header.PointerSize = 8
+	default:
+		return Header{}, fmt.Errorf("invalid pointer size %q", pointerSize)
+	}
+	switch endianness {
+	case 'v':
+		header.LittleEndian = true
+	case 'V':
+		header.LittleEndian = false
+	default:
+		return Header{}, fmt.Errorf("invalid endianness %q", endianness)
+	}
+	var err error
+	if header.Version, err = parseDigits(version); err != nil {
+		return Header{}, err
+	}
+	return header, nil
+}
+
+func (h Header) byteOrder() binary.ByteOrder {
+	if h.LittleEndian {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+func (h Header) blockHeaderSize() int {
+	if h.FormatVersion == 1 {
+		return 32
+	}
+	return 16 + h.PointerSize
+}
+
+func (h Header) parseBlockHeader(data []byte) Block {
+	order := h.byteOrder()
+	block := Block{Code: string(bytes.TrimRight(data[:4], "\x00"))}
+	if h.FormatVersion == 1 {
+		block.SDNAIndex = int(int32(order.Uint32(data[4:8])))
+		block.OldAddress = order.Uint64(data[8:16])
+		block.Length = int64(order.Uint64(data[16:24]))
+		block.Count = int64(order.Uint64(data[24:32]))
+		return block
+	}
+	block.Length = int64(int32(order.Uint32(data[4:8])))
+	rest := data[8:]
+	if h.PointerSize == 8 {
+		block.OldAddress = order.Uint64(rest[:8])
+		rest = rest[8:]
+	} else {
+		block.OldAddress = uint64(order.Uint32(rest[:4]))
+		rest = rest[4:]
+	}
+	block.SDNAIndex = int(int32(order.Uint32(rest[:4])))
+	block.Count = int64(int32(order.Uint32(rest[4:8])))
+	return block
+}
+
+// decompress returns a reader over the uncompressed file
+func decompress(r *bufio.Reader) (io.Reader, Compression, func(), error) {
+	prefix, _ := r.Peek(len(zstdMagic))
+	switch compression := DetectCompression(prefix); compression {
+	case CompressionGzip:
+		gzipReader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, compression, nil, err
+		}
+		return bufio.NewReader(gzipReader), compression, func() { gzipReader.Close() }, nil
+	case CompressionZstd:
+		zstdReader, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, compression, nil, err
+		}
+		return bufio.NewReader(zstdReader), compression, zstdReader.Close, nil
+	}
+	return r, CompressionNone, func() {}, nil
+}
+
+// Inspect reads a whole .blend file, compressed or not, and returns its
+// header, block directory and data-block names. Only the DNA1 block and the
+// start of the data-blocks it lists are held in memory.
+func Inspect(r io.Reader) (*File, error) {
+	reader, compression, closeReader, err := decompress(bufio.NewReader(r))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing %s: %w", compression, err)
+	}
+	defer closeReader()
+
+	headerData := make([]byte, MaxHeaderSize)
+	n, err := io.ReadFull(reader, headerData[:legacyHeaderSize])
+	if n == 0 || !bytes.HasPrefix(headerData[:n], []byte(magic)[:min(n, len(magic))]) {
+		return nil, ErrNotBlendFile
+	}
+	if err != nil {
+		return nil, ErrTruncated
+	}
+	if headerData[7] >= '0' && headerData[7] <= '9' {
+		if _, err := io.ReadFull(reader, headerData[legacyHeaderSize:]); err != nil {
+			return nil, ErrTruncated
+		}
+	} else {
+		headerData = headerData[:legacyHeaderSize]
+	}
+	header, err := ParseHeader(headerData)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{Header: header, Compression: compression}
+	offset := int64(header.Size)
+	blockHeader := make([]byte, header.blockHeaderSize())
+	var idBlocks []idBlock
+	var dna *sdna
+	for {
+		if _, err := io.ReadFull(reader, blockHeader); err != nil {
+			return nil, ErrTruncated
+		}
+		offset += int64(len(blockHeader))
+		block := header.parseBlockHeader(blockHeader)
+		if block.Length < 0 {
+			return nil, fmt.Errorf("block %s at %d has a negative length", block.Code, offset)
+		}
+		block.Offset = offset
+		file.Blocks = append(file.Blocks, block)
+		if block.Code == "ENDB" {
+			break
+		}
+
+		var kept []byte
+		switch {
+		case block.Code == "DNA1":
+			kept = make([]byte, block.Length)
+		case block.Code == "SC":
+			kept = make([]byte, min(block.Length, sceneBlockPrefix))
+		case isIDCode(block.Code):
+			kept = make([]byte, min(block.Length, idBlockPrefix))
+		}
+		if _, err := io.ReadFull(reader, kept); err != nil {
+			return nil, ErrTruncated
+		}
+		if skipped, err := io.CopyN(io.Discard, reader, block.Length-int64(len(kept))); err != nil {
+			return nil, fmt.Errorf("block %s at %d has %d of %d bytes: %w", block.Code, offset, int64(len(kept))+skipped, block.Length, ErrTruncated)
+		}
+		offset += block.Length
+
+		if block.Code == "DNA1" {
+			if dna, err = parseSDNA(kept, header); err != nil {
+				return nil, fmt.Errorf("parsing DNA1 block: %w", err)
+			}
+		} else if kept != nil {
+			idBlocks = append(idBlocks, idBlock{block: block, data: kept})
+		}
+	}
+	if dna == nil {
+		return nil, errors.New("file has no DNA1 block")
+	}
+
+	for _, idBlock := range idBlocks {
+		file.addIDBlock(dna, idBlock.block, idBlock.data)
+	}
+	return file, nil
+}
+
+// idBlock is the start of a data-block whose name is read once the DNA1 block
+// has been parsed
+type idBlock struct {
+	block Block
+	data  []byte
+}
+
+func isIDCode(code string) bool {
+	for _, idCode := range idCodes {
+		if code == idCode {
+			return true
+		}
+	}
+	return false
+}
+
+// cString returns the NUL terminated string at the start of data
+func cString(data []byte) string {
+	if end := bytes.IndexByte(data, 0); end >= 0 {
+		data = data[:end]
+	}
+	return string(data)
+}
+
+func (f *File) addIDBlock(dna *sdna, block Block, data []byte) {
+	nameField, ok := dna.field("ID", "name")
+	if !ok || len(data) < nameField.offset+nameField.size {
+		return
+	}
+	// ID names start with their two letter type, OBCube for example
+	name := cString(data[nameField.offset : nameField.offset+nameField.size])
+	if len(name) > 2 {
+		name = name[2:]
+	}
+
+	switch block.Code {
+	case "SC":
+		f.Scenes = append(f.Scenes, name)
+		f.SceneUnits = append(f.SceneUnits, dna.units(data))
+	case "OB":
+		f.Objects = append(f.Objects, name)
+	case "ME":
+		f.Meshes = append(f.Meshes, name)
+	case "MA":
+		f.Materials = append(f.Materials, name)
+	case "IM":
+		f.Images = append(f.Images, name)
+		// Before 2.8 the stored paths were the name members of Image and Library
+		path := dna.stringField("Image", data, "filepath", "name")
+		if path != "" && !dna.pointerSet("Image", data, "packedfile", "packedfiles") {
+			f.ExternalImages = append(f.ExternalImages, path)
+		}
+	case "LI":
+		if path := dna.stringField("Library", data, "filepath", "name"); path != "" {
+			f.Libraries = append(f.Libraries, path)
+		}
+	}
+}
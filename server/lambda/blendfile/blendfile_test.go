@@ -0,0 +1,259 @@
+package blendfile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+type testBlock struct {
+	code string
+	data []byte
+}
+
+// testSDNA describes ID as two pointers and name[66], Library as an ID
+// followed by filepath[1024], Image as a Library with a packedfile pointer and
+// Scene as an ID followed by UnitSettings, which is all Inspect reads
+func testSDNA(order binary.ByteOrder, pointerSize int) []byte {
+	var buf bytes.Buffer
+	align := func() {
+		for buf.Len()%4 != 0 {
+			buf.WriteByte(0)
+		}
+	}
+	writeInt32 := func(v int) { binary.Write(&buf, order, int32(v)) }
+	writeInt16 := func(v int) { binary.Write(&buf, order, int16(v)) }
+
+	names := []string{"*next", "*prev", "name[66]", "id", "filepath[1024]", "*packedfile", "unit", "scale_length", "system"}
+	types := []string{"char", "ID", "Library", "Image", "PackedFile", "float", "UnitSettings", "Scene"}
+	buf.WriteString("SDNANAME")
+	writeInt32(len(names))
+	for _, name := range names {
+		buf.WriteString(name + "\x00")
+	}
+	align()
+	buf.WriteString("TYPE")
+	writeInt32(len(types))
+	for _, name := range types {
+		buf.WriteString(name + "\x00")
+	}
+	align()
+	buf.WriteString("TLEN")
+	idLength := 2*pointerSize + 66
+	for _, length := range []int{1, idLength, idLength + 1024, idLength + 1024 + pointerSize, 16, 4, 5, idLength + 5} {
+		writeInt16(length)
+	}
+	align()
+	buf.WriteString("STRC")
+	writeInt32(5)
+	// ID: ID *next, ID *prev, char name[66]
+	for _, v := range []int{1, 3, 1, 0, 1, 1, 0, 2} {
+		writeInt16(v)
+	}
+	// Library: ID id, char filepath[1024]
+	for _, v := range []int{2, 2, 1, 3, 0, 4} {
+		writeInt16(v)
+	}
+	// Image: ID id, char filepath[1024], PackedFile *packedfile
+	for _, v := range []int{3, 3, 1, 3, 0, 4, 4, 5} {
+		writeInt16(v)
+	}
+	// UnitSettings: float scale_length, char system
+	for _, v := range []int{6, 2, 5, 7, 0, 8} {
+		writeInt16(v)
+	}
+	// Scene: ID id, UnitSettings unit
+	for _, v := range []int{7, 2, 1, 3, 6, 6} {
+		writeInt16(v)
+	}
+	return buf.Bytes()
+}
+
+func testIDBlock(code string, name string, pointerSize int, extra []byte) testBlock {
+	data := make([]byte, 2*pointerSize+66)
+	copy(data[2*pointerSize:], code+name)
+	return testBlock{code: code, data: append(data, extra...)}
+}
+
+func buildBlendFile(header string, blocks []testBlock) []byte {
+	h, err := ParseHeader([]byte(header))
+	if err != nil {
+		panic(err)
+	}
+	order := h.byteOrder()
+	pointerSize := h.PointerSize
+
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	blocks = append(blocks, testBlock{code: "DNA1", data: testSDNA(order, pointerSize)}, testBlock{code: "ENDB"})
+	for i, block := range blocks {
+		code := make([]byte, 4)
+		copy(code, block.code)
+		buf.Write(code)
+		if h.FormatVersion == 1 {
+			binary.Write(&buf, order, int32(0))
+			binary.Write(&buf, order, uint64(0x1000+i))
+			binary.Write(&buf, order, int64(len(block.data)))
+			binary.Write(&buf, order, int64(1))
+		} else {
+			binary.Write(&buf, order, int32(len(block.data)))
+			if pointerSize == 8 {
+				binary.Write(&buf, order, uint64(0x1000+i))
+			} else {
+				binary.Write(&buf, order, uint32(0x1000+i))
+			}
+			binary.Write(&buf, order, int32(0))
+			binary.Write(&buf, order, int32(1))
+		}
+		buf.Write(block.data)
+	}
+	return buf.Bytes()
+}
+
+func testPath(path string, packed bool, pointerSize int) []byte {
+	data := make([]byte, 1024+pointerSize)
+	copy(data, path)
+	if packed {
+		data[1024] = 0x10
+	}
+	return data
+}
+
+// testUnits are UnitSettings with the given system and scale
+func testUnits(order binary.ByteOrder, system byte, scaleLength float32) []byte {
+	data := make([]byte, 5)
+	order.PutUint32(data, math.Float32bits(scaleLength))
+	data[4] = system
+	return data
+}
+
+func testScene(header string) []byte {
+	h, _ := ParseHeader([]byte(header))
+	return buildBlendFile(header, []testBlock{
+		{code: "REND", data: make([]byte, 8)},
+		testIDBlock("SC", "Scene", h.PointerSize, testUnits(h.byteOrder(), 1, 0.01)),
+		testIDBlock("OB", "Cube", h.PointerSize, make([]byte, 32)),
+		{code: "DATA", data: make([]byte, 100)},
+		testIDBlock("OB", "Light", h.PointerSize, nil),
+		testIDBlock("ME", "Cube", h.PointerSize, nil),
+		testIDBlock("MA", "Material", h.PointerSize, nil),
+		testIDBlock("IM", "wood.png", h.PointerSize, testPath("//textures/wood.png", false, h.PointerSize)),
+		testIDBlock("IM", "logo.png", h.PointerSize, testPath("//logo.png", true, h.PointerSize)),
+		testIDBlock("LI", "shared.blend", h.PointerSize, testPath("//libs/shared.blend", false, 0)),
+	})
+}
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		data   string
+		header Header
+	}{
+		{"BLENDER-v402", Header{PointerSize: 8, LittleEndian: true, Version: 402, Size: 12}},
+		{"BLENDER_V279", Header{PointerSize: 4, LittleEndian: false, Version: 279, Size: 12}},
+		{"BLENDER17-01v0500", Header{PointerSize: 8, LittleEndian: true, Version: 500, FormatVersion: 1, Size: 17}},
+	}
+	for _, tt := range tests {
+		header, err := ParseHeader([]byte(tt.data))
+		assert.NoError(t, err, tt.data)
+		assert.Equal(t, tt.header, header, tt.data)
+	}
+}
+
+func TestParseHeader_Invalid(t *testing.T) {
+	_, err := ParseHeader([]byte("PK\x03\x04 not a blend"))
+	assert.ErrorIs(t, err, ErrNotBlendFile)
+
+	_, err = ParseHeader([]byte("BLENDER-v"))
+	assert.ErrorIs(t, err, ErrTruncated)
+
+	_, err = ParseHeader([]byte("BLENDER-x402"))
+	assert.Error(t, err)
+
+	_, err = ParseHeader([]byte("BLENDER17-02v0500"))
+	assert.ErrorContains(t, err, "unsupported file format version 2")
+}
+
+func TestDetectCompression(t *testing.T) {
+	assert.Equal(t, CompressionNone, DetectCompression([]byte("BLENDER-v402")))
+	assert.Equal(t, CompressionGzip, DetectCompression([]byte{0x1f, 0x8b, 0x08}))
+	assert.Equal(t, CompressionZstd, DetectCompression([]byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}))
+}
+
+func TestInspect_ListsDataBlocks(t *testing.T) {
+	for _, header := range []string{"BLENDER-v402", "BLENDER_V279", "BLENDER17-01v0500"} {
+		t.Run(header, func(t *testing.T) {
+			file, err := Inspect(bytes.NewReader(testScene(header)))
+			assert.NoError(t, err)
+
+			assert.Equal(t, CompressionNone, file.Compression)
+			assert.Equal(t, []string{"Scene"}, file.Scenes)
+			assert.Equal(t, UnitSystemMetric, file.SceneUnits[0].System)
+			assert.InDelta(t, 0.01, file.SceneUnits[0].ScaleLength, 1e-6)
+			assert.Equal(t, []string{"Cube", "Light"}, file.Objects)
+			assert.Equal(t, []string{"Cube"}, file.Meshes)
+			assert.Equal(t, []string{"Material"}, file.Materials)
+			assert.Equal(t, []string{"wood.png", "logo.png"}, file.Images)
+			assert.Equal(t, []string{"//textures/wood.png"}, file.ExternalImages)
+			assert.Equal(t, []string{"//libs/shared.blend"}, file.Libraries)
+
+			assert.Len(t, file.Blocks, 12)
+			assert.Equal(t, "DATA", file.Blocks[3].Code)
+			assert.Equal(t, int64(100), file.Blocks[3].Length)
+			assert.Equal(t, "ENDB", file.Blocks[11].Code)
+		})
+	}
+}
+
+func TestInspect_UnreadableUnits(t *testing.T) {
+	data := buildBlendFile("BLENDER-v402", []testBlock{
+		testIDBlock("SC", "Short", 8, nil),
+		testIDBlock("SC", "Odd", 8, testUnits(binary.LittleEndian, 7, 1)),
+	})
+
+	file, err := Inspect(bytes.NewReader(data))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Units{{}, {}}, file.SceneUnits)
+}
+
+func TestInspect_Compressed(t *testing.T) {
+	data := testScene("BLENDER-v402")
+
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	gzipWriter.Write(data)
+	gzipWriter.Close()
+
+	zstdEncoder, err := zstd.NewWriter(nil)
+	assert.NoError(t, err)
+	zstdCompressed := zstdEncoder.EncodeAll(data, nil)
+
+	for compression, compressed := range map[Compression][]byte{CompressionGzip: gzipped.Bytes(), CompressionZstd: zstdCompressed} {
+		file, err := Inspect(bytes.NewReader(compressed))
+		assert.NoError(t, err, compression)
+		assert.Equal(t, compression, file.Compression)
+		assert.Equal(t, 402, file.Version)
+		assert.Equal(t, []string{"Cube", "Light"}, file.Objects)
+	}
+}
+
+func TestInspect_Invalid(t *testing.T) {
+	data := testScene("BLENDER-v402")
+
+	_, err := Inspect(bytes.NewReader(data[:len(data)-30]))
+	assert.ErrorIs(t, err, ErrTruncated)
+
+	_, err = Inspect(bytes.NewReader([]byte("<html>Access Denied</html>")))
+	assert.ErrorIs(t, err, ErrNotBlendFile)
+
+	_, err = Inspect(bytes.NewReader(nil))
+	assert.ErrorIs(t, err, ErrNotBlendFile)
+
+	_, err = Inspect(bytes.NewReader(buildBlendFile("BLENDER-v402", nil)[:12]))
+	assert.ErrorIs(t, err, ErrTruncated)
+}
@@ -0,0 +1,264 @@
+package blendfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sdna is the struct layout a file was written with, from its DNA1 block. It
+// is what makes field offsets independent of the Blender version.
+type sdna struct {
+	pointerSize int
+	order       binary.ByteOrder
+	names       []string
+	types       []string
+	lengths     []int
+	structs     map[string][]sdnaField
+}
+
+type sdnaField struct {
+	name   string
+	offset int
+	size   int
+}
+
+// sdnaReader walks the DNA1 block, whose sections are aligned to 4 bytes
+type sdnaReader struct {
+	data  []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+var errShortSDNA = errors.New("DNA1 block is truncated")
+
+func (r *sdnaReader) expect(section string) error {
+	r.pos = (r.pos + 3) &^ 3
+	if r.pos+4 > len(r.data) || string(r.data[r.pos:r.pos+4]) != section {
+		return fmt.Errorf("missing %s section", section)
+	}
+	r.pos += 4
+	return nil
+}
+
+func (r *sdnaReader) int32() (int, error) {
+	if r.pos+4 > len(r.data) {
+		return 0, errShortSDNA
+	}
+	value := int(int32(r.order.Uint32(r.data[r.pos:])))
+	r.pos += 4
+	return value, nil
+}
+
+func (r *sdnaReader) int16() (int, error) {
+	if r.pos+2 > len(r.data) {
+		return 0, errShortSDNA
+	}
+	value := int(int16(r.order.Uint16(r.data[r.pos:])))
+	r.pos += 2
+	return value, nil
+}
+
+func (r *sdnaReader) strings(count int) ([]string, error) {
+	values := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		end := r.pos
+		for end < len(r.data) && r.data[end] != 0 {
+			end++
+		}
+		if end >= len(r.data) {
+			return nil, errShortSDNA
+		}
+		values = append(values, string(r.data[r.pos:end]))
+		r.pos = end + 1
+	}
+	return values, nil
+}
+
+func (r *sdnaReader) section(name string) (int, error) {
+	if err := r.expect(name); err != nil {
+		return 0, err
+	}
+	count, err := r.int32()
+	if err == nil && (count < 0 || count > len(r.data)) {
+		err = fmt.Errorf("invalid %s count %d", name, count)
+	}
+	return count, err
+}
+
+func parseSDNA(data []byte, header Header) (*sdna, error) {
+	r := &sdnaReader{data: data, order: header.byteOrder()}
+	if err := r.expect("SDNA"); err != nil {
+		return nil, err
+	}
+
+	dna := &sdna{pointerSize: header.PointerSize, order: r.order, structs: map[string][]sdnaField{}}
+	count, err := r.section("NAME")
+	if err != nil {
+		return nil, err
+	}
+	if dna.names, err = r.strings(count); err != nil {
+		return nil, err
+	}
+	if count, err = r.section("TYPE"); err != nil {
+		return nil, err
+	}
+	if dna.types, err = r.strings(count); err != nil {
+		return nil, err
+	}
+	if err := r.expect("TLEN"); err != nil {
+		return nil, err
+	}
+	dna.lengths = make([]int, len(dna.types))
+	for i := range dna.lengths {
+		if dna.lengths[i], err = r.int16(); err != nil {
+			return nil, err
+		}
+		// TLEN stores lengths as unsigned shorts
+		dna.lengths[i] &= 0xffff
+	}
+
+	if count, err = r.section("STRC"); err != nil {
+		return nil, err
+	}
+	for i := 0; i < count; i++ {
+		structType, err := r.int16()
+		if err != nil {
+			return nil, err
+		}
+		fieldCount, err := r.int16()
+		if err != nil {
+			return nil, err
+		}
+		if structType < 0 || structType >= len(dna.types) {
+			return nil, fmt.Errorf("struct %d has invalid type %d", i, structType)
+		}
+
+		fields := make([]sdnaField, 0, fieldCount)
+		offset := 0
+		for j := 0; j < fieldCount; j++ {
+			fieldType, err := r.int16()
+			if err != nil {
+				return nil, err
+			}
+			fieldName, err := r.int16()
+			if err != nil {
+				return nil, err
+			}
+			if fieldType < 0 || fieldType >= len(dna.types) || fieldName < 0 || fieldName >= len(dna.names) {
+				return nil, fmt.Errorf("struct %s has an invalid field", dna.types[structType])
+			}
+			name := dna.names[fieldName]
+			size := fieldSize(name, dna.lengths[fieldType], header.PointerSize)
+			fields = append(fields, sdnaField{name: fieldIdentifier(name), offset: offset, size: size})
+			offset += size
+		}
+		dna.structs[dna.types[structType]] = fields
+	}
+	return dna, nil
+}
+
+// fieldIdentifier strips pointer, function pointer and array syntax from an
+// SDNA field name, so *next, (*func)() and name[66] become next, func and name
+func fieldIdentifier(name string) string {
+	name = strings.TrimLeft(name, "(*")
+	if end := strings.IndexAny(name, ")["); end >= 0 {
+		name = name[:end]
+	}
+	return name
+}
+
+func arrayLength(name string) int {
+	length := 1
+	for {
+		start := strings.IndexByte(name, '[')
+		if start < 0 {
+			return length
+		}
+		end := strings.IndexByte(name[start:], ']')
+		if end < 0 {
+			return length
+		}
+		if n, err := strconv.Atoi(name[start+1 : start+end]); err == nil {
+			length *= n
+		}
+		name = name[start+end+1:]
+	}
+}
+
+func fieldSize(name string, typeLength int, pointerSize int) int {
+	if strings.HasPrefix(name, "*") || strings.HasPrefix(name, "(") {
+		return pointerSize * arrayLength(name)
+	}
+	return typeLength * arrayLength(name)
+}
+
+// field returns where a member of a struct is, for members declared directly
+// in that struct
+func (d *sdna) field(structName string, fieldName string) (sdnaField, bool) {
+	for _, field := range d.structs[structName] {
+		if field.name == fieldName {
+			return field, true
+		}
+	}
+	return sdnaField{}, false
+}
+
+// stringField reads the first of fieldNames that structName declares from the
+// start of a block holding that struct
+func (d *sdna) stringField(structName string, data []byte, fieldNames ...string) string {
+	for _, fieldName := range fieldNames {
+		if field, ok := d.field(structName, fieldName); ok && len(data) >= field.offset+field.size {
+			return cString(data[field.offset : field.offset+field.size])
+		}
+	}
+	return ""
+}
+
+// pointerSet reports whether any of fieldNames holds a non-null pointer. For a
+// ListBase that is its first pointer, so it reports whether the list has items.
+func (d *sdna) pointerSet(structName string, data []byte, fieldNames ...string) bool {
+	for _, fieldName := range fieldNames {
+		field, ok := d.field(structName, fieldName)
+		if !ok || len(data) < field.offset+d.pointerSize {
+			continue
+		}
+		for _, b := range data[field.offset : field.offset+d.pointerSize] {
+			if b != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// units reads the UnitSettings member of a Scene block, which Blender applies
+// as a scale when exporting
+func (d *sdna) units(data []byte) Units {
+	unit, ok := d.field("Scene", "unit")
+	if !ok || len(data) < unit.offset+unit.size {
+		return Units{}
+	}
+	settings := data[unit.offset : unit.offset+unit.size]
+	system, okSystem := d.field("UnitSettings", "system")
+	scale, okScale := d.field("UnitSettings", "scale_length")
+	if !okSystem || !okScale || len(settings) < system.offset+1 || len(settings) < scale.offset+4 {
+		return Units{}
+	}
+
+	units := Units{ScaleLength: float64(math.Float32frombits(d.order.Uint32(settings[scale.offset:])))}
+	switch settings[system.offset] {
+	case 0:
+		units.System = UnitSystemNone
+	case 1:
+		units.System = UnitSystemMetric
+	case 2:
+		units.System = UnitSystemImperial
+	default:
+		return Units{}
+	}
+	return units
+}
@@ -0,0 +1,279 @@
+// Package blendzip validates blend-zip uploads: a zip holding one main .blend
+// file together with the textures and linked libraries it references, so they
+// can be converted without the paths the file was saved with.
+package blendzip
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/blendfile"
+)
+
+// ErrInvalid wraps every reason an archive is rejected for. Other errors come
+// from reading the archive.
+var ErrInvalid = errors.New("invalid blend-zip")
+
+type Limits struct {
+	MaxFiles int
+	// MaxUncompressedSize applies to the whole archive
+	MaxUncompressedSize int64
+	// MaxCompressionRatio rejects entries that would expand far beyond their
+	// compressed size, such as zip bombs
+	MaxCompressionRatio int64
+}
+
+var DefaultLimits = Limits{
+	MaxFiles:            10000,
+	MaxUncompressedSize: 4 * 1024 * 1024 * 1024,
+	MaxCompressionRatio: 200,
+}
+
+type MissingAsset struct {
+	// Path is the reference as stored in the .blend file
+	Path         string `json:"path"`
+	Type         string `json:"type"`
+	ReferencedBy string `json:"referencedBy"`
+	Reason       string `json:"reason"`
+}
+
+type Report struct {
+	MainFile         string         `json:"mainFile"`
+	BlendFiles       []string       `json:"blendFiles"`
+	Files            int            `json:"files"`
+	UncompressedSize int64          `json:"uncompressedSize"`
+	Missing          []MissingAsset `json:"missing,omitempty"`
+	// Main is what the inspector found in MainFile
+	Main *blendfile.File `json:"-"`
+}
+
+type Validator struct {
+	Limits Limits
+	// Inspect reads a .blend file, blendfile.Inspect unless set
+	Inspect func(r io.Reader) (*blendfile.File, error)
+}
+
+// Validate checks an archive with DefaultLimits
+func Validate(r io.ReaderAt, size int64) (*Report, error) {
+	return Validator{Limits: DefaultLimits}.Validate(r, size)
+}
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, args...))
+}
+
+// entryPath returns the cleaned path of an archive entry, rejecting anything
+// that could be extracted outside the directory it is extracted to
+func entryPath(name string) (string, error) {
+	trimmed := strings.TrimSuffix(name, "/")
+	switch {
+	case trimmed == "":
+		return "", invalid("archive has an entry without a name")
+	case strings.Contains(name, "\\"):
+		return "", invalid("entry %q uses backslashes, zip paths must use /", name)
+	case path.IsAbs(trimmed) || (len(trimmed) > 1 && trimmed[1] == ':'):
+		return "", invalid("entry %q has an absolute path", name)
+	}
+	for _, segment := range strings.Split(trimmed, "/") {
+		if segment == ".." {
+			return "", invalid("entry %q points outside the archive", name)
+		}
+	}
+	if path.Clean(trimmed) != trimmed {
+		return "", invalid("entry %q is not a clean path", name)
+	}
+	return trimmed, nil
+}
+
+// skippedEntry reports whether an entry is archiver metadata rather than content
+func skippedEntry(name string) bool {
+	return strings.HasPrefix(name, "__MACOSX/") || path.Base(name) == ".DS_Store"
+}
+
+func isBlendFile(name string) bool {
+	return strings.EqualFold(path.Ext(name), ".blend")
+}
+
+// tilePattern matches the tile tokens Blender substitutes in UDIM image paths
+var tilePattern = regexp.MustCompile(`<UDIM>|<UVTILE>`)
+
+type reference struct {
+	path         string
+	assetType    string
+	referencedBy string
+}
+
+// resolve returns the archive path a reference stored in the .blend file at
+// blendPath points to, or why it cannot be in the archive
+func resolve(blendPath string, reference string) (string, string) {
+	if !strings.HasPrefix(reference, "//") {
+		return "", "absolute path, make paths relative in Blender before zipping"
+	}
+	relative := strings.ReplaceAll(strings.TrimPrefix(reference, "//"), "\\", "/")
+	resolved := path.Join(path.Dir(blendPath), relative)
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", "points outside the archive"
+	}
+	return resolved, ""
+}
+
+// present reports whether a resolved path is in the archive. UDIM paths match
+// when at least one tile is present.
+func present(files map[string]bool, resolved string) bool {
+	if !tilePattern.MatchString(resolved) {
+		return files[resolved]
+	}
+	parts := tilePattern.Split(resolved, -1)
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	tiles := regexp.MustCompile("^" + strings.Join(parts, `\d+(?:_\d+)?`) + "$")
+	for name := range files {
+		if tiles.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v Validator) inspect(file *zip.File) (*blendfile.File, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	inspect := v.Inspect
+	if inspect == nil {
+		inspect = blendfile.Inspect
+	}
+	// The declared size was checked against the limits, so reading past it
+	// means the entry lied about its size
+	limited := &io.LimitedReader{R: reader, N: int64(file.UncompressedSize64)}
+	inspected, err := inspect(limited)
+	if errors.Is(err, zip.ErrChecksum) || errors.Is(err, zip.ErrFormat) {
+		return nil, invalid("%s is corrupt: %v", file.Name, err)
+	}
+	if err != nil {
+		return nil, invalid("%s is not a valid .blend file: %v", file.Name, err)
+	}
+	return inspected, nil
+}
+
+// Validate checks the archive layout and limits, finds the main .blend file
+// and reports every referenced image or library missing from the archive.
+// Missing assets are reported, not returned as an error.
+func (v Validator) Validate(r io.ReaderAt, size int64) (*Report, error) {
+	archive, err := zip.NewReader(r, size)
+	if errors.Is(err, zip.ErrInsecurePath) {
+		return nil, invalid("archive has entries with unsafe paths")
+	}
+	if errors.Is(err, zip.ErrFormat) || errors.Is(err, zip.ErrAlgorithm) {
+		return nil, invalid("not a zip archive: %v", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	files := map[string]bool{}
+	blendEntries := map[string]*zip.File{}
+	for _, file := range archive.File {
+		if skippedEntry(file.Name) {
+			continue
+		}
+		name, err := entryPath(file.Name)
+		if err != nil {
+			return nil, err
+		}
+		mode := file.Mode()
+		if mode&os.ModeSymlink != 0 {
+			return nil, invalid("entry %q is a symbolic link", file.Name)
+		}
+		if mode.IsDir() {
+			continue
+		}
+		if files[name] {
+			return nil, invalid("entry %q appears more than once", name)
+		}
+		files[name] = true
+
+		report.Files++
+		if report.Files > v.Limits.MaxFiles {
+			return nil, invalid("archive has more than %d files", v.Limits.MaxFiles)
+		}
+		uncompressed := int64(file.UncompressedSize64)
+		report.UncompressedSize += uncompressed
+		if uncompressed < 0 || report.UncompressedSize > v.Limits.MaxUncompressedSize {
+			return nil, invalid("archive expands to more than %d bytes", v.Limits.MaxUncompressedSize)
+		}
+		if uncompressed > v.Limits.MaxCompressionRatio*max(int64(file.CompressedSize64), 1) {
+			return nil, invalid("entry %q is compressed more than %d:1", name, v.Limits.MaxCompressionRatio)
+		}
+		if isBlendFile(name) {
+			blendEntries[name] = file
+			report.BlendFiles = append(report.BlendFiles, name)
+		}
+	}
+	if len(report.BlendFiles) == 0 {
+		return nil, invalid("archive has no .blend file")
+	}
+	sort.Strings(report.BlendFiles)
+
+	// A .blend file linked by another one is a library, the main file is the
+	// one nothing links to
+	inspected := map[string]*blendfile.File{}
+	var references []reference
+	linked := map[string]bool{}
+	for _, name := range report.BlendFiles {
+		file, err := v.inspect(blendEntries[name])
+		if err != nil {
+			return nil, err
+		}
+		inspected[name] = file
+		for _, library := range file.Libraries {
+			references = append(references, reference{path: library, assetType: "library", referencedBy: name})
+			if resolved, reason := resolve(name, library); reason == "" {
+				linked[resolved] = true
+			}
+		}
+		for _, image := range file.ExternalImages {
+			references = append(references, reference{path: image, assetType: "image", referencedBy: name})
+		}
+	}
+
+	var mainFiles []string
+	for _, name := range report.BlendFiles {
+		if !linked[name] {
+			mainFiles = append(mainFiles, name)
+		}
+	}
+	if len(mainFiles) != 1 {
+		return nil, invalid("archive needs exactly one main .blend file that no other .blend links to, found %d: %s", len(mainFiles), strings.Join(mainFiles, ", "))
+	}
+	report.MainFile = mainFiles[0]
+	report.Main = inspected[report.MainFile]
+
+	for _, ref := range references {
+		resolved, reason := resolve(ref.referencedBy, ref.path)
+		if reason == "" && present(files, resolved) {
+			continue
+		}
+		if reason == "" {
+			reason = fmt.Sprintf("%s is not in the archive", resolved)
+		}
+		report.Missing = append(report.Missing, MissingAsset{
+			Path:         ref.path,
+			Type:         ref.assetType,
+			ReferencedBy: ref.referencedBy,
+			Reason:       reason,
+		})
+	}
+	return report, nil
+}
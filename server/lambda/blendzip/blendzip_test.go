@@ -0,0 +1,178 @@
+package blendzip
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/blendfile"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testEntry struct {
+	name    string
+	content string
+	mode    os.FileMode
+}
+
+func buildArchive(t *testing.T, entries []testEntry) *bytes.Reader {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		if entry.mode != 0 {
+			header.SetMode(entry.mode)
+		}
+		w, err := writer.CreateHeader(header)
+		assert.NoError(t, err)
+		w.Write([]byte(entry.content))
+	}
+	assert.NoError(t, writer.Close())
+	return bytes.NewReader(buf.Bytes())
+}
+
+// testValidator inspects .blend entries by looking their content up in files
+func testValidator(files map[string]*blendfile.File) Validator {
+	return Validator{
+		Limits: DefaultLimits,
+		Inspect: func(r io.Reader) (*blendfile.File, error) {
+			content, err := io.ReadAll(r)
+			if err != nil {
+				return nil, err
+			}
+			file, ok := files[string(content)]
+			if !ok {
+				return nil, blendfile.ErrNotBlendFile
+			}
+			return file, nil
+		},
+	}
+}
+
+func validate(t *testing.T, validator Validator, entries []testEntry) (*Report, error) {
+	archive := buildArchive(t, entries)
+	return validator.Validate(archive, archive.Size())
+}
+
+var sceneFiles = map[string]*blendfile.File{
+	"main": {
+		Header:         blendfile.Header{Version: 402},
+		Libraries:      []string{"//libs/shared.blend"},
+		ExternalImages: []string{"//textures/wood.png", "//textures/skin.<UDIM>.png"},
+	},
+	"shared": {
+		Header:         blendfile.Header{Version: 402},
+		ExternalImages: []string{"//../textures/brick.png"},
+	},
+	"other": {Header: blendfile.Header{Version: 402}},
+}
+
+func TestValidate_CompleteBundle(t *testing.T) {
+	report, err := validate(t, testValidator(sceneFiles), []testEntry{
+		{name: "scene/"},
+		{name: "scene/main.blend", content: "main"},
+		{name: "scene/libs/shared.blend", content: "shared"},
+		{name: "scene/textures/wood.png", content: "png"},
+		{name: "scene/textures/brick.png", content: "png"},
+		{name: "scene/textures/skin.1001.png", content: "png"},
+		{name: "__MACOSX/scene/._main.blend", content: "resource fork"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "scene/main.blend", report.MainFile)
+	assert.Equal(t, []string{"scene/libs/shared.blend", "scene/main.blend"}, report.BlendFiles)
+	assert.Equal(t, 5, report.Files)
+	assert.Empty(t, report.Missing)
+	assert.Same(t, sceneFiles["main"], report.Main)
+}
+
+func TestValidate_ReportsMissingAssets(t *testing.T) {
+	files := map[string]*blendfile.File{
+		"main": {
+			Libraries:      []string{"//libs/shared.blend"},
+			ExternalImages: []string{"//textures/wood.png", `C:\Users\artist\wood.png`, "//../outside.png"},
+		},
+	}
+	report, err := validate(t, testValidator(files), []testEntry{
+		{name: "main.blend", content: "main"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "main.blend", report.MainFile)
+	assert.Equal(t, []MissingAsset{
+		{Path: "//libs/shared.blend", Type: "library", ReferencedBy: "main.blend", Reason: "libs/shared.blend is not in the archive"},
+		{Path: "//textures/wood.png", Type: "image", ReferencedBy: "main.blend", Reason: "textures/wood.png is not in the archive"},
+		{Path: `C:\Users\artist\wood.png`, Type: "image", ReferencedBy: "main.blend", Reason: "absolute path, make paths relative in Blender before zipping"},
+		{Path: "//../outside.png", Type: "image", ReferencedBy: "main.blend", Reason: "points outside the archive"},
+	}, report.Missing)
+}
+
+func TestValidate_RejectsInvalidArchives(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testEntry
+		message string
+	}{
+		{
+			name:    "path traversal",
+			entries: []testEntry{{name: "main.blend", content: "main"}, {name: "textures/../../etc/passwd", content: "x"}},
+			message: "points outside the archive",
+		},
+		{
+			name:    "absolute path",
+			entries: []testEntry{{name: "/main.blend", content: "main"}},
+			message: "absolute path",
+		},
+		{
+			name:    "symbolic link",
+			entries: []testEntry{{name: "main.blend", content: "main"}, {name: "link.png", content: "/etc/passwd", mode: os.ModeSymlink | 0777}},
+			message: "symbolic link",
+		},
+		{
+			name:    "no blend file",
+			entries: []testEntry{{name: "wood.png", content: "png"}},
+			message: "no .blend file",
+		},
+		{
+			name:    "two main files",
+			entries: []testEntry{{name: "main.blend", content: "main"}, {name: "libs/shared.blend", content: "shared"}, {name: "other.blend", content: "other"}},
+			message: "found 2: main.blend, other.blend",
+		},
+		{
+			name:    "not a blend file",
+			entries: []testEntry{{name: "main.blend", content: "<html>"}},
+			message: "main.blend is not a valid .blend file",
+		},
+		{
+			name:    "zip bomb",
+			entries: []testEntry{{name: "main.blend", content: "main"}, {name: "zeros.bin", content: strings.Repeat("\x00", 1<<20)}},
+			message: "compressed more than 200:1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validate(t, testValidator(sceneFiles), tt.entries)
+			assert.ErrorIs(t, err, ErrInvalid)
+			assert.ErrorContains(t, err, tt.message)
+		})
+	}
+}
+
+func TestValidate_Limits(t *testing.T) {
+	validator := testValidator(sceneFiles)
+	validator.Limits.MaxFiles = 2
+	_, err := validate(t, validator, []testEntry{{name: "main.blend", content: "main"}, {name: "a.png"}, {name: "b.png"}})
+	assert.ErrorContains(t, err, "more than 2 files")
+
+	validator = testValidator(sceneFiles)
+	validator.Limits.MaxUncompressedSize = 8
+	_, err = validate(t, validator, []testEntry{{name: "main.blend", content: "main"}, {name: "a.png", content: "0123456789"}})
+	assert.ErrorContains(t, err, "expands to more than 8 bytes")
+}
+
+func TestValidate_NotAZip(t *testing.T) {
+	_, err := Validate(strings.NewReader("BLENDER-v402"), 12)
+	assert.ErrorIs(t, err, ErrInvalid)
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/converters"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/mesh"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// ConversionMessage is a job queued by model-loader-util for the native backend
+type ConversionMessage struct {
+	ConnectionID string `json:"connectionId"`
+	JobType      string `json:"jobType"`
+	JobID        string `json:"jobId"`
+	FromFileType string `json:"fromFileType"`
+	ToFileType   string `json:"toFileType"`
+	ModelID      string `json:"modelId"`
+	S3Key        string `json:"s3Key"`
+	SourceETag   string `json:"sourceEtag"`
+	Converter    string `json:"converter"`
+	// Options arrive as JSON, already checked against the converter's schema
+	Options string `json:"options"`
+	Attempt string `json:"attempt"`
+	// InputS3Key and InputFileType are set on post-processing steps, whose
+	// input is what another backend exported rather than the source
+	InputS3Key    string `json:"inputS3Key"`
+	InputFileType string `json:"inputFileType"`
+}
+
+// NotificationMessage is what the notification lambda expects from every
+// backend, the Blender worker sends the same fields
+type NotificationMessage struct {
+	ConnectionID string      `json:"connectionId"`
+	JobType      string      `json:"jobType"`
+	JobID        string      `json:"jobId"`
+	JobStatus    string      `json:"jobStatus"`
+	FromFileType string      `json:"fromFileType"`
+	ToFileType   string      `json:"toFileType"`
+	ModelID      string      `json:"modelId"`
+	S3Key        string      `json:"s3Key"`
+	NewS3Key     string      `json:"newS3Key,omitempty"`
+	Error        string      `json:"error,omitempty"`
+	Artifacts    []Artifact  `json:"artifacts,omitempty"`
+	Attempt      string      `json:"attempt,omitempty"`
+	MeshStats    *mesh.Stats `json:"meshStats,omitempty"`
+}
+
+type Artifact struct {
+	Path   string `json:"path"`
+	S3Key  string `json:"s3Key"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Source is the downloaded object a job converts
+type Source struct {
+	FileType string
+	Data     []byte
+}
+
+// Output holds every file a conversion produced, keyed by path relative to
+// the main file
+type Output struct {
+	Main  string
+	Files map[string][]byte
+	// MeshStats is set by the converters that read the model as one mesh
+	MeshStats *mesh.Stats
+}
+
+// implementation converts a source, naming its main output after the model
+type implementation func(source Source, name string, options map[string]any) (Output, error)
+
+// implementations are keyed by the converter names registered for the native
+// backend in the converters package, and gltf-lod which lod jobs run
+var implementations = map[string]implementation{
+	"gltf-split": splitGLTF,
+	"gltf-pack":  packGLB,
+	"usdz":       writeUSDZ,
+	"mesh-stl":   writeMesh("stl", mesh.WriteSTL),
+	"mesh-ply":   writeMesh("ply", writePLY),
+	"mesh-3mf":   writeMesh("3mf", write3MF),
+	"mesh-glb":   meshToGLTF(packGLBOutput),
+	"mesh-gltf":  meshToGLTF(gltfOutput),
+	"mesh-usdz":  meshToGLTF(usdzOutputWithOptions),
+	"fbx-glb":    convertFBX,
+	"gltf-lod":   generateLODs,
+}
+
+// defaultMaxSourceSize applies to converters registered without a limit
+const defaultMaxSourceSize = 256 << 20
+
+type S3Client interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+type SQSClient interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+}
+
+// jobIsCancelled reports whether the job was cancelled through
+// POST /jobs/{jobId}/cancel
+func jobIsCancelled(ctx context.Context, dynamoClient DynamoDBClient, jobHistoryTable string, jobID string) (bool, error) {
+	if jobHistoryTable == "" || jobID == "" {
+		return false, nil
+	}
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:            aws.String(jobHistoryTable),
+		Key:                  map[string]types.AttributeValue{"jobId": &types.AttributeValueMemberS{Value: jobID}},
+		ProjectionExpression: aws.String("jobStatus"),
+		ConsistentRead:       aws.Bool(true),
+	})
+	if err != nil {
+		return false, err
+	}
+	status, ok := result.Item["jobStatus"].(*types.AttributeValueMemberS)
+	return ok && status.Value == "cancelled", nil
+}
+
+// downloadSource reads the source object, refusing it if it changed since the
+// job was queued or grew past the converter's limit. Post-processing steps
+// read the intermediate export instead.
+func downloadSource(ctx context.Context, s3Client S3Client, bucket string, message ConversionMessage) (Source, error) {
+	maxSize := int64(defaultMaxSourceSize)
+	if converter, ok := converters.Default.Lookup(message.FromFileType, message.ToFileType); ok && converter.Limits.MaxSourceSize > 0 {
+		maxSize = converter.Limits.MaxSourceSize
+	}
+
+	key, fileType := message.S3Key, message.FromFileType
+	input := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	if message.InputS3Key != "" {
+		key, fileType = message.InputS3Key, message.InputFileType
+		input.Key = aws.String(key)
+	} else if message.SourceETag != "" {
+		input.IfMatch = aws.String(message.SourceETag)
+	}
+	result, err := s3Client.GetObject(ctx, input)
+	if err != nil {
+		return Source{}, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	defer result.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(result.Body, maxSize+1))
+	if err != nil {
+		return Source{}, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	if int64(len(data)) > maxSize {
+		return Source{}, fmt.Errorf("source is larger than the %d bytes the %s converter accepts", maxSize, message.Converter)
+	}
+	return Source{FileType: fileType, Data: data}, nil
+}
+
+func convert(source Source, message ConversionMessage) (Output, error) {
+	run, ok := implementations[message.Converter]
+	if !ok {
+		return Output{}, fmt.Errorf("no native converter is named %q", message.Converter)
+	}
+	options := map[string]any{}
+	if message.Options != "" {
+		if err := json.Unmarshal([]byte(message.Options), &options); err != nil {
+			return Output{}, fmt.Errorf("malformed options: %w", err)
+		}
+	}
+	return run(source, message.ModelID, options)
+}
+
+var contentTypes = map[string]string{
+	".glb":  "model/gltf-binary",
+	".gltf": "model/gltf+json",
+	".bin":  "application/octet-stream",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".webp": "image/webp",
+	".ktx2": "image/ktx2",
+	".usdz": "model/vnd.usdz+zip",
+	".stl":  "model/stl",
+	".ply":  "application/octet-stream",
+	".3mf":  "model/3mf",
+}
+
+// uploadOutputs uploads every file of an output and returns the key of the
+// main file. Like the Blender worker, single files keep the
+// {toFileType}/{modelId}.{ext} key and multi-file outputs are uploaded under
+// {toFileType}/{modelId}/ so their relative URIs keep resolving.
+func uploadOutputs(ctx context.Context, s3Client S3Client, bucket string, message ConversionMessage, output Output) (string, []Artifact, error) {
+	keyFor := func(filePath string) string {
+		return fmt.Sprintf("%s/%s/%s", message.ToFileType, message.ModelID, filePath)
+	}
+	// Levels of detail sit next to each other under the model's prefix, so
+	// they never replace the GLB they were generated from
+	if len(output.Files) == 1 && message.JobType != "lod" {
+		keyFor = func(filePath string) string {
+			return fmt.Sprintf("%s/%s", message.ToFileType, filePath)
+		}
+	}
+
+	paths := make([]string, 0, len(output.Files))
+	for filePath := range output.Files {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+
+	var artifacts []Artifact
+	for _, filePath := range paths {
+		data := output.Files[filePath]
+		key := keyFor(filePath)
+		contentType, ok := contentTypes[path.Ext(filePath)]
+		if !ok {
+			contentType = "application/octet-stream"
+		}
+		log.Printf("Uploading %s to s3://%s/%s", filePath, bucket, key)
+		_, err := s3Client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(data),
+			ContentType: aws.String(contentType),
+		})
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to upload %s: %w", key, err)
+		}
+		digest := sha256.Sum256(data)
+		artifacts = append(artifacts, Artifact{Path: filePath, S3Key: key, Size: int64(len(data)), SHA256: hex.EncodeToString(digest[:])})
+	}
+	return keyFor(output.Main), artifacts, nil
+}
+
+func sendNotification(ctx context.Context, sqsClient SQSClient, queueURL string, notification NotificationMessage) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	_, err = sqsClient.SendMessage(ctx, &sqs.SendMessageInput{QueueUrl: aws.String(queueURL), MessageBody: aws.String(string(body))})
+	if err != nil {
+		return fmt.Errorf("failed to send notification for job %s: %w", notification.JobID, err)
+	}
+	log.Printf("Notification sent for job %s: %s", notification.JobID, notification.JobStatus)
+	return nil
+}
+
+// processMessage runs one job and returns its notification, or nil when the
+// job was cancelled and the cancel request already recorded its final status
+func processMessage(ctx context.Context, message ConversionMessage, s3Client S3Client, dynamoClient DynamoDBClient) (*NotificationMessage, error) {
+	bucket := os.Getenv("model_s3_bucket")
+	jobHistoryTable := os.Getenv("job_history_table")
+
+	if cancelled, err := jobIsCancelled(ctx, dynamoClient, jobHistoryTable, message.JobID); err != nil {
+		return nil, fmt.Errorf("failed to check job status: %w", err)
+	} else if cancelled {
+		log.Printf("Job %s was cancelled while queued, skipping", message.JobID)
+		return nil, nil
+	}
+
+	source, err := downloadSource(ctx, s3Client, bucket, message)
+	if err != nil {
+		return nil, err
+	}
+	output, err := convert(source, message)
+	if err != nil {
+		return nil, fmt.Errorf("%s conversion failed: %w", message.Converter, err)
+	}
+
+	if cancelled, err := jobIsCancelled(ctx, dynamoClient, jobHistoryTable, message.JobID); err != nil {
+		return nil, fmt.Errorf("failed to check job status: %w", err)
+	} else if cancelled {
+		log.Printf("Job %s was cancelled during conversion, discarding output", message.JobID)
+		return nil, nil
+	}
+
+	newS3Key, artifacts, err := uploadOutputs(ctx, s3Client, bucket, message, output)
+	if err != nil {
+		return nil, err
+	}
+	// The intermediate export has served its purpose. It sits under the
+	// model's output prefix, so one left behind is removed with the model.
+	if message.InputS3Key != "" {
+		if _, err := s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(message.InputS3Key)}); err != nil {
+			log.Printf("Error deleting intermediate %s of job %s: %v", message.InputS3Key, message.JobID, err)
+		}
+	}
+	notification := newNotification(message, "completed")
+	notification.NewS3Key = newS3Key
+	notification.Artifacts = artifacts
+	notification.MeshStats = output.MeshStats
+	return &notification, nil
+}
+
+func newNotification(message ConversionMessage, jobStatus string) NotificationMessage {
+	return NotificationMessage{
+		ConnectionID: message.ConnectionID,
+		JobType:      message.JobType,
+		JobID:        message.JobID,
+		JobStatus:    jobStatus,
+		FromFileType: message.FromFileType,
+		ToFileType:   message.ToFileType,
+		ModelID:      message.ModelID,
+		S3Key:        message.S3Key,
+		Attempt:      message.Attempt,
+	}
+}
+
+func HandlerWithClients(ctx context.Context, sqsEvent events.SQSEvent, s3Client S3Client, sqsClient SQSClient, dynamoClient DynamoDBClient) error {
+	notificationQueueURL := os.Getenv("notification_queue_url")
+	if notificationQueueURL == "" {
+		return fmt.Errorf("notification_queue_url environment variable is not set")
+	}
+	if os.Getenv("model_s3_bucket") == "" {
+		return fmt.Errorf("model_s3_bucket environment variable is not set")
+	}
+
+	for _, record := range sqsEvent.Records {
+		var message ConversionMessage
+		if err := json.Unmarshal([]byte(record.Body), &message); err != nil {
+			log.Printf("Error unmarshaling job message: %v", err)
+			continue
+		}
+
+		notification, err := processMessage(ctx, message, s3Client, dynamoClient)
+		if err != nil {
+			log.Printf("Error processing job %s: %v", message.JobID, err)
+			failed := newNotification(message, "failed")
+			failed.Error = err.Error()
+			notification = &failed
+		}
+		if notification == nil {
+			continue
+		}
+		// A lost notification would leave the job pending forever, so the
+		// message is redelivered instead
+		if err := sendNotification(ctx, sqsClient, notificationQueueURL, *notification); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func handler(ctx context.Context, sqsEvent events.SQSEvent) error {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to load SDK config: %v", err)
+	}
+	return HandlerWithClients(ctx, sqsEvent, s3.NewFromConfig(cfg), sqs.NewFromConfig(cfg), dynamodb.NewFromConfig(cfg))
+}
+
+func main() {
+	lambda.Start(handler)
+}
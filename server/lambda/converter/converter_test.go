@@ -0,0 +1,455 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/converters"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/gltf"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/mesh"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+const testNotificationQueueURL = "https://sqs.us-east-1.amazonaws.com/123456789012/test-notification-queue"
+
+var testPNG = []byte("\x89PNG\r\n\x1a\nnot really an image")
+
+type mockS3Client struct {
+	contents map[string][]byte
+	etags    map[string]string
+	puts     map[string][]byte
+	deletes  []string
+	getCalls int
+}
+
+func (m *mockS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	m.getCalls++
+	content, ok := m.contents[*params.Key]
+	if !ok {
+		return nil, fmt.Errorf("NoSuchKey: %s", *params.Key)
+	}
+	if params.IfMatch != nil && *params.IfMatch != m.etags[*params.Key] {
+		return nil, fmt.Errorf("PreconditionFailed")
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(content))}, nil
+}
+
+func (m *mockS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, _ := io.ReadAll(params.Body)
+	if m.puts == nil {
+		m.puts = map[string][]byte{}
+	}
+	m.puts[*params.Key] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (m *mockS3Client) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	m.deletes = append(m.deletes, *params.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+type mockSQSClient struct {
+	sendMessageInputs []*sqs.SendMessageInput
+}
+
+func (m *mockSQSClient) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	m.sendMessageInputs = append(m.sendMessageInputs, params)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+type mockDynamoDBClient struct {
+	jobStatus string
+}
+
+func (m *mockDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if m.jobStatus == "" {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{"jobStatus": &types.AttributeValueMemberS{Value: m.jobStatus}}}, nil
+}
+
+func setupTestEnv(t *testing.T) {
+	t.Setenv("notification_queue_url", testNotificationQueueURL)
+	t.Setenv("model_s3_bucket", "test-bucket")
+	t.Setenv("job_history_table", "test-job-history")
+}
+
+// testGLTF is a point with a texture whose buffer and image are referenced by
+// the given URIs
+func testGLTF(bufferURI string, imageURI string) []byte {
+	return []byte(fmt.Sprintf(`{
+		"asset": {"version": "2.0"},
+		"meshes": [{"primitives": [{"attributes": {"POSITION": 0}, "mode": 0}]}],
+		"accessors": [{"bufferView": 0, "componentType": 5126, "count": 1, "type": "VEC3"}],
+		"bufferViews": [{"buffer": 0, "byteLength": 12}],
+		"buffers": [{"uri": %q, "byteLength": 12}],
+		"textures": [{"source": 0}],
+		"images": [{"uri": %q}]
+	}`, bufferURI, imageURI))
+}
+
+func testGLB(t *testing.T) []byte {
+	embedded := testGLTF("data:application/octet-stream;base64,"+base64.StdEncoding.EncodeToString(make([]byte, 12)), "data:image/png;base64,"+base64.StdEncoding.EncodeToString(testPNG))
+	model, err := gltf.Read(embedded, nil)
+	assert.NoError(t, err)
+	glb, err := model.WriteGLB()
+	assert.NoError(t, err)
+	return glb
+}
+
+func testZip(t *testing.T, files map[string][]byte) []byte {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for name, data := range files {
+		w, err := writer.Create(name)
+		assert.NoError(t, err)
+		w.Write(data)
+	}
+	assert.NoError(t, writer.Close())
+	return buffer.Bytes()
+}
+
+func newMessage(fromFileType string, toFileType string, converter string, options string) ConversionMessage {
+	extension := map[string]string{"glb": "glb", "gltf": "gltf", "gltf-zip": "zip", "stl": "stl", "ply": "ply", "3mf": "3mf", "fbx": "fbx"}[fromFileType]
+	return ConversionMessage{
+		ConnectionID: "test-connection",
+		JobType:      "conversion",
+		JobID:        "test-job",
+		FromFileType: fromFileType,
+		ToFileType:   toFileType,
+		ModelID:      "model-1",
+		S3Key:        fromFileType + "/model-1." + extension,
+		SourceETag:   `"etag"`,
+		Converter:    converter,
+		Options:      options,
+		Attempt:      "2",
+	}
+}
+
+func runJob(t *testing.T, message ConversionMessage, source []byte, dynamo *mockDynamoDBClient) (*mockS3Client, *mockSQSClient) {
+	body, _ := json.Marshal(message)
+	mockS3 := &mockS3Client{
+		contents: map[string][]byte{message.S3Key: source},
+		etags:    map[string]string{message.S3Key: `"etag"`},
+	}
+	mockSQS := &mockSQSClient{}
+	err := HandlerWithClients(context.Background(), events.SQSEvent{Records: []events.SQSMessage{{Body: string(body)}}}, mockS3, mockSQS, dynamo)
+	assert.NoError(t, err)
+	return mockS3, mockSQS
+}
+
+func notificationOf(t *testing.T, mockSQS *mockSQSClient) NotificationMessage {
+	var notification NotificationMessage
+	if assert.Len(t, mockSQS.sendMessageInputs, 1) {
+		assert.Equal(t, testNotificationQueueURL, *mockSQS.sendMessageInputs[0].QueueUrl)
+		assert.NoError(t, json.Unmarshal([]byte(*mockSQS.sendMessageInputs[0].MessageBody), &notification))
+	}
+	return notification
+}
+
+func TestHandler_SplitsGLBIntoGLTFFiles(t *testing.T) {
+	setupTestEnv(t)
+	mockS3, mockSQS := runJob(t, newMessage("glb", "gltf", "gltf-split", `{"embed":"none"}`), testGLB(t), &mockDynamoDBClient{})
+
+	notification := notificationOf(t, mockSQS)
+	assert.Equal(t, "completed", notification.JobStatus, notification.Error)
+	assert.Equal(t, "gltf/model-1/model-1.gltf", notification.NewS3Key)
+	assert.Equal(t, "2", notification.Attempt)
+	assert.Len(t, notification.Artifacts, 3)
+	assert.Equal(t, testPNG, mockS3.puts["gltf/model-1/model-1_image0.png"])
+	assert.Len(t, mockS3.puts["gltf/model-1/model-1.bin"], 12)
+
+	split, err := gltf.Read(mockS3.puts["gltf/model-1/model-1.gltf"], func(uri string) ([]byte, error) {
+		return mockS3.puts["gltf/model-1/"+uri], nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "model-1.bin", split.Document.Buffers[0].URI)
+}
+
+func TestHandler_EmbedAllWritesASingleGLTF(t *testing.T) {
+	setupTestEnv(t)
+	mockS3, mockSQS := runJob(t, newMessage("glb", "gltf", "gltf-split", `{"embed":"all"}`), testGLB(t), &mockDynamoDBClient{})
+
+	notification := notificationOf(t, mockSQS)
+	assert.Equal(t, "completed", notification.JobStatus, notification.Error)
+	assert.Equal(t, "gltf/model-1.gltf", notification.NewS3Key)
+	assert.Len(t, mockS3.puts, 1)
+	_, err := gltf.Read(mockS3.puts["gltf/model-1.gltf"], nil)
+	assert.NoError(t, err)
+}
+
+func TestHandler_PacksGLTFZipIntoGLB(t *testing.T) {
+	setupTestEnv(t)
+	source := testZip(t, map[string][]byte{
+		"asset/scene.gltf":              testGLTF("scene.bin", "textures/albedo%20map.png"),
+		"asset/scene.bin":               make([]byte, 12),
+		"asset/textures/albedo map.png": testPNG,
+		"__MACOSX/asset/._scene.gltf":   []byte("resource fork"),
+	})
+	mockS3, mockSQS := runJob(t, newMessage("gltf-zip", "glb", "gltf-pack", ""), source, &mockDynamoDBClient{})
+
+	notification := notificationOf(t, mockSQS)
+	assert.Equal(t, "completed", notification.JobStatus, notification.Error)
+	assert.Equal(t, "glb/model-1.glb", notification.NewS3Key)
+	packed, err := gltf.Read(mockS3.puts["glb/model-1.glb"], nil)
+	assert.NoError(t, err)
+	assert.Equal(t, testPNG, packed.Images[0].Data)
+	assert.Equal(t, "image/png", packed.Document.Images[0].MimeType)
+}
+
+func TestHandler_WritesUSDZ(t *testing.T) {
+	setupTestEnv(t)
+	mockS3, mockSQS := runJob(t, newMessage("glb", "usdz", "usdz", ""), testGLB(t), &mockDynamoDBClient{})
+
+	notification := notificationOf(t, mockSQS)
+	assert.Equal(t, "completed", notification.JobStatus, notification.Error)
+	assert.Equal(t, "usdz/model-1.usdz", notification.NewS3Key)
+	usdz := mockS3.puts["usdz/model-1.usdz"]
+	reader, err := zip.NewReader(bytes.NewReader(usdz), int64(len(usdz)))
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, reader.File) {
+		assert.Equal(t, "model-1.usda", reader.File[0].Name)
+	}
+	assert.Empty(t, mockS3.deletes)
+}
+
+// testTriangle is a triangle 10 by 20 millimeters in the XY plane
+func testTriangle() *mesh.Mesh {
+	return &mesh.Mesh{Positions: []float32{0, 0, 0, 10, 0, 0, 0, 20, 0}, Triangles: []uint32{0, 1, 2}}
+}
+
+func TestHandler_WritesSTLFromGLBWithStats(t *testing.T) {
+	setupTestEnv(t)
+	triangle := testTriangle()
+	assert.NoError(t, triangle.ConvertUnits("millimeter", "meter"))
+	model, err := mesh.ToGLTF(triangle)
+	assert.NoError(t, err)
+	glb, err := model.WriteGLB()
+	assert.NoError(t, err)
+
+	mockS3, mockSQS := runJob(t, newMessage("glb", "stl", "mesh-stl", `{"unit":"centimeter"}`), glb, &mockDynamoDBClient{})
+
+	notification := notificationOf(t, mockSQS)
+	assert.Equal(t, "completed", notification.JobStatus, notification.Error)
+	assert.Equal(t, "stl/model-1.stl", notification.NewS3Key)
+	stl, err := mesh.ReadSTL(mockS3.puts["stl/model-1.stl"])
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stl.TriangleCount())
+	if assert.NotNil(t, notification.MeshStats) {
+		assert.Equal(t, 1, notification.MeshStats.Triangles)
+		assert.Equal(t, "centimeter", notification.MeshStats.Unit)
+		assert.InDelta(t, 1, notification.MeshStats.Max[0], 1e-5)
+		assert.InDelta(t, 2, notification.MeshStats.Max[1], 1e-5)
+	}
+}
+
+func TestHandler_ConvertsSTLToGLBAndThreeMF(t *testing.T) {
+	setupTestEnv(t)
+	stl, err := mesh.WriteSTL(testTriangle(), "triangle", mesh.ASCII)
+	assert.NoError(t, err)
+
+	mockS3, mockSQS := runJob(t, newMessage("stl", "glb", "mesh-glb", `{"sourceUnit":"centimeter"}`), stl, &mockDynamoDBClient{})
+	notification := notificationOf(t, mockSQS)
+	assert.Equal(t, "completed", notification.JobStatus, notification.Error)
+	model, err := gltf.Read(mockS3.puts["glb/model-1.glb"], nil)
+	assert.NoError(t, err)
+	converted, err := mesh.FromGLTF(model)
+	assert.NoError(t, err)
+	stats := converted.Stats()
+	assert.Equal(t, 1, stats.Triangles)
+	// 20 centimeters along Y
+	assert.InDelta(t, 0.2, stats.Max[1], 1e-6)
+
+	mockS3, mockSQS = runJob(t, newMessage("stl", "3mf", "mesh-3mf", ""), stl, &mockDynamoDBClient{})
+	notification = notificationOf(t, mockSQS)
+	assert.Equal(t, "completed", notification.JobStatus, notification.Error)
+	threeMF, err := mesh.Read3MF(mockS3.puts["3mf/model-1.3mf"])
+	assert.NoError(t, err)
+	assert.Equal(t, "millimeter", threeMF.Unit)
+	assert.Equal(t, 1, threeMF.TriangleCount())
+}
+
+func TestHandler_PostProcessesTheBlenderExport(t *testing.T) {
+	setupTestEnv(t)
+	message := newMessage("glb", "usdz", "usdz", "")
+	message.FromFileType = "blend"
+	message.S3Key = "blend/model-1.blend"
+	message.InputS3Key = "usdz/model-1/model-1.glb"
+	message.InputFileType = "glb"
+	body, _ := json.Marshal(message)
+	mockS3 := &mockS3Client{contents: map[string][]byte{message.InputS3Key: testGLB(t)}}
+	mockSQS := &mockSQSClient{}
+	err := HandlerWithClients(context.Background(), events.SQSEvent{Records: []events.SQSMessage{{Body: string(body)}}}, mockS3, mockSQS, &mockDynamoDBClient{})
+	assert.NoError(t, err)
+
+	notification := notificationOf(t, mockSQS)
+	assert.Equal(t, "completed", notification.JobStatus, notification.Error)
+	assert.Equal(t, "blend", notification.FromFileType)
+	assert.Equal(t, "blend/model-1.blend", notification.S3Key)
+	assert.Equal(t, "usdz/model-1.usdz", notification.NewS3Key)
+	assert.Equal(t, []string{"usdz/model-1/model-1.glb"}, mockS3.deletes)
+}
+
+// testGrid is a flat square of 16 by 16 quads
+func testGrid() *mesh.Mesh {
+	grid := &mesh.Mesh{}
+	for y := 0; y <= 16; y++ {
+		for x := 0; x <= 16; x++ {
+			grid.Positions = append(grid.Positions, float32(x), float32(y), 0)
+		}
+	}
+	for y := uint32(0); y < 16; y++ {
+		for x := uint32(0); x < 16; x++ {
+			a, b := y*17+x, (y+1)*17+x
+			grid.Triangles = append(grid.Triangles, a, a+1, b+1, a, b+1, b)
+		}
+	}
+	return grid
+}
+
+func TestHandler_GeneratesLevelsOfDetail(t *testing.T) {
+	setupTestEnv(t)
+	model, err := mesh.ToGLTF(testGrid())
+	assert.NoError(t, err)
+	glb, err := model.WriteGLB()
+	assert.NoError(t, err)
+	message := newMessage("glb", "glb", "gltf-lod", `{"ratios":[0.5,0.125]}`)
+	message.JobType = "lod"
+	message.S3Key = "glb/model-1.glb"
+
+	mockS3, mockSQS := runJob(t, message, glb, &mockDynamoDBClient{})
+
+	notification := notificationOf(t, mockSQS)
+	assert.Equal(t, "completed", notification.JobStatus, notification.Error)
+	assert.Equal(t, "glb/model-1/lod1.glb", notification.NewS3Key)
+	if assert.Len(t, notification.Artifacts, 2) {
+		assert.Equal(t, "lod2.glb", notification.Artifacts[1].Path)
+	}
+	assert.NotContains(t, mockS3.puts, "glb/model-1.glb")
+	for key, maxTriangles := range map[string]int{"glb/model-1/lod1.glb": 256, "glb/model-1/lod2.glb": 64} {
+		lod, err := gltf.Read(mockS3.puts[key], nil)
+		assert.NoError(t, err, key)
+		stats, err := lod.Stats()
+		assert.NoError(t, err, key)
+		assert.LessOrEqual(t, stats.Triangles, maxTriangles, key)
+		assert.Positive(t, stats.Triangles, key)
+	}
+}
+
+func TestHandler_FailedJobs(t *testing.T) {
+	tests := []struct {
+		name    string
+		message ConversionMessage
+		source  []byte
+		error   string
+	}{
+		{
+			name:    "reference outside the archive",
+			message: newMessage("gltf-zip", "glb", "gltf-pack", ""),
+			source:  testZip(t, map[string][]byte{"scene.gltf": testGLTF("../scene.bin", "albedo.png")}),
+			error:   "../scene.bin points outside the archive",
+		},
+		{
+			name:    "missing file",
+			message: newMessage("gltf-zip", "glb", "gltf-pack", ""),
+			source:  testZip(t, map[string][]byte{"scene.gltf": testGLTF("scene.bin", "albedo.png"), "scene.bin": make([]byte, 12)}),
+			error:   "albedo.png is missing from the archive",
+		},
+		{
+			name:    "two gltf files",
+			message: newMessage("gltf-zip", "glb", "gltf-pack", ""),
+			source:  testZip(t, map[string][]byte{"a.gltf": []byte("{}"), "b.gltf": []byte("{}")}),
+			error:   "only one is allowed",
+		},
+		{
+			name:    "gltf with external files",
+			message: newMessage("gltf", "glb", "gltf-pack", ""),
+			source:  testGLTF("scene.bin", "albedo.png"),
+			error:   "references external file scene.bin",
+		},
+		{
+			name:    "ascii fbx",
+			message: newMessage("fbx", "glb", "fbx-glb", ""),
+			source:  []byte("; FBX 7.4.0 project file\n"),
+			error:   "unsupported FBX: ASCII FBX files are not supported",
+		},
+		{
+			name:    "level of detail without ratios",
+			message: newMessage("glb", "glb", "gltf-lod", `{"ratios":[]}`),
+			source:  testGLB(t),
+			error:   "the ratios option is required",
+		},
+		{
+			name:    "unknown converter",
+			message: newMessage("glb", "gltf", "gltf-draco", ""),
+			error:   `no native converter is named "gltf-draco"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestEnv(t)
+			mockS3, mockSQS := runJob(t, tt.message, tt.source, &mockDynamoDBClient{})
+
+			notification := notificationOf(t, mockSQS)
+			assert.Equal(t, "failed", notification.JobStatus)
+			assert.Contains(t, notification.Error, tt.error)
+			assert.Equal(t, "2", notification.Attempt)
+			assert.Empty(t, mockS3.puts)
+		})
+	}
+}
+
+func TestHandler_ChangedSourceFails(t *testing.T) {
+	setupTestEnv(t)
+	message := newMessage("glb", "gltf", "gltf-split", "")
+	message.SourceETag = `"other"`
+	_, mockSQS := runJob(t, message, testGLB(t), &mockDynamoDBClient{})
+
+	notification := notificationOf(t, mockSQS)
+	assert.Equal(t, "failed", notification.JobStatus)
+	assert.Contains(t, notification.Error, "PreconditionFailed")
+}
+
+func TestHandler_SkipsCancelledJobs(t *testing.T) {
+	setupTestEnv(t)
+	mockS3, mockSQS := runJob(t, newMessage("glb", "gltf", "gltf-split", ""), testGLB(t), &mockDynamoDBClient{jobStatus: "cancelled"})
+
+	assert.Empty(t, mockSQS.sendMessageInputs)
+	assert.Zero(t, mockS3.getCalls)
+}
+
+func TestHandler_MissingConfiguration(t *testing.T) {
+	setupTestEnv(t)
+	os.Unsetenv("model_s3_bucket")
+	err := HandlerWithClients(context.Background(), events.SQSEvent{}, &mockS3Client{}, &mockSQSClient{}, &mockDynamoDBClient{})
+	assert.ErrorContains(t, err, "model_s3_bucket")
+}
+
+func TestEveryNativeConverterIsImplemented(t *testing.T) {
+	for _, converter := range converters.Default.Converters() {
+		if converter.Backend != converters.BackendNative {
+			continue
+		}
+		_, ok := implementations[converter.Name]
+		assert.True(t, ok, "%s to %s uses %s", converter.From, converter.To, converter.Name)
+	}
+	for _, converter := range converters.Default.Converters() {
+		if converter.PostProcess == "" {
+			continue
+		}
+		_, ok := implementations[converter.PostProcess]
+		assert.True(t, ok, "%s to %s post-processes with %s", converter.From, converter.To, converter.PostProcess)
+	}
+}
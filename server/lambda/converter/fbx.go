@@ -0,0 +1,17 @@
+package main
+
+import "vibeIQ-take-home-3d-model-loader-poc/lambda/fbx"
+
+// convertFBX reads a binary FBX scene into a GLB. ASCII files and versions
+// other than 7.x fail with fbx.ErrUnsupported.
+func convertFBX(source Source, name string, options map[string]any) (Output, error) {
+	scene, err := fbx.Read(source.Data)
+	if err != nil {
+		return Output{}, err
+	}
+	model, err := fbx.ToGLTF(scene)
+	if err != nil {
+		return Output{}, err
+	}
+	return glbOutput(model, name)
+}
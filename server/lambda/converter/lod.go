@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/converters"
+)
+
+// generateLODs simplifies a GLB once for each of the ratios option, keeping
+// that share of its triangles, and writes every level to its own file
+func generateLODs(source Source, name string, options map[string]any) (Output, error) {
+	values, ok := options["ratios"].([]any)
+	if !ok || len(values) == 0 {
+		return Output{}, fmt.Errorf("the ratios option is required")
+	}
+	model, err := readGLTF(source)
+	if err != nil {
+		return Output{}, err
+	}
+
+	output := Output{Main: converters.LODFileName(1), Files: map[string][]byte{}}
+	for i, value := range values {
+		ratio, ok := value.(float64)
+		if !ok || ratio <= 0 || ratio >= 1 {
+			return Output{}, fmt.Errorf("ratio %v is not between 0 and 1", value)
+		}
+		lod, err := model.Simplify(ratio)
+		if err != nil {
+			return Output{}, fmt.Errorf("level %d: %w", i+1, err)
+		}
+		glb, err := lod.WriteGLB()
+		if err != nil {
+			return Output{}, fmt.Errorf("level %d: %w", i+1, err)
+		}
+		output.Files[converters.LODFileName(i+1)] = glb
+	}
+	return output, nil
+}
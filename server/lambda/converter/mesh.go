@@ -0,0 +1,106 @@
+package main
+
+import (
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/gltf"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/mesh"
+)
+
+// meshReaders parse the printing formats
+var meshReaders = map[string]func(data []byte) (*mesh.Mesh, error){
+	"stl": mesh.ReadSTL,
+	"ply": mesh.ReadPLY,
+	"3mf": mesh.Read3MF,
+}
+
+// defaultUnit is what printing formats are written in unless a job asks
+// otherwise, and what STL and PLY sources are taken to be in
+const defaultUnit = "millimeter"
+
+func stringOption(options map[string]any, name string, fallback string) string {
+	if value, ok := options[name].(string); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// readMesh loads a source as a single mesh. glTF scenes are flattened, and
+// STL and PLY sources, which record no unit, are in the sourceUnit option.
+func readMesh(source Source, options map[string]any) (*mesh.Mesh, error) {
+	if read, ok := meshReaders[source.FileType]; ok {
+		m, err := read(source.Data)
+		if err != nil {
+			return nil, err
+		}
+		if m.Unit == "" {
+			m.Unit = stringOption(options, "sourceUnit", defaultUnit)
+		}
+		return m, nil
+	}
+	model, err := readGLTF(source)
+	if err != nil {
+		return nil, err
+	}
+	return mesh.FromGLTF(model)
+}
+
+// writeMesh returns the implementation writing a printing format, in the
+// unit and encoding the job asks for
+func writeMesh(extension string, write func(m *mesh.Mesh, name string, encoding mesh.Encoding) ([]byte, error)) implementation {
+	return func(source Source, name string, options map[string]any) (Output, error) {
+		m, err := readMesh(source, options)
+		if err != nil {
+			return Output{}, err
+		}
+		if err := m.ConvertUnits(defaultUnit, stringOption(options, "unit", defaultUnit)); err != nil {
+			return Output{}, err
+		}
+		data, err := write(m, name, mesh.Encoding(stringOption(options, "encoding", string(mesh.Binary))))
+		if err != nil {
+			return Output{}, err
+		}
+		stats := m.Stats()
+		main := name + "." + extension
+		return Output{Main: main, Files: map[string][]byte{main: data}, MeshStats: &stats}, nil
+	}
+}
+
+// meshToGLTF returns the implementation turning a printing format into a
+// glTF-based one, in meters as glTF requires
+func meshToGLTF(write func(model *gltf.Model, name string, options map[string]any) (Output, error)) implementation {
+	return func(source Source, name string, options map[string]any) (Output, error) {
+		m, err := readMesh(source, options)
+		if err != nil {
+			return Output{}, err
+		}
+		if err := m.ConvertUnits(defaultUnit, "meter"); err != nil {
+			return Output{}, err
+		}
+		model, err := mesh.ToGLTF(m)
+		if err != nil {
+			return Output{}, err
+		}
+		output, err := write(model, name, options)
+		if err != nil {
+			return Output{}, err
+		}
+		stats := m.Stats()
+		output.MeshStats = &stats
+		return output, nil
+	}
+}
+
+func writePLY(m *mesh.Mesh, name string, encoding mesh.Encoding) ([]byte, error) {
+	return mesh.WritePLY(m, encoding)
+}
+
+func write3MF(m *mesh.Mesh, name string, encoding mesh.Encoding) ([]byte, error) {
+	return mesh.Write3MF(m)
+}
+
+func packGLBOutput(model *gltf.Model, name string, options map[string]any) (Output, error) {
+	return glbOutput(model, name)
+}
+
+func usdzOutputWithOptions(model *gltf.Model, name string, options map[string]any) (Output, error) {
+	return usdzOutput(model, name)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/gltf"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/usd"
+)
+
+// Archives are read in memory, so their content is capped like sources are
+const (
+	maxArchiveFiles            = 10000
+	maxArchiveUncompressedSize = 1 << 30
+	maxArchiveCompressionRatio = 200
+)
+
+// readGLTF loads a glb, a self-contained gltf, or the single .gltf of a
+// gltf-zip with the files it references
+func readGLTF(source Source) (*gltf.Model, error) {
+	if source.FileType != "gltf-zip" {
+		return gltf.Read(source.Data, nil)
+	}
+	archive, err := openArchive(source.Data)
+	if err != nil {
+		return nil, err
+	}
+	mainFile, err := archive.mainFile()
+	if err != nil {
+		return nil, err
+	}
+	data, err := archive.read(mainFile)
+	if err != nil {
+		return nil, err
+	}
+	return gltf.Read(data, archive.resolver(path.Dir(mainFile)))
+}
+
+// splitGLTF writes a .gltf with its buffer and images next to it, or embeds
+// them as data URIs as the embed option asks
+func splitGLTF(source Source, name string, options map[string]any) (Output, error) {
+	model, err := readGLTF(source)
+	if err != nil {
+		return Output{}, err
+	}
+	return gltfOutput(model, name, options)
+}
+
+// packGLB writes everything an asset references into a single .glb
+func packGLB(source Source, name string, options map[string]any) (Output, error) {
+	model, err := readGLTF(source)
+	if err != nil {
+		return Output{}, err
+	}
+	return glbOutput(model, name)
+}
+
+func gltfOutput(model *gltf.Model, name string, options map[string]any) (Output, error) {
+	gltfOptions := gltf.GLTFOptions{Name: name}
+	switch options["embed"] {
+	case "images":
+		gltfOptions.Images = gltf.ImageDataURIs
+	case "all":
+		gltfOptions.Images = gltf.ImageDataURIs
+		gltfOptions.EmbedBuffer = true
+	}
+	files, err := model.WriteGLTF(gltfOptions)
+	if err != nil {
+		return Output{}, err
+	}
+	return Output{Main: name + ".gltf", Files: files}, nil
+}
+
+func glbOutput(model *gltf.Model, name string) (Output, error) {
+	glb, err := model.WriteGLB()
+	if err != nil {
+		return Output{}, err
+	}
+	main := name + ".glb"
+	return Output{Main: main, Files: map[string][]byte{main: glb}}, nil
+}
+
+type archive struct {
+	files map[string]*zip.File
+	// remaining is how many more uncompressed bytes may be read
+	remaining int64
+}
+
+func openArchive(data []byte) (*archive, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a zip archive: %w", err)
+	}
+	if len(reader.File) > maxArchiveFiles {
+		return nil, fmt.Errorf("archive has %d files, at most %d are allowed", len(reader.File), maxArchiveFiles)
+	}
+	files := map[string]*zip.File{}
+	for _, file := range reader.File {
+		name := file.Name
+		if file.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") || path.Base(name) == ".DS_Store" {
+			continue
+		}
+		if strings.Contains(name, "\\") || path.IsAbs(name) || path.Clean(name) != name || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("archive entry %q is not a safe relative path", name)
+		}
+		files[name] = file
+	}
+	return &archive{files: files, remaining: maxArchiveUncompressedSize}, nil
+}
+
+// mainFile is the only .gltf of the archive
+func (a *archive) mainFile() (string, error) {
+	var found []string
+	for name := range a.files {
+		if strings.EqualFold(path.Ext(name), ".gltf") {
+			found = append(found, name)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("archive has no .gltf file")
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("archive has %d .gltf files, only one is allowed", len(found))
+}
+
+func (a *archive) read(name string) ([]byte, error) {
+	file, ok := a.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is missing from the archive", name)
+	}
+	if file.CompressedSize64 > 0 && file.UncompressedSize64/file.CompressedSize64 > maxArchiveCompressionRatio {
+		return nil, fmt.Errorf("%s expands more than %dx", name, maxArchiveCompressionRatio)
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, a.remaining+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if int64(len(data)) > a.remaining {
+		return nil, fmt.Errorf("archive content is larger than %d bytes", maxArchiveUncompressedSize)
+	}
+	a.remaining -= int64(len(data))
+	return data, nil
+}
+
+// resolver loads URIs relative to dir, which never leave the archive
+func (a *archive) resolver(dir string) gltf.Resolver {
+	return func(uri string) ([]byte, error) {
+		resolved := path.Join(dir, uri)
+		if path.IsAbs(uri) || resolved == ".." || strings.HasPrefix(resolved, "../") {
+			return nil, fmt.Errorf("%s points outside the archive", uri)
+		}
+		return a.read(resolved)
+	}
+}
+
+// writeUSDZ converts the scene to USDA and packages it with its textures
+func writeUSDZ(source Source, name string, options map[string]any) (Output, error) {
+	model, err := readGLTF(source)
+	if err != nil {
+		return Output{}, err
+	}
+	return usdzOutput(model, name)
+}
+
+func usdzOutput(model *gltf.Model, name string) (Output, error) {
+	files, err := usd.FromGLTF(model, name)
+	if err != nil {
+		return Output{}, err
+	}
+	usdz, err := usd.Package(files)
+	if err != nil {
+		return Output{}, err
+	}
+	main := name + ".usdz"
+	return Output{Main: main, Files: map[string][]byte{main: usdz}}, nil
+}
@@ -0,0 +1,267 @@
+// Package converters is the registry of conversion backends. Every
+// (fromFileType, toFileType) pair has one converter, which says where its jobs
+// are queued, which options it takes and how large a source it accepts.
+package converters
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type Backend string
+
+const (
+	// BackendBlender jobs run script.py in the Blender container
+	BackendBlender Backend = "blender"
+	// BackendNative jobs run in the Go converter Lambda
+	BackendNative Backend = "native"
+	// BackendHTTP jobs are posted to an external converter service at the
+	// converter's Endpoint by the http-dispatcher Lambda
+	BackendHTTP Backend = "http"
+)
+
+// queueURLEnvs name the environment variable holding each backend's queue
+var queueURLEnvs = map[Backend]string{
+	BackendBlender: "blender_jobs_queue_url",
+	BackendNative:  "native_jobs_queue_url",
+	BackendHTTP:    "http_jobs_queue_url",
+}
+
+// QueueURLEnv is the environment variable holding the URL of the queue the
+// backend's jobs are sent to
+func (b Backend) QueueURLEnv() string {
+	return queueURLEnvs[b]
+}
+
+type OptionType string
+
+const (
+	OptionBoolean OptionType = "boolean"
+	OptionNumber  OptionType = "number"
+	OptionString  OptionType = "string"
+)
+
+// Option describes one entry of the options object of a conversion request
+type Option struct {
+	Name        string     `json:"name"`
+	Type        OptionType `json:"type"`
+	Description string     `json:"description,omitempty"`
+	Default     any        `json:"default,omitempty"`
+	// Enum restricts the values of string options
+	Enum []string `json:"enum,omitempty"`
+	// Min and Max bound number options
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+type Limits struct {
+	// MaxSourceSize caps the source file in bytes, 0 leaves it to the upload
+	// size limit
+	MaxSourceSize int64 `json:"maxSourceSizeBytes,omitempty"`
+}
+
+type Converter struct {
+	From    string  `json:"from"`
+	To      string  `json:"to"`
+	Backend Backend `json:"backend"`
+	// Name identifies the implementation within the backend
+	Name string `json:"name"`
+	// Endpoint is where BackendHTTP converters receive jobs. It is left out
+	// of the JSON GET /formats returns.
+	Endpoint string   `json:"-"`
+	Options  []Option `json:"options,omitempty"`
+	Limits   Limits   `json:"limits"`
+	// Export and PostProcess chain a second step: the backend exports the
+	// Export format, which the native PostProcess converter turns into To
+	Export      string `json:"export,omitempty"`
+	PostProcess string `json:"postProcess,omitempty"`
+}
+
+// ErrInvalidOptions wraps every reason the options of a request are rejected for
+var ErrInvalidOptions = errors.New("invalid options")
+
+func invalidOptions(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidOptions, fmt.Sprintf(format, args...))
+}
+
+// check validates a value against the option. Numbers are float64, as
+// encoding/json decodes them.
+func (o Option) check(value any) error {
+	switch o.Type {
+	case OptionBoolean:
+		if _, ok := value.(bool); !ok {
+			return invalidOptions("%s must be a boolean", o.Name)
+		}
+	case OptionNumber:
+		number, ok := value.(float64)
+		if !ok || math.IsNaN(number) || math.IsInf(number, 0) {
+			return invalidOptions("%s must be a number", o.Name)
+		}
+		if o.Min != nil && number < *o.Min {
+			return invalidOptions("%s must be at least %g", o.Name, *o.Min)
+		}
+		if o.Max != nil && number > *o.Max {
+			return invalidOptions("%s must be at most %g", o.Name, *o.Max)
+		}
+	case OptionString:
+		text, ok := value.(string)
+		if !ok {
+			return invalidOptions("%s must be a string", o.Name)
+		}
+		if len(o.Enum) > 0 && !slices.Contains(o.Enum, text) {
+			return invalidOptions("%s must be one of %s", o.Name, strings.Join(o.Enum, ", "))
+		}
+	default:
+		return fmt.Errorf("option %s has unknown type %q", o.Name, o.Type)
+	}
+	return nil
+}
+
+// HasOption reports whether the converter declares an option
+func (c Converter) HasOption(name string) bool {
+	return slices.ContainsFunc(c.Options, func(option Option) bool { return option.Name == name })
+}
+
+// ResolveOptions checks the options of a request against the converter's
+// schema and returns them with defaults filled in
+func (c Converter) ResolveOptions(options map[string]any) (map[string]any, error) {
+	for name := range options {
+		if !c.HasOption(name) {
+			return nil, invalidOptions("%s to %s conversions have no option %s", c.From, c.To, name)
+		}
+	}
+
+	resolved := map[string]any{}
+	for _, option := range c.Options {
+		value, ok := options[option.Name]
+		if !ok || value == nil {
+			if option.Default != nil {
+				resolved[option.Name] = option.Default
+			}
+			continue
+		}
+		if err := option.check(value); err != nil {
+			return nil, err
+		}
+		resolved[option.Name] = value
+	}
+	return resolved, nil
+}
+
+func (c Converter) validate() error {
+	if c.From == "" || c.To == "" || c.Name == "" {
+		return fmt.Errorf("converter needs from, to and name")
+	}
+	if c.Backend.QueueURLEnv() == "" {
+		return fmt.Errorf("converter %s has unknown backend %q", c.Name, c.Backend)
+	}
+	if (c.Backend == BackendHTTP) != (c.Endpoint != "") {
+		return fmt.Errorf("converter %s: only http converters have an endpoint, and they need one", c.Name)
+	}
+	if c.Backend == BackendHTTP && c.PostProcess != "" {
+		return fmt.Errorf("converter %s: http converters write %s themselves", c.Name, c.To)
+	}
+	if (c.Export != "") != (c.PostProcess != "") || c.Export == c.To {
+		return fmt.Errorf("converter %s: an export format needs a post-processing step to %s", c.Name, c.To)
+	}
+	for _, option := range c.Options {
+		if option.Default == nil {
+			continue
+		}
+		if err := option.check(option.Default); err != nil {
+			return fmt.Errorf("converter %s has an invalid default: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+type pair struct {
+	from string
+	to   string
+}
+
+type Registry struct {
+	converters map[pair]Converter
+}
+
+// NewRegistry registers converters in order, so a later converter for the
+// same pair replaces an earlier one
+func NewRegistry(converters ...Converter) (*Registry, error) {
+	registry := &Registry{converters: map[pair]Converter{}}
+	for _, converter := range converters {
+		if err := registry.Register(converter); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// Register adds a converter, replacing the one registered for its pair
+func (r *Registry) Register(converter Converter) error {
+	if err := converter.validate(); err != nil {
+		return err
+	}
+	r.converters[pair{converter.From, converter.To}] = converter
+	return nil
+}
+
+// RegisterHTTPConverters adds the http converters of a JSON array, whose
+// entries are converters with an "endpoint". Either all of them are
+// registered or, when one is invalid, none.
+func (r *Registry) RegisterHTTPConverters(value string) error {
+	var entries []struct {
+		Converter
+		Endpoint string `json:"endpoint"`
+	}
+	if err := json.Unmarshal([]byte(value), &entries); err != nil {
+		return err
+	}
+	var converters []Converter
+	for _, entry := range entries {
+		converter := entry.Converter
+		converter.Endpoint = entry.Endpoint
+		if converter.Backend != BackendHTTP {
+			return fmt.Errorf("converter %s is not an http converter", converter.Name)
+		}
+		if err := converter.validate(); err != nil {
+			return err
+		}
+		converters = append(converters, converter)
+	}
+	for _, converter := range converters {
+		r.converters[pair{converter.From, converter.To}] = converter
+	}
+	return nil
+}
+
+func (r *Registry) Lookup(from string, to string) (Converter, bool) {
+	converter, ok := r.converters[pair{from, to}]
+	return converter, ok
+}
+
+// Converters returns every registered converter, sorted by pair
+func (r *Registry) Converters() []Converter {
+	converters := make([]Converter, 0, len(r.converters))
+	for _, converter := range r.converters {
+		converters = append(converters, converter)
+	}
+	sort.Slice(converters, func(i, j int) bool {
+		if converters[i].From != converters[j].From {
+			return converters[i].From < converters[j].From
+		}
+		return converters[i].To < converters[j].To
+	})
+	return converters
+}
+
+// LODFileName is the file the level of detail at the given position is
+// written to, the first being the one with most triangles. The converter
+// writes levels under this name and GET /3d-model finds them by it.
+func LODFileName(level int) string {
+	return fmt.Sprintf("lod%d.glb", level)
+}
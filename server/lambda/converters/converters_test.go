@@ -0,0 +1,158 @@
+package converters
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func float(value float64) *float64 {
+	return &value
+}
+
+var testConverter = Converter{
+	From:    "glb",
+	To:      "gltf",
+	Backend: BackendNative,
+	Name:    "gltf-repack",
+	Options: []Option{
+		{Name: "embedImages", Type: OptionBoolean, Default: false},
+		{Name: "scale", Type: OptionNumber, Min: float(0.001), Max: float(1000)},
+		{Name: "layout", Type: OptionString, Enum: []string{"separate", "embedded"}, Default: "separate"},
+	},
+}
+
+func TestResolveOptions(t *testing.T) {
+	resolved, err := testConverter.ResolveOptions(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"embedImages": false, "layout": "separate"}, resolved)
+
+	resolved, err = testConverter.ResolveOptions(map[string]any{"scale": 0.01, "layout": "embedded"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"embedImages": false, "scale": 0.01, "layout": "embedded"}, resolved)
+}
+
+func TestResolveOptions_Invalid(t *testing.T) {
+	tests := []struct {
+		options map[string]any
+		message string
+	}{
+		{map[string]any{"draco": true}, "glb to gltf conversions have no option draco"},
+		{map[string]any{"embedImages": "yes"}, "embedImages must be a boolean"},
+		{map[string]any{"scale": "1"}, "scale must be a number"},
+		{map[string]any{"scale": 0.0}, "scale must be at least 0.001"},
+		{map[string]any{"scale": 5000.0}, "scale must be at most 1000"},
+		{map[string]any{"layout": "zip"}, "layout must be one of separate, embedded"},
+	}
+	for _, tt := range tests {
+		_, err := testConverter.ResolveOptions(tt.options)
+		assert.ErrorIs(t, err, ErrInvalidOptions)
+		assert.ErrorContains(t, err, tt.message)
+	}
+}
+
+func TestRegistry_LaterConvertersReplaceEarlierOnes(t *testing.T) {
+	registry, err := NewRegistry(blenderConverters()...)
+	assert.NoError(t, err)
+
+	converter, ok := registry.Lookup("glb", "gltf")
+	assert.True(t, ok)
+	assert.Equal(t, BackendBlender, converter.Backend)
+
+	assert.NoError(t, registry.Register(testConverter))
+	converter, ok = registry.Lookup("glb", "gltf")
+	assert.True(t, ok)
+	assert.Equal(t, "gltf-repack", converter.Name)
+	assert.Len(t, registry.Converters(), len(blenderConverters()))
+
+	_, ok = registry.Lookup("glb", "glb")
+	assert.False(t, ok)
+}
+
+func TestRegistry_RejectsInvalidConverters(t *testing.T) {
+	tests := []Converter{
+		{From: "glb", To: "gltf", Backend: "lambda", Name: "unknown-backend"},
+		{From: "glb", To: "gltf", Backend: BackendHTTP, Name: "no-endpoint"},
+		{From: "glb", To: "gltf", Backend: BackendNative, Name: "endpoint", Endpoint: "https://converter.example.com"},
+		{From: "blend", To: "usdz", Backend: BackendHTTP, Name: "http-post-process", Endpoint: "https://converter.example.com", Export: "glb", PostProcess: "usdz"},
+		{From: "glb", To: "gltf", Backend: BackendNative, Name: "bad-default", Options: []Option{{Name: "scale", Type: OptionNumber, Default: "1"}}},
+		{From: "glb", Backend: BackendNative, Name: "no-to"},
+		{From: "blend", To: "usdz", Backend: BackendBlender, Name: "no-post-process", Export: "glb"},
+		{From: "blend", To: "usdz", Backend: BackendBlender, Name: "export-is-output", Export: "usdz", PostProcess: "usdz"},
+	}
+	for _, converter := range tests {
+		_, err := NewRegistry(converter)
+		assert.Error(t, err, converter.Name)
+	}
+}
+
+func TestRegistry_RegisterHTTPConverters(t *testing.T) {
+	registry, err := NewRegistry(blenderConverters()...)
+	assert.NoError(t, err)
+
+	err = registry.RegisterHTTPConverters(`[{"from": "fbx", "to": "glb", "backend": "http", "name": "acme", "endpoint": "https://converter.example.com/convert", "limits": {"maxSourceSizeBytes": 1024}}]`)
+	assert.NoError(t, err)
+	converter, ok := registry.Lookup("fbx", "glb")
+	assert.True(t, ok)
+	assert.Equal(t, BackendHTTP, converter.Backend)
+	assert.Equal(t, "https://converter.example.com/convert", converter.Endpoint)
+	assert.Equal(t, int64(1024), converter.Limits.MaxSourceSize)
+
+	invalid := []string{
+		`{"from": "fbx"}`,
+		`[{"from": "obj", "to": "glb", "backend": "native", "name": "not-http", "endpoint": "https://converter.example.com"}]`,
+		`[{"from": "obj", "to": "glb", "backend": "http", "name": "acme", "endpoint": "https://converter.example.com"}, {"from": "obj", "to": "gltf", "backend": "http", "name": "no-endpoint"}]`,
+	}
+	for _, value := range invalid {
+		assert.Error(t, registry.RegisterHTTPConverters(value), value)
+	}
+	converter, _ = registry.Lookup("obj", "glb")
+	assert.Equal(t, BackendBlender, converter.Backend)
+}
+
+func TestDefault_RoutesGLTFRepackagingToTheNativeBackend(t *testing.T) {
+	native := map[string]string{
+		"glb to gltf":      "gltf-split",
+		"gltf to glb":      "gltf-pack",
+		"gltf-zip to glb":  "gltf-pack",
+		"gltf-zip to gltf": "gltf-split",
+		"glb to usdz":      "usdz",
+		"gltf to usdz":     "usdz",
+		"gltf-zip to usdz": "usdz",
+		"fbx to glb":       "fbx-glb",
+	}
+	for _, from := range []string{"glb", "gltf", "gltf-zip", "stl", "ply", "3mf"} {
+		for _, to := range []string{"stl", "ply", "3mf"} {
+			if from != to {
+				native[from+" to "+to] = "mesh-" + to
+			}
+		}
+	}
+	for _, from := range []string{"stl", "ply", "3mf"} {
+		for _, to := range []string{"glb", "gltf", "usdz"} {
+			native[from+" to "+to] = "mesh-" + to
+		}
+	}
+	for _, converter := range Default.Converters() {
+		pair := converter.From + " to " + converter.To
+		if name, ok := native[pair]; ok {
+			assert.Equal(t, BackendNative, converter.Backend, pair)
+			assert.Equal(t, name, converter.Name, pair)
+		} else {
+			assert.Equal(t, BackendBlender, converter.Backend, pair)
+		}
+		// Blender cannot write USDZ, its GLB export is packaged natively
+		if converter.Backend == BackendBlender && converter.To == "usdz" {
+			assert.Equal(t, "glb", converter.Export, pair)
+			assert.Equal(t, "usdz", converter.PostProcess, pair)
+		}
+		// Nor the printing formats, which the mesh converters write
+		if converter.Backend == BackendBlender && (converter.To == "stl" || converter.To == "ply" || converter.To == "3mf") {
+			assert.Equal(t, "glb", converter.Export, pair)
+			assert.Equal(t, "mesh-"+converter.To, converter.PostProcess, pair)
+		}
+		assert.NotEqual(t, converter.From, converter.To)
+	}
+	assert.Equal(t, "blender_jobs_queue_url", BackendBlender.QueueURLEnv())
+	assert.Equal(t, "native_jobs_queue_url", BackendNative.QueueURLEnv())
+}
@@ -0,0 +1,198 @@
+package converters
+
+import (
+	"log"
+	"os"
+	"slices"
+)
+
+// blenderInputs and blenderOutputs are the formats script.py imports and exports
+var (
+	blenderInputs  = []string{"blend", "blend-zip", "fbx", "obj", "gltf", "glb", "stl", "ply", "usd", "usdz"}
+	blenderOutputs = []string{"glb", "gltf", "obj", "fbx", "usd"}
+)
+
+// blenderOptions are the export settings script.py reads from the options of
+// a job
+var blenderOptions = map[string][]Option{
+	"glb":  {{Name: "yUp", Type: OptionBoolean, Description: "Convert to the +Y up axis glTF expects", Default: true}},
+	"gltf": {{Name: "yUp", Type: OptionBoolean, Description: "Convert to the +Y up axis glTF expects", Default: true}},
+	"fbx":  {{Name: "applyUnitScale", Type: OptionBoolean, Description: "Scale to FBX units instead of keeping Blender units", Default: true}},
+}
+
+func blenderConverters() []Converter {
+	var converters []Converter
+	for _, from := range blenderInputs {
+		for _, to := range blenderOutputs {
+			// Sources and outputs of the same format share their key
+			if from == to {
+				continue
+			}
+			converters = append(converters, Converter{
+				From:    from,
+				To:      to,
+				Backend: BackendBlender,
+				Name:    "blender",
+				Options: blenderOptions[to],
+			})
+		}
+		// Blender cannot write .usdz or the printing formats, so it exports a
+		// GLB the native converters turn into them
+		if from != "usdz" {
+			converters = append(converters, Converter{
+				From:        from,
+				To:          "usdz",
+				Backend:     BackendBlender,
+				Name:        "blender",
+				Options:     blenderOptions["glb"],
+				Export:      "glb",
+				PostProcess: "usdz",
+			})
+		}
+		for _, to := range meshFormats {
+			if from == to {
+				continue
+			}
+			converters = append(converters, Converter{
+				From:        from,
+				To:          to,
+				Backend:     BackendBlender,
+				Name:        "blender",
+				Options:     append(append([]Option{}, blenderOptions["glb"]...), meshOutputOptions(to)...),
+				Export:      "glb",
+				PostProcess: "mesh-" + to,
+			})
+		}
+	}
+	return converters
+}
+
+// nativeLimits keep sources within what the converter Lambda holds in memory
+var nativeLimits = Limits{MaxSourceSize: 256 << 20}
+
+var embedOption = Option{
+	Name:        "embed",
+	Type:        OptionString,
+	Description: "What the .gltf embeds as data URIs instead of writing next to it",
+	Enum:        []string{"none", "images", "all"},
+	Default:     "none",
+}
+
+// meshFormats are the printing formats the mesh package reads and writes
+var meshFormats = []string{"stl", "ply", "3mf"}
+
+var (
+	unitOption = Option{
+		Name:        "unit",
+		Type:        OptionString,
+		Description: "Unit the output's coordinates are written in",
+		Enum:        []string{"micron", "millimeter", "centimeter", "meter", "inch", "foot"},
+		Default:     "millimeter",
+	}
+	sourceUnitOption = Option{
+		Name:        "sourceUnit",
+		Type:        OptionString,
+		Description: "Unit of the source's coordinates, which STL and PLY files do not record",
+		Enum:        unitOption.Enum,
+		Default:     "millimeter",
+	}
+	encodingOption = Option{
+		Name:        "encoding",
+		Type:        OptionString,
+		Description: "Whether the file is written as binary or ASCII",
+		Enum:        []string{"binary", "ascii"},
+		Default:     "binary",
+	}
+)
+
+// meshOutputOptions are the options of converters writing a printing format
+func meshOutputOptions(to string) []Option {
+	if to == "3mf" {
+		return []Option{unitOption}
+	}
+	return []Option{unitOption, encodingOption}
+}
+
+// meshConverters read and write the printing formats with the mesh package.
+// Every glTF-based and printing format converts to every printing format,
+// and printing formats convert to the glTF-based ones.
+func meshConverters() []Converter {
+	var converters []Converter
+	for _, from := range append([]string{"glb", "gltf", "gltf-zip"}, meshFormats...) {
+		var inputOptions []Option
+		if from == "stl" || from == "ply" {
+			inputOptions = []Option{sourceUnitOption}
+		}
+		for _, to := range meshFormats {
+			if from == to {
+				continue
+			}
+			converters = append(converters, Converter{
+				From:    from,
+				To:      to,
+				Backend: BackendNative,
+				Name:    "mesh-" + to,
+				Options: append(append([]Option{}, inputOptions...), meshOutputOptions(to)...),
+				Limits:  nativeLimits,
+			})
+		}
+		if !slices.Contains(meshFormats, from) {
+			continue
+		}
+		for _, to := range []string{"glb", "gltf", "usdz"} {
+			options := inputOptions
+			if to == "gltf" {
+				options = append(append([]Option{}, inputOptions...), embedOption)
+			}
+			converters = append(converters, Converter{
+				From:    from,
+				To:      to,
+				Backend: BackendNative,
+				Name:    "mesh-" + to,
+				Options: options,
+				Limits:  nativeLimits,
+			})
+		}
+	}
+	return converters
+}
+
+// nativeConverters repackage glTF containers, write USDZ, convert the
+// printing formats and read binary FBX in Go, which is faster than Blender
+// and keeps everything the asset holds
+func nativeConverters() []Converter {
+	return append([]Converter{
+		{From: "glb", To: "gltf", Backend: BackendNative, Name: "gltf-split", Options: []Option{embedOption}, Limits: nativeLimits},
+		{From: "gltf", To: "glb", Backend: BackendNative, Name: "gltf-pack", Limits: nativeLimits},
+		{From: "gltf-zip", To: "glb", Backend: BackendNative, Name: "gltf-pack", Limits: nativeLimits},
+		{From: "gltf-zip", To: "gltf", Backend: BackendNative, Name: "gltf-split", Options: []Option{embedOption}, Limits: nativeLimits},
+		{From: "glb", To: "usdz", Backend: BackendNative, Name: "usdz", Limits: nativeLimits},
+		{From: "gltf", To: "usdz", Backend: BackendNative, Name: "usdz", Limits: nativeLimits},
+		{From: "gltf-zip", To: "usdz", Backend: BackendNative, Name: "usdz", Limits: nativeLimits},
+		{From: "fbx", To: "glb", Backend: BackendNative, Name: "fbx-glb", Limits: nativeLimits},
+	}, meshConverters()...)
+}
+
+func mustRegistry(converters ...Converter) *Registry {
+	registry, err := NewRegistry(converters...)
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// defaultRegistry registers the Blender and native converters, then the http
+// converters of the http_converters environment variable. Converters
+// registered later take over their pairs.
+func defaultRegistry() *Registry {
+	registry := mustRegistry(append(blenderConverters(), nativeConverters()...)...)
+	if value := os.Getenv("http_converters"); value != "" {
+		if err := registry.RegisterHTTPConverters(value); err != nil {
+			log.Printf("Invalid http_converters %q, ignoring them: %v", value, err)
+		}
+	}
+	return registry
+}
+
+// Default is the registry conversion requests are routed with
+var Default = defaultRegistry()
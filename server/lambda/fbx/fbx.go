@@ -0,0 +1,395 @@
+// Package fbx reads binary FBX 7.x files: the node records they are made of,
+// and the meshes, materials and node hierarchy of the scene they describe.
+package fbx
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+var (
+	// ErrInvalid wraps every reason a file is malformed
+	ErrInvalid = errors.New("invalid FBX")
+	// ErrUnsupported is returned for FBX files this package does not read,
+	// such as ASCII files and versions other than 7.x
+	ErrUnsupported = errors.New("unsupported FBX")
+)
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, args...))
+}
+
+func unsupported(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrUnsupported, fmt.Sprintf(format, args...))
+}
+
+// Magic starts every binary FBX file, followed by a little-endian uint32
+// version
+const Magic = "Kaydara FBX Binary  \x00\x1a\x00"
+
+const (
+	headerSize = len(Magic) + 4
+	// maxDepth stops node records nested deeper than any exporter writes
+	maxDepth = 64
+	// maxArrayLength caps the elements of one array property
+	maxArrayLength = 1 << 26
+	// maxDecompressedSize caps what the compressed arrays of a file expand
+	// to, which may be far more than the file holds
+	maxDecompressedSize = 1 << 30
+)
+
+// Property is one value of a node record. Type is the FBX type code, and the
+// field matching it holds the value: Int for Y, C, I and L, Float for F and D,
+// Bytes for S and R, Ints for i, l and b arrays and Floats for f and d arrays.
+type Property struct {
+	Type   byte
+	Int    int64
+	Float  float64
+	Bytes  []byte
+	Ints   []int64
+	Floats []float64
+}
+
+// String returns the value of an S property
+func (p Property) String() string {
+	return string(p.Bytes)
+}
+
+// Number returns the value of a scalar property as a float
+func (p Property) Number() (float64, bool) {
+	switch p.Type {
+	case 'Y', 'C', 'I', 'L':
+		return float64(p.Int), true
+	case 'F', 'D':
+		return p.Float, true
+	}
+	return 0, false
+}
+
+// Node is a node record with its properties and nested records
+type Node struct {
+	Name       string
+	Properties []Property
+	Children   []*Node
+}
+
+// Child returns the first nested record with the given name
+func (n *Node) Child(name string) *Node {
+	for _, child := range n.Children {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// ChildrenNamed returns every nested record with the given name
+func (n *Node) ChildrenNamed(name string) []*Node {
+	var children []*Node
+	for _, child := range n.Children {
+		if child.Name == name {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// File is a parsed FBX file. Its top-level records are the children of Root.
+type File struct {
+	Version uint32
+	Root    *Node
+}
+
+// IsBinary reports whether data starts like a binary FBX file
+func IsBinary(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// Parse reads the node records of a binary FBX file
+func Parse(data []byte) (*File, error) {
+	if !IsBinary(data) {
+		if bytes.HasPrefix(bytes.TrimLeft(data, "\xef\xbb\xbf \t\r\n"), []byte(";")) {
+			return nil, unsupported("ASCII FBX files are not supported, export as binary")
+		}
+		return nil, invalid("not an FBX file")
+	}
+	if len(data) < headerSize {
+		return nil, invalid("the file ends in its header")
+	}
+	version := binary.LittleEndian.Uint32(data[len(Magic):])
+	if version < 7000 || version >= 8000 {
+		return nil, unsupported("version %d, only 7.x files are read", version)
+	}
+
+	p := &parser{data: data, offset: headerSize, wide: version >= 7500}
+	root := &Node{}
+	for {
+		node, err := p.node(0)
+		if err != nil {
+			return nil, err
+		}
+		// The top-level list ends with a null record, which a truncated
+		// upload is missing
+		if node == nil {
+			break
+		}
+		root.Children = append(root.Children, node)
+	}
+	return &File{Version: version, Root: root}, nil
+}
+
+type parser struct {
+	data   []byte
+	offset int
+	// wide records, from version 7500, have 64-bit offsets and counts
+	wide bool
+	// decompressed counts the bytes compressed arrays expanded to
+	decompressed int
+}
+
+func (p *parser) nullRecordSize() int {
+	if p.wide {
+		return 25
+	}
+	return 13
+}
+
+func (p *parser) take(n int) ([]byte, error) {
+	if n < 0 || n > len(p.data)-p.offset {
+		return nil, invalid("the file ends inside a record at byte %d", p.offset)
+	}
+	out := p.data[p.offset : p.offset+n]
+	p.offset += n
+	return out, nil
+}
+
+func (p *parser) uint(size int) (uint64, error) {
+	raw, err := p.take(size)
+	if err != nil {
+		return 0, err
+	}
+	if size == 8 {
+		return binary.LittleEndian.Uint64(raw), nil
+	}
+	return uint64(binary.LittleEndian.Uint32(raw)), nil
+}
+
+// node reads one record and the records nested in it, returning nil for the
+// null record that ends a list
+func (p *parser) node(depth int) (*Node, error) {
+	if depth > maxDepth {
+		return nil, invalid("records are nested more than %d deep", maxDepth)
+	}
+	start := p.offset
+	size := 4
+	if p.wide {
+		size = 8
+	}
+	endOffset, err := p.uint(size)
+	if err != nil {
+		return nil, err
+	}
+	propertyCount, err := p.uint(size)
+	if err != nil {
+		return nil, err
+	}
+	// The length of the property list is implied by the properties
+	if _, err := p.uint(size); err != nil {
+		return nil, err
+	}
+	nameLength, err := p.take(1)
+	if err != nil {
+		return nil, err
+	}
+	if endOffset == 0 {
+		p.offset = start + p.nullRecordSize()
+		if p.offset > len(p.data) {
+			return nil, invalid("the file ends inside a record at byte %d", start)
+		}
+		return nil, nil
+	}
+	if endOffset <= uint64(start) || endOffset > uint64(len(p.data)) {
+		return nil, invalid("record at byte %d ends at %d, outside the file", start, endOffset)
+	}
+	end := int(endOffset)
+	name, err := p.take(int(nameLength[0]))
+	if err != nil {
+		return nil, err
+	}
+	node := &Node{Name: string(name)}
+
+	// Every property takes at least a byte, which bounds the count
+	if propertyCount > uint64(end-p.offset) {
+		return nil, invalid("record %s has %d properties in %d bytes", node.Name, propertyCount, end-p.offset)
+	}
+	node.Properties = make([]Property, 0, propertyCount)
+	for i := uint64(0); i < propertyCount; i++ {
+		property, err := p.property()
+		if err != nil {
+			return nil, fmt.Errorf("record %s: %w", node.Name, err)
+		}
+		node.Properties = append(node.Properties, property)
+	}
+	if p.offset > end {
+		return nil, invalid("the properties of record %s run past its end", node.Name)
+	}
+
+	for p.offset < end {
+		child, err := p.node(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if child == nil {
+			break
+		}
+		node.Children = append(node.Children, child)
+	}
+	if p.offset != end {
+		return nil, invalid("record %s ends at byte %d, not %d", node.Name, p.offset, end)
+	}
+	return node, nil
+}
+
+func (p *parser) property() (Property, error) {
+	code, err := p.take(1)
+	if err != nil {
+		return Property{}, err
+	}
+	property := Property{Type: code[0]}
+	switch property.Type {
+	case 'Y':
+		raw, err := p.take(2)
+		if err != nil {
+			return Property{}, err
+		}
+		property.Int = int64(int16(binary.LittleEndian.Uint16(raw)))
+	case 'C':
+		raw, err := p.take(1)
+		if err != nil {
+			return Property{}, err
+		}
+		property.Int = int64(raw[0])
+	case 'I':
+		raw, err := p.take(4)
+		if err != nil {
+			return Property{}, err
+		}
+		property.Int = int64(int32(binary.LittleEndian.Uint32(raw)))
+	case 'L':
+		raw, err := p.take(8)
+		if err != nil {
+			return Property{}, err
+		}
+		property.Int = int64(binary.LittleEndian.Uint64(raw))
+	case 'F':
+		raw, err := p.take(4)
+		if err != nil {
+			return Property{}, err
+		}
+		property.Float = float64(math.Float32frombits(binary.LittleEndian.Uint32(raw)))
+	case 'D':
+		raw, err := p.take(8)
+		if err != nil {
+			return Property{}, err
+		}
+		property.Float = math.Float64frombits(binary.LittleEndian.Uint64(raw))
+	case 'S', 'R':
+		length, err := p.uint(4)
+		if err != nil {
+			return Property{}, err
+		}
+		if property.Bytes, err = p.take(int(length)); err != nil {
+			return Property{}, err
+		}
+	case 'f', 'd', 'i', 'l', 'b':
+		if err := p.array(&property); err != nil {
+			return Property{}, err
+		}
+	default:
+		return Property{}, invalid("unknown property type %q at byte %d", property.Type, p.offset-1)
+	}
+	return property, nil
+}
+
+// arrayElementSizes are the sizes of the elements of each array type
+var arrayElementSizes = map[byte]int{'f': 4, 'd': 8, 'i': 4, 'l': 8, 'b': 1}
+
+func (p *parser) array(property *Property) error {
+	length, err := p.uint(4)
+	if err != nil {
+		return err
+	}
+	encoding, err := p.uint(4)
+	if err != nil {
+		return err
+	}
+	storedLength, err := p.uint(4)
+	if err != nil {
+		return err
+	}
+	stored, err := p.take(int(storedLength))
+	if err != nil {
+		return err
+	}
+	if length > maxArrayLength {
+		return invalid("an array of %d elements is larger than the %d supported", length, maxArrayLength)
+	}
+	size := arrayElementSizes[property.Type] * int(length)
+
+	raw := stored
+	switch encoding {
+	case 0:
+	case 1:
+		reader, err := zlib.NewReader(bytes.NewReader(stored))
+		if err != nil {
+			return invalid("compressed array: %v", err)
+		}
+		if p.decompressed += size; p.decompressed > maxDecompressedSize {
+			return invalid("compressed arrays expand to more than %d bytes", maxDecompressedSize)
+		}
+		// One byte more than expected tells an overlong stream apart
+		raw, err = io.ReadAll(io.LimitReader(reader, int64(size)+1))
+		if err != nil {
+			return invalid("compressed array: %v", err)
+		}
+	default:
+		return unsupported("array encoding %d", encoding)
+	}
+	if len(raw) != size {
+		return invalid("an array of %d elements holds %d bytes", length, len(raw))
+	}
+
+	switch property.Type {
+	case 'f':
+		property.Floats = make([]float64, length)
+		for i := range property.Floats {
+			property.Floats[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:])))
+		}
+	case 'd':
+		property.Floats = make([]float64, length)
+		for i := range property.Floats {
+			property.Floats[i] = math.Float64frombits(binary.LittleEndian.Uint64(raw[i*8:]))
+		}
+	case 'i':
+		property.Ints = make([]int64, length)
+		for i := range property.Ints {
+			property.Ints[i] = int64(int32(binary.LittleEndian.Uint32(raw[i*4:])))
+		}
+	case 'l':
+		property.Ints = make([]int64, length)
+		for i := range property.Ints {
+			property.Ints[i] = int64(binary.LittleEndian.Uint64(raw[i*8:]))
+		}
+	case 'b':
+		property.Ints = make([]int64, length)
+		for i := range property.Ints {
+			property.Ints[i] = int64(raw[i])
+		}
+	}
+	return nil
+}
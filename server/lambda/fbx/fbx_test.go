@@ -0,0 +1,410 @@
+package fbx
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"math"
+	"testing"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/gltf"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testNode is a record to encode. Properties are int16, bool, int32, int64,
+// float32, float64, string, []byte, []int32, []int64 or []float64.
+type testNode struct {
+	name       string
+	properties []any
+	children   []testNode
+}
+
+func node(name string, properties ...any) testNode {
+	return testNode{name: name, properties: properties}
+}
+
+func (n testNode) with(children ...testNode) testNode {
+	n.children = append(n.children, children...)
+	return n
+}
+
+type encoder struct {
+	wide     bool
+	compress bool
+}
+
+// encode writes a binary FBX file with the given top-level records
+func encode(version uint32, compress bool, nodes ...testNode) []byte {
+	e := encoder{wide: version >= 7500, compress: compress}
+	out := []byte(Magic)
+	out = binary.LittleEndian.AppendUint32(out, version)
+	for _, n := range nodes {
+		out = e.node(out, n)
+	}
+	out = append(out, make([]byte, e.nullRecordSize())...)
+	// Footer padding, which readers ignore
+	return append(out, make([]byte, 16)...)
+}
+
+func (e encoder) nullRecordSize() int {
+	if e.wide {
+		return 25
+	}
+	return 13
+}
+
+func (e encoder) appendUint(out []byte, value int) []byte {
+	if e.wide {
+		return binary.LittleEndian.AppendUint64(out, uint64(value))
+	}
+	return binary.LittleEndian.AppendUint32(out, uint32(value))
+}
+
+// node appends a record to out, which holds the file so far, so the end
+// offsets it writes are absolute
+func (e encoder) node(out []byte, n testNode) []byte {
+	var properties []byte
+	for _, property := range n.properties {
+		properties = e.property(properties, property)
+	}
+	start := len(out)
+	out = e.appendUint(out, 0)
+	out = e.appendUint(out, len(n.properties))
+	out = e.appendUint(out, len(properties))
+	out = append(out, byte(len(n.name)))
+	out = append(out, n.name...)
+	out = append(out, properties...)
+	for _, child := range n.children {
+		out = e.node(out, child)
+	}
+	if len(n.children) > 0 {
+		out = append(out, make([]byte, e.nullRecordSize())...)
+	}
+	if e.wide {
+		binary.LittleEndian.PutUint64(out[start:], uint64(len(out)))
+	} else {
+		binary.LittleEndian.PutUint32(out[start:], uint32(len(out)))
+	}
+	return out
+}
+
+func (e encoder) array(out []byte, code byte, count int, raw []byte) []byte {
+	out = append(out, code)
+	out = binary.LittleEndian.AppendUint32(out, uint32(count))
+	if !e.compress {
+		out = binary.LittleEndian.AppendUint32(out, 0)
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(raw)))
+		return append(out, raw...)
+	}
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write(raw)
+	w.Close()
+	out = binary.LittleEndian.AppendUint32(out, 1)
+	out = binary.LittleEndian.AppendUint32(out, uint32(compressed.Len()))
+	return append(out, compressed.Bytes()...)
+}
+
+func (e encoder) property(out []byte, value any) []byte {
+	switch v := value.(type) {
+	case int16:
+		return binary.LittleEndian.AppendUint16(append(out, 'Y'), uint16(v))
+	case bool:
+		if v {
+			return append(out, 'C', 1)
+		}
+		return append(out, 'C', 0)
+	case int32:
+		return binary.LittleEndian.AppendUint32(append(out, 'I'), uint32(v))
+	case int64:
+		return binary.LittleEndian.AppendUint64(append(out, 'L'), uint64(v))
+	case float32:
+		return binary.LittleEndian.AppendUint32(append(out, 'F'), math.Float32bits(v))
+	case float64:
+		return binary.LittleEndian.AppendUint64(append(out, 'D'), math.Float64bits(v))
+	case string:
+		out = binary.LittleEndian.AppendUint32(append(out, 'S'), uint32(len(v)))
+		return append(out, v...)
+	case []byte:
+		out = binary.LittleEndian.AppendUint32(append(out, 'R'), uint32(len(v)))
+		return append(out, v...)
+	case []int32:
+		var raw []byte
+		for _, x := range v {
+			raw = binary.LittleEndian.AppendUint32(raw, uint32(x))
+		}
+		return e.array(out, 'i', len(v), raw)
+	case []int64:
+		var raw []byte
+		for _, x := range v {
+			raw = binary.LittleEndian.AppendUint64(raw, uint64(x))
+		}
+		return e.array(out, 'l', len(v), raw)
+	case []float64:
+		var raw []byte
+		for _, x := range v {
+			raw = binary.LittleEndian.AppendUint64(raw, math.Float64bits(x))
+		}
+		return e.array(out, 'd', len(v), raw)
+	}
+	panic("unknown property type")
+}
+
+// p is a Properties70 entry
+func p(name string, kind string, values ...any) testNode {
+	return node("P", append([]any{name, kind, "", "A"}, values...)...)
+}
+
+// testScene is a parent model, rotated 90 degrees about Y, with a child mesh
+// model moved 2 units along X. The mesh is a quad and a triangle with a
+// material each, in a Z up file in meters.
+func testScene(version uint32, compress bool) []byte {
+	quadAndTriangle := node("Geometry", int64(100), "Shape\x00\x01Geometry", "Mesh").with(
+		node("Vertices", []float64{0, 0, 0, 1, 0, 0, 1, 1, 0, 0, 1, 0, 2, 0, 0}),
+		node("PolygonVertexIndex", []int32{0, 1, 2, ^3, 1, 4, ^2}),
+		node("LayerElementNormal", int32(0)).with(
+			node("MappingInformationType", "ByVertice"),
+			node("ReferenceInformationType", "Direct"),
+			node("Normals", []float64{0, 0, 2, 0, 0, 2, 0, 0, 2, 0, 0, 2, 0, 0, 2}),
+		),
+		node("LayerElementUV", int32(0)).with(
+			node("MappingInformationType", "ByPolygonVertex"),
+			node("ReferenceInformationType", "IndexToDirect"),
+			node("UV", []float64{0, 0, 1, 0, 1, 1, 0, 1}),
+			node("UVIndex", []int32{0, 1, 2, 3, 0, 1, 2}),
+		),
+		node("LayerElementMaterial", int32(0)).with(
+			node("MappingInformationType", "ByPolygon"),
+			node("ReferenceInformationType", "IndexToDirect"),
+			node("Materials", []int32{0, 1}),
+		),
+	)
+	return encode(version, compress,
+		node("FBXHeaderExtension").with(node("FBXVersion", int32(version))),
+		node("GlobalSettings").with(node("Properties70").with(
+			p("UpAxis", "int", int32(2)),
+			p("UpAxisSign", "int", int32(1)),
+			p("FrontAxis", "int", int32(1)),
+			p("FrontAxisSign", "int", int32(-1)),
+			p("CoordAxis", "int", int32(0)),
+			p("CoordAxisSign", "int", int32(1)),
+			p("UnitScaleFactor", "double", float64(100)),
+		)),
+		node("Objects").with(
+			quadAndTriangle,
+			node("Model", int64(200), "Parent\x00\x01Model", "Null").with(node("Properties70").with(
+				p("Lcl Rotation", "Lcl Rotation", float64(0), float64(90), float64(0)),
+			)),
+			node("Model", int64(300), "Child\x00\x01Model", "Mesh").with(node("Properties70").with(
+				p("Lcl Translation", "Lcl Translation", float64(2), float64(0), float64(0)),
+			)),
+			node("Material", int64(400), "Red\x00\x01Material", "").with(node("Properties70").with(
+				p("DiffuseColor", "Color", float64(1), float64(0), float64(0)),
+			)),
+			node("Material", int64(500), "Glass\x00\x01Material", "").with(node("Properties70").with(
+				p("DiffuseColor", "Color", float64(0), float64(0), float64(1)),
+				p("Opacity", "double", float64(0.5)),
+			)),
+		),
+		node("Connections").with(
+			node("C", "OO", int64(200), int64(0)),
+			node("C", "OO", int64(300), int64(200)),
+			node("C", "OO", int64(100), int64(300)),
+			node("C", "OO", int64(400), int64(300)),
+			node("C", "OO", int64(500), int64(300)),
+		),
+	)
+}
+
+func TestParse_ReadsRecordsOfEveryWidthAndEncoding(t *testing.T) {
+	for _, version := range []uint32{7400, 7500} {
+		for _, compress := range []bool{false, true} {
+			data := encode(version, compress, node("Test", int16(-2), true, int32(-3), int64(1<<40), float32(1.5), 2.25, "text", []byte{1, 2}).with(
+				node("Ints", []int32{1, -2, 3}),
+				node("Longs", []int64{1 << 40}),
+				node("Doubles", []float64{0.5, -1}),
+			), node("Empty"))
+			file, err := Parse(data)
+			if !assert.NoError(t, err, version) {
+				continue
+			}
+			assert.Equal(t, version, file.Version)
+			if !assert.Len(t, file.Root.Children, 2) {
+				continue
+			}
+			test := file.Root.Children[0]
+			assert.Equal(t, "Test", test.Name)
+			values := []int64{-2, 1, -3, 1 << 40}
+			for i, value := range values {
+				assert.Equal(t, value, test.Properties[i].Int)
+			}
+			assert.Equal(t, 1.5, test.Properties[4].Float)
+			assert.Equal(t, 2.25, test.Properties[5].Float)
+			assert.Equal(t, "text", test.Properties[6].String())
+			assert.Equal(t, []byte{1, 2}, test.Properties[7].Bytes)
+			assert.Equal(t, []int64{1, -2, 3}, test.Child("Ints").Properties[0].Ints)
+			assert.Equal(t, []int64{1 << 40}, test.Child("Longs").Properties[0].Ints)
+			assert.Equal(t, []float64{0.5, -1}, test.Child("Doubles").Properties[0].Floats)
+			assert.Equal(t, "Empty", file.Root.Children[1].Name)
+		}
+	}
+}
+
+func TestParse_Rejections(t *testing.T) {
+	valid := testScene(7400, true)
+	badArray := encode(7400, false, node("Test", []int32{1, 2}))
+	// Claim three elements for the two stored
+	copy(badArray[headerSize+13+len("Test")+1:], []byte{3, 0, 0, 0})
+	badEnd := append([]byte{}, valid...)
+	binary.LittleEndian.PutUint32(badEnd[headerSize:], uint32(len(valid)+1))
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"ascii", []byte("; FBX 7.4.0 project file\nFBXHeaderExtension:  {\n"), ErrUnsupported},
+		{"old version", append([]byte(Magic), 0xd4, 0x17, 0, 0), ErrUnsupported},
+		{"not fbx", []byte("glTF"), ErrInvalid},
+		{"array length", badArray, ErrInvalid},
+		{"record end outside the file", badEnd, ErrInvalid},
+	}
+	for _, tt := range tests {
+		_, err := Read(tt.data)
+		assert.ErrorIs(t, err, tt.err, tt.name)
+	}
+}
+
+func TestRead_TruncatedFilesFailWithoutPanicking(t *testing.T) {
+	data := testScene(7500, true)
+	// The footer is all that may be cut off
+	records := len(data) - 16
+	for length := 0; length < records; length++ {
+		_, err := Read(data[:length])
+		assert.Error(t, err, length)
+	}
+}
+
+func TestRead_Scene(t *testing.T) {
+	scene, err := Read(testScene(7400, true))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1.0, scene.UnitScale)
+	if !assert.Len(t, scene.Roots, 1) {
+		return
+	}
+	parent := scene.Roots[0]
+	assert.Equal(t, "Parent", parent.Name)
+	assert.Equal(t, "Null", parent.Type)
+	assert.Nil(t, parent.Mesh)
+	if !assert.Len(t, parent.Children, 1) {
+		return
+	}
+	child := parent.Children[0]
+	assert.Equal(t, translation([3]float64{2, 0, 0}), child.Transform)
+	if assert.Len(t, child.Materials, 2) {
+		assert.Equal(t, "Red", child.Materials[0].Name)
+		assert.Equal(t, [3]float64{0, 0, 1}, child.Materials[1].Diffuse)
+		assert.Equal(t, 0.5, child.Materials[1].Opacity)
+	}
+
+	mesh := child.Mesh
+	if !assert.NotNil(t, mesh) {
+		return
+	}
+	assert.Equal(t, 2, mesh.PolygonCount())
+	assert.Equal(t, []int{0, 4, 7}, mesh.PolygonStarts)
+	assert.Equal(t, []int32{0, 1, 2, 3, 1, 4, 2}, mesh.Corners)
+	// Indexed UVs are resolved per corner
+	assert.Equal(t, []float64{0, 0, 1, 0, 1, 1, 0, 1, 0, 0, 1, 0, 1, 1}, mesh.UVs)
+	assert.Len(t, mesh.Normals, 7*3)
+	assert.Equal(t, []int32{0, 1}, mesh.PolygonMaterials)
+}
+
+func TestModelTransforms(t *testing.T) {
+	local, geometric := modelTransforms(map[string][]Property{
+		"Lcl Translation": {{Type: 'D', Float: 1}, {Type: 'D', Float: 2}, {Type: 'D', Float: 3}},
+		"Lcl Rotation":    {{Type: 'D', Float: 0}, {Type: 'D', Float: 0}, {Type: 'D', Float: 90}},
+		"Lcl Scaling":     {{Type: 'D', Float: 2}, {Type: 'D', Float: 2}, {Type: 'D', Float: 2}},
+	})
+	assert.Equal(t, identity, geometric)
+	// (1, 0, 0) is scaled to (2, 0, 0), turned to (0, 2, 0) and moved
+	x := [3]float64{local[0] + local[12], local[1] + local[13], local[2] + local[14]}
+	assert.InDeltaSlice(t, []float64{1, 4, 3}, x[:], 1e-9)
+}
+
+// worldPosition applies the matrices of a node and its ancestors to a point
+func worldPosition(doc *gltf.Document, path []int, point [3]float64) [3]float64 {
+	world := gltf.Identity
+	for _, index := range path {
+		world = gltf.Multiply(world, doc.Nodes[index].LocalMatrix())
+	}
+	x, y, z := point[0], point[1], point[2]
+	return [3]float64{
+		world[0]*x + world[4]*y + world[8]*z + world[12],
+		world[1]*x + world[5]*y + world[9]*z + world[13],
+		world[2]*x + world[6]*y + world[10]*z + world[14],
+	}
+}
+
+func TestToGLTF(t *testing.T) {
+	scene, err := Read(testScene(7500, false))
+	if !assert.NoError(t, err) {
+		return
+	}
+	model, err := ToGLTF(scene)
+	if !assert.NoError(t, err) {
+		return
+	}
+	glb, err := model.WriteGLB()
+	assert.NoError(t, err)
+	model, err = gltf.Read(glb, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	doc := model.Document
+
+	assert.Equal(t, []int{0}, doc.SceneRoots())
+	assert.Equal(t, "RootNode", doc.Nodes[0].Name)
+	assert.Equal(t, "Parent", doc.Nodes[1].Name)
+	assert.Equal(t, "Child", doc.Nodes[2].Name)
+	if !assert.NotNil(t, doc.Nodes[2].Mesh) {
+		return
+	}
+	// Z up becomes Y up: the file's (2, 0, 0) in the child is turned about
+	// the file's Y by the parent to (0, 0, -2), which is (0, -2, 0) in glTF
+	assert.InDeltaSlice(t, []float64{0, -2, 0}, sliceOf(worldPosition(doc, []int{0, 1, 2}, [3]float64{0, 0, 0})), 1e-9)
+
+	mesh := doc.Meshes[*doc.Nodes[2].Mesh]
+	if !assert.Len(t, mesh.Primitives, 2) {
+		return
+	}
+	quad, triangle := mesh.Primitives[0], mesh.Primitives[1]
+	quadIndices, err := model.Triangles(quad)
+	assert.NoError(t, err)
+	assert.Len(t, quadIndices, 6)
+	triangleIndices, err := model.Triangles(triangle)
+	assert.NoError(t, err)
+	assert.Len(t, triangleIndices, 3)
+
+	normals, _, err := model.Floats(quad.Attributes["NORMAL"])
+	assert.NoError(t, err)
+	// Normals are normalized
+	assert.Equal(t, []float32{0, 0, 1}, normals[:3])
+	uvs, _, err := model.Floats(quad.Attributes["TEXCOORD_0"])
+	assert.NoError(t, err)
+	// V is flipped
+	assert.Equal(t, []float32{0, 1, 1, 1, 1, 0, 0, 0}, uvs)
+
+	if assert.Len(t, doc.Materials, 2) {
+		assert.Equal(t, []float64{1, 0, 0, 1}, doc.Materials[*quad.Material].PBRMetallicRoughness.BaseColorFactor)
+		glass := doc.Materials[*triangle.Material]
+		assert.Equal(t, []float64{0, 0, 1, 0.5}, glass.PBRMetallicRoughness.BaseColorFactor)
+		assert.Equal(t, "BLEND", glass.AlphaMode)
+	}
+}
+
+func sliceOf(v [3]float64) []float64 {
+	return v[:]
+}
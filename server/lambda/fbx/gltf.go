@@ -0,0 +1,333 @@
+package fbx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/gltf"
+)
+
+// Buffer view targets of vertex attributes and indices
+const (
+	arrayBufferTarget        = 34962
+	elementArrayBufferTarget = 34963
+)
+
+// ToGLTF returns the scene as a glTF model. Models keep their hierarchy under
+// a root node that turns the file's axes and unit into glTF's. Polygons are
+// split into triangle fans, one primitive per material. Embedded textures are
+// kept; textures the file only names are left out, since the single file
+// upload cannot include them.
+func ToGLTF(scene *Scene) (*gltf.Model, error) {
+	b := &gltfBuilder{
+		model:     &gltf.Model{Document: &gltf.Document{Asset: gltf.Asset{Version: "2.0"}}},
+		meshes:    map[meshKey]int{},
+		materials: map[*Material]int{},
+		textures:  map[*Texture]int{},
+	}
+	doc := b.model.Document
+	doc.Nodes = append(doc.Nodes, gltf.Node{Name: "RootNode"})
+	if root := multiply(scene.Axes, scaling([3]float64{scene.UnitScale, scene.UnitScale, scene.UnitScale})); root != identity {
+		doc.Nodes[0].Matrix = root[:]
+	}
+	for _, model := range scene.Roots {
+		child, err := b.node(model)
+		if err != nil {
+			return nil, err
+		}
+		doc.Nodes[0].Children = append(doc.Nodes[0].Children, child)
+	}
+	doc.Scene = gltf.Int(0)
+	doc.Scenes = []gltf.Scene{{Nodes: []int{0}}}
+	if len(b.buffer) > 0 {
+		doc.Buffers = []gltf.Buffer{{ByteLength: len(b.buffer)}}
+		b.model.Buffers = [][]byte{b.buffer}
+	}
+	return b.model, nil
+}
+
+// meshKey identifies a glTF mesh: models sharing a geometry share it only
+// when they also share its materials
+type meshKey struct {
+	mesh      *Mesh
+	materials string
+}
+
+type gltfBuilder struct {
+	model     *gltf.Model
+	buffer    []byte
+	meshes    map[meshKey]int
+	materials map[*Material]int
+	textures  map[*Texture]int
+}
+
+func (b *gltfBuilder) node(model *Model) (int, error) {
+	doc := b.model.Document
+	index := len(doc.Nodes)
+	doc.Nodes = append(doc.Nodes, gltf.Node{Name: model.Name})
+	if model.Transform != identity {
+		doc.Nodes[index].Matrix = model.Transform[:]
+	}
+	if model.Mesh != nil {
+		mesh, err := b.mesh(model)
+		if err != nil {
+			return 0, fmt.Errorf("model %s: %w", model.Name, err)
+		}
+		switch {
+		case mesh < 0:
+			// Meshes of points and lines have nothing to draw
+		case model.Geometric == identity:
+			doc.Nodes[index].Mesh = gltf.Int(mesh)
+		default:
+			// The geometric transform is not inherited by children
+			doc.Nodes = append(doc.Nodes, gltf.Node{Name: model.Name + "_geometry", Mesh: gltf.Int(mesh), Matrix: model.Geometric[:]})
+			doc.Nodes[index].Children = append(doc.Nodes[index].Children, len(doc.Nodes)-1)
+		}
+	}
+	for _, child := range model.Children {
+		childIndex, err := b.node(child)
+		if err != nil {
+			return 0, err
+		}
+		doc.Nodes[index].Children = append(doc.Nodes[index].Children, childIndex)
+	}
+	return index, nil
+}
+
+// vertexKey tells apart corners that can share a glTF vertex
+type vertexKey struct {
+	controlPoint int32
+	normal       [3]float64
+	uv           [2]float64
+}
+
+type primitiveBuilder struct {
+	vertices  map[vertexKey]uint32
+	positions []float32
+	normals   []float32
+	uvs       []float32
+	indices   []uint32
+}
+
+// mesh returns the glTF mesh of a model, or -1 when it has no triangles
+func (b *gltfBuilder) mesh(model *Model) (int, error) {
+	key := meshKey{mesh: model.Mesh}
+	for _, material := range model.Materials {
+		key.materials += fmt.Sprintf("%d,", material.ID)
+	}
+	if index, ok := b.meshes[key]; ok {
+		return index, nil
+	}
+
+	m := model.Mesh
+	// Polygons are grouped by material, in the order materials first appear
+	var order []int32
+	primitives := map[int32]*primitiveBuilder{}
+	for polygon := 0; polygon < m.PolygonCount(); polygon++ {
+		start, end := m.PolygonStarts[polygon], m.PolygonStarts[polygon+1]
+		if end-start < 3 {
+			continue
+		}
+		material := int32(0)
+		if m.PolygonMaterials != nil {
+			material = m.PolygonMaterials[polygon]
+		}
+		if material < 0 || int(material) >= len(model.Materials) {
+			material = -1
+		}
+		p, ok := primitives[material]
+		if !ok {
+			p = &primitiveBuilder{vertices: map[vertexKey]uint32{}}
+			primitives[material] = p
+			order = append(order, material)
+		}
+		corner := func(i int) uint32 { return p.vertex(m, i) }
+		for i := start + 2; i < end; i++ {
+			p.indices = append(p.indices, corner(start), corner(i-1), corner(i))
+		}
+	}
+
+	if len(order) == 0 {
+		b.meshes[key] = -1
+		return -1, nil
+	}
+	gltfMesh := gltf.Mesh{Name: m.Name}
+	for _, material := range order {
+		p := primitives[material]
+		primitive, err := b.primitive(p, m)
+		if err != nil {
+			return 0, err
+		}
+		if material >= 0 {
+			primitive.Material = gltf.Int(b.material(model.Materials[material]))
+		}
+		gltfMesh.Primitives = append(gltfMesh.Primitives, primitive)
+	}
+	doc := b.model.Document
+	doc.Meshes = append(doc.Meshes, gltfMesh)
+	b.meshes[key] = len(doc.Meshes) - 1
+	return len(doc.Meshes) - 1, nil
+}
+
+// vertex returns the index of the vertex for a corner, adding it when no
+// earlier corner had the same position, normal and UV
+func (p *primitiveBuilder) vertex(m *Mesh, corner int) uint32 {
+	key := vertexKey{controlPoint: m.Corners[corner]}
+	if m.Normals != nil {
+		copy(key.normal[:], m.Normals[corner*3:corner*3+3])
+	}
+	if m.UVs != nil {
+		copy(key.uv[:], m.UVs[corner*2:corner*2+2])
+	}
+	if index, ok := p.vertices[key]; ok {
+		return index
+	}
+	index := uint32(len(p.positions) / 3)
+	p.vertices[key] = index
+	cp := int(key.controlPoint) * 3
+	for _, value := range m.ControlPoints[cp : cp+3] {
+		p.positions = append(p.positions, float32(value))
+	}
+	if m.Normals != nil {
+		n := key.normal
+		length := math.Sqrt(n[0]*n[0] + n[1]*n[1] + n[2]*n[2])
+		if length == 0 || math.IsNaN(length) || math.IsInf(length, 0) {
+			n, length = [3]float64{0, 1, 0}, 1
+		}
+		p.normals = append(p.normals, float32(n[0]/length), float32(n[1]/length), float32(n[2]/length))
+	}
+	if m.UVs != nil {
+		// FBX V runs up the image, glTF's runs down
+		p.uvs = append(p.uvs, float32(key.uv[0]), float32(1-key.uv[1]))
+	}
+	return index
+}
+
+func (b *gltfBuilder) primitive(p *primitiveBuilder, m *Mesh) (gltf.Primitive, error) {
+	attributes := map[string]int{}
+	minimum, maximum := []float64{0, 0, 0}, []float64{0, 0, 0}
+	for axis := 0; axis < 3; axis++ {
+		minimum[axis], maximum[axis] = math.Inf(1), math.Inf(-1)
+	}
+	for i, value := range p.positions {
+		if math.IsNaN(float64(value)) || math.IsInf(float64(value), 0) {
+			return gltf.Primitive{}, invalid("geometry %d has a vertex that is not a finite number", m.ID)
+		}
+		minimum[i%3] = math.Min(minimum[i%3], float64(value))
+		maximum[i%3] = math.Max(maximum[i%3], float64(value))
+	}
+	count := len(p.positions) / 3
+	attributes["POSITION"] = b.accessor(float32Bytes(p.positions), arrayBufferTarget, gltf.Accessor{
+		ComponentType: gltf.ComponentFloat, Count: count, Type: "VEC3", Min: minimum, Max: maximum,
+	})
+	if p.normals != nil {
+		attributes["NORMAL"] = b.accessor(float32Bytes(p.normals), arrayBufferTarget, gltf.Accessor{
+			ComponentType: gltf.ComponentFloat, Count: count, Type: "VEC3",
+		})
+	}
+	if p.uvs != nil {
+		attributes["TEXCOORD_0"] = b.accessor(float32Bytes(p.uvs), arrayBufferTarget, gltf.Accessor{
+			ComponentType: gltf.ComponentFloat, Count: count, Type: "VEC2",
+		})
+	}
+	indices := make([]byte, 0, len(p.indices)*4)
+	for _, index := range p.indices {
+		indices = binary.LittleEndian.AppendUint32(indices, index)
+	}
+	indicesAccessor := b.accessor(indices, elementArrayBufferTarget, gltf.Accessor{
+		ComponentType: gltf.ComponentUnsignedInt, Count: len(p.indices), Type: "SCALAR",
+	})
+	return gltf.Primitive{Attributes: attributes, Indices: gltf.Int(indicesAccessor)}, nil
+}
+
+// accessor adds a buffer view holding data and an accessor reading it. Every
+// view holds four byte components, so views stay aligned.
+func (b *gltfBuilder) accessor(data []byte, target int, accessor gltf.Accessor) int {
+	doc := b.model.Document
+	doc.BufferViews = append(doc.BufferViews, gltf.BufferView{ByteOffset: len(b.buffer), ByteLength: len(data), Target: target})
+	b.buffer = append(b.buffer, data...)
+	accessor.BufferView = gltf.Int(len(doc.BufferViews) - 1)
+	doc.Accessors = append(doc.Accessors, accessor)
+	return len(doc.Accessors) - 1
+}
+
+// material turns Phong properties into metallic-roughness ones: no metal,
+// and a roughness from the shininess exponent
+func (b *gltfBuilder) material(material *Material) int {
+	if index, ok := b.materials[material]; ok {
+		return index
+	}
+	clamp := func(v float64) float64 { return math.Max(0, math.Min(1, v)) }
+	metallic := 0.0
+	roughness := clamp(math.Sqrt(2 / (math.Max(material.Shininess, 0) + 2)))
+	out := gltf.Material{
+		Name: material.Name,
+		PBRMetallicRoughness: &gltf.PBRMetallicRoughness{
+			BaseColorFactor: []float64{clamp(material.Diffuse[0]), clamp(material.Diffuse[1]), clamp(material.Diffuse[2]), clamp(material.Opacity)},
+			MetallicFactor:  &metallic,
+			RoughnessFactor: &roughness,
+		},
+	}
+	if material.Opacity < 1 {
+		out.AlphaMode = "BLEND"
+	}
+	if material.Emissive != [3]float64{} {
+		out.EmissiveFactor = []float64{clamp(material.Emissive[0]), clamp(material.Emissive[1]), clamp(material.Emissive[2])}
+	}
+	if texture, ok := b.texture(material.DiffuseTexture); ok {
+		out.PBRMetallicRoughness.BaseColorTexture = &gltf.TextureInfo{Index: texture}
+		// The texture replaces the diffuse color, FBX does not multiply them
+		out.PBRMetallicRoughness.BaseColorFactor = []float64{1, 1, 1, clamp(material.Opacity)}
+	}
+	if texture, ok := b.texture(material.NormalTexture); ok {
+		out.NormalTexture = &gltf.TextureInfo{Index: texture}
+	}
+	doc := b.model.Document
+	doc.Materials = append(doc.Materials, out)
+	b.materials[material] = len(doc.Materials) - 1
+	return len(doc.Materials) - 1
+}
+
+// imageMimeTypes are the embedded images glTF can hold, by their first bytes
+var imageMimeTypes = []struct {
+	magic    string
+	mimeType string
+}{
+	{"\x89PNG\r\n\x1a\n", "image/png"},
+	{"\xff\xd8\xff", "image/jpeg"},
+}
+
+// texture adds an embedded texture, and reports false for textures that are
+// missing, not embedded or in a format glTF has no core support for
+func (b *gltfBuilder) texture(texture *Texture) (int, bool) {
+	if texture == nil || len(texture.Content) == 0 {
+		return 0, false
+	}
+	if index, ok := b.textures[texture]; ok {
+		return index, index >= 0
+	}
+	b.textures[texture] = -1
+	mimeType := ""
+	for _, candidate := range imageMimeTypes {
+		if len(texture.Content) >= len(candidate.magic) && string(texture.Content[:len(candidate.magic)]) == candidate.magic {
+			mimeType = candidate.mimeType
+		}
+	}
+	if mimeType == "" {
+		return 0, false
+	}
+	doc := b.model.Document
+	doc.Images = append(doc.Images, gltf.Image{Name: texture.Name, MimeType: mimeType})
+	b.model.Images = append(b.model.Images, gltf.ImageData{MimeType: mimeType, Data: texture.Content})
+	doc.Textures = append(doc.Textures, gltf.Texture{Name: texture.Name, Source: gltf.Int(len(doc.Images) - 1)})
+	b.textures[texture] = len(doc.Textures) - 1
+	return len(doc.Textures) - 1, true
+}
+
+func float32Bytes(values []float32) []byte {
+	out := make([]byte, 0, len(values)*4)
+	for _, value := range values {
+		out = binary.LittleEndian.AppendUint32(out, math.Float32bits(value))
+	}
+	return out
+}
@@ -0,0 +1,528 @@
+package fbx
+
+import (
+	"math"
+	"strings"
+)
+
+// Scene is what a file describes: models in a hierarchy, with the meshes and
+// materials connected to them
+type Scene struct {
+	// Roots are the models connected to the scene's root
+	Roots []*Model
+	// Axes turns the file's coordinates into +X right, +Y up and +Z front,
+	// and UnitScale them into meters. Both are column-major matrices.
+	Axes      [16]float64
+	UnitScale float64
+}
+
+// Model is a node of the hierarchy. Only models of type Mesh have a mesh.
+type Model struct {
+	ID   int64
+	Name string
+	Type string
+	// Transform is relative to the parent, Geometric applies to the model's
+	// mesh but not to its children
+	Transform [16]float64
+	Geometric [16]float64
+	Mesh      *Mesh
+	// Materials are indexed by the mesh's PolygonMaterials
+	Materials []*Material
+	Children  []*Model
+}
+
+// Mesh is a polygon mesh. Normals and UVs are resolved to one value per
+// polygon corner, whatever mapping the file stores them with.
+type Mesh struct {
+	ID   int64
+	Name string
+	// ControlPoints are xyz positions
+	ControlPoints []float64
+	// Corners are the control point of every polygon corner, and
+	// PolygonStarts the first corner of every polygon followed by the number
+	// of corners
+	Corners       []int32
+	PolygonStarts []int
+	// Normals hold xyz and UVs uv per corner, and are nil when the mesh has
+	// none
+	Normals []float64
+	UVs     []float64
+	// PolygonMaterials index the model's materials per polygon, nil when every
+	// polygon uses the first
+	PolygonMaterials []int32
+}
+
+// PolygonCount is the number of polygons of the mesh
+func (m *Mesh) PolygonCount() int {
+	return len(m.PolygonStarts) - 1
+}
+
+// Material holds the Phong properties FBX exporters write
+type Material struct {
+	ID        int64
+	Name      string
+	Diffuse   [3]float64
+	Opacity   float64
+	Emissive  [3]float64
+	Shininess float64
+	// DiffuseTexture and NormalTexture are nil when nothing is connected
+	DiffuseTexture *Texture
+	NormalTexture  *Texture
+}
+
+// Texture is a file texture. Content holds the image when the file embeds
+// it, and is empty when only its file name was written.
+type Texture struct {
+	ID       int64
+	Name     string
+	FileName string
+	Content  []byte
+}
+
+// Read parses a binary FBX file and reads its scene
+func Read(data []byte) (*Scene, error) {
+	file, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return ReadScene(file)
+}
+
+type connection struct {
+	child    int64
+	property string
+}
+
+type sceneReader struct {
+	objects  map[int64]*Node
+	children map[int64][]connection
+	models   map[int64]*Model
+	meshes   map[int64]*Mesh
+	// materials and textures are shared by the models using them
+	materials map[int64]*Material
+	textures  map[int64]*Texture
+}
+
+// ReadScene reads the models, meshes and materials of a parsed file
+func ReadScene(file *File) (*Scene, error) {
+	r := &sceneReader{
+		objects:   map[int64]*Node{},
+		children:  map[int64][]connection{},
+		models:    map[int64]*Model{},
+		meshes:    map[int64]*Mesh{},
+		materials: map[int64]*Material{},
+		textures:  map[int64]*Texture{},
+	}
+	if objects := file.Root.Child("Objects"); objects != nil {
+		for _, object := range objects.Children {
+			if len(object.Properties) > 0 && object.Properties[0].Type == 'L' {
+				r.objects[object.Properties[0].Int] = object
+			}
+		}
+	}
+	if connections := file.Root.Child("Connections"); connections != nil {
+		for _, c := range connections.ChildrenNamed("C") {
+			if len(c.Properties) < 3 || c.Properties[1].Type != 'L' || c.Properties[2].Type != 'L' {
+				return nil, invalid("malformed connection")
+			}
+			link := connection{child: c.Properties[1].Int}
+			if len(c.Properties) > 3 {
+				link.property = c.Properties[3].String()
+			}
+			parent := c.Properties[2].Int
+			r.children[parent] = append(r.children[parent], link)
+		}
+	}
+
+	scene := &Scene{Axes: identity, UnitScale: 0.01}
+	if settings := file.Root.Child("GlobalSettings"); settings != nil {
+		if err := readGlobalSettings(properties70(settings), scene); err != nil {
+			return nil, err
+		}
+	}
+	// 0 is the scene's root
+	roots, err := r.childModels(0, map[int64]bool{})
+	if err != nil {
+		return nil, err
+	}
+	scene.Roots = roots
+	return scene, nil
+}
+
+// readGlobalSettings reads the axis system and the unit. FBX units default
+// to centimeters.
+func readGlobalSettings(properties map[string][]Property, scene *Scene) error {
+	axis := func(name string, fallback int) int {
+		if value, ok := number(properties, name); ok {
+			return int(value)
+		}
+		return fallback
+	}
+	sign := func(name string) float64 {
+		if value, ok := number(properties, name); ok && value < 0 {
+			return -1
+		}
+		return 1
+	}
+	right, up, front := axis("CoordAxis", 0), axis("UpAxis", 1), axis("FrontAxis", 2)
+	for _, a := range []int{right, up, front} {
+		if a < 0 || a > 2 {
+			return unsupported("axis %d in the global settings", a)
+		}
+	}
+	if right == up || up == front || right == front {
+		return unsupported("the global settings use axis %d twice", up)
+	}
+	scene.Axes = [16]float64{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	// Column a of the matrix is where the file's axis a ends up
+	scene.Axes[right*4+0] = sign("CoordAxisSign")
+	scene.Axes[up*4+1] = sign("UpAxisSign")
+	scene.Axes[front*4+2] = sign("FrontAxisSign")
+	if factor, ok := number(properties, "UnitScaleFactor"); ok && factor > 0 && !math.IsInf(factor, 0) {
+		scene.UnitScale = factor / 100
+	}
+	return nil
+}
+
+// childModels reads the models connected to parent. visited stops
+// connections that form a cycle.
+func (r *sceneReader) childModels(parent int64, visited map[int64]bool) ([]*Model, error) {
+	var models []*Model
+	for _, link := range r.children[parent] {
+		node, ok := r.objects[link.child]
+		if !ok || node.Name != "Model" || link.property != "" {
+			continue
+		}
+		if visited[link.child] {
+			return nil, invalid("model %d is connected in a cycle", link.child)
+		}
+		visited[link.child] = true
+		model, err := r.model(link.child, node)
+		if err != nil {
+			return nil, err
+		}
+		if model.Children, err = r.childModels(link.child, visited); err != nil {
+			return nil, err
+		}
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+func (r *sceneReader) model(id int64, node *Node) (*Model, error) {
+	model := &Model{ID: id, Name: objectName(node), Type: objectClass(node)}
+	model.Transform, model.Geometric = modelTransforms(properties70(node))
+	// Materials are indexed in the order they are connected
+	for _, link := range r.children[id] {
+		child, ok := r.objects[link.child]
+		if !ok {
+			continue
+		}
+		switch child.Name {
+		case "Geometry":
+			if objectClass(child) != "Mesh" || model.Mesh != nil {
+				continue
+			}
+			mesh, err := r.mesh(link.child, child)
+			if err != nil {
+				return nil, err
+			}
+			model.Mesh = mesh
+		case "Material":
+			model.Materials = append(model.Materials, r.material(link.child, child))
+		}
+	}
+	return model, nil
+}
+
+func (r *sceneReader) material(id int64, node *Node) *Material {
+	if material, ok := r.materials[id]; ok {
+		return material
+	}
+	properties := properties70(node)
+	material := &Material{ID: id, Name: objectName(node), Diffuse: [3]float64{0.8, 0.8, 0.8}, Opacity: 1, Shininess: 20}
+	if color, ok := vector(properties, "DiffuseColor"); ok {
+		material.Diffuse = color
+	} else if color, ok := vector(properties, "Diffuse"); ok {
+		material.Diffuse = color
+	}
+	if factor, ok := number(properties, "DiffuseFactor"); ok {
+		for i := range material.Diffuse {
+			material.Diffuse[i] *= factor
+		}
+	}
+	if color, ok := vector(properties, "EmissiveColor"); ok {
+		factor, ok := number(properties, "EmissiveFactor")
+		if !ok {
+			factor = 1
+		}
+		for i := range color {
+			material.Emissive[i] = color[i] * factor
+		}
+	}
+	if opacity, ok := number(properties, "Opacity"); ok {
+		material.Opacity = opacity
+	} else if transparency, ok := number(properties, "TransparencyFactor"); ok {
+		material.Opacity = 1 - transparency
+	}
+	if shininess, ok := number(properties, "ShininessExponent"); ok {
+		material.Shininess = shininess
+	} else if shininess, ok := number(properties, "Shininess"); ok {
+		material.Shininess = shininess
+	}
+	for _, link := range r.children[id] {
+		child, ok := r.objects[link.child]
+		if !ok || child.Name != "Texture" {
+			continue
+		}
+		switch link.property {
+		case "DiffuseColor":
+			material.DiffuseTexture = r.texture(link.child, child)
+		case "NormalMap":
+			material.NormalTexture = r.texture(link.child, child)
+		}
+	}
+	r.materials[id] = material
+	return material
+}
+
+func (r *sceneReader) texture(id int64, node *Node) *Texture {
+	if texture, ok := r.textures[id]; ok {
+		return texture
+	}
+	texture := &Texture{ID: id, Name: objectName(node)}
+	for _, name := range []string{"RelativeFilename", "FileName"} {
+		if child := node.Child(name); child != nil && len(child.Properties) > 0 && texture.FileName == "" {
+			texture.FileName = child.Properties[0].String()
+		}
+	}
+	for _, link := range r.children[id] {
+		video, ok := r.objects[link.child]
+		if !ok || video.Name != "Video" {
+			continue
+		}
+		if content := video.Child("Content"); content != nil && len(content.Properties) > 0 && len(content.Properties[0].Bytes) > 0 {
+			texture.Content = content.Properties[0].Bytes
+			break
+		}
+	}
+	r.textures[id] = texture
+	return texture
+}
+
+func (r *sceneReader) mesh(id int64, node *Node) (*Mesh, error) {
+	if mesh, ok := r.meshes[id]; ok {
+		return mesh, nil
+	}
+	mesh := &Mesh{ID: id, Name: objectName(node)}
+	if vertices := node.Child("Vertices"); vertices != nil && len(vertices.Properties) > 0 {
+		mesh.ControlPoints = vertices.Properties[0].Floats
+	}
+	if len(mesh.ControlPoints)%3 != 0 {
+		return nil, invalid("geometry %d has %d vertex coordinates", id, len(mesh.ControlPoints))
+	}
+	controlPoints := len(mesh.ControlPoints) / 3
+
+	var indices []int64
+	if polygons := node.Child("PolygonVertexIndex"); polygons != nil && len(polygons.Properties) > 0 {
+		indices = polygons.Properties[0].Ints
+	}
+	mesh.Corners = make([]int32, len(indices))
+	mesh.PolygonStarts = []int{0}
+	for i, index := range indices {
+		// The last corner of every polygon is stored as -index-1
+		last := index < 0
+		if last {
+			index = -index - 1
+		}
+		if index >= int64(controlPoints) {
+			return nil, invalid("geometry %d references vertex %d of %d", id, index, controlPoints)
+		}
+		mesh.Corners[i] = int32(index)
+		if last || i == len(indices)-1 {
+			mesh.PolygonStarts = append(mesh.PolygonStarts, i+1)
+		}
+	}
+
+	layout := cornerLayout{corners: mesh.Corners, starts: mesh.PolygonStarts, controlPoints: controlPoints}
+	var err error
+	if element := node.Child("LayerElementNormal"); element != nil {
+		if mesh.Normals, err = layout.values(element, "Normals", "NormalsIndex", 3); err != nil {
+			return nil, invalid("geometry %d normals: %v", id, err)
+		}
+	}
+	if element := node.Child("LayerElementUV"); element != nil {
+		if mesh.UVs, err = layout.values(element, "UV", "UVIndex", 2); err != nil {
+			return nil, invalid("geometry %d UVs: %v", id, err)
+		}
+	}
+	if element := node.Child("LayerElementMaterial"); element != nil {
+		if mesh.PolygonMaterials, err = layout.materials(element); err != nil {
+			return nil, invalid("geometry %d materials: %v", id, err)
+		}
+	}
+	r.meshes[id] = mesh
+	return mesh, nil
+}
+
+// cornerLayout resolves layer elements to one value per polygon corner
+type cornerLayout struct {
+	corners       []int32
+	starts        []int
+	controlPoints int
+}
+
+// values resolves the direct or indexed values of a layer element
+func (l cornerLayout) values(element *Node, dataName string, indexName string, components int) ([]float64, error) {
+	data := arrayOf(element, dataName).Floats
+	if len(data)%components != 0 {
+		return nil, invalid("%d values are not a multiple of %d", len(data), components)
+	}
+	var index []int64
+	switch reference := stringOf(element, "ReferenceInformationType"); reference {
+	case "Direct", "":
+	case "IndexToDirect", "Index":
+		index = arrayOf(element, indexName).Ints
+	default:
+		return nil, unsupported("reference type %q", reference)
+	}
+	slot, err := l.slots(stringOf(element, "MappingInformationType"))
+	if err != nil {
+		return nil, err
+	}
+
+	count := len(data) / components
+	out := make([]float64, len(l.corners)*components)
+	for corner := range l.corners {
+		i := slot(corner)
+		if index != nil {
+			if i >= len(index) {
+				return nil, invalid("index %d of %d is missing", i, len(index))
+			}
+			// -1 marks a corner without a value
+			if index[i] < 0 {
+				continue
+			}
+			i = int(index[i])
+		}
+		if i >= count {
+			return nil, invalid("value %d of %d is missing", i, count)
+		}
+		copy(out[corner*components:(corner+1)*components], data[i*components:(i+1)*components])
+	}
+	return out, nil
+}
+
+// materials resolves the material index of every polygon
+func (l cornerLayout) materials(element *Node) ([]int32, error) {
+	data := arrayOf(element, "Materials").Ints
+	polygons := len(l.starts) - 1
+	out := make([]int32, polygons)
+	switch mapping := stringOf(element, "MappingInformationType"); mapping {
+	case "AllSame":
+		if len(data) > 0 {
+			for i := range out {
+				out[i] = int32(data[0])
+			}
+		}
+	case "ByPolygon":
+		if len(data) < polygons {
+			return nil, invalid("%d materials for %d polygons", len(data), polygons)
+		}
+		for i := range out {
+			out[i] = int32(data[i])
+		}
+	default:
+		return nil, unsupported("material mapping %q", mapping)
+	}
+	return out, nil
+}
+
+// slots returns what a corner is looked up by under a mapping type
+func (l cornerLayout) slots(mapping string) (func(corner int) int, error) {
+	switch mapping {
+	case "ByPolygonVertex":
+		return func(corner int) int { return corner }, nil
+	case "ByVertex", "ByVertice", "ByControlPoint":
+		return func(corner int) int { return int(l.corners[corner]) }, nil
+	case "ByPolygon":
+		polygonOf := make([]int, len(l.corners))
+		for polygon := 0; polygon+1 < len(l.starts); polygon++ {
+			for corner := l.starts[polygon]; corner < l.starts[polygon+1]; corner++ {
+				polygonOf[corner] = polygon
+			}
+		}
+		return func(corner int) int { return polygonOf[corner] }, nil
+	case "AllSame":
+		return func(corner int) int { return 0 }, nil
+	}
+	return nil, unsupported("mapping %q", mapping)
+}
+
+func arrayOf(node *Node, name string) Property {
+	if child := node.Child(name); child != nil && len(child.Properties) > 0 {
+		return child.Properties[0]
+	}
+	return Property{}
+}
+
+func stringOf(node *Node, name string) string {
+	return arrayOf(node, name).String()
+}
+
+// objectName returns the name of an object, which is stored as
+// "name\x00\x01Class"
+func objectName(node *Node) string {
+	if len(node.Properties) < 2 {
+		return ""
+	}
+	name, _, _ := strings.Cut(node.Properties[1].String(), "\x00\x01")
+	return name
+}
+
+func objectClass(node *Node) string {
+	if len(node.Properties) < 3 {
+		return ""
+	}
+	return node.Properties[2].String()
+}
+
+// properties70 returns the values of the P records of an object, by name
+func properties70(node *Node) map[string][]Property {
+	properties := map[string][]Property{}
+	block := node.Child("Properties70")
+	if block == nil {
+		return properties
+	}
+	for _, p := range block.ChildrenNamed("P") {
+		// Name, type, label and flags come before the values
+		if len(p.Properties) >= 4 {
+			properties[p.Properties[0].String()] = p.Properties[4:]
+		}
+	}
+	return properties
+}
+
+func number(properties map[string][]Property, name string) (float64, bool) {
+	values := properties[name]
+	if len(values) == 0 {
+		return 0, false
+	}
+	return values[0].Number()
+}
+
+func vector(properties map[string][]Property, name string) ([3]float64, bool) {
+	values := properties[name]
+	if len(values) < 3 {
+		return [3]float64{}, false
+	}
+	var out [3]float64
+	for i := range out {
+		value, ok := values[i].Number()
+		if !ok {
+			return [3]float64{}, false
+		}
+		out[i] = value
+	}
+	return out, true
+}
@@ -0,0 +1,120 @@
+package fbx
+
+import "math"
+
+// Matrices are column-major, like glTF's
+var identity = [16]float64{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+
+// eulerOrders are the axes of each RotationOrder, in the order they apply
+var eulerOrders = [][3]int{{0, 1, 2}, {0, 2, 1}, {1, 2, 0}, {1, 0, 2}, {2, 0, 1}, {2, 1, 0}}
+
+func multiply(a [16]float64, b [16]float64) [16]float64 {
+	var out [16]float64
+	for column := 0; column < 4; column++ {
+		for row := 0; row < 4; row++ {
+			var sum float64
+			for k := 0; k < 4; k++ {
+				sum += a[k*4+row] * b[column*4+k]
+			}
+			out[column*4+row] = sum
+		}
+	}
+	return out
+}
+
+func translation(v [3]float64) [16]float64 {
+	m := identity
+	m[12], m[13], m[14] = v[0], v[1], v[2]
+	return m
+}
+
+func scaling(v [3]float64) [16]float64 {
+	m := identity
+	m[0], m[5], m[10] = v[0], v[1], v[2]
+	return m
+}
+
+func negate(v [3]float64) [3]float64 {
+	return [3]float64{-v[0], -v[1], -v[2]}
+}
+
+// rotation turns Euler angles in degrees into a matrix, applying the axes
+// in the given order
+func rotation(degrees [3]float64, order [3]int) [16]float64 {
+	m := identity
+	for _, axis := range order {
+		radians := degrees[axis] * math.Pi / 180
+		c, s := math.Cos(radians), math.Sin(radians)
+		r := identity
+		switch axis {
+		case 0:
+			r[5], r[6], r[9], r[10] = c, s, -s, c
+		case 1:
+			r[0], r[2], r[8], r[10] = c, -s, s, c
+		case 2:
+			r[0], r[1], r[4], r[5] = c, s, -s, c
+		}
+		m = multiply(r, m)
+	}
+	return m
+}
+
+// transpose inverts a rotation
+func transpose(m [16]float64) [16]float64 {
+	var out [16]float64
+	for column := 0; column < 4; column++ {
+		for row := 0; row < 4; row++ {
+			out[column*4+row] = m[row*4+column]
+		}
+	}
+	return out
+}
+
+// modelTransforms returns the local and the geometric transform of a model,
+// composed the way the FBX SDK does:
+// T * Roff * Rp * Rpre * R * Rpost^-1 * Rp^-1 * Soff * Sp * S * Sp^-1
+func modelTransforms(properties map[string][]Property) ([16]float64, [16]float64) {
+	vectorOr := func(name string, fallback [3]float64) [3]float64 {
+		if v, ok := vector(properties, name); ok {
+			return v
+		}
+		return fallback
+	}
+	zero, one := [3]float64{}, [3]float64{1, 1, 1}
+
+	order := eulerOrders[0]
+	pre, post := identity, identity
+	// Pre- and post-rotations and the order only apply while rotation is active
+	if active, ok := number(properties, "RotationActive"); ok && active != 0 {
+		if value, ok := number(properties, "RotationOrder"); ok && value >= 0 && int(value) < len(eulerOrders) {
+			order = eulerOrders[int(value)]
+		}
+		pre = rotation(vectorOr("PreRotation", zero), eulerOrders[0])
+		post = transpose(rotation(vectorOr("PostRotation", zero), eulerOrders[0]))
+	}
+	rotationPivot := vectorOr("RotationPivot", zero)
+	scalingPivot := vectorOr("ScalingPivot", zero)
+
+	local := identity
+	for _, m := range [][16]float64{
+		translation(vectorOr("Lcl Translation", zero)),
+		translation(vectorOr("RotationOffset", zero)),
+		translation(rotationPivot),
+		pre,
+		rotation(vectorOr("Lcl Rotation", zero), order),
+		post,
+		translation(negate(rotationPivot)),
+		translation(vectorOr("ScalingOffset", zero)),
+		translation(scalingPivot),
+		scaling(vectorOr("Lcl Scaling", one)),
+		translation(negate(scalingPivot)),
+	} {
+		local = multiply(local, m)
+	}
+
+	geometric := multiply(multiply(
+		translation(vectorOr("GeometricTranslation", zero)),
+		rotation(vectorOr("GeometricRotation", zero), eulerOrders[0])),
+		scaling(vectorOr("GeometricScaling", one)))
+	return local, geometric
+}
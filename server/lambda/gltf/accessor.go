@@ -0,0 +1,244 @@
+package gltf
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+var typeComponents = map[string]int{
+	"SCALAR": 1,
+	"VEC2":   2,
+	"VEC3":   3,
+	"VEC4":   4,
+	"MAT2":   4,
+	"MAT3":   9,
+	"MAT4":   16,
+}
+
+var componentSizes = map[int]int{
+	ComponentByte:          1,
+	ComponentUnsignedByte:  1,
+	ComponentShort:         2,
+	ComponentUnsignedShort: 2,
+	ComponentUnsignedInt:   4,
+	ComponentFloat:         4,
+}
+
+// Floats returns the elements of an accessor flattened into float32 values,
+// with the number of components of each element. Normalized integers are
+// mapped to [0, 1] or [-1, 1] and sparse substitutions are applied.
+func (m *Model) Floats(index int) ([]float32, int, error) {
+	accessor, components, err := m.accessor(index)
+	if err != nil {
+		return nil, 0, err
+	}
+	values := make([]float32, accessor.Count*components)
+	if accessor.BufferView != nil {
+		err := m.eachComponent(*accessor.BufferView, accessor.ByteOffset, accessor.ComponentType, accessor.Count, components, func(i int, raw []byte) {
+			values[i] = decodeFloat(accessor.ComponentType, accessor.Normalized, raw)
+		})
+		if err != nil {
+			return nil, 0, invalid("accessor %d: %v", index, err)
+		}
+	}
+	if sparse := accessor.Sparse; sparse != nil {
+		positions, err := m.sparseIndices(*sparse)
+		if err != nil {
+			return nil, 0, invalid("accessor %d: %v", index, err)
+		}
+		substitutes := make([]float32, sparse.Count*components)
+		err = m.eachComponent(sparse.Values.BufferView, sparse.Values.ByteOffset, accessor.ComponentType, sparse.Count, components, func(i int, raw []byte) {
+			substitutes[i] = decodeFloat(accessor.ComponentType, accessor.Normalized, raw)
+		})
+		if err != nil {
+			return nil, 0, invalid("accessor %d: %v", index, err)
+		}
+		for i, position := range positions {
+			if int(position) >= accessor.Count {
+				return nil, 0, invalid("accessor %d: sparse index %d is out of range", index, position)
+			}
+			copy(values[int(position)*components:], substitutes[i*components:(i+1)*components])
+		}
+	}
+	return values, components, nil
+}
+
+// Indices returns the elements of a scalar integer accessor, such as the
+// indices of a primitive
+func (m *Model) Indices(index int) ([]uint32, error) {
+	accessor, components, err := m.accessor(index)
+	if err != nil {
+		return nil, err
+	}
+	if components != 1 || accessor.ComponentType == ComponentFloat {
+		return nil, invalid("accessor %d is not a scalar integer accessor", index)
+	}
+	values := make([]uint32, accessor.Count)
+	if accessor.BufferView != nil {
+		err := m.eachComponent(*accessor.BufferView, accessor.ByteOffset, accessor.ComponentType, accessor.Count, 1, func(i int, raw []byte) {
+			values[i] = decodeUint(accessor.ComponentType, raw)
+		})
+		if err != nil {
+			return nil, invalid("accessor %d: %v", index, err)
+		}
+	}
+	if sparse := accessor.Sparse; sparse != nil {
+		positions, err := m.sparseIndices(*sparse)
+		if err != nil {
+			return nil, invalid("accessor %d: %v", index, err)
+		}
+		err = m.eachComponent(sparse.Values.BufferView, sparse.Values.ByteOffset, accessor.ComponentType, sparse.Count, 1, func(i int, raw []byte) {
+			if int(positions[i]) < len(values) {
+				values[positions[i]] = decodeUint(accessor.ComponentType, raw)
+			}
+		})
+		if err != nil {
+			return nil, invalid("accessor %d: %v", index, err)
+		}
+	}
+	return values, nil
+}
+
+func (m *Model) accessor(index int) (Accessor, int, error) {
+	if index < 0 || index >= len(m.Document.Accessors) {
+		return Accessor{}, 0, invalid("missing accessor %d", index)
+	}
+	accessor := m.Document.Accessors[index]
+	components, ok := typeComponents[accessor.Type]
+	if !ok {
+		return Accessor{}, 0, invalid("accessor %d has unknown type %q", index, accessor.Type)
+	}
+	if _, ok := componentSizes[accessor.ComponentType]; !ok {
+		return Accessor{}, 0, invalid("accessor %d has unknown component type %d", index, accessor.ComponentType)
+	}
+	if accessor.Count < 0 {
+		return Accessor{}, 0, invalid("accessor %d has a negative count", index)
+	}
+	return accessor, components, nil
+}
+
+func (m *Model) sparseIndices(sparse Sparse) ([]uint32, error) {
+	positions := make([]uint32, sparse.Count)
+	err := m.eachComponent(sparse.Indices.BufferView, sparse.Indices.ByteOffset, sparse.Indices.ComponentType, sparse.Count, 1, func(i int, raw []byte) {
+		positions[i] = decodeUint(sparse.Indices.ComponentType, raw)
+	})
+	return positions, err
+}
+
+// eachComponent calls fn with the bytes of every component of count elements
+// stored in a buffer view, honouring its byte stride
+func (m *Model) eachComponent(viewIndex int, byteOffset int, componentType int, count int, components int, fn func(i int, raw []byte)) error {
+	if viewIndex < 0 || viewIndex >= len(m.Document.BufferViews) {
+		return invalid("missing buffer view %d", viewIndex)
+	}
+	size, ok := componentSizes[componentType]
+	if !ok {
+		return invalid("unknown component type %d", componentType)
+	}
+	view := m.Document.BufferViews[viewIndex]
+	data := m.Buffers[view.Buffer][view.ByteOffset : view.ByteOffset+view.ByteLength]
+	elementSize := size * components
+	stride := view.ByteStride
+	if stride == 0 {
+		stride = elementSize
+	}
+	if count > 0 && (byteOffset < 0 || byteOffset+(count-1)*stride+elementSize > len(data)) {
+		return invalid("elements run past the end of buffer view %d", viewIndex)
+	}
+	for element := 0; element < count; element++ {
+		start := byteOffset + element*stride
+		for component := 0; component < components; component++ {
+			offset := start + component*size
+			fn(element*components+component, data[offset:offset+size])
+		}
+	}
+	return nil
+}
+
+func decodeUint(componentType int, raw []byte) uint32 {
+	switch componentType {
+	case ComponentByte, ComponentUnsignedByte:
+		return uint32(raw[0])
+	case ComponentShort, ComponentUnsignedShort:
+		return uint32(binary.LittleEndian.Uint16(raw))
+	}
+	return binary.LittleEndian.Uint32(raw)
+}
+
+func decodeFloat(componentType int, normalized bool, raw []byte) float32 {
+	switch componentType {
+	case ComponentFloat:
+		return math.Float32frombits(binary.LittleEndian.Uint32(raw))
+	case ComponentByte:
+		if normalized {
+			return float32(math.Max(float64(int8(raw[0]))/127, -1))
+		}
+		return float32(int8(raw[0]))
+	case ComponentUnsignedByte:
+		if normalized {
+			return float32(raw[0]) / 255
+		}
+		return float32(raw[0])
+	case ComponentShort:
+		value := int16(binary.LittleEndian.Uint16(raw))
+		if normalized {
+			return float32(math.Max(float64(value)/32767, -1))
+		}
+		return float32(value)
+	case ComponentUnsignedShort:
+		value := binary.LittleEndian.Uint16(raw)
+		if normalized {
+			return float32(value) / 65535
+		}
+		return float32(value)
+	}
+	return float32(binary.LittleEndian.Uint32(raw))
+}
+
+// Triangles returns the vertex indices of a primitive as a triangle list,
+// unrolling strips and fans. Primitives without indices use their vertices
+// in order. Points and lines have no triangles.
+func (m *Model) Triangles(primitive Primitive) ([]uint32, error) {
+	var indices []uint32
+	if primitive.Indices != nil {
+		var err error
+		if indices, err = m.Indices(*primitive.Indices); err != nil {
+			return nil, err
+		}
+	} else {
+		position, ok := primitive.Attributes["POSITION"]
+		if !ok {
+			return nil, invalid("primitive has no POSITION attribute")
+		}
+		accessor, _, err := m.accessor(position)
+		if err != nil {
+			return nil, err
+		}
+		indices = make([]uint32, accessor.Count)
+		for i := range indices {
+			indices[i] = uint32(i)
+		}
+	}
+
+	switch primitive.PrimitiveMode() {
+	case ModeTriangles:
+		return indices[:len(indices)/3*3], nil
+	case ModeTriangleStrip:
+		var triangles []uint32
+		for i := 2; i < len(indices); i++ {
+			if i%2 == 0 {
+				triangles = append(triangles, indices[i-2], indices[i-1], indices[i])
+			} else {
+				triangles = append(triangles, indices[i-1], indices[i-2], indices[i])
+			}
+		}
+		return triangles, nil
+	case ModeTriangleFan:
+		var triangles []uint32
+		for i := 2; i < len(indices); i++ {
+			triangles = append(triangles, indices[i-1], indices[i], indices[0])
+		}
+		return triangles, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,96 @@
+package gltf
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	glbMagic      = "glTF"
+	glbVersion    = 2
+	glbHeaderSize = 12
+	chunkJSON     = 0x4E4F534A
+	chunkBIN      = 0x004E4942
+)
+
+// IsGLB reports whether data starts with the binary glTF header
+func IsGLB(data []byte) bool {
+	return len(data) >= 4 && string(data[:4]) == glbMagic
+}
+
+// splitGLB returns the JSON chunk of a GLB and its BIN chunk, which is nil
+// when there is none. Chunks of other types are skipped as the spec requires.
+func splitGLB(data []byte) ([]byte, []byte, error) {
+	if len(data) < glbHeaderSize || !IsGLB(data) {
+		return nil, nil, invalid("not a GLB file")
+	}
+	if version := binary.LittleEndian.Uint32(data[4:8]); version != glbVersion {
+		return nil, nil, invalid("GLB version %d, only version 2 is supported", version)
+	}
+	length := binary.LittleEndian.Uint32(data[8:12])
+	if int64(length) > int64(len(data)) {
+		return nil, nil, invalid("GLB declares %d bytes but has %d", length, len(data))
+	}
+
+	var jsonChunk, binChunk []byte
+	offset := glbHeaderSize
+	for index := 0; offset < int(length); index++ {
+		if int(length)-offset < 8 {
+			return nil, nil, invalid("truncated GLB chunk header at byte %d", offset)
+		}
+		chunkLength := int(binary.LittleEndian.Uint32(data[offset : offset+4]))
+		chunkType := binary.LittleEndian.Uint32(data[offset+4 : offset+8])
+		start := offset + 8
+		if chunkLength < 0 || chunkLength > int(length)-start {
+			return nil, nil, invalid("GLB chunk %d runs past the end of the file", index)
+		}
+		chunk := data[start : start+chunkLength]
+		switch {
+		case index == 0 && chunkType != chunkJSON:
+			return nil, nil, invalid("the first GLB chunk must be JSON")
+		case index == 0:
+			jsonChunk = chunk
+		case index == 1 && chunkType == chunkBIN:
+			binChunk = chunk
+		}
+		offset = start + align4(chunkLength)
+	}
+	if jsonChunk == nil {
+		return nil, nil, invalid("GLB has no JSON chunk")
+	}
+	return jsonChunk, binChunk, nil
+}
+
+// joinGLB writes a GLB from its JSON and BIN chunks. The JSON is padded with
+// spaces and the binary chunk with zeros, and bin is left out when empty.
+func joinGLB(jsonChunk []byte, binChunk []byte) []byte {
+	jsonLength := align4(len(jsonChunk))
+	binLength := align4(len(binChunk))
+	total := glbHeaderSize + 8 + jsonLength
+	if len(binChunk) > 0 {
+		total += 8 + binLength
+	}
+
+	var out bytes.Buffer
+	out.Grow(total)
+	out.WriteString(glbMagic)
+	binary.Write(&out, binary.LittleEndian, uint32(glbVersion))
+	binary.Write(&out, binary.LittleEndian, uint32(total))
+
+	binary.Write(&out, binary.LittleEndian, uint32(jsonLength))
+	binary.Write(&out, binary.LittleEndian, uint32(chunkJSON))
+	out.Write(jsonChunk)
+	out.Write(bytes.Repeat([]byte{' '}, jsonLength-len(jsonChunk)))
+
+	if len(binChunk) > 0 {
+		binary.Write(&out, binary.LittleEndian, uint32(binLength))
+		binary.Write(&out, binary.LittleEndian, uint32(chunkBIN))
+		out.Write(binChunk)
+		out.Write(make([]byte, binLength-len(binChunk)))
+	}
+	return out.Bytes()
+}
+
+func align4(n int) int {
+	return (n + 3) &^ 3
+}
@@ -0,0 +1,250 @@
+// Package gltf reads and writes glTF 2.0 assets, as .gltf JSON with its
+// buffers and images or as a single binary .glb, and moves buffers and images
+// between those layouts without touching the scene they describe.
+package gltf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalid wraps every reason an asset is malformed
+	ErrInvalid = errors.New("invalid glTF")
+	// ErrUnsupported is returned for valid assets this package cannot repackage
+	ErrUnsupported = errors.New("unsupported glTF")
+)
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, args...))
+}
+
+// Extensions holds extension objects as they were read, so they are written
+// back unchanged
+type Extensions map[string]json.RawMessage
+
+// Document is the JSON part of an asset. Skins, animations and cameras only
+// reference accessors and nodes, which are never renumbered, so they are kept
+// as they were read.
+type Document struct {
+	Asset              Asset             `json:"asset"`
+	ExtensionsUsed     []string          `json:"extensionsUsed,omitempty"`
+	ExtensionsRequired []string          `json:"extensionsRequired,omitempty"`
+	Scene              *int              `json:"scene,omitempty"`
+	Scenes             []Scene           `json:"scenes,omitempty"`
+	Nodes              []Node            `json:"nodes,omitempty"`
+	Meshes             []Mesh            `json:"meshes,omitempty"`
+	Accessors          []Accessor        `json:"accessors,omitempty"`
+	BufferViews        []BufferView      `json:"bufferViews,omitempty"`
+	Buffers            []Buffer          `json:"buffers,omitempty"`
+	Materials          []Material        `json:"materials,omitempty"`
+	Textures           []Texture         `json:"textures,omitempty"`
+	Images             []Image           `json:"images,omitempty"`
+	Samplers           []Sampler         `json:"samplers,omitempty"`
+	Skins              []json.RawMessage `json:"skins,omitempty"`
+	Animations         []json.RawMessage `json:"animations,omitempty"`
+	Cameras            []json.RawMessage `json:"cameras,omitempty"`
+	Extensions         Extensions        `json:"extensions,omitempty"`
+	Extras             json.RawMessage   `json:"extras,omitempty"`
+}
+
+type Asset struct {
+	Version    string          `json:"version"`
+	MinVersion string          `json:"minVersion,omitempty"`
+	Generator  string          `json:"generator,omitempty"`
+	Copyright  string          `json:"copyright,omitempty"`
+	Extensions Extensions      `json:"extensions,omitempty"`
+	Extras     json.RawMessage `json:"extras,omitempty"`
+}
+
+type Scene struct {
+	Name       string          `json:"name,omitempty"`
+	Nodes      []int           `json:"nodes,omitempty"`
+	Extensions Extensions      `json:"extensions,omitempty"`
+	Extras     json.RawMessage `json:"extras,omitempty"`
+}
+
+type Node struct {
+	Name        string          `json:"name,omitempty"`
+	Children    []int           `json:"children,omitempty"`
+	Mesh        *int            `json:"mesh,omitempty"`
+	Camera      *int            `json:"camera,omitempty"`
+	Skin        *int            `json:"skin,omitempty"`
+	Matrix      []float64       `json:"matrix,omitempty"`
+	Translation []float64       `json:"translation,omitempty"`
+	Rotation    []float64       `json:"rotation,omitempty"`
+	Scale       []float64       `json:"scale,omitempty"`
+	Weights     []float64       `json:"weights,omitempty"`
+	Extensions  Extensions      `json:"extensions,omitempty"`
+	Extras      json.RawMessage `json:"extras,omitempty"`
+}
+
+type Mesh struct {
+	Name       string          `json:"name,omitempty"`
+	Primitives []Primitive     `json:"primitives"`
+	Weights    []float64       `json:"weights,omitempty"`
+	Extensions Extensions      `json:"extensions,omitempty"`
+	Extras     json.RawMessage `json:"extras,omitempty"`
+}
+
+// Primitive modes
+const (
+	ModePoints        = 0
+	ModeLines         = 1
+	ModeTriangles     = 4
+	ModeTriangleStrip = 5
+	ModeTriangleFan   = 6
+)
+
+type Primitive struct {
+	Attributes map[string]int   `json:"attributes"`
+	Indices    *int             `json:"indices,omitempty"`
+	Material   *int             `json:"material,omitempty"`
+	Mode       *int             `json:"mode,omitempty"`
+	Targets    []map[string]int `json:"targets,omitempty"`
+	Extensions Extensions       `json:"extensions,omitempty"`
+	Extras     json.RawMessage  `json:"extras,omitempty"`
+}
+
+// PrimitiveMode returns the mode of a primitive, triangles unless set
+func (p Primitive) PrimitiveMode() int {
+	if p.Mode == nil {
+		return ModeTriangles
+	}
+	return *p.Mode
+}
+
+// Accessor component types
+const (
+	ComponentByte          = 5120
+	ComponentUnsignedByte  = 5121
+	ComponentShort         = 5122
+	ComponentUnsignedShort = 5123
+	ComponentUnsignedInt   = 5125
+	ComponentFloat         = 5126
+)
+
+type Accessor struct {
+	Name          string          `json:"name,omitempty"`
+	BufferView    *int            `json:"bufferView,omitempty"`
+	ByteOffset    int             `json:"byteOffset,omitempty"`
+	ComponentType int             `json:"componentType"`
+	Normalized    bool            `json:"normalized,omitempty"`
+	Count         int             `json:"count"`
+	Type          string          `json:"type"`
+	Max           []float64       `json:"max,omitempty"`
+	Min           []float64       `json:"min,omitempty"`
+	Sparse        *Sparse         `json:"sparse,omitempty"`
+	Extensions    Extensions      `json:"extensions,omitempty"`
+	Extras        json.RawMessage `json:"extras,omitempty"`
+}
+
+type Sparse struct {
+	Count      int             `json:"count"`
+	Indices    SparseIndices   `json:"indices"`
+	Values     SparseValues    `json:"values"`
+	Extensions Extensions      `json:"extensions,omitempty"`
+	Extras     json.RawMessage `json:"extras,omitempty"`
+}
+
+type SparseIndices struct {
+	BufferView    int             `json:"bufferView"`
+	ByteOffset    int             `json:"byteOffset,omitempty"`
+	ComponentType int             `json:"componentType"`
+	Extensions    Extensions      `json:"extensions,omitempty"`
+	Extras        json.RawMessage `json:"extras,omitempty"`
+}
+
+type SparseValues struct {
+	BufferView int             `json:"bufferView"`
+	ByteOffset int             `json:"byteOffset,omitempty"`
+	Extensions Extensions      `json:"extensions,omitempty"`
+	Extras     json.RawMessage `json:"extras,omitempty"`
+}
+
+type BufferView struct {
+	Name       string          `json:"name,omitempty"`
+	Buffer     int             `json:"buffer"`
+	ByteOffset int             `json:"byteOffset,omitempty"`
+	ByteLength int             `json:"byteLength"`
+	ByteStride int             `json:"byteStride,omitempty"`
+	Target     int             `json:"target,omitempty"`
+	Extensions Extensions      `json:"extensions,omitempty"`
+	Extras     json.RawMessage `json:"extras,omitempty"`
+}
+
+type Buffer struct {
+	Name       string          `json:"name,omitempty"`
+	URI        string          `json:"uri,omitempty"`
+	ByteLength int             `json:"byteLength"`
+	Extensions Extensions      `json:"extensions,omitempty"`
+	Extras     json.RawMessage `json:"extras,omitempty"`
+}
+
+type Material struct {
+	Name                 string                `json:"name,omitempty"`
+	PBRMetallicRoughness *PBRMetallicRoughness `json:"pbrMetallicRoughness,omitempty"`
+	NormalTexture        *TextureInfo          `json:"normalTexture,omitempty"`
+	OcclusionTexture     *TextureInfo          `json:"occlusionTexture,omitempty"`
+	EmissiveTexture      *TextureInfo          `json:"emissiveTexture,omitempty"`
+	EmissiveFactor       []float64             `json:"emissiveFactor,omitempty"`
+	AlphaMode            string                `json:"alphaMode,omitempty"`
+	AlphaCutoff          *float64              `json:"alphaCutoff,omitempty"`
+	DoubleSided          bool                  `json:"doubleSided,omitempty"`
+	Extensions           Extensions            `json:"extensions,omitempty"`
+	Extras               json.RawMessage       `json:"extras,omitempty"`
+}
+
+type PBRMetallicRoughness struct {
+	BaseColorFactor          []float64       `json:"baseColorFactor,omitempty"`
+	BaseColorTexture         *TextureInfo    `json:"baseColorTexture,omitempty"`
+	MetallicFactor           *float64        `json:"metallicFactor,omitempty"`
+	RoughnessFactor          *float64        `json:"roughnessFactor,omitempty"`
+	MetallicRoughnessTexture *TextureInfo    `json:"metallicRoughnessTexture,omitempty"`
+	Extensions               Extensions      `json:"extensions,omitempty"`
+	Extras                   json.RawMessage `json:"extras,omitempty"`
+}
+
+// TextureInfo references a texture from a material. Scale is only used by
+// normal textures and Strength by occlusion textures.
+type TextureInfo struct {
+	Index      int             `json:"index"`
+	TexCoord   int             `json:"texCoord,omitempty"`
+	Scale      *float64        `json:"scale,omitempty"`
+	Strength   *float64        `json:"strength,omitempty"`
+	Extensions Extensions      `json:"extensions,omitempty"`
+	Extras     json.RawMessage `json:"extras,omitempty"`
+}
+
+type Texture struct {
+	Name       string          `json:"name,omitempty"`
+	Sampler    *int            `json:"sampler,omitempty"`
+	Source     *int            `json:"source,omitempty"`
+	Extensions Extensions      `json:"extensions,omitempty"`
+	Extras     json.RawMessage `json:"extras,omitempty"`
+}
+
+type Image struct {
+	Name       string          `json:"name,omitempty"`
+	URI        string          `json:"uri,omitempty"`
+	MimeType   string          `json:"mimeType,omitempty"`
+	BufferView *int            `json:"bufferView,omitempty"`
+	Extensions Extensions      `json:"extensions,omitempty"`
+	Extras     json.RawMessage `json:"extras,omitempty"`
+}
+
+type Sampler struct {
+	Name       string          `json:"name,omitempty"`
+	MagFilter  int             `json:"magFilter,omitempty"`
+	MinFilter  int             `json:"minFilter,omitempty"`
+	WrapS      int             `json:"wrapS,omitempty"`
+	WrapT      int             `json:"wrapT,omitempty"`
+	Extensions Extensions      `json:"extensions,omitempty"`
+	Extras     json.RawMessage `json:"extras,omitempty"`
+}
+
+// Int returns a pointer to v, for the optional indices of a Document
+func Int(v int) *int {
+	return &v
+}
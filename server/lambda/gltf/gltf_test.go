@@ -0,0 +1,488 @@
+package gltf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testPNG = []byte("\x89PNG\r\n\x1a\nnot really an image")
+
+// newTriangle builds a single triangle whose indices leave the buffer
+// unaligned before a texture stored in it
+func newTriangle() *Model {
+	positions := make([]byte, 0, 36)
+	for _, v := range []float32{0, 0, 0, 1, 0, 0, 0, 1, 0} {
+		positions = binary.LittleEndian.AppendUint32(positions, math.Float32bits(v))
+	}
+	indices := []byte{0, 0, 1, 0, 2, 0}
+
+	buffer := append(append(append([]byte{}, positions...), indices...), testPNG...)
+	doc := &Document{
+		Asset:  Asset{Version: "2.0", Generator: "test"},
+		Scene:  Int(0),
+		Scenes: []Scene{{Nodes: []int{0}}},
+		Nodes:  []Node{{Name: "triangle", Mesh: Int(0)}},
+		Meshes: []Mesh{{Primitives: []Primitive{{
+			Attributes: map[string]int{"POSITION": 0},
+			Indices:    Int(1),
+			Material:   Int(0),
+		}}}},
+		Accessors: []Accessor{
+			{BufferView: Int(0), ComponentType: ComponentFloat, Count: 3, Type: "VEC3", Min: []float64{0, 0, 0}, Max: []float64{1, 1, 0}},
+			{BufferView: Int(1), ComponentType: ComponentUnsignedShort, Count: 3, Type: "SCALAR"},
+		},
+		BufferViews: []BufferView{
+			{Buffer: 0, ByteLength: 36, Target: 34962},
+			{Buffer: 0, ByteOffset: 36, ByteLength: 6, Target: 34963},
+			{Buffer: 0, ByteOffset: 42, ByteLength: len(testPNG)},
+		},
+		Buffers:   []Buffer{{ByteLength: len(buffer)}},
+		Materials: []Material{{Name: "paint", PBRMetallicRoughness: &PBRMetallicRoughness{BaseColorTexture: &TextureInfo{Index: 0}}}},
+		Textures:  []Texture{{Source: Int(0)}},
+		Images:    []Image{{Name: "albedo", BufferView: Int(2), MimeType: "image/png"}},
+		Extras:    json.RawMessage(`{"keep":"me"}`),
+	}
+	return &Model{
+		Document: doc,
+		Buffers:  [][]byte{buffer},
+		Images:   []ImageData{{MimeType: "image/png", Data: testPNG}},
+	}
+}
+
+func filesResolver(files map[string][]byte) Resolver {
+	return func(uri string) ([]byte, error) {
+		data, ok := files[uri]
+		if !ok {
+			return nil, fmt.Errorf("missing %s", uri)
+		}
+		return data, nil
+	}
+}
+
+// accessorBytes returns the bytes behind an accessor of a loaded model
+func accessorBytes(m *Model, index int) []byte {
+	view := m.Document.BufferViews[*m.Document.Accessors[index].BufferView]
+	return m.Buffers[view.Buffer][view.ByteOffset : view.ByteOffset+view.ByteLength]
+}
+
+func TestGLBRoundTripsThroughSplitGLTF(t *testing.T) {
+	original := newTriangle()
+	glb, err := original.WriteGLB()
+	assert.NoError(t, err)
+	assert.Zero(t, len(glb)%4)
+
+	model, err := Read(glb, nil)
+	assert.NoError(t, err)
+	files, err := model.WriteGLTF(GLTFOptions{Name: "model"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"model.gltf", "model.bin", "albedo.png"}, keys(files))
+	assert.Equal(t, testPNG, files["albedo.png"])
+
+	split, err := Read(files["model.gltf"], filesResolver(files))
+	assert.NoError(t, err)
+	assert.Len(t, split.Document.BufferViews, 2, "the image view is dropped")
+	assert.Equal(t, "albedo.png", split.Document.Images[0].URI)
+	assert.JSONEq(t, `{"keep":"me"}`, string(split.Document.Extras))
+
+	repacked, err := split.WriteGLB()
+	assert.NoError(t, err)
+	final, err := Read(repacked, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, accessorBytes(original, 0), accessorBytes(final, 0))
+	assert.Equal(t, accessorBytes(original, 1), accessorBytes(final, 1))
+	assert.Equal(t, testPNG, final.Images[0].Data)
+	assert.Equal(t, "image/png", final.Document.Images[0].MimeType)
+	for _, view := range final.Document.BufferViews {
+		assert.Zero(t, view.ByteOffset%4)
+	}
+}
+
+func TestWriteGLTF_EmbeddedIsASingleFile(t *testing.T) {
+	files, err := newTriangle().WriteGLTF(GLTFOptions{Name: "model", Images: ImageDataURIs, EmbedBuffer: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"model.gltf"}, keys(files))
+
+	model, err := Read(files["model.gltf"], nil)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(model.Document.Images[0].URI, "data:image/png;base64,"))
+	assert.Equal(t, testPNG, model.Images[0].Data)
+}
+
+func TestWriteGLTF_ImageNamesNeverCollide(t *testing.T) {
+	model := newTriangle()
+	model.Document.Images[0].Name = "model"
+	model.Document.Images = append(model.Document.Images, Image{URI: "textures/model.png"})
+	model.Images = append(model.Images, ImageData{Data: testPNG, MimeType: "image/png", Path: "textures/model.png"})
+	model.Document.Images = append(model.Document.Images, Image{URI: "data:,"})
+	model.Images = append(model.Images, ImageData{Data: []byte("?")})
+
+	files, err := model.WriteGLTF(GLTFOptions{Name: "model"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"model.gltf", "model.bin", "model.png", "model_2.png", "model_image2.bin"}, keys(files))
+}
+
+func TestRead_KeepsViewsReferencedByExtensions(t *testing.T) {
+	model := newTriangle()
+	model.Document.ExtensionsUsed = []string{"KHR_draco_mesh_compression"}
+	files, err := model.WriteGLTF(GLTFOptions{Name: "model"})
+	assert.NoError(t, err)
+
+	split, err := Read(files["model.gltf"], filesResolver(files))
+	assert.NoError(t, err)
+	assert.Len(t, split.Document.BufferViews, 3)
+}
+
+func TestRead_Rejections(t *testing.T) {
+	glb, err := newTriangle().WriteGLB()
+	assert.NoError(t, err)
+	version3 := append([]byte{}, glb...)
+	binary.LittleEndian.PutUint32(version3[4:8], 3)
+	truncated := append([]byte{}, glb...)
+	binary.LittleEndian.PutUint32(truncated[12:16], uint32(len(glb)))
+
+	tests := []struct {
+		name    string
+		data    string
+		target  error
+		message string
+	}{
+		{"glb version", string(version3), ErrInvalid, "only version 2"},
+		{"chunk past the end", string(truncated), ErrInvalid, "runs past the end"},
+		{"malformed json", `{"asset":`, ErrInvalid, "malformed JSON"},
+		{"version 1", `{"asset":{"version":"1.0"}}`, ErrUnsupported, "only 2.x"},
+		{"meshopt", `{"asset":{"version":"2.0"},"extensionsUsed":["EXT_meshopt_compression"]}`, ErrUnsupported, "EXT_meshopt_compression"},
+		{"short buffer", `{"asset":{"version":"2.0"},"buffers":[{"uri":"data:application/octet-stream;base64,AAAA","byteLength":4}]}`, ErrInvalid, "declares 4 bytes but has 3"},
+		{"view past buffer", `{"asset":{"version":"2.0"},"buffers":[{"uri":"data:application/octet-stream;base64,AAAA","byteLength":3}],"bufferViews":[{"buffer":0,"byteOffset":2,"byteLength":2}]}`, ErrInvalid, "runs past the end of buffer 0"},
+		{"missing view", `{"asset":{"version":"2.0"},"images":[{"bufferView":0,"mimeType":"image/png"}]}`, ErrInvalid, "missing buffer view 0"},
+		{"external file", `{"asset":{"version":"2.0"},"images":[{"uri":"a%20b.png"}]}`, ErrUnsupported, "external file a b.png"},
+		{"remote uri", `{"asset":{"version":"2.0"},"images":[{"uri":"https://example.com/a.png"}]}`, ErrUnsupported, "https URIs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read([]byte(tt.data), nil)
+			assert.ErrorIs(t, err, tt.target)
+			assert.ErrorContains(t, err, tt.message)
+		})
+	}
+}
+
+func keys(files map[string][]byte) []string {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestFloats_StridedNormalizedAndSparse(t *testing.T) {
+	// Two interleaved VEC2 normalized unsigned bytes with a stride of 4, and a
+	// sparse substitution of element 1
+	buffer := []byte{255, 0, 9, 9, 0, 255, 9, 9, 1, 0, 0, 0, 51, 102}
+	model := &Model{
+		Document: &Document{
+			Accessors: []Accessor{{
+				BufferView: Int(0), ComponentType: ComponentUnsignedByte, Normalized: true, Count: 2, Type: "VEC2",
+				Sparse: &Sparse{Count: 1, Indices: SparseIndices{BufferView: 1, ComponentType: ComponentUnsignedShort}, Values: SparseValues{BufferView: 1, ByteOffset: 4}},
+			}},
+			BufferViews: []BufferView{{ByteLength: 8, ByteStride: 4}, {ByteOffset: 8, ByteLength: 6}},
+		},
+		Buffers: [][]byte{buffer},
+	}
+	values, components, err := model.Floats(0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, components)
+	assert.Equal(t, []float32{1, 0, 0.2, 0.4}, values)
+
+	_, err = model.Indices(0)
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestTriangles_UnrollsStripsAndFans(t *testing.T) {
+	model := newTriangle()
+	model.Document.Accessors[1].Count = 3
+	strip := Primitive{Attributes: map[string]int{"POSITION": 0}, Mode: Int(ModeTriangleStrip)}
+	fan := Primitive{Attributes: map[string]int{"POSITION": 0}, Mode: Int(ModeTriangleFan)}
+	lines := Primitive{Attributes: map[string]int{"POSITION": 0}, Mode: Int(ModeLines)}
+	model.Document.Accessors[0].Count = 4
+	model.Document.BufferViews[0].ByteLength = 48
+	model.Buffers[0] = append(make([]byte, 48), model.Buffers[0][36:]...)
+
+	triangles, err := model.Triangles(strip)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{0, 1, 2, 2, 1, 3}, triangles)
+	triangles, err = model.Triangles(fan)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{1, 2, 0, 2, 3, 0}, triangles)
+	triangles, err = model.Triangles(lines)
+	assert.NoError(t, err)
+	assert.Empty(t, triangles)
+}
+
+func TestLocalMatrix(t *testing.T) {
+	// A quarter turn around Y, scaled by 2 and moved along X
+	node := Node{Translation: []float64{5, 0, 0}, Rotation: []float64{0, math.Sqrt2 / 2, 0, math.Sqrt2 / 2}, Scale: []float64{2, 2, 2}}
+	matrix := node.LocalMatrix()
+	// The +X axis turns into -Z
+	assert.InDeltaSlice(t, []float64{0, 0, -2, 0}, matrix[0:4], 1e-9)
+	assert.InDeltaSlice(t, []float64{5, 0, 0, 1}, matrix[12:16], 1e-9)
+
+	moved := Multiply(Node{Translation: []float64{0, 1, 0}}.LocalMatrix(), matrix)
+	assert.InDeltaSlice(t, []float64{5, 1, 0, 1}, moved[12:16], 1e-9)
+	assert.Equal(t, Identity, Node{}.LocalMatrix())
+}
+
+func TestAnalyze_CountsEveryInstance(t *testing.T) {
+	model := newTriangle()
+	var encoded bytes.Buffer
+	assert.NoError(t, png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 4, 2))))
+	model.Images[0].Data = encoded.Bytes()
+	model.Document.Scenes[0].Nodes = []int{0, 1}
+	model.Document.Nodes = append(model.Document.Nodes, Node{Mesh: Int(0), Translation: []float64{10, 0, 0}, Scale: []float64{2, 2, 2}})
+	model.Document.Animations = []json.RawMessage{json.RawMessage(`{"channels":[],"samplers":[]}`)}
+	glb, err := model.WriteGLB()
+	assert.NoError(t, err)
+
+	stats, err := Analyze(glb, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, stats.Vertices)
+	assert.Equal(t, 2, stats.Triangles)
+	assert.Equal(t, 2, stats.DrawCalls)
+	assert.Equal(t, 1, stats.Materials)
+	assert.Equal(t, 1, stats.Textures)
+	assert.Equal(t, []ImageSize{{MimeType: "image/png", Width: 4, Height: 2}}, stats.TextureSizes)
+	assert.Equal(t, int64(len(glb)), stats.ByteSize)
+	assert.Equal(t, [3]float64{0, 0, 0}, stats.Min)
+	assert.Equal(t, [3]float64{12, 2, 0}, stats.Max)
+	assert.True(t, stats.HasAnimations)
+	assert.False(t, stats.HasSkins)
+}
+
+func TestAnalyze_EmptySceneHasNoBounds(t *testing.T) {
+	stats, err := Analyze([]byte(`{"asset":{"version":"2.0"},"scenes":[{}]}`), nil)
+	assert.NoError(t, err)
+	assert.Zero(t, stats.Vertices)
+	assert.Equal(t, [3]float64{}, stats.Min)
+	assert.Equal(t, [3]float64{}, stats.Max)
+}
+
+func TestImageSize_ReadsHeaders(t *testing.T) {
+	ktx2 := append([]byte("\xabKTX 20\xbb\r\n\x1a\n"), make([]byte, 16)...)
+	binary.LittleEndian.PutUint32(ktx2[20:], 512)
+	binary.LittleEndian.PutUint32(ktx2[24:], 256)
+	lossless := append([]byte("RIFF\x00\x00\x00\x00WEBPVP8L\x00\x00\x00\x00\x2f"), make([]byte, 9)...)
+	binary.LittleEndian.PutUint32(lossless[21:], (64-1)|(32-1)<<14)
+	extended := []byte("RIFF\x00\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00\x00\x00\x00\x00\xff\x03\x00\xff\x01\x00")
+
+	for name, tc := range map[string]struct {
+		data          []byte
+		width, height int
+	}{
+		"ktx2":          {ktx2, 512, 256},
+		"lossless webp": {lossless, 64, 32},
+		"extended webp": {extended, 1024, 512},
+		"unknown":       {testPNG, 0, 0},
+	} {
+		width, height := imageSize(tc.data)
+		assert.Equal(t, tc.width, width, name)
+		assert.Equal(t, tc.height, height, name)
+	}
+}
+
+func issueCodes(report *Report) []string {
+	codes := make([]string, 0, len(report.Issues))
+	for _, issue := range report.Issues {
+		codes = append(codes, issue.Code)
+	}
+	return codes
+}
+
+func TestValidate_CleanAssetHasNoIssues(t *testing.T) {
+	glb, err := newTriangle().WriteGLB()
+	assert.NoError(t, err)
+
+	report := Validate(glb, nil)
+	assert.Zero(t, report.NumErrors, issueCodes(report))
+	assert.Zero(t, report.NumWarnings, issueCodes(report))
+	assert.Zero(t, report.NumInfos, issueCodes(report))
+}
+
+func TestValidate_ReportsBrokenReferencesAndData(t *testing.T) {
+	model := newTriangle()
+	doc := model.Document
+	// Index 2 points past the two vertices left
+	doc.Accessors[0].Count = 2
+	doc.Accessors[0].Max = []float64{5, 1, 0}
+	doc.Meshes[0].Primitives[0].Material = Int(3)
+	doc.Nodes = append(doc.Nodes, Node{Children: []int{2}}, Node{Children: []int{1}})
+	doc.Accessors = append(doc.Accessors, Accessor{BufferView: Int(0), ByteOffset: 24, ComponentType: ComponentFloat, Count: 2, Type: "VEC3"})
+	doc.Meshes[0].Primitives[0].Attributes["NORMAL"] = 2
+	glb, err := model.WriteGLB()
+	assert.NoError(t, err)
+
+	report := Validate(glb, nil)
+	codes := issueCodes(report)
+	for _, code := range []string{"ACCESSOR_INDEX_OOB", "ACCESSOR_MAX_MISMATCH", "UNRESOLVED_REFERENCE", "NODE_LOOP", "ACCESSOR_TOO_LONG"} {
+		assert.Contains(t, codes, code)
+	}
+	assert.Equal(t, "/meshes/0/primitives/0/material", report.Issues[slices.Index(codes, "UNRESOLVED_REFERENCE")].Pointer)
+	assert.Contains(t, codes, "UNUSED_OBJECT", "the material is no longer referenced")
+	assert.Equal(t, SeverityError, report.Issues[0].Severity)
+	assert.Equal(t, SeverityInfo, report.Issues[len(report.Issues)-1].Severity)
+}
+
+func TestValidate_ChecksTheGLBContainer(t *testing.T) {
+	glb, err := newTriangle().WriteGLB()
+	assert.NoError(t, err)
+
+	report := Validate(glb[:len(glb)-4], nil)
+	assert.Equal(t, []string{"GLB_LENGTH_MISMATCH"}, issueCodes(report))
+
+	report = Validate([]byte(`{"asset":{"version":"1.0"}}`), nil)
+	assert.Equal(t, []string{"UNKNOWN_ASSET_MAJOR_VERSION"}, issueCodes(report))
+}
+
+func TestValidate_CapsTheIssuesListed(t *testing.T) {
+	model := newTriangle()
+	for i := 0; i < 150; i++ {
+		model.Document.Materials = append(model.Document.Materials, Material{})
+		model.Document.Nodes = append(model.Document.Nodes, Node{Mesh: Int(99)})
+	}
+	glb, err := model.WriteGLB()
+	assert.NoError(t, err)
+
+	report := Validate(glb, nil)
+	assert.Equal(t, 150, report.NumErrors)
+	assert.Equal(t, 150, report.NumInfos)
+	assert.Len(t, report.Issues, maxIssues)
+	assert.True(t, report.Truncated)
+	assert.Equal(t, SeverityError, report.Issues[maxIssues-1].Severity)
+}
+
+// newGrid builds a flat square of size×size quads whose left and right halves
+// are two primitives with their own material, sharing vertex buffers. The
+// texture coordinates are interleaved with padding.
+func newGrid(size int) *Model {
+	var positions, texcoords, indices []byte
+	for y := 0; y <= size; y++ {
+		for x := 0; x <= size; x++ {
+			for _, v := range []float32{float32(x), 0, float32(y)} {
+				positions = binary.LittleEndian.AppendUint32(positions, math.Float32bits(v))
+			}
+			texcoords = binary.LittleEndian.AppendUint16(texcoords, uint16(x*65535/size))
+			texcoords = binary.LittleEndian.AppendUint16(texcoords, uint16(y*65535/size))
+			texcoords = append(texcoords, 0, 0, 0, 0)
+		}
+	}
+	var halves [2]int
+	for half := 0; half < 2; half++ {
+		for y := 0; y < size; y++ {
+			for x := half * size / 2; x < (half+1)*size/2; x++ {
+				a, b := uint32(y*(size+1)+x), uint32((y+1)*(size+1)+x)
+				for _, v := range []uint32{a, b, a + 1, a + 1, b, b + 1} {
+					indices = binary.LittleEndian.AppendUint32(indices, v)
+				}
+				halves[half] += 6
+			}
+		}
+	}
+
+	buffer := append(append(append([]byte{}, positions...), texcoords...), indices...)
+	vertices := (size + 1) * (size + 1)
+	doc := &Document{
+		Asset:  Asset{Version: "2.0"},
+		Scene:  Int(0),
+		Scenes: []Scene{{Nodes: []int{0}}},
+		Nodes:  []Node{{Mesh: Int(0)}},
+		Meshes: []Mesh{{Primitives: []Primitive{
+			{Attributes: map[string]int{"POSITION": 0, "TEXCOORD_0": 1}, Indices: Int(2), Material: Int(0)},
+			{Attributes: map[string]int{"POSITION": 0, "TEXCOORD_0": 1}, Indices: Int(3), Material: Int(1)},
+		}}},
+		Accessors: []Accessor{
+			{BufferView: Int(0), ComponentType: ComponentFloat, Count: vertices, Type: "VEC3", Min: []float64{0, 0, 0}, Max: []float64{float64(size), 0, float64(size)}},
+			{BufferView: Int(1), ComponentType: ComponentUnsignedShort, Normalized: true, Count: vertices, Type: "VEC2"},
+			{BufferView: Int(2), ComponentType: ComponentUnsignedInt, Count: halves[0], Type: "SCALAR"},
+			{BufferView: Int(2), ByteOffset: 4 * halves[0], ComponentType: ComponentUnsignedInt, Count: halves[1], Type: "SCALAR"},
+		},
+		BufferViews: []BufferView{
+			{Buffer: 0, ByteLength: len(positions), Target: 34962},
+			{Buffer: 0, ByteOffset: len(positions), ByteLength: len(texcoords), ByteStride: 8, Target: 34962},
+			{Buffer: 0, ByteOffset: len(positions) + len(texcoords), ByteLength: len(indices), Target: 34963},
+		},
+		Buffers:   []Buffer{{ByteLength: len(buffer)}},
+		Materials: []Material{{Name: "oak"}, {Name: "steel"}},
+	}
+	return &Model{Document: doc, Buffers: [][]byte{buffer}}
+}
+
+func TestSimplify_KeepsMaterialBoundariesAndDropsUnusedVertices(t *testing.T) {
+	model := newGrid(8)
+
+	lod, err := model.Simplify(0.25)
+	assert.NoError(t, err)
+	glb, err := lod.WriteGLB()
+	assert.NoError(t, err)
+
+	report := Validate(glb, nil)
+	assert.Zero(t, report.NumErrors, report.Issues)
+	assert.Less(t, len(glb), len(mustWriteGLB(t, model)))
+	assert.Equal(t, 81, model.Document.Accessors[0].Count, "the original is left alone")
+
+	read, err := Read(glb, nil)
+	assert.NoError(t, err)
+	positions, _, err := read.Floats(0)
+	assert.NoError(t, err)
+	texcoords, _, err := read.Floats(1)
+	assert.NoError(t, err)
+	assert.Less(t, read.Document.Accessors[0].Count, 81)
+	for i, primitive := range read.Document.Meshes[0].Primitives {
+		triangles, err := read.Triangles(primitive)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, len(triangles)/3, 16)
+		assert.Equal(t, i, *primitive.Material)
+
+		// The column where the materials meet keeps every vertex, and the
+		// texture coordinates still belong to their positions
+		boundary := 0
+		for _, index := range triangles {
+			x, z := positions[3*index], positions[3*index+2]
+			assert.InDelta(t, x/8, texcoords[2*index], 1e-4)
+			assert.InDelta(t, z/8, texcoords[2*index+1], 1e-4)
+			if x == 4 {
+				boundary++
+			}
+		}
+		assert.Positive(t, boundary)
+	}
+	stats, err := read.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, [3]float64{0, 0, 0}, stats.Min)
+	assert.Equal(t, [3]float64{8, 0, 8}, stats.Max)
+}
+
+func TestSimplify_RejectsCompressedAssetsAndBadRatios(t *testing.T) {
+	model := newGrid(2)
+	_, err := model.Simplify(0)
+	assert.Error(t, err)
+	_, err = model.Simplify(1.5)
+	assert.Error(t, err)
+
+	model.Document.ExtensionsUsed = []string{"KHR_draco_mesh_compression"}
+	_, err = model.Simplify(0.5)
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func mustWriteGLB(t *testing.T, model *Model) []byte {
+	glb, err := model.WriteGLB()
+	assert.NoError(t, err)
+	return glb
+}
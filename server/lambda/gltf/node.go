@@ -0,0 +1,71 @@
+package gltf
+
+// Identity is the column-major identity matrix
+var Identity = [16]float64{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+
+// LocalMatrix returns the column-major transform of a node relative to its
+// parent, from its matrix or from its translation, rotation and scale
+func (n Node) LocalMatrix() [16]float64 {
+	if len(n.Matrix) == 16 {
+		var matrix [16]float64
+		copy(matrix[:], n.Matrix)
+		return matrix
+	}
+	t := [3]float64{0, 0, 0}
+	r := [4]float64{0, 0, 0, 1}
+	s := [3]float64{1, 1, 1}
+	copy(t[:], n.Translation)
+	copy(r[:], n.Rotation)
+	copy(s[:], n.Scale)
+
+	x, y, z, w := r[0], r[1], r[2], r[3]
+	return [16]float64{
+		(1 - 2*(y*y+z*z)) * s[0], 2 * (x*y + z*w) * s[0], 2 * (x*z - y*w) * s[0], 0,
+		2 * (x*y - z*w) * s[1], (1 - 2*(x*x+z*z)) * s[1], 2 * (y*z + x*w) * s[1], 0,
+		2 * (x*z + y*w) * s[2], 2 * (y*z - x*w) * s[2], (1 - 2*(x*x+y*y)) * s[2], 0,
+		t[0], t[1], t[2], 1,
+	}
+}
+
+// Multiply returns a*b for column-major matrices
+func Multiply(a [16]float64, b [16]float64) [16]float64 {
+	var out [16]float64
+	for column := 0; column < 4; column++ {
+		for row := 0; row < 4; row++ {
+			var sum float64
+			for k := 0; k < 4; k++ {
+				sum += a[k*4+row] * b[column*4+k]
+			}
+			out[column*4+row] = sum
+		}
+	}
+	return out
+}
+
+// SceneRoots returns the root nodes of the default scene, or of the first
+// scene when none is set. Assets without scenes have every node that is
+// nobody's child as a root.
+func (d *Document) SceneRoots() []int {
+	if len(d.Scenes) > 0 {
+		scene := 0
+		if d.Scene != nil && *d.Scene >= 0 && *d.Scene < len(d.Scenes) {
+			scene = *d.Scene
+		}
+		return d.Scenes[scene].Nodes
+	}
+	isChild := make([]bool, len(d.Nodes))
+	for _, node := range d.Nodes {
+		for _, child := range node.Children {
+			if child >= 0 && child < len(isChild) {
+				isChild[child] = true
+			}
+		}
+	}
+	var roots []int
+	for i := range d.Nodes {
+		if !isChild[i] {
+			roots = append(roots, i)
+		}
+	}
+	return roots
+}
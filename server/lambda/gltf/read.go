@@ -0,0 +1,236 @@
+package gltf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Resolver returns the content of a file an asset references by a relative
+// URI. The URI is percent-decoded but otherwise as written in the asset, so
+// resolvers must not trust it to stay inside a directory.
+type Resolver func(uri string) ([]byte, error)
+
+// Model is a parsed asset with its buffers and images loaded
+type Model struct {
+	Document *Document
+	// Buffers holds the content of every buffer, by index
+	Buffers [][]byte
+	// Images holds the encoded content of every image, by index
+	Images []ImageData
+}
+
+type ImageData struct {
+	MimeType string
+	Data     []byte
+	// Path is the URI of an image that was read from its own file
+	Path string
+}
+
+// unsupportedExtensions store buffers this package cannot load or rewrite
+var unsupportedExtensions = []string{"EXT_meshopt_compression", "KHR_meshopt_compression"}
+
+// Read parses a .glb or a .gltf, telling them apart by the GLB header.
+// External buffers and images are loaded through resolve, which may be nil
+// for assets that embed everything.
+func Read(data []byte, resolve Resolver) (*Model, error) {
+	jsonChunk, binChunk := data, []byte(nil)
+	isGLB := IsGLB(data)
+	if isGLB {
+		var err error
+		if jsonChunk, binChunk, err = splitGLB(data); err != nil {
+			return nil, err
+		}
+	}
+
+	var doc Document
+	if err := json.Unmarshal(jsonChunk, &doc); err != nil {
+		return nil, invalid("malformed JSON: %v", err)
+	}
+	if !strings.HasPrefix(doc.Asset.Version, "2.") {
+		return nil, fmt.Errorf("%w: asset version %q, only 2.x is supported", ErrUnsupported, doc.Asset.Version)
+	}
+	if doc.Asset.MinVersion != "" && doc.Asset.MinVersion != "2.0" {
+		return nil, fmt.Errorf("%w: asset requires version %s", ErrUnsupported, doc.Asset.MinVersion)
+	}
+	for _, used := range doc.ExtensionsUsed {
+		for _, unsupported := range unsupportedExtensions {
+			if used == unsupported {
+				return nil, fmt.Errorf("%w: %s is not supported", ErrUnsupported, used)
+			}
+		}
+	}
+
+	model := &Model{Document: &doc}
+	for i, buffer := range doc.Buffers {
+		var content []byte
+		switch {
+		case buffer.URI == "" && i == 0 && isGLB:
+			content = binChunk
+		case buffer.URI == "":
+			return nil, invalid("buffer %d has no uri", i)
+		default:
+			var err error
+			if content, _, err = loadURI(buffer.URI, resolve); err != nil {
+				return nil, fmt.Errorf("buffer %d: %w", i, err)
+			}
+		}
+		if len(content) < buffer.ByteLength {
+			return nil, invalid("buffer %d declares %d bytes but has %d", i, buffer.ByteLength, len(content))
+		}
+		model.Buffers = append(model.Buffers, content[:buffer.ByteLength])
+	}
+
+	if err := model.checkBufferViews(); err != nil {
+		return nil, err
+	}
+	for i, image := range doc.Images {
+		loaded, err := model.loadImage(image, resolve)
+		if err != nil {
+			return nil, fmt.Errorf("image %d: %w", i, err)
+		}
+		model.Images = append(model.Images, loaded)
+	}
+	return model, nil
+}
+
+// checkBufferViews makes sure every buffer view fits its buffer and every
+// reference to a view points at one
+func (m *Model) checkBufferViews() error {
+	doc := m.Document
+	for i, view := range doc.BufferViews {
+		if view.Buffer < 0 || view.Buffer >= len(m.Buffers) {
+			return invalid("buffer view %d references missing buffer %d", i, view.Buffer)
+		}
+		if view.ByteOffset < 0 || view.ByteLength < 0 || view.ByteOffset+view.ByteLength > len(m.Buffers[view.Buffer]) {
+			return invalid("buffer view %d runs past the end of buffer %d", i, view.Buffer)
+		}
+	}
+	checkView := func(kind string, index int, view int) error {
+		if view < 0 || view >= len(doc.BufferViews) {
+			return invalid("%s %d references missing buffer view %d", kind, index, view)
+		}
+		return nil
+	}
+	for i, accessor := range doc.Accessors {
+		if accessor.BufferView != nil {
+			if err := checkView("accessor", i, *accessor.BufferView); err != nil {
+				return err
+			}
+		}
+		if accessor.Sparse != nil {
+			if err := checkView("accessor", i, accessor.Sparse.Indices.BufferView); err != nil {
+				return err
+			}
+			if err := checkView("accessor", i, accessor.Sparse.Values.BufferView); err != nil {
+				return err
+			}
+		}
+	}
+	for i, image := range doc.Images {
+		if image.BufferView != nil {
+			if err := checkView("image", i, *image.BufferView); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Model) loadImage(image Image, resolve Resolver) (ImageData, error) {
+	if image.BufferView != nil {
+		view := m.Document.BufferViews[*image.BufferView]
+		data := m.Buffers[view.Buffer][view.ByteOffset : view.ByteOffset+view.ByteLength]
+		return ImageData{MimeType: imageMimeType(image.MimeType, "", data), Data: data}, nil
+	}
+	if image.URI == "" {
+		return ImageData{}, invalid("image has neither a uri nor a buffer view")
+	}
+	data, mimeType, err := loadURI(image.URI, resolve)
+	if err != nil {
+		return ImageData{}, err
+	}
+	loaded := ImageData{MimeType: imageMimeType(image.MimeType, mimeType, data), Data: data}
+	if !strings.HasPrefix(image.URI, "data:") {
+		loaded.Path, _ = url.PathUnescape(image.URI)
+		if loaded.MimeType == "" {
+			loaded.MimeType = extensionMimeTypes[strings.ToLower(path.Ext(loaded.Path))]
+		}
+	}
+	return loaded, nil
+}
+
+// loadURI returns the content a buffer or image URI points at, with the media
+// type of data URIs
+func loadURI(uri string, resolve Resolver) ([]byte, string, error) {
+	if strings.HasPrefix(uri, "data:") {
+		return decodeDataURI(uri)
+	}
+	if parsed, err := url.Parse(uri); err == nil && parsed.Scheme != "" {
+		return nil, "", fmt.Errorf("%w: %s URIs are not supported", ErrUnsupported, parsed.Scheme)
+	}
+	decoded, err := url.PathUnescape(uri)
+	if err != nil {
+		return nil, "", invalid("malformed uri %q", uri)
+	}
+	if resolve == nil {
+		return nil, "", fmt.Errorf("%w: references external file %s", ErrUnsupported, decoded)
+	}
+	data, err := resolve(decoded)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, "", nil
+}
+
+func decodeDataURI(uri string) ([]byte, string, error) {
+	header, payload, ok := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !ok {
+		return nil, "", invalid("malformed data uri")
+	}
+	mimeType, isBase64 := strings.CutSuffix(header, ";base64")
+	if !isBase64 {
+		return nil, "", fmt.Errorf("%w: data uris must be base64 encoded", ErrUnsupported)
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, "", invalid("malformed base64 in data uri")
+	}
+	return data, mimeType, nil
+}
+
+func encodeDataURI(mimeType string, data []byte) string {
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+var extensionMimeTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".webp": "image/webp",
+	".ktx2": "image/ktx2",
+}
+
+// imageMimeType prefers the type the asset declares, then the type of its
+// data URI, then what the content looks like
+func imageMimeType(declared string, fromURI string, data []byte) string {
+	switch {
+	case declared != "":
+		return declared
+	case fromURI != "" && fromURI != "application/octet-stream":
+		return fromURI
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return "image/jpeg"
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return "image/webp"
+	case bytes.HasPrefix(data, []byte("\xabKTX 20\xbb\r\n\x1a\n")):
+		return "image/ktx2"
+	}
+	return ""
+}
@@ -0,0 +1,425 @@
+package gltf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/simplify"
+)
+
+// Buffer view targets of vertex attributes and indices
+const (
+	arrayBufferTarget        = 34962
+	elementArrayBufferTarget = 34963
+)
+
+type primitiveRef struct {
+	mesh      int
+	primitive int
+}
+
+// vertexSet is a group of primitives sharing vertex accessors, whose
+// vertices are compacted together
+type vertexSet struct {
+	primitives []primitiveRef
+	accessors  []int
+}
+
+// Simplify returns a copy of the model keeping about ratio of the triangles
+// of every primitive. Each primitive is simplified on its own, so materials
+// keep their boundaries, and vertices at a position another primitive of the
+// mesh uses never move. Texture seams are collapsed on both sides together.
+// Vertices no triangle uses any more are dropped from the vertex accessors,
+// which keep their index, so skins and animations stay valid.
+func (m *Model) Simplify(ratio float64) (*Model, error) {
+	if ratio <= 0 || ratio > 1 {
+		return nil, fmt.Errorf("ratio %v must be above 0 and at most 1", ratio)
+	}
+	if usesAny(m.Document.ExtensionsUsed, bufferViewExtensions) {
+		return nil, fmt.Errorf("%w: cannot simplify assets using %s", ErrUnsupported, strings.Join(m.Document.ExtensionsUsed, ", "))
+	}
+	doc, err := m.cloneDocument()
+	if err != nil {
+		return nil, err
+	}
+	lod := &Model{Document: doc, Buffers: append([][]byte{}, m.Buffers...), Images: m.Images}
+
+	triangles := map[primitiveRef][]uint32{}
+	positions := map[int][]float32{}
+	for i, mesh := range doc.Meshes {
+		for j, primitive := range mesh.Primitives {
+			position, ok := primitive.Attributes["POSITION"]
+			if !ok || !isTriangles(primitive) {
+				continue
+			}
+			if _, ok := positions[position]; !ok {
+				if positions[position], _, err = lod.Floats(position); err != nil {
+					return nil, err
+				}
+			}
+			indices, err := lod.Triangles(primitive)
+			if err != nil {
+				return nil, err
+			}
+			for _, index := range indices {
+				if int(index) >= len(positions[position])/3 {
+					return nil, invalid("mesh %d primitive %d: index %d is out of range", i, j, index)
+				}
+			}
+			triangles[primitiveRef{i, j}] = indices
+		}
+	}
+
+	appender := newBufferAppender(lod)
+	shared := sharedPositions(doc, triangles, positions)
+	for _, set := range vertexSets(doc) {
+		if err := lod.simplifyVertexSet(appender, set, triangles, positions, shared, ratio); err != nil {
+			return nil, err
+		}
+	}
+	return lod, nil
+}
+
+func isTriangles(primitive Primitive) bool {
+	mode := primitive.PrimitiveMode()
+	return mode == ModeTriangles || mode == ModeTriangleStrip || mode == ModeTriangleFan
+}
+
+func vertexAccessors(primitive Primitive) []int {
+	var accessors []int
+	for _, accessor := range primitive.Attributes {
+		accessors = append(accessors, accessor)
+	}
+	for _, target := range primitive.Targets {
+		for _, accessor := range target {
+			accessors = append(accessors, accessor)
+		}
+	}
+	return accessors
+}
+
+// vertexSets groups the primitives that share any vertex accessor, in the
+// order they first appear
+func vertexSets(doc *Document) []*vertexSet {
+	parent := map[int]int{}
+	var find func(accessor int) int
+	find = func(accessor int) int {
+		if p, ok := parent[accessor]; ok && p != accessor {
+			root := find(p)
+			parent[accessor] = root
+			return root
+		}
+		parent[accessor] = accessor
+		return accessor
+	}
+	for _, mesh := range doc.Meshes {
+		for _, primitive := range mesh.Primitives {
+			accessors := vertexAccessors(primitive)
+			for _, accessor := range accessors {
+				parent[find(accessor)] = find(accessors[0])
+			}
+		}
+	}
+
+	var sets []*vertexSet
+	byRoot := map[int]*vertexSet{}
+	for i, mesh := range doc.Meshes {
+		for j, primitive := range mesh.Primitives {
+			accessors := vertexAccessors(primitive)
+			if len(accessors) == 0 {
+				continue
+			}
+			root := find(accessors[0])
+			set, ok := byRoot[root]
+			if !ok {
+				set = &vertexSet{}
+				byRoot[root] = set
+				sets = append(sets, set)
+			}
+			set.primitives = append(set.primitives, primitiveRef{i, j})
+			for _, accessor := range accessors {
+				if !slices.Contains(set.accessors, accessor) {
+					set.accessors = append(set.accessors, accessor)
+				}
+			}
+		}
+	}
+	// Attributes come from maps, sorting keeps the written buffer stable
+	for _, set := range sets {
+		slices.Sort(set.accessors)
+	}
+	return sets
+}
+
+// sharedPositions lists for every mesh the positions more than one of its
+// primitives draws triangles at, which is where materials meet
+func sharedPositions(doc *Document, triangles map[primitiveRef][]uint32, positions map[int][]float32) []map[[3]float32]bool {
+	shared := make([]map[[3]float32]bool, len(doc.Meshes))
+	for i, mesh := range doc.Meshes {
+		users := map[[3]float32]int{}
+		for j, primitive := range mesh.Primitives {
+			indices, ok := triangles[primitiveRef{i, j}]
+			if !ok {
+				continue
+			}
+			values := positions[primitive.Attributes["POSITION"]]
+			seen := map[[3]float32]bool{}
+			for _, index := range indices {
+				key := [3]float32{values[3*index], values[3*index+1], values[3*index+2]}
+				if !seen[key] {
+					seen[key] = true
+					users[key]++
+				}
+			}
+		}
+		shared[i] = map[[3]float32]bool{}
+		for key, count := range users {
+			if count > 1 {
+				shared[i][key] = true
+			}
+		}
+	}
+	return shared
+}
+
+// simplifyVertexSet simplifies the triangles of every primitive of a set,
+// then drops the vertices none of them uses any more
+func (m *Model) simplifyVertexSet(appender *bufferAppender, set *vertexSet, triangles map[primitiveRef][]uint32, positions map[int][]float32, shared []map[[3]float32]bool, ratio float64) error {
+	doc := m.Document
+	count := -1
+	for _, index := range set.accessors {
+		accessor, _, err := m.accessor(index)
+		if err != nil {
+			return err
+		}
+		if count >= 0 && accessor.Count != count {
+			return invalid("accessor %d has %d elements, the other vertex attributes %d", index, accessor.Count, count)
+		}
+		count = accessor.Count
+	}
+
+	indices := make([][]uint32, len(set.primitives))
+	// Primitives without indices draw every vertex, which then all stay
+	compact := true
+	for i, ref := range set.primitives {
+		primitive := doc.Meshes[ref.mesh].Primitives[ref.primitive]
+		original, ok := triangles[ref]
+		switch {
+		case ok:
+			values := positions[primitive.Attributes["POSITION"]]
+			locked := make([]bool, count)
+			for _, index := range original {
+				locked[index] = shared[ref.mesh][[3]float32{values[3*index], values[3*index+1], values[3*index+2]}]
+			}
+			target := max(1, int(math.Round(ratio*float64(len(original)/3))))
+			indices[i] = simplify.Simplify(simplify.Mesh{Positions: values, Indices: original, Locked: locked}, target)
+		case primitive.Indices != nil:
+			var err error
+			if indices[i], err = m.Indices(*primitive.Indices); err != nil {
+				return err
+			}
+			for _, index := range indices[i] {
+				if int(index) >= count {
+					return invalid("mesh %d primitive %d: index %d is out of range", ref.mesh, ref.primitive, index)
+				}
+			}
+		default:
+			compact = false
+		}
+	}
+
+	remap := make([]uint32, count)
+	var kept []uint32
+	for v := range remap {
+		remap[v] = uint32(v)
+	}
+	if compact {
+		used := make([]bool, count)
+		for _, values := range indices {
+			for _, index := range values {
+				used[index] = true
+			}
+		}
+		for v, isUsed := range used {
+			if isUsed {
+				remap[v] = uint32(len(kept))
+				kept = append(kept, uint32(v))
+			}
+		}
+		compact = len(kept) > 0 && len(kept) < count
+	}
+	if compact {
+		for _, index := range set.accessors {
+			accessor, data, stride, err := m.gather(index, kept)
+			if err != nil {
+				return err
+			}
+			accessor.BufferView = Int(appender.view(data, stride, arrayBufferTarget))
+			doc.Accessors[index] = accessor
+		}
+	}
+
+	vertexCount := count
+	if compact {
+		vertexCount = len(kept)
+	}
+	references := indexReferences(doc)
+	for i, ref := range set.primitives {
+		primitive := &doc.Meshes[ref.mesh].Primitives[ref.primitive]
+		_, simplified := triangles[ref]
+		if indices[i] == nil || (!simplified && !compact) {
+			continue
+		}
+		values := make([]uint32, len(indices[i]))
+		for j, index := range indices[i] {
+			values[j] = remap[index]
+		}
+		accessor := appender.indices(values, vertexCount)
+		if primitive.Indices != nil && references[*primitive.Indices] == 1 {
+			doc.Accessors[*primitive.Indices] = accessor
+		} else {
+			doc.Accessors = append(doc.Accessors, accessor)
+			primitive.Indices = Int(len(doc.Accessors) - 1)
+		}
+		if simplified {
+			// Strips and fans were unrolled into a list
+			primitive.Mode = nil
+		}
+	}
+	return nil
+}
+
+// indexReferences counts the primitives using each accessor as indices
+func indexReferences(doc *Document) map[int]int {
+	references := map[int]int{}
+	for _, mesh := range doc.Meshes {
+		for _, primitive := range mesh.Primitives {
+			if primitive.Indices != nil {
+				references[*primitive.Indices]++
+			}
+		}
+	}
+	return references
+}
+
+// gather copies the elements of an accessor at the given indices, with
+// sparse substitutions applied. It returns the accessor describing them and
+// the byte stride of the copy, which is set when elements are padded to four
+// bytes as vertex attributes have to be.
+func (m *Model) gather(index int, elements []uint32) (Accessor, []byte, int, error) {
+	accessor, components, err := m.accessor(index)
+	if err != nil {
+		return Accessor{}, nil, 0, err
+	}
+	size := componentSizes[accessor.ComponentType]
+	if strings.HasPrefix(accessor.Type, "MAT") && size < 4 {
+		return Accessor{}, nil, 0, fmt.Errorf("%w: accessor %d holds padded matrices", ErrUnsupported, index)
+	}
+	elementSize := size * components
+	raw := make([]byte, accessor.Count*elementSize)
+	if accessor.BufferView != nil {
+		err := m.eachComponent(*accessor.BufferView, accessor.ByteOffset, accessor.ComponentType, accessor.Count, components, func(i int, value []byte) {
+			copy(raw[i*size:], value)
+		})
+		if err != nil {
+			return Accessor{}, nil, 0, invalid("accessor %d: %v", index, err)
+		}
+	}
+	if sparse := accessor.Sparse; sparse != nil {
+		positions, err := m.sparseIndices(*sparse)
+		if err != nil {
+			return Accessor{}, nil, 0, invalid("accessor %d: %v", index, err)
+		}
+		err = m.eachComponent(sparse.Values.BufferView, sparse.Values.ByteOffset, accessor.ComponentType, sparse.Count, components, func(i int, value []byte) {
+			if element := int(positions[i/components]); element < accessor.Count {
+				copy(raw[(element*components+i%components)*size:], value)
+			}
+		})
+		if err != nil {
+			return Accessor{}, nil, 0, invalid("accessor %d: %v", index, err)
+		}
+	}
+
+	stride := (elementSize + 3) &^ 3
+	data := make([]byte, len(elements)*stride)
+	for i, element := range elements {
+		copy(data[i*stride:], raw[int(element)*elementSize:(int(element)+1)*elementSize])
+	}
+
+	if len(accessor.Min) > 0 || len(accessor.Max) > 0 {
+		low := make([]float64, components)
+		high := make([]float64, components)
+		for c := range low {
+			low[c], high[c] = math.Inf(1), math.Inf(-1)
+		}
+		for i := range elements {
+			for c := 0; c < components; c++ {
+				offset := i*stride + c*size
+				value := float64(decodeFloat(accessor.ComponentType, false, data[offset:offset+size]))
+				low[c], high[c] = math.Min(low[c], value), math.Max(high[c], value)
+			}
+		}
+		if len(accessor.Min) > 0 {
+			accessor.Min = low
+		}
+		if len(accessor.Max) > 0 {
+			accessor.Max = high
+		}
+	}
+	accessor.Count = len(elements)
+	accessor.ByteOffset = 0
+	accessor.Sparse = nil
+	if stride == elementSize {
+		stride = 0
+	}
+	return accessor, data, stride, nil
+}
+
+// bufferAppender writes new buffer views into a buffer it adds to a model
+type bufferAppender struct {
+	model  *Model
+	buffer int
+}
+
+func newBufferAppender(model *Model) *bufferAppender {
+	model.Buffers = append(model.Buffers, nil)
+	model.Document.Buffers = append(model.Document.Buffers, Buffer{})
+	return &bufferAppender{model: model, buffer: len(model.Buffers) - 1}
+}
+
+// view appends data as a new buffer view, aligned to four bytes, and returns
+// its index
+func (a *bufferAppender) view(data []byte, stride int, target int) int {
+	buffer := a.model.Buffers[a.buffer]
+	for len(buffer)%4 != 0 {
+		buffer = append(buffer, 0)
+	}
+	doc := a.model.Document
+	doc.BufferViews = append(doc.BufferViews, BufferView{Buffer: a.buffer, ByteOffset: len(buffer), ByteLength: len(data), ByteStride: stride, Target: target})
+	a.model.Buffers[a.buffer] = append(buffer, data...)
+	doc.Buffers[a.buffer].ByteLength = len(a.model.Buffers[a.buffer])
+	return len(doc.BufferViews) - 1
+}
+
+// indices appends an index accessor, in the smallest component type that
+// holds every index of vertexCount vertices
+func (a *bufferAppender) indices(values []uint32, vertexCount int) Accessor {
+	accessor := Accessor{ComponentType: ComponentUnsignedInt, Count: len(values), Type: "SCALAR"}
+	var data []byte
+	if vertexCount <= math.MaxUint16 {
+		accessor.ComponentType = ComponentUnsignedShort
+		data = make([]byte, 2*len(values))
+		for i, value := range values {
+			binary.LittleEndian.PutUint16(data[2*i:], uint16(value))
+		}
+	} else {
+		data = make([]byte, 4*len(values))
+		for i, value := range values {
+			binary.LittleEndian.PutUint32(data[4*i:], value)
+		}
+	}
+	accessor.BufferView = Int(a.view(data, 0, elementArrayBufferTarget))
+	return accessor
+}
@@ -0,0 +1,237 @@
+package gltf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"strings"
+)
+
+// Stats describe what drawing the default scene of an asset costs. Meshes
+// are counted once for every node that instances them.
+type Stats struct {
+	Vertices  int `json:"vertices"`
+	Triangles int `json:"triangles"`
+	// DrawCalls is the number of primitives drawn
+	DrawCalls int `json:"drawCalls"`
+	Materials int `json:"materials"`
+	Textures  int `json:"textures"`
+	// TextureSizes lists the resolution of every image, by index
+	TextureSizes []ImageSize `json:"textureSizes,omitempty"`
+	// ByteSize is the size of the asset with its external buffers and images
+	ByteSize int64 `json:"byteSize"`
+	// Min and Max are the corners of the bounding box of the scene, in meters
+	Min           [3]float64 `json:"min"`
+	Max           [3]float64 `json:"max"`
+	HasAnimations bool       `json:"hasAnimations"`
+	HasSkins      bool       `json:"hasSkins"`
+}
+
+// ImageSize is the resolution of an image, zero when its format is unknown
+type ImageSize struct {
+	MimeType string `json:"mimeType,omitempty"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+}
+
+// Analyze reads an asset the way Read does and computes its stats
+func Analyze(data []byte, resolve Resolver) (*Stats, error) {
+	model, err := Read(data, resolve)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := model.Stats()
+	if err != nil {
+		return nil, err
+	}
+	stats.ByteSize += int64(len(data))
+	return stats, nil
+}
+
+// Stats computes the stats of a model. ByteSize only counts the external
+// buffers and images, as the file they were read from is not kept.
+func (m *Model) Stats() (*Stats, error) {
+	doc := m.Document
+	s := &statsWalker{
+		model:   m,
+		stats:   &Stats{Materials: len(doc.Materials), Textures: len(doc.Textures), HasAnimations: len(doc.Animations) > 0, HasSkins: len(doc.Skins) > 0},
+		visited: make([]bool, len(doc.Nodes)),
+		empty:   true,
+	}
+	s.stats.Min = [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	s.stats.Max = [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, root := range doc.SceneRoots() {
+		if err := s.node(root, Identity); err != nil {
+			return nil, err
+		}
+	}
+	if s.empty {
+		s.stats.Min, s.stats.Max = [3]float64{}, [3]float64{}
+	}
+
+	for i, buffer := range doc.Buffers {
+		if buffer.URI != "" && !strings.HasPrefix(buffer.URI, "data:") {
+			s.stats.ByteSize += int64(len(m.Buffers[i]))
+		}
+	}
+	for _, loaded := range m.Images {
+		if loaded.Path != "" {
+			s.stats.ByteSize += int64(len(loaded.Data))
+		}
+		width, height := imageSize(loaded.Data)
+		s.stats.TextureSizes = append(s.stats.TextureSizes, ImageSize{MimeType: loaded.MimeType, Width: width, Height: height})
+	}
+	return s.stats, nil
+}
+
+type statsWalker struct {
+	model   *Model
+	stats   *Stats
+	visited []bool
+	// empty stays true until a vertex widens the bounding box
+	empty bool
+}
+
+func (s *statsWalker) node(index int, parent [16]float64) error {
+	doc := s.model.Document
+	if index < 0 || index >= len(doc.Nodes) {
+		return invalid("missing node %d", index)
+	}
+	if s.visited[index] {
+		return invalid("node %d appears more than once in the scene", index)
+	}
+	s.visited[index] = true
+	node := doc.Nodes[index]
+	world := Multiply(parent, node.LocalMatrix())
+
+	if node.Mesh != nil {
+		if *node.Mesh < 0 || *node.Mesh >= len(doc.Meshes) {
+			return invalid("node %d references missing mesh %d", index, *node.Mesh)
+		}
+		for _, primitive := range doc.Meshes[*node.Mesh].Primitives {
+			if err := s.primitive(primitive, world); err != nil {
+				return err
+			}
+		}
+	}
+	for _, child := range node.Children {
+		if err := s.node(child, world); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *statsWalker) primitive(primitive Primitive, world [16]float64) error {
+	position, ok := primitive.Attributes["POSITION"]
+	if !ok {
+		return nil
+	}
+	accessor, _, err := s.model.accessor(position)
+	if err != nil {
+		return err
+	}
+	s.stats.DrawCalls++
+	s.stats.Vertices += accessor.Count
+
+	elements := accessor.Count
+	if primitive.Indices != nil {
+		indices, _, err := s.model.accessor(*primitive.Indices)
+		if err != nil {
+			return err
+		}
+		elements = indices.Count
+	}
+	switch primitive.PrimitiveMode() {
+	case ModeTriangles:
+		s.stats.Triangles += elements / 3
+	case ModeTriangleStrip, ModeTriangleFan:
+		s.stats.Triangles += max(elements-2, 0)
+	}
+	if accessor.Count == 0 {
+		return nil
+	}
+
+	// POSITION accessors must declare their bounds, but not every exporter
+	// does
+	low, high := accessor.Min, accessor.Max
+	if len(low) != 3 || len(high) != 3 || accessor.Sparse != nil {
+		points, _, err := s.model.Floats(position)
+		if err != nil {
+			return err
+		}
+		if len(points) < 3 {
+			return nil
+		}
+		low = []float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+		high = []float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+		for i := 0; i+2 < len(points); i += 3 {
+			for axis := 0; axis < 3; axis++ {
+				low[axis] = math.Min(low[axis], float64(points[i+axis]))
+				high[axis] = math.Max(high[axis], float64(points[i+axis]))
+			}
+		}
+	}
+	// The corners of the local box bound the transformed box
+	for corner := 0; corner < 8; corner++ {
+		var local [3]float64
+		for axis := 0; axis < 3; axis++ {
+			local[axis] = low[axis]
+			if corner&(1<<axis) != 0 {
+				local[axis] = high[axis]
+			}
+		}
+		for axis := 0; axis < 3; axis++ {
+			value := world[axis]*local[0] + world[4+axis]*local[1] + world[8+axis]*local[2] + world[12+axis]
+			s.stats.Min[axis] = math.Min(s.stats.Min[axis], value)
+			s.stats.Max[axis] = math.Max(s.stats.Max[axis], value)
+		}
+	}
+	s.empty = false
+	return nil
+}
+
+// imageSize reads the resolution from the header of a PNG, JPEG, WebP or
+// KTX2 image, returning zeros for anything else
+func imageSize(data []byte) (int, int) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xabKTX 20\xbb\r\n\x1a\n")):
+		if len(data) < 28 {
+			return 0, 0
+		}
+		return int(binary.LittleEndian.Uint32(data[20:])), int(binary.LittleEndian.Uint32(data[24:]))
+	case len(data) >= 30 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return webpSize(data)
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0
+	}
+	return config.Width, config.Height
+}
+
+// webpSize reads the resolution from the first chunk of a WebP, which is a
+// lossy, lossless or extended header
+func webpSize(data []byte) (int, int) {
+	switch string(data[12:16]) {
+	case "VP8 ":
+		if !bytes.Equal(data[23:26], []byte{0x9d, 0x01, 0x2a}) {
+			return 0, 0
+		}
+		return int(binary.LittleEndian.Uint16(data[26:]) & 0x3fff), int(binary.LittleEndian.Uint16(data[28:]) & 0x3fff)
+	case "VP8L":
+		if data[20] != 0x2f {
+			return 0, 0
+		}
+		bits := binary.LittleEndian.Uint32(data[21:])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1
+	case "VP8X":
+		width := int(data[24]) | int(data[25])<<8 | int(data[26])<<16
+		height := int(data[27]) | int(data[28])<<8 | int(data[29])<<16
+		return width + 1, height + 1
+	}
+	return 0, 0
+}
@@ -0,0 +1,844 @@
+package gltf
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Severities of validation issues, ranked the way the Khronos glTF
+// validator ranks them
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+var severityRanks = map[string]int{SeverityError: 0, SeverityWarning: 1, SeverityInfo: 2}
+
+// maxIssues caps the issues a report lists, every issue is still counted
+const maxIssues = 100
+
+// Issue is one problem found in an asset. Codes are those of the Khronos
+// validator, and Pointer is a JSON pointer to the offending property.
+type Issue struct {
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Pointer  string `json:"pointer,omitempty"`
+}
+
+const (
+	StatusValidated = "validated"
+	// StatusSkipped reports are for files that could not be checked, Reason
+	// says why
+	StatusSkipped = "skipped"
+)
+
+// Report lists the issues found in an asset, errors first
+type Report struct {
+	Status      string  `json:"status"`
+	Reason      string  `json:"reason,omitempty"`
+	NumErrors   int     `json:"numErrors"`
+	NumWarnings int     `json:"numWarnings"`
+	NumInfos    int     `json:"numInfos"`
+	Issues      []Issue `json:"issues,omitempty"`
+	// Truncated is set when more issues were found than the report lists
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Validate checks a .glb or a .gltf against the glTF 2.0 specification: the
+// GLB container, the references between objects, the layout of buffers and
+// accessors and the data of accessors meshes depend on. External buffers and
+// images are loaded through resolve, which may be nil.
+func Validate(data []byte, resolve Resolver) *Report {
+	v := &validator{report: &Report{Status: StatusValidated}}
+	v.validate(data, resolve)
+
+	issues := v.report.Issues
+	sort.SliceStable(issues, func(i, j int) bool {
+		return severityRanks[issues[i].Severity] < severityRanks[issues[j].Severity]
+	})
+	if len(issues) > maxIssues {
+		v.report.Issues = issues[:maxIssues]
+	}
+	v.report.Truncated = v.report.NumErrors+v.report.NumWarnings+v.report.NumInfos > len(v.report.Issues)
+	return v.report
+}
+
+// Skipped is the report of a file that was not validated
+func Skipped(reason string) *Report {
+	return &Report{Status: StatusSkipped, Reason: reason}
+}
+
+type validator struct {
+	report *Report
+	model  *Model
+	// viewOK and accessorOK mark the objects whose data can be read
+	viewOK     []bool
+	accessorOK []bool
+	// parents holds the parent of every node, -1 for roots
+	parents []int
+	// used marks the meshes, materials, textures and images something
+	// references
+	used map[string][]bool
+}
+
+func (v *validator) add(severity string, code string, pointer string, format string, args ...any) {
+	count := map[string]*int{
+		SeverityError:   &v.report.NumErrors,
+		SeverityWarning: &v.report.NumWarnings,
+		SeverityInfo:    &v.report.NumInfos,
+	}[severity]
+	// Keeping maxIssues of each severity lets errors found late still make
+	// the cut once the report is sorted
+	if *count++; *count <= maxIssues {
+		v.report.Issues = append(v.report.Issues, Issue{Code: code, Severity: severity, Message: fmt.Sprintf(format, args...), Pointer: pointer})
+	}
+}
+
+// reference reports whether index points at one of count objects, adding an
+// error when it does not
+func (v *validator) reference(pointer string, index int, count int) bool {
+	if index >= 0 && index < count {
+		return true
+	}
+	v.add(SeverityError, "UNRESOLVED_REFERENCE", pointer, "unresolved reference %d", index)
+	return false
+}
+
+func (v *validator) markUsed(kind string, index int) {
+	if index >= 0 && index < len(v.used[kind]) {
+		v.used[kind][index] = true
+	}
+}
+
+func (v *validator) validate(data []byte, resolve Resolver) {
+	jsonChunk, binChunk := data, []byte(nil)
+	isGLB := IsGLB(data)
+	if isGLB {
+		var ok bool
+		if jsonChunk, binChunk, ok = v.glb(data); !ok {
+			return
+		}
+	}
+
+	var doc Document
+	if err := json.Unmarshal(jsonChunk, &doc); err != nil {
+		v.add(SeverityError, "INVALID_JSON", "", "malformed JSON: %v", err)
+		return
+	}
+	if !strings.HasPrefix(doc.Asset.Version, "2.") {
+		v.add(SeverityError, "UNKNOWN_ASSET_MAJOR_VERSION", "/asset/version", "asset version %q, only 2.x is supported", doc.Asset.Version)
+		return
+	}
+	v.model = &Model{Document: &doc, Buffers: make([][]byte, len(doc.Buffers))}
+	v.used = map[string][]bool{
+		"meshes":    make([]bool, len(doc.Meshes)),
+		"materials": make([]bool, len(doc.Materials)),
+		"textures":  make([]bool, len(doc.Textures)),
+		"images":    make([]bool, len(doc.Images)),
+	}
+
+	for i, required := range doc.ExtensionsRequired {
+		if !slices.Contains(doc.ExtensionsUsed, required) {
+			v.add(SeverityError, "UNUSED_EXTENSION_REQUIRED", fmt.Sprintf("/extensionsRequired/%d", i), "%s is required but not listed as used", required)
+		}
+	}
+	v.buffers(binChunk, isGLB, resolve)
+	v.bufferViews()
+	v.accessors()
+	v.nodes()
+	v.scenes()
+	v.meshes()
+	v.materials()
+	v.textures()
+	v.images(resolve)
+	v.skins()
+	v.animations()
+
+	for _, kind := range []string{"meshes", "materials", "textures", "images"} {
+		for i, used := range v.used[kind] {
+			if !used {
+				v.add(SeverityInfo, "UNUSED_OBJECT", fmt.Sprintf("/%s/%d", kind, i), "this object may be unused")
+			}
+		}
+	}
+}
+
+// glb checks the GLB container and returns its JSON and BIN chunks, with
+// false when the JSON cannot be found
+func (v *validator) glb(data []byte) ([]byte, []byte, bool) {
+	if len(data) < glbHeaderSize+8 {
+		v.add(SeverityError, "GLB_LENGTH_TOO_SMALL", "", "a GLB needs at least %d bytes, the file has %d", glbHeaderSize+8, len(data))
+		return nil, nil, false
+	}
+	if version := binary.LittleEndian.Uint32(data[4:8]); version != glbVersion {
+		v.add(SeverityError, "GLB_INVALID_VERSION", "", "GLB version %d, only version 2 is supported", version)
+		return nil, nil, false
+	}
+	length := int64(binary.LittleEndian.Uint32(data[8:12]))
+	if length != int64(len(data)) {
+		v.add(SeverityError, "GLB_LENGTH_MISMATCH", "", "the GLB header declares %d bytes but the file has %d", length, len(data))
+		if length > int64(len(data)) {
+			return nil, nil, false
+		}
+		data = data[:length]
+	}
+
+	var jsonChunk, binChunk []byte
+	offset := glbHeaderSize
+	for index := 0; offset < len(data); index++ {
+		if len(data)-offset < 8 {
+			v.add(SeverityError, "GLB_UNEXPECTED_END_OF_CHUNK_HEADER", "", "the GLB ends inside the header of chunk %d", index)
+			break
+		}
+		chunkLength := int64(binary.LittleEndian.Uint32(data[offset : offset+4]))
+		chunkType := binary.LittleEndian.Uint32(data[offset+4 : offset+8])
+		start := offset + 8
+		if chunkLength%4 != 0 {
+			v.add(SeverityError, "GLB_CHUNK_LENGTH_UNALIGNED", "", "chunk %d is %d bytes long, not a multiple of 4", index, chunkLength)
+		}
+		if chunkLength > int64(len(data)-start) {
+			v.add(SeverityError, "GLB_CHUNK_TOO_BIG", "", "chunk %d runs past the end of the file", index)
+			break
+		}
+		chunk := data[start : start+int(chunkLength)]
+		switch {
+		case index == 0 && chunkType != chunkJSON:
+			v.add(SeverityError, "GLB_UNEXPECTED_FIRST_CHUNK", "", "the first chunk must be JSON")
+			return nil, nil, false
+		case index == 0:
+			jsonChunk = chunk
+		case index == 1 && chunkType == chunkBIN:
+			binChunk = chunk
+		case chunkType == chunkJSON || chunkType == chunkBIN:
+			v.add(SeverityError, "GLB_DUPLICATE_CHUNK", "", "chunk %d repeats the JSON or BIN chunk", index)
+		default:
+			v.add(SeverityWarning, "GLB_UNKNOWN_CHUNK_TYPE", "", "chunk %d has unknown type 0x%08x and is ignored", index, chunkType)
+		}
+		offset = start + align4(int(chunkLength))
+	}
+	if jsonChunk == nil {
+		if offset <= glbHeaderSize {
+			v.add(SeverityError, "GLB_LENGTH_TOO_SMALL", "", "the GLB has no chunks")
+		}
+		return nil, nil, false
+	}
+	return jsonChunk, binChunk, true
+}
+
+func (v *validator) buffers(binChunk []byte, isGLB bool, resolve Resolver) {
+	doc := v.model.Document
+	for i, buffer := range doc.Buffers {
+		pointer := fmt.Sprintf("/buffers/%d", i)
+		if buffer.ByteLength < 1 {
+			v.add(SeverityError, "VALUE_NOT_IN_RANGE", pointer+"/byteLength", "byteLength must be at least 1")
+			continue
+		}
+		var content []byte
+		switch {
+		case buffer.URI == "" && i == 0 && isGLB:
+			if binChunk == nil {
+				v.add(SeverityError, "BUFFER_MISSING_GLB_DATA", pointer, "the buffer refers to the BIN chunk, which the GLB does not have")
+				continue
+			}
+			if len(binChunk) > buffer.ByteLength+3 {
+				v.add(SeverityWarning, "BUFFER_GLB_CHUNK_TOO_BIG", pointer, "the BIN chunk has %d bytes, more than the %d the buffer declares", len(binChunk), buffer.ByteLength)
+			}
+			content = binChunk
+		case buffer.URI == "":
+			v.add(SeverityError, "UNDEFINED_PROPERTY", pointer+"/uri", "only the first buffer of a GLB may omit its uri")
+			continue
+		default:
+			var err error
+			if content, _, err = loadURI(buffer.URI, resolve); err != nil {
+				v.add(SeverityError, "IO_ERROR", pointer+"/uri", "%v", err)
+				continue
+			}
+		}
+		if len(content) < buffer.ByteLength {
+			v.add(SeverityError, "BUFFER_BYTE_LENGTH_MISMATCH", pointer+"/byteLength", "the buffer declares %d bytes but has %d", buffer.ByteLength, len(content))
+			continue
+		}
+		v.model.Buffers[i] = content[:buffer.ByteLength]
+	}
+}
+
+func (v *validator) bufferViews() {
+	doc := v.model.Document
+	v.viewOK = make([]bool, len(doc.BufferViews))
+	for i, view := range doc.BufferViews {
+		pointer := fmt.Sprintf("/bufferViews/%d", i)
+		if !v.reference(pointer+"/buffer", view.Buffer, len(doc.Buffers)) {
+			continue
+		}
+		switch {
+		case view.ByteLength < 1:
+			v.add(SeverityError, "VALUE_NOT_IN_RANGE", pointer+"/byteLength", "byteLength must be at least 1")
+			continue
+		case view.ByteOffset < 0:
+			v.add(SeverityError, "VALUE_NOT_IN_RANGE", pointer+"/byteOffset", "byteOffset must not be negative")
+			continue
+		case view.ByteStride != 0 && (view.ByteStride < 4 || view.ByteStride > 252 || view.ByteStride%4 != 0):
+			v.add(SeverityError, "BUFFER_VIEW_INVALID_BYTE_STRIDE", pointer+"/byteStride", "byteStride %d must be a multiple of 4 between 4 and 252", view.ByteStride)
+			continue
+		case view.ByteOffset+view.ByteLength > doc.Buffers[view.Buffer].ByteLength:
+			v.add(SeverityError, "BUFFER_VIEW_TOO_LONG", pointer, "the view runs past the end of buffer %d", view.Buffer)
+			continue
+		}
+		// Buffers that could not be loaded were reported already
+		v.viewOK[i] = v.model.Buffers[view.Buffer] != nil
+	}
+}
+
+func (v *validator) accessors() {
+	doc := v.model.Document
+	v.accessorOK = make([]bool, len(doc.Accessors))
+	for i, accessor := range doc.Accessors {
+		pointer := fmt.Sprintf("/accessors/%d", i)
+		components, typeOK := typeComponents[accessor.Type]
+		if !typeOK {
+			v.add(SeverityError, "INVALID_ENUM", pointer+"/type", "invalid accessor type %q", accessor.Type)
+		}
+		size, componentOK := componentSizes[accessor.ComponentType]
+		if !componentOK {
+			v.add(SeverityError, "INVALID_ENUM", pointer+"/componentType", "invalid component type %d", accessor.ComponentType)
+		}
+		if accessor.Count < 1 {
+			v.add(SeverityError, "VALUE_NOT_IN_RANGE", pointer+"/count", "count must be at least 1")
+		}
+		if !typeOK || !componentOK || accessor.Count < 1 {
+			continue
+		}
+		if accessor.Normalized && (accessor.ComponentType == ComponentFloat || accessor.ComponentType == ComponentUnsignedInt) {
+			v.add(SeverityError, "ACCESSOR_NORMALIZED_INVALID", pointer+"/normalized", "only byte and short accessors can be normalized")
+		}
+		if len(accessor.Min) > 0 && len(accessor.Min) != components {
+			v.add(SeverityError, "ARRAY_LENGTH_NOT_IN_LIST", pointer+"/min", "min has %d values, the accessor has %d components", len(accessor.Min), components)
+		}
+		if len(accessor.Max) > 0 && len(accessor.Max) != components {
+			v.add(SeverityError, "ARRAY_LENGTH_NOT_IN_LIST", pointer+"/max", "max has %d values, the accessor has %d components", len(accessor.Max), components)
+		}
+
+		ok := true
+		if accessor.BufferView != nil {
+			ok = v.accessorFits(pointer, accessor, *accessor.BufferView, accessor.ByteOffset, size, components, accessor.Count)
+			if ok && (doc.BufferViews[*accessor.BufferView].ByteOffset+accessor.ByteOffset)%size != 0 {
+				v.add(SeverityError, "ACCESSOR_TOTAL_OFFSET_ALIGNMENT", pointer+"/byteOffset", "the offset of the accessor in its buffer is not a multiple of %d", size)
+			}
+		}
+		if sparse := accessor.Sparse; sparse != nil {
+			if sparse.Count < 1 || sparse.Count > accessor.Count {
+				v.add(SeverityError, "VALUE_NOT_IN_RANGE", pointer+"/sparse/count", "sparse count must be between 1 and %d", accessor.Count)
+				ok = false
+			} else {
+				switch sparse.Indices.ComponentType {
+				case ComponentUnsignedByte, ComponentUnsignedShort, ComponentUnsignedInt:
+					ok = v.accessorFits(pointer+"/sparse/indices", accessor, sparse.Indices.BufferView, sparse.Indices.ByteOffset, componentSizes[sparse.Indices.ComponentType], 1, sparse.Count) && ok
+				default:
+					v.add(SeverityError, "INVALID_ENUM", pointer+"/sparse/indices/componentType", "invalid sparse indices component type %d", sparse.Indices.ComponentType)
+					ok = false
+				}
+				ok = v.accessorFits(pointer+"/sparse/values", accessor, sparse.Values.BufferView, sparse.Values.ByteOffset, size, components, sparse.Count) && ok
+			}
+		}
+		v.accessorOK[i] = ok
+		if ok {
+			v.accessorData(i, pointer)
+		}
+	}
+}
+
+// accessorFits checks that count elements at offset fit the buffer view,
+// and reports whether they can be read
+func (v *validator) accessorFits(pointer string, accessor Accessor, viewIndex int, offset int, size int, components int, count int) bool {
+	doc := v.model.Document
+	if !v.reference(pointer+"/bufferView", viewIndex, len(doc.BufferViews)) {
+		return false
+	}
+	view := doc.BufferViews[viewIndex]
+	elementSize := size * components
+	stride := view.ByteStride
+	if stride == 0 {
+		stride = elementSize
+	}
+	switch {
+	case offset < 0:
+		v.add(SeverityError, "VALUE_NOT_IN_RANGE", pointer+"/byteOffset", "byteOffset must not be negative")
+		return false
+	case stride < elementSize:
+		v.add(SeverityError, "ACCESSOR_SMALL_BYTESTRIDE", pointer, "byteStride %d of buffer view %d is smaller than the %d byte elements", stride, viewIndex, elementSize)
+		return false
+	case offset+stride*(count-1)+elementSize > view.ByteLength:
+		v.add(SeverityError, "ACCESSOR_TOO_LONG", pointer, "the elements run past the end of buffer view %d", viewIndex)
+		return false
+	}
+	return v.viewOK[viewIndex]
+}
+
+// accessorData checks that float accessors hold finite values and that the
+// declared bounds match the data
+func (v *validator) accessorData(index int, pointer string) {
+	accessor := v.model.Document.Accessors[index]
+	hasBounds := len(accessor.Min) > 0 || len(accessor.Max) > 0
+	if accessor.ComponentType != ComponentFloat && (!hasBounds || accessor.Normalized) {
+		return
+	}
+	values, components, err := v.model.Floats(index)
+	if err != nil {
+		v.add(SeverityError, "ACCESSOR_INVALID_DATA", pointer, "%v", err)
+		v.accessorOK[index] = false
+		return
+	}
+
+	low := make([]float64, components)
+	high := make([]float64, components)
+	for c := range low {
+		low[c], high[c] = math.Inf(1), math.Inf(-1)
+	}
+	for i, value := range values {
+		f := float64(value)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			v.add(SeverityError, "ACCESSOR_INVALID_FLOAT", pointer, "element %d holds %v", i/components, value)
+			v.accessorOK[index] = false
+			return
+		}
+		low[i%components] = math.Min(low[i%components], f)
+		high[i%components] = math.Max(high[i%components], f)
+	}
+	if accessor.Normalized {
+		return
+	}
+	for c := 0; c < components; c++ {
+		if len(accessor.Min) == components && !boundsMatch(accessor.Min[c], low[c]) {
+			v.add(SeverityError, "ACCESSOR_MIN_MISMATCH", fmt.Sprintf("%s/min/%d", pointer, c), "declared minimum %v does not match the actual minimum %v", accessor.Min[c], low[c])
+		}
+		if len(accessor.Max) == components && !boundsMatch(accessor.Max[c], high[c]) {
+			v.add(SeverityError, "ACCESSOR_MAX_MISMATCH", fmt.Sprintf("%s/max/%d", pointer, c), "declared maximum %v does not match the actual maximum %v", accessor.Max[c], high[c])
+		}
+	}
+}
+
+// boundsMatch compares a declared bound with the float32 data it describes,
+// allowing for exporters that print fewer digits than a float32 has
+func boundsMatch(declared float64, actual float64) bool {
+	return math.Abs(float64(float32(declared))-actual) <= 1e-6*math.Max(1, math.Abs(actual))
+}
+
+func (v *validator) nodes() {
+	doc := v.model.Document
+	v.parents = make([]int, len(doc.Nodes))
+	for i := range v.parents {
+		v.parents[i] = -1
+	}
+	for i, node := range doc.Nodes {
+		pointer := fmt.Sprintf("/nodes/%d", i)
+		if node.Mesh != nil && v.reference(pointer+"/mesh", *node.Mesh, len(doc.Meshes)) {
+			v.markUsed("meshes", *node.Mesh)
+		}
+		if node.Skin != nil {
+			v.reference(pointer+"/skin", *node.Skin, len(doc.Skins))
+		}
+		if node.Camera != nil {
+			v.reference(pointer+"/camera", *node.Camera, len(doc.Cameras))
+		}
+		for _, property := range []struct {
+			name           string
+			length, wanted int
+		}{{"matrix", len(node.Matrix), 16}, {"translation", len(node.Translation), 3}, {"rotation", len(node.Rotation), 4}, {"scale", len(node.Scale), 3}} {
+			if property.length != 0 && property.length != property.wanted {
+				v.add(SeverityError, "ARRAY_LENGTH_NOT_IN_LIST", pointer+"/"+property.name, "%s has %d values, not %d", property.name, property.length, property.wanted)
+			}
+		}
+		if len(node.Matrix) > 0 && len(node.Translation)+len(node.Rotation)+len(node.Scale) > 0 {
+			v.add(SeverityError, "NODE_MATRIX_TRS", pointer, "a node can have either a matrix or translation, rotation and scale")
+		}
+		if len(node.Rotation) == 4 {
+			var norm float64
+			for _, value := range node.Rotation {
+				norm += value * value
+			}
+			if math.Abs(math.Sqrt(norm)-1) > 0.00005 {
+				v.add(SeverityError, "ROTATION_NON_UNIT", pointer+"/rotation", "the rotation quaternion has length %v", math.Sqrt(norm))
+			}
+		}
+		for c, child := range node.Children {
+			if !v.reference(fmt.Sprintf("%s/children/%d", pointer, c), child, len(doc.Nodes)) {
+				continue
+			}
+			if v.parents[child] != -1 {
+				v.add(SeverityError, "NODE_PARENT_OVERRIDE", fmt.Sprintf("%s/children/%d", pointer, c), "node %d is already a child of node %d", child, v.parents[child])
+				continue
+			}
+			v.parents[child] = i
+		}
+	}
+
+	// Walking up from every node finds the cycles, which no root ends
+	state := make([]int8, len(doc.Nodes))
+	for i := range doc.Nodes {
+		var chain []int
+		j := i
+		for j != -1 && state[j] == 0 {
+			state[j] = 1
+			chain = append(chain, j)
+			j = v.parents[j]
+		}
+		if j != -1 && state[j] == 1 {
+			v.add(SeverityError, "NODE_LOOP", fmt.Sprintf("/nodes/%d", j), "node %d is its own ancestor", j)
+		}
+		for _, k := range chain {
+			state[k] = 2
+		}
+	}
+}
+
+func (v *validator) scenes() {
+	doc := v.model.Document
+	if doc.Scene != nil {
+		v.reference("/scene", *doc.Scene, len(doc.Scenes))
+	}
+	for s, scene := range doc.Scenes {
+		for n, node := range scene.Nodes {
+			pointer := fmt.Sprintf("/scenes/%d/nodes/%d", s, n)
+			if v.reference(pointer, node, len(doc.Nodes)) && v.parents[node] != -1 {
+				v.add(SeverityError, "SCENE_NON_ROOT_NODE", pointer, "node %d is a child of node %d and cannot be a scene root", node, v.parents[node])
+			}
+		}
+	}
+}
+
+func (v *validator) meshes() {
+	doc := v.model.Document
+	// Accessors shared by several primitives are only checked once
+	checkedNormals := map[int]bool{}
+	checkedIndices := map[int]bool{}
+	for m, mesh := range doc.Meshes {
+		if len(mesh.Primitives) == 0 {
+			v.add(SeverityError, "EMPTY_ENTITY", fmt.Sprintf("/meshes/%d/primitives", m), "the mesh has no primitives")
+		}
+		for p, primitive := range mesh.Primitives {
+			v.primitive(fmt.Sprintf("/meshes/%d/primitives/%d", m, p), primitive, checkedNormals, checkedIndices)
+		}
+	}
+}
+
+func (v *validator) primitive(pointer string, primitive Primitive, checkedNormals map[int]bool, checkedIndices map[int]bool) {
+	doc := v.model.Document
+	mode := primitive.PrimitiveMode()
+	if mode < ModePoints || mode > ModeTriangleFan {
+		v.add(SeverityError, "INVALID_ENUM", pointer+"/mode", "invalid primitive mode %d", mode)
+	}
+	if primitive.Material != nil && v.reference(pointer+"/material", *primitive.Material, len(doc.Materials)) {
+		v.markUsed("materials", *primitive.Material)
+	}
+
+	names := make([]string, 0, len(primitive.Attributes))
+	for name := range primitive.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	vertexCount := -1
+	for _, name := range names {
+		index := primitive.Attributes[name]
+		if !v.reference(pointer+"/attributes/"+name, index, len(doc.Accessors)) {
+			continue
+		}
+		count := doc.Accessors[index].Count
+		if vertexCount == -1 {
+			vertexCount = count
+		} else if count != vertexCount {
+			v.add(SeverityError, "MESH_PRIMITIVE_UNEQUAL_ACCESSOR_COUNT", pointer+"/attributes/"+name, "%s has %d elements, other attributes have %d", name, count, vertexCount)
+		}
+	}
+	for t, target := range primitive.Targets {
+		for name, index := range target {
+			v.reference(fmt.Sprintf("%s/targets/%d/%s", pointer, t, name), index, len(doc.Accessors))
+		}
+	}
+
+	position, hasPosition := primitive.Attributes["POSITION"]
+	if !hasPosition {
+		v.add(SeverityWarning, "MESH_PRIMITIVE_NO_POSITION", pointer+"/attributes", "the primitive has no POSITION attribute")
+	} else if position >= 0 && position < len(doc.Accessors) {
+		accessor := doc.Accessors[position]
+		quantized := slices.Contains(doc.ExtensionsUsed, "KHR_mesh_quantization")
+		if accessor.Type != "VEC3" || (accessor.ComponentType != ComponentFloat && !quantized) {
+			v.add(SeverityError, "MESH_PRIMITIVE_ATTRIBUTES_ACCESSOR_INVALID_FORMAT", pointer+"/attributes/POSITION", "POSITION must be a float VEC3 accessor")
+		} else if len(accessor.Min) != 3 || len(accessor.Max) != 3 {
+			v.add(SeverityError, "MESH_PRIMITIVE_POSITION_ACCESSOR_WITHOUT_BOUNDS", pointer+"/attributes/POSITION", "POSITION accessors must declare min and max")
+		}
+	}
+	if normal, ok := primitive.Attributes["NORMAL"]; ok && normal >= 0 && normal < len(doc.Accessors) && !checkedNormals[normal] {
+		checkedNormals[normal] = true
+		v.normals(pointer+"/attributes/NORMAL", normal)
+	}
+
+	elements := vertexCount
+	if primitive.Indices != nil && v.reference(pointer+"/indices", *primitive.Indices, len(doc.Accessors)) {
+		index := *primitive.Indices
+		accessor := doc.Accessors[index]
+		elements = accessor.Count
+		switch {
+		case accessor.Type != "SCALAR" || !slices.Contains([]int{ComponentUnsignedByte, ComponentUnsignedShort, ComponentUnsignedInt}, accessor.ComponentType):
+			v.add(SeverityError, "MESH_PRIMITIVE_INDICES_ACCESSOR_INVALID_FORMAT", pointer+"/indices", "indices must be an unsigned byte, short or int SCALAR accessor")
+		case v.accessorOK[index] && vertexCount >= 0 && !checkedIndices[index]:
+			checkedIndices[index] = true
+			v.indices(pointer+"/indices", index, vertexCount, mode)
+		}
+	}
+	if elements < 0 {
+		return
+	}
+	compatible := true
+	switch mode {
+	case ModeTriangles:
+		compatible = elements%3 == 0
+	case ModeLines:
+		compatible = elements%2 == 0
+	case ModeTriangleStrip, ModeTriangleFan:
+		compatible = elements >= 3
+	}
+	if !compatible {
+		v.add(SeverityWarning, "MESH_PRIMITIVE_INCOMPATIBLE_MODE", pointer, "%d elements do not make whole primitives of mode %d", elements, mode)
+	}
+}
+
+// normals checks that float normals are unit length
+func (v *validator) normals(pointer string, index int) {
+	accessor := v.model.Document.Accessors[index]
+	if !v.accessorOK[index] || accessor.Type != "VEC3" || accessor.ComponentType != ComponentFloat {
+		return
+	}
+	values, _, err := v.model.Floats(index)
+	if err != nil {
+		return
+	}
+	nonUnit := 0
+	for i := 0; i+2 < len(values); i += 3 {
+		x, y, z := float64(values[i]), float64(values[i+1]), float64(values[i+2])
+		if math.Abs(math.Sqrt(x*x+y*y+z*z)-1) > 0.0005 {
+			nonUnit++
+		}
+	}
+	if nonUnit > 0 {
+		v.add(SeverityError, "ACCESSOR_NON_UNIT", pointer, "%d of %d normals are not unit length", nonUnit, accessor.Count)
+	}
+}
+
+// indices checks that indices stay within the vertices of their primitive
+// and counts the triangles that collapse to a line or a point
+func (v *validator) indices(pointer string, index int, vertexCount int, mode int) {
+	values, err := v.model.Indices(index)
+	if err != nil {
+		return
+	}
+	outOfRange := 0
+	for _, value := range values {
+		if int64(value) >= int64(vertexCount) {
+			outOfRange++
+		}
+	}
+	if outOfRange > 0 {
+		v.add(SeverityError, "ACCESSOR_INDEX_OOB", pointer, "%d indices are not less than the vertex count %d", outOfRange, vertexCount)
+	}
+	if mode != ModeTriangles {
+		return
+	}
+	degenerate := 0
+	for i := 0; i+2 < len(values); i += 3 {
+		a, b, c := values[i], values[i+1], values[i+2]
+		if a == b || b == c || a == c {
+			degenerate++
+		}
+	}
+	if degenerate > 0 {
+		v.add(SeverityInfo, "ACCESSOR_INDEX_TRIANGLE_DEGENERATE", pointer, "%d triangles are degenerate", degenerate)
+	}
+}
+
+func (v *validator) materials() {
+	doc := v.model.Document
+	for i, material := range doc.Materials {
+		pointer := fmt.Sprintf("/materials/%d", i)
+		texture := func(name string, info *TextureInfo) {
+			if info != nil && v.reference(pointer+"/"+name+"/index", info.Index, len(doc.Textures)) {
+				v.markUsed("textures", info.Index)
+			}
+		}
+		if pbr := material.PBRMetallicRoughness; pbr != nil {
+			texture("pbrMetallicRoughness/baseColorTexture", pbr.BaseColorTexture)
+			texture("pbrMetallicRoughness/metallicRoughnessTexture", pbr.MetallicRoughnessTexture)
+			if len(pbr.BaseColorFactor) != 0 && len(pbr.BaseColorFactor) != 4 {
+				v.add(SeverityError, "ARRAY_LENGTH_NOT_IN_LIST", pointer+"/pbrMetallicRoughness/baseColorFactor", "baseColorFactor has %d values, not 4", len(pbr.BaseColorFactor))
+			}
+		}
+		texture("normalTexture", material.NormalTexture)
+		texture("occlusionTexture", material.OcclusionTexture)
+		texture("emissiveTexture", material.EmissiveTexture)
+		if len(material.EmissiveFactor) != 0 && len(material.EmissiveFactor) != 3 {
+			v.add(SeverityError, "ARRAY_LENGTH_NOT_IN_LIST", pointer+"/emissiveFactor", "emissiveFactor has %d values, not 3", len(material.EmissiveFactor))
+		}
+		switch material.AlphaMode {
+		case "", "OPAQUE", "MASK", "BLEND":
+		default:
+			v.add(SeverityError, "INVALID_ENUM", pointer+"/alphaMode", "invalid alpha mode %q", material.AlphaMode)
+		}
+		if material.AlphaCutoff != nil && material.AlphaMode != "MASK" {
+			v.add(SeverityWarning, "MATERIAL_ALPHA_CUTOFF_INVALID_MODE", pointer+"/alphaCutoff", "alphaCutoff only applies to the MASK alpha mode")
+		}
+	}
+}
+
+func (v *validator) textures() {
+	doc := v.model.Document
+	for i, texture := range doc.Textures {
+		pointer := fmt.Sprintf("/textures/%d", i)
+		if texture.Sampler != nil {
+			v.reference(pointer+"/sampler", *texture.Sampler, len(doc.Samplers))
+		}
+		if texture.Source != nil && v.reference(pointer+"/source", *texture.Source, len(doc.Images)) {
+			v.markUsed("images", *texture.Source)
+		}
+	}
+}
+
+func (v *validator) images(resolve Resolver) {
+	doc := v.model.Document
+	for i, image := range doc.Images {
+		pointer := fmt.Sprintf("/images/%d", i)
+		var data []byte
+		switch {
+		case image.BufferView != nil && image.URI != "":
+			v.add(SeverityError, "ONE_OF_MISMATCH", pointer, "an image has either a uri or a bufferView")
+			continue
+		case image.BufferView != nil:
+			if image.MimeType == "" {
+				v.add(SeverityError, "UNSATISFIED_DEPENDENCY", pointer+"/mimeType", "images stored in a buffer view need a mimeType")
+			}
+			if !v.reference(pointer+"/bufferView", *image.BufferView, len(doc.BufferViews)) || !v.viewOK[*image.BufferView] {
+				continue
+			}
+			view := doc.BufferViews[*image.BufferView]
+			data = v.model.Buffers[view.Buffer][view.ByteOffset : view.ByteOffset+view.ByteLength]
+		case image.URI != "":
+			var err error
+			if data, _, err = loadURI(image.URI, resolve); err != nil {
+				v.add(SeverityError, "IO_ERROR", pointer+"/uri", "%v", err)
+				continue
+			}
+		default:
+			v.add(SeverityError, "ONE_OF_MISMATCH", pointer, "the image has neither a uri nor a bufferView")
+			continue
+		}
+
+		detected := imageMimeType("", "", data)
+		switch {
+		case detected == "":
+			v.add(SeverityWarning, "IMAGE_UNRECOGNIZED_FORMAT", pointer, "the image is not a PNG, JPEG, WebP or KTX2")
+		case image.MimeType != "" && image.MimeType != detected:
+			v.add(SeverityError, "IMAGE_MIME_TYPE_INVALID", pointer+"/mimeType", "the image is declared %s but holds %s", image.MimeType, detected)
+		default:
+			if width, height := imageSize(data); width > 0 && (!powerOfTwo(width) || !powerOfTwo(height)) {
+				v.add(SeverityInfo, "IMAGE_NPOT_DIMENSIONS", pointer, "the image is %dx%d, not a power of two", width, height)
+			}
+		}
+	}
+}
+
+func powerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+// Skins and animations are kept as raw JSON by Document, these are the
+// fields the validator follows
+type skinReferences struct {
+	InverseBindMatrices *int  `json:"inverseBindMatrices"`
+	Skeleton            *int  `json:"skeleton"`
+	Joints              []int `json:"joints"`
+}
+
+type animationReferences struct {
+	Channels []struct {
+		Sampler int `json:"sampler"`
+		Target  struct {
+			Node *int   `json:"node"`
+			Path string `json:"path"`
+		} `json:"target"`
+	} `json:"channels"`
+	Samplers []struct {
+		Input         int    `json:"input"`
+		Output        int    `json:"output"`
+		Interpolation string `json:"interpolation"`
+	} `json:"samplers"`
+}
+
+func (v *validator) skins() {
+	doc := v.model.Document
+	for i, raw := range doc.Skins {
+		pointer := fmt.Sprintf("/skins/%d", i)
+		var skin skinReferences
+		if err := json.Unmarshal(raw, &skin); err != nil {
+			v.add(SeverityError, "TYPE_MISMATCH", pointer, "malformed skin: %v", err)
+			continue
+		}
+		if len(skin.Joints) == 0 {
+			v.add(SeverityError, "EMPTY_ENTITY", pointer+"/joints", "the skin has no joints")
+		}
+		for j, joint := range skin.Joints {
+			v.reference(fmt.Sprintf("%s/joints/%d", pointer, j), joint, len(doc.Nodes))
+		}
+		if skin.Skeleton != nil {
+			v.reference(pointer+"/skeleton", *skin.Skeleton, len(doc.Nodes))
+		}
+		if skin.InverseBindMatrices != nil && v.reference(pointer+"/inverseBindMatrices", *skin.InverseBindMatrices, len(doc.Accessors)) {
+			accessor := doc.Accessors[*skin.InverseBindMatrices]
+			if accessor.Type != "MAT4" || accessor.ComponentType != ComponentFloat || accessor.Count < len(skin.Joints) {
+				v.add(SeverityError, "SKIN_IBM_INVALID_FORMAT", pointer+"/inverseBindMatrices", "inverse bind matrices must be a float MAT4 accessor with one element per joint")
+			}
+		}
+	}
+}
+
+func (v *validator) animations() {
+	doc := v.model.Document
+	for i, raw := range doc.Animations {
+		pointer := fmt.Sprintf("/animations/%d", i)
+		var animation animationReferences
+		if err := json.Unmarshal(raw, &animation); err != nil {
+			v.add(SeverityError, "TYPE_MISMATCH", pointer, "malformed animation: %v", err)
+			continue
+		}
+		for c, channel := range animation.Channels {
+			channelPointer := fmt.Sprintf("%s/channels/%d", pointer, c)
+			v.reference(channelPointer+"/sampler", channel.Sampler, len(animation.Samplers))
+			if channel.Target.Node != nil {
+				v.reference(channelPointer+"/target/node", *channel.Target.Node, len(doc.Nodes))
+			}
+			switch channel.Target.Path {
+			case "translation", "rotation", "scale", "weights":
+			default:
+				v.add(SeverityError, "INVALID_ENUM", channelPointer+"/target/path", "invalid animation path %q", channel.Target.Path)
+			}
+		}
+		for s, sampler := range animation.Samplers {
+			samplerPointer := fmt.Sprintf("%s/samplers/%d", pointer, s)
+			if v.reference(samplerPointer+"/input", sampler.Input, len(doc.Accessors)) {
+				if input := doc.Accessors[sampler.Input]; input.Type != "SCALAR" || input.ComponentType != ComponentFloat {
+					v.add(SeverityError, "ANIMATION_SAMPLER_INPUT_ACCESSOR_INVALID_FORMAT", samplerPointer+"/input", "animation input must be a float SCALAR accessor")
+				}
+			}
+			v.reference(samplerPointer+"/output", sampler.Output, len(doc.Accessors))
+			switch sampler.Interpolation {
+			case "", "LINEAR", "STEP", "CUBICSPLINE":
+			default:
+				v.add(SeverityError, "INVALID_ENUM", samplerPointer+"/interpolation", "invalid interpolation %q", sampler.Interpolation)
+			}
+		}
+	}
+}
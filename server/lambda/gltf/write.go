@@ -0,0 +1,247 @@
+package gltf
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ImageLayout is where a written asset keeps its images
+type ImageLayout int
+
+const (
+	// ImageFiles writes every image to its own file next to the .gltf
+	ImageFiles ImageLayout = iota
+	// ImageDataURIs embeds every image in the JSON as a base64 data URI
+	ImageDataURIs
+	// ImagesInBuffer stores every image in the binary buffer, as GLBs do
+	ImagesInBuffer
+)
+
+type GLTFOptions struct {
+	// Name is the base name of the .gltf and of the files written next to it
+	Name   string
+	Images ImageLayout
+	// EmbedBuffer writes the binary buffer as a data URI instead of a .bin
+	EmbedBuffer bool
+}
+
+// bufferViewExtensions reference buffer views from places this package does
+// not rewrite, so views are never dropped or reordered when they are used
+var bufferViewExtensions = []string{"KHR_draco_mesh_compression", "EXT_structural_metadata", "EXT_feature_metadata"}
+
+// WriteGLB packs the model into a single binary file, with every buffer and
+// image in its BIN chunk
+func (m *Model) WriteGLB() ([]byte, error) {
+	doc, buffer, _, err := m.pack(ImagesInBuffer, "")
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return joinGLB(encoded, buffer), nil
+}
+
+// WriteGLTF writes the model as Name.gltf and the files it references, keyed
+// by their path relative to the .gltf
+func (m *Model) WriteGLTF(options GLTFOptions) (map[string][]byte, error) {
+	if options.Name == "" {
+		return nil, fmt.Errorf("a name is required to write a .gltf")
+	}
+	doc, buffer, files, err := m.pack(options.Images, options.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Buffers) > 0 {
+		if options.EmbedBuffer {
+			doc.Buffers[0].URI = encodeDataURI("application/octet-stream", buffer)
+		} else {
+			binName := options.Name + ".bin"
+			doc.Buffers[0].URI = binName
+			files[binName] = buffer
+		}
+	}
+
+	encoded, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files[options.Name+".gltf"] = encoded
+	return files, nil
+}
+
+// pack merges every buffer into one, with each view aligned to four bytes,
+// and moves images to the requested layout. Views no accessor references are
+// dropped unless an extension may reference them: those that only held images
+// are written again with the images, those Simplify replaced are not needed.
+func (m *Model) pack(layout ImageLayout, name string) (*Document, []byte, map[string][]byte, error) {
+	doc, err := m.cloneDocument()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	keepAll := usesAny(doc.ExtensionsUsed, bufferViewExtensions)
+	referenced := make([]bool, len(doc.BufferViews))
+	for _, accessor := range doc.Accessors {
+		if accessor.BufferView != nil {
+			referenced[*accessor.BufferView] = true
+		}
+		if accessor.Sparse != nil {
+			referenced[accessor.Sparse.Indices.BufferView] = true
+			referenced[accessor.Sparse.Values.BufferView] = true
+		}
+	}
+
+	var buffer []byte
+	appendAligned := func(data []byte) int {
+		for len(buffer)%4 != 0 {
+			buffer = append(buffer, 0)
+		}
+		offset := len(buffer)
+		buffer = append(buffer, data...)
+		return offset
+	}
+
+	remap := make([]int, len(doc.BufferViews))
+	var views []BufferView
+	for i, view := range doc.BufferViews {
+		remap[i] = -1
+		if !referenced[i] && !keepAll {
+			continue
+		}
+		data := m.Buffers[view.Buffer][view.ByteOffset : view.ByteOffset+view.ByteLength]
+		view.Buffer = 0
+		view.ByteOffset = appendAligned(data)
+		remap[i] = len(views)
+		views = append(views, view)
+	}
+	for i := range doc.Accessors {
+		accessor := &doc.Accessors[i]
+		if accessor.BufferView != nil {
+			accessor.BufferView = Int(remap[*accessor.BufferView])
+		}
+		if accessor.Sparse != nil {
+			accessor.Sparse.Indices.BufferView = remap[accessor.Sparse.Indices.BufferView]
+			accessor.Sparse.Values.BufferView = remap[accessor.Sparse.Values.BufferView]
+		}
+	}
+
+	files := map[string][]byte{}
+	names := newFileNames(name)
+	for i := range doc.Images {
+		image := &doc.Images[i]
+		data := m.Images[i]
+		if layout == ImagesInBuffer && image.BufferView != nil && remap[*image.BufferView] >= 0 {
+			image.BufferView = Int(remap[*image.BufferView])
+			continue
+		}
+		image.BufferView = nil
+		image.URI = ""
+		switch layout {
+		case ImagesInBuffer:
+			if data.MimeType == "" {
+				return nil, nil, nil, fmt.Errorf("%w: image %d has an unknown media type", ErrUnsupported, i)
+			}
+			views = append(views, BufferView{Buffer: 0, ByteOffset: appendAligned(data.Data), ByteLength: len(data.Data)})
+			image.BufferView = Int(len(views) - 1)
+			image.MimeType = data.MimeType
+		case ImageDataURIs:
+			mimeType := data.MimeType
+			if mimeType == "" {
+				mimeType = "application/octet-stream"
+			}
+			image.URI = encodeDataURI(mimeType, data.Data)
+		case ImageFiles:
+			fileName := names.imageName(i, image.Name, data)
+			files[fileName] = data.Data
+			image.URI = fileName
+		}
+	}
+
+	doc.BufferViews = views
+	doc.Buffers = nil
+	if len(buffer) > 0 {
+		doc.Buffers = []Buffer{{ByteLength: len(buffer)}}
+	}
+	return doc, buffer, files, nil
+}
+
+// cloneDocument copies the document so packing never changes the model
+func (m *Model) cloneDocument() (*Document, error) {
+	encoded, err := json.Marshal(m.Document)
+	if err != nil {
+		return nil, err
+	}
+	var doc Document
+	if err := json.Unmarshal(encoded, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func usesAny(used []string, extensions []string) bool {
+	for _, name := range used {
+		for _, extension := range extensions {
+			if name == extension {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+var mimeExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/webp": ".webp",
+	"image/ktx2": ".ktx2",
+}
+
+// fileNames hands out image file names that are safe to use as URIs without
+// escaping and never collide with each other or with the .gltf and .bin
+type fileNames struct {
+	base  string
+	taken map[string]bool
+}
+
+func newFileNames(base string) *fileNames {
+	return &fileNames{base: base, taken: map[string]bool{
+		strings.ToLower(base + ".gltf"): true,
+		strings.ToLower(base + ".bin"):  true,
+	}}
+}
+
+func (n *fileNames) imageName(index int, imageName string, data ImageData) string {
+	extension := mimeExtensions[data.MimeType]
+	stem := ""
+	if data.Path != "" {
+		base := path.Base(data.Path)
+		if extension == "" {
+			extension = path.Ext(base)
+		}
+		stem = strings.TrimSuffix(base, path.Ext(base))
+	} else if imageName != "" {
+		stem = imageName
+	}
+	stem = strings.Trim(unsafeFileNameChars.ReplaceAllString(stem, "_"), "._")
+	if stem == "" {
+		stem = fmt.Sprintf("%s_image%d", n.base, index)
+	}
+	extension = unsafeFileNameChars.ReplaceAllString(extension, "")
+	if extension == "" || extension == "." {
+		extension = ".bin"
+	}
+
+	candidate := stem + extension
+	for suffix := 2; n.taken[strings.ToLower(candidate)]; suffix++ {
+		candidate = fmt.Sprintf("%s_%d%s", stem, suffix, extension)
+	}
+	n.taken[strings.ToLower(candidate)] = true
+	return candidate
+}
@@ -3,6 +3,7 @@ package helpers
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -12,6 +13,28 @@ type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
+// apiKeyTenants reads the api_key_tenants environment variable, a JSON object
+// from API key to the tenant it belongs to. Its keys are accepted next to
+// api_key_value.
+func apiKeyTenants() map[string]string {
+	value := os.Getenv("api_key_tenants")
+	if value == "" {
+		return nil
+	}
+	var tenants map[string]string
+	if err := json.Unmarshal([]byte(value), &tenants); err != nil {
+		log.Printf("Invalid api_key_tenants, only api_key_value is accepted: %v", err)
+		return nil
+	}
+	return tenants
+}
+
+// APIKeyTenant is the tenant of an API key in api_key_tenants, empty for
+// api_key_value
+func APIKeyTenant(apiKey string) string {
+	return apiKeyTenants()[apiKey]
+}
+
 func validateAPIKey(apiKey string) (int, string) {
 	fmt.Printf("Validating API key. Received key: %s, Expected key: %s\n", apiKey, os.Getenv("api_key_value"))
 
@@ -21,7 +44,7 @@ func validateAPIKey(apiKey string) (int, string) {
 		return 401, string(body)
 	}
 
-	if apiKey != os.Getenv("api_key_value") {
+	if _, ok := apiKeyTenants()[apiKey]; !ok && apiKey != os.Getenv("api_key_value") {
 		errorResp := ErrorResponse{Error: fmt.Sprintf("Invalid API key. Received: %s", apiKey)}
 		body, _ := json.Marshal(errorResp)
 		return 403, string(body)
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/converters"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// ConversionMessage is a job queued by model-loader-util for the http backend
+type ConversionMessage struct {
+	ConnectionID string `json:"connectionId"`
+	JobType      string `json:"jobType"`
+	JobID        string `json:"jobId"`
+	FromFileType string `json:"fromFileType"`
+	ToFileType   string `json:"toFileType"`
+	ModelID      string `json:"modelId"`
+	S3Key        string `json:"s3Key"`
+	SourceETag   string `json:"sourceEtag"`
+	Converter    string `json:"converter"`
+	// Options arrive as JSON, already checked against the converter's schema
+	Options string `json:"options"`
+	Attempt string `json:"attempt"`
+}
+
+// ConversionRequest is what the external converter receives. It downloads the
+// source from SourceURL and answers with the converted file as the body.
+type ConversionRequest struct {
+	JobID        string         `json:"jobId"`
+	Converter    string         `json:"converter"`
+	FromFileType string         `json:"fromFileType"`
+	ToFileType   string         `json:"toFileType"`
+	ModelID      string         `json:"modelId"`
+	SourceURL    string         `json:"sourceUrl"`
+	SourceETag   string         `json:"sourceEtag,omitempty"`
+	Options      map[string]any `json:"options,omitempty"`
+}
+
+// NotificationMessage is what the notification lambda expects from every
+// backend, the Blender worker and the native converter send the same fields
+type NotificationMessage struct {
+	ConnectionID string     `json:"connectionId"`
+	JobType      string     `json:"jobType"`
+	JobID        string     `json:"jobId"`
+	JobStatus    string     `json:"jobStatus"`
+	FromFileType string     `json:"fromFileType"`
+	ToFileType   string     `json:"toFileType"`
+	ModelID      string     `json:"modelId"`
+	S3Key        string     `json:"s3Key"`
+	NewS3Key     string     `json:"newS3Key,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	Artifacts    []Artifact `json:"artifacts,omitempty"`
+	Attempt      string     `json:"attempt,omitempty"`
+}
+
+type Artifact struct {
+	Path   string `json:"path"`
+	S3Key  string `json:"s3Key"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+const (
+	// sourceURLExpiry leaves the converter the whole request to download the
+	// source
+	sourceURLExpiry = 5 * time.Minute
+	// maxOutputSize caps the converted file held in memory
+	maxOutputSize = 512 << 20
+	// maxErrorBody is how much of a failed response ends up in the job's error
+	maxErrorBody = 512
+)
+
+// httpClient stays under the Lambda's 300 second timeout, so a converter
+// that hangs fails the job instead of timing out the invocation
+var httpClient = &http.Client{Timeout: 270 * time.Second}
+
+type S3Client interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+type S3PresignClient interface {
+	PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+}
+
+type SQSClient interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+}
+
+// jobIsCancelled reports whether the job was cancelled through
+// POST /jobs/{jobId}/cancel
+func jobIsCancelled(ctx context.Context, dynamoClient DynamoDBClient, jobHistoryTable string, jobID string) (bool, error) {
+	if jobHistoryTable == "" || jobID == "" {
+		return false, nil
+	}
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:            aws.String(jobHistoryTable),
+		Key:                  map[string]types.AttributeValue{"jobId": &types.AttributeValueMemberS{Value: jobID}},
+		ProjectionExpression: aws.String("jobStatus"),
+		ConsistentRead:       aws.Bool(true),
+	})
+	if err != nil {
+		return false, err
+	}
+	status, ok := result.Item["jobStatus"].(*types.AttributeValueMemberS)
+	return ok && status.Value == "cancelled", nil
+}
+
+// newConversionRequest presigns the source for the converter, which can
+// compare the ETag of what it downloads with SourceETag
+func newConversionRequest(ctx context.Context, presignClient S3PresignClient, bucket string, message ConversionMessage) (ConversionRequest, error) {
+	input := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(message.S3Key)}
+	presigned, err := presignClient.PresignGetObject(ctx, input, s3.WithPresignExpires(sourceURLExpiry))
+	if err != nil {
+		return ConversionRequest{}, fmt.Errorf("failed to presign %s: %w", message.S3Key, err)
+	}
+
+	request := ConversionRequest{
+		JobID:        message.JobID,
+		Converter:    message.Converter,
+		FromFileType: message.FromFileType,
+		ToFileType:   message.ToFileType,
+		ModelID:      message.ModelID,
+		SourceURL:    presigned.URL,
+		SourceETag:   message.SourceETag,
+	}
+	if message.Options != "" {
+		if err := json.Unmarshal([]byte(message.Options), &request.Options); err != nil {
+			return ConversionRequest{}, fmt.Errorf("malformed options: %w", err)
+		}
+	}
+	return request, nil
+}
+
+// Output is the converted file a converter answered with
+type Output struct {
+	Data        []byte
+	ContentType string
+}
+
+// postJob posts the job to the converter's endpoint and returns the
+// converted file
+func postJob(ctx context.Context, endpoint string, request ConversionRequest) (Output, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return Output{}, err
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Output{}, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	response, err := httpClient.Do(httpRequest)
+	if err != nil {
+		return Output{}, fmt.Errorf("request to %s failed: %w", endpoint, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBody))
+		return Output{}, fmt.Errorf("converter answered %d: %s", response.StatusCode, bytes.TrimSpace(message))
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxOutputSize+1))
+	if err != nil {
+		return Output{}, fmt.Errorf("failed to read the converted file: %w", err)
+	}
+	if len(data) > maxOutputSize {
+		return Output{}, fmt.Errorf("converted file is larger than %d bytes", maxOutputSize)
+	}
+	if len(data) == 0 {
+		return Output{}, fmt.Errorf("converter answered without a file")
+	}
+	contentType := response.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return Output{Data: data, ContentType: contentType}, nil
+}
+
+// uploadOutput stores the converted file under the
+// {toFileType}/{modelId}.{toFileType} key the other backends use for single
+// file outputs
+func uploadOutput(ctx context.Context, s3Client S3Client, bucket string, message ConversionMessage, output Output) (string, Artifact, error) {
+	filePath := fmt.Sprintf("%s.%s", message.ModelID, message.ToFileType)
+	key := fmt.Sprintf("%s/%s", message.ToFileType, filePath)
+	log.Printf("Uploading %s to s3://%s/%s", filePath, bucket, key)
+	_, err := s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(output.Data),
+		ContentType: aws.String(output.ContentType),
+	})
+	if err != nil {
+		return "", Artifact{}, fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	digest := sha256.Sum256(output.Data)
+	return key, Artifact{Path: filePath, S3Key: key, Size: int64(len(output.Data)), SHA256: hex.EncodeToString(digest[:])}, nil
+}
+
+func sendNotification(ctx context.Context, sqsClient SQSClient, queueURL string, notification NotificationMessage) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	_, err = sqsClient.SendMessage(ctx, &sqs.SendMessageInput{QueueUrl: aws.String(queueURL), MessageBody: aws.String(string(body))})
+	if err != nil {
+		return fmt.Errorf("failed to send notification for job %s: %w", notification.JobID, err)
+	}
+	log.Printf("Notification sent for job %s: %s", notification.JobID, notification.JobStatus)
+	return nil
+}
+
+// processMessage dispatches one job and returns its notification, or nil when
+// the job was cancelled and the cancel request already recorded its final
+// status
+func processMessage(ctx context.Context, message ConversionMessage, s3Client S3Client, presignClient S3PresignClient, dynamoClient DynamoDBClient) (*NotificationMessage, error) {
+	bucket := os.Getenv("model_s3_bucket")
+	jobHistoryTable := os.Getenv("job_history_table")
+
+	if cancelled, err := jobIsCancelled(ctx, dynamoClient, jobHistoryTable, message.JobID); err != nil {
+		return nil, fmt.Errorf("failed to check job status: %w", err)
+	} else if cancelled {
+		log.Printf("Job %s was cancelled while queued, skipping", message.JobID)
+		return nil, nil
+	}
+
+	// The endpoint comes from the registry rather than the message, so a
+	// converter moved since the job was queued is reached at its new address
+	converter, ok := converters.Default.Lookup(message.FromFileType, message.ToFileType)
+	if !ok || converter.Backend != converters.BackendHTTP || converter.Name != message.Converter {
+		return nil, fmt.Errorf("no http converter %q is registered for %s to %s", message.Converter, message.FromFileType, message.ToFileType)
+	}
+	request, err := newConversionRequest(ctx, presignClient, bucket, message)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Posting job %s to the %s converter", message.JobID, converter.Name)
+	output, err := postJob(ctx, converter.Endpoint, request)
+	if err != nil {
+		return nil, fmt.Errorf("%s conversion failed: %w", converter.Name, err)
+	}
+
+	if cancelled, err := jobIsCancelled(ctx, dynamoClient, jobHistoryTable, message.JobID); err != nil {
+		return nil, fmt.Errorf("failed to check job status: %w", err)
+	} else if cancelled {
+		log.Printf("Job %s was cancelled during conversion, discarding output", message.JobID)
+		return nil, nil
+	}
+
+	newS3Key, artifact, err := uploadOutput(ctx, s3Client, bucket, message, output)
+	if err != nil {
+		return nil, err
+	}
+	notification := newNotification(message, "completed")
+	notification.NewS3Key = newS3Key
+	notification.Artifacts = []Artifact{artifact}
+	return &notification, nil
+}
+
+func newNotification(message ConversionMessage, jobStatus string) NotificationMessage {
+	return NotificationMessage{
+		ConnectionID: message.ConnectionID,
+		JobType:      message.JobType,
+		JobID:        message.JobID,
+		JobStatus:    jobStatus,
+		FromFileType: message.FromFileType,
+		ToFileType:   message.ToFileType,
+		ModelID:      message.ModelID,
+		S3Key:        message.S3Key,
+		Attempt:      message.Attempt,
+	}
+}
+
+func HandlerWithClients(ctx context.Context, sqsEvent events.SQSEvent, s3Client S3Client, presignClient S3PresignClient, sqsClient SQSClient, dynamoClient DynamoDBClient) error {
+	notificationQueueURL := os.Getenv("notification_queue_url")
+	if notificationQueueURL == "" {
+		return fmt.Errorf("notification_queue_url environment variable is not set")
+	}
+	if os.Getenv("model_s3_bucket") == "" {
+		return fmt.Errorf("model_s3_bucket environment variable is not set")
+	}
+
+	for _, record := range sqsEvent.Records {
+		var message ConversionMessage
+		if err := json.Unmarshal([]byte(record.Body), &message); err != nil {
+			log.Printf("Error unmarshaling job message: %v", err)
+			continue
+		}
+
+		notification, err := processMessage(ctx, message, s3Client, presignClient, dynamoClient)
+		if err != nil {
+			log.Printf("Error processing job %s: %v", message.JobID, err)
+			failed := newNotification(message, "failed")
+			failed.Error = err.Error()
+			notification = &failed
+		}
+		if notification == nil {
+			continue
+		}
+		// A lost notification would leave the job pending forever, so the
+		// message is redelivered instead
+		if err := sendNotification(ctx, sqsClient, notificationQueueURL, *notification); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func handler(ctx context.Context, sqsEvent events.SQSEvent) error {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to load SDK config: %v", err)
+	}
+	s3Client := s3.NewFromConfig(cfg)
+	return HandlerWithClients(ctx, sqsEvent, s3Client, s3.NewPresignClient(s3Client), sqs.NewFromConfig(cfg), dynamodb.NewFromConfig(cfg))
+}
+
+func main() {
+	lambda.Start(handler)
+}
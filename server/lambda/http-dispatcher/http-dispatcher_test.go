@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/converters"
+
+	"github.com/aws/aws-lambda-go/events"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+const testNotificationQueueURL = "https://sqs.us-east-1.amazonaws.com/123456789012/test-notification-queue"
+
+type mockS3Client struct {
+	puts         map[string][]byte
+	contentTypes map[string]string
+}
+
+func (m *mockS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, _ := io.ReadAll(params.Body)
+	if m.puts == nil {
+		m.puts = map[string][]byte{}
+		m.contentTypes = map[string]string{}
+	}
+	m.puts[*params.Key] = data
+	m.contentTypes[*params.Key] = *params.ContentType
+	return &s3.PutObjectOutput{}, nil
+}
+
+type mockS3PresignClient struct{}
+
+func (m *mockS3PresignClient) PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+	return &v4.PresignedHTTPRequest{URL: "https://test-bucket.s3.amazonaws.com/" + *params.Key + "?X-Amz-Signature=test"}, nil
+}
+
+type mockSQSClient struct {
+	sendMessageInputs []*sqs.SendMessageInput
+}
+
+func (m *mockSQSClient) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	m.sendMessageInputs = append(m.sendMessageInputs, params)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+type mockDynamoDBClient struct {
+	jobStatus string
+}
+
+func (m *mockDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if m.jobStatus == "" {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{"jobStatus": &types.AttributeValueMemberS{Value: m.jobStatus}}}, nil
+}
+
+func setupTestEnv(t *testing.T) {
+	t.Setenv("notification_queue_url", testNotificationQueueURL)
+	t.Setenv("model_s3_bucket", "test-bucket")
+	t.Setenv("job_history_table", "test-job-history")
+}
+
+// useHTTPConverter registers an fbx to glb http converter posting to the
+// handler for one test
+func useHTTPConverter(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	original, _ := converters.Default.Lookup("fbx", "glb")
+	assert.NoError(t, converters.Default.Register(converters.Converter{
+		From:     "fbx",
+		To:       "glb",
+		Backend:  converters.BackendHTTP,
+		Name:     "acme",
+		Endpoint: server.URL + "/convert",
+	}))
+	t.Cleanup(func() { converters.Default.Register(original) })
+}
+
+func newEvent(t *testing.T, message ConversionMessage) events.SQSEvent {
+	body, err := json.Marshal(message)
+	assert.NoError(t, err)
+	return events.SQSEvent{Records: []events.SQSMessage{{Body: string(body)}}}
+}
+
+func newMessage() ConversionMessage {
+	return ConversionMessage{
+		ConnectionID: "test-connection",
+		JobType:      "conversion",
+		JobID:        "test-job",
+		FromFileType: "fbx",
+		ToFileType:   "glb",
+		ModelID:      "model-1",
+		S3Key:        "fbx/model-1.fbx",
+		SourceETag:   `"etag"`,
+		Converter:    "acme",
+		Options:      `{"scale":2}`,
+		Attempt:      "2",
+	}
+}
+
+func notificationOf(t *testing.T, mockSQS *mockSQSClient) NotificationMessage {
+	assert.Len(t, mockSQS.sendMessageInputs, 1)
+	var notification NotificationMessage
+	assert.NoError(t, json.Unmarshal([]byte(*mockSQS.sendMessageInputs[0].MessageBody), &notification))
+	assert.Equal(t, testNotificationQueueURL, *mockSQS.sendMessageInputs[0].QueueUrl)
+	return notification
+}
+
+func TestHandler_PostsTheJobAndUploadsTheResult(t *testing.T) {
+	setupTestEnv(t)
+	var received ConversionRequest
+	useHTTPConverter(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/convert", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Header().Set("Content-Type", "model/gltf-binary")
+		w.Write([]byte("glTF converted"))
+	})
+
+	mockS3 := &mockS3Client{}
+	mockSQS := &mockSQSClient{}
+	err := HandlerWithClients(context.Background(), newEvent(t, newMessage()), mockS3, &mockS3PresignClient{}, mockSQS, &mockDynamoDBClient{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, ConversionRequest{
+		JobID:        "test-job",
+		Converter:    "acme",
+		FromFileType: "fbx",
+		ToFileType:   "glb",
+		ModelID:      "model-1",
+		SourceURL:    "https://test-bucket.s3.amazonaws.com/fbx/model-1.fbx?X-Amz-Signature=test",
+		SourceETag:   `"etag"`,
+		Options:      map[string]any{"scale": 2.0},
+	}, received)
+	assert.Equal(t, []byte("glTF converted"), mockS3.puts["glb/model-1.glb"])
+	assert.Equal(t, "model/gltf-binary", mockS3.contentTypes["glb/model-1.glb"])
+
+	notification := notificationOf(t, mockSQS)
+	assert.Equal(t, "completed", notification.JobStatus)
+	assert.Equal(t, "glb/model-1.glb", notification.NewS3Key)
+	assert.Equal(t, "2", notification.Attempt)
+	assert.Len(t, notification.Artifacts, 1)
+	assert.Equal(t, "model-1.glb", notification.Artifacts[0].Path)
+	assert.Equal(t, int64(len("glTF converted")), notification.Artifacts[0].Size)
+	assert.Len(t, notification.Artifacts[0].SHA256, 64)
+}
+
+func TestHandler_ConverterError_FailsTheJob(t *testing.T) {
+	setupTestEnv(t)
+	useHTTPConverter(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unsupported FBX version", http.StatusUnprocessableEntity)
+	})
+
+	mockS3 := &mockS3Client{}
+	mockSQS := &mockSQSClient{}
+	err := HandlerWithClients(context.Background(), newEvent(t, newMessage()), mockS3, &mockS3PresignClient{}, mockSQS, &mockDynamoDBClient{})
+	assert.NoError(t, err)
+
+	assert.Empty(t, mockS3.puts)
+	notification := notificationOf(t, mockSQS)
+	assert.Equal(t, "failed", notification.JobStatus)
+	assert.Contains(t, notification.Error, "converter answered 422: unsupported FBX version")
+}
+
+func TestHandler_ConverterNotRegistered_FailsTheJob(t *testing.T) {
+	setupTestEnv(t)
+	useHTTPConverter(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("no request expected")
+	})
+	message := newMessage()
+	message.Converter = "renamed"
+
+	mockSQS := &mockSQSClient{}
+	err := HandlerWithClients(context.Background(), newEvent(t, message), &mockS3Client{}, &mockS3PresignClient{}, mockSQS, &mockDynamoDBClient{})
+	assert.NoError(t, err)
+
+	notification := notificationOf(t, mockSQS)
+	assert.Equal(t, "failed", notification.JobStatus)
+	assert.Contains(t, notification.Error, `no http converter "renamed" is registered for fbx to glb`)
+}
+
+func TestHandler_CancelledJob_IsSkipped(t *testing.T) {
+	setupTestEnv(t)
+	useHTTPConverter(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("no request expected")
+	})
+
+	mockS3 := &mockS3Client{}
+	mockSQS := &mockSQSClient{}
+	err := HandlerWithClients(context.Background(), newEvent(t, newMessage()), mockS3, &mockS3PresignClient{}, mockSQS, &mockDynamoDBClient{jobStatus: "cancelled"})
+	assert.NoError(t, err)
+
+	assert.Empty(t, mockS3.puts)
+	assert.Empty(t, mockSQS.sendMessageInputs)
+}
+
+func TestPostJob_RejectsEmptyAnswers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	_, err := postJob(context.Background(), server.URL, ConversionRequest{JobID: "test-job"})
+	assert.ErrorContains(t, err, "converter answered without a file")
+}
@@ -0,0 +1,185 @@
+package mesh
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/gltf"
+)
+
+// FromGLTF flattens the triangles of the default scene of a glTF model into
+// one mesh in meters, with node transforms applied and turned Z up. Points
+// and lines are left out. Vertex colors are kept when any primitive has them.
+func FromGLTF(model *gltf.Model) (*Mesh, error) {
+	f := &flattener{model: model, mesh: &Mesh{Unit: "meter"}, visited: make([]bool, len(model.Document.Nodes))}
+	for _, root := range model.Document.SceneRoots() {
+		if err := f.node(root, gltf.Identity); err != nil {
+			return nil, err
+		}
+	}
+	return f.mesh, nil
+}
+
+type flattener struct {
+	model   *gltf.Model
+	mesh    *Mesh
+	visited []bool
+}
+
+func (f *flattener) node(index int, parent [16]float64) error {
+	doc := f.model.Document
+	if index < 0 || index >= len(doc.Nodes) {
+		return fmt.Errorf("%w: missing node %d", gltf.ErrInvalid, index)
+	}
+	if f.visited[index] {
+		return fmt.Errorf("%w: node %d appears more than once in the scene", gltf.ErrInvalid, index)
+	}
+	f.visited[index] = true
+	node := doc.Nodes[index]
+	world := gltf.Multiply(parent, node.LocalMatrix())
+
+	if node.Mesh != nil {
+		if *node.Mesh < 0 || *node.Mesh >= len(doc.Meshes) {
+			return fmt.Errorf("%w: node %d references missing mesh %d", gltf.ErrInvalid, index, *node.Mesh)
+		}
+		for _, primitive := range doc.Meshes[*node.Mesh].Primitives {
+			if err := f.primitive(primitive, world); err != nil {
+				return fmt.Errorf("mesh %d: %w", *node.Mesh, err)
+			}
+		}
+	}
+	for _, child := range node.Children {
+		if err := f.node(child, world); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *flattener) primitive(primitive gltf.Primitive, world [16]float64) error {
+	position, ok := primitive.Attributes["POSITION"]
+	if !ok {
+		return nil
+	}
+	triangles, err := f.model.Triangles(primitive)
+	if err != nil || len(triangles) == 0 {
+		return err
+	}
+	points, _, err := f.model.Floats(position)
+	if err != nil {
+		return err
+	}
+
+	part := &Mesh{Positions: make([]float32, 0, len(points))}
+	m := world
+	for i := 0; i+2 < len(points); i += 3 {
+		x, y, z := float64(points[i]), float64(points[i+1]), float64(points[i+2])
+		wx := m[0]*x + m[4]*y + m[8]*z + m[12]
+		wy := m[1]*x + m[5]*y + m[9]*z + m[13]
+		wz := m[2]*x + m[6]*y + m[10]*z + m[14]
+		// Y up to Z up
+		part.Positions = append(part.Positions, float32(wx), float32(-wz), float32(wy))
+	}
+	// Mirroring transforms turn triangles inside out
+	determinant := m[0]*(m[5]*m[10]-m[9]*m[6]) - m[4]*(m[1]*m[10]-m[9]*m[2]) + m[8]*(m[1]*m[6]-m[5]*m[2])
+	for i := 0; i+2 < len(triangles); i += 3 {
+		if determinant < 0 {
+			part.Triangles = append(part.Triangles, triangles[i], triangles[i+2], triangles[i+1])
+		} else {
+			part.Triangles = append(part.Triangles, triangles[i], triangles[i+1], triangles[i+2])
+		}
+	}
+	if color, ok := primitive.Attributes["COLOR_0"]; ok {
+		if values, components, err := f.model.Floats(color); err == nil && components >= 3 && len(values)/components == part.VertexCount() {
+			part.Colors = make([]uint8, 0, len(part.Positions))
+			for i := 0; i+2 < len(values); i += components {
+				for _, value := range values[i : i+3] {
+					part.Colors = append(part.Colors, uint8(math.Round(math.Max(0, math.Min(1, float64(value)))*255)))
+				}
+			}
+		}
+	}
+	if err := part.Validate(); err != nil {
+		return err
+	}
+	f.mesh.Append(part)
+	return nil
+}
+
+// ToGLTF returns the mesh as a glTF model with a single node, turned Y up.
+// glTF is in meters, so meshes should be converted to meters first.
+func ToGLTF(m *Mesh) (*gltf.Model, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	var buffer []byte
+	doc := &gltf.Document{
+		Asset:  gltf.Asset{Version: "2.0"},
+		Scene:  gltf.Int(0),
+		Scenes: []gltf.Scene{{Nodes: []int{0}}},
+		Nodes:  []gltf.Node{{Name: "mesh", Mesh: gltf.Int(0)}},
+	}
+	attributes := map[string]int{}
+	addAccessor := func(data []byte, target int, accessor gltf.Accessor) int {
+		// Every view holds four byte components, so views stay aligned
+		doc.BufferViews = append(doc.BufferViews, gltf.BufferView{ByteOffset: len(buffer), ByteLength: len(data), Target: target})
+		buffer = append(buffer, data...)
+		accessor.BufferView = gltf.Int(len(doc.BufferViews) - 1)
+		doc.Accessors = append(doc.Accessors, accessor)
+		return len(doc.Accessors) - 1
+	}
+
+	// Z up to Y up
+	positions := make([]float32, 0, len(m.Positions))
+	for i := 0; i+2 < len(m.Positions); i += 3 {
+		positions = append(positions, m.Positions[i], m.Positions[i+2], -m.Positions[i+1])
+	}
+	minimum, maximum := []float64{0, 0, 0}, []float64{0, 0, 0}
+	if len(positions) > 0 {
+		for axis := 0; axis < 3; axis++ {
+			minimum[axis], maximum[axis] = math.Inf(1), math.Inf(-1)
+		}
+		for i := 0; i+2 < len(positions); i += 3 {
+			for axis := 0; axis < 3; axis++ {
+				minimum[axis] = math.Min(minimum[axis], float64(positions[i+axis]))
+				maximum[axis] = math.Max(maximum[axis], float64(positions[i+axis]))
+			}
+		}
+	}
+	attributes["POSITION"] = addAccessor(float32Bytes(positions), arrayBufferTarget, gltf.Accessor{
+		ComponentType: gltf.ComponentFloat, Count: m.VertexCount(), Type: "VEC3", Min: minimum, Max: maximum,
+	})
+	if m.Colors != nil {
+		colors := make([]float32, len(m.Colors))
+		for i, value := range m.Colors {
+			colors[i] = float32(value) / 255
+		}
+		attributes["COLOR_0"] = addAccessor(float32Bytes(colors), arrayBufferTarget, gltf.Accessor{
+			ComponentType: gltf.ComponentFloat, Count: m.VertexCount(), Type: "VEC3",
+		})
+	}
+	indices := make([]byte, 0, len(m.Triangles)*4)
+	for _, index := range m.Triangles {
+		indices = binary.LittleEndian.AppendUint32(indices, index)
+	}
+	indicesAccessor := addAccessor(indices, elementArrayBufferTarget, gltf.Accessor{
+		ComponentType: gltf.ComponentUnsignedInt, Count: len(m.Triangles), Type: "SCALAR",
+	})
+	doc.Meshes = []gltf.Mesh{{Name: "mesh", Primitives: []gltf.Primitive{{Attributes: attributes, Indices: gltf.Int(indicesAccessor)}}}}
+	doc.Buffers = []gltf.Buffer{{ByteLength: len(buffer)}}
+	return &gltf.Model{Document: doc, Buffers: [][]byte{buffer}}, nil
+}
+
+// Buffer view targets of vertex attributes and indices
+const (
+	arrayBufferTarget        = 34962
+	elementArrayBufferTarget = 34963
+)
+
+func float32Bytes(values []float32) []byte {
+	out := make([]byte, 0, len(values)*4)
+	for _, value := range values {
+		out = binary.LittleEndian.AppendUint32(out, math.Float32bits(value))
+	}
+	return out
+}
@@ -0,0 +1,192 @@
+// Package mesh reads and writes the triangle mesh formats used for 3D
+// printing and scanning, STL, PLY and 3MF, and converts between them and
+// glTF scenes.
+package mesh
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrInvalid wraps every reason a mesh file is malformed
+var ErrInvalid = errors.New("invalid mesh")
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, args...))
+}
+
+// Units are the lengths of the units mesh files are written in, in meters,
+// named as 3MF names them
+var Units = map[string]float64{
+	"micron":     1e-6,
+	"millimeter": 1e-3,
+	"centimeter": 1e-2,
+	"meter":      1,
+	"inch":       0.0254,
+	"foot":       0.3048,
+}
+
+// Mesh is an indexed triangle mesh. Like the printing formats, it is Z up;
+// FromGLTF and ToGLTF turn it from and to the Y up axis of glTF.
+type Mesh struct {
+	// Positions holds x, y and z of every vertex
+	Positions []float32
+	// Colors holds red, green and blue of every vertex, or nothing
+	Colors []uint8
+	// Triangles holds three vertex indices per triangle, counter-clockwise
+	// when seen from outside
+	Triangles []uint32
+	// Unit is the name of the unit of Positions, empty when the file does
+	// not record it
+	Unit string
+}
+
+func (m *Mesh) VertexCount() int {
+	return len(m.Positions) / 3
+}
+
+func (m *Mesh) TriangleCount() int {
+	return len(m.Triangles) / 3
+}
+
+// Validate checks that every triangle references existing vertices and that
+// colors, when present, cover every vertex
+func (m *Mesh) Validate() error {
+	if len(m.Positions)%3 != 0 || len(m.Triangles)%3 != 0 {
+		return invalid("positions and triangles must come in threes")
+	}
+	if m.Colors != nil && len(m.Colors) != len(m.Positions) {
+		return invalid("%d colors for %d vertices", len(m.Colors)/3, m.VertexCount())
+	}
+	vertices := uint32(m.VertexCount())
+	for _, index := range m.Triangles {
+		if index >= vertices {
+			return invalid("vertex index %d is out of range", index)
+		}
+	}
+	return nil
+}
+
+// ConvertUnits scales the mesh to unit. Meshes without a unit are taken to be
+// in assumed, the unit the caller knows the source was written in.
+func (m *Mesh) ConvertUnits(assumed string, unit string) error {
+	from := m.Unit
+	if from == "" {
+		from = assumed
+	}
+	fromMeters, ok := Units[from]
+	if !ok {
+		return fmt.Errorf("unknown unit %q", from)
+	}
+	toMeters, ok := Units[unit]
+	if !ok {
+		return fmt.Errorf("unknown unit %q", unit)
+	}
+	if scale := float32(fromMeters / toMeters); scale != 1 {
+		for i := range m.Positions {
+			m.Positions[i] *= scale
+		}
+	}
+	m.Unit = unit
+	return nil
+}
+
+// Append adds the vertices and triangles of other to the mesh. Colors are
+// kept when both meshes have them, or filled with white for the one that
+// does not.
+func (m *Mesh) Append(other *Mesh) {
+	offset := uint32(m.VertexCount())
+	if m.Colors != nil || other.Colors != nil {
+		m.Colors = append(whiteIfMissing(m.Colors, m.VertexCount()), whiteIfMissing(other.Colors, other.VertexCount())...)
+	}
+	m.Positions = append(m.Positions, other.Positions...)
+	for _, index := range other.Triangles {
+		m.Triangles = append(m.Triangles, index+offset)
+	}
+}
+
+func whiteIfMissing(colors []uint8, vertices int) []uint8 {
+	if colors != nil {
+		return colors
+	}
+	white := make([]uint8, vertices*3)
+	for i := range white {
+		white[i] = 255
+	}
+	return white
+}
+
+// Stats describe a mesh as it was written
+type Stats struct {
+	Vertices  int        `json:"vertices"`
+	Triangles int        `json:"triangles"`
+	Min       [3]float64 `json:"min"`
+	Max       [3]float64 `json:"max"`
+	Unit      string     `json:"unit,omitempty"`
+}
+
+func (m *Mesh) Stats() Stats {
+	stats := Stats{Vertices: m.VertexCount(), Triangles: m.TriangleCount(), Unit: m.Unit}
+	if stats.Vertices == 0 {
+		return stats
+	}
+	for axis := 0; axis < 3; axis++ {
+		stats.Min[axis] = math.Inf(1)
+		stats.Max[axis] = math.Inf(-1)
+	}
+	for i := 0; i+2 < len(m.Positions); i += 3 {
+		for axis := 0; axis < 3; axis++ {
+			value := float64(m.Positions[i+axis])
+			stats.Min[axis] = math.Min(stats.Min[axis], value)
+			stats.Max[axis] = math.Max(stats.Max[axis], value)
+		}
+	}
+	return stats
+}
+
+// welder merges vertices at identical positions, for formats that store
+// every triangle with its own corners
+type welder struct {
+	mesh    *Mesh
+	indices map[[3]float32]uint32
+}
+
+func newWelder() *welder {
+	return &welder{mesh: &Mesh{}, indices: map[[3]float32]uint32{}}
+}
+
+func (w *welder) vertex(position [3]float32) uint32 {
+	if index, ok := w.indices[position]; ok {
+		return index
+	}
+	index := uint32(w.mesh.VertexCount())
+	w.indices[position] = index
+	w.mesh.Positions = append(w.mesh.Positions, position[0], position[1], position[2])
+	return index
+}
+
+func (w *welder) triangle(corners [3][3]float32) {
+	for _, corner := range corners {
+		w.mesh.Triangles = append(w.mesh.Triangles, w.vertex(corner))
+	}
+}
+
+// position returns vertex i of the mesh
+func (m *Mesh) position(i uint32) [3]float32 {
+	return [3]float32{m.Positions[i*3], m.Positions[i*3+1], m.Positions[i*3+2]}
+}
+
+// faceNormal returns the unit normal of triangle t, or zero for degenerate
+// triangles
+func (m *Mesh) faceNormal(t int) [3]float32 {
+	a, b, c := m.position(m.Triangles[t*3]), m.position(m.Triangles[t*3+1]), m.position(m.Triangles[t*3+2])
+	u := [3]float64{float64(b[0] - a[0]), float64(b[1] - a[1]), float64(b[2] - a[2])}
+	v := [3]float64{float64(c[0] - a[0]), float64(c[1] - a[1]), float64(c[2] - a[2])}
+	n := [3]float64{u[1]*v[2] - u[2]*v[1], u[2]*v[0] - u[0]*v[2], u[0]*v[1] - u[1]*v[0]}
+	length := math.Sqrt(n[0]*n[0] + n[1]*n[1] + n[2]*n[2])
+	if length == 0 {
+		return [3]float32{}
+	}
+	return [3]float32{float32(n[0] / length), float32(n[1] / length), float32(n[2] / length)}
+}
@@ -0,0 +1,248 @@
+package mesh
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/gltf"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTetrahedron is a closed mesh of four triangles, with colors
+func newTetrahedron() *Mesh {
+	return &Mesh{
+		Positions: []float32{0, 0, 0, 10, 0, 0, 0, 10, 0, 0, 0, 10},
+		Colors:    []uint8{255, 0, 0, 0, 255, 0, 0, 0, 255, 255, 255, 255},
+		Triangles: []uint32{0, 2, 1, 0, 1, 3, 0, 3, 2, 1, 2, 3},
+		Unit:      "millimeter",
+	}
+}
+
+func TestSTL_RoundTripsInBothEncodings(t *testing.T) {
+	for _, encoding := range []Encoding{Binary, ASCII} {
+		t.Run(string(encoding), func(t *testing.T) {
+			data, err := WriteSTL(newTetrahedron(), "test part", encoding)
+			assert.NoError(t, err)
+			if encoding == Binary {
+				assert.Len(t, data, 84+4*50)
+			} else {
+				assert.True(t, strings.HasPrefix(string(data), "solid test_part\n"))
+			}
+
+			read, err := ReadSTL(data)
+			assert.NoError(t, err)
+			// Corners shared by several triangles are merged again
+			assert.Equal(t, 4, read.VertexCount())
+			assert.Equal(t, 4, read.TriangleCount())
+			assert.Nil(t, read.Colors)
+			assert.Empty(t, read.Unit)
+			assert.Equal(t, newTetrahedron().Stats().Max, read.Stats().Max)
+		})
+	}
+}
+
+func TestReadSTL_BinaryStartingWithSolid(t *testing.T) {
+	data, err := WriteSTL(newTetrahedron(), "", Binary)
+	assert.NoError(t, err)
+	copy(data, "solid but binary")
+	read, err := ReadSTL(data)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, read.TriangleCount())
+}
+
+func TestReadSTL_Rejections(t *testing.T) {
+	data, _ := WriteSTL(newTetrahedron(), "", Binary)
+	_, err := ReadSTL(data[:len(data)-1])
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	_, err = ReadSTL([]byte("solid x\nfacet normal 0 0 1\nouter loop\nvertex 0 0 0\nvertex 1 0 0\nendloop\nendfacet\nendsolid x\n"))
+	assert.ErrorContains(t, err, "three vertices")
+}
+
+func TestPLY_RoundTripsInBothEncodings(t *testing.T) {
+	for _, encoding := range []Encoding{Binary, ASCII} {
+		t.Run(string(encoding), func(t *testing.T) {
+			data, err := WritePLY(newTetrahedron(), encoding)
+			assert.NoError(t, err)
+			read, err := ReadPLY(data)
+			assert.NoError(t, err)
+			expected := newTetrahedron()
+			expected.Unit = ""
+			assert.Equal(t, expected, read)
+		})
+	}
+}
+
+func TestReadPLY_BigEndianPolygonsAndExtraProperties(t *testing.T) {
+	header := "ply\nformat binary_big_endian 1.0\ncomment made by hand\n" +
+		"element vertex 4\nproperty double z\nproperty float confidence\nproperty double x\nproperty double y\n" +
+		"element face 1\nproperty uchar flags\nproperty list uchar int vertex_indices\n" +
+		"element edge 1\nproperty int vertex1\nproperty int vertex2\nend_header\n"
+	body := new(bytes.Buffer)
+	for _, vertex := range [][3]float64{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}} {
+		binary.Write(body, binary.BigEndian, vertex[2])
+		binary.Write(body, binary.BigEndian, float32(0.5))
+		binary.Write(body, binary.BigEndian, vertex[0])
+		binary.Write(body, binary.BigEndian, vertex[1])
+	}
+	binary.Write(body, binary.BigEndian, []uint8{7, 4})
+	binary.Write(body, binary.BigEndian, []int32{0, 1, 2, 3, 0, 1})
+
+	read, err := ReadPLY(append([]byte(header), body.Bytes()...))
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{0, 0, 0, 1, 0, 0, 1, 1, 0, 0, 1, 0}, read.Positions)
+	// The quad is split into two triangles
+	assert.Equal(t, []uint32{0, 1, 2, 0, 2, 3}, read.Triangles)
+}
+
+func TestReadPLY_Rejections(t *testing.T) {
+	tests := map[string]string{
+		"not a PLY file":          "solid\n",
+		"no end_header":           "ply\nformat ascii 1.0\n",
+		"vertices need x, y":      "ply\nformat ascii 1.0\nelement vertex 1\nproperty float x\nend_header\n1\n",
+		"body ends early":         "ply\nformat ascii 1.0\nelement vertex 2\nproperty float x\nproperty float y\nproperty float z\nend_header\n0 0 0\n",
+		"vertex index 5 is out":   "ply\nformat ascii 1.0\nelement vertex 1\nproperty float x\nproperty float y\nproperty float z\nelement face 1\nproperty list uchar int vertex_indices\nend_header\n0 0 0\n3 0 0 5\n",
+		`unknown PLY format`:      "ply\nformat binary_middle_endian 1.0\nend_header\n",
+		`unknown type "float128"`: "ply\nformat ascii 1.0\nelement vertex 1\nproperty float128 x\nend_header\n",
+	}
+	for message, data := range tests {
+		_, err := ReadPLY([]byte(data))
+		assert.ErrorIs(t, err, ErrInvalid, message)
+		assert.ErrorContains(t, err, message)
+	}
+}
+
+func Test3MF_RoundTrips(t *testing.T) {
+	tetrahedron := newTetrahedron()
+	tetrahedron.Unit = "inch"
+	// A triangle using a vertex twice is not allowed in 3MF
+	tetrahedron.Triangles = append(tetrahedron.Triangles, 0, 0, 1)
+	data, err := Write3MF(tetrahedron)
+	assert.NoError(t, err)
+
+	read, err := Read3MF(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "inch", read.Unit)
+	assert.Equal(t, newTetrahedron().Positions, read.Positions)
+	assert.Equal(t, newTetrahedron().Triangles, read.Triangles)
+}
+
+func threeMFPackage(t *testing.T, model string) []byte {
+	var out bytes.Buffer
+	writer := zip.NewWriter(&out)
+	for name, content := range map[string]string{
+		"_rels/.rels":         `<Relationships><Relationship Target="/3D/part.model" Type="http://schemas.microsoft.com/3dmanufacturing/2013/01/3dmodel"/></Relationships>`,
+		"3D/part.model":       model,
+		"[Content_Types].xml": "<Types/>",
+	} {
+		w, err := writer.Create(name)
+		assert.NoError(t, err)
+		w.Write([]byte(content))
+	}
+	assert.NoError(t, writer.Close())
+	return out.Bytes()
+}
+
+func TestRead3MF_AppliesItemAndComponentTransforms(t *testing.T) {
+	data := threeMFPackage(t, `<?xml version="1.0"?>
+<model unit="centimeter" xmlns="http://schemas.microsoft.com/3dmanufacturing/core/2015/02">
+  <resources>
+    <object id="1"><mesh>
+      <vertices><vertex x="0" y="0" z="0"/><vertex x="1" y="0" z="0"/><vertex x="0" y="1" z="0"/></vertices>
+      <triangles><triangle v1="0" v2="1" v3="2"/></triangles>
+    </mesh></object>
+    <object id="2"><components>
+      <component objectid="1" transform="1 0 0 0 1 0 0 0 1 5 0 0"/>
+      <component objectid="1" transform="-1 0 0 0 1 0 0 0 1 0 0 0"/>
+    </components></object>
+  </resources>
+  <build><item objectid="2" transform="1 0 0 0 1 0 0 0 1 0 0 2"/></build>
+</model>`)
+	read, err := Read3MF(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "centimeter", read.Unit)
+	assert.Equal(t, []float32{5, 0, 2, 6, 0, 2, 5, 1, 2, 0, 0, 2, -1, 0, 2, 0, 1, 2}, read.Positions)
+	// The mirrored copy has its winding flipped
+	assert.Equal(t, []uint32{0, 1, 2, 3, 5, 4}, read.Triangles)
+}
+
+func TestRead3MF_Rejections(t *testing.T) {
+	_, err := Read3MF([]byte("not a zip"))
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	cyclic := threeMFPackage(t, `<model><resources><object id="1"><components><component objectid="1"/></components></object></resources><build><item objectid="1"/></build></model>`)
+	_, err = Read3MF(cyclic)
+	assert.ErrorContains(t, err, "nested too deeply")
+
+	missing := threeMFPackage(t, `<model><resources/><build><item objectid="3"/></build></model>`)
+	_, err = Read3MF(missing)
+	assert.ErrorContains(t, err, "object 3 is missing")
+
+	unit := threeMFPackage(t, `<model unit="furlong"><resources/><build/></model>`)
+	_, err = Read3MF(unit)
+	assert.ErrorContains(t, err, `unknown unit "furlong"`)
+}
+
+func TestConvertUnits(t *testing.T) {
+	m := &Mesh{Positions: []float32{1, 2, 3}}
+	assert.NoError(t, m.ConvertUnits("inch", "millimeter"))
+	assert.InDeltaSlice(t, []float32{25.4, 50.8, 76.2}, m.Positions, 1e-4)
+	assert.Equal(t, "millimeter", m.Unit)
+
+	// A recorded unit wins over the assumed one
+	assert.NoError(t, m.ConvertUnits("inch", "meter"))
+	assert.InDeltaSlice(t, []float32{0.0254, 0.0508, 0.0762}, m.Positions, 1e-6)
+
+	assert.Error(t, m.ConvertUnits("", "furlong"))
+}
+
+func TestGLTF_RoundTripTurnsTheUpAxis(t *testing.T) {
+	tetrahedron := newTetrahedron()
+	assert.NoError(t, tetrahedron.ConvertUnits("", "meter"))
+	model, err := ToGLTF(tetrahedron)
+	assert.NoError(t, err)
+	// Z up becomes Y up, so the apex is on +Y and the +Y corner on -Z
+	assert.InDeltaSlice(t, []float64{0.01, 0.01, 0}, model.Document.Accessors[0].Max, 1e-6)
+	assert.InDeltaSlice(t, []float64{0, 0, -0.01}, model.Document.Accessors[0].Min, 1e-6)
+
+	glb, err := model.WriteGLB()
+	assert.NoError(t, err)
+	read, err := gltf.Read(glb, nil)
+	assert.NoError(t, err)
+	flattened, err := FromGLTF(read)
+	assert.NoError(t, err)
+	assert.Equal(t, "meter", flattened.Unit)
+	assert.InDeltaSlice(t, tetrahedron.Positions, flattened.Positions, 1e-6)
+	assert.Equal(t, tetrahedron.Triangles, flattened.Triangles)
+	assert.Equal(t, tetrahedron.Colors, flattened.Colors)
+}
+
+func TestFromGLTF_AppliesNodeTransforms(t *testing.T) {
+	triangle := &Mesh{Positions: []float32{0, 0, 0, 1, 0, 0, 0, 1, 0}, Triangles: []uint32{0, 1, 2}}
+	model, err := ToGLTF(triangle)
+	assert.NoError(t, err)
+	// The same mesh again under a parent moved along Y and mirrored along X
+	model.Document.Nodes[0].Children = []int{1}
+	model.Document.Nodes[0].Translation = []float64{0, 2, 0}
+	model.Document.Nodes = append(model.Document.Nodes, gltf.Node{Mesh: gltf.Int(0), Scale: []float64{-1, 1, 1}})
+
+	flattened, err := FromGLTF(model)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, flattened.VertexCount())
+	stats := flattened.Stats()
+	// glTF's +Y is the mesh's +Z
+	assert.InDelta(t, 2, stats.Min[2], 1e-6)
+	assert.InDelta(t, -1, stats.Min[0], 1e-6)
+	assert.Equal(t, []uint32{0, 1, 2, 3, 5, 4}, flattened.Triangles)
+	assert.False(t, math.IsInf(stats.Max[0], 0))
+}
+
+func TestStats(t *testing.T) {
+	stats := newTetrahedron().Stats()
+	assert.Equal(t, Stats{Vertices: 4, Triangles: 4, Max: [3]float64{10, 10, 10}, Unit: "millimeter"}, stats)
+	assert.Equal(t, Stats{}, (&Mesh{}).Stats())
+}
@@ -0,0 +1,313 @@
+package mesh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// plyTypes are the sizes of the scalar types a PLY property may have, under
+// both their old and their sized names
+var plyTypes = map[string]int{
+	"char": 1, "int8": 1, "uchar": 1, "uint8": 1,
+	"short": 2, "int16": 2, "ushort": 2, "uint16": 2,
+	"int": 4, "int32": 4, "uint": 4, "uint32": 4,
+	"float": 4, "float32": 4, "double": 8, "float64": 8,
+}
+
+type plyProperty struct {
+	name     string
+	dataType string
+	// countType is set on list properties
+	countType string
+}
+
+type plyElement struct {
+	name       string
+	count      int
+	properties []plyProperty
+}
+
+// plyValues reads the numbers of a PLY body in either encoding
+type plyValues interface {
+	next(dataType string) (float64, error)
+}
+
+// ReadPLY parses an ASCII or binary PLY file. Vertices need x, y and z and may
+// have red, green and blue; faces with more than three corners are split into
+// triangles. Other elements and properties are skipped. PLY files carry no
+// unit.
+func ReadPLY(data []byte) (*Mesh, error) {
+	reader := bufio.NewReader(bytes.NewReader(data))
+	elements, format, err := readPLYHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	var values plyValues
+	switch format {
+	case "ascii":
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(nil, 1<<20)
+		scanner.Split(bufio.ScanWords)
+		values = &asciiPLYValues{scanner: scanner}
+	case "binary_little_endian":
+		values = &binaryPLYValues{reader: reader, order: binary.LittleEndian}
+	case "binary_big_endian":
+		values = &binaryPLYValues{reader: reader, order: binary.BigEndian}
+	default:
+		return nil, invalid("unknown PLY format %q", format)
+	}
+
+	mesh := &Mesh{}
+	for _, element := range elements {
+		for i := 0; i < element.count; i++ {
+			var color [3]uint8
+			hasColor := false
+			if element.name == "vertex" {
+				mesh.Positions = append(mesh.Positions, 0, 0, 0)
+			}
+			for _, property := range element.properties {
+				if property.countType != "" {
+					count, err := values.next(property.countType)
+					if err != nil {
+						return nil, err
+					}
+					if count < 0 || count > math.MaxUint16 {
+						return nil, invalid("%s %d has a list of %v values", element.name, i, count)
+					}
+					corners := make([]uint32, int(count))
+					for j := range corners {
+						value, err := values.next(property.dataType)
+						if err != nil {
+							return nil, err
+						}
+						if value < 0 {
+							return nil, invalid("%s %d has a negative index", element.name, i)
+						}
+						corners[j] = uint32(value)
+					}
+					if element.name == "face" && (property.name == "vertex_indices" || property.name == "vertex_index") {
+						for j := 2; j < len(corners); j++ {
+							mesh.Triangles = append(mesh.Triangles, corners[0], corners[j-1], corners[j])
+						}
+					}
+					continue
+				}
+
+				value, err := values.next(property.dataType)
+				if err != nil {
+					return nil, err
+				}
+				if element.name != "vertex" {
+					continue
+				}
+				switch property.name {
+				case "x", "y", "z":
+					mesh.Positions[len(mesh.Positions)-3+int(property.name[0]-'x')] = float32(value)
+				case "red", "green", "blue":
+					hasColor = true
+					if strings.HasPrefix(property.dataType, "float") || property.dataType == "double" {
+						value *= 255
+					}
+					color[map[string]int{"red": 0, "green": 1, "blue": 2}[property.name]] = uint8(math.Max(0, math.Min(255, value)))
+				}
+			}
+			if hasColor {
+				mesh.Colors = append(mesh.Colors, color[:]...)
+			}
+		}
+	}
+	if err := mesh.Validate(); err != nil {
+		return nil, err
+	}
+	return mesh, nil
+}
+
+// readPLYHeader reads the header up to end_header, checking that vertices
+// have a position
+func readPLYHeader(reader *bufio.Reader) ([]plyElement, string, error) {
+	readLine := func() (string, error) {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", invalid("the PLY header has no end_header")
+		}
+		return strings.TrimSpace(line), nil
+	}
+	magic, err := readLine()
+	if err != nil || magic != "ply" {
+		return nil, "", invalid("not a PLY file")
+	}
+
+	var elements []plyElement
+	format := ""
+	for {
+		line, err := readLine()
+		if err != nil {
+			return nil, "", err
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "format":
+			if len(fields) != 3 {
+				return nil, "", invalid("malformed %q", line)
+			}
+			format = fields[1]
+		case "element":
+			if len(fields) != 3 {
+				return nil, "", invalid("malformed %q", line)
+			}
+			count, err := strconv.Atoi(fields[2])
+			if err != nil || count < 0 {
+				return nil, "", invalid("malformed %q", line)
+			}
+			elements = append(elements, plyElement{name: fields[1], count: count})
+		case "property":
+			if len(elements) == 0 {
+				return nil, "", invalid("property before any element")
+			}
+			property := plyProperty{}
+			if len(fields) == 5 && fields[1] == "list" {
+				property = plyProperty{countType: fields[2], dataType: fields[3], name: fields[4]}
+			} else if len(fields) == 3 {
+				property = plyProperty{dataType: fields[1], name: fields[2]}
+			} else {
+				return nil, "", invalid("malformed %q", line)
+			}
+			for _, dataType := range []string{property.dataType, property.countType} {
+				if _, ok := plyTypes[dataType]; dataType != "" && !ok {
+					return nil, "", invalid("unknown type %q", dataType)
+				}
+			}
+			element := &elements[len(elements)-1]
+			element.properties = append(element.properties, property)
+		case "end_header":
+			if format == "" {
+				return nil, "", invalid("the PLY header has no format")
+			}
+			for _, element := range elements {
+				if element.name == "vertex" && !hasPosition(element) {
+					return nil, "", invalid("vertices need x, y and z properties")
+				}
+			}
+			return elements, format, nil
+		}
+	}
+}
+
+func hasPosition(element plyElement) bool {
+	axes := map[string]bool{}
+	for _, property := range element.properties {
+		if property.countType == "" {
+			axes[property.name] = true
+		}
+	}
+	return axes["x"] && axes["y"] && axes["z"]
+}
+
+type asciiPLYValues struct {
+	scanner *bufio.Scanner
+}
+
+func (v *asciiPLYValues) next(dataType string) (float64, error) {
+	if !v.scanner.Scan() {
+		return 0, invalid("the PLY body ends early")
+	}
+	value, err := strconv.ParseFloat(v.scanner.Text(), 64)
+	if err != nil {
+		return 0, invalid("%v", err)
+	}
+	return value, nil
+}
+
+type binaryPLYValues struct {
+	reader io.Reader
+	order  binary.ByteOrder
+	buffer [8]byte
+}
+
+func (v *binaryPLYValues) next(dataType string) (float64, error) {
+	raw := v.buffer[:plyTypes[dataType]]
+	if _, err := io.ReadFull(v.reader, raw); err != nil {
+		return 0, invalid("the PLY body ends early")
+	}
+	switch dataType {
+	case "char", "int8":
+		return float64(int8(raw[0])), nil
+	case "uchar", "uint8":
+		return float64(raw[0]), nil
+	case "short", "int16":
+		return float64(int16(v.order.Uint16(raw))), nil
+	case "ushort", "uint16":
+		return float64(v.order.Uint16(raw)), nil
+	case "int", "int32":
+		return float64(int32(v.order.Uint32(raw))), nil
+	case "uint", "uint32":
+		return float64(v.order.Uint32(raw)), nil
+	case "float", "float32":
+		return float64(math.Float32frombits(v.order.Uint32(raw))), nil
+	}
+	return math.Float64frombits(v.order.Uint64(raw)), nil
+}
+
+// WritePLY writes the mesh as a PLY file, with vertex colors when it has them
+func WritePLY(m *Mesh, encoding Encoding) ([]byte, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	out.WriteString("ply\n")
+	if encoding == ASCII {
+		out.WriteString("format ascii 1.0\n")
+	} else {
+		out.WriteString("format binary_little_endian 1.0\n")
+	}
+	if m.Unit != "" {
+		fmt.Fprintf(&out, "comment unit %s\n", m.Unit)
+	}
+	fmt.Fprintf(&out, "element vertex %d\n", m.VertexCount())
+	out.WriteString("property float x\nproperty float y\nproperty float z\n")
+	if m.Colors != nil {
+		out.WriteString("property uchar red\nproperty uchar green\nproperty uchar blue\n")
+	}
+	fmt.Fprintf(&out, "element face %d\n", m.TriangleCount())
+	out.WriteString("property list uchar uint vertex_indices\n")
+	out.WriteString("end_header\n")
+
+	for i := 0; i < m.VertexCount(); i++ {
+		position := m.position(uint32(i))
+		if encoding == ASCII {
+			out.WriteString(formatVector(position))
+			if m.Colors != nil {
+				fmt.Fprintf(&out, " %d %d %d", m.Colors[i*3], m.Colors[i*3+1], m.Colors[i*3+2])
+			}
+			out.WriteByte('\n')
+			continue
+		}
+		for _, value := range position {
+			out.Write(binary.LittleEndian.AppendUint32(nil, math.Float32bits(value)))
+		}
+		if m.Colors != nil {
+			out.Write(m.Colors[i*3 : i*3+3])
+		}
+	}
+	for t := 0; t < m.TriangleCount(); t++ {
+		corners := m.Triangles[t*3 : t*3+3]
+		if encoding == ASCII {
+			fmt.Fprintf(&out, "3 %d %d %d\n", corners[0], corners[1], corners[2])
+			continue
+		}
+		out.WriteByte(3)
+		for _, index := range corners {
+			out.Write(binary.LittleEndian.AppendUint32(nil, index))
+		}
+	}
+	return out.Bytes(), nil
+}
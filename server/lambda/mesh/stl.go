@@ -0,0 +1,156 @@
+package mesh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Encoding is how STL and PLY files store their numbers
+type Encoding string
+
+const (
+	Binary Encoding = "binary"
+	ASCII  Encoding = "ascii"
+)
+
+const (
+	stlHeaderSize   = 80
+	stlTriangleSize = 50
+)
+
+// ReadSTL parses a binary or ASCII STL file. STL repeats the corners of every
+// triangle, so vertices at the same position are merged. STL files carry no
+// unit.
+func ReadSTL(data []byte) (*Mesh, error) {
+	// ASCII files start with "solid", but so do some binary ones, which are
+	// told apart by their size matching their triangle count
+	if len(data) >= stlHeaderSize+4 {
+		count := binary.LittleEndian.Uint32(data[stlHeaderSize:])
+		if uint64(stlHeaderSize+4)+uint64(count)*stlTriangleSize == uint64(len(data)) {
+			return readBinarySTL(data, int(count)), nil
+		}
+	}
+	if bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("solid")) {
+		return readASCIISTL(data)
+	}
+	return nil, invalid("not an STL file, or a binary one whose size does not match its triangle count")
+}
+
+func readBinarySTL(data []byte, count int) *Mesh {
+	w := newWelder()
+	for t := 0; t < count; t++ {
+		// Each triangle has a normal, three corners and an attribute count
+		record := data[stlHeaderSize+4+t*stlTriangleSize:]
+		var corners [3][3]float32
+		for corner := 0; corner < 3; corner++ {
+			for axis := 0; axis < 3; axis++ {
+				offset := 12 + corner*12 + axis*4
+				corners[corner][axis] = math.Float32frombits(binary.LittleEndian.Uint32(record[offset:]))
+			}
+		}
+		w.triangle(corners)
+	}
+	return w.mesh
+}
+
+func readASCIISTL(data []byte) (*Mesh, error) {
+	w := newWelder()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	var corners [3][3]float32
+	corner := 0
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "vertex":
+			if len(fields) != 4 || corner == 3 {
+				return nil, invalid("line %d: malformed vertex", line)
+			}
+			for axis := 0; axis < 3; axis++ {
+				value, err := strconv.ParseFloat(fields[axis+1], 32)
+				if err != nil {
+					return nil, invalid("line %d: %v", line, err)
+				}
+				corners[corner][axis] = float32(value)
+			}
+			corner++
+		case "endloop":
+			if corner != 3 {
+				return nil, invalid("line %d: facets must have three vertices", line)
+			}
+			w.triangle(corners)
+			corner = 0
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, invalid("%v", err)
+	}
+	return w.mesh, nil
+}
+
+// WriteSTL writes the mesh as an STL file named name, with a flat normal per
+// triangle
+func WriteSTL(m *Mesh, name string, encoding Encoding) ([]byte, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	if encoding == ASCII {
+		return writeASCIISTL(m, name), nil
+	}
+	if uint64(m.TriangleCount()) > math.MaxUint32 {
+		return nil, fmt.Errorf("%d triangles do not fit a binary STL file", m.TriangleCount())
+	}
+
+	out := make([]byte, stlHeaderSize+4+m.TriangleCount()*stlTriangleSize)
+	copy(out, fmt.Sprintf("binary STL %s", name))
+	binary.LittleEndian.PutUint32(out[stlHeaderSize:], uint32(m.TriangleCount()))
+	for t := 0; t < m.TriangleCount(); t++ {
+		record := out[stlHeaderSize+4+t*stlTriangleSize:]
+		values := m.faceNormal(t)
+		for axis, value := range values {
+			binary.LittleEndian.PutUint32(record[axis*4:], math.Float32bits(value))
+		}
+		for corner := 0; corner < 3; corner++ {
+			position := m.position(m.Triangles[t*3+corner])
+			for axis, value := range position {
+				binary.LittleEndian.PutUint32(record[12+corner*12+axis*4:], math.Float32bits(value))
+			}
+		}
+	}
+	return out, nil
+}
+
+func writeASCIISTL(m *Mesh, name string) []byte {
+	var out bytes.Buffer
+	name = strings.Join(strings.Fields(name), "_")
+	fmt.Fprintf(&out, "solid %s\n", name)
+	for t := 0; t < m.TriangleCount(); t++ {
+		fmt.Fprintf(&out, "  facet normal %s\n", formatVector(m.faceNormal(t)))
+		out.WriteString("    outer loop\n")
+		for corner := 0; corner < 3; corner++ {
+			fmt.Fprintf(&out, "      vertex %s\n", formatVector(m.position(m.Triangles[t*3+corner])))
+		}
+		out.WriteString("    endloop\n")
+		out.WriteString("  endfacet\n")
+	}
+	fmt.Fprintf(&out, "endsolid %s\n", name)
+	return out.Bytes()
+}
+
+func formatFloat(value float32) string {
+	return strconv.FormatFloat(float64(value), 'g', -1, 32)
+}
+
+func formatVector(v [3]float32) string {
+	return formatFloat(v[0]) + " " + formatFloat(v[1]) + " " + formatFloat(v[2])
+}
@@ -0,0 +1,333 @@
+package mesh
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	threeMFModelType    = "http://schemas.microsoft.com/3dmanufacturing/2013/01/3dmodel"
+	threeMFNamespace    = "http://schemas.microsoft.com/3dmanufacturing/core/2015/02"
+	threeMFDefaultModel = "3D/3dmodel.model"
+	// maxThreeMFModelSize caps the uncompressed model part, which is read in
+	// memory
+	maxThreeMFModelSize = 1 << 30
+	// maxComponentDepth stops component references that form a cycle
+	maxComponentDepth = 32
+	// maxObjectInstances caps how many objects items and components place,
+	// which can grow exponentially with the depth of components
+	maxObjectInstances = 100000
+)
+
+type threeMFRelationships struct {
+	Relationships []struct {
+		Target string `xml:"Target,attr"`
+		Type   string `xml:"Type,attr"`
+	} `xml:"Relationship"`
+}
+
+type threeMFModel struct {
+	Unit    string          `xml:"unit,attr"`
+	Objects []threeMFObject `xml:"resources>object"`
+	Items   []threeMFItem   `xml:"build>item"`
+}
+
+type threeMFObject struct {
+	ID         int                `xml:"id,attr"`
+	Vertices   []threeMFVertex    `xml:"mesh>vertices>vertex"`
+	Triangles  []threeMFTriangle  `xml:"mesh>triangles>triangle"`
+	Components []threeMFComponent `xml:"components>component"`
+}
+
+type threeMFVertex struct {
+	X float32 `xml:"x,attr"`
+	Y float32 `xml:"y,attr"`
+	Z float32 `xml:"z,attr"`
+}
+
+type threeMFTriangle struct {
+	V1 uint32 `xml:"v1,attr"`
+	V2 uint32 `xml:"v2,attr"`
+	V3 uint32 `xml:"v3,attr"`
+}
+
+type threeMFComponent struct {
+	ObjectID  int    `xml:"objectid,attr"`
+	Transform string `xml:"transform,attr"`
+}
+
+type threeMFItem struct {
+	ObjectID  int    `xml:"objectid,attr"`
+	Transform string `xml:"transform,attr"`
+}
+
+// transform is a 3MF affine matrix, m00 m01 m02 m10 m11 m12 m20 m21 m22 m30
+// m31 m32, applied to row vectors
+type transform [12]float64
+
+var identityTransform = transform{1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0}
+
+func parseTransform(value string) (transform, error) {
+	if value == "" {
+		return identityTransform, nil
+	}
+	fields := strings.Fields(value)
+	if len(fields) != 12 {
+		return transform{}, invalid("transform %q needs 12 numbers", value)
+	}
+	var t transform
+	for i, field := range fields {
+		number, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return transform{}, invalid("transform %q: %v", value, err)
+		}
+		t[i] = number
+	}
+	return t, nil
+}
+
+func (t transform) apply(p [3]float32) [3]float32 {
+	x, y, z := float64(p[0]), float64(p[1]), float64(p[2])
+	return [3]float32{
+		float32(x*t[0] + y*t[3] + z*t[6] + t[9]),
+		float32(x*t[1] + y*t[4] + z*t[7] + t[10]),
+		float32(x*t[2] + y*t[5] + z*t[8] + t[11]),
+	}
+}
+
+// then returns the transform applying t and then next
+func (t transform) then(next transform) transform {
+	var out transform
+	for row := 0; row < 4; row++ {
+		for column := 0; column < 3; column++ {
+			sum := 0.0
+			for k := 0; k < 3; k++ {
+				sum += t[row*3+k] * next[k*3+column]
+			}
+			if row == 3 {
+				sum += next[9+column]
+			}
+			out[row*3+column] = sum
+		}
+	}
+	return out
+}
+
+func (t transform) determinant() float64 {
+	return t[0]*(t[4]*t[8]-t[5]*t[7]) - t[1]*(t[3]*t[8]-t[5]*t[6]) + t[2]*(t[3]*t[7]-t[4]*t[6])
+}
+
+// Read3MF reads every build item of a 3MF package into one mesh, with the
+// transforms of items and components applied. Materials and colors are not
+// read.
+func Read3MF(data []byte) (*Mesh, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, invalid("not a 3MF package: %v", err)
+	}
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[strings.TrimPrefix(file.Name, "/")] = file
+	}
+
+	modelPath := threeMFDefaultModel
+	if rels, ok := files["_rels/.rels"]; ok {
+		var relationships threeMFRelationships
+		if err := decodeXMLPart(rels, &relationships); err != nil {
+			return nil, err
+		}
+		for _, relationship := range relationships.Relationships {
+			if relationship.Type == threeMFModelType {
+				modelPath = strings.TrimPrefix(path.Clean("/"+relationship.Target), "/")
+				break
+			}
+		}
+	}
+	part, ok := files[modelPath]
+	if !ok {
+		return nil, invalid("the package has no model part %s", modelPath)
+	}
+	var model threeMFModel
+	if err := decodeXMLPart(part, &model); err != nil {
+		return nil, err
+	}
+
+	unit := model.Unit
+	if unit == "" {
+		unit = "millimeter"
+	}
+	if _, ok := Units[unit]; !ok {
+		return nil, invalid("unknown unit %q", unit)
+	}
+	objects := map[int]threeMFObject{}
+	for _, object := range model.Objects {
+		objects[object.ID] = object
+	}
+	builder := &threeMFBuilder{mesh: &Mesh{Unit: unit}, objects: objects}
+	for _, item := range model.Items {
+		t, err := parseTransform(item.Transform)
+		if err != nil {
+			return nil, err
+		}
+		if err := builder.appendObject(item.ObjectID, t, 0); err != nil {
+			return nil, err
+		}
+	}
+	return builder.mesh, nil
+}
+
+func decodeXMLPart(file *zip.File, v any) error {
+	if file.UncompressedSize64 > maxThreeMFModelSize {
+		return invalid("%s is larger than %d bytes", file.Name, maxThreeMFModelSize)
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return invalid("%s: %v", file.Name, err)
+	}
+	defer reader.Close()
+	if err := xml.NewDecoder(io.LimitReader(reader, maxThreeMFModelSize)).Decode(v); err != nil {
+		return invalid("%s: %v", file.Name, err)
+	}
+	return nil
+}
+
+type threeMFBuilder struct {
+	mesh      *Mesh
+	objects   map[int]threeMFObject
+	instances int
+}
+
+// appendObject adds an object, and the objects its components reference, to
+// the mesh with t applied
+func (b *threeMFBuilder) appendObject(id int, t transform, depth int) error {
+	if depth > maxComponentDepth {
+		return invalid("components of object %d are nested too deeply", id)
+	}
+	if b.instances++; b.instances > maxObjectInstances {
+		return invalid("the build places more than %d objects", maxObjectInstances)
+	}
+	object, ok := b.objects[id]
+	if !ok {
+		return invalid("object %d is missing", id)
+	}
+	for _, component := range object.Components {
+		local, err := parseTransform(component.Transform)
+		if err != nil {
+			return err
+		}
+		if err := b.appendObject(component.ObjectID, local.then(t), depth+1); err != nil {
+			return err
+		}
+	}
+
+	part := &Mesh{}
+	for _, vertex := range object.Vertices {
+		p := t.apply([3]float32{vertex.X, vertex.Y, vertex.Z})
+		part.Positions = append(part.Positions, p[0], p[1], p[2])
+	}
+	// Mirroring transforms turn triangles inside out
+	mirrored := t.determinant() < 0
+	for _, triangle := range object.Triangles {
+		if mirrored {
+			part.Triangles = append(part.Triangles, triangle.V1, triangle.V3, triangle.V2)
+		} else {
+			part.Triangles = append(part.Triangles, triangle.V1, triangle.V2, triangle.V3)
+		}
+	}
+	if err := part.Validate(); err != nil {
+		return fmt.Errorf("object %d: %w", id, err)
+	}
+	b.mesh.Append(part)
+	return nil
+}
+
+const threeMFContentTypes = `<?xml version="1.0" encoding="UTF-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+  <Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+  <Default Extension="model" ContentType="application/vnd.ms-package.3dmanufacturing-3dmodel+xml"/>
+</Types>
+`
+
+const threeMFRels = `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+  <Relationship Target="/` + threeMFDefaultModel + `" Id="rel0" Type="` + threeMFModelType + `"/>
+</Relationships>
+`
+
+// Write3MF writes the mesh as a 3MF package with a single object, in the
+// mesh's unit or millimeters when it has none. 3MF does not allow triangles
+// that use a vertex twice, so those are left out.
+func Write3MF(m *Mesh) ([]byte, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	if !isFinite(m.Positions) {
+		return nil, invalid("3MF vertices must be finite numbers")
+	}
+	unit := m.Unit
+	if unit == "" {
+		unit = "millimeter"
+	}
+	if _, ok := Units[unit]; !ok {
+		return nil, fmt.Errorf("unknown unit %q", unit)
+	}
+
+	var model bytes.Buffer
+	model.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&model, `<model unit="%s" xml:lang="en-US" xmlns="%s">`+"\n", unit, threeMFNamespace)
+	model.WriteString("  <resources>\n    <object id=\"1\" type=\"model\">\n      <mesh>\n        <vertices>\n")
+	for i := 0; i < m.VertexCount(); i++ {
+		p := m.position(uint32(i))
+		fmt.Fprintf(&model, "          <vertex x=\"%s\" y=\"%s\" z=\"%s\"/>\n", formatFloat(p[0]), formatFloat(p[1]), formatFloat(p[2]))
+	}
+	model.WriteString("        </vertices>\n        <triangles>\n")
+	for t := 0; t < m.TriangleCount(); t++ {
+		a, b, c := m.Triangles[t*3], m.Triangles[t*3+1], m.Triangles[t*3+2]
+		if a == b || b == c || a == c {
+			continue
+		}
+		fmt.Fprintf(&model, "          <triangle v1=\"%d\" v2=\"%d\" v3=\"%d\"/>\n", a, b, c)
+	}
+	model.WriteString("        </triangles>\n      </mesh>\n    </object>\n  </resources>\n")
+	model.WriteString("  <build>\n    <item objectid=\"1\"/>\n  </build>\n</model>\n")
+
+	var out bytes.Buffer
+	writer := zip.NewWriter(&out)
+	for _, part := range []struct {
+		name string
+		data []byte
+	}{
+		{"[Content_Types].xml", []byte(threeMFContentTypes)},
+		{"_rels/.rels", []byte(threeMFRels)},
+		{threeMFDefaultModel, model.Bytes()},
+	} {
+		w, err := writer.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(part.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// isFinite reports whether every position is a number, which 3MF requires
+func isFinite(values []float32) bool {
+	for _, value := range values {
+		if math.IsNaN(float64(value)) || math.IsInf(float64(value), 0) {
+			return false
+		}
+	}
+	return true
+}
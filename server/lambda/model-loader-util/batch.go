@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/helpers"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
+)
+
+type BatchConversionRequest struct {
+	Jobs []ConversionJob `json:"jobs"`
+}
+
+type BatchPostResponse struct {
+	BatchID  string            `json:"batchId"`
+	Accepted int               `json:"accepted"`
+	Rejected int               `json:"rejected"`
+	Results  []BatchItemResult `json:"results"`
+}
+
+type BatchItemResult struct {
+	Index      int    `json:"index"`
+	Status     string `json:"status"`
+	ModelID    string `json:"modelId,omitempty"`
+	ToFileType string `json:"toFileType,omitempty"`
+	JobID      string `json:"jobId,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type BatchProgressResponse struct {
+	BatchID   string          `json:"batchId"`
+	Status    string          `json:"status"`
+	Total     int             `json:"total"`
+	Pending   int             `json:"pending"`
+	Completed int             `json:"completed"`
+	Failed    int             `json:"failed"`
+	Cancelled int             `json:"cancelled"`
+	Jobs      []ModelMetadata `json:"jobs"`
+}
+
+const (
+	// Every accepted item costs a HeadObject, a ranged GetObject, a PutItem and
+	// an UpdateItem on top of its share of a SendMessageBatch. Items are
+	// checked and recorded batchConcurrency at a time, so a full batch
+	// finishes well within the 30 second API Gateway limit, or items would be
+	// queued without the client hearing about them.
+	maxBatchJobs     = 250
+	batchConcurrency = 25
+	// SQS SendMessageBatch accepts at most 10 entries per call
+	maxSendMessageBatchEntries = 10
+)
+
+/*
+###########################################
+POST /v1/3d-model/batch
+###########################################
+*/
+
+// errorMessage returns the message of a response built by createErrorResponse
+func errorMessage(response events.APIGatewayV2HTTPResponse) string {
+	var errorResp ErrorResponse
+	json.Unmarshal([]byte(response.Body), &errorResp)
+	return errorResp.Error
+}
+
+func validateBatchJob(job ConversionJob) string {
+	if len(job.ToFileTypes) > 0 {
+		return "toFileTypes is not supported in batch jobs, submit one job per target"
+	}
+	if valid, resp := validateRequiredFieldsForConversion(job); !valid {
+		return errorMessage(resp)
+	}
+	if valid, resp := validateFileTypesForConversion(job); !valid {
+		return errorMessage(resp)
+	}
+	if valid, resp := validateSourceKeyForConversion(job); !valid {
+		return errorMessage(resp)
+	}
+	return ""
+}
+
+// preparedBatchJob is one batch item after its checks. Accepted items have a
+// message, already recorded as a pending job, and the queue it goes to.
+type preparedBatchJob struct {
+	result   BatchItemResult
+	message  map[string]string
+	queueURL string
+}
+
+// prepareBatchJob checks one batch item like POST /3d-model checks a job and
+// records it as pending
+func prepareBatchJob(ctx context.Context, dynamoClient DynamoDBClient, s3Client S3Client, batchID string, i int, job ConversionJob) preparedBatchJob {
+	maxSize := maxUploadSize()
+	if job.UploadSessionID != "" {
+		session, resp, err := applyUploadSession(ctx, dynamoClient, &job)
+		if err != nil {
+			log.Printf("Error resolving upload session of batch %s job %d: %v", batchID, i, err)
+		}
+		if resp.StatusCode != 0 {
+			return preparedBatchJob{result: BatchItemResult{Index: i, ToFileType: job.ToFileType, Status: "rejected", Error: errorMessage(resp)}}
+		}
+		maxSize = session.MaxSize
+	}
+
+	result := BatchItemResult{Index: i, ModelID: job.ModelID, ToFileType: job.ToFileType}
+	reject := func(message string) preparedBatchJob {
+		result.Status = "rejected"
+		result.Error = message
+		return preparedBatchJob{result: result}
+	}
+	if message := validateBatchJob(job); message != "" {
+		return reject(message)
+	}
+	route, resp := routeConversion(job.FromFileType, job.ToFileType, job.Options)
+	if resp.StatusCode != 0 {
+		return reject(errorMessage(resp))
+	}
+	maxSize = routedMaxSourceSize(maxSize, map[string]conversionRoute{job.ToFileType: route})
+	source, resp, err := preflightSourceObject(ctx, s3Client, job, maxSize)
+	if err != nil {
+		log.Printf("Error checking source of batch %s job %d: %v", batchID, i, err)
+	}
+	if resp.StatusCode != 0 {
+		return reject(errorMessage(resp))
+	}
+	if job.UploadSessionID == "" {
+		if valid, resp := validateRawSourceContentType(job, source); !valid {
+			return reject(errorMessage(resp))
+		}
+	}
+	job.Source = source
+
+	message := createConversionMessage(job, route, job.ToFileType, "")
+	message["batchId"] = batchID
+	if err := putPendingJob(ctx, dynamoClient, message, nil, job.Source); err != nil {
+		log.Printf("Error recording batch %s job %d: %v", batchID, i, err)
+		return reject("Error recording job")
+	}
+	result.JobID = message["jobId"]
+	return preparedBatchJob{result: result, message: message, queueURL: route.QueueURL}
+}
+
+// sendConversionBatch enqueues messages in chunks of 10 and returns the error
+// for every message that could not be sent, keyed by jobId
+func sendConversionBatch(ctx context.Context, sqsClient SQSClient, queueURL string, messages []map[string]string) (map[string]error, error) {
+	failed := map[string]error{}
+	var lastErr error
+	for start := 0; start < len(messages); start += maxSendMessageBatchEntries {
+		chunk := messages[start:min(start+maxSendMessageBatchEntries, len(messages))]
+		entries := make([]sqstypes.SendMessageBatchRequestEntry, 0, len(chunk))
+		for _, message := range chunk {
+			messageBody, err := json.Marshal(message)
+			if err != nil {
+				failed[message["jobId"]] = err
+				continue
+			}
+			entries = append(entries, sqstypes.SendMessageBatchRequestEntry{
+				Id:          aws.String(message["jobId"]),
+				MessageBody: aws.String(string(messageBody)),
+			})
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		result, err := sqsClient.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(queueURL),
+			Entries:  entries,
+		})
+		if err != nil {
+			lastErr = err
+			for _, entry := range entries {
+				failed[aws.ToString(entry.Id)] = err
+			}
+			continue
+		}
+		for _, entry := range result.Failed {
+			lastErr = fmt.Errorf("%s: %s", aws.ToString(entry.Code), aws.ToString(entry.Message))
+			failed[aws.ToString(entry.Id)] = lastErr
+		}
+	}
+	return failed, lastErr
+}
+
+func HandlePostBatchRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest, sqsClient SQSClient, dynamoClient DynamoDBClient, s3Client S3Client) (events.APIGatewayV2HTTPResponse, error) {
+	if valid, resp := validateContentType(request.Headers[contentTypeHeader]); !valid {
+		return resp, nil
+	}
+
+	apiKeyResp, err := helpers.ValidateHttpAPIKey(request)
+	if err != nil {
+		return createErrorResponse(500, "Error validating API key"), err
+	}
+	if apiKeyResp.StatusCode != 0 {
+		return apiKeyResp, nil
+	}
+
+	var batch BatchConversionRequest
+	if err := json.Unmarshal([]byte(request.Body), &batch); err != nil {
+		return createErrorResponse(400, "Invalid request body"), nil
+	}
+	if len(batch.Jobs) == 0 {
+		return createErrorResponse(400, "At least one job is required"), nil
+	}
+	if len(batch.Jobs) > maxBatchJobs {
+		return createErrorResponse(400, fmt.Sprintf("A batch can contain at most %d jobs", maxBatchJobs)), nil
+	}
+
+	response := BatchPostResponse{
+		BatchID: uuid.New().String(),
+		Results: make([]BatchItemResult, len(batch.Jobs)),
+	}
+
+	// Items are independent until they are sent, so their checks and pending
+	// rows run concurrently. Results are collected by index, which keeps the
+	// order messages are sent in the order of the request.
+	prepared := make([]preparedBatchJob, len(batch.Jobs))
+	var group errgroup.Group
+	group.SetLimit(batchConcurrency)
+	tenantID := helpers.APIKeyTenant(request.Headers["x-api-key"])
+	for i, job := range batch.Jobs {
+		job.TenantID = tenantID
+		group.Go(func() error {
+			prepared[i] = prepareBatchJob(ctx, dynamoClient, s3Client, response.BatchID, i, job)
+			return nil
+		})
+	}
+	group.Wait()
+
+	var messages []map[string]string
+	// Jobs are sent to the queue of the backend their converter runs on
+	queueMessages := map[string][]map[string]string{}
+	messageIndexes := map[string]int{}
+	for i, item := range prepared {
+		response.Results[i] = item.result
+		if item.message == nil {
+			continue
+		}
+		messages = append(messages, item.message)
+		queueMessages[item.queueURL] = append(queueMessages[item.queueURL], item.message)
+		messageIndexes[item.message["jobId"]] = i
+	}
+
+	failed := map[string]error{}
+	var sendErr error
+	for queueURL, queued := range queueMessages {
+		queueFailed, err := sendConversionBatch(ctx, sqsClient, queueURL, queued)
+		for jobID, err := range queueFailed {
+			failed[jobID] = err
+		}
+		if err != nil {
+			sendErr = err
+		}
+	}
+	group = errgroup.Group{}
+	group.SetLimit(batchConcurrency)
+	for _, message := range messages {
+		jobID := message["jobId"]
+		result := &response.Results[messageIndexes[jobID]]
+		if err, ok := failed[jobID]; ok {
+			log.Printf("Error sending batch %s job %s: %v", response.BatchID, jobID, err)
+			result.Status = "rejected"
+			result.JobID = ""
+			result.Error = "Error sending message to queue"
+			group.Go(func() error {
+				if err := discardPendingJob(ctx, dynamoClient, jobID); err != nil {
+					log.Printf("Error rolling back pending job %s, it will expire on its own: %v", jobID, err)
+				}
+				return nil
+			})
+			continue
+		}
+
+		result.Status = "accepted"
+		group.Go(func() error {
+			if err := confirmPendingJob(ctx, dynamoClient, jobID); err != nil {
+				// The job is queued either way, and the worker's notification clears the expiry
+				log.Printf("Error confirming pending job %s: %v", jobID, err)
+			}
+			return nil
+		})
+	}
+	group.Wait()
+
+	for _, result := range response.Results {
+		if result.Status == "accepted" {
+			response.Accepted++
+		} else {
+			response.Rejected++
+		}
+	}
+
+	if response.Accepted == 0 {
+		if sendErr != nil {
+			return createSuccessResponse(500, response), sendErr
+		}
+		return createSuccessResponse(400, response), nil
+	}
+	return createSuccessResponse(202, response), nil
+}
+
+/*
+###########################################
+GET /v1/3d-model/batch/{batchId}
+###########################################
+*/
+
+func listBatchJobs(ctx context.Context, dynamoClient DynamoDBClient, batchID string) ([]ModelMetadata, error) {
+	var jobs []ModelMetadata
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		result, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(os.Getenv("job_history_table")),
+			IndexName:              aws.String("BatchIndex"),
+			KeyConditionExpression: aws.String("batchId = :batchId"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":batchId": &types.AttributeValueMemberS{Value: batchID},
+			},
+			ExclusiveStartKey: lastEvaluatedKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range result.Items {
+			jobs = append(jobs, modelMetadataFromItem(item))
+		}
+		if result.LastEvaluatedKey == nil {
+			return jobs, nil
+		}
+		lastEvaluatedKey = result.LastEvaluatedKey
+	}
+}
+
+func HandleGetBatchRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest, dynamoClient DynamoDBClient) (events.APIGatewayV2HTTPResponse, error) {
+	apiKeyResp, err := helpers.ValidateHttpAPIKey(request)
+	if err != nil {
+		return createErrorResponse(500, "Error validating API key"), err
+	}
+	if apiKeyResp.StatusCode != 0 {
+		return apiKeyResp, nil
+	}
+
+	batchID := request.PathParameters["batchId"]
+	if batchID == "" {
+		return createErrorResponse(400, "Batch id is required"), nil
+	}
+
+	jobs, err := listBatchJobs(ctx, dynamoClient, batchID)
+	if err != nil {
+		return createErrorResponse(500, "Failed to query batch jobs"), err
+	}
+	if len(jobs) == 0 {
+		return createErrorResponse(404, fmt.Sprintf("Batch %s not found", batchID)), nil
+	}
+
+	response := BatchProgressResponse{BatchID: batchID, Total: len(jobs), Jobs: jobs}
+	for _, job := range jobs {
+		switch job.JobStatus {
+		case "pending":
+			response.Pending++
+		case "completed", "completed_with_warnings":
+			response.Completed++
+		case "cancelled":
+			response.Cancelled++
+		default:
+			response.Failed++
+		}
+	}
+
+	switch {
+	case response.Pending > 0:
+		response.Status = "pending"
+	case response.Failed == 0 && response.Cancelled == 0:
+		response.Status = "completed"
+	case response.Completed == 0 && response.Failed == 0:
+		response.Status = "cancelled"
+	case response.Completed == 0:
+		response.Status = "failed"
+	default:
+		response.Status = "partially_completed"
+	}
+	return createSuccessResponse(200, response), nil
+}
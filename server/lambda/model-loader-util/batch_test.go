@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newBatchRequest(jobs []ConversionJob) events.APIGatewayV2HTTPRequest {
+	body, _ := json.Marshal(BatchConversionRequest{Jobs: jobs})
+	return events.APIGatewayV2HTTPRequest{
+		Headers: map[string]string{
+			"x-api-key":    "test-api-key",
+			"Content-Type": "application/json",
+		},
+		Body: string(body),
+	}
+}
+
+func newBatchJobs(count int) []ConversionJob {
+	jobs := make([]ConversionJob, 0, count)
+	for i := 0; i < count; i++ {
+		jobs = append(jobs, ConversionJob{
+			ConnectionID: "test-connection-id",
+			FromFileType: "blend",
+			ToFileType:   "glb",
+			ModelID:      fmt.Sprintf("model-%d", i),
+			S3Key:        fmt.Sprintf("blend/model-%d.blend", i),
+		})
+	}
+	return jobs
+}
+
+func batchSourceKeys(count int) []string {
+	keys := make([]string, 0, count)
+	for _, job := range newBatchJobs(count) {
+		keys = append(keys, job.S3Key)
+	}
+	return keys
+}
+
+func TestHandlePostBatchRequest_SendsInChunksOfTen(t *testing.T) {
+	setupTestEnv(t)
+
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{}
+
+	resp, err := HandlePostBatchRequest(context.Background(), newBatchRequest(newBatchJobs(23)), mockSQS, mockDynamo, newSourceS3Client(batchSourceKeys(23)...))
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	var response BatchPostResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+	assert.NotEmpty(t, response.BatchID)
+	assert.Equal(t, 23, response.Accepted)
+	assert.Equal(t, 0, response.Rejected)
+	assert.Len(t, response.Results, 23)
+
+	assert.Len(t, mockSQS.sendMessageBatchInputs, 3)
+	assert.Len(t, mockSQS.sendMessageBatchInputs[0].Entries, 10)
+	assert.Len(t, mockSQS.sendMessageBatchInputs[2].Entries, 3)
+	assert.Empty(t, mockSQS.sendMessageInputs)
+
+	var messageBody map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(*mockSQS.sendMessageBatchInputs[0].Entries[0].MessageBody), &messageBody))
+	assert.Equal(t, response.BatchID, messageBody["batchId"])
+	assert.Equal(t, response.Results[0].JobID, messageBody["jobId"])
+
+	assert.Len(t, mockDynamo.putItemInputs, 23)
+	assert.Equal(t, response.BatchID, mockDynamo.putItemInputs[0].Item["batchId"].(*types.AttributeValueMemberS).Value)
+	assert.Len(t, mockDynamo.updateItemInputs, 23)
+}
+
+func TestHandlePostBatchRequest_ReportsRejectedItems(t *testing.T) {
+	setupTestEnv(t)
+
+	jobs := newBatchJobs(3)
+	jobs[1].ToFileType = "step"
+	jobs[2].S3Key = ""
+
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{}
+
+	resp, err := HandlePostBatchRequest(context.Background(), newBatchRequest(jobs), mockSQS, mockDynamo, newSourceS3Client(batchSourceKeys(3)...))
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	var response BatchPostResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+	assert.Equal(t, 1, response.Accepted)
+	assert.Equal(t, 2, response.Rejected)
+	assert.Equal(t, "accepted", response.Results[0].Status)
+	assert.Equal(t, "rejected", response.Results[1].Status)
+	assert.True(t, strings.HasPrefix(response.Results[1].Error, "Only "))
+	assert.Equal(t, "rejected", response.Results[2].Status)
+	assert.Equal(t, "Missing required fields: s3Key", response.Results[2].Error)
+
+	assert.Len(t, mockSQS.sendMessageBatchInputs, 1)
+	assert.Len(t, mockSQS.sendMessageBatchInputs[0].Entries, 1)
+	assert.Len(t, mockDynamo.putItemInputs, 1)
+}
+
+func TestHandlePostBatchRequest_FailedEntriesAreRolledBack(t *testing.T) {
+	setupTestEnv(t)
+
+	mockSQS := &mockSQSClient{sendMessageBatchFailed: map[int]bool{2: true}}
+	mockDynamo := &mockDynamoDBClient{}
+
+	resp, err := HandlePostBatchRequest(context.Background(), newBatchRequest(newBatchJobs(2)), mockSQS, mockDynamo, newSourceS3Client(batchSourceKeys(2)...))
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	var response BatchPostResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+	assert.Equal(t, 1, response.Accepted)
+	assert.Equal(t, "accepted", response.Results[0].Status)
+	assert.Equal(t, "rejected", response.Results[1].Status)
+	assert.Empty(t, response.Results[1].JobID)
+	assert.Equal(t, "Error sending message to queue", response.Results[1].Error)
+
+	assert.Len(t, mockDynamo.deleteItemInputs, 1)
+	assert.Len(t, mockDynamo.updateItemInputs, 1)
+}
+
+func TestHandlePostBatchRequest_QueueError_Returns500(t *testing.T) {
+	setupTestEnv(t)
+
+	mockSQS := &mockSQSClient{sendMessageBatchErr: errors.New("SQS error")}
+	mockDynamo := &mockDynamoDBClient{}
+
+	resp, err := HandlePostBatchRequest(context.Background(), newBatchRequest(newBatchJobs(2)), mockSQS, mockDynamo, newSourceS3Client(batchSourceKeys(2)...))
+	assert.Error(t, err)
+	assert.Equal(t, 500, resp.StatusCode)
+	assert.Len(t, mockDynamo.deleteItemInputs, 2)
+}
+
+func TestHandlePostBatchRequest_FullBatchReportsEveryItem(t *testing.T) {
+	setupTestEnv(t)
+
+	jobs := newBatchJobs(maxBatchJobs)
+	jobs[3].ToFileType = "step"
+	// The last ten sources were never uploaded
+	keys := batchSourceKeys(maxBatchJobs)[:maxBatchJobs-10]
+	// Two entries of the second chunk fail to send
+	mockSQS := &mockSQSClient{sendMessageBatchFailed: map[int]bool{12: true, 15: true}}
+	mockDynamo := &mockDynamoDBClient{}
+
+	resp, err := HandlePostBatchRequest(context.Background(), newBatchRequest(jobs), mockSQS, mockDynamo, newSourceS3Client(keys...))
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	var response BatchPostResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+	assert.Len(t, response.Results, maxBatchJobs)
+	assert.Equal(t, maxBatchJobs-13, response.Accepted)
+	assert.Equal(t, 13, response.Rejected)
+	for i, result := range response.Results {
+		assert.Equal(t, i, result.Index)
+		assert.Equal(t, result.Status == "accepted", result.JobID != "", i)
+	}
+	assert.Equal(t, "rejected", response.Results[3].Status)
+	assert.Equal(t, "rejected", response.Results[maxBatchJobs-1].Status)
+	assert.Len(t, mockDynamo.putItemInputs, maxBatchJobs-11)
+	assert.Len(t, mockDynamo.deleteItemInputs, 2)
+	assert.Len(t, mockDynamo.updateItemInputs, maxBatchJobs-13)
+}
+
+func TestHandlePostBatchRequest_TooManyJobs_Returns400(t *testing.T) {
+	setupTestEnv(t)
+
+	mockSQS := &mockSQSClient{}
+	resp, err := HandlePostBatchRequest(context.Background(), newBatchRequest(newBatchJobs(maxBatchJobs+1)), mockSQS, &mockDynamoDBClient{}, &mockS3Client{})
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Empty(t, mockSQS.sendMessageBatchInputs)
+}
+
+func TestHandleGetBatchRequest_AggregatesProgress(t *testing.T) {
+	setupTestEnv(t)
+
+	mockDynamo := &mockDynamoDBClient{
+		queryOutput: &dynamodb.QueryOutput{
+			Items: []map[string]types.AttributeValue{
+				jobItem("job-1", "completed"),
+				jobItem("job-2", "failed"),
+				jobItem("job-3", "pending"),
+			},
+		},
+	}
+	req := events.APIGatewayV2HTTPRequest{
+		Headers:        map[string]string{"x-api-key": "test-api-key"},
+		PathParameters: map[string]string{"batchId": "test-batch-id"},
+	}
+
+	resp, err := HandleGetBatchRequest(context.Background(), req, mockDynamo)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var response BatchProgressResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+	assert.Equal(t, "pending", response.Status)
+	assert.Equal(t, 3, response.Total)
+	assert.Equal(t, 1, response.Pending)
+	assert.Equal(t, 1, response.Completed)
+	assert.Equal(t, 1, response.Failed)
+}
+
+func TestHandleGetBatchRequest_NotFound_Returns404(t *testing.T) {
+	setupTestEnv(t)
+
+	req := events.APIGatewayV2HTTPRequest{
+		Headers:        map[string]string{"x-api-key": "test-api-key"},
+		PathParameters: map[string]string{"batchId": "test-batch-id"},
+	}
+
+	resp, err := HandleGetBatchRequest(context.Background(), req, &mockDynamoDBClient{queryOutput: &dynamodb.QueryOutput{}})
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const downloadURLExpiry = 24 * time.Hour
+
+func jobArtifacts(job ModelMetadata) []Artifact {
+	if len(job.Artifacts) > 0 {
+		return job.Artifacts
+	}
+	// Jobs that finished before manifests were recorded only know their main output
+	return []Artifact{{Path: path.Base(job.NewS3Key), S3Key: job.NewS3Key}}
+}
+
+func bundleObjectKey(job ModelMetadata) string {
+	return fmt.Sprintf("bundles/%s/%s.zip", job.ModelID, job.JobID)
+}
+
+// presignArtifactURLs maps each artifact's relative path to a presigned URL, so
+// a viewer can resolve the relative URIs inside a .gltf or .mtl file
+func presignArtifactURLs(ctx context.Context, presignClient PresignClient, bucket string, artifacts []Artifact) (map[string]string, error) {
+	files := make(map[string]string, len(artifacts))
+	for _, artifact := range artifacts {
+		presignedURL, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(artifact.S3Key),
+		}, s3.WithPresignExpires(downloadURLExpiry))
+		if err != nil {
+			return nil, err
+		}
+		files[artifact.Path] = presignedURL.URL
+	}
+	return files, nil
+}
+
+func writeArtifactZip(ctx context.Context, s3Client S3Client, bucket string, artifacts []Artifact, w io.Writer) error {
+	zipWriter := zip.NewWriter(w)
+	for _, artifact := range artifacts {
+		object, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(artifact.S3Key),
+		})
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", artifact.S3Key, err)
+		}
+
+		entry, err := zipWriter.Create(artifact.Path)
+		if err != nil {
+			object.Body.Close()
+			return err
+		}
+		digest := sha256.New()
+		_, err = io.Copy(entry, io.TeeReader(object.Body, digest))
+		object.Body.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", artifact.S3Key, err)
+		}
+		if artifact.SHA256 != "" && hex.EncodeToString(digest.Sum(nil)) != artifact.SHA256 {
+			return fmt.Errorf("%s does not match the sha256 in the job manifest", artifact.S3Key)
+		}
+	}
+	return zipWriter.Close()
+}
+
+// createArtifactBundle zips every artifact of a job into a single object and
+// returns its key. Bundles are immutable per job, so an existing one is reused.
+func createArtifactBundle(ctx context.Context, s3Client S3Client, bucket string, job ModelMetadata) (string, error) {
+	key := bundleObjectKey(job)
+	_, err := s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err == nil {
+		return key, nil
+	}
+	var notFound *s3types.NotFound
+	if !errors.As(err, &notFound) {
+		return "", err
+	}
+
+	// Lambda memory is small, so the archive is staged in /tmp rather than in memory
+	file, err := os.CreateTemp("", "bundle-*.zip")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := writeArtifactZip(ctx, s3Client, bucket, jobArtifacts(job), file); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        file,
+		ContentType: aws.String("application/zip"),
+	})
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func sha256Hex(content string) string {
+	digest := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(digest[:])
+}
+
+func gltfArtifactItem(gltfHash string) map[string]types.AttributeValue {
+	artifact := func(path string, hash string) types.AttributeValue {
+		return &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"path":   &types.AttributeValueMemberS{Value: path},
+			"s3Key":  &types.AttributeValueMemberS{Value: "gltf/test-model-id/" + path},
+			"size":   &types.AttributeValueMemberN{Value: "4"},
+			"sha256": &types.AttributeValueMemberS{Value: hash},
+		}}
+	}
+	return map[string]types.AttributeValue{
+		"jobId":     &types.AttributeValueMemberS{Value: "test-job-id"},
+		"modelId":   &types.AttributeValueMemberS{Value: "test-model-id"},
+		"newS3Key":  &types.AttributeValueMemberS{Value: "gltf/test-model-id/test-model-id.gltf"},
+		"timestamp": &types.AttributeValueMemberS{Value: "2025-01-01T00:00:00Z"},
+		"artifacts": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+			artifact("test-model-id.gltf", gltfHash),
+			artifact("test-model-id.bin", sha256Hex("BIN!")),
+			artifact("textures/albedo.png", sha256Hex("PNG!")),
+		}},
+	}
+}
+
+func newBundleRequest(bundle string) events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{
+		Headers: map[string]string{
+			"x-api-key": "test-api-key",
+		},
+		PathParameters: map[string]string{
+			"id": "test-model-id",
+		},
+		QueryStringParameters: map[string]string{
+			"fileType": "gltf",
+			"bundle":   bundle,
+		},
+	}
+}
+
+func newBundleS3Client() *mockS3Client {
+	return &mockS3Client{
+		contents: map[string]string{
+			"gltf/test-model-id/test-model-id.gltf":  "GLTF",
+			"gltf/test-model-id/test-model-id.bin":   "BIN!",
+			"gltf/test-model-id/textures/albedo.png": "PNG!",
+		},
+	}
+}
+
+func TestModelMetadataFromItem_ParsesArtifacts(t *testing.T) {
+	job := modelMetadataFromItem(gltfArtifactItem("gltf-hash"))
+
+	assert.Len(t, job.Artifacts, 3)
+	assert.Equal(t, Artifact{
+		Path:   "test-model-id.gltf",
+		S3Key:  "gltf/test-model-id/test-model-id.gltf",
+		Size:   4,
+		SHA256: "gltf-hash",
+	}, job.Artifacts[0])
+}
+
+func TestHandleGetModelRequest_BundleURLs(t *testing.T) {
+	setupTestEnv(t)
+
+	mockDynamo := &mockDynamoDBClient{
+		queryOutput: &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{gltfArtifactItem(sha256Hex("GLTF"))}},
+	}
+
+	resp, err := HandleGetModelRequest(context.Background(), newBundleRequest("urls"), mockDynamo, newBundleS3Client(), newTestPresignClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var response SuccessGetModelResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+	assert.Regexp(t, `/gltf/test-model-id/test-model-id\.gltf\?`, response.PresignedUrl)
+	assert.Len(t, response.Files, 3)
+	assert.Regexp(t, `/gltf/test-model-id/test-model-id\.bin\?`, response.Files["test-model-id.bin"])
+	assert.Regexp(t, `/gltf/test-model-id/textures/albedo\.png\?`, response.Files["textures/albedo.png"])
+}
+
+func TestHandleGetModelRequest_BundleZip(t *testing.T) {
+	setupTestEnv(t)
+
+	mockDynamo := &mockDynamoDBClient{
+		queryOutput: &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{gltfArtifactItem(sha256Hex("GLTF"))}},
+	}
+	mockS3 := newBundleS3Client()
+
+	resp, err := HandleGetModelRequest(context.Background(), newBundleRequest("zip"), mockDynamo, mockS3, newTestPresignClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Regexp(t, `/bundles/test-model-id/test-job-id\.zip\?`, resp.Body)
+
+	body := mockS3.putObjectBodies["bundles/test-model-id/test-job-id.zip"]
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	assert.NoError(t, err)
+	files := map[string]string{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		assert.NoError(t, err)
+		content, _ := io.ReadAll(reader)
+		files[file.Name] = string(content)
+	}
+	assert.Equal(t, map[string]string{
+		"test-model-id.gltf":  "GLTF",
+		"test-model-id.bin":   "BIN!",
+		"textures/albedo.png": "PNG!",
+	}, files)
+}
+
+func TestHandleGetModelRequest_BundleZipReusesExistingBundle(t *testing.T) {
+	setupTestEnv(t)
+
+	mockDynamo := &mockDynamoDBClient{
+		queryOutput: &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{gltfArtifactItem(sha256Hex("GLTF"))}},
+	}
+	mockS3 := newBundleS3Client()
+	mockS3.contents["bundles/test-model-id/test-job-id.zip"] = "ZIP"
+
+	resp, err := HandleGetModelRequest(context.Background(), newBundleRequest("zip"), mockDynamo, mockS3, newTestPresignClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Empty(t, mockS3.putObjectInputs)
+}
+
+func TestHandleGetModelRequest_BundleZipHashMismatch_Returns500(t *testing.T) {
+	setupTestEnv(t)
+
+	mockDynamo := &mockDynamoDBClient{
+		queryOutput: &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{gltfArtifactItem(sha256Hex("something else"))}},
+	}
+	mockS3 := newBundleS3Client()
+
+	resp, err := HandleGetModelRequest(context.Background(), newBundleRequest("zip"), mockDynamo, mockS3, newTestPresignClient())
+	assert.Error(t, err)
+	assert.Equal(t, 500, resp.StatusCode)
+	assert.Empty(t, mockS3.putObjectInputs)
+}
+
+func TestHandleGetModelRequest_InvalidBundle_Returns400(t *testing.T) {
+	setupTestEnv(t)
+
+	resp, err := HandleGetModelRequest(context.Background(), newBundleRequest("tar"), &mockDynamoDBClient{}, newBundleS3Client(), newTestPresignClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
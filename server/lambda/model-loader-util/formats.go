@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/converters"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/helpers"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// InputFormat is a file type conversions can start from
+type InputFormat struct {
+	Format string `json:"format"`
+	// Extension is what the source object key ends with
+	Extension    string   `json:"extension"`
+	ContentTypes []string `json:"contentTypes"`
+	// Outputs are the toFileTypes this format can be converted to
+	Outputs []string `json:"outputs"`
+}
+
+type FormatsResponse struct {
+	Inputs  []InputFormat `json:"inputs"`
+	Outputs []string      `json:"outputs"`
+	// Converters describe the backend, options and limits of every pair
+	Converters []converters.Converter `json:"converters"`
+}
+
+// knownInputFormats are every format a converter reads, with the outputs they
+// convert to unless input_format_matrix says otherwise. gltf sources are
+// single files that embed their buffers and textures, multi-file glTF assets
+// are uploaded zipped as gltf-zip.
+var knownInputFormats = []InputFormat{
+	{Format: "blend", Extension: "blend", ContentTypes: []string{"application/octet-stream", "application/x-blender"}, Outputs: registeredOutputs("blend")},
+	{Format: "blend-zip", Extension: "zip", ContentTypes: []string{"application/zip", "application/x-zip-compressed", "application/octet-stream"}, Outputs: registeredOutputs("blend-zip")},
+	{Format: "fbx", Extension: "fbx", ContentTypes: []string{"application/octet-stream"}, Outputs: registeredOutputs("fbx")},
+	{Format: "obj", Extension: "obj", ContentTypes: []string{"model/obj", "text/plain", "application/octet-stream"}, Outputs: registeredOutputs("obj")},
+	{Format: "gltf", Extension: "gltf", ContentTypes: []string{"model/gltf+json", "application/json"}, Outputs: registeredOutputs("gltf")},
+	{Format: "gltf-zip", Extension: "zip", ContentTypes: []string{"application/zip", "application/x-zip-compressed", "application/octet-stream"}, Outputs: registeredOutputs("gltf-zip")},
+	{Format: "glb", Extension: "glb", ContentTypes: []string{"model/gltf-binary", "application/octet-stream"}, Outputs: registeredOutputs("glb")},
+	{Format: "stl", Extension: "stl", ContentTypes: []string{"model/stl", "application/sla", "application/octet-stream"}, Outputs: registeredOutputs("stl")},
+	{Format: "ply", Extension: "ply", ContentTypes: []string{"application/ply", "text/plain", "application/octet-stream"}, Outputs: registeredOutputs("ply")},
+	{Format: "3mf", Extension: "3mf", ContentTypes: []string{"model/3mf", "application/vnd.ms-package.3dmanufacturing-3dmodel+xml", "application/zip", "application/octet-stream"}, Outputs: registeredOutputs("3mf")},
+	{Format: "usd", Extension: "usd", ContentTypes: []string{"application/octet-stream"}, Outputs: registeredOutputs("usd")},
+	{Format: "usdz", Extension: "usdz", ContentTypes: []string{"model/vnd.usdz+zip", "application/octet-stream"}, Outputs: registeredOutputs("usdz")},
+}
+
+// registeredOutputs are the output formats a converter is registered for
+func registeredOutputs(format string) []string {
+	var outputs []string
+	for _, output := range supportedOutputFormats {
+		if _, ok := converters.Default.Lookup(format, output); ok {
+			outputs = append(outputs, output)
+		}
+	}
+	return outputs
+}
+
+func knownInputFormat(format string) (InputFormat, bool) {
+	for _, input := range knownInputFormats {
+		if input.Format == format {
+			return input, true
+		}
+	}
+	return InputFormat{}, false
+}
+
+// parseFormatMatrix reads a JSON object from input format to the outputs it
+// may be converted to. Formats left out of the object are not accepted.
+func parseFormatMatrix(value string) (map[string][]string, error) {
+	var matrix map[string][]string
+	if err := json.Unmarshal([]byte(value), &matrix); err != nil {
+		return nil, err
+	}
+	if len(matrix) == 0 {
+		return nil, fmt.Errorf("no input formats")
+	}
+	for input, outputs := range matrix {
+		if _, ok := knownInputFormat(input); !ok {
+			return nil, fmt.Errorf("unknown input format %s", input)
+		}
+		if len(outputs) == 0 {
+			return nil, fmt.Errorf("%s has no outputs", input)
+		}
+		for _, output := range outputs {
+			if !slices.Contains(supportedOutputFormats, output) {
+				return nil, fmt.Errorf("unknown output format %s", output)
+			}
+			if _, ok := converters.Default.Lookup(input, output); !ok {
+				return nil, fmt.Errorf("no converter from %s to %s", input, output)
+			}
+		}
+	}
+	return matrix, nil
+}
+
+// inputFormats returns the accepted input formats, restricted by the
+// input_format_matrix environment variable when it is set
+func inputFormats() []InputFormat {
+	value := os.Getenv("input_format_matrix")
+	if value == "" {
+		return knownInputFormats
+	}
+	matrix, err := parseFormatMatrix(value)
+	if err != nil {
+		log.Printf("Invalid input_format_matrix %q, using the default formats: %v", value, err)
+		return knownInputFormats
+	}
+
+	var inputs []InputFormat
+	for _, input := range knownInputFormats {
+		outputs, ok := matrix[input.Format]
+		if !ok {
+			continue
+		}
+		// Outputs keep the order of supportedOutputFormats
+		input.Outputs = nil
+		for _, output := range supportedOutputFormats {
+			if slices.Contains(outputs, output) {
+				input.Outputs = append(input.Outputs, output)
+			}
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs
+}
+
+func inputFormat(format string) (InputFormat, bool) {
+	for _, input := range inputFormats() {
+		if input.Format == format {
+			return input, true
+		}
+	}
+	return InputFormat{}, false
+}
+
+// unsupportedInputMessage lists the accepted input formats
+func unsupportedInputMessage() string {
+	var formats []string
+	for _, input := range inputFormats() {
+		formats = append(formats, input.Format)
+	}
+	return fmt.Sprintf("Only %s files are supported", strings.Join(formats, ", "))
+}
+
+/*
+###########################################
+GET /v1/formats
+###########################################
+*/
+
+func HandleGetFormatsRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	apiKeyResp, err := helpers.ValidateHttpAPIKey(request)
+	if err != nil {
+		return createErrorResponse(500, "Error validating API key"), err
+	}
+	if apiKeyResp.StatusCode != 0 {
+		return apiKeyResp, nil
+	}
+
+	inputs := inputFormats()
+	var pairs []converters.Converter
+	for _, converter := range converters.Default.Converters() {
+		input, ok := inputFormat(converter.From)
+		if ok && slices.Contains(input.Outputs, converter.To) {
+			pairs = append(pairs, converter)
+		}
+	}
+	return createSuccessResponse(200, FormatsResponse{
+		Inputs:     inputs,
+		Outputs:    supportedOutputFormats,
+		Converters: pairs,
+	}), nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFormatsRequest() events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{
+		Headers: map[string]string{"x-api-key": "test-api-key"},
+		RawPath: "/v1/formats",
+	}
+}
+
+func getFormats(t *testing.T) FormatsResponse {
+	resp, err := HandleGetFormatsRequest(context.Background(), newFormatsRequest())
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var response FormatsResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+	return response
+}
+
+func TestHandleGetFormatsRequest_Default(t *testing.T) {
+	setupTestEnv(t)
+
+	response := getFormats(t)
+	assert.Equal(t, supportedOutputFormats, response.Outputs)
+	assert.Len(t, response.Inputs, len(knownInputFormats))
+
+	fbx := response.Inputs[2]
+	assert.Equal(t, "fbx", fbx.Format)
+	assert.Equal(t, "fbx", fbx.Extension)
+	assert.Equal(t, []string{"glb", "gltf", "obj", "usd", "usdz", "stl", "ply", "3mf"}, fbx.Outputs)
+}
+
+func TestHandleGetFormatsRequest_ConfiguredMatrix(t *testing.T) {
+	setupTestEnv(t)
+	t.Setenv("input_format_matrix", `{"stl": ["usdz", "glb"], "blend": ["glb"]}`)
+
+	response := getFormats(t)
+	assert.Len(t, response.Inputs, 2)
+	assert.Equal(t, "blend", response.Inputs[0].Format)
+	assert.Equal(t, []string{"glb"}, response.Inputs[0].Outputs)
+	assert.Equal(t, "stl", response.Inputs[1].Format)
+	assert.Equal(t, []string{"glb", "usdz"}, response.Inputs[1].Outputs)
+}
+
+func TestHandleGetFormatsRequest_RequiresAPIKey(t *testing.T) {
+	setupTestEnv(t)
+
+	request := newFormatsRequest()
+	request.Headers["x-api-key"] = "wrong-key"
+	resp, err := HandleGetFormatsRequest(context.Background(), request)
+	assert.NoError(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+}
+
+func TestParseFormatMatrix_Invalid(t *testing.T) {
+	for _, value := range []string{
+		`not json`,
+		`{}`,
+		`{"docx": ["glb"]}`,
+		`{"fbx": []}`,
+		`{"fbx": ["step"]}`,
+		`{"fbx": ["glb", "fbx"]}`,
+	} {
+		_, err := parseFormatMatrix(value)
+		assert.Error(t, err, value)
+	}
+
+	// An invalid matrix falls back to every known format
+	t.Setenv("input_format_matrix", `{"fbx": ["step"]}`)
+	assert.Equal(t, knownInputFormats, inputFormats())
+}
+
+func TestHandlePostRequest_InputFormatMatrix(t *testing.T) {
+	setupTestEnv(t)
+
+	newRequest := func(fromFileType string, toFileType string) events.APIGatewayV2HTTPRequest {
+		request := newPreflightPostRequest()
+		request.Body = strings.NewReplacer(
+			`"fromFileType": "blend"`, `"fromFileType": "`+fromFileType+`"`,
+			`"toFileType": "glb"`, `"toFileType": "`+toFileType+`"`,
+			`"s3Key": "blend/test-model-id.blend"`, `"s3Key": "`+sourceObjectKey("test-model-id", fromFileType)+`"`,
+		).Replace(request.Body)
+		return request
+	}
+	mockS3 := &mockS3Client{contents: map[string]string{
+		"fbx/test-model-id.fbx": "Kaydara FBX Binary  \x00",
+		"stl/test-model-id.stl": "solid cube",
+	}}
+
+	resp, err := HandlePostRequest(context.Background(), newRequest("fbx", "obj"), &mockSQSClient{}, &mockDynamoDBClient{}, mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	resp, err = HandlePostRequest(context.Background(), newRequest("fbx", "fbx"), &mockSQSClient{}, &mockDynamoDBClient{}, mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Equal(t, `{"error":"fbx files cannot be converted to fbx, only to glb, gltf, obj, usd, usdz, stl, ply, 3mf"}`, resp.Body)
+
+	t.Setenv("input_format_matrix", `{"blend": ["glb"]}`)
+	resp, err = HandlePostRequest(context.Background(), newRequest("stl", "glb"), &mockSQSClient{}, &mockDynamoDBClient{}, mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Equal(t, `{"error":"Only blend files are supported"}`, resp.Body)
+}
+
+func TestPreflightSourceObject_SniffsFormats(t *testing.T) {
+	setupTestEnv(t)
+
+	tests := []struct {
+		fileType string
+		content  string
+		valid    bool
+	}{
+		{"glb", "glTF\x02\x00\x00\x00", true},
+		{"glb", "{\"asset\":{}}", false},
+		{"usd", "#usda 1.0\n", true},
+		{"usd", "PXR-USDC", true},
+		{"usdz", "PK\x03\x04", true},
+		{"usdz", "<html>", false},
+	}
+	for _, tt := range tests {
+		job := ConversionJob{ModelID: "test-model-id", FromFileType: tt.fileType, S3Key: sourceObjectKey("test-model-id", tt.fileType)}
+		mockS3 := &mockS3Client{contents: map[string]string{job.S3Key: tt.content}}
+
+		source, resp, err := preflightSourceObject(context.Background(), mockS3, job, maxUploadSize())
+		assert.NoError(t, err)
+		if tt.valid {
+			assert.NotNil(t, source, tt.content)
+		} else {
+			assert.Equal(t, 400, resp.StatusCode, tt.content)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	defaultIdempotencyWindow  = 24 * time.Hour
+	idempotencyStatusPending  = "in_progress"
+	idempotencyStatusComplete = "completed"
+)
+
+// A claim left behind by a Lambda that died mid-request can be taken over once
+// it is older than the Lambda timeout
+const idempotencyLockDuration = 60 * time.Second
+
+// headerValue looks up a header case-insensitively, API Gateway forwards
+// headers in whatever case the client sent them
+func headerValue(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+func idempotencyWindow() time.Duration {
+	hoursStr := os.Getenv("idempotency_window_hours")
+	if hoursStr == "" {
+		return defaultIdempotencyWindow
+	}
+	hours, err := strconv.Atoi(hoursStr)
+	if err != nil || hours <= 0 {
+		log.Printf("Invalid idempotency_window_hours %q, using %s", hoursStr, defaultIdempotencyWindow)
+		return defaultIdempotencyWindow
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// conversionRequestHash hashes the decoded job rather than the raw body, so
+// a retry that only differs in whitespace or key order is still a replay
+func conversionRequestHash(job ConversionJob) string {
+	// The tenant is part of the request, so another tenant reusing a key
+	// never gets this tenant's response
+	body, _ := json.Marshal(struct {
+		ConversionJob
+		TenantID string `json:"tenantId,omitempty"`
+	}{job, job.TenantID})
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+func idempotencyItemKey(key string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"idempotencyKey": &types.AttributeValueMemberS{Value: key},
+	}
+}
+
+// claimIdempotencyKey records that a request with this key is being processed.
+// When the key is already taken it returns the response the caller should get
+// instead of processing the request again.
+func claimIdempotencyKey(ctx context.Context, dynamoClient DynamoDBClient, key string, requestHash string) (*events.APIGatewayV2HTTPResponse, error) {
+	tableName := os.Getenv("idempotency_table")
+	now := time.Now()
+	_, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item: map[string]types.AttributeValue{
+			"idempotencyKey": &types.AttributeValueMemberS{Value: key},
+			"requestHash":    &types.AttributeValueMemberS{Value: requestHash},
+			"status":         &types.AttributeValueMemberS{Value: idempotencyStatusPending},
+			"lockedUntil":    &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(idempotencyLockDuration).Unix(), 10)},
+			"expiresAt":      &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(idempotencyWindow()).Unix(), 10)},
+		},
+		// TTL deletion can lag by days, so expired keys are treated as free
+		ConditionExpression: aws.String("attribute_not_exists(idempotencyKey) OR expiresAt < :now OR (#status = :pending AND lockedUntil < :now AND requestHash = :requestHash)"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now":         &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+			":pending":     &types.AttributeValueMemberS{Value: idempotencyStatusPending},
+			":requestHash": &types.AttributeValueMemberS{Value: requestHash},
+		},
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if err == nil || !errors.As(err, &conditionErr) {
+		return nil, err
+	}
+
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(tableName),
+		Key:            idempotencyItemKey(key),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		// Deleted by a failed request in the meantime, the client can simply retry
+		resp := createErrorResponse(409, "A request with this Idempotency-Key is still being processed")
+		return &resp, nil
+	}
+
+	if stringAttribute(result.Item, "requestHash") != requestHash {
+		resp := createErrorResponse(422, "Idempotency-Key has already been used with a different request body")
+		return &resp, nil
+	}
+	if stringAttribute(result.Item, "status") != idempotencyStatusComplete {
+		resp := createErrorResponse(409, "A request with this Idempotency-Key is still being processed")
+		return &resp, nil
+	}
+
+	statusCode := 202
+	if code, ok := result.Item["statusCode"].(*types.AttributeValueMemberN); ok {
+		statusCode, _ = strconv.Atoi(code.Value)
+	}
+	resp := events.APIGatewayV2HTTPResponse{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			contentTypeHeader:        jsonContentType,
+			idempotentReplayedHeader: "true",
+		},
+		Body: stringAttribute(result.Item, "responseBody"),
+	}
+	return &resp, nil
+}
+
+// completeIdempotencyKey stores the response of a request that queued jobs, so
+// replays within the window return it unchanged
+func completeIdempotencyKey(ctx context.Context, dynamoClient DynamoDBClient, key string, jobID string, response events.APIGatewayV2HTTPResponse) error {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(os.Getenv("idempotency_table")),
+		Key:              idempotencyItemKey(key),
+		UpdateExpression: aws.String("SET #status = :completed, jobId = :jobId, statusCode = :statusCode, responseBody = :responseBody REMOVE lockedUntil"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":completed":    &types.AttributeValueMemberS{Value: idempotencyStatusComplete},
+			":jobId":        &types.AttributeValueMemberS{Value: jobID},
+			":statusCode":   &types.AttributeValueMemberN{Value: strconv.Itoa(response.StatusCode)},
+			":responseBody": &types.AttributeValueMemberS{Value: response.Body},
+		},
+	})
+	return err
+}
+
+// releaseIdempotencyKey frees a key whose request did not queue anything, so
+// the client can retry with the same key
+func releaseIdempotencyKey(ctx context.Context, dynamoClient DynamoDBClient, key string) error {
+	_, err := dynamoClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(os.Getenv("idempotency_table")),
+		Key:                 idempotencyItemKey(key),
+		ConditionExpression: aws.String("#status = :pending"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending": &types.AttributeValueMemberS{Value: idempotencyStatusPending},
+		},
+	})
+	return err
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const idempotentConversionBody = `{
+	"connectionId": "test-connection-id",
+	"fromFileType": "blend",
+	"toFileType": "glb",
+	"modelId": "test-model-id",
+	"s3Key": "blend/test-model-id.blend"
+}`
+
+func newIdempotentPostRequest(key string, body string) events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{
+		Headers: map[string]string{
+			"x-api-key":       "test-api-key",
+			"Content-Type":    "application/json",
+			"idempotency-key": key,
+		},
+		Body: body,
+	}
+}
+
+func storedIdempotencyItem(t *testing.T, body string, status string, responseBody string) *dynamodb.GetItemOutput {
+	var job ConversionJob
+	assert.NoError(t, json.Unmarshal([]byte(body), &job))
+	item := map[string]types.AttributeValue{
+		"idempotencyKey": &types.AttributeValueMemberS{Value: "test-key"},
+		"requestHash":    &types.AttributeValueMemberS{Value: conversionRequestHash(job)},
+		"status":         &types.AttributeValueMemberS{Value: status},
+	}
+	if responseBody != "" {
+		item["statusCode"] = &types.AttributeValueMemberN{Value: "202"}
+		item["responseBody"] = &types.AttributeValueMemberS{Value: responseBody}
+	}
+	return &dynamodb.GetItemOutput{Item: item}
+}
+
+func TestHandlePostRequest_IdempotencyKey_RecordsResponse(t *testing.T) {
+	setupTestEnv(t)
+
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{}
+
+	resp, err := HandlePostRequest(context.Background(), newIdempotentPostRequest("test-key", idempotentConversionBody), mockSQS, mockDynamo, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	var response SuccessPostResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+
+	assert.Equal(t, "test-idempotency-table", *mockDynamo.putItemInputs[0].TableName)
+	assert.Equal(t, "test-key", mockDynamo.putItemInputs[0].Item["idempotencyKey"].(*types.AttributeValueMemberS).Value)
+
+	completed := mockDynamo.updateItemInputs[len(mockDynamo.updateItemInputs)-1]
+	assert.Equal(t, "test-idempotency-table", *completed.TableName)
+	assert.Equal(t, response.JobID, completed.ExpressionAttributeValues[":jobId"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, resp.Body, completed.ExpressionAttributeValues[":responseBody"].(*types.AttributeValueMemberS).Value)
+}
+
+func TestHandlePostRequest_IdempotencyKey_ReplaysStoredResponse(t *testing.T) {
+	setupTestEnv(t)
+
+	storedBody := `{"status":"Job successfully queued","jobId":"original-job-id"}`
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{
+		putItemTableErrs: map[string]error{"test-idempotency-table": &types.ConditionalCheckFailedException{}},
+		getItemOutputs:   []*dynamodb.GetItemOutput{storedIdempotencyItem(t, idempotentConversionBody, "completed", storedBody)},
+	}
+
+	// Same job, different formatting
+	body := `{"s3Key":"blend/test-model-id.blend","modelId":"test-model-id","toFileType":"glb","fromFileType":"blend","connectionId":"test-connection-id"}`
+	resp, err := HandlePostRequest(context.Background(), newIdempotentPostRequest("test-key", body), mockSQS, mockDynamo, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+	assert.Equal(t, storedBody, resp.Body)
+	assert.Equal(t, "true", resp.Headers[idempotentReplayedHeader])
+	assert.Empty(t, mockSQS.sendMessageInputs)
+}
+
+func TestHandlePostRequest_IdempotencyKey_ReplaysBeforePreflight(t *testing.T) {
+	setupTestEnv(t)
+
+	storedBody := `{"status":"Job successfully queued","jobId":"original-job-id"}`
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{
+		putItemTableErrs: map[string]error{"test-idempotency-table": &types.ConditionalCheckFailedException{}},
+		getItemOutputs:   []*dynamodb.GetItemOutput{storedIdempotencyItem(t, idempotentConversionBody, "completed", storedBody)},
+	}
+
+	// The source has been deleted since the original request, so preflight
+	// would now reject it
+	resp, err := HandlePostRequest(context.Background(), newIdempotentPostRequest("test-key", idempotentConversionBody), mockSQS, mockDynamo, &mockS3Client{})
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+	assert.Equal(t, storedBody, resp.Body)
+	assert.Empty(t, mockSQS.sendMessageInputs)
+}
+
+func TestHandlePostRequest_IdempotencyKey_DifferentBody_Returns422(t *testing.T) {
+	setupTestEnv(t)
+
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{
+		putItemTableErrs: map[string]error{"test-idempotency-table": &types.ConditionalCheckFailedException{}},
+		getItemOutputs:   []*dynamodb.GetItemOutput{storedIdempotencyItem(t, idempotentConversionBody, "completed", `{}`)},
+	}
+
+	body := `{"connectionId":"test-connection-id","fromFileType":"blend","toFileType":"usdz","modelId":"test-model-id","s3Key":"blend/test-model-id.blend"}`
+	resp, err := HandlePostRequest(context.Background(), newIdempotentPostRequest("test-key", body), mockSQS, mockDynamo, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 422, resp.StatusCode)
+	assert.Empty(t, mockSQS.sendMessageInputs)
+}
+
+func TestHandlePostRequest_IdempotencyKey_InProgress_Returns409(t *testing.T) {
+	setupTestEnv(t)
+
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{
+		putItemTableErrs: map[string]error{"test-idempotency-table": &types.ConditionalCheckFailedException{}},
+		getItemOutputs:   []*dynamodb.GetItemOutput{storedIdempotencyItem(t, idempotentConversionBody, "in_progress", "")},
+	}
+
+	resp, err := HandlePostRequest(context.Background(), newIdempotentPostRequest("test-key", idempotentConversionBody), mockSQS, mockDynamo, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 409, resp.StatusCode)
+	assert.Empty(t, mockSQS.sendMessageInputs)
+}
+
+func TestHandlePostRequest_IdempotencyKey_ReleasedWhenQueueFails(t *testing.T) {
+	setupTestEnv(t)
+
+	mockSQS := &mockSQSClient{sendMessageErr: errors.New("SQS error")}
+	mockDynamo := &mockDynamoDBClient{}
+
+	resp, err := HandlePostRequest(context.Background(), newIdempotentPostRequest("test-key", idempotentConversionBody), mockSQS, mockDynamo, newSourceS3Client())
+	assert.Error(t, err)
+	assert.Equal(t, 500, resp.StatusCode)
+
+	released := mockDynamo.deleteItemInputs[len(mockDynamo.deleteItemInputs)-1]
+	assert.Equal(t, "test-idempotency-table", *released.TableName)
+}
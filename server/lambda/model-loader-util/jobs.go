@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/helpers"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+/*
+###########################################
+GET /v1/jobs/{jobId}?waitSeconds={number}
+###########################################
+*/
+
+// API Gateway HTTP APIs time out integrations after 30 seconds, so long-polls
+// must return well before that
+const maxJobWaitSeconds = 25
+
+var jobPollInterval = 1 * time.Second
+
+func getJobItem(ctx context.Context, dynamoClient DynamoDBClient, jobID string) (map[string]types.AttributeValue, error) {
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(os.Getenv("job_history_table")),
+		Key: map[string]types.AttributeValue{
+			"jobId": &types.AttributeValueMemberS{Value: jobID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.Item, nil
+}
+
+func HandleGetJobRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest, dynamoClient DynamoDBClient) (events.APIGatewayV2HTTPResponse, error) {
+	apiKeyResp, err := helpers.ValidateHttpAPIKey(request)
+	if err != nil {
+		return createErrorResponse(500, "Error validating API key"), err
+	}
+	if apiKeyResp.StatusCode != 0 {
+		return apiKeyResp, nil
+	}
+
+	jobID := request.PathParameters["jobId"]
+	if jobID == "" {
+		return createErrorResponse(400, "Job id is required"), nil
+	}
+
+	waitSeconds := 0
+	if waitSecondsStr := request.QueryStringParameters["waitSeconds"]; waitSecondsStr != "" {
+		waitSeconds, err = strconv.Atoi(waitSecondsStr)
+		if err != nil || waitSeconds < 0 || waitSeconds > maxJobWaitSeconds {
+			message := fmt.Sprintf("Invalid waitSeconds parameter. Must be a number between 0 and %d", maxJobWaitSeconds)
+			return createErrorResponse(400, message), nil
+		}
+	}
+	deadline := time.Now().Add(time.Duration(waitSeconds) * time.Second)
+
+	for {
+		item, err := getJobItem(ctx, dynamoClient, jobID)
+		if err != nil {
+			return createErrorResponse(500, "Failed to get job"), err
+		}
+		if item == nil {
+			return createErrorResponse(404, fmt.Sprintf("Job %s not found", jobID)), nil
+		}
+
+		job := modelMetadataFromItem(item)
+		if job.JobStatus != "pending" || !time.Now().Add(jobPollInterval).Before(deadline) {
+			return createSuccessResponse(200, job), nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return createSuccessResponse(200, job), nil
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+/*
+###########################################
+POST /v1/jobs/{jobId}/cancel
+###########################################
+*/
+
+// cancelJob marks a pending job cancelled and returns the updated row. The
+// worker skips cancelled jobs and the notification lambda discards their late
+// results, so the status cannot be overwritten afterwards.
+func cancelJob(ctx context.Context, dynamoClient DynamoDBClient, jobID string) (map[string]types.AttributeValue, error) {
+	result, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(os.Getenv("job_history_table")),
+		Key: map[string]types.AttributeValue{
+			"jobId": &types.AttributeValueMemberS{Value: jobID},
+		},
+		// Cancelled rows are kept as history, so the pending row's expiry is dropped
+		// Expired rows were never queued, they are left for TTL to delete
+		UpdateExpression:    aws.String("SET jobStatus = :cancelled, cancelledAt = :now REMOVE expiresAt"),
+		ConditionExpression: aws.String("jobStatus = :pending AND (attribute_not_exists(expiresAt) OR expiresAt > :nowUnix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":cancelled": &types.AttributeValueMemberS{Value: "cancelled"},
+			":pending":   &types.AttributeValueMemberS{Value: "pending"},
+			":now":       &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+			":nowUnix":   &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.Attributes, nil
+}
+
+func HandleCancelJobRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest, dynamoClient DynamoDBClient) (events.APIGatewayV2HTTPResponse, error) {
+	apiKeyResp, err := helpers.ValidateHttpAPIKey(request)
+	if err != nil {
+		return createErrorResponse(500, "Error validating API key"), err
+	}
+	if apiKeyResp.StatusCode != 0 {
+		return apiKeyResp, nil
+	}
+
+	jobID := request.PathParameters["jobId"]
+	if jobID == "" {
+		return createErrorResponse(400, "Job id is required"), nil
+	}
+
+	item, err := cancelJob(ctx, dynamoClient, jobID)
+	var conditionFailed *types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &conditionFailed) {
+		return createErrorResponse(500, "Failed to cancel job"), err
+	}
+	if err == nil {
+		return createSuccessResponse(200, modelMetadataFromItem(item)), nil
+	}
+
+	// The job was not pending, find out why
+	item, err = getJobItem(ctx, dynamoClient, jobID)
+	if err != nil {
+		return createErrorResponse(500, "Failed to get job"), err
+	}
+	if item == nil {
+		return createErrorResponse(404, fmt.Sprintf("Job %s not found", jobID)), nil
+	}
+	job := modelMetadataFromItem(item)
+	if job.JobStatus == "cancelled" {
+		return createSuccessResponse(200, job), nil
+	}
+	message := fmt.Sprintf("Job %s is already %s and can no longer be cancelled", jobID, job.JobStatus)
+	return createErrorResponse(409, message), nil
+}
+
+/*
+###########################################
+POST /v1/jobs/{jobId}/retry
+###########################################
+*/
+
+const defaultMaxJobAttempts = 3
+
+func maxJobAttempts() int {
+	maxStr := os.Getenv("max_job_attempts")
+	if maxStr == "" {
+		return defaultMaxJobAttempts
+	}
+	maxAttempts, err := strconv.Atoi(maxStr)
+	if err != nil || maxAttempts <= 0 {
+		log.Printf("Invalid max_job_attempts %q, using %d", maxStr, defaultMaxJobAttempts)
+		return defaultMaxJobAttempts
+	}
+	return maxAttempts
+}
+
+// retryConversionMessage rebuilds the queue message of a stored job. It keeps
+// the jobId, and carries the attempt number so results of an older attempt
+// can be told apart from the current one.
+func retryConversionMessage(job ModelMetadata, route conversionRoute, attempt int) map[string]string {
+	message := map[string]string{
+		"jobType":      job.JobType,
+		"jobId":        job.JobID,
+		"jobStatus":    "pending",
+		"connectionId": job.ConnectionID,
+		"fromFileType": job.FromFileType,
+		"toFileType":   job.ToFileType,
+		"modelId":      job.ModelID,
+		"s3Key":        job.S3Key,
+		"attempt":      strconv.Itoa(attempt),
+	}
+	if job.SubmissionID != "" {
+		message["submissionId"] = job.SubmissionID
+	}
+	if job.BatchID != "" {
+		message["batchId"] = job.BatchID
+	}
+	if job.SourceETag != "" {
+		addSourceObject(message, &SourceObject{ETag: job.SourceETag, Size: job.SourceSize, MainFile: job.SourceMainFile})
+	}
+	addConversionRoute(message, route)
+	return message
+}
+
+// startRetry moves a failed job back to pending, records the failed attempt,
+// the source it was checked against and where the retry is routed. The condition on attempts makes concurrent
+// retries of the same job fail instead of enqueuing it twice.
+func startRetry(ctx context.Context, dynamoClient DynamoDBClient, job ModelMetadata, route conversionRoute, attempt int) error {
+	failedAttempt := &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+		"attempt":  &types.AttributeValueMemberN{Value: strconv.Itoa(attempt - 1)},
+		"error":    &types.AttributeValueMemberS{Value: job.Error},
+		"failedAt": &types.AttributeValueMemberS{Value: job.Timestamp},
+	}}
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(os.Getenv("job_history_table")),
+		Key: map[string]types.AttributeValue{
+			"jobId": &types.AttributeValueMemberS{Value: job.JobID},
+		},
+		UpdateExpression:    aws.String("SET jobStatus = :pending, attempts = :attempt, attemptHistory = list_append(if_not_exists(attemptHistory, :empty), :failedAttempt), #timestamp = :now, converter = :converter, backend = :backend, sourceEtag = :sourceEtag, sourceSize = :sourceSize REMOVE #error, newS3Key, artifacts, meshStats, modelStats, validationReport, qualityReport"),
+		ConditionExpression: aws.String("jobStatus = :failed AND (attempts = :previous OR attribute_not_exists(attempts))"),
+		ExpressionAttributeNames: map[string]string{
+			"#error":     "error",
+			"#timestamp": "timestamp",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending":       &types.AttributeValueMemberS{Value: "pending"},
+			":failed":        &types.AttributeValueMemberS{Value: "failed"},
+			":attempt":       &types.AttributeValueMemberN{Value: strconv.Itoa(attempt)},
+			":previous":      &types.AttributeValueMemberN{Value: strconv.Itoa(attempt - 1)},
+			":empty":         &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
+			":failedAttempt": &types.AttributeValueMemberL{Value: []types.AttributeValue{failedAttempt}},
+			":now":           &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+			":converter":     &types.AttributeValueMemberS{Value: route.Converter.Name},
+			":backend":       &types.AttributeValueMemberS{Value: string(route.Converter.Backend)},
+			":sourceEtag":    &types.AttributeValueMemberS{Value: job.SourceETag},
+			":sourceSize":    &types.AttributeValueMemberN{Value: strconv.FormatInt(job.SourceSize, 10)},
+		},
+	})
+	return err
+}
+
+// revertRetry restores the failed state when the retry could not be enqueued,
+// so the attempt is not counted against the limit
+func revertRetry(ctx context.Context, dynamoClient DynamoDBClient, job ModelMetadata, attempt int) error {
+	updateExpression := fmt.Sprintf("SET jobStatus = :failed, #error = :error, #timestamp = :timestamp, attempts = :previous REMOVE attemptHistory[%d]", len(job.AttemptHistory))
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(os.Getenv("job_history_table")),
+		Key: map[string]types.AttributeValue{
+			"jobId": &types.AttributeValueMemberS{Value: job.JobID},
+		},
+		UpdateExpression:    aws.String(updateExpression),
+		ConditionExpression: aws.String("jobStatus = :pending AND attempts = :attempt"),
+		ExpressionAttributeNames: map[string]string{
+			"#error":     "error",
+			"#timestamp": "timestamp",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":failed":    &types.AttributeValueMemberS{Value: "failed"},
+			":pending":   &types.AttributeValueMemberS{Value: "pending"},
+			":error":     &types.AttributeValueMemberS{Value: job.Error},
+			":timestamp": &types.AttributeValueMemberS{Value: job.Timestamp},
+			":attempt":   &types.AttributeValueMemberN{Value: strconv.Itoa(attempt)},
+			":previous":  &types.AttributeValueMemberN{Value: strconv.Itoa(attempt - 1)},
+		},
+	})
+	return err
+}
+
+func HandleRetryJobRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest, sqsClient SQSClient, dynamoClient DynamoDBClient, s3Client S3Client) (events.APIGatewayV2HTTPResponse, error) {
+	apiKeyResp, err := helpers.ValidateHttpAPIKey(request)
+	if err != nil {
+		return createErrorResponse(500, "Error validating API key"), err
+	}
+	if apiKeyResp.StatusCode != 0 {
+		return apiKeyResp, nil
+	}
+
+	jobID := request.PathParameters["jobId"]
+	if jobID == "" {
+		return createErrorResponse(400, "Job id is required"), nil
+	}
+
+	item, err := getJobItem(ctx, dynamoClient, jobID)
+	if err != nil {
+		return createErrorResponse(500, "Failed to get job"), err
+	}
+	if item == nil {
+		return createErrorResponse(404, fmt.Sprintf("Job %s not found", jobID)), nil
+	}
+
+	job := modelMetadataFromItem(item)
+	if job.JobStatus != "failed" {
+		return createErrorResponse(409, fmt.Sprintf("Job %s is %s, only failed jobs can be retried", jobID, job.JobStatus)), nil
+	}
+	if job.JobType != jobTypeConversion {
+		return createErrorResponse(409, fmt.Sprintf("Job %s is a %s job, only conversions can be retried", jobID, job.JobType)), nil
+	}
+	// Jobs recorded before retries existed have made exactly one attempt
+	attempts := max(job.Attempts, 1)
+	if attempts >= maxJobAttempts() {
+		return createErrorResponse(409, fmt.Sprintf("Job %s has already been attempted %d times", jobID, attempts)), nil
+	}
+
+	// Retries follow the current registry, so a pair moved to another backend
+	// is retried there
+	route, routeResp := routeConversion(job.FromFileType, job.ToFileType, job.Options)
+	if routeResp.StatusCode != 0 {
+		return routeResp, nil
+	}
+
+	// The source may have been replaced or deleted since the job was queued,
+	// so it is checked again like on POST /3d-model
+	conversion := ConversionJob{FromFileType: job.FromFileType, ModelID: job.ModelID, S3Key: job.S3Key}
+	maxSize := routedMaxSourceSize(maxUploadSize(), map[string]conversionRoute{job.ToFileType: route})
+	source, preflightResp, err := preflightSourceObject(ctx, s3Client, conversion, maxSize)
+	if preflightResp.StatusCode != 0 {
+		return preflightResp, err
+	}
+	job.SourceETag, job.SourceSize, job.SourceMainFile = source.ETag, source.Size, source.MainFile
+
+	attempt := attempts + 1
+	err = startRetry(ctx, dynamoClient, job, route, attempt)
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return createErrorResponse(409, fmt.Sprintf("Job %s is already being retried", jobID)), nil
+	}
+	if err != nil {
+		return createErrorResponse(500, "Failed to update job"), err
+	}
+
+	message := retryConversionMessage(job, route, attempt)
+	messageBody, _ := json.Marshal(message)
+	_, err = sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(route.QueueURL),
+		MessageBody: aws.String(string(messageBody)),
+	})
+	if err != nil {
+		if revertErr := revertRetry(ctx, dynamoClient, job, attempt); revertErr != nil {
+			log.Printf("Error reverting retry of job %s: %v", jobID, revertErr)
+		}
+		return createErrorResponse(500, "Error sending message to queue"), err
+	}
+
+	return createSuccessResponse(202, SuccessPostResponse{Status: "Job successfully queued", JobID: jobID}), nil
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newGetJobRequest(jobID string, waitSeconds string) events.APIGatewayV2HTTPRequest {
+	req := events.APIGatewayV2HTTPRequest{
+		Headers: map[string]string{
+			"x-api-key": "test-api-key",
+		},
+		PathParameters: map[string]string{
+			"jobId": jobID,
+		},
+	}
+	if waitSeconds != "" {
+		req.QueryStringParameters = map[string]string{"waitSeconds": waitSeconds}
+	}
+	return req
+}
+
+func jobItem(jobID string, jobStatus string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"jobId":        &types.AttributeValueMemberS{Value: jobID},
+		"connectionId": &types.AttributeValueMemberS{Value: "test-connection-id"},
+		"jobType":      &types.AttributeValueMemberS{Value: "conversion"},
+		"jobStatus":    &types.AttributeValueMemberS{Value: jobStatus},
+		"fromFileType": &types.AttributeValueMemberS{Value: "blend"},
+		"toFileType":   &types.AttributeValueMemberS{Value: "glb"},
+		"modelId":      &types.AttributeValueMemberS{Value: "test-model-id"},
+		"s3Key":        &types.AttributeValueMemberS{Value: "blend/test-model-id.blend"},
+		"timestamp":    &types.AttributeValueMemberS{Value: "2025-01-01T00:00:00Z"},
+	}
+}
+
+// setupJobsTestEnv also polls fast, so long-polling tests finish quickly
+func TestHandleGetJobRequest_Success(t *testing.T) {
+	setupTestEnv(t)
+
+	completed := jobItem("test-job-id", "completed")
+	completed["newS3Key"] = &types.AttributeValueMemberS{Value: "glb/test-model-id.glb"}
+	completed["meshStats"] = &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+		"vertices":  &types.AttributeValueMemberN{Value: "3"},
+		"triangles": &types.AttributeValueMemberN{Value: "1"},
+		"min":       &types.AttributeValueMemberL{Value: []types.AttributeValue{&types.AttributeValueMemberN{Value: "0"}, &types.AttributeValueMemberN{Value: "0"}, &types.AttributeValueMemberN{Value: "-1.5"}}},
+		"max":       &types.AttributeValueMemberL{Value: []types.AttributeValue{&types.AttributeValueMemberN{Value: "10"}, &types.AttributeValueMemberN{Value: "20"}, &types.AttributeValueMemberN{Value: "0"}}},
+		"unit":      &types.AttributeValueMemberS{Value: "millimeter"},
+	}}
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutputs: []*dynamodb.GetItemOutput{{Item: completed}},
+	}
+
+	resp, err := HandleGetJobRequest(context.Background(), newGetJobRequest("test-job-id", ""), mockDynamo)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var job ModelMetadata
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &job))
+	assert.Equal(t, "test-job-id", job.JobID)
+	assert.Equal(t, "completed", job.JobStatus)
+	assert.Equal(t, "glb/test-model-id.glb", job.NewS3Key)
+	if assert.NotNil(t, job.MeshStats) {
+		assert.Equal(t, 1, job.MeshStats.Triangles)
+		assert.Equal(t, [3]float64{0, 0, -1.5}, job.MeshStats.Min)
+		assert.Equal(t, [3]float64{10, 20, 0}, job.MeshStats.Max)
+		assert.Equal(t, "millimeter", job.MeshStats.Unit)
+	}
+	assert.Equal(t, "test-job-history-table", *mockDynamo.getItemInputs[0].TableName)
+	assert.True(t, *mockDynamo.getItemInputs[0].ConsistentRead)
+}
+
+func TestHandleGetJobRequest_NotFound_Returns404(t *testing.T) {
+	setupTestEnv(t)
+
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutputs: []*dynamodb.GetItemOutput{{}},
+	}
+
+	resp, err := HandleGetJobRequest(context.Background(), newGetJobRequest("missing-job-id", ""), mockDynamo)
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+}
+
+func TestHandleGetJobRequest_PendingRowPastItsExpiryIsExpired(t *testing.T) {
+	setupTestEnv(t)
+
+	orphaned := jobItem("test-job-id", "pending")
+	orphaned["expiresAt"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)}
+	mockDynamo := &mockDynamoDBClient{getItemOutputs: []*dynamodb.GetItemOutput{{Item: orphaned}}}
+
+	// The long poll returns at once instead of waiting on a job nobody runs
+	resp, err := HandleGetJobRequest(context.Background(), newGetJobRequest("test-job-id", "5"), mockDynamo)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Contains(t, resp.Body, `"jobStatus":"expired"`)
+	assert.Len(t, mockDynamo.getItemInputs, 1)
+
+	queued := jobItem("test-job-id", "pending")
+	queued["expiresAt"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)}
+	assert.Equal(t, "pending", jobStatusOf(queued, time.Now()))
+	assert.Equal(t, "completed", jobStatusOf(jobItem("test-job-id", "completed"), time.Now()))
+}
+
+func TestHandleGetJobRequest_InvalidWaitSeconds_Returns400(t *testing.T) {
+	setupTestEnv(t)
+
+	for _, waitSeconds := range []string{"abc", "-1", "26"} {
+		resp, err := HandleGetJobRequest(context.Background(), newGetJobRequest("test-job-id", waitSeconds), &mockDynamoDBClient{})
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.StatusCode)
+	}
+}
+
+func TestHandleGetJobRequest_LongPollReturnsWhenJobLeavesPending(t *testing.T) {
+	setupTestEnv(t)
+
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutputs: []*dynamodb.GetItemOutput{
+			{Item: jobItem("test-job-id", "pending")},
+			{Item: jobItem("test-job-id", "pending")},
+			{Item: jobItem("test-job-id", "failed")},
+		},
+	}
+
+	resp, err := HandleGetJobRequest(context.Background(), newGetJobRequest("test-job-id", "5"), mockDynamo)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var job ModelMetadata
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &job))
+	assert.Equal(t, "failed", job.JobStatus)
+	assert.Len(t, mockDynamo.getItemInputs, 3)
+}
+
+func TestHandleGetJobRequest_LongPollTimesOutWhilePending(t *testing.T) {
+	setupTestEnv(t)
+	jobPollInterval = 600 * time.Millisecond
+
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutputs: []*dynamodb.GetItemOutput{{Item: jobItem("test-job-id", "pending")}},
+	}
+
+	resp, err := HandleGetJobRequest(context.Background(), newGetJobRequest("test-job-id", "1"), mockDynamo)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var job ModelMetadata
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &job))
+	assert.Equal(t, "pending", job.JobStatus)
+	assert.Len(t, mockDynamo.getItemInputs, 2)
+}
+
+func newCancelJobRequest(jobID string) events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{
+		Headers: map[string]string{
+			"x-api-key": "test-api-key",
+		},
+		PathParameters: map[string]string{
+			"jobId": jobID,
+		},
+	}
+}
+
+func TestHandleCancelJobRequest_CancelsPendingJob(t *testing.T) {
+	setupTestEnv(t)
+
+	mockDynamo := &mockDynamoDBClient{
+		updateItemOutput: &dynamodb.UpdateItemOutput{Attributes: jobItem("test-job-id", "cancelled")},
+	}
+
+	resp, err := HandleCancelJobRequest(context.Background(), newCancelJobRequest("test-job-id"), mockDynamo)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var job ModelMetadata
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &job))
+	assert.Equal(t, "cancelled", job.JobStatus)
+
+	assert.Len(t, mockDynamo.updateItemInputs, 1)
+	assert.Equal(t, "jobStatus = :pending AND (attribute_not_exists(expiresAt) OR expiresAt > :nowUnix)", *mockDynamo.updateItemInputs[0].ConditionExpression)
+}
+
+func TestHandleCancelJobRequest_AlreadyCancelled_Returns200(t *testing.T) {
+	setupTestEnv(t)
+
+	mockDynamo := &mockDynamoDBClient{
+		updateItemErr:  &types.ConditionalCheckFailedException{},
+		getItemOutputs: []*dynamodb.GetItemOutput{{Item: jobItem("test-job-id", "cancelled")}},
+	}
+
+	resp, err := HandleCancelJobRequest(context.Background(), newCancelJobRequest("test-job-id"), mockDynamo)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestHandleCancelJobRequest_FinishedJob_Returns409(t *testing.T) {
+	setupTestEnv(t)
+
+	mockDynamo := &mockDynamoDBClient{
+		updateItemErr:  &types.ConditionalCheckFailedException{},
+		getItemOutputs: []*dynamodb.GetItemOutput{{Item: jobItem("test-job-id", "completed")}},
+	}
+
+	resp, err := HandleCancelJobRequest(context.Background(), newCancelJobRequest("test-job-id"), mockDynamo)
+	assert.NoError(t, err)
+	assert.Equal(t, 409, resp.StatusCode)
+	assert.Contains(t, resp.Body, "already completed")
+}
+
+func TestHandleCancelJobRequest_NotFound_Returns404(t *testing.T) {
+	setupTestEnv(t)
+
+	mockDynamo := &mockDynamoDBClient{
+		updateItemErr:  &types.ConditionalCheckFailedException{},
+		getItemOutputs: []*dynamodb.GetItemOutput{{}},
+	}
+
+	resp, err := HandleCancelJobRequest(context.Background(), newCancelJobRequest("missing-job-id"), mockDynamo)
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+}
+
+func failedJobItem(jobID string, attempts int) map[string]types.AttributeValue {
+	item := jobItem(jobID, "failed")
+	item["error"] = &types.AttributeValueMemberS{Value: "Blender conversion failed"}
+	if attempts > 0 {
+		item["attempts"] = &types.AttributeValueMemberN{Value: strconv.Itoa(attempts)}
+	}
+	return item
+}
+
+func TestHandleRetryJobRequest_RequeuesFailedJob(t *testing.T) {
+	setupTestEnv(t)
+
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutputs: []*dynamodb.GetItemOutput{{Item: failedJobItem("test-job-id", 0)}},
+	}
+
+	resp, err := HandleRetryJobRequest(context.Background(), newCancelJobRequest("test-job-id"), mockSQS, mockDynamo, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	var response SuccessPostResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+	assert.Equal(t, "test-job-id", response.JobID)
+
+	var messageBody map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(*mockSQS.sendMessageInput.MessageBody), &messageBody))
+	assert.Equal(t, "test-job-id", messageBody["jobId"])
+	assert.Equal(t, "2", messageBody["attempt"])
+	assert.Equal(t, "glb", messageBody["toFileType"])
+	assert.Equal(t, "blend/test-model-id.blend", messageBody["s3Key"])
+
+	assert.Len(t, mockDynamo.updateItemInputs, 1)
+	update := mockDynamo.updateItemInputs[0]
+	assert.Equal(t, "2", update.ExpressionAttributeValues[":attempt"].(*types.AttributeValueMemberN).Value)
+	failedAttempt := update.ExpressionAttributeValues[":failedAttempt"].(*types.AttributeValueMemberL).Value[0].(*types.AttributeValueMemberM)
+	assert.Equal(t, "Blender conversion failed", failedAttempt.Value["error"].(*types.AttributeValueMemberS).Value)
+}
+
+func TestHandleRetryJobRequest_PreflightsTheSourceAgain(t *testing.T) {
+	setupTestEnv(t)
+
+	// The source was deleted after the job failed
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutputs: []*dynamodb.GetItemOutput{{Item: failedJobItem("test-job-id", 0)}},
+	}
+	resp, err := HandleRetryJobRequest(context.Background(), newCancelJobRequest("test-job-id"), mockSQS, mockDynamo, &mockS3Client{})
+	assert.NoError(t, err)
+	assert.Equal(t, 409, resp.StatusCode)
+	assert.Nil(t, mockSQS.sendMessageInput)
+	assert.Empty(t, mockDynamo.updateItemInputs)
+
+	// The source was replaced, the retry is checked against the new object
+	mockS3 := newSourceS3Client()
+	mockDynamo = &mockDynamoDBClient{
+		getItemOutputs: []*dynamodb.GetItemOutput{{Item: failedJobItem("test-job-id", 0)}},
+	}
+	resp, err = HandleRetryJobRequest(context.Background(), newCancelJobRequest("test-job-id"), mockSQS, mockDynamo, mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+	var messageBody map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(*mockSQS.sendMessageInput.MessageBody), &messageBody))
+	assert.Equal(t, strconv.Itoa(len(testBlendFile())), messageBody["sourceSize"])
+	assert.Equal(t, messageBody["sourceEtag"], mockDynamo.updateItemInputs[0].ExpressionAttributeValues[":sourceEtag"].(*types.AttributeValueMemberS).Value)
+}
+
+func TestHandleRetryJobRequest_AttemptLimitReached_Returns409(t *testing.T) {
+	setupTestEnv(t)
+	t.Setenv("max_job_attempts", "2")
+
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutputs: []*dynamodb.GetItemOutput{{Item: failedJobItem("test-job-id", 2)}},
+	}
+
+	resp, err := HandleRetryJobRequest(context.Background(), newCancelJobRequest("test-job-id"), mockSQS, mockDynamo, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 409, resp.StatusCode)
+	assert.Nil(t, mockSQS.sendMessageInput)
+	assert.Empty(t, mockDynamo.updateItemInputs)
+}
+
+func TestHandleRetryJobRequest_NotFailed_Returns409(t *testing.T) {
+	setupTestEnv(t)
+
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutputs: []*dynamodb.GetItemOutput{{Item: jobItem("test-job-id", "pending")}},
+	}
+
+	resp, err := HandleRetryJobRequest(context.Background(), newCancelJobRequest("test-job-id"), mockSQS, mockDynamo, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 409, resp.StatusCode)
+	assert.Nil(t, mockSQS.sendMessageInput)
+}
+
+func TestHandleRetryJobRequest_SQSError_RevertsAttempt(t *testing.T) {
+	setupTestEnv(t)
+
+	mockSQS := &mockSQSClient{sendMessageErr: errors.New("SQS error")}
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutputs: []*dynamodb.GetItemOutput{{Item: failedJobItem("test-job-id", 0)}},
+	}
+
+	resp, err := HandleRetryJobRequest(context.Background(), newCancelJobRequest("test-job-id"), mockSQS, mockDynamo, newSourceS3Client())
+	assert.Error(t, err)
+	assert.Equal(t, 500, resp.StatusCode)
+
+	assert.Len(t, mockDynamo.updateItemInputs, 2)
+	revert := mockDynamo.updateItemInputs[1]
+	assert.Contains(t, *revert.UpdateExpression, "REMOVE attemptHistory[0]")
+	assert.Equal(t, "1", revert.ExpressionAttributeValues[":previous"].(*types.AttributeValueMemberN).Value)
+}
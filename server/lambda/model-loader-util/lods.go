@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/converters"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/helpers"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/google/uuid"
+)
+
+/*
+###########################################
+POST /v1/3d-model/{unique-model-id}/lods
+###########################################
+*/
+
+type LODRequest struct {
+	ConnectionID string `json:"connectionId"`
+	// Ratios are the share of the GLB's triangles each level keeps
+	Ratios []float64 `json:"ratios"`
+}
+
+const (
+	// lodConverter is run by the native backend, it is not in the registry
+	// because it does not convert between formats
+	lodConverter = "gltf-lod"
+	maxLODLevels = 8
+)
+
+var defaultLODRatios = []float64{0.5, 0.25, 0.125}
+
+// lodRatios checks the requested ratios and orders them from the most
+// detailed level to the least, so lod1 always has the most triangles
+func lodRatios(requested []float64) ([]float64, error) {
+	if len(requested) == 0 {
+		return defaultLODRatios, nil
+	}
+	if len(requested) > maxLODLevels {
+		return nil, fmt.Errorf("at most %d levels of detail can be generated", maxLODLevels)
+	}
+	ratios := slices.Clone(requested)
+	for _, ratio := range ratios {
+		if ratio <= 0 || ratio >= 1 {
+			return nil, fmt.Errorf("ratio %g is not between 0 and 1", ratio)
+		}
+	}
+	slices.Sort(ratios)
+	slices.Reverse(ratios)
+	return slices.Compact(ratios), nil
+}
+
+func createLODMessage(lodRequest LODRequest, modelID string, glbS3Key string, ratios []float64) map[string]string {
+	options, _ := json.Marshal(map[string][]float64{"ratios": ratios})
+	return map[string]string{
+		"jobType":      jobTypeLOD,
+		"jobId":        uuid.New().String(),
+		"jobStatus":    "pending",
+		"connectionId": lodRequest.ConnectionID,
+		"fromFileType": "glb",
+		"toFileType":   "glb",
+		"modelId":      modelID,
+		"s3Key":        glbS3Key,
+		"converter":    lodConverter,
+		"backend":      string(converters.BackendNative),
+		"options":      string(options),
+	}
+}
+
+func HandlePostLODRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest, sqsClient SQSClient, dynamoClient DynamoDBClient) (events.APIGatewayV2HTTPResponse, error) {
+	apiKeyResp, err := helpers.ValidateHttpAPIKey(request)
+	if err != nil {
+		return createErrorResponse(500, "Error validating API key"), err
+	}
+	if apiKeyResp.StatusCode != 0 {
+		return apiKeyResp, nil
+	}
+
+	modelID := request.PathParameters["id"]
+	if modelID == "" {
+		return createErrorResponse(400, "Model id is required"), nil
+	}
+	var lodRequest LODRequest
+	if request.Body != "" {
+		if err := json.Unmarshal([]byte(request.Body), &lodRequest); err != nil {
+			return createErrorResponse(400, "Invalid request body"), nil
+		}
+	}
+	ratios, err := lodRatios(lodRequest.Ratios)
+	if err != nil {
+		return createErrorResponse(400, fmt.Sprintf("Malformed request - %v", err)), nil
+	}
+	queueURL := os.Getenv(converters.BackendNative.QueueURLEnv())
+	if queueURL == "" {
+		return createErrorResponse(500, fmt.Sprintf("Queue URL not configured for the %s backend", converters.BackendNative)), nil
+	}
+
+	conversion, err := latestCompletedConversion(ctx, dynamoClient, modelID, "glb")
+	if err != nil {
+		return createErrorResponse(500, "Failed to query model job history"), err
+	}
+	if conversion == nil {
+		return createErrorResponse(404, fmt.Sprintf("Model %s has not been converted to glb yet", modelID)), nil
+	}
+
+	message := createLODMessage(lodRequest, modelID, stringAttribute(conversion, "newS3Key"), ratios)
+	if err := putPendingJob(ctx, dynamoClient, message, nil, nil); err != nil {
+		return createErrorResponse(500, "Error recording job"), err
+	}
+	messageBody, _ := json.Marshal(message)
+	_, err = sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(queueURL),
+		MessageBody: aws.String(string(messageBody)),
+	})
+	if err != nil {
+		if discardErr := discardPendingJob(ctx, dynamoClient, message["jobId"]); discardErr != nil {
+			log.Printf("Error discarding pending job %s, it will expire on its own: %v", message["jobId"], discardErr)
+		}
+		return createErrorResponse(500, "Error sending message to queue"), err
+	}
+	if err := confirmPendingJob(ctx, dynamoClient, message["jobId"]); err != nil {
+		// The job is queued either way, and the worker's notification clears the expiry
+		log.Printf("Error confirming pending job %s: %v", message["jobId"], err)
+	}
+
+	return createSuccessResponse(202, SuccessPostResponse{Status: "Job successfully queued", JobID: message["jobId"]}), nil
+}
+
+// lodS3Key is where the given level of detail of the latest lod job is
+// stored, or empty when that job did not generate as many levels
+func lodS3Key(ctx context.Context, dynamoClient DynamoDBClient, modelID string, level int) (string, error) {
+	item, err := latestCompletedJob(ctx, dynamoClient, modelID, jobTypeLOD, "glb")
+	if err != nil || item == nil {
+		return "", err
+	}
+	for _, artifact := range jobArtifacts(modelMetadataFromItem(item)) {
+		if artifact.Path == converters.LODFileName(level) {
+			return artifact.S3Key, nil
+		}
+	}
+	return "", nil
+}
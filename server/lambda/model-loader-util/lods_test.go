@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPostLODRequest(body string) events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{
+		Headers:        map[string]string{"x-api-key": "test-api-key"},
+		PathParameters: map[string]string{"id": "test-model-id"},
+		Body:           body,
+	}
+}
+
+func lodJobItem(levels ...string) map[string]types.AttributeValue {
+	var artifacts []types.AttributeValue
+	for _, level := range levels {
+		artifacts = append(artifacts, &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"path":  &types.AttributeValueMemberS{Value: level},
+			"s3Key": &types.AttributeValueMemberS{Value: "glb/test-model-id/" + level},
+		}})
+	}
+	return map[string]types.AttributeValue{
+		"jobId":     &types.AttributeValueMemberS{Value: "lod-job"},
+		"newS3Key":  &types.AttributeValueMemberS{Value: "glb/test-model-id/" + levels[0]},
+		"timestamp": &types.AttributeValueMemberS{Value: "2025-03-01T00:00:00Z"},
+		"artifacts": &types.AttributeValueMemberL{Value: artifacts},
+	}
+}
+
+func TestLODRatios(t *testing.T) {
+	ratios, err := lodRatios(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0.5, 0.25, 0.125}, ratios)
+
+	ratios, err = lodRatios([]float64{0.1, 0.6, 0.1, 0.3})
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0.6, 0.3, 0.1}, ratios)
+
+	for _, requested := range [][]float64{{0.5, 1}, {0}, {-0.5}, {0.9, 0.8, 0.7, 0.6, 0.5, 0.4, 0.3, 0.2, 0.1}} {
+		_, err := lodRatios(requested)
+		assert.Error(t, err, requested)
+	}
+}
+
+func TestHandlePostLODRequest_QueuesLODJobForLatestGLB(t *testing.T) {
+	setupTestEnv(t)
+	mockDynamo := &mockDynamoDBClient{queryOutput: &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{
+		completedGLBItem("glb-job", "2025-01-01T00:00:00Z", ""),
+	}}}
+	mockSQS := &mockSQSClient{}
+
+	resp, err := HandlePostLODRequest(context.Background(), newPostLODRequest(`{"connectionId":"test-connection","ratios":[0.1,0.4]}`), mockSQS, mockDynamo)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+	var body SuccessPostResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &body))
+	assert.NotEmpty(t, body.JobID)
+
+	assert.Equal(t, testNativeQueueURL, *mockSQS.sendMessageInput.QueueUrl)
+	var message map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(*mockSQS.sendMessageInput.MessageBody), &message))
+	assert.Equal(t, "lod", message["jobType"])
+	assert.Equal(t, body.JobID, message["jobId"])
+	assert.Equal(t, "glb/glb-job.glb", message["s3Key"])
+	assert.Equal(t, "gltf-lod", message["converter"])
+	assert.Equal(t, `{"ratios":[0.4,0.1]}`, message["options"])
+	assert.Len(t, mockDynamo.putItemInputs, 1)
+	assert.Len(t, mockDynamo.updateItemInputs, 1, "the pending job is confirmed")
+}
+
+func TestHandlePostLODRequest_Rejections(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		items      []map[string]types.AttributeValue
+		queueURL   string
+		statusCode int
+	}{
+		{"invalid ratio", `{"ratios":[1.5]}`, nil, "queue", 400},
+		{"invalid body", `{"ratios":"half"}`, nil, "queue", 400},
+		{"no native queue", "", nil, "", 500},
+		{"not converted to glb", "", nil, "queue", 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestEnv(t)
+			t.Setenv("native_jobs_queue_url", tt.queueURL)
+			mockDynamo := &mockDynamoDBClient{queryOutput: &dynamodb.QueryOutput{Items: tt.items}}
+			mockSQS := &mockSQSClient{}
+
+			resp, _ := HandlePostLODRequest(context.Background(), newPostLODRequest(tt.body), mockSQS, mockDynamo)
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode, resp.Body)
+			assert.Empty(t, mockSQS.sendMessageInputs)
+			assert.Empty(t, mockDynamo.putItemInputs)
+		})
+	}
+}
+
+func TestHandlePostLODRequest_SQSError_DiscardsPendingJob(t *testing.T) {
+	setupTestEnv(t)
+	mockDynamo := &mockDynamoDBClient{queryOutput: &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{
+		completedGLBItem("glb-job", "2025-01-01T00:00:00Z", ""),
+	}}}
+
+	resp, err := HandlePostLODRequest(context.Background(), newPostLODRequest(""), &mockSQSClient{sendMessageErr: errors.New("SQS error")}, mockDynamo)
+
+	assert.Error(t, err)
+	assert.Equal(t, 500, resp.StatusCode)
+	assert.Len(t, mockDynamo.deleteItemInputs, 1)
+}
+
+func TestHandleGetModelRequest_DownloadsLevelOfDetail(t *testing.T) {
+	setupTestEnv(t)
+	mockDynamo := &mockDynamoDBClient{
+		queryOutput: &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{
+			completedGLBItem("glb-job", "2025-01-01T00:00:00Z", ""),
+		}},
+		jobTypeQueryOutputs: map[string]*dynamodb.QueryOutput{
+			"lod": {Items: []map[string]types.AttributeValue{lodJobItem("lod1.glb", "lod2.glb")}},
+		},
+	}
+	request := func(lod string) events.APIGatewayV2HTTPRequest {
+		return events.APIGatewayV2HTTPRequest{
+			Headers:               map[string]string{"x-api-key": "test-api-key"},
+			PathParameters:        map[string]string{"id": "test-model-id"},
+			QueryStringParameters: map[string]string{"fileType": "glb", "lod": lod},
+		}
+	}
+
+	for lod, key := range map[string]string{"0": `glb/glb-job\.glb`, "2": `glb/test-model-id/lod2\.glb`} {
+		resp, err := HandleGetModelRequest(context.Background(), request(lod), mockDynamo, &mockS3Client{}, newTestPresignClient())
+		assert.NoError(t, err, lod)
+		assert.Equal(t, 200, resp.StatusCode, lod)
+		assert.Regexp(t, `^{"presignedUrl":"https://test-bucket\.s3\.us-east-1\.amazonaws\.com/`+key+`\?.*"}$`, resp.Body)
+	}
+
+	resp, err := HandleGetModelRequest(context.Background(), request("3"), mockDynamo, &mockS3Client{}, newTestPresignClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+	assert.Contains(t, resp.Body, "Model test-model-id has no level of detail 3")
+}
+
+func TestHandleGetModelRequest_InvalidLOD_Returns400(t *testing.T) {
+	setupTestEnv(t)
+
+	for _, query := range []map[string]string{
+		{"fileType": "glb", "lod": "-1"},
+		{"fileType": "glb", "lod": "first"},
+		{"fileType": "gltf", "lod": "1"},
+		{"fileType": "glb", "lod": "1", "bundle": "zip"},
+	} {
+		req := events.APIGatewayV2HTTPRequest{
+			Headers:               map[string]string{"x-api-key": "test-api-key"},
+			PathParameters:        map[string]string{"id": "test-model-id"},
+			QueryStringParameters: query,
+		}
+
+		resp, err := HandleGetModelRequest(context.Background(), req, &mockDynamoDBClient{}, &mockS3Client{}, newTestPresignClient())
+
+		assert.NoError(t, err, query)
+		assert.Equal(t, 400, resp.StatusCode, query)
+	}
+}
+
+func TestListedModel_LeavesOutLODJobs(t *testing.T) {
+	assert.True(t, listedModel(ModelMetadata{JobType: jobTypeConversion, JobStatus: "completed"}))
+	assert.True(t, listedModel(ModelMetadata{JobType: jobTypeConversion, JobStatus: "pending"}))
+	assert.False(t, listedModel(ModelMetadata{JobType: jobTypeConversion, JobStatus: "expired"}))
+	assert.False(t, listedModel(ModelMetadata{JobType: jobTypeLOD, JobStatus: "completed"}))
+}
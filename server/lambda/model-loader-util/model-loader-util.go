@@ -11,15 +11,20 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/gltf"
 	"vibeIQ-take-home-3d-model-loader-poc/lambda/helpers"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/mesh"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/quality"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/google/uuid"
 )
@@ -29,23 +34,62 @@ type ErrorResponse struct {
 }
 
 type SuccessPostResponse struct {
-	Status string `json:"status"`
+	Status       string      `json:"status"`
+	JobID        string      `json:"jobId"`
+	SubmissionID string      `json:"submissionId,omitempty"`
+	Jobs         []QueuedJob `json:"jobs,omitempty"`
+}
+
+type QueuedJob struct {
+	ToFileType string `json:"toFileType"`
+	JobID      string `json:"jobId"`
+	Error      string `json:"error,omitempty"`
 }
 
 type SuccessGetModelResponse struct {
-	PresignedUrl string `json:"presignedUrl"`
+	PresignedUrl string            `json:"presignedUrl"`
+	Files        map[string]string `json:"files,omitempty"`
 }
 
 type SuccessPutResponse struct {
 	Message string `json:"message"`
 }
 
+type DeleteModelResponse struct {
+	ModelID        string          `json:"modelId"`
+	DeletedObjects []string        `json:"deletedObjects"`
+	DeletedJobs    []string        `json:"deletedJobs"`
+	Failures       []DeleteFailure `json:"failures,omitempty"`
+	Error          string          `json:"error,omitempty"`
+}
+
+type DeleteFailure struct {
+	Resource string `json:"resource"`
+	Error    string `json:"error"`
+}
+
 type ConversionJob struct {
-	ConnectionID string `json:"connectionId"`
-	FromFileType string `json:"fromFileType"`
-	ToFileType   string `json:"toFileType"`
-	ModelID      string `json:"modelId"`
-	S3Key        string `json:"s3Key"`
+	ConnectionID string   `json:"connectionId"`
+	FromFileType string   `json:"fromFileType"`
+	ToFileType   string   `json:"toFileType"`
+	ToFileTypes  []string `json:"toFileTypes,omitempty"`
+	// ModelID and S3Key come from the upload session. Only with
+	// allow_raw_source_keys may a request name them itself, and the key must
+	// then be that model's own upload, see validateSourceKeyForConversion.
+	ModelID string `json:"modelId"`
+	S3Key   string `json:"s3Key"`
+	// UploadSessionID is the session created through POST /uploads the
+	// source was uploaded with
+	UploadSessionID string `json:"uploadSessionId,omitempty"`
+	// Options are checked against the option schema of the converter each
+	// target is routed to. With several targets each converter gets the
+	// options it declares.
+	Options map[string]any `json:"options,omitempty"`
+	// TenantID is the tenant of the request's API key, which picks the
+	// quality budget outputs are checked against. Clients cannot set it.
+	TenantID string `json:"-"`
+	// Source is set by preflightSourceObject, never by the client
+	Source *SourceObject `json:"-"`
 }
 
 type SuccessGetModelsResponse struct {
@@ -65,6 +109,50 @@ type ModelMetadata struct {
 	NewS3Key     string `json:"newS3Key,omitempty"`
 	Error        string `json:"error,omitempty"`
 	Timestamp    string `json:"timestamp"`
+	SubmissionID string `json:"submissionId,omitempty"`
+	BatchID      string `json:"batchId,omitempty"`
+	SourceETag   string `json:"sourceEtag,omitempty"`
+	SourceSize   int64  `json:"sourceSize,omitempty"`
+	// SourceMainFile is the .blend file opened inside a blend-zip source
+	SourceMainFile string `json:"sourceMainFile,omitempty"`
+	// SourceStats describes the source .blend file when it was small enough to
+	// be inspected before queueing
+	SourceStats *SourceStats `json:"sourceStats,omitempty"`
+	Artifacts   []Artifact   `json:"artifacts,omitempty"`
+	// MeshStats describe the output of the converters that write a single
+	// mesh, such as STL, PLY and 3MF
+	MeshStats *mesh.Stats `json:"meshStats,omitempty"`
+	// ModelStats describe GLB outputs, see GET /v1/3d-model/{id}/stats
+	ModelStats *gltf.Stats `json:"modelStats,omitempty"`
+	// Validation is the report of the glTF validator on glTF outputs
+	Validation *gltf.Report `json:"validation,omitempty"`
+	TenantID   string       `json:"tenantId,omitempty"`
+	// Quality is the outcome of the tenant's quality budget, checked against
+	// the .blend source and glTF outputs
+	Quality  *quality.Report `json:"quality,omitempty"`
+	Attempts int             `json:"attempts,omitempty"`
+	// Converter and Backend record where the job was routed
+	Converter string         `json:"converter,omitempty"`
+	Backend   string         `json:"backend,omitempty"`
+	Options   map[string]any `json:"options,omitempty"`
+	// AttemptHistory lists the earlier attempts of a retried job, oldest first
+	AttemptHistory []JobAttempt `json:"attemptHistory,omitempty"`
+}
+
+type JobAttempt struct {
+	Attempt  int    `json:"attempt"`
+	Error    string `json:"error,omitempty"`
+	FailedAt string `json:"failedAt,omitempty"`
+}
+
+// Artifact is one file produced by a job. Multi-file outputs such as glTF with
+// external buffers or OBJ with its .mtl list every file, with Path relative to
+// the main output file.
+type Artifact struct {
+	Path   string `json:"path"`
+	S3Key  string `json:"s3Key"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
 }
 
 const (
@@ -73,14 +161,44 @@ const (
 	jsonContentType   = "application/json"
 )
 
-var supportedOutputFormats = []string{"glb", "gltf", "obj", "fbx", "usd", "usdz"}
+// Conversions turn a source into another format, lod jobs simplify a model's
+// GLB into levels of detail
+const (
+	jobTypeConversion = "conversion"
+	jobTypeLOD        = "lod"
+)
+
+var supportedOutputFormats = []string{"glb", "gltf", "obj", "fbx", "usd", "usdz", "stl", "ply", "3mf"}
 
 type SQSClient interface {
 	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
 }
 
 type DynamoDBClient interface {
 	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+type PresignClient interface {
+	PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+	PresignPutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+	PresignUploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+}
+
+type S3Client interface {
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	ListParts(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
 }
 
 /*
@@ -108,6 +226,145 @@ func createSuccessResponse(statusCode int, data interface{}) events.APIGatewayV2
 	}
 }
 
+func stringListAttribute(values []string) []types.AttributeValue {
+	list := make([]types.AttributeValue, 0, len(values))
+	for _, value := range values {
+		list = append(list, &types.AttributeValueMemberS{Value: value})
+	}
+	return list
+}
+
+func stringAttribute(item map[string]types.AttributeValue, name string) string {
+	if value, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return value.Value
+	}
+	return ""
+}
+
+func modelMetadataFromItem(item map[string]types.AttributeValue) ModelMetadata {
+	return ModelMetadata{
+		JobID:          stringAttribute(item, "jobId"),
+		ConnectionID:   stringAttribute(item, "connectionId"),
+		JobType:        stringAttribute(item, "jobType"),
+		JobStatus:      jobStatusOf(item, time.Now()),
+		FromFileType:   stringAttribute(item, "fromFileType"),
+		ToFileType:     stringAttribute(item, "toFileType"),
+		ModelID:        stringAttribute(item, "modelId"),
+		S3Key:          stringAttribute(item, "s3Key"),
+		NewS3Key:       stringAttribute(item, "newS3Key"),
+		Error:          stringAttribute(item, "error"),
+		Timestamp:      stringAttribute(item, "timestamp"),
+		SubmissionID:   stringAttribute(item, "submissionId"),
+		BatchID:        stringAttribute(item, "batchId"),
+		SourceETag:     stringAttribute(item, "sourceEtag"),
+		SourceSize:     int64(numberAttribute(item, "sourceSize")),
+		SourceMainFile: stringAttribute(item, "sourceMainFile"),
+		SourceStats:    sourceStatsFromAttribute(item["sourceStats"]),
+		Artifacts:      artifactsFromAttribute(item["artifacts"]),
+		MeshStats:      meshStatsFromAttribute(item["meshStats"]),
+		ModelStats:     modelStatsFromAttribute(item),
+		Validation:     validationReportFromAttribute(item),
+		TenantID:       stringAttribute(item, "tenantId"),
+		Quality:        qualityReportFromAttribute(item),
+		Attempts:       numberAttribute(item, "attempts"),
+		Converter:      stringAttribute(item, "converter"),
+		Backend:        stringAttribute(item, "backend"),
+		Options:        optionsFromAttribute(item),
+		AttemptHistory: attemptsFromAttribute(item["attemptHistory"]),
+	}
+}
+
+// optionsFromAttribute decodes the options of a job, stored as JSON like every
+// other field of the queue message
+func optionsFromAttribute(item map[string]types.AttributeValue) map[string]any {
+	encoded := stringAttribute(item, "options")
+	if encoded == "" {
+		return nil
+	}
+	var options map[string]any
+	if err := json.Unmarshal([]byte(encoded), &options); err != nil {
+		log.Printf("Invalid options %q on job %s: %v", encoded, stringAttribute(item, "jobId"), err)
+		return nil
+	}
+	return options
+}
+
+func numberAttribute(item map[string]types.AttributeValue, name string) int {
+	if value, ok := item[name].(*types.AttributeValueMemberN); ok {
+		number, _ := strconv.Atoi(value.Value)
+		return number
+	}
+	return 0
+}
+
+func meshStatsFromAttribute(attribute types.AttributeValue) *mesh.Stats {
+	value, ok := attribute.(*types.AttributeValueMemberM)
+	if !ok {
+		return nil
+	}
+	stats := &mesh.Stats{
+		Vertices:  numberAttribute(value.Value, "vertices"),
+		Triangles: numberAttribute(value.Value, "triangles"),
+		Unit:      stringAttribute(value.Value, "unit"),
+	}
+	for name, corner := range map[string]*[3]float64{"min": &stats.Min, "max": &stats.Max} {
+		list, ok := value.Value[name].(*types.AttributeValueMemberL)
+		if !ok {
+			continue
+		}
+		for i := 0; i < len(list.Value) && i < len(corner); i++ {
+			if number, ok := list.Value[i].(*types.AttributeValueMemberN); ok {
+				corner[i], _ = strconv.ParseFloat(number.Value, 64)
+			}
+		}
+	}
+	return stats
+}
+
+func attemptsFromAttribute(attribute types.AttributeValue) []JobAttempt {
+	list, ok := attribute.(*types.AttributeValueMemberL)
+	if !ok {
+		return nil
+	}
+	attempts := make([]JobAttempt, 0, len(list.Value))
+	for _, value := range list.Value {
+		entry, ok := value.(*types.AttributeValueMemberM)
+		if !ok {
+			continue
+		}
+		attempts = append(attempts, JobAttempt{
+			Attempt:  numberAttribute(entry.Value, "attempt"),
+			Error:    stringAttribute(entry.Value, "error"),
+			FailedAt: stringAttribute(entry.Value, "failedAt"),
+		})
+	}
+	return attempts
+}
+
+func artifactsFromAttribute(attribute types.AttributeValue) []Artifact {
+	list, ok := attribute.(*types.AttributeValueMemberL)
+	if !ok {
+		return nil
+	}
+	artifacts := make([]Artifact, 0, len(list.Value))
+	for _, value := range list.Value {
+		entry, ok := value.(*types.AttributeValueMemberM)
+		if !ok {
+			continue
+		}
+		artifact := Artifact{
+			Path:   stringAttribute(entry.Value, "path"),
+			S3Key:  stringAttribute(entry.Value, "s3Key"),
+			SHA256: stringAttribute(entry.Value, "sha256"),
+		}
+		if size, ok := entry.Value["size"].(*types.AttributeValueMemberN); ok {
+			artifact.Size, _ = strconv.ParseInt(size.Value, 10, 64)
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts
+}
+
 func validateContentType(contentType string) (bool, events.APIGatewayV2HTTPResponse) {
 	if strings.HasPrefix(contentType, "multipart/form-data") {
 		return false, createErrorResponse(400, "No file uploads allowed")
@@ -127,8 +384,15 @@ func validateRequiredFieldsForConversion(job ConversionJob) (bool, events.APIGat
 		"connectionId": job.ConnectionID,
 		"fromFileType": job.FromFileType,
 		"toFileType":   job.ToFileType,
-		"modelId":      job.ModelID,
-		"s3Key":        job.S3Key,
+	}
+	if len(job.ToFileTypes) > 0 {
+		fields["toFileType"] = strings.Join(job.ToFileTypes, ",")
+	}
+	if job.UploadSessionID != "" || !rawSourceKeysAllowed() {
+		fields["uploadSessionId"] = job.UploadSessionID
+	} else {
+		fields["modelId"] = job.ModelID
+		fields["s3Key"] = job.S3Key
 	}
 
 	for name, value := range fields {
@@ -145,17 +409,52 @@ func validateRequiredFieldsForConversion(job ConversionJob) (bool, events.APIGat
 }
 
 func validateFileTypesForConversion(job ConversionJob) (bool, events.APIGatewayV2HTTPResponse) {
-	if job.FromFileType != "blend" {
-		return false, createErrorResponse(400, "Only blend files are supported")
+	input, ok := inputFormat(job.FromFileType)
+	if !ok {
+		return false, createErrorResponse(400, unsupportedInputMessage())
 	}
 
-	if !slices.Contains(supportedOutputFormats, job.ToFileType) {
-		message := fmt.Sprintf("Only %s files are supported", strings.Join(supportedOutputFormats, ", "))
-		return false, createErrorResponse(400, message)
+	if job.ToFileType != "" && len(job.ToFileTypes) > 0 {
+		return false, createErrorResponse(400, "Only one of toFileType and toFileTypes can be set")
+	}
+
+	for _, toFileType := range conversionTargets(job) {
+		if !slices.Contains(supportedOutputFormats, toFileType) {
+			message := fmt.Sprintf("Only %s files are supported", strings.Join(supportedOutputFormats, ", "))
+			return false, createErrorResponse(400, message)
+		}
+		if !slices.Contains(input.Outputs, toFileType) {
+			message := fmt.Sprintf("%s files cannot be converted to %s, only to %s", job.FromFileType, toFileType, strings.Join(input.Outputs, ", "))
+			return false, createErrorResponse(400, message)
+		}
 	}
 	return true, events.APIGatewayV2HTTPResponse{}
 }
 
+// validateSourceKeyForConversion keeps conversions to the model's own upload,
+// so a request cannot feed an arbitrary bucket object to the worker
+func validateSourceKeyForConversion(job ConversionJob) (bool, events.APIGatewayV2HTTPResponse) {
+	if expected := sourceObjectKey(job.ModelID, job.FromFileType); job.S3Key != expected {
+		return false, createErrorResponse(400, fmt.Sprintf("s3Key must be %s", expected))
+	}
+	return true, events.APIGatewayV2HTTPResponse{}
+}
+
+// conversionTargets returns the requested output formats without duplicates,
+// in the order they were requested
+func conversionTargets(job ConversionJob) []string {
+	if len(job.ToFileTypes) == 0 {
+		return []string{job.ToFileType}
+	}
+	var targets []string
+	for _, toFileType := range job.ToFileTypes {
+		if !slices.Contains(targets, toFileType) {
+			targets = append(targets, toFileType)
+		}
+	}
+	return targets
+}
+
 func handlePostValidations(request events.APIGatewayV2HTTPRequest, job ConversionJob) (events.APIGatewayV2HTTPResponse, error) {
 	if valid, resp := validateContentType(request.Headers[contentTypeHeader]); !valid {
 		return resp, nil
@@ -177,25 +476,133 @@ func handlePostValidations(request events.APIGatewayV2HTTPRequest, job Conversio
 		return resp, nil
 	}
 
+	if valid, resp := validateSourceKeyForConversion(job); !valid {
+		return resp, nil
+	}
+
 	return events.APIGatewayV2HTTPResponse{
 		Headers: map[string]string{contentTypeHeader: jsonContentType},
 	}, nil
 }
 
-func createConversionMessage(job ConversionJob) map[string]string {
-	return map[string]string{
-		"jobType":      "conversion",
+func createConversionMessage(job ConversionJob, route conversionRoute, toFileType string, submissionID string) map[string]string {
+	message := map[string]string{
+		"jobType":      jobTypeConversion,
 		"jobId":        uuid.New().String(),
 		"jobStatus":    "pending",
 		"connectionId": job.ConnectionID,
 		"fromFileType": job.FromFileType,
-		"toFileType":   job.ToFileType,
+		"toFileType":   toFileType,
 		"modelId":      job.ModelID,
 		"s3Key":        job.S3Key,
 	}
+	if submissionID != "" {
+		message["submissionId"] = submissionID
+	}
+	addSourceObject(message, job.Source)
+	addConversionRoute(message, route)
+	addQualityRules(message, job, toFileType)
+	return message
+}
+
+// A pending row expires on its own unless the enqueue that follows it is
+// confirmed, so a Lambda that dies between PutItem and SendMessage cannot leave
+// a ghost job behind
+const pendingJobTTL = 1 * time.Hour
+
+// jobStatusOf reads a row's status. TTL deletion can lag by days, so a pending
+// row past its expiry is reported as expired rather than still pending.
+func jobStatusOf(item map[string]types.AttributeValue, now time.Time) string {
+	status := stringAttribute(item, "jobStatus")
+	expiresAt, ok := item["expiresAt"].(*types.AttributeValueMemberN)
+	if status != "pending" || !ok {
+		return status
+	}
+	if unix, err := strconv.ParseInt(expiresAt.Value, 10, 64); err == nil && unix <= now.Unix() {
+		return "expired"
+	}
+	return status
+}
+
+// putPendingJob records a job before it is enqueued. Jobs from a multi-target
+// submission also record their sibling jobIds, so the notification lambda can
+// tell when the whole submission has finished.
+func putPendingJob(ctx context.Context, dynamoClient DynamoDBClient, message map[string]string, submissionJobIDs []string, source *SourceObject) error {
+	item := map[string]types.AttributeValue{
+		"timestamp": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		"expiresAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Add(pendingJobTTL).Unix(), 10)},
+	}
+	for name, value := range message {
+		item[name] = &types.AttributeValueMemberS{Value: value}
+	}
+	if len(submissionJobIDs) > 0 {
+		item["submissionJobIds"] = &types.AttributeValueMemberL{Value: stringListAttribute(submissionJobIDs)}
+	}
+	if source != nil {
+		item["sourceSize"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(source.Size, 10)}
+		if source.Stats != nil {
+			item["sourceStats"] = sourceStatsAttribute(*source.Stats)
+		}
+	}
+
+	_, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(os.Getenv("job_history_table")),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(jobId)"),
+	})
+	return err
+}
+
+func confirmPendingJob(ctx context.Context, dynamoClient DynamoDBClient, jobID string) error {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(os.Getenv("job_history_table")),
+		Key: map[string]types.AttributeValue{
+			"jobId": &types.AttributeValueMemberS{Value: jobID},
+		},
+		UpdateExpression:    aws.String("REMOVE expiresAt"),
+		ConditionExpression: aws.String("attribute_exists(jobId)"),
+	})
+	return err
+}
+
+func discardPendingJob(ctx context.Context, dynamoClient DynamoDBClient, jobID string) error {
+	_, err := dynamoClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(os.Getenv("job_history_table")),
+		Key: map[string]types.AttributeValue{
+			"jobId": &types.AttributeValueMemberS{Value: jobID},
+		},
+		ConditionExpression: aws.String("jobStatus = :pending"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending": &types.AttributeValueMemberS{Value: "pending"},
+		},
+	})
+	return err
 }
 
-func HandlePostRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest, sqsClient SQSClient) (events.APIGatewayV2HTTPResponse, error) {
+// failPendingJob marks a job whose message could not be sent as failed. It is
+// used instead of discardPendingJob inside multi-target submissions, where the
+// row has to stay so its siblings can still complete the submission.
+func failPendingJob(ctx context.Context, dynamoClient DynamoDBClient, jobID string, message string) error {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(os.Getenv("job_history_table")),
+		Key: map[string]types.AttributeValue{
+			"jobId": &types.AttributeValueMemberS{Value: jobID},
+		},
+		UpdateExpression:    aws.String("SET jobStatus = :failed, #error = :error REMOVE expiresAt"),
+		ConditionExpression: aws.String("jobStatus = :pending"),
+		ExpressionAttributeNames: map[string]string{
+			"#error": "error",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":failed":  &types.AttributeValueMemberS{Value: "failed"},
+			":error":   &types.AttributeValueMemberS{Value: message},
+			":pending": &types.AttributeValueMemberS{Value: "pending"},
+		},
+	})
+	return err
+}
+
+func HandlePostRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest, sqsClient SQSClient, dynamoClient DynamoDBClient, s3Client S3Client) (events.APIGatewayV2HTTPResponse, error) {
 	var job ConversionJob
 	if err := json.Unmarshal([]byte(request.Body), &job); err != nil {
 		return createErrorResponse(400, "Invalid request body"), nil
@@ -207,43 +614,215 @@ func HandlePostRequest(ctx context.Context, request events.APIGatewayV2HTTPReque
 	if apiKeyResp.StatusCode != 0 {
 		return apiKeyResp, nil
 	}
+	job.TenantID = helpers.APIKeyTenant(request.Headers["x-api-key"])
+
+	idempotencyKey := headerValue(request.Headers, idempotencyKeyHeader)
+	if idempotencyKey == "" {
+		return submitConversion(ctx, request, job, sqsClient, dynamoClient, s3Client)
+	}
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		return createErrorResponse(400, fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength)), nil
+	}
+	if os.Getenv("idempotency_table") == "" {
+		return createErrorResponse(500, "Idempotency table not configured"), nil
+	}
+
+	// The key is claimed before anything else is checked, so a retry gets the
+	// original response even if its upload session or source changed since
+	replay, err := claimIdempotencyKey(ctx, dynamoClient, idempotencyKey, conversionRequestHash(job))
+	if err != nil {
+		return createErrorResponse(500, "Error checking Idempotency-Key"), err
+	}
+	if replay != nil {
+		return *replay, nil
+	}
+
+	resp, err := submitConversion(ctx, request, job, sqsClient, dynamoClient, s3Client)
+	if resp.StatusCode == 202 {
+		var queued SuccessPostResponse
+		json.Unmarshal([]byte(resp.Body), &queued)
+		if completeErr := completeIdempotencyKey(ctx, dynamoClient, idempotencyKey, queued.JobID, resp); completeErr != nil {
+			// A retry within the lock duration gets a 409, after that it queues again
+			log.Printf("Error recording response for Idempotency-Key %s: %v", idempotencyKey, completeErr)
+		}
+	} else if releaseErr := releaseIdempotencyKey(ctx, dynamoClient, idempotencyKey); releaseErr != nil {
+		log.Printf("Error releasing Idempotency-Key %s: %v", idempotencyKey, releaseErr)
+	}
+	return resp, err
+}
+
+// submitConversion checks a conversion request and its source, then queues
+// its jobs
+func submitConversion(ctx context.Context, request events.APIGatewayV2HTTPRequest, job ConversionJob, sqsClient SQSClient, dynamoClient DynamoDBClient, s3Client S3Client) (events.APIGatewayV2HTTPResponse, error) {
+	maxSize := maxUploadSize()
+	if job.UploadSessionID != "" {
+		session, resp, err := applyUploadSession(ctx, dynamoClient, &job)
+		if resp.StatusCode != 0 {
+			return resp, err
+		}
+		maxSize = session.MaxSize
+	}
 
 	validations, _ := handlePostValidations(request, job)
 	if validations.StatusCode != 0 && validations.StatusCode != 200 {
 		return validations, nil
 	}
+	routes, routeResp := routeConversionJob(job)
+	if routeResp.StatusCode != 0 {
+		return routeResp, nil
+	}
+	maxSize = routedMaxSourceSize(maxSize, routes)
 
-	queueURL := os.Getenv("blender_jobs_queue_url")
-	if queueURL == "" {
-		return createErrorResponse(500, "Queue URL not configured"), nil
+	// A missing or truncated upload would otherwise only fail after a full
+	// Blender run
+	source, preflightResp, err := preflightSourceObject(ctx, s3Client, job, maxSize)
+	if preflightResp.StatusCode != 0 {
+		return preflightResp, err
+	}
+	if job.UploadSessionID == "" {
+		if valid, resp := validateRawSourceContentType(job, source); !valid {
+			return resp, nil
+		}
 	}
+	job.Source = source
 
-	message := createConversionMessage(job)
-	messageBody, err := json.Marshal(message)
-	if err != nil {
-		return createErrorResponse(500, "Error creating a job queue message"), err
+	return queueConversionJobs(ctx, job, routes, sqsClient, dynamoClient)
+}
+
+func queueConversionJobs(ctx context.Context, job ConversionJob, routes map[string]conversionRoute, sqsClient SQSClient, dynamoClient DynamoDBClient) (events.APIGatewayV2HTTPResponse, error) {
+	targets := conversionTargets(job)
+	submissionID := ""
+	if len(targets) > 1 {
+		submissionID = uuid.New().String()
 	}
 
-	_, err = sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
-		QueueUrl:    aws.String(queueURL),
-		MessageBody: aws.String(string(messageBody)),
-	})
-	if err != nil {
+	messages := make([]map[string]string, 0, len(targets))
+	var submissionJobIDs []string
+	for _, toFileType := range targets {
+		message := createConversionMessage(job, routes[toFileType], toFileType, submissionID)
+		messages = append(messages, message)
+		if submissionID != "" {
+			submissionJobIDs = append(submissionJobIDs, message["jobId"])
+		}
+	}
+
+	// Every row of a submission is written before anything is sent, so a fast
+	// worker can never see a submission with targets still missing
+	for i, message := range messages {
+		if err := putPendingJob(ctx, dynamoClient, message, submissionJobIDs, job.Source); err != nil {
+			for _, written := range messages[:i] {
+				if discardErr := discardPendingJob(ctx, dynamoClient, written["jobId"]); discardErr != nil {
+					log.Printf("Error discarding pending job %s, it will expire on its own: %v", written["jobId"], discardErr)
+				}
+			}
+			return createErrorResponse(500, "Error recording job"), err
+		}
+	}
+
+	var queuedJobs []QueuedJob
+	var sendErr error
+	for _, message := range messages {
+		queuedJob := QueuedJob{ToFileType: message["toFileType"], JobID: message["jobId"]}
+		messageBody, err := json.Marshal(message)
+		if err == nil {
+			_, err = sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+				QueueUrl:    aws.String(routes[message["toFileType"]].QueueURL),
+				MessageBody: aws.String(string(messageBody)),
+			})
+		}
+		if err != nil {
+			sendErr = err
+			queuedJob.Error = "Error sending message to queue"
+			if submissionID == "" {
+				err = discardPendingJob(ctx, dynamoClient, message["jobId"])
+			} else {
+				err = failPendingJob(ctx, dynamoClient, message["jobId"], queuedJob.Error)
+			}
+			if err != nil {
+				log.Printf("Error rolling back pending job %s, it will expire on its own: %v", message["jobId"], err)
+			}
+			queuedJobs = append(queuedJobs, queuedJob)
+			continue
+		}
+
+		if err := confirmPendingJob(ctx, dynamoClient, message["jobId"]); err != nil {
+			// The job is queued either way, and the worker's notification clears the expiry
+			log.Printf("Error confirming pending job %s: %v", message["jobId"], err)
+		}
+		queuedJobs = append(queuedJobs, queuedJob)
+	}
+
+	successResp := SuccessPostResponse{Status: "Job successfully queued", SubmissionID: submissionID}
+	for _, queuedJob := range queuedJobs {
+		if queuedJob.Error == "" && successResp.JobID == "" {
+			successResp.JobID = queuedJob.JobID
+		}
+	}
+	if successResp.JobID == "" {
 		errorResp := ErrorResponse{Error: "Error sending message to queue"}
-		return createSuccessResponse(500, errorResp), err
+		return createSuccessResponse(500, errorResp), sendErr
 	}
 
-	successResp := SuccessPostResponse{Status: "Job successfully queued"}
+	if submissionID != "" {
+		successResp.Status = "Jobs successfully queued"
+		if sendErr != nil {
+			successResp.Status = "Some jobs could not be queued"
+			log.Printf("Partially queued submission %s: %v", submissionID, sendErr)
+		}
+		successResp.Jobs = queuedJobs
+	}
 	return createSuccessResponse(202, successResp), nil
 }
 
 /*
 ###########################################
-GET /v1/3d-model/{unique-model-id}?getPresignedUploadURL={boolean}&fileType={string}
+GET /v1/3d-model/{unique-model-id}?getPresignedUploadURL={boolean}&fileType={string}&bundle={zip|urls}&lod={number}
 ###########################################
 */
 
-func HandleGetModelRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+func latestCompletedConversion(ctx context.Context, dynamoClient DynamoDBClient, modelID string, toFileType string) (map[string]types.AttributeValue, error) {
+	return latestCompletedJob(ctx, dynamoClient, modelID, jobTypeConversion, toFileType)
+}
+
+func latestCompletedJob(ctx context.Context, dynamoClient DynamoDBClient, modelID string, jobType string, toFileType string) (map[string]types.AttributeValue, error) {
+	var latest map[string]types.AttributeValue
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		result, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(os.Getenv("job_history_table")),
+			IndexName:              aws.String("ModelJobTypeIndex"),
+			KeyConditionExpression: aws.String("modelId = :modelId AND jobType = :jobType"),
+			// Outputs with validation warnings are still served
+			FilterExpression: aws.String("toFileType = :toFileType AND jobStatus IN (:completed, :completedWithWarnings)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":modelId":               &types.AttributeValueMemberS{Value: modelID},
+				":jobType":               &types.AttributeValueMemberS{Value: jobType},
+				":toFileType":            &types.AttributeValueMemberS{Value: toFileType},
+				":completed":             &types.AttributeValueMemberS{Value: "completed"},
+				":completedWithWarnings": &types.AttributeValueMemberS{Value: "completed_with_warnings"},
+			},
+			ExclusiveStartKey: lastEvaluatedKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range result.Items {
+			if stringAttribute(item, "newS3Key") == "" {
+				continue
+			}
+			// RFC3339 UTC timestamps sort lexically
+			if latest == nil || stringAttribute(item, "timestamp") > stringAttribute(latest, "timestamp") {
+				latest = item
+			}
+		}
+		if result.LastEvaluatedKey == nil {
+			return latest, nil
+		}
+		lastEvaluatedKey = result.LastEvaluatedKey
+	}
+}
+
+func HandleGetModelRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest, dynamoClient DynamoDBClient, s3Client S3Client, presignClient PresignClient) (events.APIGatewayV2HTTPResponse, error) {
 	apiKeyResp, err := helpers.ValidateHttpAPIKey(request)
 	if err != nil {
 		return createErrorResponse(500, "Error validating API key"), err
@@ -257,13 +836,6 @@ func HandleGetModelRequest(ctx context.Context, request events.APIGatewayV2HTTPR
 		return createErrorResponse(400, "Model id is required"), err
 	}
 
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		return createErrorResponse(500, "Failed to load AWS config"), err
-	}
-
-	s3Client := s3.NewFromConfig(cfg)
-	presignClient := s3.NewPresignClient(s3Client)
 	bucket := os.Getenv("model_s3_bucket")
 
 	shouldGetPresignedUploadURL := request.QueryStringParameters["getPresignedUploadURL"]
@@ -271,16 +843,30 @@ func HandleGetModelRequest(ctx context.Context, request events.APIGatewayV2HTTPR
 	if fileType == "" {
 		return createErrorResponse(400, "Malformed request - fileType query parameter is required"), nil
 	}
-	if shouldGetPresignedUploadURL == "true" && fileType != "blend" {
+	if _, ok := inputFormat(fileType); shouldGetPresignedUploadURL == "true" && !ok {
 		return createErrorResponse(400, "Malformed request - fileType query parameter is not supported"), nil
 	}
-	if (shouldGetPresignedUploadURL == "false" || shouldGetPresignedUploadURL == "") && fileType != "glb" {
+	if (shouldGetPresignedUploadURL == "false" || shouldGetPresignedUploadURL == "") && !slices.Contains(supportedOutputFormats, fileType) {
 		return createErrorResponse(400, "Malformed request - fetching this file type is not supported"), nil
 	}
-
-	objectKey := fmt.Sprintf("%s/%s.%s", fileType, modelID, fileType)
+	bundle := request.QueryStringParameters["bundle"]
+	if bundle != "" && bundle != "zip" && bundle != "urls" {
+		return createErrorResponse(400, "Malformed request - bundle query parameter must be zip or urls"), nil
+	}
+	// Level 0 is the GLB itself, the levels of detail generated from it start at 1
+	lod := 0
+	if lodStr := request.QueryStringParameters["lod"]; lodStr != "" {
+		lod, err = strconv.Atoi(lodStr)
+		if err != nil || lod < 0 {
+			return createErrorResponse(400, "Malformed request - lod query parameter must be a level of detail from 0"), nil
+		}
+		if fileType != "glb" || bundle != "" || shouldGetPresignedUploadURL == "true" {
+			return createErrorResponse(400, "Malformed request - lod query parameter is only supported when downloading a glb"), nil
+		}
+	}
 
 	if shouldGetPresignedUploadURL == "true" {
+		objectKey := sourceObjectKey(modelID, fileType)
 		presignedURL, err := presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
 			Bucket: aws.String(bucket),
 			Key:    aws.String(objectKey),
@@ -295,16 +881,49 @@ func HandleGetModelRequest(ctx context.Context, request events.APIGatewayV2HTTPR
 		return createSuccessResponse(200, successResp), nil
 	}
 
+	conversion, err := latestCompletedConversion(ctx, dynamoClient, modelID, fileType)
+	if err != nil {
+		return createErrorResponse(500, "Failed to query model job history"), err
+	}
+	if conversion == nil {
+		message := fmt.Sprintf("Model %s has not been converted to %s yet", modelID, fileType)
+		return createErrorResponse(404, message), nil
+	}
+
+	job := modelMetadataFromItem(conversion)
+	downloadKey := job.NewS3Key
+	if lod > 0 {
+		downloadKey, err = lodS3Key(ctx, dynamoClient, modelID, lod)
+		if err != nil {
+			return createErrorResponse(500, "Failed to query model job history"), err
+		}
+		if downloadKey == "" {
+			return createErrorResponse(404, fmt.Sprintf("Model %s has no level of detail %d", modelID, lod)), nil
+		}
+	}
+	if bundle == "zip" {
+		downloadKey, err = createArtifactBundle(ctx, s3Client, bucket, job)
+		if err != nil {
+			return createErrorResponse(500, "Failed to create download bundle"), err
+		}
+	}
+
 	presignedURL, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
-		Key:    aws.String(objectKey),
-	}, s3.WithPresignExpires(time.Duration(24)*time.Hour))
+		Key:    aws.String(downloadKey),
+	}, s3.WithPresignExpires(downloadURLExpiry))
 
 	if err != nil {
 		return createErrorResponse(500, "Failed to generate presigned URL"), err
 	}
 
 	successResp := SuccessGetModelResponse{PresignedUrl: presignedURL.URL}
+	if bundle == "urls" {
+		successResp.Files, err = presignArtifactURLs(ctx, presignClient, bucket, jobArtifacts(job))
+		if err != nil {
+			return createErrorResponse(500, "Failed to generate presigned URL"), err
+		}
+	}
 	return createSuccessResponse(200, successResp), nil
 }
 
@@ -314,6 +933,16 @@ GET /v1/3d-models?fileType{string}&limit={number}&cursor={string}
 ###########################################
 */
 
+// listedModel reports whether a job shows up in GET /3d-models. Failed,
+// cancelled and expired jobs have no model, and LOD jobs only add levels to a
+// model its conversion job already lists.
+func listedModel(model ModelMetadata) bool {
+	if model.JobType == jobTypeLOD {
+		return false
+	}
+	return model.JobStatus != "failed" && model.JobStatus != "cancelled" && model.JobStatus != "expired"
+}
+
 func HandleGetModelsRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
 	apiKeyResp, err := helpers.ValidateHttpAPIKey(request)
 	if err != nil {
@@ -391,27 +1020,10 @@ func HandleGetModelsRequest(ctx context.Context, request events.APIGatewayV2HTTP
 		}
 
 		for _, item := range result.Items {
-			jobStatus := item["jobStatus"].(*types.AttributeValueMemberS).Value
-			if jobStatus == "failed" {
+			model := modelMetadataFromItem(item)
+			if !listedModel(model) {
 				continue
 			}
-			model := ModelMetadata{
-				JobID:        item["jobId"].(*types.AttributeValueMemberS).Value,
-				ConnectionID: item["connectionId"].(*types.AttributeValueMemberS).Value,
-				JobType:      item["jobType"].(*types.AttributeValueMemberS).Value,
-				JobStatus:    jobStatus,
-				FromFileType: item["fromFileType"].(*types.AttributeValueMemberS).Value,
-				ToFileType:   item["toFileType"].(*types.AttributeValueMemberS).Value,
-				ModelID:      item["modelId"].(*types.AttributeValueMemberS).Value,
-				S3Key:        item["s3Key"].(*types.AttributeValueMemberS).Value,
-				Timestamp:    item["timestamp"].(*types.AttributeValueMemberS).Value,
-			}
-			if newS3Key, ok := item["newS3Key"]; ok {
-				model.NewS3Key = newS3Key.(*types.AttributeValueMemberS).Value
-			}
-			if errorMsg, ok := item["error"]; ok {
-				model.Error = errorMsg.(*types.AttributeValueMemberS).Value
-			}
 			models = append(models, model)
 			if len(models) == limit {
 				break
@@ -446,6 +1058,186 @@ func HandleGetModelsRequest(ctx context.Context, request events.APIGatewayV2HTTP
 	return createSuccessResponse(200, response), nil
 }
 
+/*
+###########################################
+DELETE /v1/3d-model/{unique-model-id}
+###########################################
+*/
+
+// S3 DeleteObjects accepts at most 1000 keys per call
+const maxDeleteObjectsPerRequest = 1000
+
+func modelArtifactPrefixes(modelID string) []string {
+	prefixes := []string{fmt.Sprintf("bundles/%s/", modelID)}
+	for _, input := range knownInputFormats {
+		// Most input formats are also output formats, added below
+		if !slices.Contains(supportedOutputFormats, input.Format) {
+			prefixes = append(prefixes, fmt.Sprintf("%s/%s.", input.Format, modelID))
+		}
+	}
+	for _, format := range supportedOutputFormats {
+		prefixes = append(prefixes,
+			fmt.Sprintf("%s/%s.", format, modelID),
+			fmt.Sprintf("%s/%s/", format, modelID),
+		)
+	}
+	return prefixes
+}
+
+func listModelJobIDs(ctx context.Context, dynamoClient DynamoDBClient, modelID string) ([]string, error) {
+	var jobIDs []string
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		result, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(os.Getenv("job_history_table")),
+			IndexName:              aws.String("ModelJobTypeIndex"),
+			KeyConditionExpression: aws.String("modelId = :modelId"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":modelId": &types.AttributeValueMemberS{Value: modelID},
+			},
+			ExclusiveStartKey: lastEvaluatedKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range result.Items {
+			if jobID, ok := item["jobId"].(*types.AttributeValueMemberS); ok {
+				jobIDs = append(jobIDs, jobID.Value)
+			}
+		}
+		if result.LastEvaluatedKey == nil {
+			return jobIDs, nil
+		}
+		lastEvaluatedKey = result.LastEvaluatedKey
+	}
+}
+
+func listObjectKeys(ctx context.Context, s3Client S3Client, bucket string, prefix string) ([]string, error) {
+	var keys []string
+	var continuationToken *string
+	for {
+		result, err := s3Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(bucket),
+			Prefix:            aws.String(prefix),
+			ContinuationToken: continuationToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			keys = append(keys, aws.ToString(object.Key))
+		}
+		if !aws.ToBool(result.IsTruncated) {
+			return keys, nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+func deleteObjectKeys(ctx context.Context, s3Client S3Client, bucket string, keys []string) ([]string, []DeleteFailure) {
+	var deleted []string
+	var failures []DeleteFailure
+	for start := 0; start < len(keys); start += maxDeleteObjectsPerRequest {
+		chunk := keys[start:min(start+maxDeleteObjectsPerRequest, len(keys))]
+		objects := make([]s3types.ObjectIdentifier, 0, len(chunk))
+		for _, key := range chunk {
+			objects = append(objects, s3types.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		result, err := s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3types.Delete{Objects: objects},
+		})
+		if err != nil {
+			for _, key := range chunk {
+				failures = append(failures, DeleteFailure{Resource: "s3://" + bucket + "/" + key, Error: err.Error()})
+			}
+			continue
+		}
+		for _, object := range result.Deleted {
+			deleted = append(deleted, aws.ToString(object.Key))
+		}
+		for _, objectErr := range result.Errors {
+			failures = append(failures, DeleteFailure{
+				Resource: "s3://" + bucket + "/" + aws.ToString(objectErr.Key),
+				Error:    fmt.Sprintf("%s: %s", aws.ToString(objectErr.Code), aws.ToString(objectErr.Message)),
+			})
+		}
+	}
+	return deleted, failures
+}
+
+func HandleDeleteModelRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest, s3Client S3Client, dynamoClient DynamoDBClient) (events.APIGatewayV2HTTPResponse, error) {
+	apiKeyResp, err := helpers.ValidateHttpAPIKey(request)
+	if err != nil {
+		return createErrorResponse(500, "Error validating API key"), err
+	}
+	if apiKeyResp.StatusCode != 0 {
+		return apiKeyResp, nil
+	}
+
+	modelID := request.PathParameters["id"]
+	if modelID == "" {
+		return createErrorResponse(400, "Model id is required"), nil
+	}
+
+	bucket := os.Getenv("model_s3_bucket")
+	tableName := os.Getenv("job_history_table")
+	response := DeleteModelResponse{
+		ModelID:        modelID,
+		DeletedObjects: []string{},
+		DeletedJobs:    []string{},
+	}
+
+	jobIDs, err := listModelJobIDs(ctx, dynamoClient, modelID)
+	if err != nil {
+		return createErrorResponse(500, "Failed to query model job history"), err
+	}
+
+	var keys []string
+	for _, prefix := range modelArtifactPrefixes(modelID) {
+		prefixKeys, err := listObjectKeys(ctx, s3Client, bucket, prefix)
+		if err != nil {
+			response.Failures = append(response.Failures, DeleteFailure{Resource: "s3://" + bucket + "/" + prefix, Error: err.Error()})
+			continue
+		}
+		keys = append(keys, prefixKeys...)
+	}
+
+	if len(jobIDs) == 0 && len(keys) == 0 && len(response.Failures) == 0 {
+		return createErrorResponse(404, fmt.Sprintf("Model %s not found", modelID)), nil
+	}
+
+	deleted, failures := deleteObjectKeys(ctx, s3Client, bucket, keys)
+	response.DeletedObjects = append(response.DeletedObjects, deleted...)
+	response.Failures = append(response.Failures, failures...)
+
+	// Keep the job history while any object is left behind, so the model stays
+	// discoverable and a repeated DELETE can finish the cleanup
+	if len(response.Failures) == 0 {
+		for _, jobID := range jobIDs {
+			_, err := dynamoClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+				TableName: aws.String(tableName),
+				Key: map[string]types.AttributeValue{
+					"jobId": &types.AttributeValueMemberS{Value: jobID},
+				},
+			})
+			if err != nil {
+				response.Failures = append(response.Failures, DeleteFailure{Resource: "job/" + jobID, Error: err.Error()})
+				continue
+			}
+			response.DeletedJobs = append(response.DeletedJobs, jobID)
+		}
+	}
+
+	if len(response.Failures) > 0 {
+		log.Printf("Partial delete for model %s: %+v", modelID, response.Failures)
+		response.Error = "Model was only partially deleted, retry the request to finish cleanup"
+		return createSuccessResponse(500, response), nil
+	}
+	return createSuccessResponse(200, response), nil
+}
+
 func handler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayV2HTTPResponse, error) {
 	log.Println("Received request:", request)
 	req := events.APIGatewayV2HTTPRequest{
@@ -463,12 +1255,54 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (events
 	log.Printf("Converted request path: %s", req.RawPath)
 	switch strings.ToUpper(req.RequestContext.HTTP.Method) {
 	case "GET":
+		if strings.Contains(req.RawPath, "/3d-model/") && strings.Contains(req.RawPath, "/uploads/") {
+			cfg, err := config.LoadDefaultConfig(ctx)
+			if err != nil {
+				return createErrorResponse(500, "Error loading AWS config"), err
+			}
+
+			s3Client := s3.NewFromConfig(cfg)
+			return HandleGetUploadRequest(ctx, req, s3Client, s3.NewPresignClient(s3Client))
+		}
+		if strings.Contains(req.RawPath, "/3d-model/batch/") {
+			cfg, err := config.LoadDefaultConfig(ctx)
+			if err != nil {
+				return createErrorResponse(500, "Error loading AWS config"), err
+			}
+
+			return HandleGetBatchRequest(ctx, req, dynamodb.NewFromConfig(cfg))
+		}
+		if strings.Contains(req.RawPath, "/3d-model/") && strings.HasSuffix(req.RawPath, "/stats") {
+			cfg, err := config.LoadDefaultConfig(ctx)
+			if err != nil {
+				return createErrorResponse(500, "Error loading AWS config"), err
+			}
+
+			return HandleGetModelStatsRequest(ctx, req, dynamodb.NewFromConfig(cfg))
+		}
 		if strings.Contains(req.RawPath, "/3d-model/") {
-			return HandleGetModelRequest(ctx, req)
+			cfg, err := config.LoadDefaultConfig(ctx)
+			if err != nil {
+				return createErrorResponse(500, "Error loading AWS config"), err
+			}
+
+			s3Client := s3.NewFromConfig(cfg)
+			return HandleGetModelRequest(ctx, req, dynamodb.NewFromConfig(cfg), s3Client, s3.NewPresignClient(s3Client))
 		}
 		if strings.Contains(req.RawPath, "/3d-models") {
 			return HandleGetModelsRequest(ctx, req)
 		}
+		if strings.HasSuffix(req.RawPath, "/formats") {
+			return HandleGetFormatsRequest(ctx, req)
+		}
+		if strings.Contains(req.RawPath, "/jobs/") {
+			cfg, err := config.LoadDefaultConfig(ctx)
+			if err != nil {
+				return createErrorResponse(500, "Error loading AWS config"), err
+			}
+
+			return HandleGetJobRequest(ctx, req, dynamodb.NewFromConfig(cfg))
+		}
 		return createErrorResponse(404, "Not found"), nil
 	case "POST":
 		cfg, err := config.LoadDefaultConfig(ctx)
@@ -476,8 +1310,42 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (events
 			return createErrorResponse(500, "Error loading AWS config"), err
 		}
 
+		if strings.Contains(req.RawPath, "/3d-model/") && strings.HasSuffix(req.RawPath, "/uploads") {
+			return HandleCreateUploadRequest(ctx, req, s3.NewFromConfig(cfg))
+		}
+		if strings.Contains(req.RawPath, "/3d-model/") && strings.HasSuffix(req.RawPath, "/complete") {
+			return HandleCompleteUploadRequest(ctx, req, s3.NewFromConfig(cfg))
+		}
+		if strings.Contains(req.RawPath, "/jobs/") && strings.HasSuffix(req.RawPath, "/cancel") {
+			return HandleCancelJobRequest(ctx, req, dynamodb.NewFromConfig(cfg))
+		}
 		sqsClient := sqs.NewFromConfig(cfg)
-		return HandlePostRequest(ctx, req, sqsClient)
+		if strings.Contains(req.RawPath, "/jobs/") && strings.HasSuffix(req.RawPath, "/retry") {
+			return HandleRetryJobRequest(ctx, req, sqsClient, dynamodb.NewFromConfig(cfg), s3.NewFromConfig(cfg))
+		}
+		if strings.Contains(req.RawPath, "/3d-model/") && strings.HasSuffix(req.RawPath, "/lods") {
+			return HandlePostLODRequest(ctx, req, sqsClient, dynamodb.NewFromConfig(cfg))
+		}
+		if strings.Contains(req.RawPath, "/3d-model/batch") {
+			return HandlePostBatchRequest(ctx, req, sqsClient, dynamodb.NewFromConfig(cfg), s3.NewFromConfig(cfg))
+		}
+		if strings.HasSuffix(req.RawPath, "/uploads") {
+			return HandleCreateUploadSessionRequest(ctx, req, dynamodb.NewFromConfig(cfg), s3.NewPresignClient(s3.NewFromConfig(cfg)))
+		}
+		return HandlePostRequest(ctx, req, sqsClient, dynamodb.NewFromConfig(cfg), s3.NewFromConfig(cfg))
+	case "DELETE":
+		if !strings.Contains(req.RawPath, "/3d-model/") {
+			return createErrorResponse(404, "Not found"), nil
+		}
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return createErrorResponse(500, "Error loading AWS config"), err
+		}
+
+		if strings.Contains(req.RawPath, "/uploads/") {
+			return HandleAbortUploadRequest(ctx, req, s3.NewFromConfig(cfg))
+		}
+		return HandleDeleteModelRequest(ctx, req, s3.NewFromConfig(cfg), dynamodb.NewFromConfig(cfg))
 	default:
 		return events.APIGatewayV2HTTPResponse{
 			StatusCode: 405,
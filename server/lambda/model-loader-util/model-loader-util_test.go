@@ -1,37 +1,347 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
 	"github.com/stretchr/testify/assert"
 )
 
+const (
+	testQueueURL       = "https://sqs.us-east-1.amazonaws.com/123456789012/test-queue"
+	testNativeQueueURL = "https://sqs.us-east-1.amazonaws.com/123456789012/test-native-queue"
+	testHTTPQueueURL   = "https://sqs.us-east-1.amazonaws.com/123456789012/test-http-queue"
+)
+
+// setupTestEnv configures every table, bucket and queue the handlers read,
+// restored when the test ends. Tests change single variables with t.Setenv.
+func setupTestEnv(t *testing.T) {
+	t.Setenv("api_key_value", "test-api-key")
+	t.Setenv("model_s3_bucket", "test-bucket")
+	t.Setenv("blender_jobs_queue_url", testQueueURL)
+	t.Setenv("native_jobs_queue_url", testNativeQueueURL)
+	t.Setenv("http_jobs_queue_url", testHTTPQueueURL)
+	t.Setenv("job_history_table", "test-job-history-table")
+	t.Setenv("idempotency_table", "test-idempotency-table")
+	t.Setenv("upload_sessions_table", "test-upload-sessions-table")
+	// Most handler tests name their source directly instead of creating an
+	// upload session first
+	t.Setenv("allow_raw_source_keys", "true")
+
+	// Long-polling tests would otherwise wait a second per poll
+	previousInterval := jobPollInterval
+	jobPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { jobPollInterval = previousInterval })
+}
+
 type mockSQSClient struct {
-	sendMessageInput *sqs.SendMessageInput
-	sendMessageErr   error
+	sendMessageInput  *sqs.SendMessageInput
+	sendMessageErr    error
+	sendMessageInputs []*sqs.SendMessageInput
+	// sendMessageErrs fails individual calls, keyed by their 1-based position
+	sendMessageErrs map[int]error
+
+	sendMessageBatchInputs []*sqs.SendMessageBatchInput
+	sendMessageBatchErr    error
+	// sendMessageBatchFailed fails individual entries, keyed by their 1-based
+	// position across all calls
+	sendMessageBatchFailed map[int]bool
+	sendMessageBatchSeen   int
+}
+
+func (m *mockSQSClient) SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	m.sendMessageBatchInputs = append(m.sendMessageBatchInputs, params)
+	if m.sendMessageBatchErr != nil {
+		return nil, m.sendMessageBatchErr
+	}
+	output := &sqs.SendMessageBatchOutput{}
+	for _, entry := range params.Entries {
+		m.sendMessageBatchSeen++
+		if m.sendMessageBatchFailed[m.sendMessageBatchSeen] {
+			output.Failed = append(output.Failed, sqstypes.BatchResultErrorEntry{
+				Id:      entry.Id,
+				Code:    aws.String("InternalError"),
+				Message: aws.String("internal error"),
+			})
+			continue
+		}
+		output.Successful = append(output.Successful, sqstypes.SendMessageBatchResultEntry{Id: entry.Id})
+	}
+	return output, nil
 }
 
 func (m *mockSQSClient) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
 	m.sendMessageInput = params
+	m.sendMessageInputs = append(m.sendMessageInputs, params)
+	if err, ok := m.sendMessageErrs[len(m.sendMessageInputs)]; ok {
+		return nil, err
+	}
 	return &sqs.SendMessageOutput{}, m.sendMessageErr
 }
 
+type mockDynamoDBClient struct {
+	DynamoDBClient
+	// mu guards the recorded inputs, batch items are handled concurrently
+	mu          sync.Mutex
+	queryOutput *dynamodb.QueryOutput
+	// jobTypeQueryOutputs answer queries on one jobType instead of queryOutput
+	jobTypeQueryOutputs map[string]*dynamodb.QueryOutput
+	queryErr            error
+	deleteItemInputs    []*dynamodb.DeleteItemInput
+	deleteItemErr       error
+	getItemInputs       []*dynamodb.GetItemInput
+	getItemOutputs      []*dynamodb.GetItemOutput
+	getItemErr          error
+	putItemInputs       []*dynamodb.PutItemInput
+	putItemErr          error
+	// putItemTableErrs fails PutItem calls on individual tables
+	putItemTableErrs map[string]error
+	updateItemInputs []*dynamodb.UpdateItemInput
+	updateItemOutput *dynamodb.UpdateItemOutput
+	updateItemErr    error
+}
+
+func (m *mockDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putItemInputs = append(m.putItemInputs, params)
+	if err, ok := m.putItemTableErrs[*params.TableName]; ok {
+		return nil, err
+	}
+	return &dynamodb.PutItemOutput{}, m.putItemErr
+}
+
+func (m *mockDynamoDBClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.updateItemInputs = append(m.updateItemInputs, params)
+	if m.updateItemErr != nil {
+		return nil, m.updateItemErr
+	}
+	if m.updateItemOutput != nil {
+		return m.updateItemOutput, nil
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+// GetItem returns getItemOutputs in order, repeating the last one once exhausted
+func (m *mockDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.getItemInputs = append(m.getItemInputs, params)
+	if m.getItemErr != nil {
+		return nil, m.getItemErr
+	}
+	output := m.getItemOutputs[min(len(m.getItemInputs), len(m.getItemOutputs))-1]
+	return output, nil
+}
+
+func (m *mockDynamoDBClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if jobType, ok := params.ExpressionAttributeValues[":jobType"].(*types.AttributeValueMemberS); ok && m.jobTypeQueryOutputs[jobType.Value] != nil {
+		return m.jobTypeQueryOutputs[jobType.Value], m.queryErr
+	}
+	return m.queryOutput, m.queryErr
+}
+
+func (m *mockDynamoDBClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteItemInputs = append(m.deleteItemInputs, params)
+	return &dynamodb.DeleteItemOutput{}, m.deleteItemErr
+}
+
+type mockS3Client struct {
+	S3Client
+	objects             map[string][]string
+	deleteObjectsInputs []*s3.DeleteObjectsInput
+	deleteObjectsErrors []s3types.Error
+	contents            map[string]string
+	// contentTypes default to application/octet-stream, like S3's
+	contentTypes    map[string]string
+	putObjectInputs []*s3.PutObjectInput
+	putObjectBodies map[string][]byte
+
+	// uploads holds the parts of in-progress multipart uploads, keyed by upload id
+	uploads                       map[string][]s3types.Part
+	completeMultipartUploadInputs []*s3.CompleteMultipartUploadInput
+	completeMultipartUploadErr    error
+	abortMultipartUploadInputs    []*s3.AbortMultipartUploadInput
+}
+
+func (m *mockS3Client) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	if m.uploads == nil {
+		m.uploads = map[string][]s3types.Part{}
+	}
+	uploadID := fmt.Sprintf("upload-%d", len(m.uploads)+1)
+	m.uploads[uploadID] = nil
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String(uploadID), Key: params.Key}, nil
+}
+
+func (m *mockS3Client) ListParts(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	parts, ok := m.uploads[*params.UploadId]
+	if !ok {
+		return nil, &s3types.NoSuchUpload{}
+	}
+	return &s3.ListPartsOutput{Parts: parts, IsTruncated: aws.Bool(false)}, nil
+}
+
+func (m *mockS3Client) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	m.completeMultipartUploadInputs = append(m.completeMultipartUploadInputs, params)
+	if _, ok := m.uploads[*params.UploadId]; !ok {
+		return nil, &s3types.NoSuchUpload{}
+	}
+	if m.completeMultipartUploadErr != nil {
+		return nil, m.completeMultipartUploadErr
+	}
+	delete(m.uploads, *params.UploadId)
+	return &s3.CompleteMultipartUploadOutput{Key: params.Key}, nil
+}
+
+func (m *mockS3Client) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	m.abortMultipartUploadInputs = append(m.abortMultipartUploadInputs, params)
+	if _, ok := m.uploads[*params.UploadId]; !ok {
+		return nil, &s3types.NoSuchUpload{}
+	}
+	delete(m.uploads, *params.UploadId)
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (m *mockS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	content, ok := m.contents[*params.Key]
+	if !ok {
+		return nil, &s3types.NoSuchKey{}
+	}
+	if params.IfMatch != nil && *params.IfMatch != mockETag(content) {
+		return nil, &smithy.GenericAPIError{Code: "PreconditionFailed", Message: "At least one of the pre-conditions you specified did not hold"}
+	}
+	if params.Range != nil {
+		var start, end int
+		fmt.Sscanf(*params.Range, "bytes=%d-%d", &start, &end)
+		content = content[min(start, len(content)):min(end+1, len(content))]
+	}
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(strings.NewReader(content)),
+		ContentLength: aws.Int64(int64(len(content))),
+	}, nil
+}
+
+func (m *mockS3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	content, ok := m.contents[*params.Key]
+	if !ok {
+		return nil, &s3types.NotFound{}
+	}
+	contentType, ok := m.contentTypes[*params.Key]
+	if !ok {
+		contentType = "application/octet-stream"
+	}
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(content))), ETag: aws.String(mockETag(content)), ContentType: aws.String(contentType)}, nil
+}
+
+func mockETag(content string) string {
+	return fmt.Sprintf(`"%x"`, md5.Sum([]byte(content)))
+}
+
+// testBlendFile is the smallest file the .blend inspector accepts: a header,
+// an empty DNA1 block and the ENDB block
+func testBlendFile() string {
+	var buf bytes.Buffer
+	buf.WriteString("BLENDER-v402")
+	writeBlock := func(code string, data []byte) {
+		buf.WriteString(code)
+		binary.Write(&buf, binary.LittleEndian, int32(len(data)))
+		binary.Write(&buf, binary.LittleEndian, uint64(0))
+		binary.Write(&buf, binary.LittleEndian, int32(0))
+		binary.Write(&buf, binary.LittleEndian, int32(1))
+		buf.Write(data)
+	}
+	writeBlock("DNA1", []byte("SDNANAME\x00\x00\x00\x00TYPE\x00\x00\x00\x00TLENSTRC\x00\x00\x00\x00"))
+	writeBlock("ENDB", nil)
+	return buf.String()
+}
+
+// newSourceS3Client returns an S3 mock holding a valid .blend source under
+// each key, blend/test-model-id.blend when no key is given
+func newSourceS3Client(keys ...string) *mockS3Client {
+	if len(keys) == 0 {
+		keys = []string{"blend/test-model-id.blend"}
+	}
+	contents := map[string]string{}
+	for _, key := range keys {
+		contents[key] = testBlendFile()
+	}
+	return &mockS3Client{contents: contents}
+}
+
+func (m *mockS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	m.putObjectInputs = append(m.putObjectInputs, params)
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	if m.putObjectBodies == nil {
+		m.putObjectBodies = map[string][]byte{}
+	}
+	m.putObjectBodies[*params.Key] = body
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (m *mockS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	var contents []s3types.Object
+	for _, key := range m.objects[*params.Prefix] {
+		contents = append(contents, s3types.Object{Key: aws.String(key)})
+	}
+	return &s3.ListObjectsV2Output{Contents: contents, IsTruncated: aws.Bool(false)}, nil
+}
+
+func (m *mockS3Client) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	m.deleteObjectsInputs = append(m.deleteObjectsInputs, params)
+	failed := map[string]bool{}
+	for _, objectErr := range m.deleteObjectsErrors {
+		failed[*objectErr.Key] = true
+	}
+	output := &s3.DeleteObjectsOutput{Errors: m.deleteObjectsErrors}
+	for _, object := range params.Delete.Objects {
+		if !failed[*object.Key] {
+			output.Deleted = append(output.Deleted, s3types.DeletedObject{Key: object.Key})
+		}
+	}
+	return output, nil
+}
+
 func TestHandlePostRequest_SuccessQueueJob(t *testing.T) {
 	os.Setenv("api_key_value", "test-api-key")
 	os.Setenv("blender_jobs_queue_url", "https://sqs.us-east-1.amazonaws.com/123456789012/test-queue")
+	os.Setenv("allow_raw_source_keys", "true")
 	defer func() {
 		os.Unsetenv("api_key_value")
 		os.Unsetenv("blender_jobs_queue_url")
+		os.Unsetenv("allow_raw_source_keys")
 	}()
 
 	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{}
 
 	req := events.APIGatewayV2HTTPRequest{
 		Headers: map[string]string{
@@ -48,11 +358,11 @@ func TestHandlePostRequest_SuccessQueueJob(t *testing.T) {
 			"fromFileType": "blend",
 			"toFileType": "glb",
 			"modelId": "test-model-id",
-			"s3Key": "test-s3-key"
+			"s3Key": "blend/test-model-id.blend"
 		}`,
 	}
 
-	resp, err := HandlePostRequest(context.Background(), req, mockSQS)
+	resp, err := HandlePostRequest(context.Background(), req, mockSQS, mockDynamo, newSourceS3Client())
 	assert.NoError(t, err)
 	assert.Equal(t, 202, resp.StatusCode)
 
@@ -60,6 +370,7 @@ func TestHandlePostRequest_SuccessQueueJob(t *testing.T) {
 	err = json.Unmarshal([]byte(resp.Body), &response)
 	assert.NoError(t, err)
 	assert.Equal(t, "Job successfully queued", response.Status)
+	assert.NotEmpty(t, response.JobID)
 
 	assert.NotNil(t, mockSQS.sendMessageInput)
 	assert.Equal(t, "https://sqs.us-east-1.amazonaws.com/123456789012/test-queue", *mockSQS.sendMessageInput.QueueUrl)
@@ -73,7 +384,19 @@ func TestHandlePostRequest_SuccessQueueJob(t *testing.T) {
 	assert.Equal(t, "blend", messageBody["fromFileType"])
 	assert.Equal(t, "glb", messageBody["toFileType"])
 	assert.Equal(t, "test-model-id", messageBody["modelId"])
-	assert.Equal(t, "test-s3-key", messageBody["s3Key"])
+	assert.Equal(t, "blend/test-model-id.blend", messageBody["s3Key"])
+	assert.Equal(t, response.JobID, messageBody["jobId"])
+
+	assert.Len(t, mockDynamo.putItemInputs, 1)
+	pendingJob := mockDynamo.putItemInputs[0]
+	assert.Equal(t, "attribute_not_exists(jobId)", *pendingJob.ConditionExpression)
+	assert.Equal(t, response.JobID, pendingJob.Item["jobId"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "pending", pendingJob.Item["jobStatus"].(*types.AttributeValueMemberS).Value)
+	assert.Contains(t, pendingJob.Item, "expiresAt")
+
+	assert.Len(t, mockDynamo.updateItemInputs, 1)
+	assert.Equal(t, "REMOVE expiresAt", *mockDynamo.updateItemInputs[0].UpdateExpression)
+	assert.Empty(t, mockDynamo.deleteItemInputs)
 }
 
 func TestHandlePostRequest_MissingAPIKey(t *testing.T) {
@@ -85,6 +408,7 @@ func TestHandlePostRequest_MissingAPIKey(t *testing.T) {
 	}()
 
 	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{}
 
 	req := events.APIGatewayV2HTTPRequest{
 		Headers: map[string]string{
@@ -100,11 +424,11 @@ func TestHandlePostRequest_MissingAPIKey(t *testing.T) {
 			"fromFileType": "blend",
 			"toFileType": "glb",
 			"modelId": "test-model-id",
-			"s3Key": "test-s3-key"
+			"s3Key": "blend/test-model-id.blend"
 		}`,
 	}
 
-	resp, err := HandlePostRequest(context.Background(), req, mockSQS)
+	resp, err := HandlePostRequest(context.Background(), req, mockSQS, mockDynamo, newSourceS3Client())
 	assert.NoError(t, err)
 	assert.Equal(t, 401, resp.StatusCode)
 }
@@ -118,6 +442,7 @@ func TestHandlePostRequest_InvalidAPIKey(t *testing.T) {
 	}()
 
 	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{}
 
 	req := events.APIGatewayV2HTTPRequest{
 		Headers: map[string]string{
@@ -134,24 +459,27 @@ func TestHandlePostRequest_InvalidAPIKey(t *testing.T) {
 			"fromFileType": "blend",
 			"toFileType": "glb",
 			"modelId": "test-model-id",
-			"s3Key": "test-s3-key"
+			"s3Key": "blend/test-model-id.blend"
 		}`,
 	}
 
-	resp, err := HandlePostRequest(context.Background(), req, mockSQS)
+	resp, err := HandlePostRequest(context.Background(), req, mockSQS, mockDynamo, newSourceS3Client())
 	assert.NoError(t, err)
 	assert.Equal(t, 403, resp.StatusCode)
 }
 
 func TestHandlePostRequest_MissingRequiredBody_Returns400(t *testing.T) {
 	os.Setenv("api_key_value", "test-api-key")
+	os.Setenv("allow_raw_source_keys", "true")
 	os.Setenv("blender_jobs_queue_url", "https://sqs.us-east-1.amazonaws.com/123456789012/test-queue")
 	defer func() {
 		os.Unsetenv("api_key_value")
+		os.Unsetenv("allow_raw_source_keys")
 		os.Unsetenv("blender_jobs_queue_url")
 	}()
 
 	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{}
 
 	req1 := events.APIGatewayV2HTTPRequest{
 		Headers: map[string]string{
@@ -167,11 +495,11 @@ func TestHandlePostRequest_MissingRequiredBody_Returns400(t *testing.T) {
 			"fromFileType": "blend",
 			"toFileType": "glb",
 			"modelId": "test-model-id",
-			"s3Key": "test-s3-key"
+			"s3Key": "blend/test-model-id.blend"
 		}`,
 	}
 
-	resp1, err1 := HandlePostRequest(context.Background(), req1, mockSQS)
+	resp1, err1 := HandlePostRequest(context.Background(), req1, mockSQS, mockDynamo, newSourceS3Client())
 	assert.NoError(t, err1)
 	assert.Equal(t, "{\"error\":\"Missing required fields: connectionId\"}", resp1.Body)
 
@@ -189,11 +517,11 @@ func TestHandlePostRequest_MissingRequiredBody_Returns400(t *testing.T) {
 			"connectionId": "test-connection-id",
 			"toFileType": "glb",
 			"modelId": "test-model-id",
-			"s3Key": "test-s3-key"
+			"s3Key": "blend/test-model-id.blend"
 		}`,
 	}
 
-	resp2, err2 := HandlePostRequest(context.Background(), req2, mockSQS)
+	resp2, err2 := HandlePostRequest(context.Background(), req2, mockSQS, mockDynamo, newSourceS3Client())
 	assert.NoError(t, err2)
 	assert.Equal(t, 400, resp2.StatusCode)
 	assert.Equal(t, "{\"error\":\"Missing required fields: fromFileType\"}", resp2.Body)
@@ -212,11 +540,11 @@ func TestHandlePostRequest_MissingRequiredBody_Returns400(t *testing.T) {
 			"connectionId": "test-connection-id",
 			"fromFileType": "blend",
 			"modelId": "test-model-id",
-			"s3Key": "test-s3-key"
+			"s3Key": "blend/test-model-id.blend"
 		}`,
 	}
 
-	resp3, err3 := HandlePostRequest(context.Background(), req3, mockSQS)
+	resp3, err3 := HandlePostRequest(context.Background(), req3, mockSQS, mockDynamo, newSourceS3Client())
 	assert.NoError(t, err3)
 	assert.Equal(t, 400, resp3.StatusCode)
 	assert.Equal(t, "{\"error\":\"Missing required fields: toFileType\"}", resp3.Body)
@@ -235,11 +563,11 @@ func TestHandlePostRequest_MissingRequiredBody_Returns400(t *testing.T) {
 			"connectionId": "test-connection-id",
 			"fromFileType": "blend",
 			"toFileType": "glb",
-			"s3Key": "test-s3-key"
+			"s3Key": "blend/test-model-id.blend"
 		}`,
 	}
 
-	resp4, err4 := HandlePostRequest(context.Background(), req4, mockSQS)
+	resp4, err4 := HandlePostRequest(context.Background(), req4, mockSQS, mockDynamo, newSourceS3Client())
 	assert.NoError(t, err4)
 	assert.Equal(t, 400, resp4.StatusCode)
 	assert.Equal(t, "{\"error\":\"Missing required fields: modelId\"}", resp4.Body)
@@ -262,7 +590,7 @@ func TestHandlePostRequest_MissingRequiredBody_Returns400(t *testing.T) {
 		}`,
 	}
 
-	resp5, err5 := HandlePostRequest(context.Background(), req5, mockSQS)
+	resp5, err5 := HandlePostRequest(context.Background(), req5, mockSQS, mockDynamo, newSourceS3Client())
 	assert.NoError(t, err5)
 	assert.Equal(t, 400, resp5.StatusCode)
 	assert.Equal(t, "{\"error\":\"Missing required fields: s3Key\"}", resp5.Body)
@@ -270,13 +598,16 @@ func TestHandlePostRequest_MissingRequiredBody_Returns400(t *testing.T) {
 
 func TestHandlePostRequest_InvalidFromFileType_Returns400(t *testing.T) {
 	os.Setenv("api_key_value", "test-api-key")
+	os.Setenv("allow_raw_source_keys", "true")
 	os.Setenv("blender_jobs_queue_url", "https://sqs.us-east-1.amazonaws.com/123456789012/test-queue")
 	defer func() {
 		os.Unsetenv("api_key_value")
+		os.Unsetenv("allow_raw_source_keys")
 		os.Unsetenv("blender_jobs_queue_url")
 	}()
 
 	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{}
 
 	req := events.APIGatewayV2HTTPRequest{
 		Headers: map[string]string{
@@ -293,26 +624,29 @@ func TestHandlePostRequest_InvalidFromFileType_Returns400(t *testing.T) {
 			"fromFileType": "word-document",
 			"toFileType": "glb",
 			"modelId": "test-model-id",
-			"s3Key": "test-s3-key"
+			"s3Key": "blend/test-model-id.blend"
 		}`,
 	}
 
-	resp, err := HandlePostRequest(context.Background(), req, mockSQS)
+	resp, err := HandlePostRequest(context.Background(), req, mockSQS, mockDynamo, newSourceS3Client())
 	assert.NoError(t, err)
 
 	assert.Equal(t, 400, resp.StatusCode)
-	assert.Equal(t, "{\"error\":\"Only blend files are supported\"}", resp.Body)
+	assert.Equal(t, "{\"error\":\"Only blend, blend-zip, fbx, obj, gltf, gltf-zip, glb, stl, ply, 3mf, usd, usdz files are supported\"}", resp.Body)
 }
 
 func TestHandlePostRequest_InvalidToFileType_Returns400(t *testing.T) {
 	os.Setenv("api_key_value", "test-api-key")
+	os.Setenv("allow_raw_source_keys", "true")
 	os.Setenv("blender_jobs_queue_url", "https://sqs.us-east-1.amazonaws.com/123456789012/test-queue")
 	defer func() {
 		os.Unsetenv("api_key_value")
+		os.Unsetenv("allow_raw_source_keys")
 		os.Unsetenv("blender_jobs_queue_url")
 	}()
 
 	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{}
 
 	req := events.APIGatewayV2HTTPRequest{
 		Headers: map[string]string{
@@ -329,22 +663,24 @@ func TestHandlePostRequest_InvalidToFileType_Returns400(t *testing.T) {
 			"fromFileType": "blend",
 			"toFileType": "docx",
 			"modelId": "test-model-id",
-			"s3Key": "test-s3-key"
+			"s3Key": "blend/test-model-id.blend"
 		}`,
 	}
 
-	resp, err := HandlePostRequest(context.Background(), req, mockSQS)
+	resp, err := HandlePostRequest(context.Background(), req, mockSQS, mockDynamo, newSourceS3Client())
 	assert.NoError(t, err)
 
 	assert.Equal(t, 400, resp.StatusCode)
-	assert.Equal(t, "{\"error\":\"Only glb, gltf, obj, fbx, usd, usdz files are supported\"}", resp.Body)
+	assert.Equal(t, "{\"error\":\"Only glb, gltf, obj, fbx, usd, usdz, stl, ply, 3mf files are supported\"}", resp.Body)
 }
 
 func TestHandlePostRequest_SQSError_Returns500(t *testing.T) {
 	os.Setenv("api_key_value", "test-api-key")
+	os.Setenv("allow_raw_source_keys", "true")
 	os.Setenv("blender_jobs_queue_url", "https://sqs.us-east-1.amazonaws.com/123456789012/test-queue")
 	defer func() {
 		os.Unsetenv("api_key_value")
+		os.Unsetenv("allow_raw_source_keys")
 		os.Unsetenv("blender_jobs_queue_url")
 	}()
 
@@ -352,6 +688,7 @@ func TestHandlePostRequest_SQSError_Returns500(t *testing.T) {
 	mockSQS := &mockSQSClient{
 		sendMessageErr: errors.New("failed to send message to SQS"),
 	}
+	mockDynamo := &mockDynamoDBClient{}
 
 	req := events.APIGatewayV2HTTPRequest{
 		Headers: map[string]string{
@@ -368,15 +705,182 @@ func TestHandlePostRequest_SQSError_Returns500(t *testing.T) {
 			"fromFileType": "blend",
 			"toFileType": "glb",
 			"modelId": "test-model-id",
-			"s3Key": "test-s3-key"
+			"s3Key": "blend/test-model-id.blend"
 		}`,
 	}
 
-	resp, err := HandlePostRequest(context.Background(), req, mockSQS)
+	resp, err := HandlePostRequest(context.Background(), req, mockSQS, mockDynamo, newSourceS3Client())
 
 	assert.Error(t, err)
 	assert.Equal(t, 500, resp.StatusCode)
 	assert.Equal(t, "{\"error\":\"Error sending message to queue\"}", resp.Body)
+
+	// The pending row written before the send must be rolled back
+	assert.Len(t, mockDynamo.putItemInputs, 1)
+	assert.Len(t, mockDynamo.deleteItemInputs, 1)
+	assert.Equal(t, mockDynamo.putItemInputs[0].Item["jobId"], mockDynamo.deleteItemInputs[0].Key["jobId"])
+	assert.Equal(t, "jobStatus = :pending", *mockDynamo.deleteItemInputs[0].ConditionExpression)
+	assert.Empty(t, mockDynamo.updateItemInputs)
+}
+
+func TestHandlePostRequest_JobHistoryError_DoesNotQueue(t *testing.T) {
+	os.Setenv("api_key_value", "test-api-key")
+	os.Setenv("allow_raw_source_keys", "true")
+	os.Setenv("blender_jobs_queue_url", "https://sqs.us-east-1.amazonaws.com/123456789012/test-queue")
+	defer func() {
+		os.Unsetenv("api_key_value")
+		os.Unsetenv("allow_raw_source_keys")
+		os.Unsetenv("blender_jobs_queue_url")
+	}()
+
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{
+		putItemErr: errors.New("failed to write job history"),
+	}
+
+	req := events.APIGatewayV2HTTPRequest{
+		Headers: map[string]string{
+			"x-api-key":    "test-api-key",
+			"Content-Type": "application/json",
+		},
+		Body: `{
+			"connectionId": "test-connection-id",
+			"fromFileType": "blend",
+			"toFileType": "glb",
+			"modelId": "test-model-id",
+			"s3Key": "blend/test-model-id.blend"
+		}`,
+	}
+
+	resp, err := HandlePostRequest(context.Background(), req, mockSQS, mockDynamo, newSourceS3Client())
+
+	assert.Error(t, err)
+	assert.Equal(t, 500, resp.StatusCode)
+	assert.Nil(t, mockSQS.sendMessageInput)
+}
+
+func newTestPresignClient() *s3.PresignClient {
+	return s3.NewPresignClient(s3.New(s3.Options{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("test-access-key", "test-secret-key", ""),
+	}))
+}
+
+func newMultiTargetPostRequest(toFileTypes string) events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{
+		Headers: map[string]string{
+			"x-api-key":    "test-api-key",
+			"Content-Type": "application/json",
+		},
+		Body: `{
+			"connectionId": "test-connection-id",
+			"fromFileType": "blend",
+			"toFileTypes": ` + toFileTypes + `,
+			"modelId": "test-model-id",
+			"s3Key": "blend/test-model-id.blend"
+		}`,
+	}
+}
+
+func TestHandlePostRequest_MultiTargetFansOut(t *testing.T) {
+	os.Setenv("api_key_value", "test-api-key")
+	os.Setenv("allow_raw_source_keys", "true")
+	os.Setenv("blender_jobs_queue_url", "https://sqs.us-east-1.amazonaws.com/123456789012/test-queue")
+	defer func() {
+		os.Unsetenv("api_key_value")
+		os.Unsetenv("allow_raw_source_keys")
+		os.Unsetenv("blender_jobs_queue_url")
+	}()
+
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{}
+
+	resp, err := HandlePostRequest(context.Background(), newMultiTargetPostRequest(`["glb", "usdz", "fbx", "glb"]`), mockSQS, mockDynamo, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	var response SuccessPostResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+	assert.Equal(t, "Jobs successfully queued", response.Status)
+	assert.NotEmpty(t, response.SubmissionID)
+	assert.Len(t, response.Jobs, 3)
+	assert.Equal(t, response.Jobs[0].JobID, response.JobID)
+
+	assert.Len(t, mockSQS.sendMessageInputs, 3)
+	var jobIDs []string
+	for i, input := range mockSQS.sendMessageInputs {
+		var messageBody map[string]string
+		assert.NoError(t, json.Unmarshal([]byte(*input.MessageBody), &messageBody))
+		assert.Equal(t, []string{"glb", "usdz", "fbx"}[i], messageBody["toFileType"])
+		assert.Equal(t, response.SubmissionID, messageBody["submissionId"])
+		assert.Equal(t, response.Jobs[i].JobID, messageBody["jobId"])
+		jobIDs = append(jobIDs, messageBody["jobId"])
+	}
+
+	// All rows are written before the first message is sent
+	assert.Len(t, mockDynamo.putItemInputs, 3)
+	for _, input := range mockDynamo.putItemInputs {
+		siblings := input.Item["submissionJobIds"].(*types.AttributeValueMemberL).Value
+		assert.Len(t, siblings, 3)
+		for i, sibling := range siblings {
+			assert.Equal(t, jobIDs[i], sibling.(*types.AttributeValueMemberS).Value)
+		}
+	}
+}
+
+func TestHandlePostRequest_MultiTargetPartialSendFailure(t *testing.T) {
+	os.Setenv("api_key_value", "test-api-key")
+	os.Setenv("allow_raw_source_keys", "true")
+	os.Setenv("blender_jobs_queue_url", "https://sqs.us-east-1.amazonaws.com/123456789012/test-queue")
+	defer func() {
+		os.Unsetenv("api_key_value")
+		os.Unsetenv("allow_raw_source_keys")
+		os.Unsetenv("blender_jobs_queue_url")
+	}()
+
+	mockSQS := &mockSQSClient{
+		sendMessageErrs: map[int]error{2: errors.New("failed to send message to SQS")},
+	}
+	mockDynamo := &mockDynamoDBClient{}
+
+	resp, err := HandlePostRequest(context.Background(), newMultiTargetPostRequest(`["glb", "usdz"]`), mockSQS, mockDynamo, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	var response SuccessPostResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+	assert.Equal(t, "Some jobs could not be queued", response.Status)
+	assert.Empty(t, response.Jobs[0].Error)
+	assert.Equal(t, "Error sending message to queue", response.Jobs[1].Error)
+
+	// The failed target stays as a failed row so the submission can still finish
+	assert.Empty(t, mockDynamo.deleteItemInputs)
+	failed := mockDynamo.updateItemInputs[len(mockDynamo.updateItemInputs)-1]
+	assert.Equal(t, response.Jobs[1].JobID, failed.Key["jobId"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "failed", failed.ExpressionAttributeValues[":failed"].(*types.AttributeValueMemberS).Value)
+}
+
+func TestHandlePostRequest_ToFileTypeAndToFileTypes_Returns400(t *testing.T) {
+	os.Setenv("api_key_value", "test-api-key")
+	os.Setenv("allow_raw_source_keys", "true")
+	os.Setenv("blender_jobs_queue_url", "https://sqs.us-east-1.amazonaws.com/123456789012/test-queue")
+	defer func() {
+		os.Unsetenv("api_key_value")
+		os.Unsetenv("allow_raw_source_keys")
+		os.Unsetenv("blender_jobs_queue_url")
+	}()
+
+	req := newMultiTargetPostRequest(`["glb"]`)
+	req.Body = strings.Replace(req.Body, `"fromFileType": "blend",`, `"fromFileType": "blend", "toFileType": "fbx",`, 1)
+
+	resp, err := HandlePostRequest(context.Background(), req, &mockSQSClient{}, &mockDynamoDBClient{}, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	resp, err = HandlePostRequest(context.Background(), newMultiTargetPostRequest(`["glb", "docx"]`), &mockSQSClient{}, &mockDynamoDBClient{}, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Equal(t, "{\"error\":\"Only glb, gltf, obj, fbx, usd, usdz, stl, ply, 3mf files are supported\"}", resp.Body)
 }
 
 func TestHandleGetModelRequest_Success(t *testing.T) {
@@ -387,6 +891,18 @@ func TestHandleGetModelRequest_Success(t *testing.T) {
 		os.Unsetenv("model_s3_bucket")
 	}()
 
+	mockDynamo := &mockDynamoDBClient{
+		queryOutput: &dynamodb.QueryOutput{
+			Items: []map[string]types.AttributeValue{
+				{
+					"jobId":     &types.AttributeValueMemberS{Value: "test-job-id"},
+					"newS3Key":  &types.AttributeValueMemberS{Value: "glb/test-model-id.glb"},
+					"timestamp": &types.AttributeValueMemberS{Value: "2025-01-01T00:00:00Z"},
+				},
+			},
+		},
+	}
+
 	req1 := events.APIGatewayV2HTTPRequest{
 		Headers: map[string]string{
 			"x-api-key":    "test-api-key",
@@ -401,7 +917,7 @@ func TestHandleGetModelRequest_Success(t *testing.T) {
 		},
 	}
 
-	resp1, err1 := HandleGetModelRequest(context.Background(), req1)
+	resp1, err1 := HandleGetModelRequest(context.Background(), req1, mockDynamo, &mockS3Client{}, newTestPresignClient())
 	assert.NoError(t, err1)
 	assert.Equal(t, 200, resp1.StatusCode)
 
@@ -423,7 +939,7 @@ func TestHandleGetModelRequest_Success(t *testing.T) {
 		},
 	}
 
-	resp2, err2 := HandleGetModelRequest(context.Background(), req2)
+	resp2, err2 := HandleGetModelRequest(context.Background(), req2, mockDynamo, &mockS3Client{}, newTestPresignClient())
 	assert.NoError(t, err2)
 	assert.Equal(t, 200, resp2.StatusCode)
 
@@ -453,7 +969,7 @@ func TestHandleGetModelRequest_MissingAPIKey_Returns401(t *testing.T) {
 		},
 	}
 
-	resp, err := HandleGetModelRequest(context.Background(), req)
+	resp, err := HandleGetModelRequest(context.Background(), req, &mockDynamoDBClient{}, &mockS3Client{}, newTestPresignClient())
 	assert.NoError(t, err)
 	assert.Equal(t, 401, resp.StatusCode)
 }
@@ -480,7 +996,7 @@ func TestHandleGetModelRequest_IncorrectAPIKey_Returns403(t *testing.T) {
 		},
 	}
 
-	resp, err := HandleGetModelRequest(context.Background(), req)
+	resp, err := HandleGetModelRequest(context.Background(), req, &mockDynamoDBClient{}, &mockS3Client{}, newTestPresignClient())
 	assert.NoError(t, err)
 	assert.Equal(t, 403, resp.StatusCode)
 }
@@ -504,7 +1020,7 @@ func TestHandleGetModelRequest_MissingModelID_Returns400(t *testing.T) {
 		},
 	}
 
-	resp, err := HandleGetModelRequest(context.Background(), req)
+	resp, err := HandleGetModelRequest(context.Background(), req, &mockDynamoDBClient{}, &mockS3Client{}, newTestPresignClient())
 	assert.NoError(t, err)
 	assert.Equal(t, 400, resp.StatusCode)
 }
@@ -530,8 +1046,213 @@ func TestHandleGetModelRequest_MissingFileType_Returns400(t *testing.T) {
 		},
 	}
 
-	resp, err := HandleGetModelRequest(context.Background(), req)
+	resp, err := HandleGetModelRequest(context.Background(), req, &mockDynamoDBClient{}, &mockS3Client{}, newTestPresignClient())
 	assert.NoError(t, err)
 	log.Printf("resp: %+v", resp)
 	assert.Equal(t, 400, resp.StatusCode)
 }
+
+func newDeleteModelRequest(modelID string) events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{
+		Headers: map[string]string{
+			"x-api-key": "test-api-key",
+		},
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method: "DELETE",
+			},
+		},
+		PathParameters: map[string]string{
+			"id": modelID,
+		},
+	}
+}
+
+func TestHandleDeleteModelRequest_Success(t *testing.T) {
+	os.Setenv("api_key_value", "test-api-key")
+	os.Setenv("model_s3_bucket", "test-bucket")
+	os.Setenv("job_history_table", "test-job-history-table")
+	defer func() {
+		os.Unsetenv("api_key_value")
+		os.Unsetenv("model_s3_bucket")
+		os.Unsetenv("job_history_table")
+	}()
+
+	mockDynamo := &mockDynamoDBClient{
+		queryOutput: &dynamodb.QueryOutput{
+			Items: []map[string]types.AttributeValue{
+				{"jobId": &types.AttributeValueMemberS{Value: "job-1"}},
+				{"jobId": &types.AttributeValueMemberS{Value: "job-2"}},
+			},
+		},
+	}
+	mockS3 := &mockS3Client{
+		objects: map[string][]string{
+			"blend/test-model-id.": {"blend/test-model-id.blend"},
+			"glb/test-model-id.":   {"glb/test-model-id.glb"},
+			"gltf/test-model-id/":  {"gltf/test-model-id/test-model-id.gltf", "gltf/test-model-id/test-model-id.bin"},
+			"glb/other-model-id.":  {"glb/other-model-id.glb"},
+		},
+	}
+
+	resp, err := HandleDeleteModelRequest(context.Background(), newDeleteModelRequest("test-model-id"), mockS3, mockDynamo)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var response DeleteModelResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+	assert.Equal(t, "test-model-id", response.ModelID)
+	assert.ElementsMatch(t, []string{
+		"blend/test-model-id.blend",
+		"glb/test-model-id.glb",
+		"gltf/test-model-id/test-model-id.gltf",
+		"gltf/test-model-id/test-model-id.bin",
+	}, response.DeletedObjects)
+	assert.ElementsMatch(t, []string{"job-1", "job-2"}, response.DeletedJobs)
+	assert.Empty(t, response.Failures)
+	assert.Len(t, mockDynamo.deleteItemInputs, 2)
+	assert.Equal(t, "test-job-history-table", *mockDynamo.deleteItemInputs[0].TableName)
+}
+
+func TestHandleDeleteModelRequest_NotFound_Returns404(t *testing.T) {
+	os.Setenv("api_key_value", "test-api-key")
+	defer os.Unsetenv("api_key_value")
+
+	mockDynamo := &mockDynamoDBClient{queryOutput: &dynamodb.QueryOutput{}}
+	mockS3 := &mockS3Client{}
+
+	resp, err := HandleDeleteModelRequest(context.Background(), newDeleteModelRequest("missing-model-id"), mockS3, mockDynamo)
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+	assert.Empty(t, mockS3.deleteObjectsInputs)
+}
+
+func TestHandleDeleteModelRequest_PartialFailure_KeepsJobHistory(t *testing.T) {
+	os.Setenv("api_key_value", "test-api-key")
+	os.Setenv("model_s3_bucket", "test-bucket")
+	defer func() {
+		os.Unsetenv("api_key_value")
+		os.Unsetenv("model_s3_bucket")
+	}()
+
+	mockDynamo := &mockDynamoDBClient{
+		queryOutput: &dynamodb.QueryOutput{
+			Items: []map[string]types.AttributeValue{
+				{"jobId": &types.AttributeValueMemberS{Value: "job-1"}},
+			},
+		},
+	}
+	mockS3 := &mockS3Client{
+		objects: map[string][]string{
+			"blend/test-model-id.": {"blend/test-model-id.blend"},
+			"glb/test-model-id.":   {"glb/test-model-id.glb"},
+		},
+		deleteObjectsErrors: []s3types.Error{
+			{Key: aws.String("glb/test-model-id.glb"), Code: aws.String("AccessDenied"), Message: aws.String("Access Denied")},
+		},
+	}
+
+	resp, err := HandleDeleteModelRequest(context.Background(), newDeleteModelRequest("test-model-id"), mockS3, mockDynamo)
+	assert.NoError(t, err)
+	assert.Equal(t, 500, resp.StatusCode)
+
+	var response DeleteModelResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+	assert.Equal(t, []string{"blend/test-model-id.blend"}, response.DeletedObjects)
+	assert.Empty(t, response.DeletedJobs)
+	assert.Equal(t, []DeleteFailure{
+		{Resource: "s3://test-bucket/glb/test-model-id.glb", Error: "AccessDenied: Access Denied"},
+	}, response.Failures)
+	assert.NotEmpty(t, response.Error)
+	assert.Empty(t, mockDynamo.deleteItemInputs)
+}
+
+func TestHandleGetModelRequest_ResolvesLatestConvertedKey(t *testing.T) {
+	os.Setenv("api_key_value", "test-api-key")
+	os.Setenv("model_s3_bucket", "test-bucket")
+	defer func() {
+		os.Unsetenv("api_key_value")
+		os.Unsetenv("model_s3_bucket")
+	}()
+
+	mockDynamo := &mockDynamoDBClient{
+		queryOutput: &dynamodb.QueryOutput{
+			Items: []map[string]types.AttributeValue{
+				{
+					"newS3Key":  &types.AttributeValueMemberS{Value: "gltf/test-model-id-old.gltf"},
+					"timestamp": &types.AttributeValueMemberS{Value: "2025-01-01T00:00:00Z"},
+				},
+				{
+					"newS3Key":  &types.AttributeValueMemberS{Value: "gltf/test-model-id/test-model-id.gltf"},
+					"timestamp": &types.AttributeValueMemberS{Value: "2025-02-01T00:00:00Z"},
+				},
+			},
+		},
+	}
+
+	req := events.APIGatewayV2HTTPRequest{
+		Headers: map[string]string{
+			"x-api-key": "test-api-key",
+		},
+		PathParameters: map[string]string{
+			"id": "test-model-id",
+		},
+		QueryStringParameters: map[string]string{
+			"fileType": "gltf",
+		},
+	}
+
+	resp, err := HandleGetModelRequest(context.Background(), req, mockDynamo, &mockS3Client{}, newTestPresignClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Regexp(t, `^{"presignedUrl":"https://test-bucket\.s3\.us-east-1\.amazonaws\.com/gltf/test-model-id/test-model-id\.gltf\?.*"}$`, resp.Body)
+}
+
+func TestHandleGetModelRequest_NotConverted_Returns404(t *testing.T) {
+	os.Setenv("api_key_value", "test-api-key")
+	os.Setenv("model_s3_bucket", "test-bucket")
+	defer func() {
+		os.Unsetenv("api_key_value")
+		os.Unsetenv("model_s3_bucket")
+	}()
+
+	mockDynamo := &mockDynamoDBClient{queryOutput: &dynamodb.QueryOutput{}}
+
+	req := events.APIGatewayV2HTTPRequest{
+		Headers: map[string]string{
+			"x-api-key": "test-api-key",
+		},
+		PathParameters: map[string]string{
+			"id": "test-model-id",
+		},
+		QueryStringParameters: map[string]string{
+			"fileType": "usdz",
+		},
+	}
+
+	resp, err := HandleGetModelRequest(context.Background(), req, mockDynamo, &mockS3Client{}, newTestPresignClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+	assert.Equal(t, "{\"error\":\"Model test-model-id has not been converted to usdz yet\"}", resp.Body)
+}
+
+func TestHandleGetModelRequest_UnsupportedDownloadFileType_Returns400(t *testing.T) {
+	os.Setenv("api_key_value", "test-api-key")
+	defer os.Unsetenv("api_key_value")
+
+	req := events.APIGatewayV2HTTPRequest{
+		Headers: map[string]string{
+			"x-api-key": "test-api-key",
+		},
+		PathParameters: map[string]string{
+			"id": "test-model-id",
+		},
+		QueryStringParameters: map[string]string{
+			"fileType": "docx",
+		},
+	}
+
+	resp, err := HandleGetModelRequest(context.Background(), req, &mockDynamoDBClient{}, &mockS3Client{}, newTestPresignClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
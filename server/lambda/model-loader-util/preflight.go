@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/blendfile"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/fbx"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	// sourceSniffBytes is how much of a source file is read to check its format
+	sourceSniffBytes = blendfile.MaxHeaderSize
+	// Smaller .blend files are read completely, which catches truncated
+	// uploads and records what they contain
+	maxInspectedSourceSize = 32 * 1024 * 1024
+)
+
+// SourceObject identifies the exact bytes a conversion was queued for
+type SourceObject struct {
+	ETag        string
+	Size        int64
+	ContentType string
+	// MainFile is the .blend file to open inside a blend-zip
+	MainFile string
+	Stats    *SourceStats
+	// Blend is what the inspector read from a .blend source, for the checks of
+	// the quality budget
+	Blend *blendfile.File
+}
+
+// SourceStats is what the .blend inspector found in a source file
+type SourceStats struct {
+	BlenderVersion string   `json:"blenderVersion"`
+	Compression    string   `json:"compression,omitempty"`
+	Scenes         int      `json:"scenes"`
+	Objects        int      `json:"objects"`
+	Meshes         int      `json:"meshes"`
+	Materials      int      `json:"materials"`
+	Images         int      `json:"images"`
+	Libraries      []string `json:"libraries,omitempty"`
+}
+
+// sourceSniffers check the first bytes of a source file of each type
+var sourceSniffers = map[string]func(header []byte) error{
+	"blend": sniffBlendFile,
+	"glb":   sniffMagic("binary glTF", "glTF"),
+	// .usd files can be either the text or the binary encoding
+	"usd":      sniffMagic("USD", "#usda", "PXR-USDC"),
+	"usdz":     sniffMagic("USDZ", "PK\x03\x04"),
+	"gltf-zip": sniffMagic("zip", "PK\x03\x04"),
+	"ply":      sniffMagic("PLY", "ply\n", "ply\r\n"),
+	"3mf":      sniffMagic("3MF", "PK\x03\x04"),
+	"fbx":      sniffFBX,
+}
+
+// sniffFBX accepts binary FBX files, the only kind the converters read. The
+// header read is shorter than the FBX magic.
+func sniffFBX(header []byte) error {
+	if len(header) > 0 && strings.HasPrefix(fbx.Magic, string(header)) {
+		return nil
+	}
+	if bytes.HasPrefix(header, []byte(";")) {
+		return fmt.Errorf("ASCII FBX files are not supported, export as binary FBX")
+	}
+	return fmt.Errorf("not a binary FBX file")
+}
+
+// sniffMagic accepts files starting with any of the magic strings
+func sniffMagic(description string, magics ...string) func(header []byte) error {
+	return func(header []byte) error {
+		for _, magic := range magics {
+			if bytes.HasPrefix(header, []byte(magic)) {
+				return nil
+			}
+		}
+		return fmt.Errorf("not a %s file", description)
+	}
+}
+
+// sniffBlendFile checks the header of uncompressed .blend files, compressed
+// ones are only recognised by their gzip or zstd magic
+func sniffBlendFile(header []byte) error {
+	if blendfile.DetectCompression(header) != blendfile.CompressionNone {
+		return nil
+	}
+	_, err := blendfile.ParseHeader(header)
+	return err
+}
+
+func newSourceStats(file *blendfile.File) *SourceStats {
+	return &SourceStats{
+		BlenderVersion: fmt.Sprintf("%d.%d", file.Version/100, file.Version%100),
+		Compression:    string(file.Compression),
+		Scenes:         len(file.Scenes),
+		Objects:        len(file.Objects),
+		Meshes:         len(file.Meshes),
+		Materials:      len(file.Materials),
+		Images:         len(file.Images),
+		Libraries:      file.Libraries,
+	}
+}
+
+func sourceStatsAttribute(stats SourceStats) types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		"blenderVersion": &types.AttributeValueMemberS{Value: stats.BlenderVersion},
+		"scenes":         &types.AttributeValueMemberN{Value: strconv.Itoa(stats.Scenes)},
+		"objects":        &types.AttributeValueMemberN{Value: strconv.Itoa(stats.Objects)},
+		"meshes":         &types.AttributeValueMemberN{Value: strconv.Itoa(stats.Meshes)},
+		"materials":      &types.AttributeValueMemberN{Value: strconv.Itoa(stats.Materials)},
+		"images":         &types.AttributeValueMemberN{Value: strconv.Itoa(stats.Images)},
+	}
+	if stats.Compression != "" {
+		item["compression"] = &types.AttributeValueMemberS{Value: stats.Compression}
+	}
+	if len(stats.Libraries) > 0 {
+		item["libraries"] = &types.AttributeValueMemberL{Value: stringListAttribute(stats.Libraries)}
+	}
+	return &types.AttributeValueMemberM{Value: item}
+}
+
+func sourceStatsFromAttribute(attribute types.AttributeValue) *SourceStats {
+	value, ok := attribute.(*types.AttributeValueMemberM)
+	if !ok {
+		return nil
+	}
+	stats := &SourceStats{
+		BlenderVersion: stringAttribute(value.Value, "blenderVersion"),
+		Compression:    stringAttribute(value.Value, "compression"),
+		Scenes:         numberAttribute(value.Value, "scenes"),
+		Objects:        numberAttribute(value.Value, "objects"),
+		Meshes:         numberAttribute(value.Value, "meshes"),
+		Materials:      numberAttribute(value.Value, "materials"),
+		Images:         numberAttribute(value.Value, "images"),
+	}
+	if libraries, ok := value.Value["libraries"].(*types.AttributeValueMemberL); ok {
+		for _, library := range libraries.Value {
+			if path, ok := library.(*types.AttributeValueMemberS); ok {
+				stats.Libraries = append(stats.Libraries, path.Value)
+			}
+		}
+	}
+	return stats
+}
+
+// validateRawSourceContentType checks a source uploaded without a session
+// against the content types of its input format, which the presigned upload
+// of a session enforces
+func validateRawSourceContentType(job ConversionJob, source *SourceObject) (bool, events.APIGatewayV2HTTPResponse) {
+	input, _ := inputFormat(job.FromFileType)
+	if !slices.Contains(input.ContentTypes, source.ContentType) {
+		message := fmt.Sprintf("Source file %s was uploaded as %q, %s files must be one of %s", job.S3Key, source.ContentType, job.FromFileType, strings.Join(input.ContentTypes, ", "))
+		return false, createErrorResponse(400, message)
+	}
+	return true, events.APIGatewayV2HTTPResponse{}
+}
+
+// preflightSourceObject checks that the source of a conversion was uploaded
+// completely and looks like its fromFileType before a worker is spent on it.
+// It returns a non-zero response when the job should not be queued.
+func preflightSourceObject(ctx context.Context, s3Client S3Client, job ConversionJob, maxSize int64) (*SourceObject, events.APIGatewayV2HTTPResponse, error) {
+	bucket := os.Getenv("model_s3_bucket")
+	head, err := s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(job.S3Key),
+	})
+	var notFound *s3types.NotFound
+	if errors.As(err, &notFound) {
+		return nil, createErrorResponse(409, fmt.Sprintf("Source file %s has not been uploaded", job.S3Key)), nil
+	}
+	if err != nil {
+		return nil, createErrorResponse(500, "Failed to check source file"), err
+	}
+
+	source := &SourceObject{ETag: aws.ToString(head.ETag), Size: aws.ToInt64(head.ContentLength), ContentType: aws.ToString(head.ContentType)}
+	if source.Size == 0 {
+		return nil, createErrorResponse(400, fmt.Sprintf("Source file %s is empty", job.S3Key)), nil
+	}
+	if source.Size > maxSize {
+		message := fmt.Sprintf("Source file is %d bytes, at most %d bytes are allowed", source.Size, maxSize)
+		return nil, createErrorResponse(413, message), nil
+	}
+
+	if job.FromFileType == "blend-zip" {
+		return preflightBlendZip(ctx, s3Client, job, source)
+	}
+
+	inspect := job.FromFileType == "blend" && source.Size <= maxInspectedSourceSize
+	sniff, ok := sourceSniffers[job.FromFileType]
+	if !ok && !inspect {
+		return source, events.APIGatewayV2HTTPResponse{}, nil
+	}
+
+	// IfMatch makes sure the bytes read belong to the object that was sized
+	getInput := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(job.S3Key),
+	}
+	if !inspect {
+		getInput.Range = aws.String(fmt.Sprintf("bytes=0-%d", sourceSniffBytes-1))
+	}
+	if source.ETag != "" {
+		getInput.IfMatch = aws.String(source.ETag)
+	}
+	result, err := s3Client.GetObject(ctx, getInput)
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "PreconditionFailed" {
+		return nil, createErrorResponse(409, fmt.Sprintf("Source file %s changed while it was being checked", job.S3Key)), nil
+	}
+	if err != nil {
+		return nil, createErrorResponse(500, "Failed to read source file"), err
+	}
+	defer result.Body.Close()
+
+	invalid := func(err error) events.APIGatewayV2HTTPResponse {
+		return createErrorResponse(400, fmt.Sprintf("Source file %s is not a valid %s file: %v", job.S3Key, job.FromFileType, err))
+	}
+	if inspect {
+		file, err := blendfile.Inspect(result.Body)
+		if err != nil {
+			return nil, invalid(err), nil
+		}
+		source.Stats = newSourceStats(file)
+		source.Blend = file
+		return source, events.APIGatewayV2HTTPResponse{}, nil
+	}
+
+	header, err := io.ReadAll(io.LimitReader(result.Body, sourceSniffBytes))
+	if err != nil {
+		return nil, createErrorResponse(500, "Failed to read source file"), err
+	}
+	if err := sniff(header); err != nil {
+		return nil, invalid(err), nil
+	}
+	return source, events.APIGatewayV2HTTPResponse{}, nil
+}
+
+// addSourceObject records the checked source on a conversion message
+func addSourceObject(message map[string]string, source *SourceObject) {
+	if source == nil {
+		return
+	}
+	message["sourceEtag"] = source.ETag
+	message["sourceSize"] = strconv.FormatInt(source.Size, 10)
+	if source.MainFile != "" {
+		message["sourceMainFile"] = source.MainFile
+	}
+}
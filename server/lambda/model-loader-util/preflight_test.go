@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+const preflightConversionBody = `{
+	"connectionId": "test-connection-id",
+	"fromFileType": "blend",
+	"toFileType": "glb",
+	"modelId": "test-model-id",
+	"s3Key": "blend/test-model-id.blend"
+}`
+
+func newPreflightPostRequest() events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{
+		Headers: map[string]string{
+			"x-api-key":    "test-api-key",
+			"Content-Type": "application/json",
+		},
+		Body: preflightConversionBody,
+	}
+}
+
+func TestHandlePostRequest_Preflight_RecordsSourceObject(t *testing.T) {
+	setupTestEnv(t)
+
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{}
+	mockS3 := newSourceS3Client()
+
+	resp, err := HandlePostRequest(context.Background(), newPreflightPostRequest(), mockSQS, mockDynamo, mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	content := mockS3.contents["blend/test-model-id.blend"]
+	size := strconv.Itoa(len(content))
+	var messageBody map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(*mockSQS.sendMessageInput.MessageBody), &messageBody))
+	assert.Equal(t, mockETag(content), messageBody["sourceEtag"])
+	assert.Equal(t, size, messageBody["sourceSize"])
+
+	item := mockDynamo.putItemInputs[0].Item
+	assert.Equal(t, mockETag(content), item["sourceEtag"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, size, item["sourceSize"].(*types.AttributeValueMemberN).Value)
+	stats := sourceStatsFromAttribute(item["sourceStats"])
+	assert.Equal(t, &SourceStats{BlenderVersion: "4.2"}, stats)
+}
+
+func TestHandlePostRequest_Preflight_AcceptsCompressedBlend(t *testing.T) {
+	setupTestEnv(t)
+
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	gzipWriter.Write([]byte(testBlendFile()))
+	gzipWriter.Close()
+	zstdEncoder, err := zstd.NewWriter(nil)
+	assert.NoError(t, err)
+
+	for compression, content := range map[string]string{
+		"gzip": gzipped.String(),
+		"zstd": string(zstdEncoder.EncodeAll([]byte(testBlendFile()), nil)),
+	} {
+		mockDynamo := &mockDynamoDBClient{}
+		mockS3 := &mockS3Client{contents: map[string]string{"blend/test-model-id.blend": content}}
+		resp, err := HandlePostRequest(context.Background(), newPreflightPostRequest(), &mockSQSClient{}, mockDynamo, mockS3)
+		assert.NoError(t, err)
+		assert.Equal(t, 202, resp.StatusCode, compression)
+		assert.Equal(t, compression, sourceStatsFromAttribute(mockDynamo.putItemInputs[0].Item["sourceStats"]).Compression)
+	}
+}
+
+func TestHandlePostRequest_Preflight_Rejections(t *testing.T) {
+	setupTestEnv(t)
+	t.Setenv("max_upload_size_bytes", "64")
+
+	tests := []struct {
+		name       string
+		contents   map[string]string
+		statusCode int
+		message    string
+	}{
+		{
+			name:       "missing",
+			statusCode: 409,
+			message:    "has not been uploaded",
+		},
+		{
+			name:       "empty",
+			contents:   map[string]string{"blend/test-model-id.blend": ""},
+			statusCode: 400,
+			message:    "is empty",
+		},
+		{
+			name:       "too large",
+			contents:   map[string]string{"blend/test-model-id.blend": "BLENDER" + string(make([]byte, 64))},
+			statusCode: 413,
+			message:    "at most 64 bytes",
+		},
+		{
+			name:       "truncated",
+			contents:   map[string]string{"blend/test-model-id.blend": testBlendFile()[:40]},
+			statusCode: 400,
+			message:    "file ends before its ENDB block",
+		},
+		{
+			name:       "not a blend file",
+			contents:   map[string]string{"blend/test-model-id.blend": "<html>Access Denied</html>"},
+			statusCode: 400,
+			message:    "is not a valid blend file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSQS := &mockSQSClient{}
+			mockDynamo := &mockDynamoDBClient{}
+
+			resp, err := HandlePostRequest(context.Background(), newPreflightPostRequest(), mockSQS, mockDynamo, &mockS3Client{contents: tt.contents})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			assert.Contains(t, resp.Body, tt.message)
+			assert.Nil(t, mockSQS.sendMessageInput)
+			assert.Empty(t, mockDynamo.putItemInputs)
+		})
+	}
+}
+
+func TestHandlePostRequest_Preflight_RejectsASCIIFBX(t *testing.T) {
+	setupTestEnv(t)
+	t.Setenv("native_jobs_queue_url", "https://sqs.us-east-1.amazonaws.com/123456789012/native-queue")
+
+	request := newPreflightPostRequest()
+	request.Body = strings.NewReplacer(`"blend"`, `"fbx"`, "blend/test-model-id.blend", "fbx/test-model-id.fbx").Replace(request.Body)
+	mockS3 := &mockS3Client{contents: map[string]string{"fbx/test-model-id.fbx": "; FBX 7.4.0 project file"}}
+
+	resp, err := HandlePostRequest(context.Background(), request, &mockSQSClient{}, &mockDynamoDBClient{}, mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Contains(t, resp.Body, "ASCII FBX files are not supported")
+}
+
+func TestHandlePostBatchRequest_Preflight_RejectsMissingSource(t *testing.T) {
+	setupTestEnv(t)
+
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{}
+
+	resp, err := HandlePostBatchRequest(context.Background(), newBatchRequest(newBatchJobs(2)), mockSQS, mockDynamo, newSourceS3Client("blend/model-0.blend"))
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	var response BatchPostResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+	assert.Equal(t, 1, response.Accepted)
+	assert.Equal(t, "rejected", response.Results[1].Status)
+	assert.Contains(t, response.Results[1].Error, "has not been uploaded")
+}
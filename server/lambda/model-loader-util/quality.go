@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/quality"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// qualityBudgets reads the quality_budgets environment variable, a JSON object
+// from tenant to output format to rule set. Jobs are not checked when it is
+// unset or invalid.
+func qualityBudgets() quality.Budgets {
+	value := os.Getenv("quality_budgets")
+	if value == "" {
+		return nil
+	}
+	budgets, err := quality.ParseBudgets(value)
+	if err != nil {
+		log.Printf("Invalid quality_budgets, outputs are not checked: %v", err)
+		return nil
+	}
+	return budgets
+}
+
+// addQualityRules records on a conversion message the rule set its output is
+// checked against, with what the .blend preflight found against it. The
+// notification lambda reads both from the pending row. Budgets are looked up
+// for the tenant of the API key, keys without one only get the "*" budgets.
+func addQualityRules(message map[string]string, job ConversionJob, toFileType string) {
+	if job.TenantID != "" {
+		message["tenantId"] = job.TenantID
+	}
+	ruleSet, ok := qualityBudgets().Lookup(job.TenantID, toFileType)
+	if !ok {
+		return
+	}
+	encoded, _ := json.Marshal(ruleSet)
+	message["qualityRules"] = string(encoded)
+	if job.Source != nil && job.Source.Blend != nil {
+		if findings := ruleSet.CheckBlend(job.Source.Blend); len(findings) > 0 {
+			encoded, _ := json.Marshal(findings)
+			message["sourceQuality"] = string(encoded)
+		}
+	}
+}
+
+// qualityReportFromAttribute decodes the quality report the notification
+// lambda stores as JSON on finished jobs
+func qualityReportFromAttribute(item map[string]types.AttributeValue) *quality.Report {
+	encoded := stringAttribute(item, "qualityReport")
+	if encoded == "" {
+		return nil
+	}
+	var report quality.Report
+	if err := json.Unmarshal([]byte(encoded), &report); err != nil {
+		log.Printf("Invalid quality report on job %s: %v", stringAttribute(item, "jobId"), err)
+		return nil
+	}
+	return &report
+}
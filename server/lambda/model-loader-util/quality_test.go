@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/blendfile"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/converters"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/quality"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateConversionMessage_AddsQualityRules(t *testing.T) {
+	t.Setenv("quality_budgets", `{"acme": {"glb": {"maxTriangles": 50000, "namePattern": "[a-z_]+", "warn": ["namePattern"]}}}`)
+	route := conversionRoute{Converter: converters.Converter{Name: "blender", Backend: converters.BackendBlender}}
+	job := ConversionJob{
+		FromFileType: "blend",
+		ModelID:      "test-model-id",
+		S3Key:        "blend/test-model-id.blend",
+		TenantID:     "acme",
+		Source:       &SourceObject{ETag: `"etag"`, Size: 100, Blend: &blendfile.File{Objects: []string{"chair_seat", "Cube"}}},
+	}
+
+	message := createConversionMessage(job, route, "glb", "")
+
+	assert.Equal(t, "acme", message["tenantId"])
+	var ruleSet quality.RuleSet
+	assert.NoError(t, json.Unmarshal([]byte(message["qualityRules"]), &ruleSet))
+	assert.Equal(t, 50000, ruleSet.MaxTriangles)
+	var findings []quality.Finding
+	assert.NoError(t, json.Unmarshal([]byte(message["sourceQuality"]), &findings))
+	assert.Equal(t, []quality.Finding{{Rule: quality.RuleNamePattern, Result: quality.ResultWarn, Message: `1 objects do not match [a-z_]+: "Cube"`, Source: true}}, findings)
+
+	// Other tenants and formats have no budget
+	for _, toFileType := range []string{"fbx", "glb"} {
+		job.TenantID = "globex"
+		message = createConversionMessage(job, route, toFileType, "")
+		assert.NotContains(t, message, "qualityRules")
+		assert.NotContains(t, message, "sourceQuality")
+	}
+}
+
+func TestHandlePostRequest_TenantComesFromTheAPIKey(t *testing.T) {
+	setupTestEnv(t)
+	t.Setenv("api_key_tenants", `{"acme-key": "acme", "globex-key": "globex"}`)
+	t.Setenv("quality_budgets", `{"*": {"glb": {"maxTriangles": 50000}}, "acme": {"glb": {"maxTriangles": 500000}}}`)
+
+	// A tenantId in the body is ignored, so a client cannot pick a laxer budget
+	body := strings.Replace(preflightConversionBody, `"toFileType": "glb",`, `"toFileType": "glb", "tenantId": "acme",`, 1)
+	tests := []struct {
+		apiKey       string
+		tenantID     string
+		qualityRules string
+	}{
+		{apiKey: "acme-key", tenantID: "acme", qualityRules: `{"maxTriangles": 500000}`},
+		{apiKey: "globex-key", tenantID: "globex", qualityRules: `{"maxTriangles": 50000}`},
+		// Without a tenant of its own the key gets the "*" budget
+		{apiKey: "test-api-key", qualityRules: `{"maxTriangles": 50000}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.apiKey, func(t *testing.T) {
+			mockSQS := &mockSQSClient{}
+			request := newPreflightPostRequest()
+			request.Headers["x-api-key"] = tt.apiKey
+			request.Body = body
+
+			resp, err := HandlePostRequest(context.Background(), request, mockSQS, &mockDynamoDBClient{}, newSourceS3Client())
+			assert.NoError(t, err)
+			assert.Equal(t, 202, resp.StatusCode)
+			var messageBody map[string]string
+			assert.NoError(t, json.Unmarshal([]byte(*mockSQS.sendMessageInput.MessageBody), &messageBody))
+			assert.Equal(t, tt.tenantID, messageBody["tenantId"])
+			assert.JSONEq(t, tt.qualityRules, messageBody["qualityRules"])
+		})
+	}
+
+	request := newPreflightPostRequest()
+	request.Headers["x-api-key"] = "initech-key"
+	resp, err := HandlePostRequest(context.Background(), request, &mockSQSClient{}, &mockDynamoDBClient{}, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+}
+
+func TestHandlePostBatchRequest_TenantComesFromTheAPIKey(t *testing.T) {
+	setupTestEnv(t)
+	t.Setenv("api_key_tenants", `{"acme-key": "acme"}`)
+
+	request := newBatchRequest(newBatchJobs(2))
+	request.Headers["x-api-key"] = "acme-key"
+	mockSQS := &mockSQSClient{}
+	resp, err := HandlePostBatchRequest(context.Background(), request, mockSQS, &mockDynamoDBClient{}, newSourceS3Client(batchSourceKeys(2)...))
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	assert.Len(t, mockSQS.sendMessageBatchInputs[0].Entries, 2)
+	for _, entry := range mockSQS.sendMessageBatchInputs[0].Entries {
+		var messageBody map[string]string
+		assert.NoError(t, json.Unmarshal([]byte(*entry.MessageBody), &messageBody))
+		assert.Equal(t, "acme", messageBody["tenantId"])
+	}
+}
+
+func TestCreateConversionMessage_IgnoresInvalidQualityBudgets(t *testing.T) {
+	t.Setenv("quality_budgets", `{"*": {"*": {"namePattern": "[a-z"}}}`)
+	route := conversionRoute{Converter: converters.Converter{Name: "blender", Backend: converters.BackendBlender}}
+
+	message := createConversionMessage(ConversionJob{FromFileType: "blend"}, route, "glb", "")
+
+	assert.NotContains(t, message, "qualityRules")
+}
+
+func TestModelMetadataFromItem_DecodesQualityReport(t *testing.T) {
+	item := completedGLBItem("test-job", "2025-01-01T00:00:00Z", "")
+	item["tenantId"] = &types.AttributeValueMemberS{Value: "acme"}
+	item["qualityReport"] = &types.AttributeValueMemberS{Value: `{"result":"warn","rules":["maxTriangles"],"findings":[{"rule":"maxTriangles","result":"warn","message":"The model has 60000 triangles, at most 50000 are allowed"}]}`}
+
+	job := modelMetadataFromItem(item)
+
+	assert.Equal(t, "acme", job.TenantID)
+	assert.Equal(t, quality.ResultWarn, job.Quality.Result)
+	assert.Equal(t, quality.RuleMaxTriangles, job.Quality.Findings[0].Rule)
+	assert.Nil(t, modelMetadataFromItem(completedGLBItem("test-job", "2025-01-01T00:00:00Z", "")).Quality)
+}
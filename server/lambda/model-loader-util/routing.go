@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/converters"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// conversionRoute is where the job for one output format is sent
+type conversionRoute struct {
+	Converter converters.Converter
+	QueueURL  string
+	// Options are the request options with the converter's defaults, as JSON
+	Options string
+}
+
+// routeConversion looks up the converter of a from and to pair and checks the
+// options against its schema
+func routeConversion(fromFileType string, toFileType string, options map[string]any) (conversionRoute, events.APIGatewayV2HTTPResponse) {
+	converter, ok := converters.Default.Lookup(fromFileType, toFileType)
+	if !ok {
+		return conversionRoute{}, createErrorResponse(400, fmt.Sprintf("No converter is registered for %s to %s", fromFileType, toFileType))
+	}
+	resolved, err := converter.ResolveOptions(options)
+	if errors.Is(err, converters.ErrInvalidOptions) {
+		return conversionRoute{}, createErrorResponse(400, err.Error())
+	}
+	if err != nil {
+		return conversionRoute{}, createErrorResponse(500, fmt.Sprintf("Converter %s is misconfigured", converter.Name))
+	}
+	queueURL := os.Getenv(converter.Backend.QueueURLEnv())
+	if queueURL == "" {
+		return conversionRoute{}, createErrorResponse(500, fmt.Sprintf("Queue URL not configured for the %s backend", converter.Backend))
+	}
+
+	route := conversionRoute{Converter: converter, QueueURL: queueURL}
+	if len(resolved) > 0 {
+		encoded, _ := json.Marshal(resolved)
+		route.Options = string(encoded)
+	}
+	return route, events.APIGatewayV2HTTPResponse{}
+}
+
+// routeConversionJob routes every target of a job, keyed by output format.
+// The options of a job with several targets are shared, so each converter
+// gets only the options it declares and only names no target declares are
+// rejected.
+func routeConversionJob(job ConversionJob) (map[string]conversionRoute, events.APIGatewayV2HTTPResponse) {
+	targets := conversionTargets(job)
+	routes := map[string]conversionRoute{}
+	for _, toFileType := range targets {
+		options := job.Options
+		if converter, ok := converters.Default.Lookup(job.FromFileType, toFileType); ok && len(targets) > 1 {
+			options = declaredOptions(converter, job.Options)
+		}
+		route, resp := routeConversion(job.FromFileType, toFileType, options)
+		if resp.StatusCode != 0 {
+			return nil, resp
+		}
+		routes[toFileType] = route
+	}
+
+	var undeclared []string
+	for name := range job.Options {
+		if !slices.ContainsFunc(targets, func(toFileType string) bool { return routes[toFileType].Converter.HasOption(name) }) {
+			undeclared = append(undeclared, name)
+		}
+	}
+	if len(undeclared) > 0 {
+		sort.Strings(undeclared)
+		return nil, createErrorResponse(400, fmt.Sprintf("No target of this job has the option %s", strings.Join(undeclared, ", ")))
+	}
+	return routes, events.APIGatewayV2HTTPResponse{}
+}
+
+// declaredOptions keeps the options a converter declares
+func declaredOptions(converter converters.Converter, options map[string]any) map[string]any {
+	declared := map[string]any{}
+	for name, value := range options {
+		if converter.HasOption(name) {
+			declared[name] = value
+		}
+	}
+	return declared
+}
+
+// routedMaxSourceSize lowers the allowed source size to the smallest limit of
+// the converters a job is routed to
+func routedMaxSourceSize(maxSize int64, routes map[string]conversionRoute) int64 {
+	for _, route := range routes {
+		if limit := route.Converter.Limits.MaxSourceSize; limit > 0 && limit < maxSize {
+			maxSize = limit
+		}
+	}
+	return maxSize
+}
+
+// addConversionRoute records on a conversion message which converter it was
+// routed to and the options it runs with
+func addConversionRoute(message map[string]string, route conversionRoute) {
+	message["converter"] = route.Converter.Name
+	message["backend"] = string(route.Converter.Backend)
+	if route.Options != "" {
+		message["options"] = route.Options
+	}
+	if route.Converter.PostProcess != "" {
+		message["exportFileType"] = route.Converter.Export
+		message["postProcess"] = route.Converter.PostProcess
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/converters"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// useConverter registers a converter on the default registry for one test
+func useConverter(t *testing.T, converter converters.Converter) {
+	original, _ := converters.Default.Lookup(converter.From, converter.To)
+	assert.NoError(t, converters.Default.Register(converter))
+	t.Cleanup(func() { converters.Default.Register(original) })
+}
+
+var testNativeConverter = converters.Converter{
+	From:    "blend",
+	To:      "gltf",
+	Backend: converters.BackendNative,
+	Name:    "test-native",
+	Options: []converters.Option{{Name: "embedImages", Type: converters.OptionBoolean, Default: false}},
+	Limits:  converters.Limits{MaxSourceSize: 16},
+}
+
+func TestHandlePostRequest_RoutesTargetsToTheirBackends(t *testing.T) {
+	setupTestEnv(t)
+	unlimited := testNativeConverter
+	unlimited.Limits = converters.Limits{}
+	useConverter(t, unlimited)
+
+	mockSQS := &mockSQSClient{}
+	resp, err := HandlePostRequest(context.Background(), newMultiTargetPostRequest(`["glb", "gltf"]`), mockSQS, &mockDynamoDBClient{}, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	assert.Len(t, mockSQS.sendMessageInputs, 2)
+	queues := map[string]map[string]string{}
+	for _, input := range mockSQS.sendMessageInputs {
+		var messageBody map[string]string
+		assert.NoError(t, json.Unmarshal([]byte(*input.MessageBody), &messageBody))
+		queues[*input.QueueUrl] = messageBody
+	}
+	blender := queues["https://sqs.us-east-1.amazonaws.com/123456789012/test-queue"]
+	assert.Equal(t, "glb", blender["toFileType"])
+	assert.Equal(t, "blender", blender["backend"])
+	assert.Equal(t, `{"yUp":true}`, blender["options"])
+	native := queues[testNativeQueueURL]
+	assert.Equal(t, "gltf", native["toFileType"])
+	assert.Equal(t, "test-native", native["converter"])
+	assert.Equal(t, `{"embedImages":false}`, native["options"])
+}
+
+func TestHandlePostRequest_RoutesHTTPConvertersToTheHTTPQueue(t *testing.T) {
+	setupTestEnv(t)
+	useConverter(t, converters.Converter{
+		From:     "blend",
+		To:       "obj",
+		Backend:  converters.BackendHTTP,
+		Name:     "acme",
+		Endpoint: "https://converter.example.com/convert",
+	})
+
+	mockSQS := &mockSQSClient{}
+	resp, err := HandlePostRequest(context.Background(), newMultiTargetPostRequest(`["obj"]`), mockSQS, &mockDynamoDBClient{}, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	assert.Len(t, mockSQS.sendMessageInputs, 1)
+	assert.Equal(t, testHTTPQueueURL, *mockSQS.sendMessageInputs[0].QueueUrl)
+	var messageBody map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(*mockSQS.sendMessageInputs[0].MessageBody), &messageBody))
+	assert.Equal(t, "http", messageBody["backend"])
+	assert.Equal(t, "acme", messageBody["converter"])
+	assert.NotContains(t, *mockSQS.sendMessageInputs[0].MessageBody, "converter.example.com")
+}
+
+func TestHandlePostRequest_SplitsOptionsAcrossTargets(t *testing.T) {
+	setupTestEnv(t)
+	unlimited := testNativeConverter
+	unlimited.Limits = converters.Limits{}
+	useConverter(t, unlimited)
+
+	request := newMultiTargetPostRequest(`["glb", "gltf"]`)
+	request.Body = strings.Replace(request.Body, `"fromFileType"`, `"options": {"yUp": false, "embedImages": true}, "fromFileType"`, 1)
+	mockSQS := &mockSQSClient{}
+	resp, err := HandlePostRequest(context.Background(), request, mockSQS, &mockDynamoDBClient{}, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	options := map[string]string{}
+	for _, input := range mockSQS.sendMessageInputs {
+		var messageBody map[string]string
+		assert.NoError(t, json.Unmarshal([]byte(*input.MessageBody), &messageBody))
+		options[messageBody["toFileType"]] = messageBody["options"]
+	}
+	assert.Equal(t, map[string]string{"glb": `{"yUp":false}`, "gltf": `{"embedImages":true}`}, options)
+}
+
+func TestHandlePostRequest_OptionNoTargetDeclares_Returns400(t *testing.T) {
+	setupTestEnv(t)
+	unlimited := testNativeConverter
+	unlimited.Limits = converters.Limits{}
+	useConverter(t, unlimited)
+
+	request := newMultiTargetPostRequest(`["glb", "gltf"]`)
+	request.Body = strings.Replace(request.Body, `"fromFileType"`, `"options": {"yUp": false, "draco": true}, "fromFileType"`, 1)
+	mockSQS := &mockSQSClient{}
+	resp, err := HandlePostRequest(context.Background(), request, mockSQS, &mockDynamoDBClient{}, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Contains(t, resp.Body, "No target of this job has the option draco")
+	assert.Empty(t, mockSQS.sendMessageInputs)
+}
+
+func TestHandlePostRequest_ConverterRejections(t *testing.T) {
+	setupTestEnv(t)
+	useConverter(t, testNativeConverter)
+
+	tests := []struct {
+		name       string
+		body       string
+		statusCode int
+		message    string
+	}{
+		{
+			name:       "unknown option",
+			body:       strings.Replace(preflightConversionBody, `"toFileType": "glb",`, `"toFileType": "glb", "options": {"draco": true},`, 1),
+			statusCode: 400,
+			message:    "blend to glb conversions have no option draco",
+		},
+		{
+			name:       "invalid option",
+			body:       strings.Replace(preflightConversionBody, `"toFileType": "glb",`, `"toFileType": "glb", "options": {"yUp": "no"},`, 1),
+			statusCode: 400,
+			message:    "yUp must be a boolean",
+		},
+		{
+			name:       "source over the converter limit",
+			body:       strings.Replace(preflightConversionBody, `"toFileType": "glb"`, `"toFileType": "gltf"`, 1),
+			statusCode: 413,
+			message:    "at most 16 bytes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSQS := &mockSQSClient{}
+			request := newPreflightPostRequest()
+			request.Body = tt.body
+
+			resp, err := HandlePostRequest(context.Background(), request, mockSQS, &mockDynamoDBClient{}, newSourceS3Client())
+			assert.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			assert.Contains(t, resp.Body, tt.message)
+			assert.Empty(t, mockSQS.sendMessageInputs)
+		})
+	}
+}
+
+func TestHandlePostRequest_BackendQueueNotConfigured_Returns500(t *testing.T) {
+	setupTestEnv(t)
+	useConverter(t, testNativeConverter)
+	t.Setenv("native_jobs_queue_url", "")
+
+	request := newPreflightPostRequest()
+	request.Body = strings.Replace(preflightConversionBody, `"toFileType": "glb"`, `"toFileType": "gltf"`, 1)
+	resp, err := HandlePostRequest(context.Background(), request, &mockSQSClient{}, &mockDynamoDBClient{}, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 500, resp.StatusCode)
+	assert.Contains(t, resp.Body, "Queue URL not configured for the native backend")
+}
+
+func TestHandlePostBatchRequest_RoutesJobsToTheirBackends(t *testing.T) {
+	setupTestEnv(t)
+	unlimited := testNativeConverter
+	unlimited.Limits = converters.Limits{}
+	useConverter(t, unlimited)
+
+	jobs := newBatchJobs(3)
+	jobs[1].ToFileType = "gltf"
+
+	mockSQS := &mockSQSClient{}
+	resp, err := HandlePostBatchRequest(context.Background(), newBatchRequest(jobs), mockSQS, &mockDynamoDBClient{}, newSourceS3Client(batchSourceKeys(3)...))
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	entries := map[string]int{}
+	for _, input := range mockSQS.sendMessageBatchInputs {
+		entries[*input.QueueUrl] += len(input.Entries)
+	}
+	assert.Equal(t, map[string]int{
+		"https://sqs.us-east-1.amazonaws.com/123456789012/test-queue": 2,
+		testNativeQueueURL: 1,
+	}, entries)
+}
+
+func TestHandleRetryJobRequest_FollowsTheCurrentRoute(t *testing.T) {
+	setupTestEnv(t)
+	unlimited := testNativeConverter
+	unlimited.Limits = converters.Limits{}
+	useConverter(t, unlimited)
+
+	item := failedJobItem("test-job-id", 0)
+	item["toFileType"] = &types.AttributeValueMemberS{Value: "gltf"}
+	item["backend"] = &types.AttributeValueMemberS{Value: "blender"}
+	item["options"] = &types.AttributeValueMemberS{Value: `{"embedImages":true}`}
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{getItemOutputs: []*dynamodb.GetItemOutput{{Item: item}}}
+
+	resp, err := HandleRetryJobRequest(context.Background(), newCancelJobRequest("test-job-id"), mockSQS, mockDynamo, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	assert.Equal(t, testNativeQueueURL, *mockSQS.sendMessageInput.QueueUrl)
+	var messageBody map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(*mockSQS.sendMessageInput.MessageBody), &messageBody))
+	assert.Equal(t, `{"embedImages":true}`, messageBody["options"])
+	assert.Equal(t, "native", mockDynamo.updateItemInputs[0].ExpressionAttributeValues[":backend"].(*types.AttributeValueMemberS).Value)
+}
+
+func TestHandlePostRequest_USDZIsExportedAsGLBAndPostProcessed(t *testing.T) {
+	setupTestEnv(t)
+
+	mockSQS := &mockSQSClient{}
+	resp, err := HandlePostRequest(context.Background(), newMultiTargetPostRequest(`["usdz"]`), mockSQS, &mockDynamoDBClient{}, newSourceS3Client())
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	if assert.Len(t, mockSQS.sendMessageInputs, 1) {
+		var messageBody map[string]string
+		assert.NoError(t, json.Unmarshal([]byte(*mockSQS.sendMessageInputs[0].MessageBody), &messageBody))
+		assert.Equal(t, "usdz", messageBody["toFileType"])
+		assert.Equal(t, "blender", messageBody["backend"])
+		assert.Equal(t, "glb", messageBody["exportFileType"])
+		assert.Equal(t, "usdz", messageBody["postProcess"])
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/helpers"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+type CreateUploadSessionRequest struct {
+	FileType    string `json:"fileType"`
+	ContentType string `json:"contentType"`
+	// FileSize is optional, when set the presigned URL only accepts that size
+	FileSize int64 `json:"fileSize"`
+}
+
+type UploadSession struct {
+	SessionID    string `json:"sessionId"`
+	ModelID      string `json:"modelId"`
+	S3Key        string `json:"s3Key"`
+	FileType     string `json:"fileType"`
+	ContentType  string `json:"contentType"`
+	MaxSize      int64  `json:"maxSize"`
+	ExpiresAt    string `json:"expiresAt"`
+	PresignedUrl string `json:"presignedUrl,omitempty"`
+}
+
+const (
+	// Uploads have to start within this window, conversions can reference the
+	// session for as long as it is retained
+	uploadSessionDuration  = 1 * time.Hour
+	uploadSessionRetention = 30 * 24 * time.Hour
+	// Single presigned PUTs are capped at 5 GiB by S3
+	defaultMaxUploadSize = 5 * 1024 * 1024 * 1024
+)
+
+// rawSourceKeysAllowed reports whether conversions may name modelId and s3Key
+// without an upload session. allow_raw_source_keys turns this on while
+// clients of PUT /3d-model/{id} and the multipart uploads move to sessions.
+func rawSourceKeysAllowed() bool {
+	return os.Getenv("allow_raw_source_keys") == "true"
+}
+
+func maxUploadSize() int64 {
+	maxStr := os.Getenv("max_upload_size_bytes")
+	if maxStr == "" {
+		return defaultMaxUploadSize
+	}
+	maxSize, err := strconv.ParseInt(maxStr, 10, 64)
+	if err != nil || maxSize <= 0 {
+		log.Printf("Invalid max_upload_size_bytes %q, using %d", maxStr, defaultMaxUploadSize)
+		return defaultMaxUploadSize
+	}
+	return maxSize
+}
+
+// sourceObjectKey is the only key a model's source file may be stored under
+func sourceObjectKey(modelID string, fileType string) string {
+	extension := fileType
+	if input, ok := knownInputFormat(fileType); ok {
+		extension = input.Extension
+	}
+	return fmt.Sprintf("%s/%s.%s", fileType, modelID, extension)
+}
+
+/*
+###########################################
+POST /v1/uploads
+###########################################
+*/
+
+func putUploadSession(ctx context.Context, dynamoClient DynamoDBClient, session UploadSession, expiresAt time.Time) error {
+	_, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(os.Getenv("upload_sessions_table")),
+		Item: map[string]types.AttributeValue{
+			"sessionId":   &types.AttributeValueMemberS{Value: session.SessionID},
+			"modelId":     &types.AttributeValueMemberS{Value: session.ModelID},
+			"s3Key":       &types.AttributeValueMemberS{Value: session.S3Key},
+			"fileType":    &types.AttributeValueMemberS{Value: session.FileType},
+			"contentType": &types.AttributeValueMemberS{Value: session.ContentType},
+			"maxSize":     &types.AttributeValueMemberN{Value: strconv.FormatInt(session.MaxSize, 10)},
+			"expiresAt":   &types.AttributeValueMemberS{Value: session.ExpiresAt},
+			"retainUntil": &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt.Add(uploadSessionRetention).Unix(), 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(sessionId)"),
+	})
+	return err
+}
+
+func HandleCreateUploadSessionRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest, dynamoClient DynamoDBClient, presignClient PresignClient) (events.APIGatewayV2HTTPResponse, error) {
+	apiKeyResp, err := helpers.ValidateHttpAPIKey(request)
+	if err != nil {
+		return createErrorResponse(500, "Error validating API key"), err
+	}
+	if apiKeyResp.StatusCode != 0 {
+		return apiKeyResp, nil
+	}
+
+	var sessionRequest CreateUploadSessionRequest
+	if request.Body != "" {
+		if err := json.Unmarshal([]byte(request.Body), &sessionRequest); err != nil {
+			return createErrorResponse(400, "Invalid request body"), nil
+		}
+	}
+	if sessionRequest.FileType == "" {
+		sessionRequest.FileType = "blend"
+	}
+	input, ok := inputFormat(sessionRequest.FileType)
+	if !ok {
+		return createErrorResponse(400, unsupportedInputMessage()), nil
+	}
+	contentTypes := input.ContentTypes
+	if sessionRequest.ContentType == "" {
+		sessionRequest.ContentType = contentTypes[0]
+	}
+	if !slices.Contains(contentTypes, sessionRequest.ContentType) {
+		message := fmt.Sprintf("contentType must be one of %s", strings.Join(contentTypes, ", "))
+		return createErrorResponse(400, message), nil
+	}
+	maxSize := maxUploadSize()
+	if sessionRequest.FileSize < 0 || sessionRequest.FileSize > maxSize {
+		return createErrorResponse(400, fmt.Sprintf("fileSize must be at most %d bytes", maxSize)), nil
+	}
+
+	expiresAt := time.Now().Add(uploadSessionDuration)
+	modelID := uuid.New().String()
+	session := UploadSession{
+		SessionID:   uuid.New().String(),
+		ModelID:     modelID,
+		S3Key:       sourceObjectKey(modelID, sessionRequest.FileType),
+		FileType:    sessionRequest.FileType,
+		ContentType: sessionRequest.ContentType,
+		MaxSize:     maxSize,
+		ExpiresAt:   expiresAt.UTC().Format(time.RFC3339),
+	}
+	if err := putUploadSession(ctx, dynamoClient, session, expiresAt); err != nil {
+		return createErrorResponse(500, "Failed to create upload session"), err
+	}
+
+	// The content type, and the size when the client declared one, are part of
+	// the signature, so S3 rejects uploads that do not match the session
+	putObjectInput := &s3.PutObjectInput{
+		Bucket:      aws.String(os.Getenv("model_s3_bucket")),
+		Key:         aws.String(session.S3Key),
+		ContentType: aws.String(session.ContentType),
+	}
+	if sessionRequest.FileSize > 0 {
+		putObjectInput.ContentLength = aws.Int64(sessionRequest.FileSize)
+	}
+	presignedURL, err := presignClient.PresignPutObject(ctx, putObjectInput, s3.WithPresignExpires(uploadSessionDuration))
+	if err != nil {
+		return createErrorResponse(500, "Failed to generate presigned PUT URL"), err
+	}
+	session.PresignedUrl = presignedURL.URL
+
+	return createSuccessResponse(201, session), nil
+}
+
+func getUploadSession(ctx context.Context, dynamoClient DynamoDBClient, sessionID string) (*UploadSession, error) {
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(os.Getenv("upload_sessions_table")),
+		Key: map[string]types.AttributeValue{
+			"sessionId": &types.AttributeValueMemberS{Value: sessionID},
+		},
+	})
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+	return &UploadSession{
+		SessionID:   stringAttribute(result.Item, "sessionId"),
+		ModelID:     stringAttribute(result.Item, "modelId"),
+		S3Key:       stringAttribute(result.Item, "s3Key"),
+		FileType:    stringAttribute(result.Item, "fileType"),
+		ContentType: stringAttribute(result.Item, "contentType"),
+		MaxSize:     int64(numberAttribute(result.Item, "maxSize")),
+		ExpiresAt:   stringAttribute(result.Item, "expiresAt"),
+	}, nil
+}
+
+// applyUploadSession fills the source of a conversion from its upload session.
+// It returns a non-zero response when the session cannot be used, the upload
+// itself is checked by preflightSourceObject against the session's maxSize.
+func applyUploadSession(ctx context.Context, dynamoClient DynamoDBClient, job *ConversionJob) (*UploadSession, events.APIGatewayV2HTTPResponse, error) {
+	session, err := getUploadSession(ctx, dynamoClient, job.UploadSessionID)
+	if err != nil {
+		return nil, createErrorResponse(500, "Failed to get upload session"), err
+	}
+	if session == nil {
+		return nil, createErrorResponse(404, fmt.Sprintf("Upload session %s not found", job.UploadSessionID)), nil
+	}
+	if (job.ModelID != "" && job.ModelID != session.ModelID) || (job.S3Key != "" && job.S3Key != session.S3Key) {
+		return nil, createErrorResponse(400, "modelId and s3Key must match the upload session or be left out"), nil
+	}
+
+	job.ModelID = session.ModelID
+	job.S3Key = session.S3Key
+	if job.FromFileType == "" {
+		job.FromFileType = session.FileType
+	}
+	return session, events.APIGatewayV2HTTPResponse{}, nil
+}
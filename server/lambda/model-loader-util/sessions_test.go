@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func uploadSessionItem(maxSize string) *dynamodb.GetItemOutput {
+	return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+		"sessionId":   &types.AttributeValueMemberS{Value: "test-session-id"},
+		"modelId":     &types.AttributeValueMemberS{Value: "server-model-id"},
+		"s3Key":       &types.AttributeValueMemberS{Value: "blend/server-model-id.blend"},
+		"fileType":    &types.AttributeValueMemberS{Value: "blend"},
+		"contentType": &types.AttributeValueMemberS{Value: "application/octet-stream"},
+		"maxSize":     &types.AttributeValueMemberN{Value: maxSize},
+	}}
+}
+
+func newSessionPostRequest(body string) events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{
+		Headers: map[string]string{
+			"x-api-key":    "test-api-key",
+			"Content-Type": "application/json",
+		},
+		Body: body,
+	}
+}
+
+func TestHandleCreateUploadSessionRequest_Success(t *testing.T) {
+	setupTestEnv(t)
+
+	mockDynamo := &mockDynamoDBClient{}
+	req := newSessionPostRequest(`{"fileType": "blend", "fileSize": 1048576}`)
+
+	resp, err := HandleCreateUploadSessionRequest(context.Background(), req, mockDynamo, newTestPresignClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 201, resp.StatusCode)
+
+	var session UploadSession
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &session))
+	assert.NotEmpty(t, session.SessionID)
+	assert.NotEmpty(t, session.ModelID)
+	assert.Equal(t, "blend/"+session.ModelID+".blend", session.S3Key)
+	assert.Equal(t, "application/octet-stream", session.ContentType)
+	assert.Equal(t, int64(defaultMaxUploadSize), session.MaxSize)
+	assert.Contains(t, session.PresignedUrl, session.S3Key)
+	assert.True(t, strings.Contains(session.PresignedUrl, "content-type"))
+
+	assert.Len(t, mockDynamo.putItemInputs, 1)
+	assert.Equal(t, "test-upload-sessions-table", *mockDynamo.putItemInputs[0].TableName)
+	assert.Equal(t, session.ModelID, mockDynamo.putItemInputs[0].Item["modelId"].(*types.AttributeValueMemberS).Value)
+}
+
+func TestHandleCreateUploadSessionRequest_InvalidRequests_Return400(t *testing.T) {
+	setupTestEnv(t)
+	t.Setenv("max_upload_size_bytes", "1024")
+
+	for _, body := range []string{
+		`{"fileType": "docx"}`,
+		`{"contentType": "text/plain"}`,
+		`{"fileSize": 2048}`,
+	} {
+		mockDynamo := &mockDynamoDBClient{}
+		resp, err := HandleCreateUploadSessionRequest(context.Background(), newSessionPostRequest(body), mockDynamo, newTestPresignClient())
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.StatusCode, body)
+		assert.Empty(t, mockDynamo.putItemInputs)
+	}
+}
+
+func TestHandlePostRequest_UploadSession_UsesSessionKey(t *testing.T) {
+	setupTestEnv(t)
+	t.Setenv("allow_raw_source_keys", "")
+
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{getItemOutputs: []*dynamodb.GetItemOutput{uploadSessionItem("1024")}}
+	mockS3 := &mockS3Client{contents: map[string]string{"blend/server-model-id.blend": testBlendFile()}}
+	req := newSessionPostRequest(`{"connectionId": "test-connection-id", "toFileType": "glb", "uploadSessionId": "test-session-id"}`)
+
+	resp, err := HandlePostRequest(context.Background(), req, mockSQS, mockDynamo, mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	var messageBody map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(*mockSQS.sendMessageInput.MessageBody), &messageBody))
+	assert.Equal(t, "server-model-id", messageBody["modelId"])
+	assert.Equal(t, "blend/server-model-id.blend", messageBody["s3Key"])
+	assert.Equal(t, "blend", messageBody["fromFileType"])
+}
+
+func TestHandlePostRequest_UploadSession_Rejections(t *testing.T) {
+	setupTestEnv(t)
+
+	tests := []struct {
+		name       string
+		session    *dynamodb.GetItemOutput
+		contents   map[string]string
+		body       string
+		statusCode int
+	}{
+		{
+			name:       "unknown session",
+			session:    &dynamodb.GetItemOutput{},
+			body:       `{"connectionId": "c", "toFileType": "glb", "uploadSessionId": "missing"}`,
+			statusCode: 404,
+		},
+		{
+			name:       "not uploaded yet",
+			session:    uploadSessionItem("1024"),
+			body:       `{"connectionId": "c", "toFileType": "glb", "uploadSessionId": "test-session-id"}`,
+			statusCode: 409,
+		},
+		{
+			name:       "larger than allowed",
+			session:    uploadSessionItem("4"),
+			contents:   map[string]string{"blend/server-model-id.blend": testBlendFile()},
+			body:       `{"connectionId": "c", "toFileType": "glb", "uploadSessionId": "test-session-id"}`,
+			statusCode: 413,
+		},
+		{
+			name:       "different s3Key",
+			session:    uploadSessionItem("1024"),
+			contents:   map[string]string{"blend/server-model-id.blend": testBlendFile()},
+			body:       `{"connectionId": "c", "toFileType": "glb", "uploadSessionId": "test-session-id", "s3Key": "blend/other.blend"}`,
+			statusCode: 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSQS := &mockSQSClient{}
+			mockDynamo := &mockDynamoDBClient{getItemOutputs: []*dynamodb.GetItemOutput{tt.session}}
+
+			resp, err := HandlePostRequest(context.Background(), newSessionPostRequest(tt.body), mockSQS, mockDynamo, &mockS3Client{contents: tt.contents})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			assert.Nil(t, mockSQS.sendMessageInput)
+		})
+	}
+}
+
+func TestHandlePostRequest_WithoutSession_Returns400(t *testing.T) {
+	setupTestEnv(t)
+	t.Setenv("allow_raw_source_keys", "")
+
+	mockSQS := &mockSQSClient{}
+	mockS3 := &mockS3Client{contents: map[string]string{"blend/client-model-id.blend": testBlendFile()}}
+	req := newSessionPostRequest(`{"connectionId": "c", "fromFileType": "blend", "toFileType": "glb", "modelId": "client-model-id", "s3Key": "blend/client-model-id.blend"}`)
+
+	resp, err := HandlePostRequest(context.Background(), req, mockSQS, &mockDynamoDBClient{}, mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Contains(t, resp.Body, "Missing required fields: uploadSessionId")
+	assert.Nil(t, mockSQS.sendMessageInput)
+}
+
+func TestHandlePostBatchRequest_WithoutSession_RejectsTheItem(t *testing.T) {
+	setupTestEnv(t)
+	t.Setenv("allow_raw_source_keys", "")
+
+	jobs := []ConversionJob{
+		{ConnectionID: "c", ToFileType: "glb", UploadSessionID: "test-session-id"},
+		{ConnectionID: "c", FromFileType: "blend", ToFileType: "glb", ModelID: "client-model-id", S3Key: "blend/client-model-id.blend"},
+	}
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{getItemOutputs: []*dynamodb.GetItemOutput{uploadSessionItem("1024")}}
+	mockS3 := &mockS3Client{contents: map[string]string{
+		"blend/server-model-id.blend": testBlendFile(),
+		"blend/client-model-id.blend": testBlendFile(),
+	}}
+
+	resp, err := HandlePostBatchRequest(context.Background(), newBatchRequest(jobs), mockSQS, mockDynamo, mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	var response BatchPostResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+	assert.Equal(t, "accepted", response.Results[0].Status)
+	assert.Equal(t, "server-model-id", response.Results[0].ModelID)
+	assert.Equal(t, "rejected", response.Results[1].Status)
+	assert.Equal(t, "Missing required fields: uploadSessionId", response.Results[1].Error)
+}
+
+func TestHandlePostRequest_RawSourceKeys_AcceptsTheModelsOwnUpload(t *testing.T) {
+	setupTestEnv(t)
+
+	// Clients of PUT /3d-model/{id} choose the model id themselves until
+	// allow_raw_source_keys is turned off
+	mockSQS := &mockSQSClient{}
+	mockS3 := &mockS3Client{contents: map[string]string{"blend/client-model-id.blend": testBlendFile()}}
+	req := newSessionPostRequest(`{"connectionId": "c", "fromFileType": "blend", "toFileType": "glb", "modelId": "client-model-id", "s3Key": "blend/client-model-id.blend"}`)
+
+	resp, err := HandlePostRequest(context.Background(), req, mockSQS, &mockDynamoDBClient{}, mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	var messageBody map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(*mockSQS.sendMessageInput.MessageBody), &messageBody))
+	assert.Equal(t, "client-model-id", messageBody["modelId"])
+	assert.Equal(t, "blend/client-model-id.blend", messageBody["s3Key"])
+}
+
+func TestHandlePostRequest_RawSourceKeys_CheckContentTypeAndSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		contentType   string
+		maxUploadSize string
+		statusCode    int
+		message       string
+	}{
+		{
+			name:        "content type of another format",
+			contentType: "text/html",
+			statusCode:  400,
+			message:     `uploaded as \"text/html\"`,
+		},
+		{
+			name:          "larger than uploads may be",
+			contentType:   "application/x-blender",
+			maxUploadSize: "4",
+			statusCode:    413,
+			message:       "at most 4 bytes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestEnv(t)
+			t.Setenv("max_upload_size_bytes", tt.maxUploadSize)
+
+			mockSQS := &mockSQSClient{}
+			mockS3 := &mockS3Client{
+				contents:     map[string]string{"blend/client-model-id.blend": testBlendFile()},
+				contentTypes: map[string]string{"blend/client-model-id.blend": tt.contentType},
+			}
+			req := newSessionPostRequest(`{"connectionId": "c", "fromFileType": "blend", "toFileType": "glb", "modelId": "client-model-id", "s3Key": "blend/client-model-id.blend"}`)
+
+			resp, err := HandlePostRequest(context.Background(), req, mockSQS, &mockDynamoDBClient{}, mockS3)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			assert.Contains(t, resp.Body, tt.message)
+			assert.Nil(t, mockSQS.sendMessageInput)
+		})
+	}
+}
+
+func TestHandlePostRequest_ForeignS3Key_Returns400(t *testing.T) {
+	setupTestEnv(t)
+
+	mockSQS := &mockSQSClient{}
+	req := newSessionPostRequest(`{"connectionId": "c", "fromFileType": "blend", "toFileType": "glb", "modelId": "test-model-id", "s3Key": "blend/someone-else.blend"}`)
+
+	resp, err := HandlePostRequest(context.Background(), req, mockSQS, &mockDynamoDBClient{}, &mockS3Client{})
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Contains(t, resp.Body, "s3Key must be blend/test-model-id.blend")
+	assert.Nil(t, mockSQS.sendMessageInput)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/blendzip"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type BundleValidationResponse struct {
+	Error   string                  `json:"error"`
+	Missing []blendzip.MissingAsset `json:"missing"`
+}
+
+const (
+	// blend-zip archives are validated within the request, which bounds how
+	// large they can be
+	maxBundleSourceSize = 1024 * 1024 * 1024
+	s3ReadChunkSize     = 8 * 1024 * 1024
+)
+
+// blendZipValidator checks blend-zip sources before their job is queued
+var blendZipValidator = blendzip.Validator{Limits: blendzip.DefaultLimits}
+
+// s3ReaderAt reads an object through ranged GetObject calls. It keeps the last
+// chunk it fetched, since zip entries are mostly read front to back.
+type s3ReaderAt struct {
+	ctx        context.Context
+	client     S3Client
+	bucket     string
+	key        string
+	etag       string
+	size       int64
+	chunkStart int64
+	chunk      []byte
+}
+
+func (r *s3ReaderAt) fetch(position int64) error {
+	start := position - position%s3ReadChunkSize
+	end := min(start+s3ReadChunkSize, r.size) - 1
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+	}
+	if r.etag != "" {
+		input.IfMatch = aws.String(r.etag)
+	}
+	result, err := r.client.GetObject(r.ctx, input)
+	if err != nil {
+		return err
+	}
+	defer result.Body.Close()
+	chunk, err := io.ReadAll(result.Body)
+	if err != nil {
+		return err
+	}
+	r.chunkStart, r.chunk = start, chunk
+	return nil
+}
+
+func (r *s3ReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	n := 0
+	for n < len(p) && offset+int64(n) < r.size {
+		position := offset + int64(n)
+		if position < r.chunkStart || position >= r.chunkStart+int64(len(r.chunk)) {
+			if err := r.fetch(position); err != nil {
+				return n, err
+			}
+			if len(r.chunk) == 0 {
+				break
+			}
+		}
+		n += copy(p[n:], r.chunk[position-r.chunkStart:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// preflightBlendZip validates a blend-zip source and records its main .blend
+// file, so the worker knows which file to open
+func preflightBlendZip(ctx context.Context, s3Client S3Client, job ConversionJob, source *SourceObject) (*SourceObject, events.APIGatewayV2HTTPResponse, error) {
+	if source.Size > maxBundleSourceSize {
+		message := fmt.Sprintf("blend-zip files can be at most %d bytes", maxBundleSourceSize)
+		return nil, createErrorResponse(413, message), nil
+	}
+
+	reader := &s3ReaderAt{
+		ctx:    ctx,
+		client: s3Client,
+		bucket: os.Getenv("model_s3_bucket"),
+		key:    job.S3Key,
+		etag:   source.ETag,
+		size:   source.Size,
+	}
+	report, err := blendZipValidator.Validate(reader, source.Size)
+	if errors.Is(err, blendzip.ErrInvalid) {
+		return nil, createErrorResponse(400, fmt.Sprintf("Source file %s is not a valid blend-zip: %v", job.S3Key, err)), nil
+	}
+	if err != nil {
+		return nil, createErrorResponse(500, "Failed to read source file"), err
+	}
+
+	if len(report.Missing) > 0 {
+		paths := make([]string, 0, len(report.Missing))
+		for _, missing := range report.Missing {
+			paths = append(paths, missing.Path)
+		}
+		log.Printf("blend-zip %s is missing %d assets", job.S3Key, len(report.Missing))
+		return nil, createSuccessResponse(400, BundleValidationResponse{
+			Error:   fmt.Sprintf("%d referenced assets are missing from the archive: %s", len(paths), strings.Join(paths, ", ")),
+			Missing: report.Missing,
+		}), nil
+	}
+
+	source.MainFile = report.MainFile
+	source.Stats = newSourceStats(report.Main)
+	source.Blend = report.Main
+	return source, events.APIGatewayV2HTTPResponse{}, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/blendfile"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/blendzip"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const blendZipConversionBody = `{
+	"connectionId": "test-connection-id",
+	"fromFileType": "blend-zip",
+	"toFileType": "glb",
+	"modelId": "test-model-id",
+	"s3Key": "blend-zip/test-model-id.zip"
+}`
+
+func newBlendZipPostRequest() events.APIGatewayV2HTTPRequest {
+	request := newPreflightPostRequest()
+	request.Body = blendZipConversionBody
+	return request
+}
+
+func testBlendZip(t *testing.T, files map[string]string) string {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := writer.Create(name)
+		assert.NoError(t, err)
+		w.Write([]byte(content))
+	}
+	assert.NoError(t, writer.Close())
+	return buf.String()
+}
+
+// useBlendZipReferences makes .blend files inside blend-zips reference images,
+// which testBlendFile cannot describe
+func useBlendZipReferences(t *testing.T, images ...string) {
+	original := blendZipValidator
+	blendZipValidator.Inspect = func(r io.Reader) (*blendfile.File, error) {
+		file, err := blendfile.Inspect(r)
+		if err != nil {
+			return nil, err
+		}
+		file.ExternalImages = images
+		return file, nil
+	}
+	t.Cleanup(func() { blendZipValidator = original })
+}
+
+func TestHandlePostRequest_BlendZip_RecordsMainFile(t *testing.T) {
+	setupTestEnv(t)
+	useBlendZipReferences(t, "//textures/wood.png")
+
+	mockSQS := &mockSQSClient{}
+	mockDynamo := &mockDynamoDBClient{}
+	mockS3 := &mockS3Client{contents: map[string]string{
+		"blend-zip/test-model-id.zip": testBlendZip(t, map[string]string{
+			"scene/chair.blend":        testBlendFile(),
+			"scene/textures/wood.png":  "png",
+			"__MACOSX/scene/._chair.b": "resource fork",
+		}),
+	}}
+
+	resp, err := HandlePostRequest(context.Background(), newBlendZipPostRequest(), mockSQS, mockDynamo, mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	var messageBody map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(*mockSQS.sendMessageInput.MessageBody), &messageBody))
+	assert.Equal(t, "scene/chair.blend", messageBody["sourceMainFile"])
+	assert.Equal(t, "blend-zip", messageBody["fromFileType"])
+
+	item := mockDynamo.putItemInputs[0].Item
+	assert.Equal(t, "scene/chair.blend", item["sourceMainFile"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "4.2", sourceStatsFromAttribute(item["sourceStats"]).BlenderVersion)
+}
+
+func TestHandlePostRequest_BlendZip_ReportsMissingAssets(t *testing.T) {
+	setupTestEnv(t)
+	useBlendZipReferences(t, "//textures/wood.png", "/Users/artist/metal.png")
+
+	mockSQS := &mockSQSClient{}
+	mockS3 := &mockS3Client{contents: map[string]string{
+		"blend-zip/test-model-id.zip": testBlendZip(t, map[string]string{"chair.blend": testBlendFile()}),
+	}}
+
+	resp, err := HandlePostRequest(context.Background(), newBlendZipPostRequest(), mockSQS, &mockDynamoDBClient{}, mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Nil(t, mockSQS.sendMessageInput)
+
+	var response BundleValidationResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+	assert.Equal(t, "2 referenced assets are missing from the archive: //textures/wood.png, /Users/artist/metal.png", response.Error)
+	assert.Equal(t, []blendzip.MissingAsset{
+		{Path: "//textures/wood.png", Type: "image", ReferencedBy: "chair.blend", Reason: "textures/wood.png is not in the archive"},
+		{Path: "/Users/artist/metal.png", Type: "image", ReferencedBy: "chair.blend", Reason: "absolute path, make paths relative in Blender before zipping"},
+	}, response.Missing)
+}
+
+func TestHandlePostRequest_BlendZip_Rejections(t *testing.T) {
+	setupTestEnv(t)
+
+	tests := []struct {
+		name    string
+		content string
+		message string
+	}{
+		{
+			name:    "path traversal",
+			content: testBlendZip(t, map[string]string{"chair.blend": testBlendFile(), "../../etc/cron.d/job": "x"}),
+			message: "points outside the archive",
+		},
+		{
+			name:    "no blend file",
+			content: testBlendZip(t, map[string]string{"wood.png": "png"}),
+			message: "archive has no .blend file",
+		},
+		{
+			name:    "not a zip",
+			content: testBlendFile(),
+			message: "is not a valid blend-zip",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSQS := &mockSQSClient{}
+			mockS3 := &mockS3Client{contents: map[string]string{"blend-zip/test-model-id.zip": tt.content}}
+
+			resp, err := HandlePostRequest(context.Background(), newBlendZipPostRequest(), mockSQS, &mockDynamoDBClient{}, mockS3)
+			assert.NoError(t, err)
+			assert.Equal(t, 400, resp.StatusCode)
+			assert.Contains(t, resp.Body, tt.message)
+			assert.Nil(t, mockSQS.sendMessageInput)
+		})
+	}
+}
+
+func TestS3ReaderAt_ReadsAcrossChunks(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), s3ReadChunkSize/5)
+	mockS3 := &mockS3Client{contents: map[string]string{"blend-zip/test-model-id.zip": string(content)}}
+	reader := &s3ReaderAt{
+		ctx:    context.Background(),
+		client: mockS3,
+		key:    "blend-zip/test-model-id.zip",
+		etag:   mockETag(string(content)),
+		size:   int64(len(content)),
+	}
+
+	buf := make([]byte, 20)
+	n, err := reader.ReadAt(buf, s3ReadChunkSize-10)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, n)
+	assert.Equal(t, content[s3ReadChunkSize-10:s3ReadChunkSize+10], buf)
+
+	n, err = reader.ReadAt(buf, int64(len(content))-5)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 5, n)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/gltf"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/helpers"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+/*
+###########################################
+GET /v1/3d-model/{unique-model-id}/stats
+###########################################
+*/
+
+// ModelStatsResponse describes the latest GLB a model was converted to
+type ModelStatsResponse struct {
+	ModelID string      `json:"modelId"`
+	JobID   string      `json:"jobId"`
+	Stats   *gltf.Stats `json:"stats"`
+}
+
+// modelStatsFromAttribute decodes the stats the notification lambda stores as
+// JSON on completed GLB jobs
+func modelStatsFromAttribute(item map[string]types.AttributeValue) *gltf.Stats {
+	encoded := stringAttribute(item, "modelStats")
+	if encoded == "" {
+		return nil
+	}
+	var stats gltf.Stats
+	if err := json.Unmarshal([]byte(encoded), &stats); err != nil {
+		log.Printf("Invalid model stats on job %s: %v", stringAttribute(item, "jobId"), err)
+		return nil
+	}
+	return &stats
+}
+
+// validationReportFromAttribute decodes the glTF validation report the
+// notification lambda stores as JSON on GLB and glTF jobs
+func validationReportFromAttribute(item map[string]types.AttributeValue) *gltf.Report {
+	encoded := stringAttribute(item, "validationReport")
+	if encoded == "" {
+		return nil
+	}
+	var report gltf.Report
+	if err := json.Unmarshal([]byte(encoded), &report); err != nil {
+		log.Printf("Invalid validation report on job %s: %v", stringAttribute(item, "jobId"), err)
+		return nil
+	}
+	return &report
+}
+
+func HandleGetModelStatsRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest, dynamoClient DynamoDBClient) (events.APIGatewayV2HTTPResponse, error) {
+	apiKeyResp, err := helpers.ValidateHttpAPIKey(request)
+	if err != nil {
+		return createErrorResponse(500, "Error validating API key"), err
+	}
+	if apiKeyResp.StatusCode != 0 {
+		return apiKeyResp, nil
+	}
+
+	modelID := request.PathParameters["id"]
+	if modelID == "" {
+		return createErrorResponse(400, "Model id is required"), nil
+	}
+
+	conversion, err := latestCompletedConversion(ctx, dynamoClient, modelID, "glb")
+	if err != nil {
+		return createErrorResponse(500, "Failed to query model job history"), err
+	}
+	if conversion == nil {
+		return createErrorResponse(404, fmt.Sprintf("Model %s has not been converted to glb yet", modelID)), nil
+	}
+	job := modelMetadataFromItem(conversion)
+	if job.ModelStats == nil {
+		return createErrorResponse(404, fmt.Sprintf("Stats of model %s are not available", modelID)), nil
+	}
+	return createSuccessResponse(200, ModelStatsResponse{ModelID: modelID, JobID: job.JobID, Stats: job.ModelStats}), nil
+}
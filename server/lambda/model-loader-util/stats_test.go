@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newGetModelStatsRequest(modelID string) events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{
+		Headers:        map[string]string{"x-api-key": "test-api-key"},
+		PathParameters: map[string]string{"id": modelID},
+	}
+}
+
+func completedGLBItem(jobID string, timestamp string, modelStats string) map[string]types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		"jobId":     &types.AttributeValueMemberS{Value: jobID},
+		"newS3Key":  &types.AttributeValueMemberS{Value: "glb/" + jobID + ".glb"},
+		"timestamp": &types.AttributeValueMemberS{Value: timestamp},
+	}
+	if modelStats != "" {
+		item["modelStats"] = &types.AttributeValueMemberS{Value: modelStats}
+	}
+	return item
+}
+
+func TestHandleGetModelStatsRequest_ReturnsLatestGLBStats(t *testing.T) {
+	setupTestEnv(t)
+
+	mockDynamo := &mockDynamoDBClient{queryOutput: &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{
+		completedGLBItem("old-job", "2025-01-01T00:00:00Z", `{"vertices":3}`),
+		completedGLBItem("new-job", "2025-02-01T00:00:00Z", `{"vertices":8,"triangles":12,"drawCalls":1,"byteSize":1024,"min":[-1,-1,-1],"max":[1,1,1],"hasAnimations":true}`),
+	}}}
+
+	resp, err := HandleGetModelStatsRequest(context.Background(), newGetModelStatsRequest("test-model-id"), mockDynamo)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	var body ModelStatsResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &body))
+	assert.Equal(t, "new-job", body.JobID)
+	assert.Equal(t, 12, body.Stats.Triangles)
+	assert.Equal(t, [3]float64{1, 1, 1}, body.Stats.Max)
+	assert.True(t, body.Stats.HasAnimations)
+}
+
+func TestHandleGetModelStatsRequest_Returns404WithoutStats(t *testing.T) {
+	setupTestEnv(t)
+
+	for name, items := range map[string][]map[string]types.AttributeValue{
+		"never converted": nil,
+		"not analyzed":    {completedGLBItem("test-job", "2025-01-01T00:00:00Z", "")},
+	} {
+		mockDynamo := &mockDynamoDBClient{queryOutput: &dynamodb.QueryOutput{Items: items}}
+
+		resp, err := HandleGetModelStatsRequest(context.Background(), newGetModelStatsRequest("test-model-id"), mockDynamo)
+
+		assert.NoError(t, err, name)
+		assert.Equal(t, 404, resp.StatusCode, name)
+	}
+}
+
+func TestModelMetadataFromItem_DecodesModelStats(t *testing.T) {
+	job := modelMetadataFromItem(completedGLBItem("test-job", "2025-01-01T00:00:00Z", `{"textures":2,"textureSizes":[{"mimeType":"image/png","width":1024,"height":512}]}`))
+
+	assert.Equal(t, 2, job.ModelStats.Textures)
+	assert.Equal(t, 1024, job.ModelStats.TextureSizes[0].Width)
+	assert.Nil(t, modelMetadataFromItem(completedGLBItem("test-job", "2025-01-01T00:00:00Z", "")).ModelStats)
+}
+
+func TestModelMetadataFromItem_DecodesValidationReport(t *testing.T) {
+	item := completedGLBItem("test-job", "2025-01-01T00:00:00Z", "")
+	item["jobStatus"] = &types.AttributeValueMemberS{Value: "completed_with_warnings"}
+	item["validationReport"] = &types.AttributeValueMemberS{Value: `{"numErrors":0,"numWarnings":1,"numInfos":0,"issues":[{"code":"MESH_PRIMITIVE_INCOMPATIBLE_MODE","severity":"warning","message":"too few vertices","pointer":"/meshes/0/primitives/0"}]}`}
+
+	job := modelMetadataFromItem(item)
+
+	assert.Equal(t, 1, job.Validation.NumWarnings)
+	assert.Equal(t, "MESH_PRIMITIVE_INCOMPATIBLE_MODE", job.Validation.Issues[0].Code)
+	assert.Nil(t, modelMetadataFromItem(completedGLBItem("test-job", "2025-01-01T00:00:00Z", "")).Validation)
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/helpers"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+type CreateMultipartUploadRequest struct {
+	FromFileType string `json:"fromFileType"`
+}
+
+type MultipartUploadResponse struct {
+	UploadID string `json:"uploadId"`
+	S3Key    string `json:"s3Key"`
+	// PartSize is a suggestion, every part but the last must be at least 5 MiB
+	PartSize int64 `json:"partSize"`
+}
+
+type MultipartUploadStatusResponse struct {
+	UploadID string            `json:"uploadId"`
+	S3Key    string            `json:"s3Key"`
+	Parts    []UploadedPart    `json:"parts"`
+	URLs     map[string]string `json:"urls,omitempty"`
+}
+
+type UploadedPart struct {
+	PartNumber int32  `json:"partNumber"`
+	ETag       string `json:"eTag"`
+	Size       int64  `json:"size,omitempty"`
+}
+
+type CompleteMultipartUploadRequest struct {
+	Parts []UploadedPart `json:"parts"`
+}
+
+const (
+	// S3 multipart uploads allow part numbers 1 to 10000
+	maxUploadPartNumber = 10000
+	// Part URLs are requested on demand, so they only need to outlive one part
+	uploadPartURLExpiry      = 1 * time.Hour
+	maxPresignedPartsPerCall = 100
+	suggestedUploadPartSize  = 64 * 1024 * 1024
+)
+
+// Error codes S3 returns when the part list does not match what was uploaded
+var invalidPartErrorCodes = []string{"InvalidPart", "InvalidPartOrder", "EntityTooSmall"}
+
+// multipartUploadKey is the source key of a model in the declared input
+// format, blend when none is declared, so the conversion can find it
+func multipartUploadKey(modelID string, fromFileType string) (string, bool) {
+	if fromFileType == "" {
+		fromFileType = "blend"
+	}
+	if _, ok := inputFormat(fromFileType); !ok {
+		return "", false
+	}
+	return sourceObjectKey(modelID, fromFileType), true
+}
+
+// isNoSuchUpload reports whether S3 rejected an unknown, completed or aborted upload id
+func isNoSuchUpload(err error) bool {
+	var noSuchUpload *s3types.NoSuchUpload
+	return errors.As(err, &noSuchUpload)
+}
+
+func parsePartNumbers(value string) ([]int32, error) {
+	var partNumbers []int32
+	for _, field := range strings.Split(value, ",") {
+		partNumber, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || partNumber < 1 || partNumber > maxUploadPartNumber {
+			return nil, fmt.Errorf("invalid part number %q", field)
+		}
+		if !slices.Contains(partNumbers, int32(partNumber)) {
+			partNumbers = append(partNumbers, int32(partNumber))
+		}
+	}
+	if len(partNumbers) > maxPresignedPartsPerCall {
+		return nil, fmt.Errorf("at most %d parts can be requested at once", maxPresignedPartsPerCall)
+	}
+	return partNumbers, nil
+}
+
+func listUploadedParts(ctx context.Context, s3Client S3Client, bucket string, key string, uploadID string) ([]UploadedPart, error) {
+	parts := []UploadedPart{}
+	var partNumberMarker *string
+	for {
+		result, err := s3Client.ListParts(ctx, &s3.ListPartsInput{
+			Bucket:           aws.String(bucket),
+			Key:              aws.String(key),
+			UploadId:         aws.String(uploadID),
+			PartNumberMarker: partNumberMarker,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range result.Parts {
+			parts = append(parts, UploadedPart{
+				PartNumber: aws.ToInt32(part.PartNumber),
+				ETag:       aws.ToString(part.ETag),
+				Size:       aws.ToInt64(part.Size),
+			})
+		}
+		if !aws.ToBool(result.IsTruncated) {
+			return parts, nil
+		}
+		partNumberMarker = result.NextPartNumberMarker
+	}
+}
+
+func validateUploadRequest(request events.APIGatewayV2HTTPRequest, needsUploadID bool) (events.APIGatewayV2HTTPResponse, error) {
+	apiKeyResp, err := helpers.ValidateHttpAPIKey(request)
+	if err != nil {
+		return createErrorResponse(500, "Error validating API key"), err
+	}
+	if apiKeyResp.StatusCode != 0 {
+		return apiKeyResp, nil
+	}
+	if request.PathParameters["id"] == "" {
+		return createErrorResponse(400, "Model id is required"), nil
+	}
+	if needsUploadID && request.PathParameters["uploadId"] == "" {
+		return createErrorResponse(400, "Upload id is required"), nil
+	}
+	return events.APIGatewayV2HTTPResponse{}, nil
+}
+
+/*
+###########################################
+POST /v1/3d-model/{unique-model-id}/uploads
+###########################################
+*/
+
+func HandleCreateUploadRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest, s3Client S3Client) (events.APIGatewayV2HTTPResponse, error) {
+	if resp, err := validateUploadRequest(request, false); resp.StatusCode != 0 {
+		return resp, err
+	}
+
+	var create CreateMultipartUploadRequest
+	if request.Body != "" {
+		if err := json.Unmarshal([]byte(request.Body), &create); err != nil {
+			return createErrorResponse(400, "Invalid request body"), nil
+		}
+	}
+	key, ok := multipartUploadKey(request.PathParameters["id"], create.FromFileType)
+	if !ok {
+		return createErrorResponse(400, unsupportedInputMessage()), nil
+	}
+	result, err := s3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(os.Getenv("model_s3_bucket")),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return createErrorResponse(500, "Failed to start multipart upload"), err
+	}
+
+	return createSuccessResponse(201, MultipartUploadResponse{
+		UploadID: aws.ToString(result.UploadId),
+		S3Key:    key,
+		PartSize: suggestedUploadPartSize,
+	}), nil
+}
+
+/*
+###########################################
+GET /v1/3d-model/{unique-model-id}/uploads/{uploadId}?partNumbers={comma separated numbers}&fromFileType={format}
+###########################################
+*/
+
+// HandleGetUploadRequest lists the parts S3 already has and presigns PUT URLs
+// for the requested part numbers, so an interrupted client can resume by
+// uploading only what is missing
+func HandleGetUploadRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest, s3Client S3Client, presignClient PresignClient) (events.APIGatewayV2HTTPResponse, error) {
+	if resp, err := validateUploadRequest(request, true); resp.StatusCode != 0 {
+		return resp, err
+	}
+
+	var partNumbers []int32
+	if value := request.QueryStringParameters["partNumbers"]; value != "" {
+		var err error
+		partNumbers, err = parsePartNumbers(value)
+		if err != nil {
+			return createErrorResponse(400, fmt.Sprintf("Malformed request - %v", err)), nil
+		}
+	}
+
+	bucket := os.Getenv("model_s3_bucket")
+	uploadID := request.PathParameters["uploadId"]
+	// The upload id only identifies the upload together with its key
+	key, ok := multipartUploadKey(request.PathParameters["id"], request.QueryStringParameters["fromFileType"])
+	if !ok {
+		return createErrorResponse(400, unsupportedInputMessage()), nil
+	}
+
+	parts, err := listUploadedParts(ctx, s3Client, bucket, key, uploadID)
+	if isNoSuchUpload(err) {
+		return createErrorResponse(404, fmt.Sprintf("Upload %s not found", uploadID)), nil
+	}
+	if err != nil {
+		return createErrorResponse(500, "Failed to list uploaded parts"), err
+	}
+
+	response := MultipartUploadStatusResponse{UploadID: uploadID, S3Key: key, Parts: parts}
+	if len(partNumbers) > 0 {
+		response.URLs = make(map[string]string, len(partNumbers))
+	}
+	for _, partNumber := range partNumbers {
+		presignedURL, err := presignClient.PresignUploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(bucket),
+			Key:        aws.String(key),
+			UploadId:   aws.String(uploadID),
+			PartNumber: aws.Int32(partNumber),
+		}, s3.WithPresignExpires(uploadPartURLExpiry))
+		if err != nil {
+			return createErrorResponse(500, "Failed to generate presigned part URL"), err
+		}
+		response.URLs[strconv.Itoa(int(partNumber))] = presignedURL.URL
+	}
+	return createSuccessResponse(200, response), nil
+}
+
+/*
+###########################################
+POST /v1/3d-model/{unique-model-id}/uploads/{uploadId}/complete?fromFileType={format}
+###########################################
+*/
+
+func HandleCompleteUploadRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest, s3Client S3Client) (events.APIGatewayV2HTTPResponse, error) {
+	if resp, err := validateUploadRequest(request, true); resp.StatusCode != 0 {
+		return resp, err
+	}
+
+	var complete CompleteMultipartUploadRequest
+	if request.Body != "" {
+		if err := json.Unmarshal([]byte(request.Body), &complete); err != nil {
+			return createErrorResponse(400, "Invalid request body"), nil
+		}
+	}
+
+	bucket := os.Getenv("model_s3_bucket")
+	uploadID := request.PathParameters["uploadId"]
+	key, ok := multipartUploadKey(request.PathParameters["id"], request.QueryStringParameters["fromFileType"])
+	if !ok {
+		return createErrorResponse(400, unsupportedInputMessage()), nil
+	}
+
+	// Without an explicit part list, every part S3 has received is assembled
+	parts := complete.Parts
+	if len(parts) == 0 {
+		var err error
+		parts, err = listUploadedParts(ctx, s3Client, bucket, key, uploadID)
+		if isNoSuchUpload(err) {
+			return createErrorResponse(404, fmt.Sprintf("Upload %s not found", uploadID)), nil
+		}
+		if err != nil {
+			return createErrorResponse(500, "Failed to list uploaded parts"), err
+		}
+	}
+	if len(parts) == 0 {
+		return createErrorResponse(400, "Upload has no parts"), nil
+	}
+
+	slices.SortFunc(parts, func(a, b UploadedPart) int { return int(a.PartNumber - b.PartNumber) })
+	completedParts := make([]s3types.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		if part.PartNumber < 1 || part.PartNumber > maxUploadPartNumber || part.ETag == "" {
+			return createErrorResponse(400, "Every part needs a partNumber between 1 and 10000 and an eTag"), nil
+		}
+		completedParts = append(completedParts, s3types.CompletedPart{
+			PartNumber: aws.Int32(part.PartNumber),
+			ETag:       aws.String(part.ETag),
+		})
+	}
+
+	_, err := s3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: completedParts},
+	})
+	if isNoSuchUpload(err) {
+		return createErrorResponse(404, fmt.Sprintf("Upload %s not found", uploadID)), nil
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && slices.Contains(invalidPartErrorCodes, apiErr.ErrorCode()) {
+		return createErrorResponse(400, fmt.Sprintf("Failed to complete multipart upload: %s", apiErr.ErrorMessage())), nil
+	}
+	if err != nil {
+		return createErrorResponse(500, "Failed to complete multipart upload"), err
+	}
+
+	return createSuccessResponse(200, SuccessPutResponse{Message: fmt.Sprintf("Upload %s completed as %s", uploadID, key)}), nil
+}
+
+/*
+###########################################
+DELETE /v1/3d-model/{unique-model-id}/uploads/{uploadId}?fromFileType={format}
+###########################################
+*/
+
+func HandleAbortUploadRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest, s3Client S3Client) (events.APIGatewayV2HTTPResponse, error) {
+	if resp, err := validateUploadRequest(request, true); resp.StatusCode != 0 {
+		return resp, err
+	}
+
+	key, ok := multipartUploadKey(request.PathParameters["id"], request.QueryStringParameters["fromFileType"])
+	if !ok {
+		return createErrorResponse(400, unsupportedInputMessage()), nil
+	}
+	uploadID := request.PathParameters["uploadId"]
+	_, err := s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(os.Getenv("model_s3_bucket")),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	if isNoSuchUpload(err) {
+		return createErrorResponse(404, fmt.Sprintf("Upload %s not found", uploadID)), nil
+	}
+	if err != nil {
+		return createErrorResponse(500, "Failed to abort multipart upload"), err
+	}
+
+	return createSuccessResponse(200, SuccessPutResponse{Message: fmt.Sprintf("Upload %s aborted", uploadID)}), nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func newUploadRequest(uploadID string, body string) events.APIGatewayV2HTTPRequest {
+	pathParameters := map[string]string{"id": "test-model-id"}
+	if uploadID != "" {
+		pathParameters["uploadId"] = uploadID
+	}
+	return events.APIGatewayV2HTTPRequest{
+		Headers:        map[string]string{"x-api-key": "test-api-key"},
+		PathParameters: pathParameters,
+		Body:           body,
+	}
+}
+
+func uploadedPart(partNumber int32, eTag string) s3types.Part {
+	return s3types.Part{PartNumber: aws.Int32(partNumber), ETag: aws.String(eTag), Size: aws.Int64(5 * 1024 * 1024)}
+}
+
+func TestHandleCreateUploadRequest_StartsMultipartUpload(t *testing.T) {
+	setupTestEnv(t)
+
+	mockS3 := &mockS3Client{}
+	resp, err := HandleCreateUploadRequest(context.Background(), newUploadRequest("", ""), mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 201, resp.StatusCode)
+
+	var response MultipartUploadResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+	assert.Equal(t, "upload-1", response.UploadID)
+	assert.Equal(t, "blend/test-model-id.blend", response.S3Key)
+	assert.Contains(t, mockS3.uploads, "upload-1")
+}
+
+func TestHandleCreateUploadRequest_UsesTheDeclaredFormat(t *testing.T) {
+	setupTestEnv(t)
+
+	mockS3 := &mockS3Client{}
+	resp, err := HandleCreateUploadRequest(context.Background(), newUploadRequest("", `{"fromFileType": "fbx"}`), mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 201, resp.StatusCode)
+
+	var response MultipartUploadResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+	assert.Equal(t, "fbx/test-model-id.fbx", response.S3Key)
+
+	resp, err = HandleCreateUploadRequest(context.Background(), newUploadRequest("", `{"fromFileType": "docx"}`), mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Len(t, mockS3.uploads, 1)
+}
+
+func TestHandleGetUploadRequest_ListsPartsAndPresignsRequested(t *testing.T) {
+	setupTestEnv(t)
+
+	mockS3 := &mockS3Client{uploads: map[string][]s3types.Part{
+		"upload-1": {uploadedPart(1, `"etag-1"`)},
+	}}
+	req := newUploadRequest("upload-1", "")
+	req.QueryStringParameters = map[string]string{"partNumbers": "2,3"}
+
+	resp, err := HandleGetUploadRequest(context.Background(), req, mockS3, newTestPresignClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var response MultipartUploadStatusResponse
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &response))
+	assert.Equal(t, []UploadedPart{{PartNumber: 1, ETag: `"etag-1"`, Size: 5 * 1024 * 1024}}, response.Parts)
+	assert.Len(t, response.URLs, 2)
+	assert.True(t, strings.Contains(response.URLs["2"], "partNumber=2"))
+	assert.True(t, strings.Contains(response.URLs["3"], "uploadId=upload-1"))
+}
+
+func TestHandleGetUploadRequest_InvalidPartNumber_Returns400(t *testing.T) {
+	setupTestEnv(t)
+
+	req := newUploadRequest("upload-1", "")
+	req.QueryStringParameters = map[string]string{"partNumbers": "0"}
+
+	resp, err := HandleGetUploadRequest(context.Background(), req, &mockS3Client{}, newTestPresignClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestHandleGetUploadRequest_UnknownUpload_Returns404(t *testing.T) {
+	setupTestEnv(t)
+
+	resp, err := HandleGetUploadRequest(context.Background(), newUploadRequest("missing", ""), &mockS3Client{}, newTestPresignClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+}
+
+func TestHandleCompleteUploadRequest_AssemblesUploadedParts(t *testing.T) {
+	setupTestEnv(t)
+
+	mockS3 := &mockS3Client{uploads: map[string][]s3types.Part{
+		"upload-1": {uploadedPart(2, `"etag-2"`), uploadedPart(1, `"etag-1"`)},
+	}}
+
+	resp, err := HandleCompleteUploadRequest(context.Background(), newUploadRequest("upload-1", ""), mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	assert.Len(t, mockS3.completeMultipartUploadInputs, 1)
+	parts := mockS3.completeMultipartUploadInputs[0].MultipartUpload.Parts
+	assert.Equal(t, int32(1), *parts[0].PartNumber)
+	assert.Equal(t, `"etag-2"`, *parts[1].ETag)
+}
+
+func TestHandleCompleteUploadRequest_UsesTheDeclaredFormat(t *testing.T) {
+	setupTestEnv(t)
+
+	mockS3 := &mockS3Client{uploads: map[string][]s3types.Part{"upload-1": {uploadedPart(1, `"etag-1"`)}}}
+	req := newUploadRequest("upload-1", "")
+	req.QueryStringParameters = map[string]string{"fromFileType": "stl"}
+
+	resp, err := HandleCompleteUploadRequest(context.Background(), req, mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "stl/test-model-id.stl", *mockS3.completeMultipartUploadInputs[0].Key)
+}
+
+func TestHandleCompleteUploadRequest_InvalidPart_Returns400(t *testing.T) {
+	setupTestEnv(t)
+
+	mockS3 := &mockS3Client{
+		uploads:                    map[string][]s3types.Part{"upload-1": nil},
+		completeMultipartUploadErr: &smithy.GenericAPIError{Code: "InvalidPart", Message: "One or more of the specified parts could not be found"},
+	}
+	body := `{"parts":[{"partNumber":1,"eTag":"\"wrong\""}]}`
+
+	resp, err := HandleCompleteUploadRequest(context.Background(), newUploadRequest("upload-1", body), mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Contains(t, resp.Body, "could not be found")
+}
+
+func TestHandleAbortUploadRequest_AbortsUpload(t *testing.T) {
+	setupTestEnv(t)
+
+	mockS3 := &mockS3Client{uploads: map[string][]s3types.Part{"upload-1": nil}}
+
+	resp, err := HandleAbortUploadRequest(context.Background(), newUploadRequest("upload-1", ""), mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.NotContains(t, mockS3.uploads, "upload-1")
+
+	resp, err = HandleAbortUploadRequest(context.Background(), newUploadRequest("upload-1", ""), mockS3)
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+}
@@ -3,44 +3,507 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/gltf"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/mesh"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/quality"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi"
+	apitypes "github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi/types"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 type NotificationMessage struct {
-	ConnectionID string `json:"connectionId"`
-	JobType      string `json:"jobType"`
-	JobID        string `json:"jobId"`
-	JobStatus    string `json:"jobStatus"`
-	FromFileType string `json:"fromFileType"`
-	ToFileType   string `json:"toFileType"`
-	ModelID      string `json:"modelId"`
-	S3Key        string `json:"s3Key"`
-	NewS3Key     string `json:"newS3Key"`
-	Error        string `json:"error"`
+	ConnectionID string     `json:"connectionId"`
+	JobType      string     `json:"jobType"`
+	JobID        string     `json:"jobId"`
+	JobStatus    string     `json:"jobStatus"`
+	FromFileType string     `json:"fromFileType"`
+	ToFileType   string     `json:"toFileType"`
+	ModelID      string     `json:"modelId"`
+	S3Key        string     `json:"s3Key"`
+	NewS3Key     string     `json:"newS3Key"`
+	Error        string     `json:"error"`
+	Artifacts    []Artifact `json:"artifacts,omitempty"`
+	// Attempt is echoed back from the job message, jobs that were never
+	// retried leave it empty
+	Attempt string `json:"attempt,omitempty"`
+	// MeshStats describe the output of converters that write a single mesh
+	MeshStats *mesh.Stats `json:"meshStats,omitempty"`
+	// ModelStats and Validation are filled in here for glTF outputs, workers
+	// never send them
+	ModelStats *gltf.Stats  `json:"modelStats,omitempty"`
+	Validation *gltf.Report `json:"validation,omitempty"`
+	// Quality is the outcome of the tenant's quality budget, for jobs that
+	// were submitted with one
+	Quality *quality.Report `json:"quality,omitempty"`
 }
 
+// Artifact is one file produced by a job. Multi-file outputs such as glTF with
+// external buffers or OBJ with its .mtl list every file, with Path relative to
+// the main output file.
+type Artifact struct {
+	Path   string `json:"path"`
+	S3Key  string `json:"s3Key"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// SubmissionNotification is relayed once every job of a multi-target
+// submission has finished
+type SubmissionNotification struct {
+	Type         string          `json:"type"`
+	SubmissionID string          `json:"submissionId"`
+	ConnectionID string          `json:"connectionId"`
+	JobStatus    string          `json:"jobStatus"`
+	Jobs         []SubmissionJob `json:"jobs"`
+}
+
+type SubmissionJob struct {
+	JobID      string `json:"jobId"`
+	ToFileType string `json:"toFileType"`
+	JobStatus  string `json:"jobStatus"`
+	NewS3Key   string `json:"newS3Key,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+var terminalJobStatuses = []string{"completed", "completed_with_warnings", "failed", "cancelled"}
+
+// maxInspectedSize caps the glTF outputs that are validated and analyzed,
+// larger ones complete with a skipped validation report
+var maxInspectedSize = 256 << 20
+
 type DynamoDBClient interface {
 	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
 	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
 	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
 }
 
+type S3Client interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
 type APIGatewayClient interface {
 	PostToConnection(ctx context.Context, params *apigatewaymanagementapi.PostToConnectionInput, optFns ...func(*apigatewaymanagementapi.Options)) (*apigatewaymanagementapi.PostToConnectionOutput, error)
 }
 
-func HandlerWithClients(ctx context.Context, sqsEvent events.SQSEvent, dynamoClient DynamoDBClient, apiClient APIGatewayClient) error {
+func artifactsAttribute(artifacts []Artifact) types.AttributeValue {
+	list := make([]types.AttributeValue, 0, len(artifacts))
+	for _, artifact := range artifacts {
+		list = append(list, &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"path":   &types.AttributeValueMemberS{Value: artifact.Path},
+			"s3Key":  &types.AttributeValueMemberS{Value: artifact.S3Key},
+			"size":   &types.AttributeValueMemberN{Value: strconv.FormatInt(artifact.Size, 10)},
+			"sha256": &types.AttributeValueMemberS{Value: artifact.SHA256},
+		}})
+	}
+	return &types.AttributeValueMemberL{Value: list}
+}
+
+func meshStatsAttribute(stats mesh.Stats) types.AttributeValue {
+	bounds := func(corner [3]float64) types.AttributeValue {
+		list := make([]types.AttributeValue, 0, len(corner))
+		for _, value := range corner {
+			list = append(list, &types.AttributeValueMemberN{Value: strconv.FormatFloat(value, 'g', -1, 64)})
+		}
+		return &types.AttributeValueMemberL{Value: list}
+	}
+	item := map[string]types.AttributeValue{
+		"vertices":  &types.AttributeValueMemberN{Value: strconv.Itoa(stats.Vertices)},
+		"triangles": &types.AttributeValueMemberN{Value: strconv.Itoa(stats.Triangles)},
+		"min":       bounds(stats.Min),
+		"max":       bounds(stats.Max),
+	}
+	if stats.Unit != "" {
+		item["unit"] = &types.AttributeValueMemberS{Value: stats.Unit}
+	}
+	return &types.AttributeValueMemberM{Value: item}
+}
+
+func readObject(ctx context.Context, s3Client S3Client, key string) ([]byte, error) {
+	result, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(os.Getenv("model_s3_bucket")),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer result.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(result.Body, int64(maxInspectedSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxInspectedSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", key, maxInspectedSize)
+	}
+	return data, nil
+}
+
+// inspectedOutput is what inspectOutput found in a glTF output. Model and
+// Stats are only set when the output has no validation errors.
+type inspectedOutput struct {
+	Report *gltf.Report
+	Model  *gltf.Model
+	Stats  *gltf.Stats
+}
+
+// inspectOutput validates the glTF a completed job wrote and, when it has no
+// errors, reads it and computes its stats. An output that cannot be read gets
+// a skipped report. Jobs with any other output return nil.
+func inspectOutput(ctx context.Context, s3Client S3Client, notification NotificationMessage) (*inspectedOutput, error) {
+	extension := strings.ToLower(path.Ext(notification.NewS3Key))
+	if notification.JobStatus != "completed" || (extension != ".glb" && extension != ".gltf") {
+		return nil, nil
+	}
+	data, err := readObject(ctx, s3Client, notification.NewS3Key)
+	if err != nil {
+		return &inspectedOutput{Report: gltf.Skipped(err.Error())}, err
+	}
+
+	// The buffers and images of a .gltf are artifacts with paths relative to it
+	artifactKeys := map[string]string{}
+	for _, artifact := range notification.Artifacts {
+		artifactKeys[artifact.Path] = artifact.S3Key
+	}
+	files := map[string][]byte{}
+	resolve := func(uri string) ([]byte, error) {
+		if content, ok := files[uri]; ok {
+			return content, nil
+		}
+		key, ok := artifactKeys[uri]
+		if !ok {
+			return nil, fmt.Errorf("%s is not an artifact of the job", uri)
+		}
+		content, err := readObject(ctx, s3Client, key)
+		if err != nil {
+			return nil, err
+		}
+		files[uri] = content
+		return content, nil
+	}
+
+	output := &inspectedOutput{Report: gltf.Validate(data, resolve)}
+	if output.Report.NumErrors > 0 {
+		return output, nil
+	}
+	model, err := gltf.Read(data, resolve)
+	if err != nil {
+		return output, err
+	}
+	stats, err := model.Stats()
+	if err != nil {
+		return output, err
+	}
+	stats.ByteSize += int64(len(data))
+	output.Model, output.Stats = model, stats
+	return output, nil
+}
+
+// applyValidation attaches the report to the notification, failing the job
+// when its output has errors and flagging it when it has warnings
+func applyValidation(notification *NotificationMessage, report *gltf.Report) {
+	notification.Validation = report
+	switch {
+	case report.NumErrors > 0:
+		first := report.Issues[0]
+		notification.JobStatus = "failed"
+		notification.Error = fmt.Sprintf("The %s output failed glTF validation with %d errors, the first is %s at %s: %s", notification.ToFileType, report.NumErrors, first.Code, first.Pointer, first.Message)
+	case report.NumWarnings > 0:
+		notification.JobStatus = "completed_with_warnings"
+	}
+}
+
+// applyQuality checks a completed job against the rule set it was submitted
+// with: its glTF output when there is one, and whatever the .blend preflight
+// found in its source. Failing rules fail the job and warnings flag it.
+func applyQuality(notification *NotificationMessage, item map[string]types.AttributeValue, output *inspectedOutput) {
+	encodedRules := stringAttribute(item, "qualityRules")
+	if encodedRules == "" || (notification.JobStatus != "completed" && notification.JobStatus != "completed_with_warnings") {
+		return
+	}
+	var ruleSet quality.RuleSet
+	if err := json.Unmarshal([]byte(encodedRules), &ruleSet); err != nil {
+		log.Printf("Invalid quality rules on job %s: %v", notification.JobID, err)
+		return
+	}
+	var sourceFindings []quality.Finding
+	if encoded := stringAttribute(item, "sourceQuality"); encoded != "" {
+		if err := json.Unmarshal([]byte(encoded), &sourceFindings); err != nil {
+			log.Printf("Invalid source quality findings on job %s: %v", notification.JobID, err)
+		}
+	}
+
+	var report *quality.Report
+	switch {
+	case output != nil && output.Model != nil:
+		report = quality.NewReport(ruleSet, sourceFindings, ruleSet.CheckModel(output.Model, output.Stats))
+	case item["sourceStats"] != nil:
+		// Only a .blend source was inspected
+		report = quality.NewReport(ruleSet, sourceFindings)
+		report.SkipAllBut(quality.SourceRules...)
+	default:
+		return
+	}
+
+	notification.Quality = report
+	switch report.Result {
+	case quality.ResultFail:
+		failed := 0
+		var first quality.Finding
+		for _, finding := range report.Findings {
+			if finding.Result == quality.ResultFail {
+				if failed == 0 {
+					first = finding
+				}
+				failed++
+			}
+		}
+		notification.JobStatus = "failed"
+		notification.Error = fmt.Sprintf("The %s output broke %d quality rules, the first is %s: %s", notification.ToFileType, failed, first.Rule, first.Message)
+	case quality.ResultWarn:
+		notification.JobStatus = "completed_with_warnings"
+	}
+}
+
+func jsonAttribute(value any) types.AttributeValue {
+	encoded, _ := json.Marshal(value)
+	return &types.AttributeValueMemberS{Value: string(encoded)}
+}
+
+// existingJobItem returns the job history row a notification belongs to and
+// its jobId. Jobs submitted through POST /3d-model already have a pending row
+// under their own jobId; older jobs fall back to the row sharing the same
+// modelId, jobType, fromFileType and toFileType.
+func existingJobItem(ctx context.Context, dynamoClient DynamoDBClient, jobHistoryTable string, notification NotificationMessage) (map[string]types.AttributeValue, string, error) {
+	getResult, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: &jobHistoryTable,
+		Key: map[string]types.AttributeValue{
+			"jobId": &types.AttributeValueMemberS{Value: notification.JobID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	item := map[string]types.AttributeValue{}
+	existingJobId := notification.JobID
+	if getResult.Item != nil {
+		item = getResult.Item
+	} else {
+		// Check for existing record with same modelId, jobType, fromFileType, and toFileType
+		queryInput := &dynamodb.QueryInput{
+			TableName:              &jobHistoryTable,
+			IndexName:              aws.String("ModelJobTypeIndex"),
+			KeyConditionExpression: aws.String("modelId = :modelId AND jobType = :jobType"),
+			FilterExpression:       aws.String("fromFileType = :fromFileType AND toFileType = :toFileType"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":modelId":      &types.AttributeValueMemberS{Value: notification.ModelID},
+				":jobType":      &types.AttributeValueMemberS{Value: notification.JobType},
+				":fromFileType": &types.AttributeValueMemberS{Value: notification.FromFileType},
+				":toFileType":   &types.AttributeValueMemberS{Value: notification.ToFileType},
+			},
+		}
+
+		queryResult, err := dynamoClient.Query(ctx, queryInput)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, candidate := range queryResult.Items {
+			// A pending row past its expiry was never queued, TTL just has not
+			// deleted it yet
+			if pendingRowExpired(candidate, time.Now()) {
+				continue
+			}
+			// Found existing record, use its jobId
+			existingJobId = candidate["jobId"].(*types.AttributeValueMemberS).Value
+			break
+		}
+	}
+	return item, existingJobId, nil
+}
+
+// pendingRowExpired tells whether a pending row outlived the expiry it was
+// written with
+func pendingRowExpired(item map[string]types.AttributeValue, now time.Time) bool {
+	expiresAt, ok := item["expiresAt"].(*types.AttributeValueMemberN)
+	if stringAttribute(item, "jobStatus") != "pending" || !ok {
+		return false
+	}
+	unix, err := strconv.ParseInt(expiresAt.Value, 10, 64)
+	return err == nil && unix <= now.Unix()
+}
+
+// jobHistoryItem fills the row the notification is saved as in
+func jobHistoryItem(item map[string]types.AttributeValue, existingJobId string, notification NotificationMessage) map[string]types.AttributeValue {
+	fields := map[string]string{
+		"jobId":        existingJobId,
+		"connectionId": notification.ConnectionID,
+		"jobType":      notification.JobType,
+		"jobStatus":    notification.JobStatus,
+		"fromFileType": notification.FromFileType,
+		"toFileType":   notification.ToFileType,
+		"modelId":      notification.ModelID,
+		"s3Key":        notification.S3Key,
+		"newS3Key":     notification.NewS3Key,
+		"error":        notification.Error,
+		"timestamp":    time.Now().UTC().Format(time.RFC3339),
+	}
+	for name, value := range fields {
+		item[name] = &types.AttributeValueMemberS{Value: value}
+	}
+	if len(notification.Artifacts) > 0 {
+		item["artifacts"] = artifactsAttribute(notification.Artifacts)
+	}
+	if notification.MeshStats != nil {
+		item["meshStats"] = meshStatsAttribute(*notification.MeshStats)
+	}
+	// Stats and reports are stored as JSON like the options of a job
+	if notification.ModelStats != nil {
+		item["modelStats"] = jsonAttribute(notification.ModelStats)
+	}
+	if notification.Validation != nil {
+		item["validationReport"] = jsonAttribute(notification.Validation)
+	}
+	if notification.Quality != nil {
+		item["qualityReport"] = jsonAttribute(notification.Quality)
+	}
+	// The worker reported back, so the pending row's expiry no longer applies
+	delete(item, "expiresAt")
+	return item
+}
+
+func stringAttribute(item map[string]types.AttributeValue, name string) string {
+	if value, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return value.Value
+	}
+	return ""
+}
+
+// completedSubmission returns the submission notification to relay when item
+// is the last job of its multi-target submission to finish. Siblings are read
+// with strongly consistent reads, and the conditional write on the first
+// sibling's row makes sure only one of several racing jobs relays it.
+func completedSubmission(ctx context.Context, dynamoClient DynamoDBClient, jobHistoryTable string, item map[string]types.AttributeValue) (*SubmissionNotification, error) {
+	submissionID := stringAttribute(item, "submissionId")
+	siblingIDs, ok := item["submissionJobIds"].(*types.AttributeValueMemberL)
+	if submissionID == "" || !ok || len(siblingIDs.Value) == 0 {
+		return nil, nil
+	}
+
+	submission := &SubmissionNotification{
+		Type:         "submissionCompleted",
+		SubmissionID: submissionID,
+		ConnectionID: stringAttribute(item, "connectionId"),
+	}
+	completed := 0
+	for _, siblingID := range siblingIDs.Value {
+		jobID := siblingID.(*types.AttributeValueMemberS).Value
+		sibling := item
+		if jobID != stringAttribute(item, "jobId") {
+			getResult, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+				TableName: &jobHistoryTable,
+				Key: map[string]types.AttributeValue{
+					"jobId": &types.AttributeValueMemberS{Value: jobID},
+				},
+				ConsistentRead: aws.Bool(true),
+			})
+			if err != nil {
+				return nil, err
+			}
+			if getResult.Item == nil {
+				continue
+			}
+			sibling = getResult.Item
+		}
+
+		jobStatus := stringAttribute(sibling, "jobStatus")
+		if !slices.Contains(terminalJobStatuses, jobStatus) {
+			return nil, nil
+		}
+		if jobStatus == "completed" || jobStatus == "completed_with_warnings" {
+			completed++
+		}
+		submission.Jobs = append(submission.Jobs, SubmissionJob{
+			JobID:      jobID,
+			ToFileType: stringAttribute(sibling, "toFileType"),
+			JobStatus:  jobStatus,
+			NewS3Key:   stringAttribute(sibling, "newS3Key"),
+			Error:      stringAttribute(sibling, "error"),
+		})
+	}
+
+	switch completed {
+	case len(submission.Jobs):
+		submission.JobStatus = "completed"
+	case 0:
+		submission.JobStatus = "failed"
+	default:
+		submission.JobStatus = "partially_completed"
+	}
+
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: &jobHistoryTable,
+		Key: map[string]types.AttributeValue{
+			"jobId": siblingIDs.Value[0],
+		},
+		UpdateExpression:    aws.String("SET submissionNotifiedAt = :now"),
+		ConditionExpression: aws.String("attribute_exists(jobId) AND attribute_not_exists(submissionNotifiedAt)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return submission, nil
+}
+
+// connectionGone reports whether the client of a connection has disconnected,
+// which no redelivery can fix
+func connectionGone(err error) bool {
+	var gone *apitypes.GoneException
+	return errors.As(err, &gone)
+}
+
+// releaseSubmission clears the marker completedSubmission set when relaying the
+// submission failed, so a redelivered notification relays it again
+func releaseSubmission(ctx context.Context, dynamoClient DynamoDBClient, jobHistoryTable string, item map[string]types.AttributeValue) {
+	siblingIDs := item["submissionJobIds"].(*types.AttributeValueMemberL)
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: &jobHistoryTable,
+		Key: map[string]types.AttributeValue{
+			"jobId": siblingIDs.Value[0],
+		},
+		UpdateExpression:    aws.String("REMOVE submissionNotifiedAt"),
+		ConditionExpression: aws.String("attribute_exists(jobId)"),
+	})
+	if err != nil {
+		log.Printf("Error releasing submission %s, it will not be relayed again: %v", stringAttribute(item, "submissionId"), err)
+	}
+}
+
+func HandlerWithClients(ctx context.Context, sqsEvent events.SQSEvent, dynamoClient DynamoDBClient, apiClient APIGatewayClient, s3Client S3Client) error {
 	connectionsTable := os.Getenv("connections_table")
 	jobHistoryTable := os.Getenv("job_history_table")
 	websocketEndpoint := os.Getenv("websocket_api_endpoint")
@@ -49,6 +512,7 @@ func HandlerWithClients(ctx context.Context, sqsEvent events.SQSEvent, dynamoCli
 	log.Printf("notificationsTable: '%s'", jobHistoryTable)
 	log.Printf("websocket_api_endpoint: '%s'", websocketEndpoint)
 
+	var relayErr error
 	for _, record := range sqsEvent.Records {
 		var notification NotificationMessage
 		if err := json.Unmarshal([]byte(record.Body), &notification); err != nil {
@@ -61,86 +525,128 @@ func HandlerWithClients(ctx context.Context, sqsEvent events.SQSEvent, dynamoCli
 			continue
 		}
 
-		getInput := &dynamodb.GetItemInput{
-			TableName: &connectionsTable,
-			Key: map[string]types.AttributeValue{
-				"connectionId": &types.AttributeValueMemberS{Value: notification.ConnectionID},
-			},
-		}
-		getResult, err := dynamoClient.GetItem(ctx, getInput)
+		item, existingJobId, err := existingJobItem(ctx, dynamoClient, jobHistoryTable, notification)
 		if err != nil {
-			log.Printf("Error getting connectionId %s: %v", notification.ConnectionID, err)
+			log.Printf("Error looking up job %s: %v", notification.JobID, err)
 			continue
 		}
-		if getResult.Item == nil {
-			log.Printf("connectionId %s not found in DynamoDB, skipping.", notification.ConnectionID)
-			continue
+
+		// The output is checked before the job is saved, so a broken glTF or
+		// one over its quality budget never shows as completed. Outputs that
+		// cannot be read keep the reported status.
+		body := []byte(record.Body)
+		output, err := inspectOutput(ctx, s3Client, notification)
+		if err != nil {
+			log.Printf("Error inspecting output of job %s: %v", notification.JobID, err)
+		}
+		if output != nil {
+			applyValidation(&notification, output.Report)
+			notification.ModelStats = output.Stats
+		}
+		applyQuality(&notification, item, output)
+		if output != nil || notification.Quality != nil {
+			body, _ = json.Marshal(notification)
 		}
+		item = jobHistoryItem(item, existingJobId, notification)
 
-		// Check for existing record with same modelId, jobType, fromFileType, and toFileType
-		queryInput := &dynamodb.QueryInput{
-			TableName:              &jobHistoryTable,
-			IndexName:              aws.String("ModelJobTypeIndex"),
-			KeyConditionExpression: aws.String("modelId = :modelId AND jobType = :jobType"),
-			FilterExpression:       aws.String("fromFileType = :fromFileType AND toFileType = :toFileType"),
+		// A job cancelled through POST /jobs/{jobId}/cancel keeps its status, and
+		// a job retried through POST /jobs/{jobId}/retry only accepts results of
+		// its current attempt, even if either happened after the lookup above
+		attempt := notification.Attempt
+		if attempt == "" {
+			attempt = "1"
+		}
+		putInput := &dynamodb.PutItemInput{
+			TableName:           &jobHistoryTable,
+			Item:                item,
+			ConditionExpression: aws.String("(attribute_not_exists(jobId) OR jobStatus <> :cancelled) AND (attribute_not_exists(attempts) OR attempts = :attempt)"),
 			ExpressionAttributeValues: map[string]types.AttributeValue{
-				":modelId":      &types.AttributeValueMemberS{Value: notification.ModelID},
-				":jobType":      &types.AttributeValueMemberS{Value: notification.JobType},
-				":fromFileType": &types.AttributeValueMemberS{Value: notification.FromFileType},
-				":toFileType":   &types.AttributeValueMemberS{Value: notification.ToFileType},
+				":cancelled": &types.AttributeValueMemberS{Value: "cancelled"},
+				":attempt":   &types.AttributeValueMemberN{Value: attempt},
 			},
 		}
 
-		queryResult, err := dynamoClient.Query(ctx, queryInput)
+		_, err = dynamoClient.PutItem(ctx, putInput)
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			log.Printf("Job %s was cancelled or retried, discarding the %s result of attempt %s", existingJobId, notification.JobStatus, attempt)
+			continue
+		}
 		if err != nil {
-			log.Printf("Error querying for existing record: %v", err)
+			log.Printf("Error saving notification to DynamoDB: %v", err)
 			continue
 		}
 
-		var existingJobId string
-		if len(queryResult.Items) > 0 {
-			// Found existing record, use its jobId
-			existingJobId = queryResult.Items[0]["jobId"].(*types.AttributeValueMemberS).Value
-		} else {
-			// No existing record, use the new jobId
-			existingJobId = notification.JobID
+		submission, err := completedSubmission(ctx, dynamoClient, jobHistoryTable, item)
+		if err != nil {
+			log.Printf("Error checking submission of job %s: %v", existingJobId, err)
+		}
+		// A submission that could not be relayed is released and the message
+		// is failed, so SQS redelivers it and the submission is relayed then
+		relayFailed := func(err error) {
+			if submission != nil {
+				releaseSubmission(ctx, dynamoClient, jobHistoryTable, item)
+				relayErr = errors.Join(relayErr, fmt.Errorf("relaying submission %s: %w", submission.SubmissionID, err))
+			}
 		}
 
-		putInput := &dynamodb.PutItemInput{
-			TableName: &jobHistoryTable,
-			Item: map[string]types.AttributeValue{
-				"jobId":        &types.AttributeValueMemberS{Value: existingJobId},
+		// The job result is persisted above whether or not the client is still
+		// connected, so it can be fetched later through GET /jobs/{jobId}
+		getInput := &dynamodb.GetItemInput{
+			TableName: &connectionsTable,
+			Key: map[string]types.AttributeValue{
 				"connectionId": &types.AttributeValueMemberS{Value: notification.ConnectionID},
-				"jobType":      &types.AttributeValueMemberS{Value: notification.JobType},
-				"jobStatus":    &types.AttributeValueMemberS{Value: notification.JobStatus},
-				"fromFileType": &types.AttributeValueMemberS{Value: notification.FromFileType},
-				"toFileType":   &types.AttributeValueMemberS{Value: notification.ToFileType},
-				"modelId":      &types.AttributeValueMemberS{Value: notification.ModelID},
-				"s3Key":        &types.AttributeValueMemberS{Value: notification.S3Key},
-				"newS3Key":     &types.AttributeValueMemberS{Value: notification.NewS3Key},
-				"error":        &types.AttributeValueMemberS{Value: notification.Error},
-				"timestamp":    &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
 			},
 		}
-
-		_, err = dynamoClient.PutItem(ctx, putInput)
+		getResult, err := dynamoClient.GetItem(ctx, getInput)
 		if err != nil {
-			log.Printf("Error saving notification to DynamoDB: %v", err)
+			log.Printf("Error getting connectionId %s: %v", notification.ConnectionID, err)
+			relayFailed(err)
+			continue
+		}
+		if getResult.Item == nil {
+			log.Printf("connectionId %s not found in DynamoDB, job %s saved without relaying.", notification.ConnectionID, existingJobId)
+			if submission != nil {
+				releaseSubmission(ctx, dynamoClient, jobHistoryTable, item)
+			}
 			continue
 		}
 
 		_, err = apiClient.PostToConnection(ctx, &apigatewaymanagementapi.PostToConnectionInput{
 			ConnectionId: &notification.ConnectionID,
-			Data:         []byte(record.Body),
+			Data:         body,
 		})
+		if connectionGone(err) {
+			// A stale row of a client that disconnected without $disconnect
+			log.Printf("connectionId %s is gone, job %s saved without relaying.", notification.ConnectionID, existingJobId)
+			if submission != nil {
+				releaseSubmission(ctx, dynamoClient, jobHistoryTable, item)
+			}
+			continue
+		}
 		if err != nil {
 			log.Printf("Error sending message to connection %s: %v", notification.ConnectionID, err)
+			relayFailed(err)
 			continue
 		}
+		if submission != nil {
+			submissionBody, _ := json.Marshal(submission)
+			_, err = apiClient.PostToConnection(ctx, &apigatewaymanagementapi.PostToConnectionInput{
+				ConnectionId: &notification.ConnectionID,
+				Data:         submissionBody,
+			})
+			if connectionGone(err) {
+				log.Printf("connectionId %s is gone, submission %s not relayed.", notification.ConnectionID, submission.SubmissionID)
+				releaseSubmission(ctx, dynamoClient, jobHistoryTable, item)
+			} else if err != nil {
+				log.Printf("Error sending submission %s to connection %s: %v", submission.SubmissionID, notification.ConnectionID, err)
+				relayFailed(err)
+			}
+		}
 		log.Printf("Notification relayed to connectionId %s", notification.ConnectionID)
 	}
 
-	return nil
+	return relayErr
 }
 
 func handler(ctx context.Context, sqsEvent events.SQSEvent) error {
@@ -155,7 +661,7 @@ func handler(ctx context.Context, sqsEvent events.SQSEvent) error {
 	apiClient := apigatewaymanagementapi.NewFromConfig(cfg, func(o *apigatewaymanagementapi.Options) {
 		o.BaseEndpoint = &apiEndpoint
 	})
-	return HandlerWithClients(ctx, sqsEvent, dynamoClient, apiClient)
+	return HandlerWithClients(ctx, sqsEvent, dynamoClient, apiClient, s3.NewFromConfig(cfg))
 }
 
 func main() {
@@ -1,15 +1,27 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"encoding/json"
+	"fmt"
+	"io"
+	"math"
 	"os"
+	"strconv"
 	"testing"
+	"time"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/gltf"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/mesh"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/quality"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi"
+	apitypes "github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi/types"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,6 +30,12 @@ type mockDynamoDBClient struct {
 	getItemOutput *dynamodb.GetItemOutput
 	getItemErr    error
 
+	jobItemOutput *dynamodb.GetItemOutput
+	jobItems      map[string]map[string]types.AttributeValue
+
+	updateItemInputs []*dynamodb.UpdateItemInput
+	updateItemErr    error
+
 	putItemInput  *dynamodb.PutItemInput
 	putItemOutput *dynamodb.PutItemOutput
 	putItemErr    error
@@ -27,7 +45,18 @@ type mockDynamoDBClient struct {
 	queryErr    error
 }
 
+// GetItem answers job history lookups with jobItemOutput and connection
+// lookups with getItemOutput
 func (m *mockDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if *params.TableName == os.Getenv("job_history_table") {
+		if m.jobItems != nil {
+			return &dynamodb.GetItemOutput{Item: m.jobItems[params.Key["jobId"].(*types.AttributeValueMemberS).Value]}, nil
+		}
+		if m.jobItemOutput == nil {
+			return &dynamodb.GetItemOutput{}, nil
+		}
+		return m.jobItemOutput, nil
+	}
 	m.getItemInput = params
 	return m.getItemOutput, m.getItemErr
 }
@@ -37,12 +66,18 @@ func (m *mockDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutIt
 	return m.putItemOutput, m.putItemErr
 }
 
+func (m *mockDynamoDBClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.updateItemInputs = append(m.updateItemInputs, params)
+	return &dynamodb.UpdateItemOutput{}, m.updateItemErr
+}
+
 func (m *mockDynamoDBClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
 	m.queryInput = params
 	return m.queryOutput, m.queryErr
 }
 
 type mockAPIGatewayClient struct {
+	postToConnectionInputs []*apigatewaymanagementapi.PostToConnectionInput
 	postToConnectionInput  *apigatewaymanagementapi.PostToConnectionInput
 	postToConnectionOutput *apigatewaymanagementapi.PostToConnectionOutput
 	postToConnectionErr    error
@@ -50,9 +85,22 @@ type mockAPIGatewayClient struct {
 
 func (m *mockAPIGatewayClient) PostToConnection(ctx context.Context, params *apigatewaymanagementapi.PostToConnectionInput, optFns ...func(*apigatewaymanagementapi.Options)) (*apigatewaymanagementapi.PostToConnectionOutput, error) {
 	m.postToConnectionInput = params
+	m.postToConnectionInputs = append(m.postToConnectionInputs, params)
 	return m.postToConnectionOutput, m.postToConnectionErr
 }
 
+type mockS3Client struct {
+	contents map[string][]byte
+}
+
+func (m *mockS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	content, ok := m.contents[*params.Key]
+	if !ok {
+		return nil, fmt.Errorf("NoSuchKey: %s", *params.Key)
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(content))}, nil
+}
+
 func setupTestEnv(t *testing.T) func() {
 	// Set environment variables
 	os.Setenv("connections_table", "test-connections-table")
@@ -106,7 +154,7 @@ func TestHandler_SuccessfulMessageProcessing(t *testing.T) {
 		},
 	}
 
-	err := HandlerWithClients(context.Background(), event, mockDynamo, mockAPI)
+	err := HandlerWithClients(context.Background(), event, mockDynamo, mockAPI, &mockS3Client{})
 
 	assert.NoError(t, err)
 	assert.NotNil(t, mockDynamo.getItemInput)
@@ -156,7 +204,7 @@ func TestHandler_ErrorHandling(t *testing.T) {
 		},
 	}
 
-	err := HandlerWithClients(context.Background(), event, mockDynamo, mockAPI)
+	err := HandlerWithClients(context.Background(), event, mockDynamo, mockAPI, &mockS3Client{})
 
 	assert.NoError(t, err)
 	assert.NotNil(t, mockDynamo.putItemInput)
@@ -204,7 +252,7 @@ func TestHandler_JobHistorySaving(t *testing.T) {
 		},
 	}
 
-	err := HandlerWithClients(context.Background(), event, mockDynamo, mockAPI)
+	err := HandlerWithClients(context.Background(), event, mockDynamo, mockAPI, &mockS3Client{})
 
 	assert.NoError(t, err)
 	assert.NotNil(t, mockDynamo.putItemInput)
@@ -221,3 +269,741 @@ func TestHandler_JobHistorySaving(t *testing.T) {
 	assert.Equal(t, "test-new-s3-key", mockDynamo.putItemInput.Item["newS3Key"].(*types.AttributeValueMemberS).Value)
 	assert.NotEmpty(t, mockDynamo.putItemInput.Item["timestamp"].(*types.AttributeValueMemberS).Value)
 }
+
+func TestHandler_SavesJobHistoryWhenConnectionIsGone(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	notification := NotificationMessage{
+		ConnectionID: "stale-connection-id",
+		JobType:      "conversion",
+		JobID:        "test-job-id",
+		JobStatus:    "completed",
+		FromFileType: "blend",
+		ToFileType:   "glb",
+		ModelID:      "test-model-id",
+		S3Key:        "test-s3-key",
+		NewS3Key:     "test-new-s3-key",
+	}
+	notificationBody, _ := json.Marshal(notification)
+
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutput: &dynamodb.GetItemOutput{},
+		queryOutput: &dynamodb.QueryOutput{
+			Items: []map[string]types.AttributeValue{},
+		},
+	}
+
+	mockAPI := &mockAPIGatewayClient{}
+
+	event := events.SQSEvent{
+		Records: []events.SQSMessage{
+			{
+				Body: string(notificationBody),
+			},
+		},
+	}
+
+	err := HandlerWithClients(context.Background(), event, mockDynamo, mockAPI, &mockS3Client{})
+
+	assert.NoError(t, err)
+	assert.NotNil(t, mockDynamo.putItemInput)
+	assert.Equal(t, "completed", mockDynamo.putItemInput.Item["jobStatus"].(*types.AttributeValueMemberS).Value)
+	assert.Nil(t, mockAPI.postToConnectionInput)
+}
+
+func TestHandler_UpdatesPendingJobRecordedAtSubmission(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	notification := NotificationMessage{
+		ConnectionID: "test-connection-id",
+		JobType:      "conversion",
+		JobID:        "test-job-id",
+		JobStatus:    "completed",
+		FromFileType: "blend",
+		ToFileType:   "glb",
+		ModelID:      "test-model-id",
+		S3Key:        "test-s3-key",
+		NewS3Key:     "test-new-s3-key",
+	}
+	notificationBody, _ := json.Marshal(notification)
+
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutput: &dynamodb.GetItemOutput{
+			Item: map[string]types.AttributeValue{
+				"connectionId": &types.AttributeValueMemberS{Value: "test-connection-id"},
+			},
+		},
+		jobItemOutput: &dynamodb.GetItemOutput{
+			Item: map[string]types.AttributeValue{
+				"jobId":       &types.AttributeValueMemberS{Value: "test-job-id"},
+				"jobStatus":   &types.AttributeValueMemberS{Value: "pending"},
+				"submittedAt": &types.AttributeValueMemberS{Value: "2025-01-01T00:00:00Z"},
+				"expiresAt":   &types.AttributeValueMemberN{Value: "1735693200"},
+			},
+		},
+	}
+
+	mockAPI := &mockAPIGatewayClient{}
+
+	event := events.SQSEvent{
+		Records: []events.SQSMessage{
+			{
+				Body: string(notificationBody),
+			},
+		},
+	}
+
+	err := HandlerWithClients(context.Background(), event, mockDynamo, mockAPI, &mockS3Client{})
+
+	assert.NoError(t, err)
+	assert.Nil(t, mockDynamo.queryInput)
+	assert.NotNil(t, mockDynamo.putItemInput)
+	assert.Equal(t, "test-job-id", mockDynamo.putItemInput.Item["jobId"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "completed", mockDynamo.putItemInput.Item["jobStatus"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "2025-01-01T00:00:00Z", mockDynamo.putItemInput.Item["submittedAt"].(*types.AttributeValueMemberS).Value)
+	assert.NotContains(t, mockDynamo.putItemInput.Item, "expiresAt")
+}
+
+func TestHandler_SkipsExpiredPendingRowsOfOlderJobs(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	row := func(jobID string, jobStatus string, expiresAt time.Time) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{
+			"jobId":     &types.AttributeValueMemberS{Value: jobID},
+			"jobStatus": &types.AttributeValueMemberS{Value: jobStatus},
+			"expiresAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt.Unix(), 10)},
+		}
+	}
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutput: &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+			"connectionId": &types.AttributeValueMemberS{Value: "test-connection-id"},
+		}},
+		queryOutput: &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{
+			row("ghost-job", "pending", time.Now().Add(-time.Minute)),
+			row("old-job", "pending", time.Now().Add(time.Hour)),
+		}},
+	}
+	body, _ := json.Marshal(NotificationMessage{ConnectionID: "test-connection-id", JobType: "conversion", JobID: "unknown-job", JobStatus: "completed", FromFileType: "blend", ToFileType: "glb", ModelID: "test-model-id"})
+
+	err := HandlerWithClients(context.Background(), events.SQSEvent{Records: []events.SQSMessage{{Body: string(body)}}}, mockDynamo, &mockAPIGatewayClient{}, &mockS3Client{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "old-job", mockDynamo.putItemInput.Item["jobId"].(*types.AttributeValueMemberS).Value)
+}
+
+func TestHandler_SavesArtifactManifest(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	notification := NotificationMessage{
+		ConnectionID: "test-connection-id",
+		JobType:      "conversion",
+		JobID:        "test-job-id",
+		JobStatus:    "completed",
+		FromFileType: "blend",
+		ToFileType:   "gltf",
+		ModelID:      "test-model-id",
+		S3Key:        "test-s3-key",
+		NewS3Key:     "gltf/test-model-id/test-model-id.gltf",
+		Artifacts: []Artifact{
+			{Path: "test-model-id.bin", S3Key: "gltf/test-model-id/test-model-id.bin", Size: 2048, SHA256: "bin-hash"},
+			{Path: "test-model-id.gltf", S3Key: "gltf/test-model-id/test-model-id.gltf", Size: 512, SHA256: "gltf-hash"},
+		},
+	}
+	notificationBody, _ := json.Marshal(notification)
+
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutput: &dynamodb.GetItemOutput{},
+		queryOutput: &dynamodb.QueryOutput{
+			Items: []map[string]types.AttributeValue{},
+		},
+	}
+
+	event := events.SQSEvent{
+		Records: []events.SQSMessage{
+			{
+				Body: string(notificationBody),
+			},
+		},
+	}
+
+	err := HandlerWithClients(context.Background(), event, mockDynamo, &mockAPIGatewayClient{}, &mockS3Client{})
+
+	assert.NoError(t, err)
+	artifacts := mockDynamo.putItemInput.Item["artifacts"].(*types.AttributeValueMemberL).Value
+	assert.Len(t, artifacts, 2)
+	bin := artifacts[0].(*types.AttributeValueMemberM).Value
+	assert.Equal(t, "test-model-id.bin", bin["path"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "gltf/test-model-id/test-model-id.bin", bin["s3Key"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "2048", bin["size"].(*types.AttributeValueMemberN).Value)
+	assert.Equal(t, "bin-hash", bin["sha256"].(*types.AttributeValueMemberS).Value)
+}
+
+func TestHandler_SavesMeshStats(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	notification := NotificationMessage{
+		ConnectionID: "test-connection-id",
+		JobType:      "conversion",
+		JobID:        "test-job-id",
+		JobStatus:    "completed",
+		FromFileType: "glb",
+		ToFileType:   "stl",
+		ModelID:      "test-model-id",
+		S3Key:        "test-s3-key",
+		NewS3Key:     "stl/test-model-id.stl",
+		MeshStats:    &mesh.Stats{Vertices: 3, Triangles: 1, Min: [3]float64{0, 0, 0}, Max: [3]float64{10, 20.5, 0}, Unit: "millimeter"},
+	}
+	notificationBody, _ := json.Marshal(notification)
+	mockDynamo := &mockDynamoDBClient{getItemOutput: &dynamodb.GetItemOutput{}, queryOutput: &dynamodb.QueryOutput{}}
+
+	err := HandlerWithClients(context.Background(), events.SQSEvent{Records: []events.SQSMessage{{Body: string(notificationBody)}}}, mockDynamo, &mockAPIGatewayClient{}, &mockS3Client{})
+
+	assert.NoError(t, err)
+	stats := mockDynamo.putItemInput.Item["meshStats"].(*types.AttributeValueMemberM).Value
+	assert.Equal(t, "1", stats["triangles"].(*types.AttributeValueMemberN).Value)
+	assert.Equal(t, "3", stats["vertices"].(*types.AttributeValueMemberN).Value)
+	assert.Equal(t, "millimeter", stats["unit"].(*types.AttributeValueMemberS).Value)
+	maximum := stats["max"].(*types.AttributeValueMemberL).Value
+	assert.Equal(t, "20.5", maximum[1].(*types.AttributeValueMemberN).Value)
+}
+
+// testGLB is a single triangle, one meter wide and two meters tall
+func testGLB(t *testing.T) []byte {
+	positions := make([]byte, 0, 36)
+	for _, v := range []float32{0, 0, 0, 1, 0, 0, 0, 2, 0} {
+		positions = binary.LittleEndian.AppendUint32(positions, math.Float32bits(v))
+	}
+	model := &gltf.Model{
+		Document: &gltf.Document{
+			Asset:       gltf.Asset{Version: "2.0"},
+			Nodes:       []gltf.Node{{Mesh: gltf.Int(0)}},
+			Meshes:      []gltf.Mesh{{Primitives: []gltf.Primitive{{Attributes: map[string]int{"POSITION": 0}}}}},
+			Accessors:   []gltf.Accessor{{BufferView: gltf.Int(0), ComponentType: gltf.ComponentFloat, Count: 3, Type: "VEC3", Min: []float64{0, 0, 0}, Max: []float64{1, 2, 0}}},
+			BufferViews: []gltf.BufferView{{Buffer: 0, ByteLength: len(positions)}},
+			Buffers:     []gltf.Buffer{{ByteLength: len(positions)}},
+		},
+		Buffers: [][]byte{positions},
+	}
+	glb, err := model.WriteGLB()
+	assert.NoError(t, err)
+	return glb
+}
+
+func TestHandler_SavesModelStatsOfGLBOutputs(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	notification := NotificationMessage{
+		ConnectionID: "test-connection-id",
+		JobType:      "conversion",
+		JobID:        "test-job-id",
+		JobStatus:    "completed",
+		FromFileType: "fbx",
+		ToFileType:   "glb",
+		ModelID:      "test-model-id",
+		S3Key:        "test-s3-key",
+		NewS3Key:     "glb/test-model-id.glb",
+	}
+	notificationBody, _ := json.Marshal(notification)
+	glb := testGLB(t)
+	mockDynamo := &mockDynamoDBClient{getItemOutput: &dynamodb.GetItemOutput{}, queryOutput: &dynamodb.QueryOutput{}}
+	mockS3 := &mockS3Client{contents: map[string][]byte{"glb/test-model-id.glb": glb}}
+
+	err := HandlerWithClients(context.Background(), events.SQSEvent{Records: []events.SQSMessage{{Body: string(notificationBody)}}}, mockDynamo, &mockAPIGatewayClient{}, mockS3)
+
+	assert.NoError(t, err)
+	var stats gltf.Stats
+	assert.NoError(t, json.Unmarshal([]byte(mockDynamo.putItemInput.Item["modelStats"].(*types.AttributeValueMemberS).Value), &stats))
+	assert.Equal(t, 3, stats.Vertices)
+	assert.Equal(t, 1, stats.Triangles)
+	assert.Equal(t, 1, stats.DrawCalls)
+	assert.Equal(t, int64(len(glb)), stats.ByteSize)
+	assert.Equal(t, [3]float64{1, 2, 0}, stats.Max)
+	assert.Equal(t, "completed", mockDynamo.putItemInput.Item["jobStatus"].(*types.AttributeValueMemberS).Value)
+	assert.Contains(t, mockDynamo.putItemInput.Item, "validationReport")
+}
+
+func TestHandler_FailsJobsWithInvalidGLTF(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	notification := NotificationMessage{
+		ConnectionID: "test-connection-id",
+		JobType:      "conversion",
+		JobID:        "test-job-id",
+		JobStatus:    "completed",
+		ToFileType:   "glb",
+		NewS3Key:     "glb/test-model-id.glb",
+	}
+	notificationBody, _ := json.Marshal(notification)
+	glb := testGLB(t)
+	// Drop the end of the BIN chunk the positions live in
+	mockS3 := &mockS3Client{contents: map[string][]byte{"glb/test-model-id.glb": glb[:len(glb)-8]}}
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutput: &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{"connectionId": &types.AttributeValueMemberS{Value: "test-connection-id"}}},
+		queryOutput:   &dynamodb.QueryOutput{},
+	}
+	mockAPI := &mockAPIGatewayClient{}
+
+	err := HandlerWithClients(context.Background(), events.SQSEvent{Records: []events.SQSMessage{{Body: string(notificationBody)}}}, mockDynamo, mockAPI, mockS3)
+
+	assert.NoError(t, err)
+	item := mockDynamo.putItemInput.Item
+	assert.Equal(t, "failed", item["jobStatus"].(*types.AttributeValueMemberS).Value)
+	assert.Contains(t, item["error"].(*types.AttributeValueMemberS).Value, "GLB_LENGTH_MISMATCH")
+	assert.NotContains(t, item, "modelStats")
+	var report gltf.Report
+	assert.NoError(t, json.Unmarshal([]byte(item["validationReport"].(*types.AttributeValueMemberS).Value), &report))
+	assert.Positive(t, report.NumErrors)
+
+	var relayed NotificationMessage
+	assert.NoError(t, json.Unmarshal(mockAPI.postToConnectionInput.Data, &relayed))
+	assert.Equal(t, "failed", relayed.JobStatus)
+	assert.Equal(t, report.NumErrors, relayed.Validation.NumErrors)
+}
+
+func TestHandler_FlagsGLTFWithWarnings(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	// A .gltf whose buffer is a separate artifact, with a single vertex that
+	// cannot make a whole line
+	positions := make([]byte, 12)
+	document := `{"asset":{"version":"2.0"},"meshes":[{"primitives":[{"attributes":{"POSITION":0},"mode":1}]}],"nodes":[{"mesh":0}],` +
+		`"accessors":[{"bufferView":0,"componentType":5126,"count":1,"type":"VEC3","min":[0,0,0],"max":[0,0,0]}],` +
+		`"bufferViews":[{"buffer":0,"byteLength":12}],"buffers":[{"uri":"model.bin","byteLength":12}]}`
+	notificationBody, _ := json.Marshal(NotificationMessage{
+		ConnectionID: "test-connection-id",
+		JobType:      "conversion",
+		JobID:        "test-job-id",
+		JobStatus:    "completed",
+		ToFileType:   "gltf",
+		NewS3Key:     "gltf/test-model-id/model.gltf",
+		Artifacts: []Artifact{
+			{Path: "model.gltf", S3Key: "gltf/test-model-id/model.gltf"},
+			{Path: "model.bin", S3Key: "gltf/test-model-id/model.bin"},
+		},
+	})
+	mockS3 := &mockS3Client{contents: map[string][]byte{
+		"gltf/test-model-id/model.gltf": []byte(document),
+		"gltf/test-model-id/model.bin":  positions,
+	}}
+	mockDynamo := &mockDynamoDBClient{getItemOutput: &dynamodb.GetItemOutput{}, queryOutput: &dynamodb.QueryOutput{}}
+
+	err := HandlerWithClients(context.Background(), events.SQSEvent{Records: []events.SQSMessage{{Body: string(notificationBody)}}}, mockDynamo, &mockAPIGatewayClient{}, mockS3)
+
+	assert.NoError(t, err)
+	item := mockDynamo.putItemInput.Item
+	assert.Equal(t, "completed_with_warnings", item["jobStatus"].(*types.AttributeValueMemberS).Value)
+	assert.Contains(t, item, "modelStats")
+}
+
+func TestHandler_SavesJobWhenOutputCannotBeAnalyzed(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	notificationBody, _ := json.Marshal(NotificationMessage{
+		ConnectionID: "test-connection-id",
+		JobType:      "conversion",
+		JobID:        "test-job-id",
+		JobStatus:    "completed",
+		ToFileType:   "glb",
+		NewS3Key:     "glb/missing.glb",
+	})
+	mockDynamo := &mockDynamoDBClient{getItemOutput: &dynamodb.GetItemOutput{}, queryOutput: &dynamodb.QueryOutput{}}
+
+	err := HandlerWithClients(context.Background(), events.SQSEvent{Records: []events.SQSMessage{{Body: string(notificationBody)}}}, mockDynamo, &mockAPIGatewayClient{}, &mockS3Client{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "completed", mockDynamo.putItemInput.Item["jobStatus"].(*types.AttributeValueMemberS).Value)
+	assert.NotContains(t, mockDynamo.putItemInput.Item, "modelStats")
+	var report gltf.Report
+	assert.NoError(t, json.Unmarshal([]byte(mockDynamo.putItemInput.Item["validationReport"].(*types.AttributeValueMemberS).Value), &report))
+	assert.Equal(t, gltf.StatusSkipped, report.Status)
+	assert.Contains(t, report.Reason, "glb/missing.glb")
+}
+
+func TestHandler_SkipsValidationOfOversizedOutputs(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+	glb := testGLB(t)
+	original := maxInspectedSize
+	maxInspectedSize = len(glb) - 1
+	t.Cleanup(func() { maxInspectedSize = original })
+
+	notificationBody, _ := json.Marshal(NotificationMessage{
+		ConnectionID: "test-connection-id",
+		JobType:      "conversion",
+		JobID:        "test-job-id",
+		JobStatus:    "completed",
+		ToFileType:   "glb",
+		NewS3Key:     "glb/test-model-id.glb",
+	})
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutput: &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{"connectionId": &types.AttributeValueMemberS{Value: "test-connection-id"}}},
+		queryOutput:   &dynamodb.QueryOutput{},
+	}
+	mockS3 := &mockS3Client{contents: map[string][]byte{"glb/test-model-id.glb": glb}}
+	mockAPI := &mockAPIGatewayClient{}
+
+	err := HandlerWithClients(context.Background(), events.SQSEvent{Records: []events.SQSMessage{{Body: string(notificationBody)}}}, mockDynamo, mockAPI, mockS3)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "completed", mockDynamo.putItemInput.Item["jobStatus"].(*types.AttributeValueMemberS).Value)
+	var relayed NotificationMessage
+	assert.NoError(t, json.Unmarshal(mockAPI.postToConnectionInput.Data, &relayed))
+	assert.Equal(t, gltf.StatusSkipped, relayed.Validation.Status)
+	assert.Contains(t, relayed.Validation.Reason, "is larger than")
+}
+
+// pendingJobItem is the row POST /3d-model writes for a job submitted with a
+// quality budget
+func pendingJobItem(qualityRules string, sourceQuality string) map[string]types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		"jobId":        &types.AttributeValueMemberS{Value: "test-job-id"},
+		"jobStatus":    &types.AttributeValueMemberS{Value: "pending"},
+		"tenantId":     &types.AttributeValueMemberS{Value: "acme"},
+		"qualityRules": &types.AttributeValueMemberS{Value: qualityRules},
+	}
+	if sourceQuality != "" {
+		item["sourceQuality"] = &types.AttributeValueMemberS{Value: sourceQuality}
+		item["sourceStats"] = &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}}
+	}
+	return item
+}
+
+func TestHandler_FailsGLBOverItsQualityBudget(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	notificationBody, _ := json.Marshal(NotificationMessage{
+		ConnectionID: "test-connection-id",
+		JobType:      "conversion",
+		JobID:        "test-job-id",
+		JobStatus:    "completed",
+		ToFileType:   "glb",
+		NewS3Key:     "glb/test-model-id.glb",
+	})
+	mockS3 := &mockS3Client{contents: map[string][]byte{"glb/test-model-id.glb": testGLB(t)}}
+	mockDynamo := &mockDynamoDBClient{
+		jobItemOutput: &dynamodb.GetItemOutput{Item: pendingJobItem(`{"maxTriangles":100,"maxFileSizeBytes":10,"namePattern":"[a-z]+","warn":["namePattern"]}`, "")},
+		getItemOutput: &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{"connectionId": &types.AttributeValueMemberS{Value: "test-connection-id"}}},
+	}
+	mockAPI := &mockAPIGatewayClient{}
+
+	err := HandlerWithClients(context.Background(), events.SQSEvent{Records: []events.SQSMessage{{Body: string(notificationBody)}}}, mockDynamo, mockAPI, mockS3)
+
+	assert.NoError(t, err)
+	item := mockDynamo.putItemInput.Item
+	assert.Equal(t, "failed", item["jobStatus"].(*types.AttributeValueMemberS).Value)
+	assert.Contains(t, item["error"].(*types.AttributeValueMemberS).Value, "broke 1 quality rules, the first is maxFileSize")
+	assert.Contains(t, item, "modelStats")
+
+	var report quality.Report
+	assert.NoError(t, json.Unmarshal([]byte(item["qualityReport"].(*types.AttributeValueMemberS).Value), &report))
+	assert.Equal(t, quality.ResultFail, report.Result)
+	assert.Equal(t, []quality.Rule{quality.RuleMaxTriangles, quality.RuleNamePattern, quality.RuleMaxFileSize}, report.Rules)
+	assert.Len(t, report.Findings, 3)
+
+	var relayed NotificationMessage
+	assert.NoError(t, json.Unmarshal(mockAPI.postToConnectionInput.Data, &relayed))
+	assert.Equal(t, quality.ResultFail, relayed.Quality.Result)
+}
+
+func TestHandler_FlagsSourceQualityWarnings(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	notificationBody, _ := json.Marshal(NotificationMessage{
+		ConnectionID: "test-connection-id",
+		JobType:      "conversion",
+		JobID:        "test-job-id",
+		JobStatus:    "completed",
+		FromFileType: "blend",
+		ToFileType:   "fbx",
+		NewS3Key:     "fbx/test-model-id.fbx",
+	})
+	sourceQuality := `[{"rule":"unitsInMeters","result":"warn","message":"Scene \"Scene\" has a unit scale of 0.01","source":true}]`
+	mockDynamo := &mockDynamoDBClient{
+		jobItemOutput: &dynamodb.GetItemOutput{Item: pendingJobItem(`{"maxTriangles":100,"unitsInMeters":true,"warn":["unitsInMeters"]}`, sourceQuality)},
+		getItemOutput: &dynamodb.GetItemOutput{},
+	}
+
+	err := HandlerWithClients(context.Background(), events.SQSEvent{Records: []events.SQSMessage{{Body: string(notificationBody)}}}, mockDynamo, &mockAPIGatewayClient{}, &mockS3Client{})
+
+	assert.NoError(t, err)
+	item := mockDynamo.putItemInput.Item
+	assert.Equal(t, "completed_with_warnings", item["jobStatus"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "acme", item["tenantId"].(*types.AttributeValueMemberS).Value)
+	var report quality.Report
+	assert.NoError(t, json.Unmarshal([]byte(item["qualityReport"].(*types.AttributeValueMemberS).Value), &report))
+	assert.Equal(t, quality.ResultWarn, report.Result)
+	assert.Equal(t, []quality.Rule{quality.RuleUnitsInMeters}, report.Rules)
+	assert.Equal(t, []quality.Rule{quality.RuleMaxTriangles}, report.Skipped)
+}
+
+func TestHandler_SkipsQualityOfFailedJobs(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	notificationBody, _ := json.Marshal(NotificationMessage{
+		ConnectionID: "test-connection-id",
+		JobType:      "conversion",
+		JobID:        "test-job-id",
+		JobStatus:    "failed",
+		ToFileType:   "glb",
+		Error:        "Blender crashed",
+	})
+	mockDynamo := &mockDynamoDBClient{
+		jobItemOutput: &dynamodb.GetItemOutput{Item: pendingJobItem(`{"maxTriangles":100}`, "")},
+		getItemOutput: &dynamodb.GetItemOutput{},
+	}
+
+	err := HandlerWithClients(context.Background(), events.SQSEvent{Records: []events.SQSMessage{{Body: string(notificationBody)}}}, mockDynamo, &mockAPIGatewayClient{}, &mockS3Client{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Blender crashed", mockDynamo.putItemInput.Item["error"].(*types.AttributeValueMemberS).Value)
+	assert.NotContains(t, mockDynamo.putItemInput.Item, "qualityReport")
+}
+
+func submissionJobItem(jobID string, toFileType string, jobStatus string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"jobId":        &types.AttributeValueMemberS{Value: jobID},
+		"connectionId": &types.AttributeValueMemberS{Value: "test-connection-id"},
+		"jobStatus":    &types.AttributeValueMemberS{Value: jobStatus},
+		"toFileType":   &types.AttributeValueMemberS{Value: toFileType},
+		"submissionId": &types.AttributeValueMemberS{Value: "test-submission-id"},
+		"submissionJobIds": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+			&types.AttributeValueMemberS{Value: "job-glb"},
+			&types.AttributeValueMemberS{Value: "job-usdz"},
+		}},
+	}
+}
+
+func newSubmissionEvent(jobID string, toFileType string, jobStatus string) events.SQSEvent {
+	notification := NotificationMessage{
+		ConnectionID: "test-connection-id",
+		JobType:      "conversion",
+		JobID:        jobID,
+		JobStatus:    jobStatus,
+		FromFileType: "blend",
+		ToFileType:   toFileType,
+		ModelID:      "test-model-id",
+		S3Key:        "test-s3-key",
+	}
+	notificationBody, _ := json.Marshal(notification)
+	return events.SQSEvent{
+		Records: []events.SQSMessage{
+			{
+				Body: string(notificationBody),
+			},
+		},
+	}
+}
+
+func TestHandler_SubmissionStillRunning_NoSubmissionNotification(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutput: &dynamodb.GetItemOutput{
+			Item: map[string]types.AttributeValue{
+				"connectionId": &types.AttributeValueMemberS{Value: "test-connection-id"},
+			},
+		},
+		jobItems: map[string]map[string]types.AttributeValue{
+			"job-glb":  submissionJobItem("job-glb", "glb", "pending"),
+			"job-usdz": submissionJobItem("job-usdz", "usdz", "pending"),
+		},
+	}
+	mockAPI := &mockAPIGatewayClient{}
+
+	err := HandlerWithClients(context.Background(), newSubmissionEvent("job-glb", "glb", "completed"), mockDynamo, mockAPI, &mockS3Client{})
+
+	assert.NoError(t, err)
+	assert.Empty(t, mockDynamo.updateItemInputs)
+	assert.Len(t, mockAPI.postToConnectionInputs, 1)
+}
+
+func TestHandler_LastSubmissionJob_SendsSubmissionNotification(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutput: &dynamodb.GetItemOutput{
+			Item: map[string]types.AttributeValue{
+				"connectionId": &types.AttributeValueMemberS{Value: "test-connection-id"},
+			},
+		},
+		jobItems: map[string]map[string]types.AttributeValue{
+			"job-glb":  submissionJobItem("job-glb", "glb", "completed"),
+			"job-usdz": submissionJobItem("job-usdz", "usdz", "pending"),
+		},
+	}
+	mockAPI := &mockAPIGatewayClient{}
+
+	err := HandlerWithClients(context.Background(), newSubmissionEvent("job-usdz", "usdz", "failed"), mockDynamo, mockAPI, &mockS3Client{})
+
+	assert.NoError(t, err)
+	assert.Len(t, mockDynamo.updateItemInputs, 1)
+	assert.Equal(t, "job-glb", mockDynamo.updateItemInputs[0].Key["jobId"].(*types.AttributeValueMemberS).Value)
+	assert.Contains(t, *mockDynamo.updateItemInputs[0].ConditionExpression, "attribute_not_exists(submissionNotifiedAt)")
+
+	assert.Len(t, mockAPI.postToConnectionInputs, 2)
+	var submission SubmissionNotification
+	assert.NoError(t, json.Unmarshal(mockAPI.postToConnectionInputs[1].Data, &submission))
+	assert.Equal(t, "submissionCompleted", submission.Type)
+	assert.Equal(t, "test-submission-id", submission.SubmissionID)
+	assert.Equal(t, "partially_completed", submission.JobStatus)
+	assert.Equal(t, []SubmissionJob{
+		{JobID: "job-glb", ToFileType: "glb", JobStatus: "completed"},
+		{JobID: "job-usdz", ToFileType: "usdz", JobStatus: "failed"},
+	}, submission.Jobs)
+}
+
+func TestHandler_SubmissionRelayFails_ReleasesItForRedelivery(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutput: &dynamodb.GetItemOutput{
+			Item: map[string]types.AttributeValue{
+				"connectionId": &types.AttributeValueMemberS{Value: "test-connection-id"},
+			},
+		},
+		jobItems: map[string]map[string]types.AttributeValue{
+			"job-glb":  submissionJobItem("job-glb", "glb", "completed"),
+			"job-usdz": submissionJobItem("job-usdz", "usdz", "pending"),
+		},
+	}
+	mockAPI := &mockAPIGatewayClient{postToConnectionErr: fmt.Errorf("LimitExceededException")}
+
+	err := HandlerWithClients(context.Background(), newSubmissionEvent("job-usdz", "usdz", "completed"), mockDynamo, mockAPI, &mockS3Client{})
+
+	assert.ErrorContains(t, err, "relaying submission test-submission-id")
+	if assert.Len(t, mockDynamo.updateItemInputs, 2) {
+		assert.Equal(t, "job-glb", mockDynamo.updateItemInputs[1].Key["jobId"].(*types.AttributeValueMemberS).Value)
+		assert.Equal(t, "REMOVE submissionNotifiedAt", *mockDynamo.updateItemInputs[1].UpdateExpression)
+	}
+}
+
+func TestHandler_ConnectionGone_ReleasesSubmissionWithoutFailing(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutput: &dynamodb.GetItemOutput{
+			Item: map[string]types.AttributeValue{
+				"connectionId": &types.AttributeValueMemberS{Value: "test-connection-id"},
+			},
+		},
+		jobItems: map[string]map[string]types.AttributeValue{
+			"job-glb":  submissionJobItem("job-glb", "glb", "completed"),
+			"job-usdz": submissionJobItem("job-usdz", "usdz", "pending"),
+		},
+	}
+	mockAPI := &mockAPIGatewayClient{postToConnectionErr: &apitypes.GoneException{}}
+
+	err := HandlerWithClients(context.Background(), newSubmissionEvent("job-usdz", "usdz", "completed"), mockDynamo, mockAPI, &mockS3Client{})
+
+	assert.NoError(t, err)
+	assert.Len(t, mockAPI.postToConnectionInputs, 1)
+	if assert.Len(t, mockDynamo.updateItemInputs, 2) {
+		assert.Equal(t, "REMOVE submissionNotifiedAt", *mockDynamo.updateItemInputs[1].UpdateExpression)
+	}
+}
+
+func TestHandler_SubmissionAlreadyNotified_SendsOnlyJobNotification(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutput: &dynamodb.GetItemOutput{
+			Item: map[string]types.AttributeValue{
+				"connectionId": &types.AttributeValueMemberS{Value: "test-connection-id"},
+			},
+		},
+		jobItems: map[string]map[string]types.AttributeValue{
+			"job-glb":  submissionJobItem("job-glb", "glb", "completed"),
+			"job-usdz": submissionJobItem("job-usdz", "usdz", "pending"),
+		},
+		updateItemErr: &types.ConditionalCheckFailedException{},
+	}
+	mockAPI := &mockAPIGatewayClient{}
+
+	err := HandlerWithClients(context.Background(), newSubmissionEvent("job-usdz", "usdz", "completed"), mockDynamo, mockAPI, &mockS3Client{})
+
+	assert.NoError(t, err)
+	assert.Len(t, mockAPI.postToConnectionInputs, 1)
+}
+
+func TestHandler_CancelledJob_DiscardsLateResult(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	cancelledItem := submissionJobItem("job-glb", "glb", "cancelled")
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutput: &dynamodb.GetItemOutput{
+			Item: map[string]types.AttributeValue{
+				"connectionId": &types.AttributeValueMemberS{Value: "test-connection-id"},
+			},
+		},
+		jobItemOutput: &dynamodb.GetItemOutput{Item: cancelledItem},
+		putItemErr:    &types.ConditionalCheckFailedException{},
+	}
+	mockAPI := &mockAPIGatewayClient{}
+
+	err := HandlerWithClients(context.Background(), newSubmissionEvent("job-glb", "glb", "completed"), mockDynamo, mockAPI, &mockS3Client{})
+
+	assert.NoError(t, err)
+	assert.Contains(t, *mockDynamo.putItemInput.ConditionExpression, "jobStatus <> :cancelled")
+	assert.Empty(t, mockDynamo.updateItemInputs)
+	assert.Empty(t, mockAPI.postToConnectionInputs)
+}
+
+func TestHandler_RetriedJob_ChecksAttempt(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	notification := NotificationMessage{
+		ConnectionID: "test-connection-id",
+		JobType:      "conversion",
+		JobID:        "test-job-id",
+		JobStatus:    "completed",
+		FromFileType: "blend",
+		ToFileType:   "glb",
+		ModelID:      "test-model-id",
+		S3Key:        "test-s3-key",
+		Attempt:      "2",
+	}
+	notificationBody, _ := json.Marshal(notification)
+	mockDynamo := &mockDynamoDBClient{
+		getItemOutput: &dynamodb.GetItemOutput{
+			Item: map[string]types.AttributeValue{
+				"connectionId": &types.AttributeValueMemberS{Value: "test-connection-id"},
+			},
+		},
+		jobItemOutput: &dynamodb.GetItemOutput{
+			Item: map[string]types.AttributeValue{
+				"jobId":     &types.AttributeValueMemberS{Value: "test-job-id"},
+				"jobStatus": &types.AttributeValueMemberS{Value: "pending"},
+				"attempts":  &types.AttributeValueMemberN{Value: "2"},
+			},
+		},
+	}
+	mockAPI := &mockAPIGatewayClient{}
+
+	err := HandlerWithClients(context.Background(), events.SQSEvent{
+		Records: []events.SQSMessage{{Body: string(notificationBody)}},
+	}, mockDynamo, mockAPI, &mockS3Client{})
+
+	assert.NoError(t, err)
+	assert.Contains(t, *mockDynamo.putItemInput.ConditionExpression, "attempts = :attempt")
+	assert.Equal(t, "2", mockDynamo.putItemInput.ExpressionAttributeValues[":attempt"].(*types.AttributeValueMemberN).Value)
+	assert.Len(t, mockAPI.postToConnectionInputs, 1)
+}
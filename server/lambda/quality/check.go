@@ -0,0 +1,188 @@
+package quality
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/blendfile"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/gltf"
+)
+
+const (
+	// Models outside these sizes were most likely modelled in centimeters,
+	// millimeters or inches and exported without converting to meters
+	minMeterExtent = 0.001
+	maxMeterExtent = 100
+	// maxListedNames caps the names quoted in a naming finding
+	maxListedNames = 5
+)
+
+// checker collects the findings of one rule set
+type checker struct {
+	ruleSet  RuleSet
+	source   bool
+	findings []Finding
+}
+
+func (c *checker) add(rule Rule, pointer string, format string, args ...any) {
+	c.findings = append(c.findings, Finding{
+		Rule:    rule,
+		Result:  c.ruleSet.result(rule),
+		Message: fmt.Sprintf(format, args...),
+		Pointer: pointer,
+		Source:  c.source,
+	})
+}
+
+// namePattern compiles NamePattern to match whole names, adding a finding
+// when it is invalid
+func (c *checker) namePattern() *regexp.Regexp {
+	pattern, err := regexp.Compile("^(?:" + c.ruleSet.NamePattern + ")$")
+	if err != nil {
+		c.add(RuleNamePattern, "", "namePattern %q is not a valid regular expression", c.ruleSet.NamePattern)
+		return nil
+	}
+	return pattern
+}
+
+// names adds one finding for the names of a kind of object that do not match
+// the pattern. pointer is the JSON pointer of the objects, empty for sources.
+func (c *checker) names(pattern *regexp.Regexp, kind string, pointer string, names []string) {
+	var mismatched []string
+	first := -1
+	for i, name := range names {
+		if pattern.MatchString(name) {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		mismatched = append(mismatched, fmt.Sprintf("%q", name))
+	}
+	if len(mismatched) == 0 {
+		return
+	}
+	if pointer != "" {
+		pointer = fmt.Sprintf("%s/%d", pointer, first)
+	}
+	listed := strings.Join(mismatched[:min(len(mismatched), maxListedNames)], ", ")
+	if len(mismatched) > maxListedNames {
+		listed += fmt.Sprintf(" and %d more", len(mismatched)-maxListedNames)
+	}
+	c.add(RuleNamePattern, pointer, "%d %s do not match %s: %s", len(mismatched), kind, c.ruleSet.NamePattern, listed)
+}
+
+func objectNames[T any](objects []T, name func(T) string) []string {
+	names := make([]string, len(objects))
+	for i, object := range objects {
+		names[i] = name(object)
+	}
+	return names
+}
+
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+// missingChannels lists the required channels a material has no texture for
+func missingChannels(material gltf.Material, required []string) []string {
+	pbr := material.PBRMetallicRoughness
+	if pbr == nil {
+		pbr = &gltf.PBRMetallicRoughness{}
+	}
+	present := map[string]bool{
+		ChannelBaseColor:         pbr.BaseColorTexture != nil,
+		ChannelMetallicRoughness: pbr.MetallicRoughnessTexture != nil,
+		ChannelNormal:            material.NormalTexture != nil,
+		ChannelOcclusion:         material.OcclusionTexture != nil,
+		ChannelEmissive:          material.EmissiveTexture != nil,
+	}
+	var missing []string
+	for _, channel := range required {
+		if !present[channel] {
+			missing = append(missing, channel)
+		}
+	}
+	return missing
+}
+
+// CheckModel checks a glTF output against the rule set, using the stats the
+// gltf package computed for it
+func (r RuleSet) CheckModel(model *gltf.Model, stats *gltf.Stats) []Finding {
+	c := &checker{ruleSet: r}
+	doc := model.Document
+
+	if r.MaxTriangles > 0 && stats.Triangles > r.MaxTriangles {
+		c.add(RuleMaxTriangles, "", "The model has %d triangles, at most %d are allowed", stats.Triangles, r.MaxTriangles)
+	}
+	for i, size := range stats.TextureSizes {
+		// Images of unknown formats have no size to check
+		if size.Width == 0 || size.Height == 0 {
+			continue
+		}
+		pointer := fmt.Sprintf("/images/%d", i)
+		if r.MaxTextureSize > 0 && max(size.Width, size.Height) > r.MaxTextureSize {
+			c.add(RuleMaxTextureSize, pointer, "Image %d is %dx%d, at most %dx%d is allowed", i, size.Width, size.Height, r.MaxTextureSize, r.MaxTextureSize)
+		}
+		if r.PowerOfTwoTextures && (!isPowerOfTwo(size.Width) || !isPowerOfTwo(size.Height)) {
+			c.add(RulePowerOfTwoTextures, pointer, "Image %d is %dx%d, which is not a power of two", i, size.Width, size.Height)
+		}
+	}
+	if len(r.RequiredChannels) > 0 {
+		if len(doc.Materials) == 0 {
+			c.add(RuleRequiredChannels, "", "The model has no materials, %s textures are required", strings.Join(r.RequiredChannels, ", "))
+		}
+		for i, material := range doc.Materials {
+			if missing := missingChannels(material, r.RequiredChannels); len(missing) > 0 {
+				c.add(RuleRequiredChannels, fmt.Sprintf("/materials/%d", i), "Material %q has no %s texture", material.Name, strings.Join(missing, ", "))
+			}
+		}
+	}
+	if r.UnitsInMeters {
+		extent := 0.0
+		for axis := 0; axis < 3; axis++ {
+			extent = math.Max(extent, stats.Max[axis]-stats.Min[axis])
+		}
+		// Empty scenes have no size
+		if extent > 0 && (extent < minMeterExtent || extent > maxMeterExtent) {
+			c.add(RuleUnitsInMeters, "", "The model is %.4g m across, which suggests it was not modelled in meters", extent)
+		}
+	}
+	if r.NamePattern != "" {
+		if pattern := c.namePattern(); pattern != nil {
+			c.names(pattern, "nodes", "/nodes", objectNames(doc.Nodes, func(node gltf.Node) string { return node.Name }))
+			c.names(pattern, "meshes", "/meshes", objectNames(doc.Meshes, func(mesh gltf.Mesh) string { return mesh.Name }))
+			c.names(pattern, "materials", "/materials", objectNames(doc.Materials, func(material gltf.Material) string { return material.Name }))
+		}
+	}
+	if r.MaxFileSize > 0 && stats.ByteSize > r.MaxFileSize {
+		c.add(RuleMaxFileSize, "", "The model is %d bytes, at most %d bytes are allowed", stats.ByteSize, r.MaxFileSize)
+	}
+	return c.findings
+}
+
+// CheckBlend checks what the .blend preflight read from a source file against
+// the rule set. Only the units and names can be checked before conversion.
+func (r RuleSet) CheckBlend(file *blendfile.File) []Finding {
+	c := &checker{ruleSet: r, source: true}
+
+	if r.UnitsInMeters {
+		for i, units := range file.SceneUnits {
+			switch {
+			case units.System == blendfile.UnitSystemImperial:
+				c.add(RuleUnitsInMeters, "", "Scene %q uses imperial units", file.Scenes[i])
+			case units.System != "" && math.Abs(units.ScaleLength-1) > 1e-6:
+				c.add(RuleUnitsInMeters, "", "Scene %q has a unit scale of %.4g, models are exported in meters with a unit scale of 1", file.Scenes[i], units.ScaleLength)
+			}
+		}
+	}
+	if r.NamePattern != "" {
+		if pattern := c.namePattern(); pattern != nil {
+			c.names(pattern, "objects", "", file.Objects)
+			c.names(pattern, "meshes", "", file.Meshes)
+			c.names(pattern, "materials", "", file.Materials)
+		}
+	}
+	return c.findings
+}
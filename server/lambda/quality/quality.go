@@ -0,0 +1,202 @@
+// Package quality checks converted models against the quality budgets of a
+// tenant: how many triangles, how large and which textures, the units and
+// names they use and how large the file is. Every broken rule is a finding
+// that either warns or fails the job.
+package quality
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+type Rule string
+
+const (
+	RuleMaxTriangles       Rule = "maxTriangles"
+	RuleMaxTextureSize     Rule = "maxTextureSize"
+	RulePowerOfTwoTextures Rule = "powerOfTwoTextures"
+	RuleRequiredChannels   Rule = "requiredChannels"
+	RuleUnitsInMeters      Rule = "unitsInMeters"
+	RuleNamePattern        Rule = "namePattern"
+	RuleMaxFileSize        Rule = "maxFileSize"
+)
+
+var rules = []Rule{RuleMaxTriangles, RuleMaxTextureSize, RulePowerOfTwoTextures, RuleRequiredChannels, RuleUnitsInMeters, RuleNamePattern, RuleMaxFileSize}
+
+// SourceRules are the rules CheckBlend can check before a job is converted
+var SourceRules = []Rule{RuleUnitsInMeters, RuleNamePattern}
+
+type Result string
+
+const (
+	ResultPass Result = "pass"
+	ResultWarn Result = "warn"
+	ResultFail Result = "fail"
+)
+
+// Channels are the material inputs RequiredChannels can ask for, named after
+// the glTF texture that provides them
+const (
+	ChannelBaseColor         = "baseColor"
+	ChannelMetallicRoughness = "metallicRoughness"
+	ChannelNormal            = "normal"
+	ChannelOcclusion         = "occlusion"
+	ChannelEmissive          = "emissive"
+)
+
+var channels = []string{ChannelBaseColor, ChannelMetallicRoughness, ChannelNormal, ChannelOcclusion, ChannelEmissive}
+
+// RuleSet is the budget of one tenant for one output format. Zero values turn
+// a rule off.
+type RuleSet struct {
+	MaxTriangles int `json:"maxTriangles,omitempty"`
+	// MaxTextureSize caps the width and height of every image, in pixels
+	MaxTextureSize     int  `json:"maxTextureSize,omitempty"`
+	PowerOfTwoTextures bool `json:"powerOfTwoTextures,omitempty"`
+	// RequiredChannels are the textures every material needs
+	RequiredChannels []string `json:"requiredChannels,omitempty"`
+	// UnitsInMeters flags models whose size suggests they were not modelled in
+	// meters, and .blend scenes with a unit scale
+	UnitsInMeters bool `json:"unitsInMeters,omitempty"`
+	// NamePattern is a regular expression every object, mesh and material
+	// name has to match completely
+	NamePattern string `json:"namePattern,omitempty"`
+	MaxFileSize int64  `json:"maxFileSizeBytes,omitempty"`
+	// Warn lists the rules that only warn when they are broken, the others
+	// fail the job
+	Warn []Rule `json:"warn,omitempty"`
+}
+
+// Rules lists the rules the set turns on
+func (r RuleSet) Rules() []Rule {
+	enabled := map[Rule]bool{
+		RuleMaxTriangles:       r.MaxTriangles > 0,
+		RuleMaxTextureSize:     r.MaxTextureSize > 0,
+		RulePowerOfTwoTextures: r.PowerOfTwoTextures,
+		RuleRequiredChannels:   len(r.RequiredChannels) > 0,
+		RuleUnitsInMeters:      r.UnitsInMeters,
+		RuleNamePattern:        r.NamePattern != "",
+		RuleMaxFileSize:        r.MaxFileSize > 0,
+	}
+	var on []Rule
+	for _, rule := range rules {
+		if enabled[rule] {
+			on = append(on, rule)
+		}
+	}
+	return on
+}
+
+func (r RuleSet) validate() error {
+	if r.MaxTriangles < 0 || r.MaxTextureSize < 0 || r.MaxFileSize < 0 {
+		return fmt.Errorf("limits cannot be negative")
+	}
+	for _, channel := range r.RequiredChannels {
+		if !slices.Contains(channels, channel) {
+			return fmt.Errorf("unknown channel %q", channel)
+		}
+	}
+	if _, err := regexp.Compile(r.NamePattern); err != nil {
+		return fmt.Errorf("invalid namePattern: %w", err)
+	}
+	for _, rule := range r.Warn {
+		if !slices.Contains(rules, rule) {
+			return fmt.Errorf("unknown rule %q", rule)
+		}
+	}
+	return nil
+}
+
+// result is what breaking a rule of the set results in
+func (r RuleSet) result(rule Rule) Result {
+	if slices.Contains(r.Warn, rule) {
+		return ResultWarn
+	}
+	return ResultFail
+}
+
+// Any matches every tenant or every output format in Budgets
+const Any = "*"
+
+// Budgets map a tenant to the rule set of each output format
+type Budgets map[string]map[string]RuleSet
+
+// ParseBudgets reads budgets from JSON and checks every rule set
+func ParseBudgets(value string) (Budgets, error) {
+	var budgets Budgets
+	if err := json.Unmarshal([]byte(value), &budgets); err != nil {
+		return nil, err
+	}
+	for tenant, formats := range budgets {
+		for format, ruleSet := range formats {
+			if err := ruleSet.validate(); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", tenant, format, err)
+			}
+		}
+	}
+	return budgets, nil
+}
+
+// Lookup returns the rule set of a tenant and output format. The tenant's own
+// sets win over those of Any, and a set for the format over one for Any.
+func (b Budgets) Lookup(tenant string, format string) (RuleSet, bool) {
+	for _, t := range []string{tenant, Any} {
+		for _, f := range []string{format, Any} {
+			if ruleSet, ok := b[t][f]; ok {
+				return ruleSet, true
+			}
+		}
+	}
+	return RuleSet{}, false
+}
+
+// Finding is one broken rule
+type Finding struct {
+	Rule    Rule   `json:"rule"`
+	Result  Result `json:"result"`
+	Message string `json:"message"`
+	// Pointer is the JSON pointer of the glTF object the finding is about
+	Pointer string `json:"pointer,omitempty"`
+	// Source is set on findings about the source file instead of the output
+	Source bool `json:"source,omitempty"`
+}
+
+// Report is the outcome of checking a job against its rule set
+type Report struct {
+	Result Result `json:"result"`
+	// Rules are the rules that were checked
+	Rules []Rule `json:"rules"`
+	// Skipped are the rules of the set that could not be checked
+	Skipped  []Rule    `json:"skipped,omitempty"`
+	Findings []Finding `json:"findings,omitempty"`
+}
+
+// NewReport collects findings into a report that fails when any of them
+// fails, and warns when any of them warns
+func NewReport(ruleSet RuleSet, findings ...[]Finding) *Report {
+	report := &Report{Result: ResultPass, Rules: ruleSet.Rules()}
+	for _, group := range findings {
+		for _, finding := range group {
+			report.Findings = append(report.Findings, finding)
+			if finding.Result == ResultFail || report.Result == ResultPass {
+				report.Result = finding.Result
+			}
+		}
+	}
+	return report
+}
+
+// SkipAllBut moves every rule but the checked ones from Rules to Skipped
+func (r *Report) SkipAllBut(checked ...Rule) {
+	var kept []Rule
+	for _, rule := range r.Rules {
+		if slices.Contains(checked, rule) {
+			kept = append(kept, rule)
+		} else {
+			r.Skipped = append(r.Skipped, rule)
+		}
+	}
+	r.Rules = kept
+}
@@ -0,0 +1,150 @@
+package quality
+
+import (
+	"testing"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/blendfile"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/gltf"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func findingRules(findings []Finding) []Rule {
+	var rules []Rule
+	for _, finding := range findings {
+		rules = append(rules, finding.Rule)
+	}
+	return rules
+}
+
+func testModel() *gltf.Model {
+	return &gltf.Model{Document: &gltf.Document{
+		Nodes:  []gltf.Node{{Name: "chair_seat"}, {Name: "Cube.001"}},
+		Meshes: []gltf.Mesh{{Name: "chair_seat"}},
+		Materials: []gltf.Material{
+			{Name: "oak", PBRMetallicRoughness: &gltf.PBRMetallicRoughness{BaseColorTexture: &gltf.TextureInfo{}}, NormalTexture: &gltf.TextureInfo{}},
+			{Name: "steel"},
+		},
+	}}
+}
+
+func testStats() *gltf.Stats {
+	return &gltf.Stats{
+		Triangles:    12000,
+		TextureSizes: []gltf.ImageSize{{Width: 4096, Height: 4096}, {Width: 1000, Height: 512}, {}},
+		ByteSize:     3 << 20,
+		Min:          [3]float64{-40, 0, -40},
+		Max:          [3]float64{40, 180, 40},
+	}
+}
+
+func TestParseBudgets_LooksUpTenantAndFormat(t *testing.T) {
+	budgets, err := ParseBudgets(`{
+		"*": {"*": {"maxFileSizeBytes": 100}, "usdz": {"maxTriangles": 1000}},
+		"acme": {"glb": {"maxTriangles": 50000, "warn": ["maxTriangles"]}, "*": {"unitsInMeters": true}}
+	}`)
+	assert.NoError(t, err)
+
+	for _, test := range []struct {
+		tenant string
+		format string
+		want   RuleSet
+	}{
+		{"acme", "glb", RuleSet{MaxTriangles: 50000, Warn: []Rule{RuleMaxTriangles}}},
+		{"acme", "usdz", RuleSet{UnitsInMeters: true}},
+		{"globex", "usdz", RuleSet{MaxTriangles: 1000}},
+		{"", "fbx", RuleSet{MaxFileSize: 100}},
+	} {
+		ruleSet, ok := budgets.Lookup(test.tenant, test.format)
+		assert.True(t, ok, test.tenant+" "+test.format)
+		assert.Equal(t, test.want, ruleSet, test.tenant+" "+test.format)
+	}
+
+	_, ok := Budgets{"acme": {"glb": {}}}.Lookup("globex", "glb")
+	assert.False(t, ok)
+}
+
+func TestParseBudgets_RejectsInvalidRuleSets(t *testing.T) {
+	for _, value := range []string{
+		`[]`,
+		`{"*": {"glb": {"maxTriangles": -1}}}`,
+		`{"*": {"glb": {"requiredChannels": ["roughness"]}}}`,
+		`{"*": {"glb": {"namePattern": "[a-z"}}}`,
+		`{"*": {"glb": {"warn": ["maxPolygons"]}}}`,
+	} {
+		_, err := ParseBudgets(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestCheckModel_ReportsEveryBrokenRule(t *testing.T) {
+	ruleSet := RuleSet{
+		MaxTriangles:       10000,
+		MaxTextureSize:     2048,
+		PowerOfTwoTextures: true,
+		RequiredChannels:   []string{ChannelBaseColor, ChannelNormal},
+		UnitsInMeters:      true,
+		NamePattern:        "[a-z_]+",
+		MaxFileSize:        1 << 20,
+		Warn:               []Rule{RulePowerOfTwoTextures, RuleNamePattern},
+	}
+
+	findings := ruleSet.CheckModel(testModel(), testStats())
+
+	assert.Equal(t, []Rule{RuleMaxTriangles, RuleMaxTextureSize, RulePowerOfTwoTextures, RuleRequiredChannels, RuleUnitsInMeters, RuleNamePattern, RuleMaxFileSize}, findingRules(findings))
+	assert.Equal(t, "/images/0", findings[1].Pointer)
+	assert.Equal(t, Finding{Rule: RulePowerOfTwoTextures, Result: ResultWarn, Message: "Image 1 is 1000x512, which is not a power of two", Pointer: "/images/1"}, findings[2])
+	assert.Equal(t, `Material "steel" has no baseColor, normal texture`, findings[3].Message)
+	assert.Equal(t, "/materials/1", findings[3].Pointer)
+	assert.Equal(t, `1 nodes do not match [a-z_]+: "Cube.001"`, findings[5].Message)
+	assert.Equal(t, "/nodes/1", findings[5].Pointer)
+
+	report := NewReport(ruleSet, findings)
+	assert.Equal(t, ResultFail, report.Result)
+	assert.Len(t, report.Rules, 7)
+}
+
+func TestCheckModel_PassesWithinBudget(t *testing.T) {
+	ruleSet := RuleSet{MaxTriangles: 20000, MaxTextureSize: 4096, UnitsInMeters: true, NamePattern: `\S*`}
+
+	stats := testStats()
+	stats.Min, stats.Max = [3]float64{-0.4, 0, -0.4}, [3]float64{0.4, 0.9, 0.4}
+	report := NewReport(ruleSet, ruleSet.CheckModel(testModel(), stats))
+
+	assert.Equal(t, &Report{Result: ResultPass, Rules: []Rule{RuleMaxTriangles, RuleMaxTextureSize, RuleUnitsInMeters, RuleNamePattern}}, report)
+}
+
+func TestCheckBlend_ChecksUnitsAndNames(t *testing.T) {
+	file := &blendfile.File{
+		Scenes:     []string{"Scene", "Imperial", "Unknown"},
+		SceneUnits: []blendfile.Units{{System: blendfile.UnitSystemMetric, ScaleLength: 0.01}, {System: blendfile.UnitSystemImperial, ScaleLength: 1}, {}},
+		Objects:    []string{"a", "B", "C", "D", "E", "F", "G", "h"},
+		Materials:  []string{"oak"},
+	}
+	ruleSet := RuleSet{UnitsInMeters: true, NamePattern: "[a-z]+", MaxTriangles: 10, Warn: []Rule{RuleNamePattern}}
+
+	findings := ruleSet.CheckBlend(file)
+
+	assert.Equal(t, []Rule{RuleUnitsInMeters, RuleUnitsInMeters, RuleNamePattern}, findingRules(findings))
+	assert.Equal(t, `Scene "Scene" has a unit scale of 0.01, models are exported in meters with a unit scale of 1`, findings[0].Message)
+	assert.True(t, findings[0].Source)
+	assert.Equal(t, `6 objects do not match [a-z]+: "B", "C", "D", "E", "F" and 1 more`, findings[2].Message)
+	assert.Equal(t, ResultWarn, findings[2].Result)
+}
+
+func TestNewReport_WarnsWhenNoRuleFails(t *testing.T) {
+	warning := Finding{Rule: RuleNamePattern, Result: ResultWarn}
+	failure := Finding{Rule: RuleMaxTriangles, Result: ResultFail}
+
+	assert.Equal(t, ResultWarn, NewReport(RuleSet{}, []Finding{warning}, nil).Result)
+	assert.Equal(t, ResultFail, NewReport(RuleSet{}, []Finding{warning}, []Finding{failure, warning}).Result)
+	assert.Equal(t, ResultPass, NewReport(RuleSet{}).Result)
+}
+
+func TestReport_SkipAllButListsRulesThatWereNotChecked(t *testing.T) {
+	report := NewReport(RuleSet{MaxTriangles: 10, UnitsInMeters: true, MaxFileSize: 100})
+
+	report.SkipAllBut(SourceRules...)
+
+	assert.Equal(t, []Rule{RuleUnitsInMeters}, report.Rules)
+	assert.Equal(t, []Rule{RuleMaxTriangles, RuleMaxFileSize}, report.Skipped)
+}
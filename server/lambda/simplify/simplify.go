@@ -0,0 +1,557 @@
+// Package simplify reduces triangle meshes by quadric edge collapse. A vertex
+// is only ever collapsed onto one of its neighbours, so a simplified mesh
+// indexes into the original vertices and every attribute they carry, such as
+// normals and texture coordinates, stays valid.
+package simplify
+
+import (
+	"math"
+	"sort"
+)
+
+// Mesh is an indexed triangle list
+type Mesh struct {
+	// Positions holds three coordinates for every vertex
+	Positions []float32
+	// Indices must all be below the number of vertices
+	Indices []uint32
+	// Locked vertices never move, nor do the vertices sharing their position.
+	// It may be nil.
+	Locked []bool
+}
+
+const (
+	// Open borders are weighted heavily so they keep their outline, texture
+	// seams lightly so they stay straight
+	borderWeight = 10
+	seamWeight   = 1
+	// maxPasses bounds the rounds of collapses, in each of which a vertex and
+	// its neighbours take part in at most one collapse
+	maxPasses = 100
+	// minNormalDot rejects collapses that turn a triangle by more than about
+	// 75 degrees, which also catches triangles that would flip
+	minNormalDot = 0.25
+)
+
+type kind uint8
+
+const (
+	// kindManifold vertices are surrounded by triangles and collapse onto any
+	// neighbour
+	kindManifold kind = iota
+	// kindBorder vertices sit on an open edge and only collapse along it
+	kindBorder
+	// kindSeam vertices are one half of a vertex split by a texture seam. The
+	// halves collapse along the seam together.
+	kindSeam
+	kindLocked
+)
+
+// none marks a missing vertex and many a vertex with several open edges in
+// the same direction
+const (
+	none uint32 = math.MaxUint32
+	many uint32 = math.MaxUint32 - 1
+)
+
+// Simplify collapses edges of the mesh, cheapest first, until at most target
+// triangles are left or no edge can be collapsed without breaking a border, a
+// seam or the orientation of a triangle. It returns the new indices.
+func Simplify(mesh Mesh, target int) []uint32 {
+	indices := withoutDegenerates(mesh.Indices)
+	var quadrics []quadric
+	for pass := 0; pass < maxPasses && len(indices)/3 > max(target, 0); pass++ {
+		s := newSimplifier(mesh, indices)
+		if quadrics == nil {
+			quadrics = s.quadrics()
+		}
+		collapse, ok := s.collapse(quadrics, len(indices)/3-target)
+		if !ok {
+			break
+		}
+		for i, v := range indices {
+			indices[i] = collapse[v]
+		}
+		indices = withoutDegenerates(indices)
+	}
+	return indices
+}
+
+// withoutDegenerates copies the triangles that use three distinct vertices
+func withoutDegenerates(indices []uint32) []uint32 {
+	kept := make([]uint32, 0, len(indices)/3*3)
+	for i := 0; i+2 < len(indices); i += 3 {
+		a, b, c := indices[i], indices[i+1], indices[i+2]
+		if a != b && b != c && c != a {
+			kept = append(kept, a, b, c)
+		}
+	}
+	return kept
+}
+
+type vec3 [3]float64
+
+func (a vec3) sub(b vec3) vec3 {
+	return vec3{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func (a vec3) dot(b vec3) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func (a vec3) cross(b vec3) vec3 {
+	return vec3{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+func (a vec3) length() float64 {
+	return math.Sqrt(a.dot(a))
+}
+
+func (a vec3) scale(f float64) vec3 {
+	return vec3{a[0] * f, a[1] * f, a[2] * f}
+}
+
+func position(positions []float32, v uint32) vec3 {
+	return vec3{float64(positions[3*v]), float64(positions[3*v+1]), float64(positions[3*v+2])}
+}
+
+// quadric is the symmetric matrix of the squared distance to a set of planes,
+// stored as its upper triangle: a², ab, ac, ad, b², bc, bd, c², cd, d²
+type quadric [10]float64
+
+// planeQuadric is the weighted squared distance to the plane n·p + d = 0, n
+// being of unit length
+func planeQuadric(n vec3, d float64, weight float64) quadric {
+	a, b, c := n[0], n[1], n[2]
+	q := quadric{a * a, a * b, a * c, a * d, b * b, b * c, b * d, c * c, c * d, d * d}
+	for i := range q {
+		q[i] *= weight
+	}
+	return q
+}
+
+func (q *quadric) add(other quadric) {
+	for i := range q {
+		q[i] += other[i]
+	}
+}
+
+func (q quadric) error(p vec3) float64 {
+	x, y, z := p[0], p[1], p[2]
+	return q[0]*x*x + 2*q[1]*x*y + 2*q[2]*x*z + 2*q[3]*x +
+		q[4]*y*y + 2*q[5]*y*z + 2*q[6]*y +
+		q[7]*z*z + 2*q[8]*z + q[9]
+}
+
+func edgeKey(a uint32, b uint32) uint64 {
+	return uint64(a)<<32 | uint64(b)
+}
+
+// quadrics sums for every vertex the planes of the triangles around its
+// position, and planes through open edges that keep borders and seams in
+// place. Vertices sharing a position get the same quadric.
+func (s *simplifier) quadrics() []quadric {
+	indices := s.indices
+	byPosition := map[uint32]*quadric{}
+	at := func(v uint32) *quadric {
+		q, ok := byPosition[s.remap[v]]
+		if !ok {
+			q = &quadric{}
+			byPosition[s.remap[v]] = q
+		}
+		return q
+	}
+
+	for t := 0; t < len(indices); t += 3 {
+		corners := [3]uint32{indices[t], indices[t+1], indices[t+2]}
+		p0, p1, p2 := s.positions[corners[0]], s.positions[corners[1]], s.positions[corners[2]]
+		normal := p1.sub(p0).cross(p2.sub(p0))
+		doubleArea := normal.length()
+		if doubleArea == 0 {
+			continue
+		}
+		normal = normal.scale(1 / doubleArea)
+		face := planeQuadric(normal, -normal.dot(p0), doubleArea/2)
+		for _, v := range corners {
+			at(v).add(face)
+		}
+
+		for e := 0; e < 3; e++ {
+			a, b := corners[e], corners[(e+1)%3]
+			if s.edges[edgeKey(b, a)] {
+				continue
+			}
+			weight := float64(borderWeight)
+			// The other side of the edge exists with other vertices, so the
+			// edge is a seam rather than a border
+			if s.positionEdges[edgeKey(s.remap[b], s.remap[a])] {
+				weight = seamWeight
+			}
+			edge := s.positions[b].sub(s.positions[a])
+			perpendicular := edge.cross(normal)
+			length := perpendicular.length()
+			if length == 0 {
+				continue
+			}
+			perpendicular = perpendicular.scale(1 / length)
+			constraint := planeQuadric(perpendicular, -perpendicular.dot(s.positions[a]), weight*edge.dot(edge))
+			at(a).add(constraint)
+			at(b).add(constraint)
+		}
+	}
+
+	quadrics := make([]quadric, len(s.positions))
+	for v := range quadrics {
+		if s.remap[v] != none {
+			quadrics[v] = *at(uint32(v))
+		}
+	}
+	return quadrics
+}
+
+// simplifier holds the topology of the mesh during one pass
+type simplifier struct {
+	positions []vec3
+	indices   []uint32
+	// remap is the first vertex used at the same position, none for vertices
+	// no triangle uses. wedge links the vertices at a position in a cycle.
+	remap []uint32
+	wedge []uint32
+	// edges are the directed edges of the triangles, positionEdges the same
+	// edges between remapped vertices
+	edges         map[uint64]bool
+	positionEdges map[uint64]bool
+	// openOut and openIn are the other end of the open edge leaving and
+	// entering a vertex
+	openOut []uint32
+	openIn  []uint32
+	kinds   []kind
+	// triangles lists the triangles around each vertex, starting at offsets
+	offsets   []int
+	triangles []int
+}
+
+func newSimplifier(mesh Mesh, indices []uint32) *simplifier {
+	count := len(mesh.Positions) / 3
+	s := &simplifier{
+		positions:     make([]vec3, count),
+		indices:       indices,
+		remap:         make([]uint32, count),
+		wedge:         make([]uint32, count),
+		edges:         make(map[uint64]bool, len(indices)),
+		positionEdges: make(map[uint64]bool, len(indices)),
+		openOut:       make([]uint32, count),
+		openIn:        make([]uint32, count),
+		kinds:         make([]kind, count),
+		offsets:       make([]int, count+1),
+		triangles:     make([]int, len(indices)),
+	}
+	for v := range s.positions {
+		s.positions[v] = position(mesh.Positions, uint32(v))
+		s.remap[v], s.wedge[v] = none, uint32(v)
+		s.openOut[v], s.openIn[v] = none, none
+	}
+
+	firsts := map[[3]float32]uint32{}
+	for _, v := range indices {
+		if s.remap[v] != none {
+			continue
+		}
+		key := [3]float32{mesh.Positions[3*v], mesh.Positions[3*v+1], mesh.Positions[3*v+2]}
+		first, ok := firsts[key]
+		if !ok {
+			firsts[key] = v
+			s.remap[v] = v
+			continue
+		}
+		s.remap[v] = first
+		s.wedge[v], s.wedge[first] = s.wedge[first], v
+	}
+
+	for t := 0; t < len(indices); t += 3 {
+		for e := 0; e < 3; e++ {
+			a, b := indices[t+e], indices[t+(e+1)%3]
+			s.edges[edgeKey(a, b)] = true
+			s.positionEdges[edgeKey(s.remap[a], s.remap[b])] = true
+		}
+	}
+	for t := 0; t < len(indices); t += 3 {
+		for e := 0; e < 3; e++ {
+			a, b := indices[t+e], indices[t+(e+1)%3]
+			if !s.edges[edgeKey(b, a)] {
+				s.openOut[a] = link(s.openOut[a], b)
+				s.openIn[b] = link(s.openIn[b], a)
+			}
+		}
+	}
+
+	for v := range s.kinds {
+		s.kinds[v] = s.classify(uint32(v))
+	}
+	for v, locked := range mesh.Locked {
+		if !locked || v >= count || s.remap[v] == none {
+			continue
+		}
+		for w := uint32(v); ; {
+			s.kinds[w] = kindLocked
+			if w = s.wedge[w]; w == uint32(v) {
+				break
+			}
+		}
+	}
+
+	for _, v := range indices {
+		s.offsets[v+1]++
+	}
+	for v := 0; v < count; v++ {
+		s.offsets[v+1] += s.offsets[v]
+	}
+	filled := append([]int{}, s.offsets[:count]...)
+	for i, v := range indices {
+		s.triangles[filled[v]] = i / 3
+		filled[v]++
+	}
+	return s
+}
+
+// link records another open edge end, which is many once there are two
+func link(current uint32, v uint32) uint32 {
+	if current == none || current == v {
+		return v
+	}
+	return many
+}
+
+func (s *simplifier) classify(v uint32) kind {
+	if s.remap[v] == none {
+		return kindLocked
+	}
+	twin := s.wedge[v]
+	single := func(v uint32) bool { return s.openOut[v] < many && s.openIn[v] < many }
+	switch {
+	case twin == v:
+		if s.openOut[v] == none && s.openIn[v] == none {
+			return kindManifold
+		}
+		if single(v) {
+			return kindBorder
+		}
+	case s.wedge[twin] == v && single(v) && single(twin):
+		// Both halves of a seam have an open edge each way, leading to the
+		// same positions in opposite directions
+		if s.remap[s.openOut[v]] == s.remap[s.openIn[twin]] && s.remap[s.openIn[v]] == s.remap[s.openOut[twin]] {
+			return kindSeam
+		}
+	}
+	return kindLocked
+}
+
+// along reports whether from and to share an open edge
+func (s *simplifier) along(from uint32, to uint32) bool {
+	return s.openOut[from] == to || s.openIn[from] == to
+}
+
+// target checks that from may collapse onto to. Seam vertices take their twin
+// along, which is returned with the vertex it collapses onto.
+func (s *simplifier) target(from uint32, to uint32) (uint32, uint32, bool) {
+	switch s.kinds[from] {
+	case kindManifold:
+		return none, none, true
+	case kindBorder:
+		return none, none, s.along(from, to) && (s.kinds[to] == kindBorder || s.kinds[to] == kindLocked)
+	case kindSeam:
+		if !s.along(from, to) || (s.kinds[to] != kindSeam && s.kinds[to] != kindLocked) {
+			return none, none, false
+		}
+		twin := s.wedge[from]
+		for k := to; ; {
+			if s.along(twin, k) {
+				return twin, k, true
+			}
+			if k = s.wedge[k]; k == to {
+				break
+			}
+		}
+	}
+	return none, none, false
+}
+
+func (s *simplifier) trianglesAround(v uint32) []int {
+	return s.triangles[s.offsets[v]:s.offsets[v+1]]
+}
+
+func (s *simplifier) corner(t int, i int) uint32 {
+	return s.indices[3*t+i]
+}
+
+func (s *simplifier) hasCorner(t int, v uint32) bool {
+	return s.corner(t, 0) == v || s.corner(t, 1) == v || s.corner(t, 2) == v
+}
+
+// keepsOrientation checks that moving from onto to turns none of the
+// triangles that remain around from too far
+func (s *simplifier) keepsOrientation(from uint32, to uint32) bool {
+	for _, t := range s.trianglesAround(from) {
+		if s.hasCorner(t, to) {
+			continue
+		}
+		var before, after [3]vec3
+		for i := range before {
+			v := s.corner(t, i)
+			before[i], after[i] = s.positions[v], s.positions[v]
+			if v == from {
+				after[i] = s.positions[to]
+			}
+		}
+		n0 := before[1].sub(before[0]).cross(before[2].sub(before[0]))
+		n1 := after[1].sub(after[0]).cross(after[2].sub(after[0]))
+		length := n0.length() * n1.length()
+		if length == 0 || n0.dot(n1) < minNormalDot*length {
+			return false
+		}
+	}
+	return true
+}
+
+// neighbours collects the positions around the position of v
+func (s *simplifier) neighbours(v uint32) map[uint32]bool {
+	found := map[uint32]bool{}
+	for w := v; ; {
+		for _, t := range s.trianglesAround(w) {
+			for i := 0; i < 3; i++ {
+				if p := s.remap[s.corner(t, i)]; p != s.remap[v] {
+					found[p] = true
+				}
+			}
+		}
+		if w = s.wedge[w]; w == v {
+			break
+		}
+	}
+	return found
+}
+
+// keepsManifold checks the link condition: the only positions next to both
+// ends of the edge are those of the triangles on the edge, otherwise the
+// collapse would fold the surface onto itself
+func (s *simplifier) keepsManifold(from uint32, to uint32) bool {
+	fromPosition, toPosition := s.remap[from], s.remap[to]
+	opposite := map[uint32]bool{}
+	for w := from; ; {
+		for _, t := range s.trianglesAround(w) {
+			hasTo := false
+			for i := 0; i < 3; i++ {
+				hasTo = hasTo || s.remap[s.corner(t, i)] == toPosition
+			}
+			if !hasTo {
+				continue
+			}
+			for i := 0; i < 3; i++ {
+				if p := s.remap[s.corner(t, i)]; p != fromPosition && p != toPosition {
+					opposite[p] = true
+				}
+			}
+		}
+		if w = s.wedge[w]; w == from {
+			break
+		}
+	}
+	toNeighbours := s.neighbours(to)
+	for p := range s.neighbours(from) {
+		if p != toPosition && toNeighbours[p] && !opposite[p] {
+			return false
+		}
+	}
+	return true
+}
+
+type collapse struct {
+	from, to         uint32
+	twinFrom, twinTo uint32
+	cost             float64
+}
+
+// candidate returns the cheaper valid direction of collapsing an edge
+func (s *simplifier) candidate(quadrics []quadric, a uint32, b uint32) (collapse, bool) {
+	best := collapse{cost: math.Inf(1)}
+	for _, pair := range [2][2]uint32{{a, b}, {b, a}} {
+		from, to := pair[0], pair[1]
+		twinFrom, twinTo, ok := s.target(from, to)
+		if !ok {
+			continue
+		}
+		cost := quadrics[from].error(s.positions[to])
+		if cost < best.cost {
+			best = collapse{from: from, to: to, twinFrom: twinFrom, twinTo: twinTo, cost: cost}
+		}
+	}
+	return best, !math.IsInf(best.cost, 1)
+}
+
+// collapse picks the cheapest collapses of one pass, touching every position
+// at most once, until excess triangles are gone. It returns where every vertex
+// goes, and false when nothing could be collapsed.
+func (s *simplifier) collapse(quadrics []quadric, excess int) ([]uint32, bool) {
+	seen := map[uint64]bool{}
+	var candidates []collapse
+	for t := 0; t < len(s.indices); t += 3 {
+		for e := 0; e < 3; e++ {
+			a, b := s.indices[t+e], s.indices[t+(e+1)%3]
+			key := edgeKey(min(a, b), max(a, b))
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if c, ok := s.candidate(quadrics, a, b); ok {
+				candidates = append(candidates, c)
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].cost < candidates[j].cost })
+
+	result := make([]uint32, len(s.positions))
+	for v := range result {
+		result[v] = uint32(v)
+	}
+	touched := map[uint32]bool{}
+	removed := 0
+	for _, c := range candidates {
+		if removed >= excess {
+			break
+		}
+		if touched[s.remap[c.from]] || touched[s.remap[c.to]] {
+			continue
+		}
+		if !s.keepsOrientation(c.from, c.to) || !s.keepsManifold(c.from, c.to) {
+			continue
+		}
+		if c.twinFrom != none && !s.keepsOrientation(c.twinFrom, c.twinTo) {
+			continue
+		}
+
+		for _, pair := range [2][2]uint32{{c.from, c.to}, {c.twinFrom, c.twinTo}} {
+			from, to := pair[0], pair[1]
+			if from == none {
+				continue
+			}
+			result[from] = to
+			for _, t := range s.trianglesAround(from) {
+				if s.hasCorner(t, to) {
+					removed++
+				}
+				for i := 0; i < 3; i++ {
+					touched[s.remap[s.corner(t, i)]] = true
+				}
+			}
+		}
+		// The twin shares the quadric of from, so it is only added once to
+		// every vertex at the target position
+		for w := c.to; ; {
+			quadrics[w].add(quadrics[c.from])
+			if w = s.wedge[w]; w == c.to {
+				break
+			}
+		}
+	}
+	return result, len(touched) > 0
+}
@@ -0,0 +1,172 @@
+package simplify
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// grid is a flat square of size×size quads. With a seam column, the vertices
+// of that column are split in two, the right half using copies.
+func grid(size int, seam int) Mesh {
+	var mesh Mesh
+	vertex := func(x int, y int) uint32 {
+		return uint32(y*(size+1) + x)
+	}
+	for y := 0; y <= size; y++ {
+		for x := 0; x <= size; x++ {
+			mesh.Positions = append(mesh.Positions, float32(x), float32(y), 0)
+		}
+	}
+	copies := map[uint32]uint32{}
+	for y := 0; y <= size && seam > 0; y++ {
+		copies[vertex(seam, y)] = uint32(len(mesh.Positions) / 3)
+		mesh.Positions = append(mesh.Positions, float32(seam), float32(y), 0)
+	}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			quad := []uint32{vertex(x, y), vertex(x+1, y), vertex(x+1, y+1), vertex(x, y), vertex(x+1, y+1), vertex(x, y+1)}
+			for i, v := range quad {
+				if copy, ok := copies[v]; ok && x >= seam {
+					quad[i] = copy
+				}
+			}
+			mesh.Indices = append(mesh.Indices, quad...)
+		}
+	}
+	return mesh
+}
+
+// sphere is a closed latitude and longitude sphere of radius 1
+func sphere(rings int, segments int) Mesh {
+	mesh := Mesh{Positions: []float32{0, 1, 0, 0, -1, 0}}
+	for ring := 1; ring < rings; ring++ {
+		theta := math.Pi * float64(ring) / float64(rings)
+		for segment := 0; segment < segments; segment++ {
+			phi := 2 * math.Pi * float64(segment) / float64(segments)
+			mesh.Positions = append(mesh.Positions, float32(math.Sin(theta)*math.Cos(phi)), float32(math.Cos(theta)), float32(math.Sin(theta)*math.Sin(phi)))
+		}
+	}
+	vertex := func(ring int, segment int) uint32 {
+		return uint32(2 + (ring-1)*segments + segment%segments)
+	}
+	for segment := 0; segment < segments; segment++ {
+		mesh.Indices = append(mesh.Indices, 0, vertex(1, segment+1), vertex(1, segment))
+		mesh.Indices = append(mesh.Indices, 1, vertex(rings-1, segment), vertex(rings-1, segment+1))
+		for ring := 1; ring < rings-1; ring++ {
+			a, b := vertex(ring, segment), vertex(ring, segment+1)
+			c, d := vertex(ring+1, segment), vertex(ring+1, segment+1)
+			mesh.Indices = append(mesh.Indices, a, b, d, a, d, c)
+		}
+	}
+	return mesh
+}
+
+func volume(mesh Mesh, indices []uint32) float64 {
+	total := 0.0
+	for t := 0; t < len(indices); t += 3 {
+		a := position(mesh.Positions, indices[t])
+		b := position(mesh.Positions, indices[t+1])
+		c := position(mesh.Positions, indices[t+2])
+		total += a.dot(b.cross(c)) / 6
+	}
+	return total
+}
+
+func usesVertex(indices []uint32, v uint32) bool {
+	for _, index := range indices {
+		if index == v {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSimplify_ReducesClosedMeshKeepingItsVolume(t *testing.T) {
+	mesh := sphere(16, 32)
+	original := volume(mesh, mesh.Indices)
+
+	indices := Simplify(mesh, 240)
+
+	assert.LessOrEqual(t, len(indices)/3, 240)
+	assert.Greater(t, len(indices)/3, 200)
+	assert.InDelta(t, original, volume(mesh, indices), original*0.1)
+}
+
+func TestSimplify_KeepsTheOutlineOfOpenMeshes(t *testing.T) {
+	mesh := grid(10, 0)
+
+	indices := Simplify(mesh, 20)
+
+	assert.LessOrEqual(t, len(indices)/3, 20)
+	for _, corner := range []uint32{0, 10, 110, 120} {
+		assert.True(t, usesVertex(indices, corner), "corner %d", corner)
+	}
+	// Every triangle still faces up
+	for t0 := 0; t0 < len(indices); t0 += 3 {
+		a, b, c := position(mesh.Positions, indices[t0]), position(mesh.Positions, indices[t0+1]), position(mesh.Positions, indices[t0+2])
+		assert.Greater(t, b.sub(a).cross(c.sub(a))[2], 0.0)
+	}
+}
+
+func TestSimplify_CollapsesSeamsOnBothSides(t *testing.T) {
+	mesh := grid(8, 4)
+
+	indices := Simplify(mesh, 24)
+
+	assert.LessOrEqual(t, len(indices)/3, 24)
+	// Every edge inside the square still has a matching edge the other way,
+	// so the seam did not open a crack
+	edges := map[[2][3]float32]bool{}
+	corner := func(v uint32) [3]float32 {
+		return [3]float32{mesh.Positions[3*v], mesh.Positions[3*v+1], mesh.Positions[3*v+2]}
+	}
+	for t0 := 0; t0 < len(indices); t0 += 3 {
+		for e := 0; e < 3; e++ {
+			edges[[2][3]float32{corner(indices[t0+e]), corner(indices[t0+(e+1)%3])}] = true
+		}
+	}
+	onOutline := func(p [3]float32, q [3]float32) bool {
+		for axis := 0; axis < 2; axis++ {
+			if p[axis] == q[axis] && (p[axis] == 0 || p[axis] == 8) {
+				return true
+			}
+		}
+		return false
+	}
+	for edge := range edges {
+		if !onOutline(edge[0], edge[1]) {
+			assert.True(t, edges[[2][3]float32{edge[1], edge[0]}], "edge %v", edge)
+		}
+	}
+	// Triangles right of the seam keep using its copies
+	for t0 := 0; t0 < len(indices); t0 += 3 {
+		copies, left := false, false
+		for _, v := range indices[t0 : t0+3] {
+			copies = copies || v > 80
+			left = left || (v <= 80 && corner(v)[0] <= 4)
+		}
+		assert.False(t, copies && left, "triangle %d mixes both halves", t0/3)
+	}
+}
+
+func TestSimplify_NeverMovesLockedVertices(t *testing.T) {
+	mesh := grid(6, 0)
+	mesh.Locked = make([]bool, len(mesh.Positions)/3)
+	mesh.Locked[24] = true
+
+	indices := Simplify(mesh, 4)
+
+	assert.True(t, usesVertex(indices, 24))
+	assert.Less(t, len(indices)/3, 72)
+}
+
+func TestSimplify_LeavesMeshesAtTheTargetAlone(t *testing.T) {
+	mesh := grid(2, 0)
+	mesh.Indices = append(mesh.Indices, 0, 0, 1)
+
+	indices := Simplify(mesh, 8)
+
+	assert.Equal(t, mesh.Indices[:24], indices)
+}
@@ -0,0 +1,151 @@
+package usd
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/gltf"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testPNG = []byte("\x89PNG\r\n\x1a\nnot really an image")
+
+func dataURI(mimeType string, data []byte) string {
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// testModel is a textured triangle under a translated and rotated node, with
+// a second material whose texture USDZ cannot hold
+func testModel(t *testing.T) *gltf.Model {
+	positions := []byte{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0x80, 0x3f, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0x80, 0x3f, 0, 0, 0, 0,
+	}
+	texCoords := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x80, 0x3f, 0, 0, 0x80, 0x3f, 0, 0, 0, 0, 0, 0, 0x80, 0x3f}
+	buffer := append(append([]byte{}, positions...), texCoords...)
+	document := fmt.Sprintf(`{
+		"asset": {"version": "2.0"},
+		"scene": 0,
+		"scenes": [{"nodes": [0]}],
+		"nodes": [
+			{"name": "Body Panel", "translation": [1, 2, 3], "rotation": [0, 0.7071068, 0, 0.7071068], "children": [1]},
+			{"name": "1st", "mesh": 0, "matrix": [1,0,0,0, 0,1,0,0, 0,0,1,0, 4,5,6,1]}
+		],
+		"meshes": [{"name": "panel", "primitives": [
+			{"attributes": {"POSITION": 0, "TEXCOORD_0": 1}, "material": 0},
+			{"attributes": {"POSITION": 0}, "material": 1, "mode": 6},
+			{"attributes": {"POSITION": 0}, "mode": 1}
+		]}],
+		"accessors": [
+			{"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"},
+			{"bufferView": 1, "componentType": 5126, "count": 3, "type": "VEC2"}
+		],
+		"bufferViews": [{"buffer": 0, "byteLength": 36}, {"buffer": 0, "byteOffset": 36, "byteLength": 24}],
+		"buffers": [{"uri": %q, "byteLength": %d}],
+		"materials": [
+			{"name": "paint", "pbrMetallicRoughness": {"baseColorFactor": [1, 0.5, 0.25, 0.5], "baseColorTexture": {"index": 0}, "metallicFactor": 0}, "alphaMode": "BLEND", "doubleSided": true},
+			{"name": "paint", "pbrMetallicRoughness": {"baseColorTexture": {"index": 1}, "roughnessFactor": 0.25}, "alphaMode": "MASK"}
+		],
+		"samplers": [{"wrapS": 33071}],
+		"textures": [{"source": 0, "sampler": 0}, {"source": 1}],
+		"images": [{"name": "albedo", "uri": %q}, {"uri": %q}]
+	}`, dataURI("application/octet-stream", buffer), len(buffer), dataURI("image/png", testPNG), dataURI("image/webp", []byte("RIFF....WEBP")))
+
+	model, err := gltf.Read([]byte(document), nil)
+	assert.NoError(t, err)
+	return model
+}
+
+func TestFromGLTF(t *testing.T) {
+	files, err := FromGLTF(testModel(t), "model")
+	assert.NoError(t, err)
+	if !assert.Len(t, files, 2) {
+		return
+	}
+	assert.Equal(t, "textures/albedo.png", files[1].Path)
+	assert.Equal(t, testPNG, files[1].Data)
+
+	assert.Equal(t, "model.usda", files[0].Path)
+	layer := string(files[0].Data)
+	for _, expected := range []string{
+		"#usda 1.0\n",
+		`defaultPrim = "Root"`,
+		`upAxis = "Y"`,
+		`def Xform "Body_Panel"`,
+		"double3 xformOp:translate = (1, 2, 3)",
+		"quatf xformOp:orient = (0.7071068, 0, 0.7071068, 0)",
+		`uniform token[] xformOpOrder = ["xformOp:translate", "xformOp:orient"]`,
+		`def Xform "_1st"`,
+		"matrix4d xformOp:transform = ( (1, 0, 0, 0), (0, 1, 0, 0), (0, 0, 1, 0), (4, 5, 6, 1) )",
+		`def Mesh "panel"`,
+		`def Mesh "panel_1"`,
+		"int[] faceVertexIndices = [0, 1, 2]",
+		"point3f[] points = [(0, 0, 0), (1, 0, 0), (0, 1, 0)]",
+		"texCoord2f[] primvars:st = [(0, 1), (1, 0), (0, 0)]",
+		"rel material:binding = </Root/Materials/paint>",
+		"rel material:binding = </Root/Materials/paint_1>",
+		"uniform bool doubleSided = 1",
+		"color3f inputs:diffuseColor.connect = </Root/Materials/paint/baseColorTexture.outputs:rgb>",
+		"float inputs:opacity.connect = </Root/Materials/paint/baseColorTexture.outputs:a>",
+		"float4 inputs:scale = (1, 0.5, 0.25, 0.5)",
+		"asset inputs:file = @textures/albedo.png@",
+		`token inputs:wrapS = "clamp"`,
+		`token inputs:wrapT = "repeat"`,
+		`string inputs:varname = "st"`,
+		"float inputs:metallic = 0",
+		"float inputs:roughness = 0.25",
+		"float inputs:opacityThreshold = 0.5",
+	} {
+		assert.Contains(t, layer, expected)
+	}
+	assert.NotContains(t, layer, "webp", "unsupported textures fall back to factors")
+	assert.Equal(t, 2, strings.Count(layer, "def Mesh"), "lines are left out")
+	assert.Equal(t, strings.Count(layer, "{"), strings.Count(layer, "}"))
+}
+
+func TestPackage_AlignsEveryEntry(t *testing.T) {
+	files := []File{
+		{Path: "model.usda", Data: []byte("#usda 1.0\n")},
+		{Path: "textures/a.png", Data: testPNG},
+		{Path: "textures/ab.png", Data: bytes.Repeat([]byte{1}, 61)},
+		{Path: "textures/abc.jpg", Data: []byte("\xff\xd8\xff")},
+	}
+	usdz, err := Package(files)
+	assert.NoError(t, err)
+
+	reader, err := zip.NewReader(bytes.NewReader(usdz), int64(len(usdz)))
+	assert.NoError(t, err)
+	if !assert.Len(t, reader.File, len(files)) {
+		return
+	}
+	for i, file := range reader.File {
+		assert.Equal(t, files[i].Path, file.Name)
+		assert.Equal(t, zip.Store, file.Method)
+		offset, err := file.DataOffset()
+		assert.NoError(t, err)
+		assert.Zero(t, offset%64, file.Name)
+
+		rc, err := file.Open()
+		assert.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		assert.NoError(t, err)
+		assert.Equal(t, files[i].Data, data)
+	}
+}
+
+func TestPackage_Rejections(t *testing.T) {
+	_, err := Package([]File{{Path: "textures/a.png"}, {Path: "model.usda"}})
+	assert.ErrorContains(t, err, "must be a USD layer")
+
+	_, err = Package([]File{{Path: "model.usda"}, {Path: "../a.png"}})
+	assert.ErrorContains(t, err, "not a relative package path")
+
+	_, err = Package([]File{{Path: "model.usda"}, {Path: "model.usda"}})
+	assert.ErrorContains(t, err, "appears twice")
+}
@@ -0,0 +1,553 @@
+// Package usd writes glTF scenes as USDA layers with UsdPreviewSurface
+// materials and packages them, with their textures, as USDZ archives for
+// AR Quick Look.
+package usd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"vibeIQ-take-home-3d-model-loader-poc/lambda/gltf"
+)
+
+// File is one file of a USDZ package, Path is relative to the archive root
+type File struct {
+	Path string
+	Data []byte
+}
+
+// textureMimeTypes are the image types USDZ packages may contain
+var textureMimeTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+}
+
+var wrapModes = map[int]string{
+	10497: "repeat",
+	33071: "clamp",
+	33648: "mirror",
+}
+
+// FromGLTF converts the default scene of a glTF model to a USDA layer named
+// name.usda, followed by the textures it references. Points and lines have
+// no USD preview representation and are left out, as are textures in formats
+// USDZ does not allow, whose materials fall back to their factors.
+func FromGLTF(model *gltf.Model, name string) ([]File, error) {
+	c := &converter{model: model, textures: map[int]string{}, fileNames: map[string]bool{}}
+	c.line("#usda 1.0")
+	c.open("(")
+	c.line(`defaultPrim = "Root"`)
+	c.line("metersPerUnit = 1")
+	c.line(`upAxis = "Y"`)
+	c.close(")")
+	c.line("")
+
+	c.line(`def Xform "Root" (`)
+	c.indent++
+	c.line(`kind = "component"`)
+	c.indent--
+	c.line(")")
+	c.open("{")
+	c.materialPaths = make([]string, len(model.Document.Materials))
+	if len(model.Document.Materials) > 0 {
+		c.line(`def Scope "Materials"`)
+		c.open("{")
+		names := map[string]bool{}
+		for i, material := range model.Document.Materials {
+			primName := uniqueName(names, identifier(material.Name, fmt.Sprintf("Material_%d", i)))
+			c.materialPaths[i] = "/Root/Materials/" + primName
+			c.material(material, primName)
+		}
+		c.close("}")
+	}
+
+	names := map[string]bool{"Materials": true}
+	visited := make([]bool, len(model.Document.Nodes))
+	for _, root := range model.Document.SceneRoots() {
+		if err := c.node(root, names, visited); err != nil {
+			return nil, err
+		}
+	}
+	c.close("}")
+
+	files := []File{{Path: name + ".usda", Data: []byte(c.out.String())}}
+	return append(files, c.files...), nil
+}
+
+type converter struct {
+	model  *gltf.Model
+	out    strings.Builder
+	indent int
+
+	materialPaths []string
+	// textures maps image indices to their path in the package
+	textures  map[int]string
+	fileNames map[string]bool
+	files     []File
+}
+
+func (c *converter) line(format string, args ...any) {
+	if format != "" {
+		c.out.WriteString(strings.Repeat("    ", c.indent))
+		fmt.Fprintf(&c.out, format, args...)
+	}
+	c.out.WriteByte('\n')
+}
+
+func (c *converter) open(token string) {
+	c.line(token)
+	c.indent++
+}
+
+func (c *converter) close(token string) {
+	c.indent--
+	c.line(token)
+}
+
+func (c *converter) node(index int, siblings map[string]bool, visited []bool) error {
+	doc := c.model.Document
+	if index < 0 || index >= len(doc.Nodes) {
+		return fmt.Errorf("%w: missing node %d", gltf.ErrInvalid, index)
+	}
+	if visited[index] {
+		return fmt.Errorf("%w: node %d appears more than once in the scene", gltf.ErrInvalid, index)
+	}
+	visited[index] = true
+	node := doc.Nodes[index]
+
+	c.line("")
+	c.line(`def Xform "%s"`, uniqueName(siblings, identifier(node.Name, fmt.Sprintf("Node_%d", index))))
+	c.open("{")
+	c.transform(node)
+	children := map[string]bool{}
+	if node.Mesh != nil {
+		if *node.Mesh < 0 || *node.Mesh >= len(doc.Meshes) {
+			return fmt.Errorf("%w: node %d references missing mesh %d", gltf.ErrInvalid, index, *node.Mesh)
+		}
+		mesh := doc.Meshes[*node.Mesh]
+		meshName := identifier(mesh.Name, fmt.Sprintf("Mesh_%d", *node.Mesh))
+		for _, primitive := range mesh.Primitives {
+			if err := c.primitive(primitive, uniqueName(children, meshName)); err != nil {
+				return fmt.Errorf("mesh %d: %w", *node.Mesh, err)
+			}
+		}
+	}
+	for _, child := range node.Children {
+		if err := c.node(child, children, visited); err != nil {
+			return err
+		}
+	}
+	c.close("}")
+	return nil
+}
+
+func (c *converter) transform(node gltf.Node) {
+	if len(node.Matrix) == 16 {
+		m := node.Matrix
+		// glTF matrices are column-major for column vectors, USD matrices are
+		// row-major for row vectors, so the same 16 numbers read in order
+		c.line("matrix4d xformOp:transform = ( (%s), (%s), (%s), (%s) )",
+			floats64(m[0:4]), floats64(m[4:8]), floats64(m[8:12]), floats64(m[12:16]))
+		c.line(`uniform token[] xformOpOrder = ["xformOp:transform"]`)
+		return
+	}
+	var order []string
+	if len(node.Translation) == 3 {
+		c.line("double3 xformOp:translate = (%s)", floats64(node.Translation))
+		order = append(order, `"xformOp:translate"`)
+	}
+	if len(node.Rotation) == 4 {
+		r := node.Rotation
+		c.line("quatf xformOp:orient = (%s)", floats64([]float64{r[3], r[0], r[1], r[2]}))
+		order = append(order, `"xformOp:orient"`)
+	}
+	if len(node.Scale) == 3 {
+		c.line("float3 xformOp:scale = (%s)", floats64(node.Scale))
+		order = append(order, `"xformOp:scale"`)
+	}
+	if len(order) > 0 {
+		c.line("uniform token[] xformOpOrder = [%s]", strings.Join(order, ", "))
+	}
+}
+
+func (c *converter) primitive(primitive gltf.Primitive, primName string) error {
+	position, ok := primitive.Attributes["POSITION"]
+	if !ok {
+		return nil
+	}
+	triangles, err := c.model.Triangles(primitive)
+	if err != nil {
+		return err
+	}
+	if len(triangles) == 0 {
+		return nil
+	}
+	points, _, err := c.model.Floats(position)
+	if err != nil {
+		return err
+	}
+	for _, index := range triangles {
+		if int(index)*3 >= len(points) {
+			return fmt.Errorf("%w: index %d is out of range", gltf.ErrInvalid, index)
+		}
+	}
+
+	bound := primitive.Material != nil && *primitive.Material >= 0 && *primitive.Material < len(c.materialPaths)
+	c.line("")
+	if bound {
+		c.line(`def Mesh "%s" (`, primName)
+		c.indent++
+		c.line(`prepend apiSchemas = ["MaterialBindingAPI"]`)
+		c.indent--
+		c.line(")")
+	} else {
+		c.line(`def Mesh "%s"`, primName)
+	}
+	c.open("{")
+	minimum, maximum := extent(points)
+	c.line("float3[] extent = [(%s), (%s)]", floats(minimum[:]), floats(maximum[:]))
+	counts := make([]string, len(triangles)/3)
+	for i := range counts {
+		counts[i] = "3"
+	}
+	c.line("int[] faceVertexCounts = [%s]", strings.Join(counts, ", "))
+	c.line("int[] faceVertexIndices = [%s]", uints(triangles))
+	if bound {
+		c.line("rel material:binding = <%s>", c.materialPaths[*primitive.Material])
+	}
+	c.line("point3f[] points = [%s]", tuples(points, 3))
+	if normal, ok := primitive.Attributes["NORMAL"]; ok {
+		if values, _, err := c.model.Floats(normal); err == nil && len(values) == len(points) {
+			c.primvar("normal3f[] normals", tuples(values, 3))
+		}
+	}
+	for set, primvar := range []string{"st", "st1"} {
+		texCoord, ok := primitive.Attributes[fmt.Sprintf("TEXCOORD_%d", set)]
+		if !ok {
+			continue
+		}
+		values, _, err := c.model.Floats(texCoord)
+		if err != nil || len(values)/2 != len(points)/3 {
+			continue
+		}
+		// glTF puts the origin of texture space at the top left, USD at the
+		// bottom left
+		for i := 1; i < len(values); i += 2 {
+			values[i] = 1 - values[i]
+		}
+		c.primvar("texCoord2f[] primvars:"+primvar, tuples(values, 2))
+	}
+	if color, ok := primitive.Attributes["COLOR_0"]; ok {
+		if values, components, err := c.model.Floats(color); err == nil && len(values)/components == len(points)/3 {
+			rgb := make([]float32, 0, len(points))
+			for i := 0; i+2 < len(values); i += components {
+				rgb = append(rgb, values[i], values[i+1], values[i+2])
+			}
+			c.primvar("color3f[] primvars:displayColor", tuples(rgb, 3))
+		}
+	}
+	c.line(`uniform token subdivisionScheme = "none"`)
+	if bound && c.model.Document.Materials[*primitive.Material].DoubleSided {
+		c.line("uniform bool doubleSided = 1")
+	}
+	c.close("}")
+	return nil
+}
+
+func (c *converter) primvar(declaration string, values string) {
+	c.line("%s = [%s] (", declaration, values)
+	c.indent++
+	c.line(`interpolation = "vertex"`)
+	c.indent--
+	c.line(")")
+}
+
+// textureInput is one UsdUVTexture feeding a UsdPreviewSurface input
+type textureInput struct {
+	shader     string
+	info       *gltf.TextureInfo
+	colorSpace string
+	scale      [4]float64
+	bias       [4]float64
+}
+
+func (c *converter) material(material gltf.Material, primName string) {
+	path := "/Root/Materials/" + primName
+	pbr := material.PBRMetallicRoughness
+	if pbr == nil {
+		pbr = &gltf.PBRMetallicRoughness{}
+	}
+	baseColor := [4]float64{1, 1, 1, 1}
+	copy(baseColor[:], pbr.BaseColorFactor)
+	metallic, roughness := 1.0, 1.0
+	if pbr.MetallicFactor != nil {
+		metallic = *pbr.MetallicFactor
+	}
+	if pbr.RoughnessFactor != nil {
+		roughness = *pbr.RoughnessFactor
+	}
+	emissive := [3]float64{0, 0, 0}
+	copy(emissive[:], material.EmissiveFactor)
+
+	var textures []textureInput
+	inputs := map[string]string{}
+	connect := func(input textureInput, surfaceInput string, output string) {
+		if _, ok := c.texturePath(input.info); !ok {
+			return
+		}
+		inputs[surfaceInput] = fmt.Sprintf("%s/%s.outputs:%s", path, input.shader, output)
+		for _, existing := range textures {
+			if existing.shader == input.shader {
+				return
+			}
+		}
+		textures = append(textures, input)
+	}
+	if pbr.BaseColorTexture != nil {
+		input := textureInput{shader: "baseColorTexture", info: pbr.BaseColorTexture, colorSpace: "sRGB", scale: baseColor}
+		connect(input, "diffuseColor", "rgb")
+		if material.AlphaMode == "BLEND" || material.AlphaMode == "MASK" {
+			connect(input, "opacity", "a")
+		}
+	}
+	if pbr.MetallicRoughnessTexture != nil {
+		// glTF keeps roughness in the green channel and metalness in the blue
+		input := textureInput{shader: "metallicRoughnessTexture", info: pbr.MetallicRoughnessTexture, colorSpace: "raw", scale: [4]float64{1, roughness, metallic, 1}}
+		connect(input, "roughness", "g")
+		connect(input, "metallic", "b")
+	}
+	if material.NormalTexture != nil {
+		scale := 1.0
+		if material.NormalTexture.Scale != nil {
+			scale = *material.NormalTexture.Scale
+		}
+		connect(textureInput{
+			shader:     "normalTexture",
+			info:       material.NormalTexture,
+			colorSpace: "raw",
+			scale:      [4]float64{2 * scale, 2 * scale, 2, 1},
+			bias:       [4]float64{-scale, -scale, -1, 0},
+		}, "normal", "rgb")
+	}
+	if material.OcclusionTexture != nil {
+		strength := 1.0
+		if material.OcclusionTexture.Strength != nil {
+			strength = *material.OcclusionTexture.Strength
+		}
+		connect(textureInput{
+			shader:     "occlusionTexture",
+			info:       material.OcclusionTexture,
+			colorSpace: "raw",
+			scale:      [4]float64{strength, strength, strength, 1},
+			bias:       [4]float64{1 - strength, 1 - strength, 1 - strength, 0},
+		}, "occlusion", "r")
+	}
+	if material.EmissiveTexture != nil {
+		connect(textureInput{shader: "emissiveTexture", info: material.EmissiveTexture, colorSpace: "sRGB", scale: [4]float64{emissive[0], emissive[1], emissive[2], 1}}, "emissiveColor", "rgb")
+	}
+
+	c.line("")
+	c.line(`def Material "%s"`, primName)
+	c.open("{")
+	c.line("token outputs:surface.connect = <%s/PreviewSurface.outputs:surface>", path)
+	c.line("")
+	c.line(`def Shader "PreviewSurface"`)
+	c.open("{")
+	c.line(`uniform token info:id = "UsdPreviewSurface"`)
+	value := func(declaration string, input string, constant string) {
+		if source, ok := inputs[input]; ok {
+			c.line("%s inputs:%s.connect = <%s>", declaration, input, source)
+		} else if constant != "" {
+			c.line("%s inputs:%s = %s", declaration, input, constant)
+		}
+	}
+	value("color3f", "diffuseColor", fmt.Sprintf("(%s)", floats64(baseColor[:3])))
+	value("float", "metallic", formatFloat(metallic))
+	value("float", "roughness", formatFloat(roughness))
+	value("color3f", "emissiveColor", fmt.Sprintf("(%s)", floats64(emissive[:])))
+	value("normal3f", "normal", "")
+	value("float", "occlusion", "")
+	switch material.AlphaMode {
+	case "BLEND":
+		value("float", "opacity", formatFloat(baseColor[3]))
+	case "MASK":
+		value("float", "opacity", formatFloat(baseColor[3]))
+		cutoff := 0.5
+		if material.AlphaCutoff != nil {
+			cutoff = *material.AlphaCutoff
+		}
+		c.line("float inputs:opacityThreshold = %s", formatFloat(cutoff))
+	}
+	c.line("int inputs:useSpecularWorkflow = 0")
+	c.line("token outputs:surface")
+	c.close("}")
+
+	readers := map[int]bool{}
+	for _, texture := range textures {
+		readers[texture.info.TexCoord] = true
+	}
+	for set := 0; set <= 1; set++ {
+		if !readers[set] {
+			continue
+		}
+		c.line("")
+		c.line(`def Shader "%s"`, primvarReader(set))
+		c.open("{")
+		c.line(`uniform token info:id = "UsdPrimvarReader_float2"`)
+		c.line(`string inputs:varname = "%s"`, primvarName(set))
+		c.line("float2 outputs:result")
+		c.close("}")
+	}
+	for _, texture := range textures {
+		c.textureShader(path, texture)
+	}
+	c.close("}")
+}
+
+func (c *converter) textureShader(materialPath string, texture textureInput) {
+	file, _ := c.texturePath(texture.info)
+	wrapS, wrapT := "repeat", "repeat"
+	doc := c.model.Document
+	if sampler := doc.Textures[texture.info.Index].Sampler; sampler != nil && *sampler >= 0 && *sampler < len(doc.Samplers) {
+		if mode, ok := wrapModes[doc.Samplers[*sampler].WrapS]; ok {
+			wrapS = mode
+		}
+		if mode, ok := wrapModes[doc.Samplers[*sampler].WrapT]; ok {
+			wrapT = mode
+		}
+	}
+
+	c.line("")
+	c.line(`def Shader "%s"`, texture.shader)
+	c.open("{")
+	c.line(`uniform token info:id = "UsdUVTexture"`)
+	c.line("asset inputs:file = @%s@", file)
+	c.line("float2 inputs:st.connect = <%s/%s.outputs:result>", materialPath, primvarReader(texture.info.TexCoord))
+	c.line(`token inputs:sourceColorSpace = "%s"`, texture.colorSpace)
+	c.line(`token inputs:wrapS = "%s"`, wrapS)
+	c.line(`token inputs:wrapT = "%s"`, wrapT)
+	if texture.scale != [4]float64{1, 1, 1, 1} {
+		c.line("float4 inputs:scale = (%s)", floats64(texture.scale[:]))
+	}
+	if texture.bias != [4]float64{} {
+		c.line("float4 inputs:bias = (%s)", floats64(texture.bias[:]))
+	}
+	c.line("float3 outputs:rgb")
+	c.line("float outputs:r")
+	c.line("float outputs:g")
+	c.line("float outputs:b")
+	c.line("float outputs:a")
+	c.close("}")
+}
+
+// texturePath returns where the image of a texture is stored in the package,
+// adding it on first use
+func (c *converter) texturePath(info *gltf.TextureInfo) (string, bool) {
+	doc := c.model.Document
+	if info.Index < 0 || info.Index >= len(doc.Textures) || info.TexCoord > 1 {
+		return "", false
+	}
+	source := doc.Textures[info.Index].Source
+	if source == nil || *source < 0 || *source >= len(c.model.Images) {
+		return "", false
+	}
+	if path, ok := c.textures[*source]; ok {
+		return path, path != ""
+	}
+	image := c.model.Images[*source]
+	extension, ok := textureMimeTypes[image.MimeType]
+	if !ok {
+		c.textures[*source] = ""
+		return "", false
+	}
+	stem := identifier(doc.Images[*source].Name, fmt.Sprintf("image_%d", *source))
+	path := "textures/" + uniqueName(c.fileNames, stem) + extension
+	c.textures[*source] = path
+	c.files = append(c.files, File{Path: path, Data: image.Data})
+	return path, true
+}
+
+func primvarName(set int) string {
+	if set == 0 {
+		return "st"
+	}
+	return fmt.Sprintf("st%d", set)
+}
+
+func primvarReader(set int) string {
+	return primvarName(set) + "Reader"
+}
+
+var invalidIdentifierChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// identifier turns a glTF name into a valid USD prim name
+func identifier(name string, fallback string) string {
+	name = invalidIdentifierChars.ReplaceAllString(name, "_")
+	if name == "" || strings.Trim(name, "_") == "" {
+		return fallback
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// uniqueName suffixes name until it is not in taken, and takes it
+func uniqueName(taken map[string]bool, name string) string {
+	candidate := name
+	for suffix := 1; taken[candidate]; suffix++ {
+		candidate = fmt.Sprintf("%s_%d", name, suffix)
+	}
+	taken[candidate] = true
+	return candidate
+}
+
+func extent(points []float32) ([3]float32, [3]float32) {
+	minimum := [3]float32{points[0], points[1], points[2]}
+	maximum := minimum
+	for i := 0; i+2 < len(points); i += 3 {
+		for axis := 0; axis < 3; axis++ {
+			minimum[axis] = min(minimum[axis], points[i+axis])
+			maximum[axis] = max(maximum[axis], points[i+axis])
+		}
+	}
+	return minimum, maximum
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 32)
+}
+
+func floats(values []float32) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = strconv.FormatFloat(float64(value), 'g', -1, 32)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func floats64(values []float64) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func uints(values []uint32) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = strconv.FormatUint(uint64(value), 10)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// tuples formats values as (a, b, c) groups of size components
+func tuples(values []float32, components int) string {
+	parts := make([]string, 0, len(values)/components)
+	for i := 0; i+components <= len(values); i += components {
+		parts = append(parts, "("+floats(values[i:i+components])+")")
+	}
+	return strings.Join(parts, ", ")
+}
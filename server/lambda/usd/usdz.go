@@ -0,0 +1,93 @@
+package usd
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"path"
+	"strings"
+)
+
+const (
+	// usdzAlignment is the boundary the data of every entry starts on, so
+	// readers can map files in place
+	usdzAlignment   = 64
+	localHeaderSize = 30
+	// paddingExtraID tags the extra field that pads local headers, the same
+	// one Apple's usdzip uses
+	paddingExtraID = 0x1986
+)
+
+var layerExtensions = []string{".usda", ".usdc", ".usd"}
+
+// Package writes files into a USDZ archive: an uncompressed zip whose first
+// entry is the root layer and whose entries all start on a 64 byte boundary
+func Package(files []File) ([]byte, error) {
+	if len(files) == 0 || !isLayer(files[0].Path) {
+		return nil, fmt.Errorf("the first file of a USDZ package must be a USD layer")
+	}
+
+	var out bytes.Buffer
+	writer := zip.NewWriter(&out)
+	offset := 0
+	seen := map[string]bool{}
+	for _, file := range files {
+		if file.Path == "" || path.IsAbs(file.Path) || path.Clean(file.Path) != file.Path || strings.HasPrefix(file.Path, "../") {
+			return nil, fmt.Errorf("%q is not a relative package path", file.Path)
+		}
+		if seen[file.Path] {
+			return nil, fmt.Errorf("%s appears twice in the package", file.Path)
+		}
+		seen[file.Path] = true
+
+		header := &zip.FileHeader{
+			Name:               file.Path,
+			Method:             zip.Store,
+			CRC32:              crc32.ChecksumIEEE(file.Data),
+			CompressedSize64:   uint64(len(file.Data)),
+			UncompressedSize64: uint64(len(file.Data)),
+			Extra:              padding(offset + localHeaderSize + len(file.Path)),
+		}
+		entry, err := writer.CreateRaw(header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := entry.Write(file.Data); err != nil {
+			return nil, err
+		}
+		offset += localHeaderSize + len(file.Path) + len(header.Extra) + len(file.Data)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// padding returns the extra field that moves data starting at offset to the
+// next 64 byte boundary, or nothing when it is already aligned
+func padding(offset int) []byte {
+	size := (usdzAlignment - offset%usdzAlignment) % usdzAlignment
+	if size == 0 {
+		return nil
+	}
+	// An extra field needs four bytes for its id and length
+	if size < 4 {
+		size += usdzAlignment
+	}
+	extra := make([]byte, size)
+	binary.LittleEndian.PutUint16(extra[0:2], paddingExtraID)
+	binary.LittleEndian.PutUint16(extra[2:4], uint16(size-4))
+	return extra
+}
+
+func isLayer(name string) bool {
+	extension := strings.ToLower(path.Ext(name))
+	for _, layer := range layerExtensions {
+		if extension == layer {
+			return true
+		}
+	}
+	return false
+}
@@ -58,7 +58,9 @@ resource "aws_iam_role_policy" "lambda_app_s3_policy" {
         Action = [
           "s3:GetObject",
           "s3:PutObject",
-          "s3:DeleteObject"
+          "s3:DeleteObject",
+          "s3:ListMultipartUploadParts",
+          "s3:AbortMultipartUpload"
         ],
         Resource = "arn:aws:s3:::${var.model_s3_bucket}/*"
       },
@@ -74,7 +76,9 @@ resource "aws_iam_role_policy" "lambda_app_s3_policy" {
         ],
         Resource = [
           aws_dynamodb_table.job_history_table.arn,
-          "${aws_dynamodb_table.job_history_table.arn}/index/*"
+          "${aws_dynamodb_table.job_history_table.arn}/index/*",
+          aws_dynamodb_table.idempotency_table.arn,
+          aws_dynamodb_table.upload_sessions_table.arn
         ]
       }
     ]
@@ -89,8 +93,8 @@ resource "aws_apigatewayv2_api" "model_loader_api" {
   protocol_type = "HTTP"
   cors_configuration {
     allow_origins     = concat([var.client_domain], var.allowed_origins)
-    allow_methods     = ["GET", "POST", "OPTIONS"]
-    allow_headers     = ["Content-Type", "x-api-key", "Authorization"]
+    allow_methods     = ["GET", "POST", "DELETE", "OPTIONS"]
+    allow_headers     = ["Content-Type", "x-api-key", "Authorization", "Idempotency-Key"]
     allow_credentials = true
     max_age           = 300
   }
@@ -129,6 +133,34 @@ resource "aws_apigatewayv2_integration" "post_model" {
   integration_uri  = aws_lambda_function.model_loader_util.invoke_arn
 }
 
+# Add POST /3d-model/batch route and integration
+resource "aws_apigatewayv2_route" "post_model_batch" {
+  api_id    = aws_apigatewayv2_api.model_loader_api.id
+  route_key = "POST /3d-model/batch"
+  target    = "integrations/${aws_apigatewayv2_integration.post_model_batch.id}"
+  authorization_type = "NONE"
+}
+
+resource "aws_apigatewayv2_integration" "post_model_batch" {
+  api_id           = aws_apigatewayv2_api.model_loader_api.id
+  integration_type = "AWS_PROXY"
+  integration_uri  = aws_lambda_function.model_loader_util.invoke_arn
+}
+
+# Add GET /3d-model/batch/{batchId} route and integration
+resource "aws_apigatewayv2_route" "get_model_batch" {
+  api_id    = aws_apigatewayv2_api.model_loader_api.id
+  route_key = "GET /3d-model/batch/{batchId}"
+  target    = "integrations/${aws_apigatewayv2_integration.get_model_batch.id}"
+  authorization_type = "NONE"
+}
+
+resource "aws_apigatewayv2_integration" "get_model_batch" {
+  api_id           = aws_apigatewayv2_api.model_loader_api.id
+  integration_type = "AWS_PROXY"
+  integration_uri  = aws_lambda_function.model_loader_util.invoke_arn
+}
+
 # Add PUT /3d-model/{id} route and integration for direct S3 upload via Lambda
 resource "aws_apigatewayv2_route" "put_model" {
   api_id    = aws_apigatewayv2_api.model_loader_api.id
@@ -143,6 +175,160 @@ resource "aws_apigatewayv2_integration" "put_model" {
   integration_uri  = aws_lambda_function.model_loader_util.invoke_arn
 }
 
+# Add DELETE /3d-model/{id} route and integration
+resource "aws_apigatewayv2_route" "delete_model" {
+  api_id    = aws_apigatewayv2_api.model_loader_api.id
+  route_key = "DELETE /3d-model/{id}"
+  target    = "integrations/${aws_apigatewayv2_integration.delete_model.id}"
+  authorization_type = "NONE"
+}
+
+resource "aws_apigatewayv2_integration" "delete_model" {
+  api_id           = aws_apigatewayv2_api.model_loader_api.id
+  integration_type = "AWS_PROXY"
+  integration_uri  = aws_lambda_function.model_loader_util.invoke_arn
+}
+
+# Add GET /jobs/{jobId} route and integration
+resource "aws_apigatewayv2_route" "get_job" {
+  api_id    = aws_apigatewayv2_api.model_loader_api.id
+  route_key = "GET /jobs/{jobId}"
+  target    = "integrations/${aws_apigatewayv2_integration.get_job.id}"
+  authorization_type = "NONE"
+}
+
+resource "aws_apigatewayv2_integration" "get_job" {
+  api_id           = aws_apigatewayv2_api.model_loader_api.id
+  integration_type = "AWS_PROXY"
+  integration_uri  = aws_lambda_function.model_loader_util.invoke_arn
+}
+
+# Add POST /3d-model/{id}/uploads route and integration
+resource "aws_apigatewayv2_route" "create_upload" {
+  api_id    = aws_apigatewayv2_api.model_loader_api.id
+  route_key = "POST /3d-model/{id}/uploads"
+  target    = "integrations/${aws_apigatewayv2_integration.create_upload.id}"
+  authorization_type = "NONE"
+}
+
+resource "aws_apigatewayv2_integration" "create_upload" {
+  api_id           = aws_apigatewayv2_api.model_loader_api.id
+  integration_type = "AWS_PROXY"
+  integration_uri  = aws_lambda_function.model_loader_util.invoke_arn
+}
+
+# Add GET /3d-model/{id}/stats route and integration
+resource "aws_apigatewayv2_route" "get_model_stats" {
+  api_id    = aws_apigatewayv2_api.model_loader_api.id
+  route_key = "GET /3d-model/{id}/stats"
+  target    = "integrations/${aws_apigatewayv2_integration.get_model_stats.id}"
+  authorization_type = "NONE"
+}
+
+resource "aws_apigatewayv2_integration" "get_model_stats" {
+  api_id           = aws_apigatewayv2_api.model_loader_api.id
+  integration_type = "AWS_PROXY"
+  integration_uri  = aws_lambda_function.model_loader_util.invoke_arn
+}
+
+# Add POST /3d-model/{id}/lods route and integration
+resource "aws_apigatewayv2_route" "post_model_lods" {
+  api_id    = aws_apigatewayv2_api.model_loader_api.id
+  route_key = "POST /3d-model/{id}/lods"
+  target    = "integrations/${aws_apigatewayv2_integration.post_model_lods.id}"
+  authorization_type = "NONE"
+}
+
+resource "aws_apigatewayv2_integration" "post_model_lods" {
+  api_id           = aws_apigatewayv2_api.model_loader_api.id
+  integration_type = "AWS_PROXY"
+  integration_uri  = aws_lambda_function.model_loader_util.invoke_arn
+}
+
+# Add GET /3d-model/{id}/uploads/{uploadId} route and integration
+resource "aws_apigatewayv2_route" "get_upload" {
+  api_id    = aws_apigatewayv2_api.model_loader_api.id
+  route_key = "GET /3d-model/{id}/uploads/{uploadId}"
+  target    = "integrations/${aws_apigatewayv2_integration.get_upload.id}"
+  authorization_type = "NONE"
+}
+
+resource "aws_apigatewayv2_integration" "get_upload" {
+  api_id           = aws_apigatewayv2_api.model_loader_api.id
+  integration_type = "AWS_PROXY"
+  integration_uri  = aws_lambda_function.model_loader_util.invoke_arn
+}
+
+# Add POST /3d-model/{id}/uploads/{uploadId}/complete route and integration
+resource "aws_apigatewayv2_route" "complete_upload" {
+  api_id    = aws_apigatewayv2_api.model_loader_api.id
+  route_key = "POST /3d-model/{id}/uploads/{uploadId}/complete"
+  target    = "integrations/${aws_apigatewayv2_integration.complete_upload.id}"
+  authorization_type = "NONE"
+}
+
+resource "aws_apigatewayv2_integration" "complete_upload" {
+  api_id           = aws_apigatewayv2_api.model_loader_api.id
+  integration_type = "AWS_PROXY"
+  integration_uri  = aws_lambda_function.model_loader_util.invoke_arn
+}
+
+# Add DELETE /3d-model/{id}/uploads/{uploadId} route and integration
+resource "aws_apigatewayv2_route" "abort_upload" {
+  api_id    = aws_apigatewayv2_api.model_loader_api.id
+  route_key = "DELETE /3d-model/{id}/uploads/{uploadId}"
+  target    = "integrations/${aws_apigatewayv2_integration.abort_upload.id}"
+  authorization_type = "NONE"
+}
+
+resource "aws_apigatewayv2_integration" "abort_upload" {
+  api_id           = aws_apigatewayv2_api.model_loader_api.id
+  integration_type = "AWS_PROXY"
+  integration_uri  = aws_lambda_function.model_loader_util.invoke_arn
+}
+
+# Add POST /jobs/{jobId}/cancel route and integration
+resource "aws_apigatewayv2_route" "cancel_job" {
+  api_id    = aws_apigatewayv2_api.model_loader_api.id
+  route_key = "POST /jobs/{jobId}/cancel"
+  target    = "integrations/${aws_apigatewayv2_integration.cancel_job.id}"
+  authorization_type = "NONE"
+}
+
+resource "aws_apigatewayv2_integration" "cancel_job" {
+  api_id           = aws_apigatewayv2_api.model_loader_api.id
+  integration_type = "AWS_PROXY"
+  integration_uri  = aws_lambda_function.model_loader_util.invoke_arn
+}
+
+# Add POST /jobs/{jobId}/retry route and integration
+resource "aws_apigatewayv2_route" "retry_job" {
+  api_id    = aws_apigatewayv2_api.model_loader_api.id
+  route_key = "POST /jobs/{jobId}/retry"
+  target    = "integrations/${aws_apigatewayv2_integration.retry_job.id}"
+  authorization_type = "NONE"
+}
+
+resource "aws_apigatewayv2_integration" "retry_job" {
+  api_id           = aws_apigatewayv2_api.model_loader_api.id
+  integration_type = "AWS_PROXY"
+  integration_uri  = aws_lambda_function.model_loader_util.invoke_arn
+}
+
+# Add POST /uploads route and integration
+resource "aws_apigatewayv2_route" "create_upload_session" {
+  api_id    = aws_apigatewayv2_api.model_loader_api.id
+  route_key = "POST /uploads"
+  target    = "integrations/${aws_apigatewayv2_integration.create_upload_session.id}"
+  authorization_type = "NONE"
+}
+
+resource "aws_apigatewayv2_integration" "create_upload_session" {
+  api_id           = aws_apigatewayv2_api.model_loader_api.id
+  integration_type = "AWS_PROXY"
+  integration_uri  = aws_lambda_function.model_loader_util.invoke_arn
+}
+
 # Add GET /3d-models route and integration
 resource "aws_apigatewayv2_route" "get_models" {
   api_id    = aws_apigatewayv2_api.model_loader_api.id
@@ -157,6 +343,20 @@ resource "aws_apigatewayv2_integration" "get_models" {
   integration_uri  = aws_lambda_function.model_loader_util.invoke_arn
 }
 
+# Add GET /formats route and integration
+resource "aws_apigatewayv2_route" "get_formats" {
+  api_id    = aws_apigatewayv2_api.model_loader_api.id
+  route_key = "GET /formats"
+  target    = "integrations/${aws_apigatewayv2_integration.get_formats.id}"
+  authorization_type = "NONE"
+}
+
+resource "aws_apigatewayv2_integration" "get_formats" {
+  api_id           = aws_apigatewayv2_api.model_loader_api.id
+  integration_type = "AWS_PROXY"
+  integration_uri  = aws_lambda_function.model_loader_util.invoke_arn
+}
+
 ###########################################
 # Model Loader Lambda Resources
 ###########################################
@@ -168,7 +368,8 @@ resource "aws_lambda_function" "model_loader_util" {
   filename      = "${path.module}/lambda/model-loader-util/model-loader-util.zip"
   source_code_hash = filebase64sha256("${path.module}/lambda/model-loader-util/model-loader-util.zip")
 
-  timeout = 10
+  # GET /jobs/{jobId}?waitSeconds= long-polls for up to 25 seconds
+  timeout = 30
   memory_size = 128
 
   environment {
@@ -176,7 +377,20 @@ resource "aws_lambda_function" "model_loader_util" {
       model_s3_bucket = var.model_s3_bucket
       api_key_value = var.api_key_value
       blender_jobs_queue_url = aws_sqs_queue.blender_jobs.url
+      native_jobs_queue_url = aws_sqs_queue.native_jobs.url
+      http_jobs_queue_url = aws_sqs_queue.http_jobs.url
+      http_converters = length(var.http_converters) > 0 ? jsonencode(var.http_converters) : ""
       job_history_table = aws_dynamodb_table.job_history_table.name
+      idempotency_table = aws_dynamodb_table.idempotency_table.name
+      idempotency_window_hours = var.idempotency_window_hours
+      max_job_attempts = var.max_job_attempts
+      upload_sessions_table = aws_dynamodb_table.upload_sessions_table.name
+      max_upload_size_bytes = var.max_upload_size_bytes
+      # Transition flag, conversions otherwise need an uploadSessionId
+      allow_raw_source_keys = var.allow_raw_source_keys ? "true" : "false"
+      input_format_matrix = length(var.input_format_matrix) > 0 ? jsonencode(var.input_format_matrix) : ""
+      quality_budgets = length(var.quality_budgets) > 0 ? jsonencode(var.quality_budgets) : ""
+      api_key_tenants = length(var.api_key_tenants) > 0 ? jsonencode(var.api_key_tenants) : ""
     }
   }
 
@@ -303,6 +517,11 @@ resource "aws_dynamodb_table" "job_history_table" {
     type = "S"
   }
 
+  attribute {
+    name = "batchId"
+    type = "S"
+  }
+
   global_secondary_index {
     name               = "ModelJobTypeIndex"
     hash_key           = "modelId"
@@ -328,6 +547,19 @@ resource "aws_dynamodb_table" "job_history_table" {
     projection_type    = "ALL"
   }
 
+  # Sparse index, only jobs submitted through POST /3d-model/batch have a batchId
+  global_secondary_index {
+    name               = "BatchIndex"
+    hash_key           = "batchId"
+    projection_type    = "ALL"
+  }
+
+  # Pending rows written by POST /3d-model expire unless the enqueue is confirmed
+  ttl {
+    attribute_name = "expiresAt"
+    enabled        = true
+  }
+
   timeouts {
     create = "30m"
     update = "30m"
@@ -337,6 +569,66 @@ resource "aws_dynamodb_table" "job_history_table" {
   tags = local.tags
 }
 
+# Idempotency-Key values sent with POST /3d-model, kept for idempotency_window_hours
+resource "aws_dynamodb_table" "idempotency_table" {
+  name           = "${var.project_name}-${var.environment}-idempotency-table"
+  billing_mode   = "PAY_PER_REQUEST"
+  hash_key       = "idempotencyKey"
+
+  attribute {
+    name = "idempotencyKey"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expiresAt"
+    enabled        = true
+  }
+
+  tags = local.tags
+}
+
+# Upload sessions from POST /uploads, kept until retainUntil so conversions can reference them
+resource "aws_dynamodb_table" "upload_sessions_table" {
+  name           = "${var.project_name}-${var.environment}-upload-sessions-table"
+  billing_mode   = "PAY_PER_REQUEST"
+  hash_key       = "sessionId"
+
+  attribute {
+    name = "sessionId"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "retainUntil"
+    enabled        = true
+  }
+
+  tags = local.tags
+}
+
+# Multipart uploads from POST /3d-model/{id}/uploads that are never completed or aborted.
+# This resource owns the whole lifecycle configuration of the model bucket, which
+# is created outside this stack, so it is only created when
+# manage_model_bucket_lifecycle is set. Add any rules the bucket already has here
+# and import them first:
+#   terraform import 'aws_s3_bucket_lifecycle_configuration.model_bucket[0]' <bucket>
+resource "aws_s3_bucket_lifecycle_configuration" "model_bucket" {
+  count  = var.manage_model_bucket_lifecycle ? 1 : 0
+  bucket = var.model_s3_bucket
+
+  rule {
+    id     = "abort-incomplete-multipart-uploads"
+    status = "Enabled"
+
+    filter {}
+
+    abort_incomplete_multipart_upload {
+      days_after_initiation = 7
+    }
+  }
+}
+
 resource "aws_iam_role_policy_attachment" "connect_lambda_dynamodb" {
   role       = aws_iam_role.lambda_app_exec.name
   policy_arn = aws_iam_policy.dynamodb_access.arn
@@ -421,6 +713,7 @@ resource "aws_lambda_function" "websocket_connect" {
     variables = {
       connections_table = aws_dynamodb_table.websocket_connections.name
       api_key_value = var.api_key_value
+      api_key_tenants = length(var.api_key_tenants) > 0 ? jsonencode(var.api_key_tenants) : ""
     }
   }
 
@@ -439,6 +732,7 @@ resource "aws_lambda_function" "websocket_disconnect" {
     variables = {
       connections_table = aws_dynamodb_table.websocket_connections.name
       api_key_value = var.api_key_value
+      api_key_tenants = length(var.api_key_tenants) > 0 ? jsonencode(var.api_key_tenants) : ""
     }
   }
 
@@ -471,7 +765,11 @@ resource "aws_iam_role_policy" "lambda_sqs_policy" {
           "sqs:SendMessage",
           "sqs:GetQueueUrl"
         ]
-        Resource = aws_sqs_queue.blender_jobs.arn
+        Resource = [
+          aws_sqs_queue.blender_jobs.arn,
+          aws_sqs_queue.native_jobs.arn,
+          aws_sqs_queue.http_jobs.arn
+        ]
       }
     ]
   })
@@ -493,7 +791,9 @@ resource "aws_lambda_function" "blender" {
     variables = {
       model_s3_bucket                = var.model_s3_bucket
       blender_jobs_queue_url   = aws_sqs_queue.blender_jobs.url
+      native_jobs_queue_url    = aws_sqs_queue.native_jobs.url
       notification_queue_url   = aws_sqs_queue.notification_queue.url
+      job_history_table        = aws_dynamodb_table.job_history_table.name
     }
   }
 }
@@ -549,7 +849,10 @@ resource "aws_iam_role_policy" "lambda_blender_s3_sqs_policy" {
           "sqs:SendMessage",
           "sqs:GetQueueUrl"
         ],
-        Resource = aws_sqs_queue.notification_queue.arn
+        Resource = [
+          aws_sqs_queue.notification_queue.arn,
+          aws_sqs_queue.native_jobs.arn
+        ]
       },
       {
         Effect = "Allow",
@@ -559,6 +862,230 @@ resource "aws_iam_role_policy" "lambda_blender_s3_sqs_policy" {
           "sqs:GetQueueAttributes"
         ],
         Resource = aws_sqs_queue.blender_jobs.arn
+      },
+      {
+        Effect = "Allow",
+        Action = [
+          "dynamodb:GetItem"
+        ],
+        Resource = aws_dynamodb_table.job_history_table.arn
+      }
+    ]
+  })
+}
+
+###########################################
+# Native Converter Resources
+###########################################
+
+# Jobs of converters registered for the native backend, such as glTF
+# repackaging and USDZ packaging, which run in Go without Blender. The Blender
+# worker also queues post-processing steps of its exports here.
+resource "aws_sqs_queue" "native_jobs" {
+  name = "${var.project_name}-${var.environment}-native-jobs"
+  visibility_timeout_seconds = 360
+  message_retention_seconds  = 86400
+  delay_seconds              = 0
+  receive_wait_time_seconds  = 20
+  tags = local.tags
+}
+
+resource "aws_lambda_function" "converter" {
+  function_name = "${var.project_name}-${var.environment}-converter"
+  role          = aws_iam_role.lambda_converter_exec.arn
+  handler       = "bootstrap"
+  runtime       = "provided.al2"
+  filename      = "${path.module}/lambda/converter/converter.zip"
+  source_code_hash = filebase64sha256("${path.module}/lambda/converter/converter.zip")
+  timeout       = 60
+  # Sources of up to 256 MiB are converted in memory
+  memory_size   = 1536
+
+  environment {
+    variables = {
+      model_s3_bucket        = var.model_s3_bucket
+      notification_queue_url = aws_sqs_queue.notification_queue.url
+      job_history_table      = aws_dynamodb_table.job_history_table.name
+    }
+  }
+
+  tags = local.tags
+}
+
+resource "aws_lambda_event_source_mapping" "native_jobs_trigger" {
+  event_source_arn = aws_sqs_queue.native_jobs.arn
+  function_name    = aws_lambda_function.converter.arn
+  batch_size       = 1
+  enabled          = true
+}
+
+resource "aws_iam_role" "lambda_converter_exec" {
+  name = "3d-model-loader-${var.environment}-lambda-converter-exec-role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17",
+    Statement = [{
+      Action    = "sts:AssumeRole",
+      Effect    = "Allow",
+      Principal = {
+        Service = "lambda.amazonaws.com"
+      }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "lambda_converter_policy" {
+  role       = aws_iam_role.lambda_converter_exec.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_iam_role_policy" "lambda_converter_s3_sqs_policy" {
+  name = "${var.project_name}-${var.environment}-lambda-converter-s3-sqs-policy"
+  role = aws_iam_role.lambda_converter_exec.id
+
+  policy = jsonencode({
+    Version = "2012-10-17",
+    Statement = [
+      {
+        Effect = "Allow",
+        Action = [
+          "s3:GetObject",
+          "s3:PutObject",
+          "s3:DeleteObject"
+        ],
+        Resource = "arn:aws:s3:::${var.model_s3_bucket}/*"
+      },
+      {
+        Effect = "Allow",
+        Action = [
+          "sqs:SendMessage",
+          "sqs:GetQueueUrl"
+        ],
+        Resource = aws_sqs_queue.notification_queue.arn
+      },
+      {
+        Effect = "Allow",
+        Action = [
+          "sqs:ReceiveMessage",
+          "sqs:DeleteMessage",
+          "sqs:GetQueueAttributes"
+        ],
+        Resource = aws_sqs_queue.native_jobs.arn
+      },
+      {
+        Effect = "Allow",
+        Action = [
+          "dynamodb:GetItem"
+        ],
+        Resource = aws_dynamodb_table.job_history_table.arn
+      }
+    ]
+  })
+}
+
+###########################################
+# HTTP Converter Resources
+###########################################
+
+# Jobs of converters registered for the http backend through
+# var.http_converters, which the dispatcher posts to external services
+resource "aws_sqs_queue" "http_jobs" {
+  name = "${var.project_name}-${var.environment}-http-jobs"
+  visibility_timeout_seconds = 360
+  message_retention_seconds  = 86400
+  delay_seconds              = 0
+  receive_wait_time_seconds  = 20
+  tags = local.tags
+}
+
+resource "aws_lambda_function" "http_dispatcher" {
+  function_name = "${var.project_name}-${var.environment}-http-dispatcher"
+  role          = aws_iam_role.lambda_http_dispatcher_exec.arn
+  handler       = "bootstrap"
+  runtime       = "provided.al2"
+  filename      = "${path.module}/lambda/http-dispatcher/http-dispatcher.zip"
+  source_code_hash = filebase64sha256("${path.module}/lambda/http-dispatcher/http-dispatcher.zip")
+  # The converter has up to 270 seconds to answer
+  timeout       = 300
+  # Converted files of up to 512 MiB are held in memory before the upload
+  memory_size   = 1536
+
+  environment {
+    variables = {
+      model_s3_bucket        = var.model_s3_bucket
+      notification_queue_url = aws_sqs_queue.notification_queue.url
+      job_history_table      = aws_dynamodb_table.job_history_table.name
+      http_converters        = length(var.http_converters) > 0 ? jsonencode(var.http_converters) : ""
+    }
+  }
+
+  tags = local.tags
+}
+
+resource "aws_lambda_event_source_mapping" "http_jobs_trigger" {
+  event_source_arn = aws_sqs_queue.http_jobs.arn
+  function_name    = aws_lambda_function.http_dispatcher.arn
+  batch_size       = 1
+  enabled          = true
+}
+
+resource "aws_iam_role" "lambda_http_dispatcher_exec" {
+  name = "3d-model-loader-${var.environment}-lambda-http-dispatcher-exec-role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17",
+    Statement = [{
+      Action    = "sts:AssumeRole",
+      Effect    = "Allow",
+      Principal = {
+        Service = "lambda.amazonaws.com"
+      }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "lambda_http_dispatcher_policy" {
+  role       = aws_iam_role.lambda_http_dispatcher_exec.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_iam_role_policy" "lambda_http_dispatcher_s3_sqs_policy" {
+  name = "${var.project_name}-${var.environment}-lambda-http-dispatcher-s3-sqs-policy"
+  role = aws_iam_role.lambda_http_dispatcher_exec.id
+
+  policy = jsonencode({
+    Version = "2012-10-17",
+    Statement = [
+      {
+        Effect = "Allow",
+        Action = [
+          # GetObject signs the source URLs the converters download from
+          "s3:GetObject",
+          "s3:PutObject"
+        ],
+        Resource = "arn:aws:s3:::${var.model_s3_bucket}/*"
+      },
+      {
+        Effect = "Allow",
+        Action = [
+          "sqs:SendMessage",
+          "sqs:GetQueueUrl"
+        ],
+        Resource = aws_sqs_queue.notification_queue.arn
+      },
+      {
+        Effect = "Allow",
+        Action = [
+          "sqs:ReceiveMessage",
+          "sqs:DeleteMessage",
+          "sqs:GetQueueAttributes"
+        ],
+        Resource = aws_sqs_queue.http_jobs.arn
+      },
+      {
+        Effect = "Allow",
+        Action = [
+          "dynamodb:GetItem"
+        ],
+        Resource = aws_dynamodb_table.job_history_table.arn
       }
     ]
   })
@@ -570,10 +1097,22 @@ resource "aws_iam_role_policy" "lambda_blender_s3_sqs_policy" {
 
 resource "aws_sqs_queue" "notification_queue" {
   name = "${var.project_name}-${var.environment}-notification-queue"
-  visibility_timeout_seconds = 30
+  # Must be at least the notification Lambda's timeout
+  visibility_timeout_seconds = 180
   message_retention_seconds = 86400 # 1 day
   delay_seconds = 0
   receive_wait_time_seconds = 20
+  # Notifications that keep failing are parked instead of retried for a day
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.notification_dlq.arn
+    maxReceiveCount     = 5
+  })
+  tags = local.tags
+}
+
+resource "aws_sqs_queue" "notification_dlq" {
+  name = "${var.project_name}-${var.environment}-notification-dlq"
+  message_retention_seconds = 1209600 # 14 days
   tags = local.tags
 }
 
@@ -589,12 +1128,17 @@ resource "aws_lambda_function" "notification" {
   filename      = "${path.module}/lambda/notification/notification.zip"
   source_code_hash = filebase64sha256("${path.module}/lambda/notification/notification.zip")
   depends_on = [aws_dynamodb_table.websocket_connections]
+  # glTF outputs of up to 256 MiB, and each of their buffers and images, are
+  # read into memory to validate them and compute model stats
+  timeout       = 120
+  memory_size   = 2048
   
   environment {
     variables = {
       connections_table = aws_dynamodb_table.websocket_connections.name
       websocket_api_endpoint = "https://${replace(aws_apigatewayv2_api.websocket_api.api_endpoint, "wss://", "")}/${aws_apigatewayv2_stage.websocket_api_stage.name}"
       job_history_table = aws_dynamodb_table.job_history_table.name
+      model_s3_bucket = var.model_s3_bucket
     }
   }
 
@@ -623,6 +1167,7 @@ resource "aws_iam_role_policy" "notification_lambda_policy" {
         Action = [
           "dynamodb:PutItem",
           "dynamodb:GetItem",
+          "dynamodb:UpdateItem",
           "dynamodb:Query",
           "dynamodb:Scan"
         ]
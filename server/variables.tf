@@ -32,6 +32,12 @@ variable "model_s3_bucket" {
   type        = string
 }
 
+variable "manage_model_bucket_lifecycle" {
+  description = "Let this stack own the lifecycle configuration of model_s3_bucket, replacing any rules it already has, to abort multipart uploads left incomplete for 7 days"
+  type        = bool
+  default     = false
+}
+
 variable "api_key_value" {
   description = "API key value for API Gateway"
   type        = string
@@ -46,4 +52,52 @@ variable "allowed_origins" {
 variable "blender_ecr_image" {
   description = "ECR image URI for the Blender Lambda container"
   type        = string
-}
\ No newline at end of file
+}
+variable "idempotency_window_hours" {
+  description = "How long an Idempotency-Key on POST /3d-model replays its original response"
+  type        = number
+  default     = 24
+}
+
+variable "max_job_attempts" {
+  description = "How many times a conversion can be attempted, including retries through POST /jobs/{jobId}/retry"
+  type        = number
+  default     = 3
+}
+
+variable "max_upload_size_bytes" {
+  description = "Largest source file an upload session from POST /uploads accepts"
+  type        = number
+  default     = 5368709120
+}
+
+variable "input_format_matrix" {
+  description = "Input formats conversions accept, mapped to the formats each may be converted to. Empty accepts every input format the worker reads, listed by GET /formats"
+  type        = map(list(string))
+  default     = {}
+}
+
+variable "api_key_tenants" {
+  description = "Further API keys, each mapped to the tenant whose quality_budgets apply to its jobs. api_key_value has no tenant and only gets the \"*\" budgets"
+  type        = map(string)
+  sensitive   = true
+  default     = {}
+}
+
+variable "quality_budgets" {
+  description = "Quality rule sets outputs are checked against, by tenantId and then output format. \"*\" matches any tenant or format. Empty checks nothing"
+  type        = any
+  default     = {}
+}
+
+variable "http_converters" {
+  description = "External converter services, each a converter entry with backend \"http\" and the endpoint the http-dispatcher posts its jobs to. They take over the pairs they are registered for"
+  type        = any
+  default     = []
+}
+
+variable "allow_raw_source_keys" {
+  description = "Let POST /3d-model and batch jobs name modelId and s3Key without an uploadSessionId, for clients of PUT /3d-model/{id} and the multipart uploads while they move to POST /uploads. The key must be the model's own upload and is checked against the input format's content types and max_upload_size_bytes. Off by default"
+  type        = bool
+  default     = false
+}